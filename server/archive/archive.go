@@ -0,0 +1,22 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package archive
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when requesting an object that does not exist.
+var ErrNotFound = errors.New("archive: object not found")
+
+// Archive is used to store data that has been moved out of the database.
+// Objects are identified by keys that can be listed by prefix. Put reads
+// exactly size bytes from the given reader.
+type Archive interface {
+	Put(key string, r io.Reader, size int64) error
+	Get(key string) ([]byte, error)
+	List(prefix string) ([]string, error)
+	Delete(key string) error
+}
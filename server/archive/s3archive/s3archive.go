@@ -0,0 +1,169 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package s3archive
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/offen/offen/server/archive"
+)
+
+// New creates a new Archive that stores objects in the given bucket of an S3
+// compatible storage. Objects are addressed using path style URLs so the
+// endpoint is expected to be the root URL of the storage service.
+func New(endpoint, region, bucket, accessKeyID, secretAccessKey string) archive.Archive {
+	return &s3Archive{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		bucket:   bucket,
+		client:   &http.Client{Timeout: time.Minute},
+		credentials: &credentials{
+			accessKeyID:     accessKeyID,
+			secretAccessKey: secretAccessKey,
+			region:          region,
+			service:         "s3",
+		},
+	}
+}
+
+const (
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	// minUploadRate is the rate in bytes per second uploads are expected
+	// to sustain at least.
+	minUploadRate = 256 * 1024
+)
+
+type s3Archive struct {
+	endpoint    string
+	bucket      string
+	client      *http.Client
+	credentials *credentials
+}
+
+func (s *s3Archive) Put(key string, r io.Reader, size int64) error {
+	res, err := s.do(http.MethodPut, key, nil, r, size)
+	if err != nil {
+		return fmt.Errorf("s3archive: error putting object %s: %w", key, err)
+	}
+	res.Body.Close()
+	return nil
+}
+
+func (s *s3Archive) Get(key string) ([]byte, error) {
+	res, err := s.do(http.MethodGet, key, nil, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("s3archive: error getting object %s: %w", key, err)
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("s3archive: error reading object %s: %w", key, err)
+	}
+	return data, nil
+}
+
+func (s *s3Archive) Delete(key string) error {
+	res, err := s.do(http.MethodDelete, key, nil, nil, 0)
+	if err != nil {
+		return fmt.Errorf("s3archive: error deleting object %s: %w", key, err)
+	}
+	res.Body.Close()
+	return nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *s3Archive) List(prefix string) ([]string, error) {
+	keys := []string{}
+	var token string
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		res, err := s.do(http.MethodGet, "", query, nil, 0)
+		if err != nil {
+			return nil, fmt.Errorf("s3archive: error listing objects: %w", err)
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(res.Body).Decode(&result)
+		res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3archive: error decoding object listing: %w", err)
+		}
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// do sends a signed request for the given key. Request bodies are streamed
+// and therefore not included in the signature. Responses with a status code
+// other than 2xx are returned as an error.
+func (s *s3Archive) do(method, key string, query url.Values, body io.Reader, size int64) (*http.Response, error) {
+	target, err := url.Parse(s.endpoint + "/" + s.bucket)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing endpoint: %w", err)
+	}
+	if key != "" {
+		target.Path += "/" + key
+	}
+	target.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	req, err := http.NewRequest(method, target.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	payloadHash := hashHex(nil)
+	if body != nil {
+		req.ContentLength = size
+		payloadHash = unsignedPayload
+	}
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	s.credentials.sign(req, payloadHash, time.Now())
+
+	res, err := s.clientFor(size).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		defer res.Body.Close()
+		if res.StatusCode == http.StatusNotFound {
+			return nil, archive.ErrNotFound
+		}
+		message, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf("unexpected status code %d: %s", res.StatusCode, message)
+	}
+	return res, nil
+}
+
+// clientFor returns the client to be used for uploading an object of the
+// given size. Uploads of large objects like backups take longer than the
+// default timeout, so it is extended according to the size of the object.
+func (s *s3Archive) clientFor(size int64) *http.Client {
+	if size <= 0 {
+		return s.client
+	}
+	client := *s.client
+	client.Timeout += time.Duration(size/minUploadRate) * time.Second
+	return &client
+}
@@ -0,0 +1,111 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package s3archive
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/archive"
+)
+
+type mockStorage struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (m *mockStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	switch {
+	case r.Method == http.MethodPut:
+		b, _ := ioutil.ReadAll(r.Body)
+		m.objects[key] = b
+	case r.Method == http.MethodDelete:
+		delete(m.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case r.URL.Query().Get("list-type") == "2":
+		w.Write([]byte("<ListBucketResult>"))
+		for k := range m.objects {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				w.Write([]byte("<Contents><Key>" + k + "</Key></Contents>"))
+			}
+		}
+		w.Write([]byte("<IsTruncated>false</IsTruncated></ListBucketResult>"))
+	default:
+		b, ok := m.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(b)
+	}
+}
+
+func TestS3Archive(t *testing.T) {
+	storage := &mockStorage{objects: map[string][]byte{}}
+	server := httptest.NewServer(storage)
+	defer server.Close()
+
+	a := New(server.URL, "us-east-1", "bucket", "key", "secret")
+	if err := a.Put("account-a/bundle", strings.NewReader("hello"), 5); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := a.Put("account-b/bundle", strings.NewReader("world"), 5); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	data, err := a.Get("account-a/bundle")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("Unexpected data %v", string(data))
+	}
+
+	keys, err := a.List("account-a/")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(keys, []string{"account-a/bundle"}) {
+		t.Errorf("Unexpected keys %v", keys)
+	}
+
+	if err := a.Delete("account-a/bundle"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if _, err := a.Get("account-a/bundle"); !errors.Is(err, archive.ErrNotFound) {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	unauthorized := New(server.URL, "us-east-1", "bucket", "other", "secret")
+	if err := unauthorized.Put("account-a/bundle", strings.NewReader("hello"), 5); err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
+
+func TestS3Archive_ClientFor(t *testing.T) {
+	s := New("http://localhost", "us-east-1", "bucket", "key", "secret").(*s3Archive)
+	if s.clientFor(0) != s.client {
+		t.Error("Expected default client to be used")
+	}
+	if timeout := s.clientFor(minUploadRate * 60).Timeout; timeout != 2*time.Minute {
+		t.Errorf("Unexpected timeout %v", timeout)
+	}
+	if s.client.Timeout != time.Minute {
+		t.Errorf("Expected default timeout to be unchanged, got %v", s.client.Timeout)
+	}
+}
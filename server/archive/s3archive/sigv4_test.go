@@ -0,0 +1,48 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package s3archive
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCredentials_Sign(t *testing.T) {
+	// test cases are taken from the AWS Signature Version 4 test suite
+	tests := []struct {
+		name              string
+		url               string
+		expectedSignature string
+	}{
+		{
+			"get vanilla",
+			"https://example.amazonaws.com/",
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			"query order",
+			"https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &credentials{
+				accessKeyID:     "AKIDEXAMPLE",
+				secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+				region:          "us-east-1",
+				service:         "service",
+			}
+			req, _ := http.NewRequest(http.MethodGet, test.url, nil)
+			c.sign(req, hashHex(nil), time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+			if header := req.Header.Get("Authorization"); header != test.expectedSignature {
+				t.Errorf("Expected %v, got %v", test.expectedSignature, header)
+			}
+			if date := req.Header.Get("X-Amz-Date"); date != "20150830T123600Z" {
+				t.Errorf("Unexpected date header %v", date)
+			}
+		})
+	}
+}
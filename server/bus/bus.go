@@ -0,0 +1,59 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package bus delivers internal messages, e.g. about changed records, to
+// interested subscribers, optionally across multiple instances.
+package bus
+
+import (
+	"sync"
+)
+
+// Bus delivers messages published on a topic to all subscribers of the
+// topic. Subscribers are called synchronously and must not block.
+type Bus interface {
+	Publish(topic string, payload []byte) error
+	// Subscribe calls fn for each message published on the given topic
+	// until the returned function is called.
+	Subscribe(topic string, fn func(payload []byte)) (unsubscribe func())
+}
+
+type localBus struct {
+	lock        sync.RWMutex
+	next        int
+	subscribers map[string]map[int]func([]byte)
+}
+
+// New returns a Bus that delivers messages inside the current process only.
+func New() Bus {
+	return &localBus{subscribers: map[string]map[int]func([]byte){}}
+}
+
+func (l *localBus) Publish(topic string, payload []byte) error {
+	l.lock.RLock()
+	var fns []func([]byte)
+	for _, fn := range l.subscribers[topic] {
+		fns = append(fns, fn)
+	}
+	l.lock.RUnlock()
+	for _, fn := range fns {
+		fn(payload)
+	}
+	return nil
+}
+
+func (l *localBus) Subscribe(topic string, fn func([]byte)) func() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	id := l.next
+	l.next++
+	if l.subscribers[topic] == nil {
+		l.subscribers[topic] = map[int]func([]byte){}
+	}
+	l.subscribers[topic][id] = fn
+	return func() {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		delete(l.subscribers[topic], id)
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package bus
+
+import (
+	"testing"
+)
+
+func TestLocalBus(t *testing.T) {
+	b := New()
+	var a, c []string
+	unsubscribe := b.Subscribe("topic-a", func(payload []byte) {
+		a = append(a, string(payload))
+	})
+	b.Subscribe("topic-c", func(payload []byte) {
+		c = append(c, string(payload))
+	})
+
+	b.Publish("topic-a", []byte("one"))
+	b.Publish("topic-b", []byte("two"))
+	unsubscribe()
+	b.Publish("topic-a", []byte("three"))
+
+	if len(a) != 1 || a[0] != "one" {
+		t.Errorf("Unexpected messages %v", a)
+	}
+	if len(c) != 0 {
+		t.Errorf("Unexpected messages %v", c)
+	}
+}
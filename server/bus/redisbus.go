@@ -0,0 +1,181 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const redisChannelPrefix = "offen:bus:"
+
+// redisReconnectInterval is the time waited before subscribing again after
+// the subscription has failed.
+const redisReconnectInterval = time.Second * 5
+
+type subscription interface {
+	Receive() (string, []byte, error)
+	Close() error
+}
+
+// RedisBus delivers messages to subscribers in the current process right
+// away and to subscribers of all other instances using Redis Pub/Sub. As
+// Pub/Sub does not store messages, messages published while an instance is
+// disconnected from Redis are lost to this instance.
+type RedisBus struct {
+	local     *localBus
+	origin    string
+	publish   func(channel string, message []byte) error
+	subscribe func(pattern string) (subscription, error)
+	onError   func(error)
+	stop      chan struct{}
+	lock      sync.Mutex
+	sub       subscription
+}
+
+type redisMessage struct {
+	Origin  string `json:"origin"`
+	Payload []byte `json:"payload"`
+}
+
+// NewRedis returns a Bus that shares messages with other instances using the
+// given Redis client. Errors that occur when receiving messages in the
+// background are passed to onError.
+func NewRedis(client *redis.Client, onError func(error)) (*RedisBus, error) {
+	return newRedisBus(
+		func(channel string, message []byte) error {
+			return client.Publish(context.Background(), channel, message).Err()
+		},
+		func(pattern string) (subscription, error) {
+			ctx := context.Background()
+			pubsub := client.PSubscribe(ctx, pattern)
+			// the first reply confirms the subscription
+			if _, err := pubsub.Receive(ctx); err != nil {
+				pubsub.Close()
+				return nil, err
+			}
+			return &redisSubscription{pubsub: pubsub}, nil
+		},
+		onError,
+	)
+}
+
+// redisSubscription implements subscription using a Redis Pub/Sub
+// subscription.
+type redisSubscription struct {
+	pubsub *redis.PubSub
+}
+
+func (r *redisSubscription) Receive() (string, []byte, error) {
+	message, err := r.pubsub.ReceiveMessage(context.Background())
+	if err != nil {
+		return "", nil, err
+	}
+	return message.Channel, []byte(message.Payload), nil
+}
+
+func (r *redisSubscription) Close() error {
+	return r.pubsub.Close()
+}
+
+func newRedisBus(publish func(string, []byte) error, subscribe func(string) (subscription, error), onError func(error)) (*RedisBus, error) {
+	origin, err := uuid.NewV4()
+	if err != nil {
+		return nil, fmt.Errorf("bus: error creating instance identifier: %w", err)
+	}
+	r := &RedisBus{
+		local:     New().(*localBus),
+		origin:    origin.String(),
+		publish:   publish,
+		subscribe: subscribe,
+		onError:   onError,
+		stop:      make(chan struct{}),
+	}
+	go r.receive()
+	return r, nil
+}
+
+// Publish delivers the message to local subscribers and publishes it to
+// all other instances.
+func (r *RedisBus) Publish(topic string, payload []byte) error {
+	r.local.Publish(topic, payload)
+	b, err := json.Marshal(redisMessage{Origin: r.origin, Payload: payload})
+	if err != nil {
+		return fmt.Errorf("bus: error encoding message: %w", err)
+	}
+	if err := r.publish(redisChannelPrefix+topic, b); err != nil {
+		return fmt.Errorf("bus: error publishing message on %s: %w", topic, err)
+	}
+	return nil
+}
+
+// Subscribe calls fn for each message published on the given topic by any
+// instance.
+func (r *RedisBus) Subscribe(topic string, fn func([]byte)) func() {
+	return r.local.Subscribe(topic, fn)
+}
+
+// Close stops receiving messages from other instances.
+func (r *RedisBus) Close() error {
+	close(r.stop)
+	r.lock.Lock()
+	sub := r.sub
+	r.lock.Unlock()
+	if sub != nil {
+		return sub.Close()
+	}
+	return nil
+}
+
+func (r *RedisBus) receive() {
+	for {
+		sub, err := r.subscribe(redisChannelPrefix + "*")
+		if err == nil {
+			r.lock.Lock()
+			r.sub = sub
+			r.lock.Unlock()
+			err = r.deliver(sub)
+		}
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+		if r.onError != nil {
+			r.onError(fmt.Errorf("bus: error receiving messages: %w", err))
+		}
+		select {
+		case <-r.stop:
+			return
+		case <-time.After(redisReconnectInterval):
+		}
+	}
+}
+
+func (r *RedisBus) deliver(sub subscription) error {
+	defer sub.Close()
+	for {
+		channel, b, err := sub.Receive()
+		if err != nil {
+			return err
+		}
+		var message redisMessage
+		if err := json.Unmarshal(b, &message); err != nil {
+			continue
+		}
+		// local subscribers have already received the message when it was
+		// published
+		if message.Origin == r.origin {
+			continue
+		}
+		r.local.Publish(strings.TrimPrefix(channel, redisChannelPrefix), message.Payload)
+	}
+}
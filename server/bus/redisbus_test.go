@@ -0,0 +1,133 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package bus
+
+import (
+	"errors"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockPubSub connects multiple buses like a Redis server would.
+type mockPubSub struct {
+	lock sync.Mutex
+	subs []*mockSubscription
+}
+
+type mockMessage struct {
+	channel string
+	payload []byte
+}
+
+type mockSubscription struct {
+	pattern  string
+	messages chan mockMessage
+	closed   chan struct{}
+	once     sync.Once
+}
+
+func (m *mockSubscription) Receive() (string, []byte, error) {
+	select {
+	case msg := <-m.messages:
+		return msg.channel, msg.payload, nil
+	case <-m.closed:
+		return "", nil, errors.New("closed")
+	}
+}
+
+func (m *mockSubscription) Close() error {
+	m.once.Do(func() { close(m.closed) })
+	return nil
+}
+
+func (m *mockPubSub) publish(channel string, payload []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, sub := range m.subs {
+		if ok, _ := path.Match(sub.pattern, channel); ok {
+			sub.messages <- mockMessage{channel, payload}
+		}
+	}
+	return nil
+}
+
+func (m *mockPubSub) subscribe(pattern string) (subscription, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	sub := &mockSubscription{pattern: pattern, messages: make(chan mockMessage, 10), closed: make(chan struct{})}
+	m.subs = append(m.subs, sub)
+	return sub, nil
+}
+
+func (m *mockPubSub) subscribed(count int) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return len(m.subs) == count
+}
+
+func TestRedisBus(t *testing.T) {
+	pubsub := &mockPubSub{}
+	a, err := newRedisBus(pubsub.publish, pubsub.subscribe, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer a.Close()
+	b, _ := newRedisBus(pubsub.publish, pubsub.subscribe, nil)
+	defer b.Close()
+
+	for !pubsub.subscribed(2) {
+		time.Sleep(time.Millisecond)
+	}
+
+	received := make(chan string, 10)
+	a.Subscribe("topic", func(payload []byte) {
+		received <- "a:" + string(payload)
+	})
+	b.Subscribe("topic", func(payload []byte) {
+		received <- "b:" + string(payload)
+	})
+
+	if err := a.Publish("topic", []byte("message")); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// the local subscriber is called synchronously
+	if msg := <-received; msg != "a:message" {
+		t.Errorf("Unexpected message %s", msg)
+	}
+	select {
+	case msg := <-received:
+		if msg != "b:message" {
+			t.Errorf("Unexpected message %s", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected message to be delivered to other instance")
+	}
+	select {
+	case msg := <-received:
+		t.Errorf("Unexpected duplicate message %s", msg)
+	case <-time.After(time.Millisecond * 50):
+	}
+}
+
+func TestRedisBus_PublishError(t *testing.T) {
+	pubsub := &mockPubSub{}
+	r, _ := newRedisBus(func(string, []byte) error {
+		return errors.New("did not work")
+	}, pubsub.subscribe, nil)
+	defer r.Close()
+
+	var received bool
+	r.Subscribe("topic", func([]byte) {
+		received = true
+	})
+	if err := r.Publish("topic", []byte("message")); err == nil {
+		t.Error("Expected error, got nil")
+	}
+	if !received {
+		t.Error("Expected message to be delivered locally")
+	}
+}
@@ -27,8 +27,14 @@ func newApp(populateMissing, quiet bool, envFileOverride string) *app {
 	logger := logrus.New()
 	cfg, cfgErr := config.New(populateMissing, envFileOverride)
 	if cfgErr != nil {
+		var validationErr config.ValidationError
 		if errors.Is(cfgErr, config.ErrPopulatedMissing) {
 			logger.Infof("Some configuration values were missing: %v", cfgErr.Error())
+		} else if errors.As(cfgErr, &validationErr) {
+			for _, problem := range validationErr {
+				logger.WithField("hint", problem.Hint).Errorf("%s: %s", problem.Key, problem.Message)
+			}
+			logger.Fatalf("Found %d problem(s) with the runtime configuration, refusing to start", len(validationErr))
 		} else {
 			logger.WithError(cfgErr).Fatal("Error sourcing runtime configuration")
 		}
@@ -45,39 +51,46 @@ func newApp(populateMissing, quiet bool, envFileOverride string) *app {
 	}
 }
 
+// reload sources the runtime configuration again and applies the settings
+// that can be changed while the application is running. In case the new
+// configuration is invalid, the current one is kept.
+func (a *app) reload(envFileOverride string) {
+	next, err := config.New(false, envFileOverride)
+	if err != nil {
+		a.logger.WithError(err).Error("Error reloading runtime configuration, keeping current configuration")
+		return
+	}
+	changed := a.config.Reload(next)
+	a.logger.SetLevel(next.App.LogLevel.LogLevel())
+	a.logger.WithField("changed", changed).Info("Successfully reloaded runtime configuration")
+}
+
 func newLogger() *logrus.Logger {
 	return logrus.New()
 }
 
 func newDB(c *config.Config, l *logrus.Logger) (*gorm.DB, error) {
-	var d gorm.Dialector
-	switch c.Database.Dialect.String() {
-	case "sqlite3":
-		d = sqlite.Open(c.Database.ConnectionString.String())
-	case "mysql":
-		d = mysql.Open(c.Database.ConnectionString.String())
-	case "postgres":
-		d = postgres.Open(c.Database.ConnectionString.String())
-	}
+	d := newDialector(c.Database.Dialect, c.Database.ConnectionString.String())
 
-	logLevel := logger.Silent
-	if c.App.Development {
-		logLevel = logger.Info
+	// SQLite databases are local files that will not become available
+	// by waiting, so connecting is only retried for other dialects
+	retries := c.Database.ConnectionRetries
+	if c.Database.Dialect == "sqlite3" {
+		retries = 0
 	}
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = c.Database.ConnectionTimeout
 
 	var gormDB *gorm.DB
 	if err := backoff.RetryNotify(
 		func() error {
 			var err error
-			gormDB, err = gorm.Open(d, &gorm.Config{
-				Logger:                                   logger.Default.LogMode(logLevel),
-				DisableForeignKeyConstraintWhenMigrating: c.Database.Dialect.String() == "sqlite3",
-			})
+			gormDB, err = gorm.Open(d, newGormConfig(c))
 			return err
 		},
-		backoff.WithMaxRetries(backoff.NewExponentialBackOff(), uint64(c.Database.ConnectionRetries)),
+		backoff.WithMaxRetries(b, uint64(retries)),
 		func(err error, duration time.Duration) {
-			if l != nil && c.Database.ConnectionRetries != 0 {
+			if l != nil {
 				l.WithError(err).Warn("Connecting to database failed")
 				l.WithField("duration", duration).Info("Scheduling sleep before retrying")
 			}
@@ -86,12 +99,63 @@ func newDB(c *config.Config, l *logrus.Logger) (*gorm.DB, error) {
 		return nil, fmt.Errorf("error opening database: %w", err)
 	}
 
+	if err := configurePool(c, gormDB); err != nil {
+		return nil, err
+	}
+	return gormDB, nil
+}
+
+// newReadDB opens the connection to the configured read replica. The replica
+// is not required to be available at this point, so no connection is made
+// until it is first used.
+func newReadDB(c *config.Config) (*gorm.DB, error) {
+	gormCfg := newGormConfig(c)
+	gormCfg.DisableAutomaticPing = true
+	gormDB, err := gorm.Open(newDialector(c.Database.Dialect, c.Database.ReadConnectionString.String()), gormCfg)
+	if err != nil {
+		return nil, fmt.Errorf("error opening read replica: %w", err)
+	}
+	if err := configurePool(c, gormDB); err != nil {
+		return nil, err
+	}
+	return gormDB, nil
+}
+
+func newDialector(dialect config.Dialect, connectionString string) gorm.Dialector {
+	switch dialect.String() {
+	case "sqlite3":
+		return sqlite.Open(connectionString)
+	case "mysql":
+		return mysql.Open(connectionString)
+	case "postgres":
+		return postgres.Open(connectionString)
+	}
+	return nil
+}
+
+func newGormConfig(c *config.Config) *gorm.Config {
+	logLevel := logger.Silent
+	if c.App.Development {
+		logLevel = logger.Info
+	}
+	return &gorm.Config{
+		Logger:                                   logger.Default.LogMode(logLevel),
+		DisableForeignKeyConstraintWhenMigrating: c.Database.Dialect.String() == "sqlite3",
+	}
+}
+
+func configurePool(c *config.Config, gormDB *gorm.DB) error {
+	db, err := gormDB.DB()
+	if err != nil {
+		return fmt.Errorf("error accessing underlying database: %w", err)
+	}
+	// SQLite does not support concurrent writes, so a single connection is used
 	if c.Database.Dialect == "sqlite3" {
-		db, err := gormDB.DB()
-		if err != nil {
-			return nil, fmt.Errorf("error accessing underlying database: %w", err)
-		}
 		db.SetMaxOpenConns(1)
+	} else {
+		db.SetMaxOpenConns(c.Database.MaxOpenConnections)
+		db.SetMaxIdleConns(c.Database.MaxIdleConnections)
+		db.SetConnMaxLifetime(c.Database.ConnectionMaxLifetime)
 	}
-	return gormDB, nil
+	return nil
 }
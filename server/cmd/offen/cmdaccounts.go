@@ -0,0 +1,186 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"time"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/persistence/relational"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+var exportAccountUsage = `
+"export-account" writes all data stored about a single account to a file that
+can be imported into another Offen instance using "import-account", keeping
+the original identifiers of its user secrets and events.
+
+As the export contains the account's key encryption key, it grants access to
+all of the account's data. Make sure to store it in a safe place and delete
+it once the migration is done.
+
+The command will prompt for a password in case none is given.
+
+Usage of "export-account":
+`
+
+func cmdExportAccount(subcommand string, flags []string) {
+	cmd := flag.NewFlagSet(subcommand, flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), exportAccountUsage)
+		cmd.PrintDefaults()
+	}
+	var (
+		envFile   = cmd.String("envfile", "", "the env file to use")
+		accountID = cmd.String("account", "", "the id of the account to export")
+		email     = cmd.String("email", "", "the email address of an account user with access to the account")
+		password  = cmd.String("password", "", "the password of the account user")
+		out       = cmd.String("out", "", "the file to write the export to (defaults to a file named after the account)")
+	)
+	cmd.Parse(flags)
+	a := newApp(false, true, *envFile)
+
+	if *accountID == "" || *email == "" {
+		a.logger.Fatal("Missing required parameters, use the -help flag for reference on parameters")
+	}
+	pw := *password
+	if pw == "" {
+		pw = promptPassword(a.logger)
+	}
+	if *out == "" {
+		*out = fmt.Sprintf("offen-account-%s.json", *accountID)
+	}
+
+	gormDB, dbErr := newDB(a.config, a.logger)
+	if dbErr != nil {
+		a.logger.WithError(dbErr).Fatal("Error establishing database connection")
+	}
+
+	var configs []persistence.Config
+	if a.config.ArchiveConfigured() {
+		configs = append(configs, persistence.WithArchive(a.config.NewArchive(), a.config.ArchiveKey()))
+	}
+	db, err := persistence.New(
+		relational.NewRelationalDAL(gormDB),
+		configs...,
+	)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error setting up database")
+	}
+
+	export, err := db.ExportAccount(*accountID, *email, pw)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error exporting account")
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			a.logger.WithError(err).Fatal("Error creating export file")
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := json.NewEncoder(w).Encode(export); err != nil {
+		a.logger.WithError(err).Fatal("Error writing export")
+	}
+	a.logger.WithField("events", len(export.Events)).Info("Successfully exported account")
+}
+
+var importAccountUsage = `
+"import-account" creates an account from a file that has been created by
+running "export-account" against another Offen instance. The account user
+of the given email address is granted admin access to the imported account.
+
+Importing fails in case an account with the same id or name already exists.
+The command will prompt for a password in case none is given.
+
+Usage of "import-account":
+`
+
+func cmdImportAccount(subcommand string, flags []string) {
+	cmd := flag.NewFlagSet(subcommand, flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), importAccountUsage)
+		cmd.PrintDefaults()
+	}
+	var (
+		envFile  = cmd.String("envfile", "", "the env file to use")
+		in       = cmd.String("in", "", "the file to read the export from")
+		email    = cmd.String("email", "", "the email address of the account user to grant access to")
+		password = cmd.String("password", "", "the password of the account user")
+	)
+	cmd.Parse(flags)
+	a := newApp(false, true, *envFile)
+
+	if *in == "" || *email == "" {
+		a.logger.Fatal("Missing required parameters, use the -help flag for reference on parameters")
+	}
+	pw := *password
+	if pw == "" {
+		if *in == "-" {
+			a.logger.Fatal("Reading the export from stdin requires passing -password")
+		}
+		pw = promptPassword(a.logger)
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			a.logger.WithError(err).Fatal("Error opening export file")
+		}
+		defer f.Close()
+		r = f
+	}
+	var export persistence.AccountExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		a.logger.WithError(err).Fatal("Error reading export")
+	}
+	export.Name = html.UnescapeString(bluemonday.StrictPolicy().Sanitize(export.Name))
+
+	gormDB, dbErr := newDB(a.config, a.logger)
+	if dbErr != nil {
+		a.logger.WithError(dbErr).Fatal("Error establishing database connection")
+	}
+
+	db, err := persistence.New(
+		relational.NewRelationalDAL(gormDB),
+	)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error setting up database")
+	}
+
+	if err := db.ImportAccount(export, *email, pw); err != nil {
+		a.logger.WithError(err).Fatal("Error importing account")
+	}
+	a.logger.WithField("events", len(export.Events)).Infof("Successfully imported account %s", export.AccountID)
+}
+
+func promptPassword(logger *logrus.Logger) string {
+	received := make(chan bool, 2)
+	go func() {
+		select {
+		case <-received:
+			return
+		case <-time.Tick(time.Second / 10):
+			logger.Info("You can now enter your password (input is not displayed):")
+		}
+	}()
+	input, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	received <- true
+	if err != nil {
+		logger.WithError(err).Fatal("Error reading password")
+	}
+	return string(input)
+}
@@ -0,0 +1,133 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/offen/offen/server/keys"
+	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/persistence/relational"
+)
+
+var backupUsage = `
+"backup" writes an encrypted snapshot of all accounts, account users and events
+stored in the connected database. The snapshot is read in a single transaction,
+so it is consistent even when taken while the server is running.
+
+Snapshots are compressed and encrypted using a key derived from the configured
+secret, which means the same secret is required for restoring them.
+
+By default, the snapshot is written to a file in the current directory. Pass
+"-" to -out for writing to stdout. In case an archive is configured, passing
+-upload stores the snapshot in the archive's bucket instead.
+
+Usage of "backup":
+`
+
+func cmdBackup(subcommand string, flags []string) {
+	cmd := flag.NewFlagSet(subcommand, flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), backupUsage)
+		cmd.PrintDefaults()
+	}
+	var (
+		envFile = cmd.String("envfile", "", "the env file to use")
+		out     = cmd.String("out", "", "the file to write the snapshot to (defaults to a timestamped file name)")
+		upload  = cmd.Bool("upload", false, "store the snapshot in the configured archive")
+	)
+	cmd.Parse(flags)
+	a := newApp(false, true, *envFile)
+
+	if *out == "" {
+		*out = fmt.Sprintf("offen-backup-%s.bin", time.Now().UTC().Format("20060102T150405Z"))
+	}
+	if *upload && a.config.Archive.Bucket == "" {
+		a.logger.Fatal("Cannot upload snapshot as no archive is configured")
+	}
+
+	gormDB, dbErr := newDB(a.config, a.logger)
+	if dbErr != nil {
+		a.logger.WithError(dbErr).Fatal("Error establishing database connection")
+	}
+
+	db, err := persistence.New(
+		relational.NewRelationalDAL(gormDB),
+	)
+	if err != nil {
+		a.logger.WithError(err).Fatalf("Error setting up database")
+	}
+
+	if *out == "-" {
+		if err := writeBackup(db, a.config.BackupKey(), os.Stdout); err != nil {
+			a.logger.WithError(err).Fatal("Error writing snapshot")
+		}
+		return
+	}
+
+	if !*upload {
+		f, err := os.Create(*out)
+		if err != nil {
+			a.logger.WithError(err).Fatal("Error creating snapshot file")
+		}
+		defer f.Close()
+		if err := writeBackup(db, a.config.BackupKey(), f); err != nil {
+			a.logger.WithError(err).Fatal("Error writing snapshot")
+		}
+		a.logger.WithField("file", *out).Info("Successfully wrote snapshot")
+		return
+	}
+
+	// the snapshot is buffered in a temporary file as the size of an
+	// object needs to be known before uploading it
+	f, err := ioutil.TempFile("", "offen-backup-")
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error creating temporary file")
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := writeBackup(db, a.config.BackupKey(), f); err != nil {
+		a.logger.WithError(err).Fatal("Error writing snapshot")
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error determining snapshot size")
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		a.logger.WithError(err).Fatal("Error rewinding snapshot file")
+	}
+	key := path.Join("backups", path.Base(*out))
+	if err := a.config.NewArchive().Put(key, f, size); err != nil {
+		a.logger.WithError(err).Fatal("Error uploading snapshot")
+	}
+	a.logger.WithField("key", key).Info("Successfully uploaded snapshot")
+}
+
+// writeBackup writes a compressed and encrypted snapshot of the given
+// database to w.
+func writeBackup(db persistence.Service, key []byte, w io.Writer) error {
+	encrypted, err := keys.NewEncryptingWriter(key, w)
+	if err != nil {
+		return fmt.Errorf("error creating encrypting writer: %w", err)
+	}
+	compressed := gzip.NewWriter(encrypted)
+	if err := db.Backup(compressed); err != nil {
+		return err
+	}
+	if err := compressed.Close(); err != nil {
+		return fmt.Errorf("error compressing snapshot: %w", err)
+	}
+	if err := encrypted.Close(); err != nil {
+		return fmt.Errorf("error encrypting snapshot: %w", err)
+	}
+	return nil
+}
@@ -40,6 +40,9 @@ take a minute or two.
 By default, a random free port will be picked for running the server.
 If you need to override this, pass a value to -port.
 
+Usage data is spread across the default retention period of Offen. Pass a
+number of days to -days to generate data for a shorter period only.
+
 Usage of "demo":
 `
 
@@ -52,6 +55,7 @@ func cmdDemo(subcommand string, flags []string) {
 	var (
 		port     = demoCmd.Int("port", 0, "the port to bind to (defaults to a random free port)")
 		numUsers = demoCmd.Int("users", -1, "the number of users to simulate - this defaults to a random number between 250 and 500")
+		numDays  = demoCmd.Int("days", 0, "the number of days to generate usage data for (defaults to the default retention period)")
 	)
 	demoCmd.Parse(flags)
 
@@ -65,6 +69,9 @@ func cmdDemo(subcommand string, flags []string) {
 			cfg.Database.ConnectionString = config.EnvString(fmt.Sprintf("%%Temp%%\\offen-%s.db", dbID.String()))
 		}
 		cfg.Secret = mustSecret(16)
+		// generating usage data hashes user ids for each event, which would
+		// take minutes when using argon2id
+		cfg.App.UserIDHash = config.UserIDHash(keys.UserIDHashSHA256)
 		a.config = cfg
 	}
 
@@ -87,8 +94,19 @@ func cmdDemo(subcommand string, flags []string) {
 	if err != nil {
 		a.logger.WithError(err).Fatal("Unable to establish database connection")
 	}
+	keypairs, err := a.config.NewKeypairProvider()
+	if err != nil {
+		a.logger.WithError(err).Fatal("Unable to create keypair provider")
+	}
+	userSalts, err := a.config.NewUserSaltProvider()
+	if err != nil {
+		a.logger.WithError(err).Fatal("Unable to create user salt provider")
+	}
 	db, err := persistence.New(
 		relational.NewRelationalDAL(gormDB),
+		persistence.WithKeypairProvider(keypairs),
+		persistence.WithUserSaltProvider(userSalts),
+		persistence.WithTOTPKey(a.config.TOTPKey()),
 	)
 	if err != nil {
 		a.logger.WithError(err).Fatal("Unable to create persistence layer")
@@ -122,6 +140,10 @@ func cmdDemo(subcommand string, flags []string) {
 	if users == -1 {
 		users = randomInRange(250, 500)
 	}
+	period := config.EventRetention
+	if *numDays > 0 && time.Duration(*numDays)*time.Hour*24 < period {
+		period = time.Duration(*numDays) * time.Hour * 24
+	}
 
 	wg := sync.WaitGroup{}
 	done := make(chan error)
@@ -139,28 +161,32 @@ func cmdDemo(subcommand string, flags []string) {
 				account.PublicKey, jwk,
 			)
 			if encryptionErr != nil {
-				done <- err
+				done <- encryptionErr
 				return
 			}
 			if err := db.AssociateUserSecret(
 				accountID.String(), userID, encryptedSecret.Marshal(),
 			); err != nil {
 				done <- err
+				return
 			}
 
 			for s := 0; s < randomInRange(1, 4); s++ {
 				evts := newFakeSession(
 					fmt.Sprintf("http://localhost:%d", a.config.Server.Port),
 					randomInRange(1, 12),
+					period,
 				)
 				for _, evt := range evts {
 					b, bErr := json.Marshal(evt)
 					if bErr != nil {
-						done <- err
+						done <- bErr
+						return
 					}
 					event, eventErr := keys.EncryptWith(key, b)
 					if eventErr != nil {
-						done <- err
+						done <- eventErr
+						return
 					}
 					eventID, _ := persistence.EventIDAt(evt.Timestamp)
 					if err := db.Insert(
@@ -170,6 +196,7 @@ func cmdDemo(subcommand string, flags []string) {
 						&eventID,
 					); err != nil {
 						done <- err
+						return
 					}
 				}
 			}
@@ -204,17 +231,21 @@ func cmdDemo(subcommand string, flags []string) {
 		a.logger.WithError(emailsErr).Fatal("Failed parsing template files, cannot continue")
 	}
 
+	handler, handlerErr := router.New(
+		router.WithDatabase(db),
+		router.WithLogger(a.logger),
+		router.WithTemplate(tpl),
+		router.WithEmails(emails),
+		router.WithConfig(a.config),
+		router.WithFS(fs),
+		router.WithMailer(a.config.NewMailer()),
+	)
+	if handlerErr != nil {
+		a.logger.WithError(handlerErr).Fatal("Failed creating router, cannot continue")
+	}
 	srv := &http.Server{
-		Addr: fmt.Sprintf("0.0.0.0:%d", a.config.Server.Port),
-		Handler: router.New(
-			router.WithDatabase(db),
-			router.WithLogger(a.logger),
-			router.WithTemplate(tpl),
-			router.WithEmails(emails),
-			router.WithConfig(a.config),
-			router.WithFS(fs),
-			router.WithMailer(a.config.NewMailer()),
-		),
+		Addr:    fmt.Sprintf("0.0.0.0:%d", a.config.Server.Port),
+		Handler: handler,
 	}
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -227,7 +258,9 @@ func cmdDemo(subcommand string, flags []string) {
 	a.logger.Infof("")
 	a.logger.Infof("in your browser.")
 
-	quit := make(chan os.Signal)
+	// signals are delivered without blocking, so the channel needs to be
+	// buffered for not missing a signal that is sent before receiving
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
@@ -320,10 +353,12 @@ func randomReferrer() string {
 	return referrers[randomInRange(0, len(referrers)-1)]
 }
 
-func newFakeSession(root string, length int) []*fakeEvent {
+// newFakeSession creates a session of the given length that starts at a
+// random point in time within the given period.
+func newFakeSession(root string, length int, period time.Duration) []*fakeEvent {
 	var result []*fakeEvent
 	sessionID, _ := uuid.NewV4()
-	timestamp := time.Now().Add(-time.Duration(randomInRange(0, int(config.EventRetention))))
+	timestamp := time.Now().Add(-time.Duration(randomInRange(0, int(period))))
 	isMobileSession := randomBool(0.33)
 
 	var href string
@@ -337,7 +372,7 @@ func newFakeSession(root string, length int) []*fakeEvent {
 			referrer = href
 		}
 
-		href := fmt.Sprintf("%s%s", root, randomPage())
+		href = fmt.Sprintf("%s%s", root, randomPage())
 		result = append(result, &fakeEvent{
 			Type:      "PAGEVIEW",
 			Href:      href,
@@ -348,7 +383,8 @@ func newFakeSession(root string, length int) []*fakeEvent {
 			Timestamp: timestamp,
 			SessionID: sessionID.String(),
 		})
-		timestamp = timestamp.Add(time.Duration(randomInRange(0, 10000)))
+		// users spend up to a few minutes on a page before visiting the next
+		timestamp = timestamp.Add(time.Duration(randomInRange(5, 300)) * time.Second)
 	}
 	return result
 }
@@ -7,16 +7,27 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+
+	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/persistence/relational"
+	"github.com/sirupsen/logrus"
 )
 
 var debugUsage = `
 "debug" prints the runtime configuration resolved from the current working
 directory.
 
+Run "debug keys" to verify that the encrypted private keys of all accounts
+the given account user can access decrypt and match the stored public keys.
+
 Usage of "debug":
 `
 
 func cmdDebug(subcommand string, flags []string) {
+	if len(flags) > 0 && flags[0] == "keys" {
+		cmdDebugKeys("debug keys", flags[1:])
+		return
+	}
 	cmd := flag.NewFlagSet("debug", flag.ExitOnError)
 	cmd.Usage = func() {
 		fmt.Fprint(flag.CommandLine.Output(), debugUsage)
@@ -34,3 +45,76 @@ func cmdDebug(subcommand string, flags []string) {
 	a.logger.Info("Current configuration values")
 	fmt.Fprintln(a.logger.Out, string(pretty))
 }
+
+var debugKeysUsage = `
+"debug keys" decrypts the private keys of all accounts the given account user
+can access and verifies each of them belongs to the public key stored for the
+account. Deprecated keys are checked as well. The command exits with a non-zero
+status in case any mismatch is found.
+
+The command will prompt for a password in case none is given.
+
+Usage of "debug keys":
+`
+
+func cmdDebugKeys(subcommand string, flags []string) {
+	cmd := flag.NewFlagSet(subcommand, flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), debugKeysUsage)
+		cmd.PrintDefaults()
+	}
+	var (
+		envFile  = cmd.String("envfile", "", "the env file to use")
+		email    = cmd.String("email", "", "the email address of the account user")
+		password = cmd.String("password", "", "the password of the account user")
+	)
+	cmd.Parse(flags)
+	a := newApp(false, true, *envFile)
+
+	if *email == "" {
+		a.logger.Fatal("Missing required parameters, use the -help flag for reference on parameters")
+	}
+	pw := *password
+	if pw == "" {
+		pw = promptPassword(a.logger)
+	}
+
+	gormDB, dbErr := newDB(a.config, a.logger)
+	if dbErr != nil {
+		a.logger.WithError(dbErr).Fatal("Error establishing database connection")
+	}
+	db, err := persistence.New(
+		relational.NewRelationalDAL(gormDB),
+	)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error setting up database")
+	}
+
+	results, err := db.VerifyAccountKeys(*email, pw)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error verifying account keys")
+	}
+	var mismatches int
+	for _, result := range results {
+		keyID := result.KeyID
+		if keyID == "" {
+			keyID = "current"
+		}
+		logger := a.logger.WithFields(logrus.Fields{
+			"account":   result.AccountID,
+			"name":      result.Name,
+			"key":       keyID,
+			"algorithm": result.KeyAlgorithm,
+		})
+		if !result.Valid {
+			mismatches++
+			logger.Errorf("Key pair is not usable: %s", result.Problem)
+			continue
+		}
+		logger.Info("Key pair is valid")
+	}
+	if mismatches > 0 {
+		a.logger.Fatalf("Found %d unusable key pair(s) in %d checked", mismatches, len(results))
+	}
+	a.logger.Infof("Successfully verified %d key pair(s)", len(results))
+}
@@ -7,15 +7,20 @@ import (
 	"flag"
 	"fmt"
 
-	"github.com/offen/offen/server/config"
 	"github.com/offen/offen/server/persistence"
 	"github.com/offen/offen/server/persistence/relational"
+	"github.com/sirupsen/logrus"
 )
 
 var expireUsage = `
-"expire" prunes all events older than 6 months (4464 hours) from the connected
-database. Only run this command when you run Offen as a horizontally scaling
-service as the default installation will handle this routine by itself.
+"expire" prunes all events older than the configured retention period (which
+defaults to 6 months or 4464 hours) from the connected database. Only run this
+command when you run Offen as a horizontally scaling service as the default
+installation will handle this routine by itself.
+
+Pass -dry-run to report the number of events that would be expired per account
+without deleting anything. Pass -account to expire the events of a single
+account only. When using either flag, archived events are not affected.
 
 Usage of "expire":
 `
@@ -27,26 +32,65 @@ func cmdExpire(subcommand string, flags []string) {
 		cmd.PrintDefaults()
 	}
 	var (
-		envFile = cmd.String("envfile", "", "the env file to use")
+		envFile   = cmd.String("envfile", "", "the env file to use")
+		retention = cmd.Duration("retention", 0, "the retention period to use (defaults to the configured value)")
+		dryRun    = cmd.Bool("dry-run", false, "report the number of events that would be expired per account without deleting them")
+		accountID = cmd.String("account", "", "only expire events of the account with the given id")
 	)
 	cmd.Parse(flags)
 	a := newApp(false, true, *envFile)
+	if *retention == 0 {
+		*retention = a.config.Retention()
+	}
 
 	gormDB, dbErr := newDB(a.config, a.logger)
 	if dbErr != nil {
 		a.logger.WithError(dbErr).Fatal("Error establishing database connection")
 	}
 
+	var persistenceConfigs []persistence.Config
+	if a.config.ArchiveConfigured() {
+		persistenceConfigs = append(persistenceConfigs, persistence.WithArchive(
+			a.config.NewArchive(), a.config.ArchiveKey(),
+		))
+	}
 	db, err := persistence.New(
 		relational.NewRelationalDAL(gormDB),
+		persistenceConfigs...,
 	)
 	if err != nil {
 		a.logger.WithError(err).Fatalf("Error setting up database")
 	}
 
-	affected, err := db.Expire(config.EventRetention)
+	if *dryRun || *accountID != "" {
+		results, err := db.ExpireAccounts(*retention, persistence.ExpireOptions{
+			AccountID: *accountID,
+			DryRun:    *dryRun,
+		})
+		if err != nil {
+			a.logger.WithError(err).Fatalf("Error pruning expired events")
+		}
+		var total int
+		for _, result := range results {
+			a.logger.WithFields(logrus.Fields{
+				"accountId": result.AccountID,
+				"name":      result.Name,
+				"retention": result.Retention,
+				"expired":   result.Expired,
+			}).Info("Expired events of account")
+			total += result.Expired
+		}
+		if *dryRun {
+			a.logger.WithField("expired", total).Info("Dry run finished, no events have been removed")
+			return
+		}
+		a.logger.WithField("removed", total).Info("Successfully expired events")
+		return
+	}
+
+	report, err := db.Expire(*retention)
 	if err != nil {
 		a.logger.WithError(err).Fatalf("Error pruning expired events")
 	}
-	a.logger.WithField("removed", affected).Info("Successfully expired events")
+	a.logger.WithField("removed", report.Expired).Info("Successfully expired events")
 }
@@ -0,0 +1,82 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/offen/offen/server/loadgen"
+)
+
+var loadUsage = `
+"load" sends synthetic traffic to an Offen instance and reports the latency
+of its responses. Simulated users opt in and keep their cookies just like
+browsers do, so the instance handles the requests exactly as it would handle
+real traffic. Use this for sizing deployments or comparing database setups.
+
+The given account needs to exist on the target instance and will receive all
+generated events, so do not use an account that collects real data. Keep in
+mind that the target instance throttles requests per user, so use enough users
+for the rate you request.
+
+Usage of "load":
+`
+
+func cmdLoad(subcommand string, flags []string) {
+	cmd := flag.NewFlagSet(subcommand, flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), loadUsage)
+		cmd.PrintDefaults()
+	}
+	var (
+		target    = cmd.String("target", "http://localhost:3000", "the URL of the instance to send traffic to")
+		accountID = cmd.String("account", "", "the id of the account to send events to")
+		rate      = cmd.Float64("rate", 10, "the number of requests per second")
+		users     = cmd.Int("users", 50, "the number of users to simulate")
+		duration  = cmd.Duration("duration", time.Minute, "the duration to send traffic for")
+		readRatio = cmd.Float64("read-ratio", 0.1, "the share of requests querying events instead of sending them")
+		verbose   = cmd.Bool("verbose", false, "log each failed request")
+	)
+	cmd.Parse(flags)
+	logger := newLogger()
+
+	if *accountID == "" {
+		logger.Fatal("An account id is required, use the -help flag for reference on parameters")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-quit
+		cancel()
+	}()
+
+	logger.Infof("Sending %v requests per second for %v to %s", *rate, *duration, *target)
+	results, err := loadgen.Run(ctx, loadgen.Config{
+		Target:    *target,
+		AccountID: *accountID,
+		Rate:      *rate,
+		Users:     *users,
+		Duration:  *duration,
+		ReadRatio: *readRatio,
+	}, func(err error) {
+		if *verbose {
+			logger.WithError(err).Warn("Request failed")
+		}
+	})
+	if err != nil {
+		logger.WithError(err).Fatal("Error generating load")
+	}
+	for _, result := range results {
+		fmt.Println(result)
+	}
+}
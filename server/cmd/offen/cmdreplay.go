@@ -0,0 +1,87 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/offen/offen/server/deadletter"
+	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/persistence/relational"
+)
+
+var replayEventsUsage = `
+"replay-events" persists the events that have been written to the dead letter
+file because the database could not be reached when they were received.
+Events that still cannot be persisted are kept in the file. Events are stored
+using the id they have been assigned when being received, so replaying the
+same event more than once does not create duplicates.
+
+Usage of "replay-events":
+`
+
+func cmdReplayEvents(subcommand string, flags []string) {
+	cmd := flag.NewFlagSet(subcommand, flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), replayEventsUsage)
+		cmd.PrintDefaults()
+	}
+	var (
+		envFile = cmd.String("envfile", "", "the env file to use")
+		file    = cmd.String("file", "", "the dead letter file to replay (defaults to the configured value)")
+	)
+	cmd.Parse(flags)
+	a := newApp(false, true, *envFile)
+
+	deadLetters := a.config.NewDeadLetters()
+	if *file != "" {
+		deadLetters = deadletter.New(*file)
+	}
+	if deadLetters == nil {
+		a.logger.Fatal("No dead letter file configured, pass -file or set OFFEN_APP_DEADLETTERFILE")
+	}
+
+	gormDB, dbErr := newDB(a.config, a.logger)
+	if dbErr != nil {
+		a.logger.WithError(dbErr).Fatal("Error establishing database connection")
+	}
+
+	db, err := persistence.New(
+		relational.NewRelationalDAL(gormDB),
+		persistence.WithUserIDPepper(a.config.UserIDPepper.Bytes()),
+	)
+	if err != nil {
+		a.logger.WithError(err).Fatalf("Error setting up database")
+	}
+
+	replayed, remaining, err := deadLetters.Replay(func(e deadletter.Entry) error {
+		err := db.Insert(e.UserID, e.AccountID, e.Payload, &e.EventID)
+		if err == nil {
+			return nil
+		}
+		// these events would also have been rejected when being received,
+		// so there is no point in retrying them
+		if isRejectedEvent(err) {
+			a.logger.WithError(err).WithField("eventId", e.EventID).Warn("Dropping event that cannot be persisted")
+			return nil
+		}
+		a.logger.WithError(err).WithField("eventId", e.EventID).Error("Error persisting event")
+		return err
+	})
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error replaying events")
+	}
+	a.logger.WithField("replayed", replayed).WithField("remaining", remaining).Info("Successfully replayed events")
+}
+
+// isRejectedEvent checks whether the given error has been caused by the
+// event itself, i.e. inserting the same event again will fail again.
+func isRejectedEvent(err error) bool {
+	var unknownAccountErr persistence.ErrUnknownAccount
+	var unknownSecretErr persistence.ErrUnknownSecret
+	var duplicateEventErr persistence.ErrDuplicateEvent
+	return errors.As(err, &unknownAccountErr) || errors.As(err, &unknownSecretErr) || errors.As(err, &duplicateEventErr)
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/offen/offen/server/keys"
+	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/persistence/relational"
+)
+
+var restoreUsage = `
+"restore" replays a snapshot created by "backup" into the connected database.
+The snapshot is decrypted and verified while being read and restored in a
+single transaction, so a corrupted or truncated snapshot leaves the database
+untouched.
+
+Restoring is only possible into an empty database unless -force is given, in
+which case all existing data is replaced with the content of the snapshot.
+
+Usage of "restore":
+`
+
+func cmdRestore(subcommand string, flags []string) {
+	cmd := flag.NewFlagSet(subcommand, flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), restoreUsage)
+		cmd.PrintDefaults()
+	}
+	var (
+		envFile  = cmd.String("envfile", "", "the env file to use")
+		in       = cmd.String("in", "", "the file to read the snapshot from")
+		download = cmd.Bool("download", false, "read the snapshot from the configured archive")
+		force    = cmd.Bool("force", false, "overwrite existing data")
+	)
+	cmd.Parse(flags)
+	a := newApp(false, true, *envFile)
+
+	if *in == "" {
+		a.logger.Fatal("Flag -in is required")
+	}
+	if *download && a.config.Archive.Bucket == "" {
+		a.logger.Fatal("Cannot download snapshot as no archive is configured")
+	}
+
+	var r io.Reader
+	switch {
+	case *download:
+		key := path.Join("backups", path.Base(*in))
+		data, err := a.config.NewArchive().Get(key)
+		if err != nil {
+			a.logger.WithError(err).Fatal("Error downloading snapshot")
+		}
+		r = bytes.NewReader(data)
+	case *in == "-":
+		r = os.Stdin
+	default:
+		f, err := os.Open(*in)
+		if err != nil {
+			a.logger.WithError(err).Fatal("Error opening snapshot file")
+		}
+		defer f.Close()
+		r = f
+	}
+
+	gormDB, dbErr := newDB(a.config, a.logger)
+	if dbErr != nil {
+		a.logger.WithError(dbErr).Fatal("Error establishing database connection")
+	}
+
+	db, err := persistence.New(
+		relational.NewRelationalDAL(gormDB),
+	)
+	if err != nil {
+		a.logger.WithError(err).Fatalf("Error setting up database")
+	}
+
+	if err := db.Migrate(); err != nil {
+		a.logger.WithError(err).Fatal("Error applying database migrations")
+	}
+
+	if err := readBackup(db, a.config.BackupKey(), r, *force); err != nil {
+		a.logger.WithError(err).Fatal("Error restoring snapshot")
+	}
+	a.logger.Info("Successfully restored snapshot")
+}
+
+// readBackup decrypts and decompresses the snapshot read from r and restores
+// it into the given database.
+func readBackup(db persistence.Service, key []byte, r io.Reader, force bool) error {
+	decrypted, err := keys.NewDecryptingReader(key, r)
+	if err != nil {
+		return fmt.Errorf("error creating decrypting reader: %w", err)
+	}
+	decompressed, err := gzip.NewReader(decrypted)
+	if err != nil {
+		return fmt.Errorf("error decompressing snapshot: %w", err)
+	}
+	return db.Restore(decompressed, force)
+}
@@ -0,0 +1,69 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/persistence/relational"
+)
+
+var rotateSaltUsage = `
+"rotate-salt" replaces the salt that is used for hashing the user ids of the
+given account. Use this in case you suspect the salt has been compromised.
+
+User ids are only known to the users themselves, so existing data cannot be
+rehashed right away. Instead, the secret and events of each user are migrated
+the next time the user interacts with the account. The previous salt is kept
+for this, so rotating the salt of the same account again requires -force,
+which discards the previous salt. Users that have not been migrated by then
+lose access to their data.
+
+Usage of "rotate-salt":
+`
+
+func cmdRotateSalt(subcommand string, flags []string) {
+	cmd := flag.NewFlagSet(subcommand, flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), rotateSaltUsage)
+		cmd.PrintDefaults()
+	}
+	var (
+		envFile   = cmd.String("envfile", "", "the env file to use")
+		accountID = cmd.String("account", "", "the id of the account to rotate the salt for")
+		force     = cmd.Bool("force", false, "discard the salt of a pending previous rotation")
+	)
+	cmd.Parse(flags)
+	a := newApp(false, true, *envFile)
+
+	if *accountID == "" {
+		a.logger.Fatal("Flag -account is required")
+	}
+
+	gormDB, dbErr := newDB(a.config, a.logger)
+	if dbErr != nil {
+		a.logger.WithError(dbErr).Fatal("Error establishing database connection")
+	}
+
+	userSalts, err := a.config.NewUserSaltProvider()
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error creating user salt provider")
+	}
+
+	db, err := persistence.New(
+		relational.NewRelationalDAL(gormDB),
+		persistence.WithUserSaltProvider(userSalts),
+		persistence.WithUserIDPepper(a.config.UserIDPepper.Bytes()),
+	)
+	if err != nil {
+		a.logger.WithError(err).Fatalf("Error setting up database")
+	}
+
+	if err := db.RotateUserSalt(*accountID, *force); err != nil {
+		a.logger.WithError(err).Fatal("Error rotating user salt")
+	}
+	a.logger.WithField("account", *accountID).Info("Successfully rotated user salt")
+}
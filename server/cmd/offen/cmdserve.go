@@ -13,20 +13,42 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/offen/offen/server/config"
+	"github.com/gofrs/uuid"
+	"github.com/offen/offen/server/bus"
+	"github.com/offen/offen/server/deadletter"
+	"github.com/offen/offen/server/domainverify"
+	"github.com/offen/offen/server/features"
 	"github.com/offen/offen/server/locales"
+	"github.com/offen/offen/server/mailer"
 	"github.com/offen/offen/server/persistence"
 	"github.com/offen/offen/server/persistence/relational"
 	"github.com/offen/offen/server/public"
+	"github.com/offen/offen/server/replication"
 	"github.com/offen/offen/server/router"
+	"github.com/offen/offen/server/scheduler"
+	"github.com/offen/offen/server/systemd"
+	"github.com/offen/offen/server/webhook"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/acme/autocert"
 )
 
+// defaultInsertBuffer is the capacity used for buffering inserts when the
+// insert-buffer feature is enabled without configuring a capacity.
+const defaultInsertBuffer = 1000
+
+// webhookHealthInterval is the interval in which the health of the database
+// connection is checked for notifying webhooks about degradation.
+const webhookHealthInterval = time.Minute
+
+// mailQueueCapacity is the number of messages that can wait for being sent.
+const mailQueueCapacity = 100
+
 var serveUsage = `
 "serve" starts the Offen instance and listens to the configured port(s).
-Configuration is sourced either from the envfile given to -envfile or a file
-called offen.env in the default lookup hierarchy (this applies to Linux and
-Darwin only):
+Configuration is sourced either from the file given to -envfile or a file
+called offen.env or offen.yml in the default lookup hierarchy (this applies
+to Linux and Darwin only):
 
 - In the current working directory
 - In ~/.config
@@ -40,6 +62,14 @@ https://docs.offen.dev/running-offen/configuring-the-application/
 To find out about the configuration that would currently by applied, use
 the "offen debug" subcommand.
 
+Sending SIGHUP to the process reloads the log level, retention period, origin
+check mode and maximum event payload size from the configuration without
+restarting the server.
+
+When run as a systemd service of Type=notify, the server signals readiness
+and shutdown to systemd. In case WatchdogSec is set, watchdog pings are sent
+as long as the database connection is healthy.
+
 Usage of "serve":
 `
 
@@ -60,8 +90,139 @@ func cmdServe(subcommand string, flags []string) {
 		a.logger.WithError(err).Fatal("Unable to establish database connection")
 	}
 
+	keypairs, err := a.config.NewKeypairProvider()
+	if err != nil {
+		a.logger.WithError(err).Fatal("Unable to create keypair provider")
+	}
+	userSalts, err := a.config.NewUserSaltProvider()
+	if err != nil {
+		a.logger.WithError(err).Fatal("Unable to create user salt provider")
+	}
+	featureFlags, err := a.config.NewFeatures()
+	if err != nil {
+		a.logger.WithError(err).Fatal("Unable to read feature flags")
+	}
+	persistenceConfigs := []persistence.Config{
+		persistence.WithKeypairProvider(keypairs),
+		persistence.WithUserSaltProvider(userSalts),
+		persistence.WithUserIDPepper(a.config.UserIDPepper.Bytes()),
+		persistence.WithEventQuota(a.config.App.EventQuota),
+		persistence.WithDomainVerifier(domainverify.New()),
+		persistence.WithMigrationProgress(func(accountID string, migrated int) {
+			a.logger.WithField("account", accountID).WithField("events", migrated).Info("Moving events of user that has sent a new secret")
+		}),
+	}
+	if a.config.Database.ReadConnectionString != "" {
+		readDB, err := newReadDB(a.config)
+		if err != nil {
+			a.logger.WithError(err).Fatal("Unable to set up read replica")
+		}
+		persistenceConfigs = append(persistenceConfigs, persistence.WithReadReplica(
+			relational.NewRelationalDAL(readDB),
+		))
+	}
+	var webhooks *webhook.Dispatcher
+	if a.config.WebhooksConfigured() {
+		var endpoints []webhook.Endpoint
+		for i, url := range a.config.Webhooks.URLs {
+			endpoints = append(endpoints, webhook.Endpoint{URL: url, Secret: a.config.WebhookSecret(i)})
+		}
+		webhooks = webhook.New(
+			endpoints,
+			a.config.Webhooks.MaxAttempts,
+			func(d webhook.Delivery) {
+				entry := a.logger.
+					WithField("event", d.Event).
+					WithField("url", d.URL).
+					WithField("deliveryId", d.DeliveryID).
+					WithField("attempts", d.Attempts)
+				if !d.Delivered {
+					entry.WithField("error", d.Error).Warn("Failed to deliver webhook")
+					return
+				}
+				entry.Info("Successfully delivered webhook")
+			},
+		)
+		defer webhooks.Close()
+		persistenceConfigs = append(persistenceConfigs, persistence.WithWebhooks(webhooks))
+	}
+	deadLetters := a.config.NewDeadLetters()
+	insertBuffer := a.config.App.InsertBuffer
+	if insertBuffer == 0 && featureFlags.Enabled(features.InsertBuffer) {
+		insertBuffer = defaultInsertBuffer
+	}
+	if insertBuffer > 0 {
+		persistenceConfigs = append(persistenceConfigs, persistence.WithInsertBuffer(
+			insertBuffer,
+			a.config.App.InsertBatchSize,
+			a.config.App.InsertFlushInterval,
+			func(events []persistence.BufferedEvent, err error) {
+				if isRejectedEvent(err) || deadLetters == nil {
+					a.logger.WithError(err).WithField("events", len(events)).Error("Error writing buffered events, dropping events")
+					return
+				}
+				for _, evt := range events {
+					if err := deadLetters.Write(deadletter.Entry{
+						UserID:     evt.UserID,
+						AccountID:  evt.AccountID,
+						Payload:    evt.Payload,
+						EventID:    evt.EventID,
+						ReceivedAt: time.Now(),
+					}); err != nil {
+						a.logger.WithError(err).WithField("eventId", evt.EventID).Error("Error writing event to dead letter file")
+					}
+				}
+				a.logger.WithError(err).WithField("events", len(events)).Error("Error writing buffered events, wrote events to dead letter file")
+			},
+		))
+	}
+	var redisClient *redis.Client
+	messageBus := bus.New()
+	if a.config.RedisConfigured() {
+		redisClient = a.config.NewRedis()
+		defer redisClient.Close()
+		if err := redisClient.Ping(context.Background()).Err(); err != nil {
+			a.logger.WithError(err).Warn("Unable to reach Redis, falling back to the database until it becomes available")
+		}
+		persistenceConfigs = append(persistenceConfigs, persistence.WithAccountCache(
+			persistence.NewRedisAccountCache(redisClient, a.config.App.AccountCacheTTL),
+		))
+		redisBus, err := bus.NewRedis(redisClient, func(err error) {
+			a.logger.WithError(err).Warn("Error receiving messages from other instances")
+		})
+		if err != nil {
+			a.logger.WithError(err).Fatal("Unable to create message bus")
+		}
+		defer redisBus.Close()
+		messageBus = redisBus
+	} else if a.config.App.AccountCacheSize > 0 {
+		persistenceConfigs = append(persistenceConfigs, persistence.WithAccountCache(
+			persistence.NewAccountCache(a.config.App.AccountCacheSize, a.config.App.AccountCacheTTL),
+		))
+	}
+	persistenceConfigs = append(persistenceConfigs, persistence.WithBus(messageBus), persistence.WithTOTPKey(a.config.TOTPKey()))
+	if a.config.App.IngestHookURL != "" {
+		persistenceConfigs = append(persistenceConfigs, persistence.WithIngestHooks(
+			func(meta persistence.InboundEventMetadata, reason string) {
+				a.logger.
+					WithField("accountId", meta.AccountID).
+					WithField("eventId", meta.EventID).
+					WithField("reason", reason).
+					Warn("Ingest hook flagged event")
+			},
+			persistence.NewRemoteIngestHook(a.config.App.IngestHookURL, a.config.App.IngestHookTimeout, func(err error) {
+				a.logger.WithError(err).Warn("Error calling ingest hook, accepting event")
+			}),
+		))
+	}
+	if a.config.ArchiveConfigured() {
+		persistenceConfigs = append(persistenceConfigs, persistence.WithArchive(
+			a.config.NewArchive(), a.config.ArchiveKey(),
+		))
+	}
 	db, err := persistence.New(
 		relational.NewRelationalDAL(gormDB),
+		persistenceConfigs...,
 	)
 	if err != nil {
 		a.logger.WithError(err).Fatal("Unable to create persistence layer")
@@ -75,6 +236,19 @@ func cmdServe(subcommand string, flags []string) {
 		}
 	}
 
+	// in case multiple instances share a database, jobs are coordinated
+	// using a lock in the database so each scheduled run happens only once
+	var locker scheduler.Locker
+	if !a.config.App.SingleNode {
+		instanceID, err := uuid.NewV4()
+		if err != nil {
+			a.logger.WithError(err).Fatal("Unable to create instance identifier")
+		}
+		locker = scheduler.LockerFunc(func(name string, until time.Time) (bool, error) {
+			return db.AcquireJobLock(name, instanceID.String(), until)
+		})
+	}
+
 	fs := public.NewLocalizedFS(a.config.App.Locale.String())
 	gettext, gettextErr := locales.GettextFor(a.config.App.Locale.String())
 	if gettextErr != nil {
@@ -88,18 +262,145 @@ func cmdServe(subcommand string, flags []string) {
 	if emailErr != nil {
 		a.logger.WithError(emailErr).Fatal("Failed parsing template files, cannot continue")
 	}
+	if !a.config.MailerConfigured() {
+		a.logger.Warn("Neither SMTP nor sendmail are available, password resets, invites and reports cannot be sent by email")
+	}
+	directMail := a.config.NewMailer()
+	// messages sent in the background are queued and retried, while
+	// messages requested by users are sent directly, so a failure can be
+	// reported back to them
+	mail := mailer.NewQueue(directMail, mailQueueCapacity, a.config.SMTP.MaxAttempts, func(m mailer.Message, err error) {
+		a.logger.WithError(err).WithField("subject", m.Subject).Error("Error sending email, dropping message")
+	})
+	defer mail.Close()
+
+	expireSchedule, err := a.config.Jobs.Expire.Schedule()
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error parsing schedule for expiring events")
+	}
+	secretsSchedule, err := a.config.Jobs.Secrets.Schedule()
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error parsing schedule for pruning orphaned secrets")
+	}
+	jobList := []scheduler.Job{
+		{
+			Name:       "expire",
+			Schedule:   expireSchedule,
+			RunOnStart: true,
+			Run: func() error {
+				report, err := db.Expire(a.config.Retention())
+				if err != nil {
+					a.logger.WithError(err).Errorf("Error pruning expired events")
+					return err
+				}
+				a.reportExpiry(report, webhooks, mail, emails)
+				return nil
+			},
+		},
+		{
+			Name:     "secrets",
+			Schedule: secretsSchedule,
+			Run: func() error {
+				affected, err := db.PruneSecrets()
+				if err != nil {
+					a.logger.WithError(err).Errorf("Error pruning orphaned secrets")
+					return err
+				}
+				a.logger.WithField("removed", affected).Info("Cron successfully pruned orphaned secrets")
+				return nil
+			},
+		},
+	}
+	// a replica archiving its events would write the same bundles as its
+	// primary, so archiving is only done by the primary
+	if a.config.ArchiveConfigured() && !a.config.IsReplica() {
+		archiveSchedule, err := a.config.Jobs.Archive.Schedule()
+		if err != nil {
+			a.logger.WithError(err).Fatal("Error parsing schedule for archiving events")
+		}
+		jobList = append(jobList, scheduler.Job{
+			Name:     "archive",
+			Schedule: archiveSchedule,
+			Run: func() error {
+				affected, err := db.ArchiveEvents(a.config.Archive.After)
+				if err != nil {
+					a.logger.WithError(err).Errorf("Error archiving events")
+					return err
+				}
+				a.logger.WithField("archived", affected).Info("Cron successfully archived events")
+				return nil
+			},
+		})
+	}
+	if a.config.IsReplica() {
+		syncSchedule, err := a.config.Jobs.Sync.Schedule()
+		if err != nil {
+			a.logger.WithError(err).Fatal("Error parsing schedule for syncing from primary")
+		}
+		client := replication.NewClient(a.config.Sync.Primary, a.config.Sync.Token)
+		jobList = append(jobList, scheduler.Job{
+			Name:       "sync",
+			Schedule:   syncSchedule,
+			RunOnStart: true,
+			Run: func() error {
+				added, err := db.Replicate(a.config.Sync.Primary, client.Pull)
+				if err != nil {
+					a.logger.WithError(err).Errorf("Error syncing from primary")
+					return err
+				}
+				a.logger.WithField("added", added).Info("Cron successfully synced events from primary")
+				return nil
+			},
+		})
+	}
+	for i := range jobList {
+		jobList[i].Run = a.skipWhenReadOnly(db, jobList[i].Name, jobList[i].Run)
+	}
+	jobs := scheduler.New(a.config.Jobs.Jitter, locker, jobList...)
+
+	integrity, integrityErr := fs.Integrity()
+	if integrityErr != nil {
+		a.logger.WithError(integrityErr).Fatal("Served scripts do not match their integrity hashes, cannot continue")
+	}
 
+	routerConfigs := []router.Config{
+		router.WithDatabase(db),
+		router.WithLogger(a.logger),
+		router.WithTemplate(tpl),
+		router.WithEmails(emails),
+		router.WithConfig(a.config),
+		router.WithFS(fs),
+		router.WithMailer(directMail),
+		router.WithScheduler(jobs),
+		router.WithDeadLetters(deadLetters),
+		router.WithBus(messageBus),
+		router.WithFeatures(featureFlags),
+		router.WithIntegrity(integrity),
+		router.WithLocales(a.config.NewLocalesLoader()),
+	}
+	if redisClient != nil {
+		routerConfigs = append(routerConfigs, router.WithRedis(redisClient))
+	}
+	if webhooks != nil {
+		routerConfigs = append(routerConfigs, router.WithWebhooks(webhooks))
+	}
+
+	handler, err := router.New(routerConfigs...)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Failed creating router, cannot continue")
+	}
 	srv := &http.Server{
-		Addr: fmt.Sprintf("0.0.0.0:%d", a.config.Server.Port),
-		Handler: router.New(
-			router.WithDatabase(db),
-			router.WithLogger(a.logger),
-			router.WithTemplate(tpl),
-			router.WithEmails(emails),
-			router.WithConfig(a.config),
-			router.WithFS(fs),
-			router.WithMailer(a.config.NewMailer()),
-		),
+		Addr:    fmt.Sprintf("0.0.0.0:%d", a.config.Server.Port),
+		Handler: handler,
+	}
+	if a.config.Server.SSLCertificate != "" && a.config.Server.HTTPSRedirect {
+		go func() {
+			addr := fmt.Sprintf("0.0.0.0:%d", a.config.Server.HTTPPort)
+			if err := http.ListenAndServe(addr, router.NewHTTPSRedirect(a.config.Server.Port)); err != nil {
+				a.logger.WithError(err).Fatal("Error binding redirect server to network")
+			}
+		}()
+		a.logger.Infof("Redirecting HTTP requests on port %d to HTTPS", a.config.Server.HTTPPort)
 	}
 	go func() {
 		if a.config.Server.SSLCertificate != "" && a.config.Server.SSLKey != "" {
@@ -130,35 +431,124 @@ func cmdServe(subcommand string, flags []string) {
 		a.logger.Infof("Server now listening on port %d", a.config.Server.Port)
 	}
 
-	if a.config.App.SingleNode {
-		hourlyJob := time.Tick(time.Hour)
-		runOnInit := make(chan bool)
-		go func() {
-			for {
-				select {
-				case <-hourlyJob:
-				case <-runOnInit:
-				}
-				affected, err := db.Expire(config.EventRetention)
-				if err != nil {
-					a.logger.WithError(err).Errorf("Error pruning expired events")
-					return
-				}
-				a.logger.WithField("removed", affected).Info("Cron successfully pruned expired events")
-			}
-		}()
-		runOnInit <- true
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+	jobs.Start(jobsCtx)
+	if webhooks != nil {
+		go webhook.WatchHealth(jobsCtx, webhookHealthInterval, db.CheckHealth, webhooks)
+	}
+
+	if _, err := systemd.Notify(systemd.Ready); err != nil {
+		a.logger.WithError(err).Warn("Unable to notify systemd about readiness")
+	}
+	watchdogInterval, err := systemd.WatchdogInterval()
+	if err != nil {
+		a.logger.WithError(err).Warn("Unable to read systemd watchdog interval, not sending watchdog pings")
+	}
+	if watchdogInterval > 0 {
+		go systemd.RunWatchdog(jobsCtx, watchdogInterval, db.CheckHealth, func(err error) {
+			a.logger.WithError(err).Warn("Error sending systemd watchdog ping")
+		})
 	}
 
-	quit := make(chan os.Signal)
+	// signals are delivered without blocking, so the channels need to be
+	// buffered for not missing a signal that is sent before receiving
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	for running := true; running; {
+		select {
+		case <-reload:
+			systemd.Notify(systemd.Reloading)
+			a.reload(*envFile)
+			systemd.Notify(systemd.Ready)
+		case <-quit:
+			running = false
+		}
+	}
+	systemd.Notify(systemd.Stopping)
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
 		a.logger.WithError(err).Fatal("Error shutting down server")
 	}
+	// buffered events are written only after the server has stopped
+	// accepting requests
+	if err := db.Close(); err != nil {
+		a.logger.WithError(err).Fatal("Error writing pending events")
+	}
 
 	a.logger.Info("Gracefully shut down server")
 }
+
+// skipWhenReadOnly wraps the given job so it does not run while the instance
+// is in read-only mode for maintenance, as all jobs write to the database.
+func (a *app) skipWhenReadOnly(db persistence.Service, name string, run func() error) func() error {
+	return func() error {
+		readOnly := a.config.App.ReadOnly
+		if !readOnly {
+			var err error
+			if readOnly, err = db.ReadOnly(); err != nil {
+				a.logger.WithError(err).WithField("job", name).Error("Error looking up maintenance state")
+				return err
+			}
+		}
+		if readOnly {
+			a.logger.WithField("job", name).Info("Skipping job as instance is in read-only mode")
+			return nil
+		}
+		return run()
+	}
+}
+
+// reportExpiry notifies all configured channels about a finished run of
+// expiring events, so operators can prove that retention periods are being
+// enforced. The report is always logged, and sent to webhooks and email
+// recipients in case they are configured and any event has been removed.
+// As the job runs hourly by default, runs that did not remove anything are
+// not sent so recipients are not flooded with empty reports.
+func (a *app) reportExpiry(report persistence.ExpireReport, webhooks *webhook.Dispatcher, m mailer.Mailer, emails mailer.Templates) {
+	for _, result := range report.Accounts {
+		if result.Expired == 0 {
+			continue
+		}
+		a.logger.WithFields(logrus.Fields{
+			"accountId": result.AccountID,
+			"name":      result.Name,
+			"retention": result.Retention,
+			"removed":   result.Expired,
+		}).Info("Cron pruned expired events of account")
+	}
+	a.logger.
+		WithField("removed", report.Expired).
+		WithField("duration", report.Duration).
+		Info("Cron successfully pruned expired events")
+
+	if report.Expired == 0 {
+		return
+	}
+	if webhooks != nil {
+		webhooks.Notify(webhook.EventRetentionCompleted, report)
+	}
+
+	if len(a.config.Jobs.ExpireRecipients) == 0 {
+		return
+	}
+	subject, body, err := mailer.Render(emails, "expire_report", map[string]interface{}{
+		"finished": report.Started.Add(report.Duration).Format(time.RFC3339),
+		"duration": report.Duration.Round(time.Millisecond).String(),
+		"accounts": report.Accounts,
+		"expired":  report.Expired,
+	})
+	if err != nil {
+		a.logger.WithError(err).Error("Error rendering report of expired events")
+		return
+	}
+	for _, recipient := range a.config.Jobs.ExpireRecipients {
+		if err := m.Send(a.config.SMTP.Sender, recipient, subject, body); err != nil {
+			a.logger.WithError(err).WithField("recipient", recipient).Error("Error sending report of expired events")
+		}
+	}
+}
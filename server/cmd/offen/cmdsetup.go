@@ -4,15 +4,18 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"html"
 	"io/ioutil"
 	"os"
+	"strings"
 	"time"
 
 	uuid "github.com/gofrs/uuid"
 	"github.com/microcosm-cc/bluemonday"
+	"github.com/offen/offen/server/config"
 	"github.com/offen/offen/server/persistence"
 	"github.com/offen/offen/server/persistence/relational"
 	"golang.org/x/crypto/ssh/terminal"
@@ -28,9 +31,14 @@ A basic example for setting up a new instance looks like:
 
 $ offen setup -name "My New Account" -email me@mydomain.org -populate
 
-The command will then prompt for a password to use. Passing -populate will
-create potentially missing secrets in your envfile. Do not pass the flag if you
-plan to do this yourself.
+The command will then prompt for a password to use. In case -name or -email
+are not given either, the command will prompt for them too. Passing -populate
+will create potentially missing secrets in your envfile. Do not pass the flag
+if you plan to do this yourself.
+
+After the account has been created, the snippet for embedding Offen on your
+site is printed. Pass -url in case your instance is not served from the
+default location.
 
 If you do not want to use the CLI, you can also create an initial account and
 user by visting "/setup/" in your browser while the Offen instance is running.
@@ -53,11 +61,22 @@ func cmdSetup(subcommand string, flags []string) {
 		force           = cmd.Bool("force", false, "allow setup to delete existing data")
 		source          = cmd.String("source", "", "a configuration file (this is an experimental feature - do not use it if you are not sure)")
 		accountID       = cmd.String("forceid", "", "force usage of given valid UUID as account ID (this is meant to be used in tests or similar - you probably do not want to use this)")
+		instanceURL     = cmd.String("url", "", "the URL your Offen instance is served from, used for printing the embed snippet")
 	)
 	cmd.Parse(flags)
 	sanitizer := bluemonday.StrictPolicy()
 	a := newApp(*populateMissing, true, *envFile)
 
+	if *source == "" && terminal.IsTerminal(int(os.Stdin.Fd())) {
+		stdin := bufio.NewReader(os.Stdin)
+		if *accountName == "" {
+			*accountName = promptLine(stdin, "Name of the account to create:")
+		}
+		if *email == "" {
+			*email = promptLine(stdin, "Email address used for login:")
+		}
+	}
+
 	pw := *password
 	if *source == "" && pw == "" {
 		received := make(chan bool, 2)
@@ -139,7 +158,21 @@ func cmdSetup(subcommand string, flags []string) {
 		a.logger.WithError(dbErr).Fatal("Error establishing database connection")
 	}
 
-	db, dbErr := persistence.New(relational.NewRelationalDAL(gormDB))
+	keypairs, keypairsErr := a.config.NewKeypairProvider()
+	if keypairsErr != nil {
+		a.logger.WithError(keypairsErr).Fatal("Error creating keypair provider")
+	}
+	userSalts, userSaltsErr := a.config.NewUserSaltProvider()
+	if userSaltsErr != nil {
+		a.logger.WithError(userSaltsErr).Fatal("Error creating user salt provider")
+	}
+
+	db, dbErr := persistence.New(
+		relational.NewRelationalDAL(gormDB),
+		persistence.WithKeypairProvider(keypairs),
+		persistence.WithUserSaltProvider(userSalts),
+		persistence.WithUserIDPepper(a.config.UserIDPepper.Bytes()),
+	)
 	if dbErr != nil {
 		a.logger.WithError(dbErr).Fatal("Error creating persistence layer")
 	}
@@ -153,7 +186,38 @@ func cmdSetup(subcommand string, flags []string) {
 	}
 	if *source == "" {
 		a.logger.Infof("Successfully created account %s with ID %s, you can use the given credentials to access it", *accountName, *accountID)
+		if *instanceURL == "" {
+			*instanceURL = defaultInstanceURL(a.config)
+		}
+		a.logger.Info("To start collecting usage data, add the following snippet to all pages of your site:")
+		fmt.Println(embedSnippet(*instanceURL, *accountID))
 	} else {
 		a.logger.Infof("Successfully bootstrapped database from data in %s", *source)
 	}
 }
+
+func promptLine(r *bufio.Reader, label string) string {
+	fmt.Print(label + " ")
+	line, _ := r.ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+// defaultInstanceURL guesses the URL the instance is served from using the
+// given configuration.
+func defaultInstanceURL(c *config.Config) string {
+	if len(c.Server.AutoTLS) != 0 {
+		return "https://" + c.Server.AutoTLS[0]
+	}
+	scheme := "http"
+	if c.Server.SSLCertificate != "" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://localhost:%d", scheme, c.Server.Port)
+}
+
+func embedSnippet(instanceURL, accountID string) string {
+	return fmt.Sprintf(
+		`<script async src="%s/script.js" data-account-id="%s"></script>`,
+		strings.TrimRight(instanceURL, "/"), accountID,
+	)
+}
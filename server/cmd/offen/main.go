@@ -18,7 +18,14 @@ var mainUsage = `
 - "demo" starts an ephemeral instance for testing
 - "expire" prunes expired events from the database
 - "migrate" applies pending database migrations
-- "debug" prints the currently applied configuration values
+- "debug" prints the currently applied configuration values or verifies account keys
+- "backup" writes an encrypted snapshot of the database
+- "restore" restores a snapshot created by "backup"
+- "export-account" exports an account for moving it to another instance
+- "import-account" imports an account exported from another instance
+- "rotate-salt" rotates the salt used for hashing user ids of an account
+- "replay-events" persists events that could not be written to the database
+- "load" sends synthetic traffic to an instance and reports latencies
 
 Refer to the -help content of each subcommand for information about how to use
 them. Further documentation is available at
@@ -54,6 +61,20 @@ func main() {
 		cmdExpire("expire", flags)
 	case "debug":
 		cmdDebug("debug", flags)
+	case "backup":
+		cmdBackup("backup", flags)
+	case "restore":
+		cmdRestore("restore", flags)
+	case "export-account":
+		cmdExportAccount("export-account", flags)
+	case "import-account":
+		cmdImportAccount("import-account", flags)
+	case "rotate-salt":
+		cmdRotateSalt("rotate-salt", flags)
+	case "replay-events":
+		cmdReplayEvents("replay-events", flags)
+	case "load":
+		cmdLoad("load", flags)
 	case "secret":
 		cmdSecret("secret", flags)
 	case "version":
@@ -4,6 +4,8 @@
 package config
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"os"
@@ -13,18 +15,25 @@ import (
 
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
+	"github.com/offen/offen/server/archive"
+	"github.com/offen/offen/server/archive/s3archive"
+	"github.com/offen/offen/server/deadletter"
+	"github.com/offen/offen/server/features"
 	"github.com/offen/offen/server/keys"
+	"github.com/offen/offen/server/locales"
 	"github.com/offen/offen/server/mailer"
 	"github.com/offen/offen/server/mailer/localmailer"
+	"github.com/offen/offen/server/mailer/nopmailer"
 	"github.com/offen/offen/server/mailer/sendmailmailer"
 	"github.com/offen/offen/server/mailer/smtpmailer"
+	"github.com/redis/go-redis/v9"
 )
 
 const envFileName = "offen.env"
 
 var (
-	// EventRetention defines the duration for which events are expected to
-	//  be kept before expired.
+	// EventRetention defines the default duration for which events are
+	// expected to be kept before expired.
 	EventRetention = time.Hour * 24 * 6 * 31
 )
 
@@ -40,9 +49,131 @@ func (c *Config) SMTPConfigured() bool {
 	return c.SMTP.Host != ""
 }
 
+// Retention returns the duration for which events are kept before being
+// expired. In case no value is configured, EventRetention is used.
+func (c *Config) Retention() time.Duration {
+	reloadLock.RLock()
+	defer reloadLock.RUnlock()
+	if c.App.Retention > 0 {
+		return c.App.Retention
+	}
+	return EventRetention
+}
+
+// ArchiveConfigured returns true if events are supposed to be moved to an
+// archive after a certain duration.
+func (c *Config) ArchiveConfigured() bool {
+	return c.Archive.After > 0 && c.Archive.Bucket != ""
+}
+
+// IsReplica returns true if the instance is supposed to sync data from a
+// primary instance.
+func (c *Config) IsReplica() bool {
+	return c.Sync.Primary != ""
+}
+
+// RedisConfigured returns true if cached data is supposed to be shared with
+// other instances using Redis.
+func (c *Config) RedisConfigured() bool {
+	return c.Redis.Address != ""
+}
+
+// WebhooksConfigured returns true if operators are supposed to be notified
+// about events on the instance using webhooks.
+func (c *Config) WebhooksConfigured() bool {
+	return len(c.Webhooks.URLs) != 0
+}
+
+// WebhookSecret returns the secret used for signing requests sent to the
+// webhook URL at the given index. URLs without a secret of their own use
+// the shared secret.
+func (c *Config) WebhookSecret(index int) string {
+	if index < len(c.Webhooks.Secrets) && c.Webhooks.Secrets[index] != "" {
+		return c.Webhooks.Secrets[index]
+	}
+	return c.Webhooks.Secret
+}
+
+// NewRedis returns a client for the configured Redis server.
+func (c *Config) NewRedis() *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:     c.Redis.Address,
+		Password: c.Redis.Password,
+		DB:       c.Redis.DB,
+	})
+}
+
+// CacheSalt derives the salt used for hashing identifiers in caches that are
+// shared by multiple instances from the configured secret.
+func (c *Config) CacheSalt() []byte {
+	return c.deriveKey("cache")
+}
+
+// NewKeypairProvider returns a provider for the key pairs of accounts using
+// the configured algorithm.
+func (c *Config) NewKeypairProvider() (keys.KeypairProvider, error) {
+	return keys.NewKeypairProvider(c.App.KeyAlgorithm.String(), c.App.RSAKeyLength)
+}
+
+// NewUserSaltProvider returns a provider for the salts accounts use for
+// hashing user ids using the configured algorithm.
+func (c *Config) NewUserSaltProvider() (keys.UserSaltProvider, error) {
+	return keys.NewUserSaltProvider(c.App.UserIDHash.String(), keys.Argon2Params{
+		Time:    c.App.UserIDHashTime,
+		Memory:  c.App.UserIDHashMemory,
+		Threads: c.App.UserIDHashThreads,
+	})
+}
+
+// NewFeatures returns the set of features enabled for the instance.
+func (c *Config) NewFeatures() (*features.Set, error) {
+	return features.New(c.App.Features...)
+}
+
+// NewArchive returns a new archive for the configured S3 compatible storage.
+func (c *Config) NewArchive() archive.Archive {
+	return s3archive.New(
+		c.Archive.Endpoint, c.Archive.Region, c.Archive.Bucket,
+		c.Archive.AccessKeyID, c.Archive.SecretAccessKey,
+	)
+}
+
+// ArchiveKey derives the key used for encrypting archived events from the
+// configured secret.
+func (c *Config) ArchiveKey() []byte {
+	return c.deriveKey("archive")
+}
+
+// TOTPKey derives the key used for encrypting the TOTP secrets of account
+// users from the configured secret.
+func (c *Config) TOTPKey() []byte {
+	return c.deriveKey("totp")
+}
+
+// BackupKey derives the key used for encrypting backups from the configured
+// secret.
+func (c *Config) BackupKey() []byte {
+	return c.deriveKey("backup")
+}
+
+func (c *Config) deriveKey(purpose string) []byte {
+	mac := hmac.New(sha256.New, c.Secret.Bytes())
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// MailerConfigured returns true if the instance has a way of delivering
+// email, i.e. it runs in development, SMTP is configured or sendmail is
+// available.
+func (c *Config) MailerConfigured() bool {
+	return c.App.Development || c.SMTPConfigured() || sendmailmailer.Available()
+}
+
 // NewMailer returns a new mailer that is suitable for the given config.
 // In development, mail content will be printed to stdout. In production,
 // SMTP is preferred and falls back to sendmail if no SMTP credentials are given.
+// In case sendmail is not available either, sending any message fails with
+// mailer.ErrUnavailable.
 func (c *Config) NewMailer() mailer.Mailer {
 	if c.App.Development {
 		return localmailer.New()
@@ -50,7 +181,49 @@ func (c *Config) NewMailer() mailer.Mailer {
 	if c.SMTPConfigured() {
 		return smtpmailer.New(c.SMTP.Host, c.SMTP.User, c.SMTP.Password, c.SMTP.Port)
 	}
-	return sendmailmailer.New()
+	if sendmailmailer.Available() {
+		return sendmailmailer.New()
+	}
+	return nopmailer.New()
+}
+
+// NewDeadLetters returns the store for events that could not be persisted.
+// In case no dead letter file is configured, nil is returned.
+func (c *Config) NewDeadLetters() *deadletter.File {
+	if c.App.DeadLetterFile == "" {
+		return nil
+	}
+	return deadletter.New(c.App.DeadLetterFile.String())
+}
+
+// NewLocalesLoader returns the loader for the message catalogs that are
+// served to clients. Catalogs in the configured locales directory take
+// precedence over the bundled ones.
+func (c *Config) NewLocalesLoader() locales.Loader {
+	if c.App.LocalesDirectory == "" {
+		return locales.DefaultLoader()
+	}
+	return locales.NewMultiLoader(
+		locales.NewDirLoader(c.App.LocalesDirectory.String()),
+		locales.DefaultLoader(),
+	)
+}
+
+// loadEnvFile sets the environment variables defined in the given env file.
+// Variables that are already set in the environment take precedence.
+func loadEnvFile(file string) error {
+	values, err := godotenv.Read(file)
+	if err != nil {
+		// an env file that cannot be read is ignored so that the
+		// configuration is sourced from the environment only
+		return nil
+	}
+	for key, value := range values {
+		if err := setFileValue(key, value); err != nil {
+			return fmt.Errorf("config: error setting %s: %w", key, err)
+		}
+	}
+	return nil
 }
 
 func walkConfigurationCascade() (string, error) {
@@ -64,24 +237,29 @@ func walkConfigurationCascade() (string, error) {
 	switch runtime.GOOS {
 	case "windows":
 		cascade = []string{
-			path.Join(wd, envFileName),
+			wd,
 		}
 	case "darwin", "linux":
 		cascade = []string{
-			path.Join(wd, envFileName),
-			path.Join(ExpandString("$HOME/.config"), envFileName),
-			path.Join(ExpandString("$XDG_CONFIG_HOME"), envFileName),
-			path.Join("/etc/offen", envFileName),
+			wd,
+			ExpandString("$HOME/.config"),
+			ExpandString("$XDG_CONFIG_HOME"),
+			"/etc/offen",
 		}
 	}
-	for _, file := range cascade {
-		_, err := os.Stat(file)
-		if os.IsNotExist(err) {
-			continue
-		} else if err != nil {
-			return "", fmt.Errorf("config: error checking if config file exists in location %s: %w", file, err)
+	for _, dir := range cascade {
+		// in case a directory contains both an env file and a structured
+		// config file, the env file is preferred
+		for _, name := range []string{envFileName, yamlFileName} {
+			file := path.Join(dir, name)
+			_, err := os.Stat(file)
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return "", fmt.Errorf("config: error checking if config file exists in location %s: %w", file, err)
+			}
+			return file, nil
 		}
-		return file, nil
 	}
 	return "", nil
 }
@@ -135,8 +313,17 @@ func New(populateMissing bool, override string) (*Config, error) {
 		}
 	}
 
+	// values from a previous call are cleared so that changes to the file
+	// are picked up when reloading the configuration
+	clearFileValues()
 	if envFile != "" {
-		godotenv.Load(envFile)
+		if isYAMLFile(envFile) {
+			if err := loadYAMLFile(envFile); err != nil {
+				return nil, err
+			}
+		} else if err := loadEnvFile(envFile); err != nil {
+			return nil, err
+		}
 	}
 
 	err := envconfig.Process("offen", &c)
@@ -144,10 +331,17 @@ func New(populateMissing bool, override string) (*Config, error) {
 		return &c, fmt.Errorf("config: error processing configuration: %w", err)
 	}
 
+	if err := c.loadSecretFiles(); err != nil {
+		return nil, err
+	}
+
 	if populateMissing {
 		if envFile == "" {
 			return nil, errors.New("config: unable to find env file to persist settings as no env file could be found")
 		}
+		if isYAMLFile(envFile) {
+			return nil, fmt.Errorf("config: unable to persist settings to config file %s, only env files are supported", envFile)
+		}
 		update := map[string]string{}
 		for _, val := range []autopopulatedValue{
 			{"OFFEN_SECRET", c.Secret.IsZero},
@@ -191,5 +385,9 @@ func New(populateMissing bool, override string) (*Config, error) {
 		}
 	}
 
+	if err := c.Validate(); err != nil {
+		return &c, err
+	}
+
 	return &c, nil
 }
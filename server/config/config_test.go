@@ -4,8 +4,10 @@
 package config
 
 import (
+	"bytes"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
@@ -31,3 +33,120 @@ func TestNew(t *testing.T) {
 		t.Error("Expected app secret to be populated")
 	}
 }
+
+func TestConfig_Retention(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		c := &Config{}
+		if c.Retention() != EventRetention {
+			t.Errorf("Unexpected retention %v", c.Retention())
+		}
+	})
+	t.Run("configured", func(t *testing.T) {
+		c := &Config{}
+		c.App.Retention = time.Hour
+		if c.Retention() != time.Hour {
+			t.Errorf("Unexpected retention %v", c.Retention())
+		}
+	})
+}
+
+func TestConfig_IsReplica(t *testing.T) {
+	c := &Config{}
+	if c.IsReplica() {
+		t.Error("Expected instance not to be a replica")
+	}
+	c.Sync.Primary = "https://primary.offen.dev"
+	if !c.IsReplica() {
+		t.Error("Expected instance to be a replica")
+	}
+}
+
+func TestConfig_WebhookSecret(t *testing.T) {
+	c := &Config{}
+	c.Webhooks.URLs = []string{"https://a.example.com", "https://b.example.com", "https://c.example.com"}
+	c.Webhooks.Secret = "shared"
+	c.Webhooks.Secrets = []string{"secret-a", ""}
+	for index, expected := range []string{"secret-a", "shared", "shared"} {
+		if secret := c.WebhookSecret(index); secret != expected {
+			t.Errorf("Expected %q for index %d, got %q", expected, index, secret)
+		}
+	}
+}
+
+func TestConfig_Archive(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		c := &Config{}
+		if c.ArchiveConfigured() {
+			t.Error("Expected archive not to be configured")
+		}
+	})
+	t.Run("configured", func(t *testing.T) {
+		c := &Config{Secret: Bytes("secret")}
+		c.Archive.After = time.Hour
+		c.Archive.Bucket = "bucket"
+		if !c.ArchiveConfigured() {
+			t.Error("Expected archive to be configured")
+		}
+		if len(c.ArchiveKey()) != 32 {
+			t.Errorf("Unexpected key length %d", len(c.ArchiveKey()))
+		}
+		other := &Config{Secret: Bytes("other")}
+		if bytes.Equal(c.ArchiveKey(), other.ArchiveKey()) {
+			t.Error("Expected keys to differ")
+		}
+		if bytes.Equal(c.ArchiveKey(), c.BackupKey()) {
+			t.Error("Expected keys for different purposes to differ")
+		}
+	})
+}
+
+func TestNew_YAML(t *testing.T) {
+	for _, key := range []string{
+		"OFFEN_SERVER_PORT", "OFFEN_SERVER_AUTOTLS", "OFFEN_DATABASE_DIALECT",
+		"OFFEN_DATABASE_CONNECTIONSTRING", "OFFEN_APP_RETENTION", "OFFEN_APP_BOTFILTER",
+		"OFFEN_USERCOOKIE_SAMESITE", "OFFEN_APP_DEPLOYTARGET",
+	} {
+		defer restoreEnv(key)()
+		os.Unsetenv(key)
+	}
+	os.Setenv("OFFEN_SERVER_PORT", "9876")
+
+	c, err := New(false, "./testdata/offen.yml")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if c.Server.Port != 9876 {
+		t.Errorf("Expected environment to override file, got port %v", c.Server.Port)
+	}
+	if len(c.Server.AutoTLS) != 2 || c.Server.AutoTLS[1] != "www.analytics.offen.dev" {
+		t.Errorf("Unexpected AutoTLS config %v", c.Server.AutoTLS)
+	}
+	if c.Database.Dialect != "postgres" {
+		t.Errorf("Unexpected dialect %v", c.Database.Dialect)
+	}
+	if c.Database.ConnectionString.String() != "postgres://offen@localhost/offen" {
+		t.Errorf("Unexpected connection string %v", c.Database.ConnectionString)
+	}
+	if c.App.Retention != time.Hour*720 {
+		t.Errorf("Unexpected retention %v", c.App.Retention)
+	}
+	if !c.App.BotFilter {
+		t.Error("Expected bot filter to be enabled")
+	}
+	if c.UserCookie.SameSite != "lax" {
+		t.Errorf("Unexpected SameSite value %v", c.UserCookie.SameSite)
+	}
+}
+
+// restoreEnv returns a function that resets the given environment variable
+// to its current state.
+func restoreEnv(key string) func() {
+	value, ok := os.LookupEnv(key)
+	return func() {
+		if ok {
+			os.Setenv(key, value)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// CookieSameSite is the SameSite policy applied to a cookie. In case the
+// value is "auto" or empty, the policy is derived from the request context.
+type CookieSameSite string
+
+// Decode validates and assigns v.
+func (s *CookieSameSite) Decode(v string) error {
+	switch value := strings.ToLower(v); value {
+	case "auto", "lax", "strict", "none":
+		*s = CookieSameSite(value)
+	default:
+		return fmt.Errorf("unknown SameSite policy %s", v)
+	}
+	return nil
+}
+
+// Mode returns the SameSite mode to use for a request. In auto mode, cross
+// site requests are only allowed in secure contexts.
+func (s *CookieSameSite) Mode(secure bool) http.SameSite {
+	switch *s {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		if secure {
+			return http.SameSiteNoneMode
+		}
+		return http.SameSiteLaxMode
+	}
+}
+
+// CookieSecure defines whether the Secure flag is set on a cookie. In case
+// the value is "auto" or empty, the flag is derived from the request context.
+type CookieSecure string
+
+// Decode validates and assigns v.
+func (s *CookieSecure) Decode(v string) error {
+	switch value := strings.ToLower(v); value {
+	case "auto", "true", "false":
+		*s = CookieSecure(value)
+	default:
+		return fmt.Errorf("unknown value for Secure flag %s", v)
+	}
+	return nil
+}
+
+// Value returns whether the Secure flag should be set for a request.
+func (s *CookieSecure) Value(secure bool) bool {
+	switch *s {
+	case "true":
+		return true
+	case "false":
+		return false
+	default:
+		return secure
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCookieSameSite(t *testing.T) {
+	t.Run("error", func(t *testing.T) {
+		var s CookieSameSite
+		if err := s.Decode("sometimes"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+	for _, test := range []struct {
+		value          string
+		secure         bool
+		expectedResult http.SameSite
+	}{
+		{"auto", true, http.SameSiteNoneMode},
+		{"auto", false, http.SameSiteLaxMode},
+		{"Strict", true, http.SameSiteStrictMode},
+		{"lax", true, http.SameSiteLaxMode},
+		{"none", false, http.SameSiteNoneMode},
+	} {
+		t.Run(test.value, func(t *testing.T) {
+			var s CookieSameSite
+			if err := s.Decode(test.value); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if mode := s.Mode(test.secure); mode != test.expectedResult {
+				t.Errorf("Expected %v, got %v", test.expectedResult, mode)
+			}
+		})
+	}
+	t.Run("zero value", func(t *testing.T) {
+		var s CookieSameSite
+		if mode := s.Mode(false); mode != http.SameSiteLaxMode {
+			t.Errorf("Unexpected mode %v", mode)
+		}
+	})
+}
+
+func TestCookieSecure(t *testing.T) {
+	t.Run("error", func(t *testing.T) {
+		var s CookieSecure
+		if err := s.Decode("maybe"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+	for _, test := range []struct {
+		value          string
+		secure         bool
+		expectedResult bool
+	}{
+		{"auto", true, true},
+		{"auto", false, false},
+		{"true", false, true},
+		{"FALSE", true, false},
+	} {
+		t.Run(test.value, func(t *testing.T) {
+			var s CookieSecure
+			if err := s.Decode(test.value); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if value := s.Value(test.secure); value != test.expectedResult {
+				t.Errorf("Expected %v, got %v", test.expectedResult, value)
+			}
+		})
+	}
+}
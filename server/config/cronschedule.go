@@ -0,0 +1,25 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"github.com/offen/offen/server/scheduler"
+)
+
+// CronSchedule is a cron expression defining when a background job is run.
+type CronSchedule string
+
+// Decode validates and assigns v.
+func (c *CronSchedule) Decode(v string) error {
+	if _, err := scheduler.Parse(v); err != nil {
+		return err
+	}
+	*c = CronSchedule(v)
+	return nil
+}
+
+// Schedule parses c into a schedule.
+func (c *CronSchedule) Schedule() (scheduler.Schedule, error) {
+	return scheduler.Parse(string(*c))
+}
@@ -0,0 +1,24 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "testing"
+
+func TestCronSchedule(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var c CronSchedule
+		if err := c.Decode("*/15 * * * *"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if _, err := c.Schedule(); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	})
+	t.Run("bad expression", func(t *testing.T) {
+		var c CronSchedule
+		if err := c.Decode("sometimes"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+}
@@ -5,6 +5,8 @@
 
 package config
 
+import "time"
+
 // Config contains all runtime configuration needed for running offen as
 // and also defines the desired defaults. Package envconfig is used to
 // source values from the application environment at runtime.
@@ -16,28 +18,117 @@ type Config struct {
 		SSLKey           EnvString
 		AutoTLS          []string
 		LetsEncryptEmail string
-		CertificateCache EnvString `default:"%AppData%\offen\.cache"`
+		CertificateCache EnvString     `default:"%AppData%\offen\.cache"`
+		HTTPSRedirect    bool          `default:"false"`
+		HTTPPort         int           `default:"80"`
+		HSTSMaxAge       time.Duration `default:"4380h"`
+		HSTSPreload      bool          `default:"false"`
 	}
 	Database struct {
-		Dialect           Dialect   `default:"sqlite3"`
-		ConnectionString  EnvString `default:"%Temp%\offen.db"`
-		ConnectionRetries int       `default:"0"`
+		Dialect               Dialect   `default:"sqlite3"`
+		ConnectionString      EnvString `default:"%Temp%\offen.db"`
+		ReadConnectionString  EnvString
+		ConnectionRetries     int           `default:"10"`
+		ConnectionTimeout     time.Duration `default:"1m"`
+		MaxOpenConnections    int           `default:"20"`
+		MaxIdleConnections    int           `default:"5"`
+		ConnectionMaxLifetime time.Duration `default:"30m"`
 	}
 	App struct {
-		Development  bool     `default:"false"`
-		LogLevel     LogLevel `default:"info"`
-		SingleNode   bool     `default:"true"`
-		Locale       Locale   `default:"en"`
-		RootAccount  string
-		DemoAccount  string `ignored:"true"`
-		DeployTarget DeployTarget
-	}
-	Secret Bytes
-	SMTP   struct {
-		User     string
+		Development          bool     `default:"false"`
+		LogLevel             LogLevel `default:"info"`
+		SingleNode           bool     `default:"true"`
+		Locale               Locale   `default:"en"`
+		RootAccount          string
+		DemoAccount          string `ignored:"true"`
+		DeployTarget         DeployTarget
+		PrivacySignals       PrivacySignals `default:"ignore"`
+		Retention            time.Duration  `default:"4464h"`
+		KeyAlgorithm         KeyAlgorithm   `default:"rsa-oaep"`
+		RSAKeyLength         int            `default:"4096"`
+		UserIDHash           UserIDHash     `default:"sha256"`
+		UserIDHashTime       uint32         `default:"2"`
+		UserIDHashMemory     uint32         `default:"19456"`
+		UserIDHashThreads    uint8          `default:"1"`
+		MaxEventPayloadSize  int            `default:"65536"`
+		DuplicateEventWindow time.Duration  `default:"0"`
+		DeadLetterFile       EnvString
+		InsertBuffer         int           `default:"0"`
+		InsertBatchSize      int           `default:"100"`
+		InsertFlushInterval  time.Duration `default:"1s"`
+		AccountCacheSize     int           `default:"1000"`
+		AccountCacheTTL      time.Duration `default:"1m"`
+		EventQuota           int           `default:"0"`
+		IngestConcurrency    int           `default:"0"`
+		IngestQueueTimeout   time.Duration `default:"250ms"`
+		IngestHookURL        string
+		IngestHookTimeout    time.Duration `default:"250ms"`
+		IngestRateLimit      time.Duration `default:"500ms"`
+		BotFilter            bool          `default:"false"`
+		BotUserAgents        []string
+		OriginCheck          OriginCheck `default:"off"`
+		CORSOrigins          []string
+		ReadOnly             bool        `default:"false"`
+		Features             []string
+		SamplingRate         float64 `default:"1"`
+		LocalesDirectory     EnvString
+		MetricsToken         string
+	}
+	UserCookie struct {
+		Disabled       bool           `default:"false"`
+		SameSite       CookieSameSite `default:"auto"`
+		Secure         CookieSecure   `default:"auto"`
+		Domain         string
+		Path           string `default:"/api"`
+		MaxAge         time.Duration
+		AcceptUnsigned bool `default:"true"`
+	}
+	Headers struct {
+		Disabled                   bool `default:"false"`
+		ContentSecurityPolicy      string
+		VaultContentSecurityPolicy string
+		VaultFrameAncestors        []string
+		ReferrerPolicy             string `default:"origin-when-cross-origin"`
+	}
+	Jobs struct {
+		Jitter           time.Duration `default:"1m"`
+		Expire           CronSchedule  `default:"@hourly"`
+		Secrets          CronSchedule  `default:"@daily"`
+		Archive          CronSchedule  `default:"@daily"`
+		Sync             CronSchedule  `default:"@every 1m"`
+		ExpireRecipients []string
+	}
+	Archive struct {
+		After           time.Duration
+		Endpoint        string
+		Region          string `default:"us-east-1"`
+		Bucket          string
+		AccessKeyID     string
+		SecretAccessKey string
+	}
+	Sync struct {
+		Primary string
+		Token   string
+	}
+	Redis struct {
+		Address  string
 		Password string
-		Host     string
-		Port     int    `default:"587"`
-		Sender   string `default:"no-reply@offen.dev"`
+		DB       int `default:"0"`
+	}
+	Webhooks struct {
+		URLs        []string
+		Secret      string
+		Secrets     []string
+		MaxAttempts int `default:"5"`
+	}
+	Secret       Bytes
+	UserIDPepper Bytes
+	SMTP         struct {
+		User        string
+		Password    string
+		Host        string
+		Port        int    `default:"587"`
+		Sender      string `default:"no-reply@offen.dev"`
+		MaxAttempts int    `default:"3"`
 	}
 }
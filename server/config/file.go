@@ -0,0 +1,81 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const yamlFileName = "offen.yml"
+
+func isYAMLFile(file string) bool {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yml", ".yaml":
+		return true
+	default:
+		return false
+	}
+}
+
+// loadYAMLFile reads the structured configuration file at the given location
+// and sets the environment variables its values map to. Just like values from
+// env files, variables that are already set in the environment take precedence.
+func loadYAMLFile(file string) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("config: error reading config file: %w", err)
+	}
+	var values map[interface{}]interface{}
+	if err := yaml.Unmarshal(b, &values); err != nil {
+		return fmt.Errorf("config: error parsing config file %s: %w", file, err)
+	}
+	env := map[string]string{}
+	if err := flattenYAML("OFFEN", values, env); err != nil {
+		return fmt.Errorf("config: error parsing config file %s: %w", file, err)
+	}
+	for key, value := range env {
+		if err := setFileValue(key, value); err != nil {
+			return fmt.Errorf("config: error setting %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// flattenYAML maps the nested structure of a config file onto the names of
+// the environment variables the configuration is sourced from, e.g.
+// `database.connectionString` is mapped onto `OFFEN_DATABASE_CONNECTIONSTRING`.
+func flattenYAML(prefix string, values map[interface{}]interface{}, result map[string]string) error {
+	for rawKey, rawValue := range values {
+		key := strings.NewReplacer("_", "", "-", "").Replace(
+			strings.ToUpper(fmt.Sprintf("%v", rawKey)),
+		)
+		key = prefix + "_" + key
+		switch value := rawValue.(type) {
+		case nil:
+			continue
+		case map[interface{}]interface{}:
+			if err := flattenYAML(key, value, result); err != nil {
+				return err
+			}
+		case []interface{}:
+			var items []string
+			for _, item := range value {
+				switch item.(type) {
+				case map[interface{}]interface{}, []interface{}:
+					return fmt.Errorf("config: unsupported nested value in list %s", key)
+				}
+				items = append(items, fmt.Sprintf("%v", item))
+			}
+			result[key] = strings.Join(items, ",")
+		default:
+			result[key] = fmt.Sprintf("%v", value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFlattenYAML(t *testing.T) {
+	tests := []struct {
+		name           string
+		values         map[interface{}]interface{}
+		expectedResult map[string]string
+		expectError    bool
+	}{
+		{
+			"empty",
+			map[interface{}]interface{}{},
+			map[string]string{},
+			false,
+		},
+		{
+			"nested",
+			map[interface{}]interface{}{
+				"secret": "abc",
+				"app": map[interface{}]interface{}{
+					"rsa_key_length": 2048,
+					"botUserAgents":  []interface{}{"a", "b"},
+					"demoAccount":    nil,
+				},
+			},
+			map[string]string{
+				"OFFEN_SECRET":            "abc",
+				"OFFEN_APP_RSAKEYLENGTH":  "2048",
+				"OFFEN_APP_BOTUSERAGENTS": "a,b",
+			},
+			false,
+		},
+		{
+			"nested list",
+			map[interface{}]interface{}{
+				"app": map[interface{}]interface{}{
+					"features": []interface{}{[]interface{}{"a"}},
+				},
+			},
+			map[string]string{},
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := map[string]string{}
+			err := flattenYAML("OFFEN", test.values, result)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if !test.expectError && !reflect.DeepEqual(test.expectedResult, result) {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/offen/offen/server/keys"
+)
+
+// KeyAlgorithm defines the algorithm of the key pairs created for new
+// accounts.
+type KeyAlgorithm string
+
+// Decode validates and assigns v.
+func (k *KeyAlgorithm) Decode(v string) error {
+	value := strings.ToLower(v)
+	if !keys.IsKnownKeyAlgorithm(value) {
+		return fmt.Errorf("config: unknown key algorithm %s", v)
+	}
+	*k = KeyAlgorithm(value)
+	return nil
+}
+
+func (k *KeyAlgorithm) String() string {
+	return string(*k)
+}
@@ -0,0 +1,36 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"testing"
+
+	"github.com/offen/offen/server/keys"
+)
+
+func TestKeyAlgorithm(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var k KeyAlgorithm
+		if err := k.Decode("RSA-OAEP"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if k != keys.KeyAlgorithmRSAOAEP {
+			t.Errorf("Unexpected value %v", k.String())
+		}
+	})
+	t.Run("unknown", func(t *testing.T) {
+		var k KeyAlgorithm
+		if err := k.Decode("dsa"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+	t.Run("unsupported by clients", func(t *testing.T) {
+		for _, value := range []string{"ecdh-p256", "nacl-box"} {
+			var k KeyAlgorithm
+			if err := k.Decode(value); err == nil {
+				t.Errorf("Unexpected nil error for %s", value)
+			}
+		}
+	})
+}
@@ -0,0 +1,41 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OriginCheck defines how the origin of events is checked against the domains
+// of the account they are sent to.
+type OriginCheck string
+
+// this defines all the known modes of checking origins.
+const (
+	// OriginCheckOff accepts events from any origin.
+	OriginCheckOff OriginCheck = "off"
+	// OriginCheckLenient rejects events that are sent from an origin not
+	// matching the account's domains, but accepts events that do not carry
+	// any origin information.
+	OriginCheckLenient OriginCheck = "lenient"
+	// OriginCheckStrict requires events to be sent from an origin matching
+	// the account's domains.
+	OriginCheckStrict OriginCheck = "strict"
+)
+
+// Decode validates and assigns v.
+func (o *OriginCheck) Decode(v string) error {
+	switch value := OriginCheck(strings.ToLower(v)); value {
+	case OriginCheckOff, OriginCheckLenient, OriginCheckStrict:
+		*o = value
+	default:
+		return fmt.Errorf("config: unknown mode for checking origins %s", v)
+	}
+	return nil
+}
+
+func (o *OriginCheck) String() string {
+	return string(*o)
+}
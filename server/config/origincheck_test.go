@@ -0,0 +1,24 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "testing"
+
+func TestOriginCheck(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var o OriginCheck
+		if err := o.Decode("Strict"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if o != OriginCheckStrict {
+			t.Errorf("Unexpected value %v", o.String())
+		}
+	})
+	t.Run("unknown", func(t *testing.T) {
+		var o OriginCheck
+		if err := o.Decode("maybe"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+}
@@ -0,0 +1,35 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PrivacySignals defines how requests carrying a Do-Not-Track or Global
+// Privacy Control signal are handled.
+type PrivacySignals string
+
+// this defines all the known modes of handling privacy signals.
+const (
+	PrivacySignalsIgnore    PrivacySignals = "ignore"
+	PrivacySignalsAnonymous PrivacySignals = "anonymous"
+	PrivacySignalsDrop      PrivacySignals = "drop"
+)
+
+// Decode validates and assigns v.
+func (p *PrivacySignals) Decode(v string) error {
+	switch value := PrivacySignals(strings.ToLower(v)); value {
+	case PrivacySignalsIgnore, PrivacySignalsAnonymous, PrivacySignalsDrop:
+		*p = value
+	default:
+		return fmt.Errorf("config: unknown mode for handling privacy signals %s", v)
+	}
+	return nil
+}
+
+func (p *PrivacySignals) String() string {
+	return string(*p)
+}
@@ -0,0 +1,24 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "testing"
+
+func TestPrivacySignals(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var p PrivacySignals
+		if err := p.Decode("Anonymous"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if p != PrivacySignalsAnonymous {
+			t.Errorf("Unexpected value %v", p.String())
+		}
+	})
+	t.Run("unknown", func(t *testing.T) {
+		var p PrivacySignals
+		if err := p.Decode("yes"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+}
@@ -0,0 +1,114 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reloadLock guards the settings that can be changed by calling Reload while
+// they are read concurrently.
+var reloadLock sync.RWMutex
+
+// fileValues contains all environment variables that have been set from a
+// config file, so they can be cleared before the file is read again.
+var fileValues = map[string]string{}
+
+func setFileValue(key, value string) error {
+	if _, ok := os.LookupEnv(key); ok {
+		return nil
+	}
+	if err := os.Setenv(key, value); err != nil {
+		return err
+	}
+	fileValues[key] = value
+	return nil
+}
+
+func clearFileValues() {
+	for key, value := range fileValues {
+		// variables that have been changed in the meantime have not been set
+		// by the file anymore
+		if os.Getenv(key) == value {
+			os.Unsetenv(key)
+		}
+	}
+	fileValues = map[string]string{}
+}
+
+// Reload applies the settings of next that can safely be changed while the
+// application is running onto c. It returns the keys of all settings that
+// have changed. All other settings in next are ignored.
+func (c *Config) Reload(next *Config) []string {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+	var changed []string
+	if c.App.LogLevel != next.App.LogLevel {
+		c.App.LogLevel = next.App.LogLevel
+		changed = append(changed, "OFFEN_APP_LOGLEVEL")
+	}
+	if c.App.Retention != next.App.Retention {
+		c.App.Retention = next.App.Retention
+		changed = append(changed, "OFFEN_APP_RETENTION")
+	}
+	if c.App.OriginCheck != next.App.OriginCheck {
+		c.App.OriginCheck = next.App.OriginCheck
+		changed = append(changed, "OFFEN_APP_ORIGINCHECK")
+	}
+	if c.App.MaxEventPayloadSize != next.App.MaxEventPayloadSize {
+		c.App.MaxEventPayloadSize = next.App.MaxEventPayloadSize
+		changed = append(changed, "OFFEN_APP_MAXEVENTPAYLOADSIZE")
+	}
+	if c.App.IngestRateLimit != next.App.IngestRateLimit {
+		c.App.IngestRateLimit = next.App.IngestRateLimit
+		changed = append(changed, "OFFEN_APP_INGESTRATELIMIT")
+	}
+	if !reflect.DeepEqual(c.App.CORSOrigins, next.App.CORSOrigins) {
+		c.App.CORSOrigins = next.App.CORSOrigins
+		changed = append(changed, "OFFEN_APP_CORSORIGINS")
+	}
+	return changed
+}
+
+// OriginCheckMode returns the currently configured mode for checking the
+// origin of events.
+func (c *Config) OriginCheckMode() OriginCheck {
+	reloadLock.RLock()
+	defer reloadLock.RUnlock()
+	return c.App.OriginCheck
+}
+
+// MaxEventPayloadSize returns the currently configured maximum length of
+// event payloads.
+func (c *Config) MaxEventPayloadSize() int {
+	reloadLock.RLock()
+	defer reloadLock.RUnlock()
+	return c.App.MaxEventPayloadSize
+}
+
+// IngestRateLimit returns the currently configured minimum interval between
+// two requests for inserting events sent by the same client.
+func (c *Config) IngestRateLimit() time.Duration {
+	reloadLock.RLock()
+	defer reloadLock.RUnlock()
+	return c.App.IngestRateLimit
+}
+
+// AllowsCORSOrigin checks whether the given origin is currently configured to
+// be allowed to send cross-origin requests.
+func (c *Config) AllowsCORSOrigin(origin string) bool {
+	reloadLock.RLock()
+	defer reloadLock.RUnlock()
+	origin = strings.TrimSuffix(origin, "/")
+	for _, allowed := range c.App.CORSOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestConfig_Reload(t *testing.T) {
+	c := &Config{}
+	c.App.LogLevel = LogLevel(logrus.InfoLevel)
+	c.App.Retention = time.Hour * 48
+	c.Server.Port = 3000
+
+	next := &Config{}
+	next.App.LogLevel = LogLevel(logrus.DebugLevel)
+	next.App.Retention = time.Hour * 48
+	next.App.OriginCheck = OriginCheckStrict
+	next.App.IngestRateLimit = time.Second
+	next.App.CORSOrigins = []string{"https://dashboard.example.com"}
+	next.Server.Port = 4000
+
+	changed := c.Reload(next)
+	expected := []string{"OFFEN_APP_LOGLEVEL", "OFFEN_APP_ORIGINCHECK", "OFFEN_APP_INGESTRATELIMIT", "OFFEN_APP_CORSORIGINS"}
+	if !reflect.DeepEqual(expected, changed) {
+		t.Errorf("Expected %v, got %v", expected, changed)
+	}
+	if c.App.LogLevel != LogLevel(logrus.DebugLevel) || c.OriginCheckMode() != OriginCheckStrict {
+		t.Errorf("Expected settings to be applied, got %v", c.App)
+	}
+	if c.IngestRateLimit() != time.Second {
+		t.Errorf("Expected rate limit to be applied, got %v", c.IngestRateLimit())
+	}
+	if !c.AllowsCORSOrigin("https://Dashboard.example.com") || c.AllowsCORSOrigin("https://example.com") {
+		t.Errorf("Expected CORS origins to be applied, got %v", c.App.CORSOrigins)
+	}
+	if c.Server.Port != 3000 {
+		t.Errorf("Expected port not to be reloaded, got %v", c.Server.Port)
+	}
+}
+
+func TestNew_ReloadFile(t *testing.T) {
+	for _, key := range []string{"OFFEN_APP_DEPLOYTARGET", "OFFEN_APP_LOGLEVEL"} {
+		defer restoreEnv(key)()
+		os.Unsetenv(key)
+	}
+	defer clearFileValues()
+
+	dir, err := ioutil.TempDir("", "offen-reload")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "offen.env")
+
+	ioutil.WriteFile(file, []byte("OFFEN_APP_LOGLEVEL=warn\n"), 0644)
+	c, err := New(false, file)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if c.App.LogLevel != LogLevel(logrus.WarnLevel) {
+		t.Errorf("Unexpected log level %v", c.App.LogLevel)
+	}
+
+	ioutil.WriteFile(file, []byte("OFFEN_APP_LOGLEVEL=debug\n"), 0644)
+	c, err = New(false, file)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if c.App.LogLevel != LogLevel(logrus.DebugLevel) {
+		t.Errorf("Expected changed file to be picked up, got %v", c.App.LogLevel)
+	}
+}
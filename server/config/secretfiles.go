@@ -0,0 +1,60 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+type secretFile struct {
+	key string
+	set func(c *Config, value string) error
+}
+
+// secretFiles are all settings that can be read from a file by setting the
+// variable of the same name suffixed with `_FILE`, so the values do not have
+// to be passed in the environment. Values read from files are written to the
+// configuration directly and are never exported to the environment, where
+// they would be visible to child processes.
+var secretFiles = []secretFile{
+	{"OFFEN_SECRET", func(c *Config, v string) error { return c.Secret.Decode(v) }},
+	{"OFFEN_USERIDPEPPER", func(c *Config, v string) error { return c.UserIDPepper.Decode(v) }},
+	{"OFFEN_DATABASE_CONNECTIONSTRING", func(c *Config, v string) error { return c.Database.ConnectionString.Decode(v) }},
+	{"OFFEN_DATABASE_READCONNECTIONSTRING", func(c *Config, v string) error { return c.Database.ReadConnectionString.Decode(v) }},
+	{"OFFEN_SMTP_PASSWORD", func(c *Config, v string) error { c.SMTP.Password = v; return nil }},
+	{"OFFEN_ARCHIVE_ACCESSKEYID", func(c *Config, v string) error { c.Archive.AccessKeyID = v; return nil }},
+	{"OFFEN_ARCHIVE_SECRETACCESSKEY", func(c *Config, v string) error { c.Archive.SecretAccessKey = v; return nil }},
+	{"OFFEN_SYNC_TOKEN", func(c *Config, v string) error { c.Sync.Token = v; return nil }},
+	{"OFFEN_APP_METRICSTOKEN", func(c *Config, v string) error { c.App.MetricsToken = v; return nil }},
+	{"OFFEN_REDIS_PASSWORD", func(c *Config, v string) error { c.Redis.Password = v; return nil }},
+	{"OFFEN_WEBHOOKS_SECRET", func(c *Config, v string) error { c.Webhooks.Secret = v; return nil }},
+	{"OFFEN_WEBHOOKS_SECRETS", func(c *Config, v string) error { c.Webhooks.Secrets = strings.Split(v, ","); return nil }},
+}
+
+// loadSecretFiles sets the settings in secretFiles from the content of the
+// files their `_FILE` variants point to.
+func (c *Config) loadSecretFiles() error {
+	for _, secret := range secretFiles {
+		file, ok := os.LookupEnv(secret.key + "_FILE")
+		if !ok || file == "" {
+			continue
+		}
+		if _, ok := os.LookupEnv(secret.key); ok {
+			return fmt.Errorf("config: both %s and %s_FILE are set, only one of them can be used", secret.key, secret.key)
+		}
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("config: error reading value for %s from file: %w", secret.key, err)
+		}
+		// files created by editors or `echo` commonly end with a newline
+		// which is not considered to be part of the value
+		if err := secret.set(c, strings.TrimRight(string(b), "\r\n")); err != nil {
+			return fmt.Errorf("config: error setting %s: %w", secret.key, err)
+		}
+	}
+	return nil
+}
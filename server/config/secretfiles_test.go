@@ -0,0 +1,76 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadSecretFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "offen-secrets")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "token")
+	ioutil.WriteFile(file, []byte("s3cr3t\n"), 0600)
+
+	tests := []struct {
+		name          string
+		env           map[string]string
+		expectError   bool
+		expectedValue string
+	}{
+		{
+			"no file",
+			map[string]string{},
+			false,
+			"",
+		},
+		{
+			"file",
+			map[string]string{"OFFEN_SYNC_TOKEN_FILE": file},
+			false,
+			"s3cr3t",
+		},
+		{
+			"missing file",
+			map[string]string{"OFFEN_SYNC_TOKEN_FILE": filepath.Join(dir, "missing")},
+			true,
+			"",
+		},
+		{
+			"both set",
+			map[string]string{"OFFEN_SYNC_TOKEN_FILE": file, "OFFEN_SYNC_TOKEN": "other"},
+			true,
+			"other",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, key := range []string{"OFFEN_SYNC_TOKEN", "OFFEN_SYNC_TOKEN_FILE"} {
+				defer restoreEnv(key)()
+				os.Unsetenv(key)
+			}
+			for key, value := range test.env {
+				os.Setenv(key, value)
+			}
+			var c Config
+			c.Sync.Token = os.Getenv("OFFEN_SYNC_TOKEN")
+			err := c.loadSecretFiles()
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if c.Sync.Token != test.expectedValue {
+				t.Errorf("Expected %q, got %q", test.expectedValue, c.Sync.Token)
+			}
+			if test.expectedValue == "s3cr3t" && os.Getenv("OFFEN_SYNC_TOKEN") != "" {
+				t.Error("Expected value not to be exported to the environment")
+			}
+		})
+	}
+}
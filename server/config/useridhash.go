@@ -0,0 +1,29 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/offen/offen/server/keys"
+)
+
+// UserIDHash defines the algorithm new accounts use for hashing user ids.
+type UserIDHash string
+
+// Decode validates and assigns v.
+func (u *UserIDHash) Decode(v string) error {
+	switch value := strings.ToLower(v); value {
+	case keys.UserIDHashSHA256, keys.UserIDHashArgon2id:
+		*u = UserIDHash(value)
+	default:
+		return fmt.Errorf("config: unknown user id hashing algorithm %s", v)
+	}
+	return nil
+}
+
+func (u *UserIDHash) String() string {
+	return string(*u)
+}
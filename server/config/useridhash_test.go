@@ -0,0 +1,28 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"testing"
+
+	"github.com/offen/offen/server/keys"
+)
+
+func TestUserIDHash(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var u UserIDHash
+		if err := u.Decode("Argon2id"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if u != keys.UserIDHashArgon2id {
+			t.Errorf("Unexpected value %v", u.String())
+		}
+	})
+	t.Run("unknown", func(t *testing.T) {
+		var u UserIDHash
+		if err := u.Decode("md5"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+}
@@ -0,0 +1,206 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	"github.com/offen/offen/server/keys"
+)
+
+// minRetention is the shortest retention period that is accepted.
+const minRetention = time.Hour * 24
+
+// Problem describes a single issue with a configuration.
+type Problem struct {
+	Key     string
+	Message string
+	Hint    string
+}
+
+func (p Problem) String() string {
+	if p.Hint == "" {
+		return fmt.Sprintf("%s: %s", p.Key, p.Message)
+	}
+	return fmt.Sprintf("%s: %s (%s)", p.Key, p.Message, p.Hint)
+}
+
+// ValidationError is returned when a configuration contains one or more
+// problems.
+type ValidationError []Problem
+
+func (v ValidationError) Error() string {
+	var lines []string
+	for _, p := range v {
+		lines = append(lines, p.String())
+	}
+	return fmt.Sprintf("config: found %d problem(s) with the configuration: %s", len(v), strings.Join(lines, "; "))
+}
+
+// Validate checks the entire configuration and collects all problems it finds
+// instead of stopping at the first one. In case there are problems, the
+// returned error is a ValidationError.
+func (c *Config) Validate() error {
+	var problems ValidationError
+	add := func(key, message, hint string) {
+		problems = append(problems, Problem{Key: key, Message: message, Hint: hint})
+	}
+
+	if c.Database.ConnectionString == "" {
+		add("OFFEN_DATABASE_CONNECTIONSTRING", "no connection string is configured", "set the location of your database")
+	} else if err := validateConnectionString(c.Database.Dialect, c.Database.ConnectionString.String()); err != nil {
+		add("OFFEN_DATABASE_CONNECTIONSTRING", err.Error(), "check the connection string matches the format expected for OFFEN_DATABASE_DIALECT")
+	}
+	if c.Database.ReadConnectionString != "" {
+		if c.Database.Dialect == "sqlite3" {
+			add("OFFEN_DATABASE_READCONNECTIONSTRING", "read replicas are not supported when using SQLite", "unset the read connection string or use a different dialect")
+		} else if err := validateConnectionString(c.Database.Dialect, c.Database.ReadConnectionString.String()); err != nil {
+			add("OFFEN_DATABASE_READCONNECTIONSTRING", err.Error(), "check the connection string matches the format expected for OFFEN_DATABASE_DIALECT")
+		}
+	}
+	if c.Database.Dialect != "sqlite3" && c.Database.MaxOpenConnections < 1 {
+		add("OFFEN_DATABASE_MAXOPENCONNECTIONS", "at least one connection is required", "set a positive value")
+	}
+
+	if c.Server.SSLCertificate != "" && c.Server.SSLKey == "" {
+		add("OFFEN_SERVER_SSLKEY", "a certificate is configured without a key", "set the location of the key matching OFFEN_SERVER_SSLCERTIFICATE")
+	}
+	if c.Server.SSLKey != "" && c.Server.SSLCertificate == "" {
+		add("OFFEN_SERVER_SSLCERTIFICATE", "a key is configured without a certificate", "set the location of the certificate matching OFFEN_SERVER_SSLKEY")
+	}
+	if len(c.Server.AutoTLS) > 0 && c.Server.SSLCertificate != "" {
+		add("OFFEN_SERVER_AUTOTLS", "cannot be used together with OFFEN_SERVER_SSLCERTIFICATE", "either acquire certificates automatically or supply your own")
+	}
+	if c.Server.HTTPSRedirect {
+		if c.Server.SSLCertificate == "" {
+			add("OFFEN_SERVER_HTTPSREDIRECT", "redirecting to HTTPS requires a certificate", "set OFFEN_SERVER_SSLCERTIFICATE, AutoTLS always redirects")
+		} else if c.Server.HTTPPort == c.Server.Port {
+			add("OFFEN_SERVER_HTTPPORT", "cannot be the same as OFFEN_SERVER_PORT", "use a different port for redirecting")
+		}
+	}
+	if c.Server.HSTSMaxAge < 0 {
+		add("OFFEN_SERVER_HSTSMAXAGE", "must not be negative", "use 0 to disable HSTS")
+	}
+
+	if !c.Secret.IsZero() && len(c.Secret.Bytes()) < keys.DefaultSecretLength {
+		add("OFFEN_SECRET", fmt.Sprintf("must be at least %d bytes long", keys.DefaultSecretLength), "create a new value using `offen secret`")
+	}
+	if !c.UserIDPepper.IsZero() && len(c.UserIDPepper.Bytes()) < keys.DefaultSecretLength {
+		add("OFFEN_USERIDPEPPER", fmt.Sprintf("must be at least %d bytes long", keys.DefaultSecretLength), "create a new value using `offen secret`")
+	}
+	if _, err := c.NewKeypairProvider(); err != nil {
+		add("OFFEN_APP_KEYALGORITHM", err.Error(), "check OFFEN_APP_KEYALGORITHM and OFFEN_APP_RSAKEYLENGTH")
+	}
+	if _, err := c.NewUserSaltProvider(); err != nil {
+		add("OFFEN_APP_USERIDHASH", err.Error(), "check OFFEN_APP_USERIDHASH and its parameters")
+	}
+	if _, err := c.NewFeatures(); err != nil {
+		add("OFFEN_APP_FEATURES", err.Error(), "remove unknown features")
+	}
+
+	if c.App.Retention != 0 && c.App.Retention < minRetention {
+		add("OFFEN_APP_RETENTION", fmt.Sprintf("must be at least %v", minRetention), "use a longer retention period")
+	}
+	if c.App.InsertBuffer > 0 && (c.App.InsertBatchSize <= 0 || c.App.InsertFlushInterval <= 0) {
+		add("OFFEN_APP_INSERTBUFFER", "buffering inserts requires a positive batch size and flush interval", "set OFFEN_APP_INSERTBATCHSIZE and OFFEN_APP_INSERTFLUSHINTERVAL")
+	}
+	if c.App.EventQuota < 0 {
+		add("OFFEN_APP_EVENTQUOTA", "must not be negative", "use 0 to disable quotas")
+	}
+	if c.App.SamplingRate < 0 || c.App.SamplingRate > 1 {
+		add("OFFEN_APP_SAMPLINGRATE", "must be between 0 and 1", "use 1 to collect data from all users")
+	}
+	if c.App.IngestConcurrency < 0 {
+		add("OFFEN_APP_INGESTCONCURRENCY", "must not be negative", "use 0 to disable limiting concurrent inserts")
+	}
+	if c.App.IngestRateLimit < 0 {
+		add("OFFEN_APP_INGESTRATELIMIT", "must not be negative", "use 0 to disable rate limiting inserts")
+	}
+	for _, origin := range c.App.CORSOrigins {
+		if u, err := url.Parse(origin); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.TrimSuffix(u.Path, "/") != "" {
+			add("OFFEN_APP_CORSORIGINS", fmt.Sprintf("%q is not a valid origin", origin), "use a comma separated list of origins, e.g. https://dashboard.example.com")
+		}
+	}
+	if c.App.IngestHookURL != "" {
+		if u, err := url.Parse(c.App.IngestHookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("OFFEN_APP_INGESTHOOKURL", "is not a valid URL", "use a full URL, e.g. https://hooks.example.com/inspect")
+		}
+		if c.App.IngestHookTimeout <= 0 {
+			add("OFFEN_APP_INGESTHOOKTIMEOUT", "must be positive", "use a short timeout, e.g. 250ms")
+		}
+	}
+
+	if c.SMTP.MaxAttempts < 1 {
+		add("OFFEN_SMTP_MAXATTEMPTS", "at least one attempt is required", "set a positive value")
+	}
+
+	for _, recipient := range c.Jobs.ExpireRecipients {
+		if _, err := mail.ParseAddress(recipient); err != nil {
+			add("OFFEN_JOBS_EXPIRERECIPIENTS", fmt.Sprintf("%q is not a valid email address", recipient), "use a comma separated list of email addresses")
+		}
+	}
+
+	if c.Archive.After > 0 {
+		if c.Archive.Bucket == "" {
+			add("OFFEN_ARCHIVE_BUCKET", "archiving events requires a bucket", "set a bucket or unset OFFEN_ARCHIVE_AFTER")
+		}
+		if c.Archive.After >= c.Retention() {
+			add("OFFEN_ARCHIVE_AFTER", "events expire before they are archived", "use a value shorter than OFFEN_APP_RETENTION")
+		}
+	}
+
+	if c.Sync.Primary != "" {
+		if c.Sync.Token == "" {
+			add("OFFEN_SYNC_TOKEN", "syncing from a primary instance requires a sync token", "set the token configured on the primary instance")
+		}
+		if u, err := url.Parse(c.Sync.Primary); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("OFFEN_SYNC_PRIMARY", "is not a valid URL", "use the full URL of the primary instance, e.g. https://offen.example.com")
+		}
+	}
+
+	if len(c.Webhooks.URLs) != 0 {
+		for _, webhookURL := range c.Webhooks.URLs {
+			if u, err := url.Parse(webhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				add("OFFEN_WEBHOOKS_URLS", fmt.Sprintf("%q is not a valid URL", webhookURL), "use full URLs, e.g. https://hooks.example.com/offen")
+			}
+		}
+		if len(c.Webhooks.Secrets) != 0 && len(c.Webhooks.Secrets) != len(c.Webhooks.URLs) {
+			add("OFFEN_WEBHOOKS_SECRETS", fmt.Sprintf("expected %d secrets, got %d", len(c.Webhooks.URLs), len(c.Webhooks.Secrets)), "pass one secret per URL, leaving values empty to use OFFEN_WEBHOOKS_SECRET")
+		}
+		for i := range c.Webhooks.URLs {
+			if c.WebhookSecret(i) == "" {
+				add("OFFEN_WEBHOOKS_SECRET", "sending webhooks requires a secret for signing requests", "create a new value using `offen secret`")
+				break
+			}
+		}
+		if c.Webhooks.MaxAttempts < 1 {
+			add("OFFEN_WEBHOOKS_MAXATTEMPTS", "at least one attempt is required", "set a positive value")
+		}
+	}
+
+	if len(problems) != 0 {
+		return problems
+	}
+	return nil
+}
+
+func validateConnectionString(dialect Dialect, connectionString string) error {
+	switch dialect {
+	case "mysql":
+		if _, err := mysql.ParseDSN(connectionString); err != nil {
+			return fmt.Errorf("unable to parse connection string: %w", err)
+		}
+	case "postgres":
+		if _, err := pgconn.ParseConfig(connectionString); err != nil {
+			return fmt.Errorf("unable to parse connection string: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package deadletter keeps events that could not be persisted, e.g. during a
+// database outage, so they can be replayed later on.
+package deadletter
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry is an event that could not be persisted when it was received.
+type Entry struct {
+	UserID     string    `json:"userId,omitempty"`
+	AccountID  string    `json:"accountId"`
+	Payload    string    `json:"payload"`
+	EventID    string    `json:"eventId"`
+	ReceivedAt time.Time `json:"receivedAt"`
+}
+
+// File stores entries in a file on disk, one JSON encoded entry per line.
+type File struct {
+	path string
+	lock sync.Mutex
+}
+
+// New creates a new File that stores entries at the given location. The
+// file is created on the first write.
+func New(path string) *File {
+	return &File{path: path}
+}
+
+// Write appends the given entry to the file.
+func (f *File) Write(e Entry) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.write([]Entry{e})
+}
+
+func (f *File) write(entries []Entry) error {
+	// entries contain user ids in plaintext, so the file is not supposed
+	// to be readable by anyone else
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("deadletter: error opening file: %w", err)
+	}
+	defer file.Close()
+
+	enc := json.NewEncoder(file)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("deadletter: error writing entry: %w", err)
+		}
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("deadletter: error syncing file: %w", err)
+	}
+	return nil
+}
+
+// Replay calls fn for each stored entry. Entries for which fn returns an
+// error are kept for the next replay, all others are removed. Entries that
+// are written while replaying are kept as well. As an aborted replay is
+// picked up again, fn might be called more than once for the same entry.
+// It returns the number of replayed and remaining entries.
+func (f *File) Replay(fn func(Entry) error) (int, int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	// the file is moved out of the way first so a server process that
+	// keeps writing entries does not interfere with the replay. In case
+	// a previous replay has been aborted, its entries are replayed first.
+	replayPath := f.path + ".replay"
+	if _, err := os.Stat(replayPath); errors.Is(err, os.ErrNotExist) {
+		if err := os.Rename(f.path, replayPath); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return 0, 0, nil
+			}
+			return 0, 0, fmt.Errorf("deadletter: error moving file: %w", err)
+		}
+	}
+
+	file, err := os.Open(replayPath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("deadletter: error opening file: %w", err)
+	}
+	defer file.Close()
+
+	var replayed int
+	var remaining []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return 0, 0, fmt.Errorf("deadletter: error decoding entry: %w", err)
+		}
+		if err := fn(e); err != nil {
+			remaining = append(remaining, e)
+			continue
+		}
+		replayed++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, fmt.Errorf("deadletter: error reading file: %w", err)
+	}
+
+	if len(remaining) != 0 {
+		if err := f.write(remaining); err != nil {
+			return 0, 0, err
+		}
+	}
+	if err := os.Remove(replayPath); err != nil {
+		return 0, 0, fmt.Errorf("deadletter: error removing replayed file: %w", err)
+	}
+	return replayed, len(remaining), nil
+}
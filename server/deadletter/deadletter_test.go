@@ -0,0 +1,61 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package deadletter
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFile_Replay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := New(filepath.Join(dir, "events"))
+	if replayed, remaining, err := f.Replay(nil); replayed != 0 || remaining != 0 || err != nil {
+		t.Errorf("Unexpected result replaying missing file: %d, %d, %v", replayed, remaining, err)
+	}
+
+	for _, id := range []string{"event-a", "event-b", "event-c"} {
+		if err := f.Write(Entry{AccountID: "account-a", EventID: id, Payload: "payload"}); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	var seen []string
+	replayed, remaining, err := f.Replay(func(e Entry) error {
+		seen = append(seen, e.EventID)
+		if e.EventID == "event-b" {
+			return errors.New("did not work")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if replayed != 2 || remaining != 1 || len(seen) != 3 {
+		t.Errorf("Unexpected result %d, %d, %v", replayed, remaining, seen)
+	}
+
+	seen = nil
+	replayed, remaining, err = f.Replay(func(e Entry) error {
+		seen = append(seen, e.EventID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if replayed != 1 || remaining != 0 || len(seen) != 1 || seen[0] != "event-b" {
+		t.Errorf("Unexpected result replaying again %d, %d, %v", replayed, remaining, seen)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "events")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected file to be removed, got %v", err)
+	}
+}
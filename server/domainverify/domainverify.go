@@ -0,0 +1,99 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package domainverify checks that whoever registers a domain for an account
+// actually controls the domain, by looking for a token that has been
+// published either as a DNS TXT record or as a file on the domain's website.
+package domainverify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrNotVerified is returned when the token could not be found for a domain.
+var ErrNotVerified = errors.New("domainverify: token not found")
+
+const (
+	// TXTPrefix is the prefix of the TXT record containing the token.
+	TXTPrefix = "offen-verification="
+	// WellKnownPath is the path of the file containing the token.
+	WellKnownPath = "/.well-known/offen-verification.txt"
+)
+
+// maxFileSize is the number of bytes that is read from the verification file.
+const maxFileSize = 1024
+
+const defaultTimeout = time.Second * 10
+
+// Verifier checks whether the given token has been published for the given
+// domain.
+type Verifier interface {
+	Verify(domain, token string) error
+}
+
+type verifier struct {
+	lookupTXT func(ctx context.Context, name string) ([]string, error)
+	client    *http.Client
+	timeout   time.Duration
+}
+
+// New returns a Verifier that looks for the token in the TXT records of the
+// domain first and falls back to requesting the well-known file using HTTPS.
+func New() Verifier {
+	return &verifier{
+		lookupTXT: net.DefaultResolver.LookupTXT,
+		client:    &http.Client{Timeout: defaultTimeout},
+		timeout:   defaultTimeout,
+	}
+}
+
+func (v *verifier) Verify(domain, token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), v.timeout)
+	defer cancel()
+
+	records, dnsErr := v.lookupTXT(ctx, domain)
+	for _, record := range records {
+		if strings.TrimSpace(record) == TXTPrefix+token {
+			return nil
+		}
+	}
+
+	fileErr := v.verifyFile(ctx, domain, token)
+	if fileErr == nil {
+		return nil
+	}
+	if dnsErr != nil {
+		return fmt.Errorf("%w: error looking up TXT records for %s: %v, %v", ErrNotVerified, domain, dnsErr, fileErr)
+	}
+	return fmt.Errorf("%w: no matching TXT record for %s, %v", ErrNotVerified, domain, fileErr)
+}
+
+func (v *verifier) verifyFile(ctx context.Context, domain, token string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+domain+WellKnownPath, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	res, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error requesting verification file: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("verification file responded with status %d", res.StatusCode)
+	}
+	b, err := io.ReadAll(io.LimitReader(res.Body, maxFileSize))
+	if err != nil {
+		return fmt.Errorf("error reading verification file: %v", err)
+	}
+	if strings.TrimSpace(string(b)) != token {
+		return errors.New("verification file does not contain the token")
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package domainverify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifier_Verify(t *testing.T) {
+	tests := []struct {
+		name        string
+		records     []string
+		dnsErr      error
+		file        string
+		status      int
+		expectError bool
+	}{
+		{
+			"txt record",
+			[]string{"v=spf1 -all", "offen-verification=token"},
+			nil,
+			"",
+			http.StatusNotFound,
+			false,
+		},
+		{
+			"file",
+			nil,
+			errors.New("no such host"),
+			"token\n",
+			http.StatusOK,
+			false,
+		},
+		{
+			"wrong token",
+			[]string{"offen-verification=other"},
+			nil,
+			"other",
+			http.StatusOK,
+			true,
+		},
+		{
+			"nothing found",
+			nil,
+			nil,
+			"",
+			http.StatusNotFound,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != WellKnownPath {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.WriteHeader(test.status)
+				fmt.Fprint(w, test.file)
+			}))
+			defer server.Close()
+
+			v := &verifier{
+				lookupTXT: func(context.Context, string) ([]string, error) {
+					return test.records, test.dnsErr
+				},
+				client:  server.Client(),
+				timeout: time.Second,
+			}
+			err := v.Verify(strings.TrimPrefix(server.URL, "https://"), "token")
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if err != nil && !errors.Is(err, ErrNotVerified) {
+				t.Errorf("Expected ErrNotVerified, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package features allows experimental behavior to be enabled per instance
+// without having to build a custom version of Offen.
+package features
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Flag is the name of a feature that can be enabled.
+type Flag string
+
+// this defines all the known feature flags.
+const (
+	// InsertBuffer buffers inserts using a default capacity in case no
+	// explicit capacity has been configured.
+	InsertBuffer Flag = "insert-buffer"
+)
+
+var descriptions = map[Flag]string{
+	InsertBuffer: "Buffer inserts of events and write them in batches.",
+}
+
+// Set contains the features that have been enabled for an instance. A nil
+// Set has no features enabled.
+type Set struct {
+	enabled map[Flag]bool
+}
+
+// New creates a Set with the given features enabled. It errors when an
+// unknown feature is given.
+func New(names ...string) (*Set, error) {
+	s := &Set{enabled: map[Flag]bool{}}
+	for _, name := range names {
+		flag := Flag(strings.ToLower(strings.TrimSpace(name)))
+		if flag == "" {
+			continue
+		}
+		if _, ok := descriptions[flag]; !ok {
+			return nil, fmt.Errorf("features: unknown feature %s", name)
+		}
+		s.enabled[flag] = true
+	}
+	return s, nil
+}
+
+// Enabled checks whether the given feature has been enabled.
+func (s *Set) Enabled(f Flag) bool {
+	if s == nil {
+		return false
+	}
+	return s.enabled[f]
+}
+
+// State describes a known feature and whether it is enabled.
+type State struct {
+	Name        Flag   `json:"name"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+}
+
+// List returns the state of all known features, sorted by name.
+func (s *Set) List() []State {
+	var result []State
+	for flag, description := range descriptions {
+		result = append(result, State{
+			Name:        flag,
+			Description: description,
+			Enabled:     s.Enabled(flag),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
@@ -0,0 +1,48 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package features
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name            string
+		args            []string
+		expectError     bool
+		expectedEnabled bool
+	}{
+		{"none", nil, false, false},
+		{"empty", []string{""}, false, false},
+		{"known", []string{" Insert-Buffer "}, false, true},
+		{"unknown", []string{"insert-buffer", "time-travel"}, true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := New(test.args...)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if s.Enabled(InsertBuffer) != test.expectedEnabled {
+				t.Errorf("Unexpected enabled state %v", s.Enabled(InsertBuffer))
+			}
+		})
+	}
+}
+
+func TestSet_List(t *testing.T) {
+	s, _ := New("insert-buffer")
+	expected := []State{
+		{Name: InsertBuffer, Description: descriptions[InsertBuffer], Enabled: true},
+	}
+	if result := s.List(); !reflect.DeepEqual(expected, result) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+	var empty *Set
+	if result := empty.List(); result[0].Enabled {
+		t.Errorf("Unexpected result %v", result)
+	}
+}
@@ -55,5 +55,5 @@ func EncryptAsymmetricWith(publicKey interface{}, value []byte) (*VersionedCiphe
 	if encryptedErr != nil {
 		return nil, fmt.Errorf("keys: error encrypting given value: %w", encryptedErr)
 	}
-	return newVersionedCipher(encrypted, 1), nil
+	return newVersionedCipher(encrypted, rsaOAEPAlgo), nil
 }
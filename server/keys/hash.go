@@ -5,6 +5,7 @@ package keys
 
 import (
 	"bytes"
+	"crypto/hmac"
 	"crypto/sha256"
 	"errors"
 	"fmt"
@@ -128,21 +129,50 @@ func highMemoryArgon2HashDEPRECATED(val, salt []byte, size uint32) []byte {
 }
 
 const (
-	hashAlgoSHA256 = 1
+	hashAlgoSHA256   = 1
+	hashAlgoArgon2id = 2
 )
 
-// HashFast creates a fast (i.e. not suitable for passwords) hash of the given
-// value and the given salt
+// HashFast creates a hash of the given value and the given salt that is
+// suitable for identifiers, but not for passwords. Depending on the version
+// of the salt this is either a plain SHA256 hash or an Argon2id hash using
+// the parameters stored with the salt.
 func HashFast(value, versionedSalt string) (string, error) {
+	return HashFastWithPepper(value, versionedSalt, nil)
+}
+
+// HashFastWithPepper works like HashFast, but mixes the given pepper into
+// the value before hashing in case the salt has been created by a peppered
+// provider. Salts that are not peppered ignore the pepper.
+func HashFastWithPepper(value, versionedSalt string, pepper []byte) (string, error) {
 	salt, err := unmarshalVersionedCipher(versionedSalt)
 	if err != nil {
 		return "", fmt.Errorf("keys: error unmarshaling given salt: %w", err)
 	}
+	switch salt.keyVersion {
+	case -1:
+	case pepperVersion:
+		if len(pepper) == 0 {
+			return "", errors.New("keys: salt requires a pepper, but none was given")
+		}
+		mac := hmac.New(sha256.New, pepper)
+		mac.Write([]byte(value))
+		value = fmt.Sprintf("%x", mac.Sum(nil))
+	default:
+		return "", fmt.Errorf("keys: received unknown pepper version %d for creating hash", salt.keyVersion)
+	}
 	switch salt.algoVersion {
 	case hashAlgoSHA256:
 		joined := append([]byte(value), salt.cipher...)
 		hashed := sha256.Sum256(joined)
 		return fmt.Sprintf("%x", hashed), nil
+	case hashAlgoArgon2id:
+		params, err := unmarshalArgon2Params(salt.nonce)
+		if err != nil {
+			return "", fmt.Errorf("keys: error reading hashing parameters from salt: %w", err)
+		}
+		hashed := argon2.IDKey([]byte(value), salt.cipher, params.Time, params.Memory, params.Threads, sha256.Size)
+		return fmt.Sprintf("%x", hashed), nil
 	default:
 		return "", fmt.Errorf("keys: received unknown algo version %d for creating hash", salt.algoVersion)
 	}
@@ -0,0 +1,99 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package keys
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+// these constants identify the supported algorithms for account key pairs.
+// Only algorithms that are supported by the script and Auditorium can be
+// used, as these need to encrypt and decrypt data using the account's keys.
+const (
+	KeyAlgorithmRSAOAEP   = "rsa-oaep"
+	DefaultKeyAlgorithm   = KeyAlgorithmRSAOAEP
+	minimumRSAKeyLength   = 2048
+	rsaKeyLengthIncrement = 1024
+)
+
+// A KeypairProvider creates the asymmetric key pairs that accounts use for
+// encrypting user secrets.
+type KeypairProvider interface {
+	// Algorithm returns the identifier of the algorithm of the key pairs
+	// created by the provider.
+	Algorithm() string
+	// GenerateKeypair returns a new public and private key in JWK format.
+	GenerateKeypair() ([]byte, []byte, error)
+}
+
+// NewKeypairProvider returns a KeypairProvider for the given algorithm. The
+// RSA key length is only used when the algorithm is KeyAlgorithmRSAOAEP.
+func NewKeypairProvider(algorithm string, rsaKeyLength int) (KeypairProvider, error) {
+	switch algorithm {
+	case KeyAlgorithmRSAOAEP:
+		if rsaKeyLength < minimumRSAKeyLength || rsaKeyLength%rsaKeyLengthIncrement != 0 {
+			return nil, fmt.Errorf("keys: invalid RSA key length %d, expected a multiple of %d of at least %d", rsaKeyLength, rsaKeyLengthIncrement, minimumRSAKeyLength)
+		}
+		return &rsaKeypairProvider{bits: rsaKeyLength}, nil
+	default:
+		return nil, fmt.Errorf("keys: unknown key algorithm %s", algorithm)
+	}
+}
+
+// IsKnownKeyAlgorithm checks whether the given identifier refers to a
+// supported key algorithm.
+func IsKnownKeyAlgorithm(algorithm string) bool {
+	switch algorithm {
+	case KeyAlgorithmRSAOAEP:
+		return true
+	default:
+		return false
+	}
+}
+
+type rsaKeypairProvider struct {
+	bits int
+}
+
+func (r *rsaKeypairProvider) Algorithm() string {
+	return KeyAlgorithmRSAOAEP
+}
+
+func (r *rsaKeypairProvider) GenerateKeypair() ([]byte, []byte, error) {
+	return GenerateRSAKeypair(r.bits)
+}
+
+// MatchKeypair checks whether the given private key belongs to the given
+// public key. Both keys are expected to be in JWK format.
+func MatchKeypair(publicKey, privateKey []byte) error {
+	public, err := jwk.ParseKey(publicKey)
+	if err != nil {
+		return fmt.Errorf("keys: error parsing public key: %w", err)
+	}
+	private, err := jwk.ParseKey(privateKey)
+	if err != nil {
+		return fmt.Errorf("keys: error parsing private key: %w", err)
+	}
+	derived, err := jwk.PublicKeyOf(private)
+	if err != nil {
+		return fmt.Errorf("keys: error deriving public key from private key: %w", err)
+	}
+	expected, err := public.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return fmt.Errorf("keys: error computing thumbprint of public key: %w", err)
+	}
+	actual, err := derived.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return fmt.Errorf("keys: error computing thumbprint of private key: %w", err)
+	}
+	if !bytes.Equal(expected, actual) {
+		return errors.New("keys: private key does not match public key")
+	}
+	return nil
+}
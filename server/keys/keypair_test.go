@@ -0,0 +1,79 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package keys
+
+import (
+	"testing"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+func TestNewKeypairProvider(t *testing.T) {
+	tests := []struct {
+		name            string
+		algorithm       string
+		rsaKeyLength    int
+		expectError     bool
+		expectedKeyType jwa.KeyType
+	}{
+		{"rsa", KeyAlgorithmRSAOAEP, 2048, false, jwa.RSA},
+		{"rsa bad length", KeyAlgorithmRSAOAEP, 1000, true, ""},
+		{"rsa too short", KeyAlgorithmRSAOAEP, 1024, true, ""},
+		{"ecdh", "ecdh-p256", 0, true, ""},
+		{"nacl box", "nacl-box", 0, true, ""},
+		{"unknown", "dsa", 0, true, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider, err := NewKeypairProvider(test.algorithm, test.rsaKeyLength)
+			if (err != nil) != test.expectError {
+				t.Fatalf("Unexpected error value %v", err)
+			}
+			if test.expectError {
+				return
+			}
+			if provider.Algorithm() != test.algorithm {
+				t.Errorf("Unexpected algorithm %v", provider.Algorithm())
+			}
+			public, private, err := provider.GenerateKeypair()
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			publicKey, err := jwk.ParseKey(public)
+			if err != nil {
+				t.Fatalf("Unexpected error parsing public key %v", err)
+			}
+			if publicKey.KeyType() != test.expectedKeyType {
+				t.Errorf("Unexpected key type %v", publicKey.KeyType())
+			}
+			privateKey, err := jwk.ParseKey(private)
+			if err != nil {
+				t.Fatalf("Unexpected error parsing private key %v", err)
+			}
+			if privateKey.KeyType() != test.expectedKeyType {
+				t.Errorf("Unexpected key type %v", privateKey.KeyType())
+			}
+		})
+	}
+}
+
+func TestMatchKeypair(t *testing.T) {
+	for _, algorithm := range []string{KeyAlgorithmRSAOAEP} {
+		t.Run(algorithm, func(t *testing.T) {
+			provider, _ := NewKeypairProvider(algorithm, 2048)
+			publicA, privateA, _ := provider.GenerateKeypair()
+			publicB, _, _ := provider.GenerateKeypair()
+			if err := MatchKeypair(publicA, privateA); err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+			if err := MatchKeypair(publicB, privateA); err == nil {
+				t.Error("Expected error for mismatching keys")
+			}
+		})
+	}
+	if err := MatchKeypair([]byte("{}"), []byte("{}")); err == nil {
+		t.Error("Expected error for malformed keys")
+	}
+}
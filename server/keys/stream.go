@@ -0,0 +1,178 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package keys
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// streamChunkSize is the maximum size of plaintext sealed in a single chunk
+const streamChunkSize = 64 * 1024
+
+// ErrTruncatedStream is returned when an encrypted stream ends before its
+// final chunk has been read.
+var ErrTruncatedStream = errors.New("keys: encrypted stream is truncated")
+
+// NewEncryptingWriter returns a writer that encrypts everything written to it
+// using the given key before writing it to w. Data is sealed in chunks using
+// AES-GCM, binding each chunk to its position in the stream so chunks cannot
+// be reordered or dropped. Callers must call Close to write the final chunk.
+func NewEncryptingWriter(key []byte, w io.Writer) (io.WriteCloser, error) {
+	aead, err := newStreamAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptingWriter{aead: aead, w: w}, nil
+}
+
+type encryptingWriter struct {
+	aead    cipher.AEAD
+	w       io.Writer
+	buf     []byte
+	counter uint64
+	closed  bool
+}
+
+func (e *encryptingWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("keys: write to closed stream")
+	}
+	written := len(p)
+	for len(p) > 0 {
+		n := streamChunkSize - len(e.buf)
+		if n > len(p) {
+			n = len(p)
+		}
+		e.buf = append(e.buf, p[:n]...)
+		p = p[n:]
+		if len(e.buf) == streamChunkSize {
+			if err := e.flush(false); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close writes the final chunk. It does not close the underlying writer.
+func (e *encryptingWriter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.flush(true)
+}
+
+func (e *encryptingWriter) flush(final bool) error {
+	nonce, err := GenerateRandomBytes(e.aead.NonceSize())
+	if err != nil {
+		return fmt.Errorf("keys: error generating nonce for chunk: %w", err)
+	}
+	sealed := e.aead.Seal(nil, nonce, e.buf, chunkAdditionalData(e.counter, final))
+	header := make([]byte, 5)
+	if final {
+		header[0] = 1
+	}
+	binary.BigEndian.PutUint32(header[1:], uint32(len(sealed)))
+	for _, b := range [][]byte{header, nonce, sealed} {
+		if _, err := e.w.Write(b); err != nil {
+			return fmt.Errorf("keys: error writing chunk: %w", err)
+		}
+	}
+	e.counter++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+// NewDecryptingReader returns a reader that decrypts a stream that has been
+// created using NewEncryptingWriter. In case the stream has been tampered
+// with, reading returns an error. In case it has been truncated, reading
+// returns ErrTruncatedStream.
+func NewDecryptingReader(key []byte, r io.Reader) (io.Reader, error) {
+	aead, err := newStreamAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptingReader{aead: aead, r: bufio.NewReader(r)}, nil
+}
+
+type decryptingReader struct {
+	aead    cipher.AEAD
+	r       io.Reader
+	buf     []byte
+	counter uint64
+	done    bool
+}
+
+func (d *decryptingReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+func (d *decryptingReader) next() error {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(d.r, header); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return ErrTruncatedStream
+		}
+		return fmt.Errorf("keys: error reading chunk header: %w", err)
+	}
+	final := header[0] == 1
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > streamChunkSize+uint32(d.aead.Overhead()) {
+		return errors.New("keys: chunk exceeds maximum size")
+	}
+	chunk := make([]byte, d.aead.NonceSize()+int(size))
+	if _, err := io.ReadFull(d.r, chunk); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return ErrTruncatedStream
+		}
+		return fmt.Errorf("keys: error reading chunk: %w", err)
+	}
+	nonce, sealed := chunk[:d.aead.NonceSize()], chunk[d.aead.NonceSize():]
+	plaintext, err := d.aead.Open(nil, nonce, sealed, chunkAdditionalData(d.counter, final))
+	if err != nil {
+		return fmt.Errorf("keys: error decrypting chunk: %w", err)
+	}
+	d.counter++
+	d.buf = plaintext
+	d.done = final
+	return nil
+}
+
+func newStreamAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("keys: error generating block from key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("keys: error creating GCM from block: %w", err)
+	}
+	return aead, nil
+}
+
+func chunkAdditionalData(counter uint64, final bool) []byte {
+	ad := make([]byte, 9)
+	binary.BigEndian.PutUint64(ad, counter)
+	if final {
+		ad[8] = 1
+	}
+	return ad
+}
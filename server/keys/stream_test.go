@@ -0,0 +1,80 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package keys
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func TestStreamEncryption(t *testing.T) {
+	key, _ := GenerateRandomBytes(DefaultEncryptionKeySize)
+	encrypt := func(value []byte) []byte {
+		var buf bytes.Buffer
+		w, err := NewEncryptingWriter(key, &buf)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if _, err := w.Write(value); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		return buf.Bytes()
+	}
+	decrypt := func(k, ciphertext []byte) ([]byte, error) {
+		r, err := NewDecryptingReader(k, bytes.NewReader(ciphertext))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		return ioutil.ReadAll(r)
+	}
+
+	large := bytes.Repeat([]byte("much encryption, so wow"), streamChunkSize/10)
+	tests := []struct {
+		name  string
+		value []byte
+	}{
+		{"empty", []byte{}},
+		{"small", []byte("much encryption, so wow")},
+		{"multiple chunks", large},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plaintext, err := decrypt(key, encrypt(test.value))
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if !bytes.Equal(plaintext, test.value) {
+				t.Errorf("Unexpected plaintext of length %d", len(plaintext))
+			}
+		})
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		// the final chunk of a stream that fills its chunks completely is
+		// empty, so dropping it leaves a stream of valid chunks only
+		ciphertext := encrypt(bytes.Repeat([]byte("a"), 2*streamChunkSize))
+		truncated := ciphertext[:len(ciphertext)-5-12-16]
+		if _, err := decrypt(key, truncated); !errors.Is(err, ErrTruncatedStream) {
+			t.Errorf("Unexpected error %v", err)
+		}
+	})
+	t.Run("tampered", func(t *testing.T) {
+		ciphertext := encrypt([]byte("much encryption, so wow"))
+		ciphertext[len(ciphertext)-1] ^= 1
+		if _, err := decrypt(key, ciphertext); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+	t.Run("wrong key", func(t *testing.T) {
+		other, _ := GenerateRandomBytes(DefaultEncryptionKeySize)
+		if _, err := decrypt(other, encrypt([]byte("much encryption, so wow"))); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+}
@@ -26,6 +26,13 @@ const (
 	rsaOAEPAlgo = 1
 )
 
+// these values match the defaults of crypto/cipher and the parameters used
+// by the vault when encrypting event payloads
+const (
+	aesGCMNonceSize = 12
+	aesGCMTagSize   = 16
+)
+
 // EncryptWith encrypts the given value symmetrically using the given key.
 // In case of success it also returns the unique nonce value that has been used
 // for encrypting the value and will be needed for clients that want to decrypt
@@ -52,7 +59,22 @@ func EncryptWith(key, value []byte) (*VersionedCipher, error) {
 }
 
 // DecryptWith decrypts the given value using the given key and nonce value.
+// The algorithm is picked using the version the value has been marshaled
+// with, so values encrypted using previous algorithms can still be read.
 func DecryptWith(key []byte, s string) ([]byte, error) {
+	v, err := unmarshalVersionedCipher(s)
+	if err != nil {
+		return nil, fmt.Errorf("keys: error unmarshaling cipher: %w", err)
+	}
+	switch v.algoVersion {
+	case aesGCMAlgo:
+		return decryptAESGCM(key, v)
+	default:
+		return nil, fmt.Errorf("keys: received unknown algo version %d for decrypting", v.algoVersion)
+	}
+}
+
+func decryptAESGCM(key []byte, v *VersionedCipher) ([]byte, error) {
 	block, blockErr := aes.NewCipher(key)
 	if blockErr != nil {
 		return nil, fmt.Errorf("keys: error creating block from key: %w", blockErr)
@@ -61,9 +83,28 @@ func DecryptWith(key []byte, s string) ([]byte, error) {
 	if gcmErr != nil {
 		return nil, fmt.Errorf("keys: error creating GCM from block: %w", gcmErr)
 	}
+	return aesgcm.Open(nil, v.nonce, v.cipher, nil)
+}
+
+// ValidateSymmetricCipher checks whether the given value is a well-formed
+// ciphertext as created by EncryptWith or by the encryption in the vault. It
+// does not require the key and can therefore not tell whether the value can
+// actually be decrypted.
+func ValidateSymmetricCipher(s string) error {
 	v, err := unmarshalVersionedCipher(s)
 	if err != nil {
-		return nil, fmt.Errorf("keys: error unmarshaling cipher: %w", err)
+		return fmt.Errorf("keys: error unmarshaling cipher: %w", err)
+	}
+	switch v.algoVersion {
+	case aesGCMAlgo:
+		if len(v.nonce) != aesGCMNonceSize {
+			return fmt.Errorf("keys: expected nonce of %d bytes, got %d", aesGCMNonceSize, len(v.nonce))
+		}
+		if len(v.cipher) < aesGCMTagSize {
+			return fmt.Errorf("keys: ciphertext of %d bytes is shorter than authentication tag", len(v.cipher))
+		}
+		return nil
+	default:
+		return fmt.Errorf("keys: received unknown algo version %d", v.algoVersion)
 	}
-	return aesgcm.Open(nil, v.nonce, v.cipher, nil)
 }
@@ -47,3 +47,50 @@ func TestSymmetricEncryption(t *testing.T) {
 		})
 	}
 }
+
+func TestDecryptWith_UnknownAlgoVersion(t *testing.T) {
+	key, err := GenerateRandomBytes(DefaultEncryptionKeySize)
+	if err != nil {
+		t.Fatalf("Unexpected error generating key: %v", err)
+	}
+	versionedCipher, err := EncryptWith(key, []byte("much encryption, so wow"))
+	if err != nil {
+		t.Fatalf("Unexpected error encrypting value: %v", err)
+	}
+	versionedCipher.algoVersion = 99
+	if _, err := DecryptWith(key, versionedCipher.Marshal()); err == nil {
+		t.Error("Expected error when decrypting value of unknown algo version")
+	}
+}
+
+func TestValidateSymmetricCipher(t *testing.T) {
+	key, err := GenerateRandomBytes(DefaultEncryptionKeySize)
+	if err != nil {
+		t.Fatalf("Unexpected error generating key: %v", err)
+	}
+	versionedCipher, err := EncryptWith(key, []byte("much encryption, so wow"))
+	if err != nil {
+		t.Fatalf("Unexpected error encrypting value: %v", err)
+	}
+	tests := []struct {
+		name        string
+		value       string
+		expectError bool
+	}{
+		{"ok", versionedCipher.Marshal(), false},
+		{"vault", "{1,} AAAAAAAAAAAAAAAAAAAAAA== AAAAAAAAAAAAAAAA", false},
+		{"garbage", "some-payload", true},
+		{"bad base64", "{1,} not-base64 AAAAAAAAAAAAAAAA", true},
+		{"missing nonce", "{1,} AAAAAAAAAAAAAAAAAAAAAA==", true},
+		{"short nonce", "{1,} AAAAAAAAAAAAAAAAAAAAAA== AAAA", true},
+		{"short ciphertext", "{1,} AAAA AAAAAAAAAAAAAAAA", true},
+		{"unknown algo version", "{99,} AAAAAAAAAAAAAAAAAAAAAA== AAAAAAAAAAAAAAAA", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := ValidateSymmetricCipher(test.value); (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package keys
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// these constants describe the TOTP configuration as defined in RFC 6238.
+// The values are the defaults used by common authenticator apps.
+const (
+	TOTPSecretLength = 20
+	TOTPDigits       = 6
+	TOTPPeriod       = 30 * time.Second
+	// TOTPSkew is the number of periods a code is accepted before or after
+	// the current period in order to account for clock drift.
+	TOTPSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a random secret that can be used for generating
+// and validating TOTP codes, encoded as a Base32 string.
+func GenerateTOTPSecret() (string, error) {
+	return randomBytesWithEncoding(TOTPSecretLength, totpEncoding)
+}
+
+// TOTPURI returns the key URI for the given secret that can be used for
+// enrolling the secret in an authenticator app, e.g. by rendering it as a
+// QR code.
+func TOTPURI(secret, issuer, accountName string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprintf("%d", TOTPDigits))
+	params.Set("period", fmt.Sprintf("%d", int(TOTPPeriod.Seconds())))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + accountName,
+		RawQuery: params.Encode(),
+	}
+	return u.String()
+}
+
+// ValidateTOTP checks whether the given code is valid for the secret at the
+// given point in time.
+func ValidateTOTP(secret, code string, t time.Time) (bool, error) {
+	_, ok, err := ValidateTOTPStep(secret, code, t)
+	return ok, err
+}
+
+// ValidateTOTPStep checks whether the given code is valid for the secret at
+// the given point in time. In case it is, it also returns the time step the
+// code belongs to, so callers can reject codes that have already been used.
+func ValidateTOTPStep(secret, code string, t time.Time) (int64, bool, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return 0, false, fmt.Errorf("keys: error decoding totp secret: %w", err)
+	}
+	code = strings.TrimSpace(code)
+	if len(code) != TOTPDigits {
+		return 0, false, nil
+	}
+	counter := t.Unix() / int64(TOTPPeriod.Seconds())
+	for i := -TOTPSkew; i <= TOTPSkew; i++ {
+		step := counter + int64(i)
+		expected := totpCode(key, uint64(step))
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+func totpCode(key []byte, counter uint64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, value%mod)
+}
+
+// RecoveryCodeLength is the number of random bytes used for a recovery code.
+const RecoveryCodeLength = 10
+
+// GenerateRecoveryCode returns a random code that can be used in place of
+// a TOTP code in case the secret is not available anymore.
+func GenerateRecoveryCode() (string, error) {
+	return randomBytesWithEncoding(RecoveryCodeLength, totpEncoding)
+}
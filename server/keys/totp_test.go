@@ -0,0 +1,69 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package keys
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateTOTP(t *testing.T) {
+	// the secret and codes are the SHA1 test vectors from RFC 6238,
+	// truncated to 6 digits
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	tests := []struct {
+		name           string
+		secret         string
+		code           string
+		time           time.Time
+		expectedResult bool
+		expectError    bool
+	}{
+		{"bad secret", "!!", "287082", time.Unix(59, 0), false, true},
+		{"ok", secret, "287082", time.Unix(59, 0), true, false},
+		{"ok lowercase secret", strings.ToLower(secret), "287082", time.Unix(59, 0), true, false},
+		{"ok later vector", secret, "081804", time.Unix(1111111109, 0), true, false},
+		{"ok previous period", secret, "081804", time.Unix(1111111109+30, 0), true, false},
+		{"expired", secret, "081804", time.Unix(1111111109+90, 0), false, false},
+		{"bad code", secret, "123456", time.Unix(59, 0), false, false},
+		{"bad length", secret, "28708", time.Unix(59, 0), false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := ValidateTOTP(test.secret, test.code, test.time)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if result != test.expectedResult {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(key) != TOTPSecretLength {
+		t.Errorf("Unexpected key length %d", len(key))
+	}
+	if ok, _ := ValidateTOTP(secret, totpCode(key, uint64(time.Now().Unix()/30)), time.Now()); !ok {
+		t.Error("Expected generated code to validate")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	result := TOTPURI("SECRET", "Offen", "hioffen@posteo.de")
+	expected := "otpauth://totp/Offen:hioffen@posteo.de?algorithm=SHA1&digits=6&issuer=Offen&period=30&secret=SECRET"
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package keys
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// these constants identify the supported algorithms for hashing user ids.
+const (
+	UserIDHashSHA256   = "sha256"
+	UserIDHashArgon2id = "argon2id"
+	DefaultUserIDHash  = UserIDHashSHA256
+)
+
+// these constants define the default cost of hashing user ids using Argon2id.
+const (
+	DefaultArgon2Time    = 2
+	DefaultArgon2Memory  = 19 * 1024
+	DefaultArgon2Threads = 1
+)
+
+// Argon2Params defines the cost of hashing user ids using Argon2id. Memory is
+// given in KiB.
+type Argon2Params struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+const argon2ParamsLength = 9
+
+func (a Argon2Params) marshal() []byte {
+	b := make([]byte, argon2ParamsLength)
+	binary.BigEndian.PutUint32(b[0:4], a.Time)
+	binary.BigEndian.PutUint32(b[4:8], a.Memory)
+	b[8] = a.Threads
+	return b
+}
+
+func (a Argon2Params) validate() error {
+	if a.Time < 1 {
+		return errors.New("keys: argon2id time cost needs to be at least 1")
+	}
+	if a.Threads < 1 {
+		return errors.New("keys: argon2id needs to use at least 1 thread")
+	}
+	if a.Memory < 8*uint32(a.Threads) {
+		return fmt.Errorf("keys: argon2id memory cost needs to be at least %d KiB when using %d threads", 8*uint32(a.Threads), a.Threads)
+	}
+	return nil
+}
+
+func unmarshalArgon2Params(b []byte) (Argon2Params, error) {
+	if len(b) != argon2ParamsLength {
+		return Argon2Params{}, fmt.Errorf("keys: expected %d bytes of argon2id parameters, got %d", argon2ParamsLength, len(b))
+	}
+	params := Argon2Params{
+		Time:    binary.BigEndian.Uint32(b[0:4]),
+		Memory:  binary.BigEndian.Uint32(b[4:8]),
+		Threads: b[8],
+	}
+	if err := params.validate(); err != nil {
+		return Argon2Params{}, err
+	}
+	return params, nil
+}
+
+// A UserSaltProvider creates the salts accounts use for hashing user ids.
+type UserSaltProvider interface {
+	// Algorithm returns the identifier of the hashing algorithm of the salts
+	// created by the provider.
+	Algorithm() string
+	// NewUserSalt returns a new salt to be used with HashFast.
+	NewUserSalt() (*VersionedCipher, error)
+}
+
+// NewUserSaltProvider returns a UserSaltProvider for the given algorithm. The
+// given parameters are only used when the algorithm is UserIDHashArgon2id.
+func NewUserSaltProvider(algorithm string, params Argon2Params) (UserSaltProvider, error) {
+	switch algorithm {
+	case UserIDHashSHA256:
+		return &sha256SaltProvider{}, nil
+	case UserIDHashArgon2id:
+		if err := params.validate(); err != nil {
+			return nil, err
+		}
+		return &argon2idSaltProvider{params: params}, nil
+	default:
+		return nil, fmt.Errorf("keys: unknown user id hashing algorithm %s", algorithm)
+	}
+}
+
+type sha256SaltProvider struct{}
+
+func (s *sha256SaltProvider) Algorithm() string {
+	return UserIDHashSHA256
+}
+
+func (s *sha256SaltProvider) NewUserSalt() (*VersionedCipher, error) {
+	return NewFastSalt(DefaultSecretLength)
+}
+
+type argon2idSaltProvider struct {
+	params Argon2Params
+}
+
+func (a *argon2idSaltProvider) Algorithm() string {
+	return UserIDHashArgon2id
+}
+
+// NewUserSalt stores the hashing parameters in place of a nonce, so that
+// changing the configured parameters does not invalidate existing hashes.
+func (a *argon2idSaltProvider) NewUserSalt() (*VersionedCipher, error) {
+	b, err := GenerateRandomBytes(DefaultSecretLength)
+	if err != nil {
+		return nil, fmt.Errorf("keys: error generating user salt: %w", err)
+	}
+	return newVersionedCipher(b, hashAlgoArgon2id).addNonce(a.params.marshal()), nil
+}
+
+// pepperVersion is the key version of salts that require the hashed value
+// to be mixed with a pepper before hashing.
+const pepperVersion = 1
+
+// NewPepperedUserSaltProvider wraps the given provider so that the salts it
+// creates can only be used together with a pepper, which is expected to be
+// kept outside of the database.
+func NewPepperedUserSaltProvider(u UserSaltProvider) UserSaltProvider {
+	return &pepperedSaltProvider{u}
+}
+
+type pepperedSaltProvider struct {
+	UserSaltProvider
+}
+
+func (p *pepperedSaltProvider) NewUserSalt() (*VersionedCipher, error) {
+	salt, err := p.UserSaltProvider.NewUserSalt()
+	if err != nil {
+		return nil, err
+	}
+	return salt.addKeyVersion(pepperVersion), nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package keys
+
+import "testing"
+
+func TestNewUserSaltProvider(t *testing.T) {
+	tests := []struct {
+		name        string
+		algorithm   string
+		params      Argon2Params
+		expectError bool
+	}{
+		{"sha256", UserIDHashSHA256, Argon2Params{}, false},
+		{"argon2id", UserIDHashArgon2id, Argon2Params{Time: 1, Memory: 64, Threads: 1}, false},
+		{"argon2id no threads", UserIDHashArgon2id, Argon2Params{Time: 1, Memory: 64}, true},
+		{"argon2id too little memory", UserIDHashArgon2id, Argon2Params{Time: 1, Memory: 16, Threads: 4}, true},
+		{"unknown", "md5", Argon2Params{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider, err := NewUserSaltProvider(test.algorithm, test.params)
+			if (err != nil) != test.expectError {
+				t.Fatalf("Unexpected error value %v", err)
+			}
+			if test.expectError {
+				return
+			}
+			if provider.Algorithm() != test.algorithm {
+				t.Errorf("Unexpected algorithm %v", provider.Algorithm())
+			}
+			salt, err := provider.NewUserSalt()
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			hash, err := HashFast("user-id", salt.Marshal())
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if len(hash) != 64 {
+				t.Errorf("Unexpected hash %v", hash)
+			}
+			repeated, _ := HashFast("user-id", salt.Marshal())
+			if repeated != hash {
+				t.Errorf("Expected hashing to be deterministic, got %v and %v", hash, repeated)
+			}
+			other, _ := HashFast("other-user-id", salt.Marshal())
+			if other == hash {
+				t.Errorf("Expected different user ids to result in different hashes")
+			}
+		})
+	}
+}
+
+func TestNewPepperedUserSaltProvider(t *testing.T) {
+	for _, algorithm := range []string{UserIDHashSHA256, UserIDHashArgon2id} {
+		t.Run(algorithm, func(t *testing.T) {
+			provider, err := NewUserSaltProvider(algorithm, Argon2Params{Time: 1, Memory: 64, Threads: 1})
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			salt, err := NewPepperedUserSaltProvider(provider).NewUserSalt()
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if _, err := HashFast("user-id", salt.Marshal()); err == nil {
+				t.Error("Expected error when hashing without pepper")
+			}
+			hash, err := HashFastWithPepper("user-id", salt.Marshal(), []byte("pepper"))
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			other, _ := HashFastWithPepper("user-id", salt.Marshal(), []byte("other-pepper"))
+			if hash == other {
+				t.Error("Expected different peppers to result in different hashes")
+			}
+		})
+	}
+	t.Run("unpeppered salt", func(t *testing.T) {
+		salt, _ := NewFastSalt(DefaultSecretLength)
+		hash, _ := HashFast("user-id", salt.Marshal())
+		peppered, err := HashFastWithPepper("user-id", salt.Marshal(), []byte("pepper"))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if hash != peppered {
+			t.Error("Expected pepper to be ignored for unpeppered salt")
+		}
+	})
+}
@@ -59,6 +59,13 @@ func (v *VersionedCipher) Marshal() string {
 	return base
 }
 
+// IsVersionedCipher checks whether the given string is the representation
+// of a versioned cipher, without decrypting it.
+func IsVersionedCipher(s string) bool {
+	_, err := unmarshalVersionedCipher(s)
+	return err == nil
+}
+
 func unmarshalVersionedCipher(s string) (*VersionedCipher, error) {
 	parseResult := parseCipherRE.FindStringSubmatch(s)
 	if parseResult == nil || len(parseResult) != 4 {
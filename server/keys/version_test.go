@@ -129,3 +129,23 @@ func TestParseVersionedCipher(t *testing.T) {
 		})
 	}
 }
+
+func TestIsVersionedCipher(t *testing.T) {
+	tests := []struct {
+		name           string
+		value          string
+		expectedResult bool
+	}{
+		{"ok", "{1,} YWJj eHl6", true},
+		{"key version", "{2,1} YWJj", true},
+		{"plaintext", "abc", false},
+		{"bad encoding", "{1,} abc$", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := IsVersionedCipher(test.value); result != test.expectedResult {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
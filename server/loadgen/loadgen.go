@@ -0,0 +1,182 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package loadgen generates synthetic traffic against an Offen instance
+// and measures the latency of its responses.
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operations that are performed against the target instance
+const (
+	OperationPostEvents = "postEvents"
+	OperationGetEvents  = "getEvents"
+)
+
+// Config defines the traffic that is generated.
+type Config struct {
+	// Target is the base URL of the instance, e.g. https://offen.example.com
+	Target string
+	// AccountID is the account events are sent to.
+	AccountID string
+	// Rate is the number of requests per second.
+	Rate float64
+	// Users is the number of simulated users sharing the requests.
+	Users int
+	// Duration is the time traffic is generated for.
+	Duration time.Duration
+	// ReadRatio is the share of requests that query events instead of
+	// sending them.
+	ReadRatio float64
+	// Timeout is the timeout applied to each request.
+	Timeout time.Duration
+}
+
+// Result describes the latency of all requests of a single operation.
+type Result struct {
+	Operation string
+	Requests  int
+	Errors    int
+	P50       time.Duration
+	P90       time.Duration
+	P99       time.Duration
+	Max       time.Duration
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf(
+		"%s: requests=%d errors=%d p50=%v p90=%v p99=%v max=%v",
+		r.Operation, r.Requests, r.Errors, r.P50, r.P90, r.P99, r.Max,
+	)
+}
+
+type recorder struct {
+	lock      sync.Mutex
+	latencies map[string][]time.Duration
+	errors    map[string]int
+}
+
+func (r *recorder) record(operation string, d time.Duration, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.latencies[operation] = append(r.latencies[operation], d)
+	if err != nil {
+		r.errors[operation]++
+	}
+}
+
+func (r *recorder) results() []Result {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var results []Result
+	for operation, latencies := range r.latencies {
+		sorted := append([]time.Duration{}, latencies...)
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i] < sorted[j]
+		})
+		results = append(results, Result{
+			Operation: operation,
+			Requests:  len(sorted),
+			Errors:    r.errors[operation],
+			P50:       percentile(sorted, 0.5),
+			P90:       percentile(sorted, 0.9),
+			P99:       percentile(sorted, 0.99),
+			Max:       sorted[len(sorted)-1],
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Operation < results[j].Operation
+	})
+	return results
+}
+
+// percentile returns the p-th percentile of the given sorted durations
+// using the nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+// Run generates traffic as defined in cfg until the configured duration has
+// elapsed or ctx is cancelled. Failed requests are counted in the results
+// instead of stopping the run. In case onError is not nil, it is called
+// with each error.
+func Run(ctx context.Context, cfg Config, onError func(error)) ([]Result, error) {
+	if cfg.Rate <= 0 {
+		return nil, errors.New("loadgen: rate must be positive")
+	}
+	if cfg.Users <= 0 {
+		return nil, errors.New("loadgen: at least one user is required")
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = time.Second * 10
+	}
+	cfg.Target = strings.TrimRight(cfg.Target, "/")
+
+	publicKey, err := fetchPublicKey(&http.Client{Timeout: cfg.Timeout}, cfg.Target, cfg.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	var users []*user
+	for i := 0; i < cfg.Users; i++ {
+		u, err := newUser(cfg.Target, cfg.AccountID, cfg.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		if err := u.optin(publicKey); err != nil {
+			return nil, fmt.Errorf("loadgen: error setting up user %d: %w", i, err)
+		}
+		users = append(users, u)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+
+	rec := &recorder{latencies: map[string][]time.Duration{}, errors: map[string]int{}}
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / cfg.Rate))
+	defer ticker.Stop()
+	var wg sync.WaitGroup
+	for running := true; running; {
+		select {
+		case <-ctx.Done():
+			running = false
+		case <-ticker.C:
+			u := users[rand.Intn(len(users))]
+			operation, fn := OperationPostEvents, u.postEvent
+			if rand.Float64() < cfg.ReadRatio {
+				operation, fn = OperationGetEvents, u.getEvents
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				start := time.Now()
+				err := fn()
+				rec.record(operation, time.Since(start), err)
+				if err != nil && onError != nil {
+					onError(err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	return rec.results(), nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/keys"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	tests := []struct {
+		p        float64
+		expected time.Duration
+	}{
+		{0.5, 5},
+		{0.9, 9},
+		{0.99, 10},
+		{0, 1},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%v", test.p), func(t *testing.T) {
+			if result := percentile(sorted, test.p); result != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+	if result := percentile(nil, 0.5); result != 0 {
+		t.Errorf("Unexpected result %v", result)
+	}
+}
+
+func TestRun(t *testing.T) {
+	publicKey, _, err := keys.GenerateRSAKeypair(2048)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	requireCookie := func(w http.ResponseWriter, r *http.Request) bool {
+		if _, err := r.Cookie("user"); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return false
+		}
+		return true
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/exchange", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprintf(w, `{"accountId":"account-a","publicKey":%s}`, publicKey)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "user", Value: "user-a", Path: "/"})
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/api/events", func(w http.ResponseWriter, r *http.Request) {
+		if !requireCookie(w, r) {
+			return
+		}
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	results, err := Run(context.Background(), Config{
+		Target:    server.URL + "/",
+		AccountID: "account-a",
+		Rate:      200,
+		Users:     3,
+		Duration:  time.Millisecond * 250,
+		ReadRatio: 0.5,
+	}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Unexpected results %v", results)
+	}
+	for _, result := range results {
+		if result.Requests == 0 || result.Errors != 0 {
+			t.Errorf("Unexpected result %v", result)
+		}
+		if result.P50 > result.P99 || result.P99 > result.Max {
+			t.Errorf("Unexpected percentiles %v", result)
+		}
+	}
+}
+
+func TestRun_BadConfig(t *testing.T) {
+	if _, err := Run(context.Background(), Config{Rate: 0, Users: 1}, nil); err == nil {
+		t.Error("Expected error for zero rate")
+	}
+	if _, err := Run(context.Background(), Config{Rate: 1, Users: 0}, nil); err == nil {
+		t.Error("Expected error for zero users")
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package loadgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/offen/offen/server/keys"
+)
+
+// user simulates a single visitor of a site. Just like a browser, it keeps
+// the cookies set by the target instance, so all of its events are
+// associated with the same user id.
+type user struct {
+	client    *http.Client
+	target    string
+	accountID string
+	key       []byte
+}
+
+func newUser(target, accountID string, timeout time.Duration) (*user, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, fmt.Errorf("loadgen: error creating cookie jar: %w", err)
+	}
+	key, err := keys.GenerateRandomBytes(keys.DefaultSecretLength)
+	if err != nil {
+		return nil, fmt.Errorf("loadgen: error creating user key: %w", err)
+	}
+	return &user{
+		client:    &http.Client{Jar: jar, Timeout: timeout},
+		target:    target,
+		accountID: accountID,
+		key:       key,
+	}, nil
+}
+
+type publicKeyResponse struct {
+	PublicKey json.RawMessage `json:"publicKey"`
+}
+
+// optin performs the key exchange a user goes through when first visiting a
+// site, which results in the target instance setting the user cookie.
+func (u *user) optin(publicKey jwk.Key) error {
+	j, err := jwk.New(u.key)
+	if err != nil {
+		return fmt.Errorf("loadgen: error wrapping user key: %w", err)
+	}
+	j.Set(jwk.AlgorithmKey, "A128GCM")
+	j.Set("ext", true)
+	j.Set(jwk.KeyOpsKey, jwk.KeyOperationList{jwk.KeyOpEncrypt, jwk.KeyOpDecrypt})
+	b, err := json.Marshal(j)
+	if err != nil {
+		return fmt.Errorf("loadgen: error marshaling user key: %w", err)
+	}
+	encryptedSecret, err := keys.EncryptAsymmetricWith(publicKey, b)
+	if err != nil {
+		return fmt.Errorf("loadgen: error encrypting user key: %w", err)
+	}
+	return u.do(http.MethodPost, "/api/exchange", map[string]string{
+		"accountId":       u.accountID,
+		"encryptedSecret": encryptedSecret.Marshal(),
+	}, http.StatusNoContent)
+}
+
+type fakeEvent struct {
+	Type      string    `json:"type"`
+	Href      string    `json:"href"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (u *user) postEvent() error {
+	b, err := json.Marshal(fakeEvent{
+		Type:      "PAGEVIEW",
+		Href:      u.target + "/",
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("loadgen: error marshaling event: %w", err)
+	}
+	payload, err := keys.EncryptWith(u.key, b)
+	if err != nil {
+		return fmt.Errorf("loadgen: error encrypting event: %w", err)
+	}
+	return u.do(http.MethodPost, "/api/events", map[string]string{
+		"accountId": u.accountID,
+		"payload":   payload.Marshal(),
+	}, http.StatusCreated)
+}
+
+func (u *user) getEvents() error {
+	return u.do(http.MethodGet, "/api/events", nil, http.StatusOK)
+}
+
+func (u *user) do(method, path string, body interface{}, expectedStatus int) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("loadgen: error marshaling request body: %w", err)
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, u.target+path, reader)
+	if err != nil {
+		return fmt.Errorf("loadgen: error creating request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := u.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("loadgen: error performing request: %w", err)
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode != expectedStatus {
+		return fmt.Errorf("loadgen: %s %s responded with unexpected status %d", method, path, res.StatusCode)
+	}
+	return nil
+}
+
+// fetchPublicKey looks up the public key of the given account in the same
+// way the script embedded on a site does.
+func fetchPublicKey(client *http.Client, target, accountID string) (jwk.Key, error) {
+	res, err := client.Get(fmt.Sprintf("%s/api/exchange?accountId=%s", target, url.QueryEscape(accountID)))
+	if err != nil {
+		return nil, fmt.Errorf("loadgen: error requesting public key: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("loadgen: requesting public key responded with unexpected status %d", res.StatusCode)
+	}
+	var response publicKeyResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("loadgen: error decoding public key response: %w", err)
+	}
+	key, err := jwk.ParseKey(response.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("loadgen: error parsing public key: %w", err)
+	}
+	if key.KeyType() != "RSA" {
+		return nil, fmt.Errorf("loadgen: only accounts using RSA keys are supported, got %s", key.KeyType())
+	}
+	return key, nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package locales
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/leonelquinteros/gotext"
+	"github.com/offen/offen/server/public"
+)
+
+// Catalog maps the message ids used by the clients to their translation in
+// a single locale.
+type Catalog map[string]string
+
+// ErrUnknownLocale is returned when loading the catalog of a locale that
+// is not available.
+var ErrUnknownLocale = errors.New("locales: unknown locale")
+
+// A Loader looks up the message catalogs of all available locales, so new
+// languages can be added without rebuilding the clients.
+type Loader interface {
+	Locales() ([]string, error)
+	Load(locale string) (Catalog, error)
+}
+
+// NewFSLoader returns a Loader that reads catalogs from the .po files
+// in the given directory of fsys. Messages of the default locale are used as
+// message ids, so the default locale is always available with an empty
+// catalog.
+func NewFSLoader(fsys fs.FS, dir string) Loader {
+	return &fsLoader{fsys: fsys, dir: dir}
+}
+
+// NewDirLoader returns a Loader that reads catalogs from the .po files in
+// the given directory on disk.
+func NewDirLoader(dir string) Loader {
+	return NewFSLoader(os.DirFS(dir), ".")
+}
+
+// DefaultLoader returns a Loader for the catalogs that are bundled with
+// the application.
+func DefaultLoader() Loader {
+	return NewFSLoader(public.FS, "static/locales")
+}
+
+type fsLoader struct {
+	fsys fs.FS
+	dir  string
+}
+
+func (f *fsLoader) Locales() ([]string, error) {
+	entries, err := fs.ReadDir(f.fsys, f.dir)
+	if err != nil {
+		return nil, fmt.Errorf("locales: error reading directory %s: %w", f.dir, err)
+	}
+	result := []string{defaultLocale}
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".po" {
+			continue
+		}
+		if locale := strings.TrimSuffix(entry.Name(), ".po"); locale != defaultLocale {
+			result = append(result, locale)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func (f *fsLoader) Load(locale string) (Catalog, error) {
+	if locale == defaultLocale {
+		return Catalog{}, nil
+	}
+	if !fs.ValidPath(locale) || strings.Contains(locale, "/") {
+		return nil, ErrUnknownLocale
+	}
+	b, err := fs.ReadFile(f.fsys, path.Join(f.dir, locale+".po"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrUnknownLocale
+		}
+		return nil, fmt.Errorf("locales: error reading file for locale %s: %w", locale, err)
+	}
+	return parseCatalog(b)
+}
+
+// parseCatalog reads all singular translations from the given .po file.
+// gotext does not expose the parsed translations, so they are read from its
+// binary encoding.
+func parseCatalog(b []byte) (Catalog, error) {
+	po := gotext.Po{}
+	po.Parse(b)
+	encoded, err := po.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("locales: error encoding translations: %w", err)
+	}
+	var translations gotext.TranslatorEncoding
+	if err := gob.NewDecoder(bytes.NewReader(encoded)).Decode(&translations); err != nil {
+		return nil, fmt.Errorf("locales: error decoding translations: %w", err)
+	}
+	result := Catalog{}
+	for id, translation := range translations.Translations {
+		if id == "" {
+			continue
+		}
+		if value := translation.Trs[0]; value != "" {
+			result[id] = value
+		}
+	}
+	return result, nil
+}
+
+// NewMultiLoader returns a Loader that combines the locales of all given
+// loaders. In case multiple loaders provide the same locale, the catalog of
+// the loader that has been given first is used.
+func NewMultiLoader(loaders ...Loader) Loader {
+	return multiLoader(loaders)
+}
+
+type multiLoader []Loader
+
+func (m multiLoader) Locales() ([]string, error) {
+	seen := map[string]bool{}
+	var result []string
+	for _, loader := range m {
+		locales, err := loader.Locales()
+		if err != nil {
+			return nil, err
+		}
+		for _, locale := range locales {
+			if !seen[locale] {
+				seen[locale] = true
+				result = append(result, locale)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func (m multiLoader) Load(locale string) (Catalog, error) {
+	for _, loader := range m {
+		catalog, err := loader.Load(locale)
+		if errors.Is(err, ErrUnknownLocale) {
+			continue
+		}
+		return catalog, err
+	}
+	return nil, ErrUnknownLocale
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package locales
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFSLoader(t *testing.T) {
+	loader := NewDirLoader("./testdata")
+
+	locales, err := loader.Locales()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(locales, []string{"de", "en", "fr"}) {
+		t.Errorf("Unexpected locales %v", locales)
+	}
+
+	tests := []struct {
+		name            string
+		locale          string
+		expectedCatalog Catalog
+		expectedError   error
+	}{
+		{"default", "en", Catalog{}, nil},
+		{"ok", "fr", Catalog{"Yes": "Oui", "No": "Non"}, nil},
+		{"unknown", "es", nil, ErrUnknownLocale},
+		{"traversal", "../catalog", nil, ErrUnknownLocale},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			catalog, err := loader.Load(test.locale)
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("Expected error %v, got %v", test.expectedError, err)
+			}
+			if !reflect.DeepEqual(catalog, test.expectedCatalog) {
+				t.Errorf("Expected %v, got %v", test.expectedCatalog, catalog)
+			}
+		})
+	}
+}
+
+func TestMultiLoader(t *testing.T) {
+	bundled := NewFSLoader(fstest.MapFS{
+		"locales/de.po": &fstest.MapFile{Data: []byte("msgid \"Yes\"\nmsgstr \"Ja\"\n")},
+		"locales/it.po": &fstest.MapFile{Data: []byte("msgid \"Yes\"\nmsgstr \"Sì\"\n")},
+	}, "locales")
+	loader := NewMultiLoader(NewDirLoader("./testdata"), bundled)
+
+	locales, err := loader.Locales()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(locales, []string{"de", "en", "fr", "it"}) {
+		t.Errorf("Unexpected locales %v", locales)
+	}
+
+	tests := []struct {
+		name            string
+		locale          string
+		expectedCatalog Catalog
+		expectedError   error
+	}{
+		{"first loader wins", "de", Catalog{"Yes": "Jawohl"}, nil},
+		{"fallback", "it", Catalog{"Yes": "Sì"}, nil},
+		{"unknown", "es", nil, ErrUnknownLocale},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			catalog, err := loader.Load(test.locale)
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("Expected error %v, got %v", test.expectedError, err)
+			}
+			if !reflect.DeepEqual(catalog, test.expectedCatalog) {
+				t.Errorf("Expected %v, got %v", test.expectedCatalog, catalog)
+			}
+		})
+	}
+}
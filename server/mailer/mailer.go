@@ -3,7 +3,37 @@
 
 package mailer
 
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrUnavailable is returned by mailers that have no way of delivering
+// messages.
+var ErrUnavailable = errors.New("mailer: no way of delivering email is configured")
+
 // Mailer is used to send transactional emails
 type Mailer interface {
 	Send(from, to, subject, body string) error
 }
+
+// Templates contains the templates messages are rendered from. Both
+// html/template and text/template can be used.
+type Templates interface {
+	ExecuteTemplate(w io.Writer, name string, data interface{}) error
+}
+
+// Render executes the templates named subject_<name> and body_<name>
+// using the given data.
+func Render(t Templates, name string, data interface{}) (string, string, error) {
+	subject, body := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+	if err := t.ExecuteTemplate(subject, "subject_"+name, data); err != nil {
+		return "", "", fmt.Errorf("mailer: error rendering subject of %s: %w", name, err)
+	}
+	if err := t.ExecuteTemplate(body, "body_"+name, data); err != nil {
+		return "", "", fmt.Errorf("mailer: error rendering body of %s: %w", name, err)
+	}
+	return subject.String(), body.String(), nil
+}
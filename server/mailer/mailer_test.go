@@ -0,0 +1,32 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package mailer
+
+import (
+	"testing"
+	"text/template"
+)
+
+func TestRender(t *testing.T) {
+	tpl := template.Must(template.New("").Parse(
+		`{{ define "subject_invite" }}Join {{ .name }}{{ end }}{{ define "body_invite" }}Visit {{ .url }}{{ end }}`,
+	))
+	t.Run("ok", func(t *testing.T) {
+		subject, body, err := Render(tpl, "invite", map[string]string{"name": "Offen", "url": "https://offen.dev"})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if subject != "Join Offen" {
+			t.Errorf("Unexpected subject %v", subject)
+		}
+		if body != "Visit https://offen.dev" {
+			t.Errorf("Unexpected body %v", body)
+		}
+	})
+	t.Run("unknown template", func(t *testing.T) {
+		if _, _, err := Render(tpl, "reset", nil); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+}
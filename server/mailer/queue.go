@@ -0,0 +1,132 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package mailer
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrQueueFull is returned when a message is sent while the queue has
+// reached its capacity.
+var ErrQueueFull = errors.New("mailer: queue is full")
+
+// ErrQueueClosed is returned when a message is sent after the queue has
+// been closed.
+var ErrQueueClosed = errors.New("mailer: queue is closed")
+
+// Message is a single email waiting to be sent.
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+}
+
+// Queue is a Mailer that sends messages in the background using another
+// Mailer, so callers do not have to wait for slow mail servers. Messages
+// that fail to be sent are retried using an exponential backoff.
+type Queue struct {
+	mailer      Mailer
+	maxAttempts int
+	backoff     time.Duration
+	onError     func(Message, error)
+	messages    chan Message
+	done        chan struct{}
+	closing     chan struct{}
+	lock        sync.RWMutex
+	closed      bool
+}
+
+// NewQueue creates a Queue holding at most capacity messages that are sent
+// using the given Mailer. Each message is tried at most maxAttempts times
+// before it is passed to onError together with the last error.
+func NewQueue(m Mailer, capacity, maxAttempts int, onError func(Message, error)) *Queue {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	q := &Queue{
+		mailer:      m,
+		maxAttempts: maxAttempts,
+		backoff:     time.Second * 5,
+		onError:     onError,
+		messages:    make(chan Message, capacity),
+		done:        make(chan struct{}),
+		closing:     make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// Send adds the message to the queue. It does not block and only returns
+// an error in case the message could not be queued.
+func (q *Queue) Send(from, to, subject, body string) error {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	select {
+	case q.messages <- Message{From: from, To: to, Subject: subject, Body: body}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (q *Queue) run() {
+	defer close(q.done)
+	for msg := range q.messages {
+		q.deliver(msg)
+	}
+}
+
+func (q *Queue) deliver(msg Message) {
+	backoff := q.backoff
+	for attempt := 1; ; attempt++ {
+		err := q.mailer.Send(msg.From, msg.To, msg.Subject, msg.Body)
+		if err == nil {
+			return
+		}
+		// retrying cannot succeed in case the mailer is not able to deliver
+		// any message at all
+		if attempt >= q.maxAttempts || errors.Is(err, ErrUnavailable) {
+			q.fail(msg, err)
+			return
+		}
+		select {
+		case <-q.closing:
+			// messages that are still queued on shutdown are tried once
+			// more without waiting, so closing does not block for long
+			if err := q.mailer.Send(msg.From, msg.To, msg.Subject, msg.Body); err != nil {
+				q.fail(msg, err)
+			}
+			return
+		case <-time.After(backoff):
+			backoff *= 2
+		}
+	}
+}
+
+func (q *Queue) fail(msg Message, err error) {
+	if q.onError != nil {
+		q.onError(msg, err)
+	}
+}
+
+// Close stops accepting new messages and waits for all queued messages to
+// be sent.
+func (q *Queue) Close() {
+	q.lock.Lock()
+	if q.closed {
+		q.lock.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.closing)
+	close(q.messages)
+	q.lock.Unlock()
+	<-q.done
+}
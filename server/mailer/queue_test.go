@@ -0,0 +1,106 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package mailer
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mockMailer struct {
+	lock     sync.Mutex
+	failures int
+	sent     []Message
+	attempts int
+}
+
+func (m *mockMailer) Send(from, to, subject, body string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.attempts++
+	if m.failures > 0 {
+		m.failures--
+		return errors.New("did not work")
+	}
+	m.sent = append(m.sent, Message{From: from, To: to, Subject: subject, Body: body})
+	return nil
+}
+
+func (m *mockMailer) count() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.attempts
+}
+
+type unavailableMailer struct{}
+
+func (*unavailableMailer) Send(from, to, subject, body string) error {
+	return ErrUnavailable
+}
+
+func TestQueue(t *testing.T) {
+	tests := []struct {
+		name             string
+		failures         int
+		maxAttempts      int
+		expectedAttempts int
+		expectFailure    bool
+	}{
+		{"ok", 0, 3, 1, false},
+		{"retried", 2, 3, 3, false},
+		{"attempts exceeded", 5, 2, 2, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := &mockMailer{failures: test.failures}
+			var failed []Message
+			q := NewQueue(m, 10, test.maxAttempts, func(msg Message, err error) {
+				failed = append(failed, msg)
+			})
+			q.backoff = time.Millisecond
+			if err := q.Send("from@offen.dev", "to@offen.dev", "subject", "body"); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			// closing the queue right away would skip waiting for retries
+			deadline := time.Now().Add(time.Second * 5)
+			for m.count() < test.expectedAttempts && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			q.Close()
+
+			if m.attempts != test.expectedAttempts {
+				t.Errorf("Expected %d attempts, got %d", test.expectedAttempts, m.attempts)
+			}
+			if test.expectFailure != (len(failed) == 1) {
+				t.Errorf("Unexpected failures %v", failed)
+			}
+			if !test.expectFailure && (len(m.sent) != 1 || m.sent[0].To != "to@offen.dev") {
+				t.Errorf("Unexpected messages %v", m.sent)
+			}
+		})
+	}
+	t.Run("unavailable", func(t *testing.T) {
+		var failed []error
+		q := NewQueue(&unavailableMailer{}, 10, 3, func(msg Message, err error) {
+			failed = append(failed, err)
+		})
+		q.backoff = time.Hour
+		if err := q.Send("from@offen.dev", "to@offen.dev", "subject", "body"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		q.Close()
+		if len(failed) != 1 || !errors.Is(failed[0], ErrUnavailable) {
+			t.Errorf("Expected message to be dropped without retrying, got %v", failed)
+		}
+	})
+	t.Run("closed", func(t *testing.T) {
+		q := NewQueue(&mockMailer{}, 10, 1, nil)
+		q.Close()
+		if err := q.Send("from@offen.dev", "to@offen.dev", "subject", "body"); err != ErrQueueClosed {
+			t.Errorf("Expected ErrQueueClosed, got %v", err)
+		}
+	})
+}
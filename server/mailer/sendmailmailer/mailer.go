@@ -68,6 +68,12 @@ func submitMail(m *gomail.Message) error {
 	return nil
 }
 
+// Available checks whether a sendmail binary can be found on the host.
+func Available() bool {
+	_, err := lookupSendmail()
+	return err == nil
+}
+
 func lookupSendmail() (string, error) {
 	if runtime.GOOS == "windows" {
 		return "", errors.New("sendmailmailer: using sendmail on windows is currently not supported")
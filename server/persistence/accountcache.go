@@ -0,0 +1,133 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// AccountCache is used to cache active accounts so the hot path of
+// inserting events does not need to look up the account for each event.
+// Implementations are expected to expire entries after a while so changes
+// that have not been invalidated explicitly are picked up eventually.
+type AccountCache interface {
+	Get(accountID string) (Account, bool)
+	Set(account Account)
+	// Invalidate removes the accounts of the given ids. In case no ids are
+	// given, all accounts are removed.
+	Invalidate(accountIDs ...string)
+}
+
+// WithAccountCache configures the persistence layer to use the given cache
+// when looking up active accounts for inserting events or associating user
+// secrets.
+func WithAccountCache(cache AccountCache) Config {
+	return func(p *persistenceLayer) {
+		p.accounts = cache
+	}
+}
+
+// lruAccountCache keeps up to size accounts in memory. Entries are evicted in
+// least recently used order and expire after ttl.
+type lruAccountCache struct {
+	size    int
+	ttl     time.Duration
+	lock    sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type accountCacheEntry struct {
+	account Account
+	expires time.Time
+}
+
+// NewAccountCache returns an AccountCache that keeps up to size accounts in
+// memory for the given duration.
+func NewAccountCache(size int, ttl time.Duration) AccountCache {
+	return newLRUAccountCache(size, ttl)
+}
+
+func newLRUAccountCache(size int, ttl time.Duration) *lruAccountCache {
+	return &lruAccountCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+func (a *lruAccountCache) Get(accountID string) (Account, bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	elem, ok := a.entries[accountID]
+	if !ok {
+		return Account{}, false
+	}
+	entry := elem.Value.(*accountCacheEntry)
+	if time.Now().After(entry.expires) {
+		a.order.Remove(elem)
+		delete(a.entries, accountID)
+		return Account{}, false
+	}
+	a.order.MoveToFront(elem)
+	return entry.account, true
+}
+
+func (a *lruAccountCache) Set(account Account) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	entry := &accountCacheEntry{
+		account: account,
+		expires: time.Now().Add(a.ttl),
+	}
+	if elem, ok := a.entries[account.AccountID]; ok {
+		elem.Value = entry
+		a.order.MoveToFront(elem)
+		return
+	}
+	a.entries[account.AccountID] = a.order.PushFront(entry)
+	for a.order.Len() > a.size {
+		oldest := a.order.Back()
+		a.order.Remove(oldest)
+		delete(a.entries, oldest.Value.(*accountCacheEntry).account.AccountID)
+	}
+}
+
+func (a *lruAccountCache) Invalidate(accountIDs ...string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if len(accountIDs) == 0 {
+		a.order.Init()
+		a.entries = map[string]*list.Element{}
+		return
+	}
+	for _, accountID := range accountIDs {
+		if elem, ok := a.entries[accountID]; ok {
+			a.order.Remove(elem)
+			delete(a.entries, accountID)
+		}
+	}
+}
+
+// findActiveAccount looks up the non-retired account of the given id, using
+// the account cache if configured.
+func (p *persistenceLayer) findActiveAccount(accountID string) (Account, error) {
+	if p.accounts != nil {
+		if account, ok := p.accounts.Get(accountID); ok {
+			return account, nil
+		}
+	}
+	account, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return Account{}, fmt.Errorf("persistence: error looking up account %s: %w", accountID, err)
+	}
+	if p.accounts != nil {
+		p.accounts.Set(account)
+	}
+	return account, nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/bus"
+)
+
+func TestAccountCache(t *testing.T) {
+	cache := newLRUAccountCache(2, time.Minute)
+	cache.Set(Account{AccountID: "account-a", Name: "a"})
+	cache.Set(Account{AccountID: "account-b", Name: "b"})
+
+	if account, ok := cache.Get("account-a"); !ok || account.Name != "a" {
+		t.Errorf("Unexpected result %v, %v", account, ok)
+	}
+
+	// account-b is the least recently used entry now
+	cache.Set(Account{AccountID: "account-c", Name: "c"})
+	if _, ok := cache.Get("account-b"); ok {
+		t.Error("Expected account-b to be evicted")
+	}
+	if _, ok := cache.Get("account-a"); !ok {
+		t.Error("Expected account-a to be cached")
+	}
+
+	cache.Set(Account{AccountID: "account-c", Name: "other"})
+	if account, _ := cache.Get("account-c"); account.Name != "other" {
+		t.Errorf("Expected entry to be replaced, got %v", account)
+	}
+
+	cache.Invalidate("account-a")
+	if _, ok := cache.Get("account-a"); ok {
+		t.Error("Expected account-a to be invalidated")
+	}
+
+	cache.Invalidate()
+	if _, ok := cache.Get("account-c"); ok {
+		t.Error("Expected cache to be purged")
+	}
+
+	cache.Set(Account{AccountID: "account-d"})
+	cache.entries["account-d"].Value.(*accountCacheEntry).expires = time.Now().Add(-time.Second)
+	if _, ok := cache.Get("account-d"); ok {
+		t.Error("Expected expired entry to be skipped")
+	}
+	if cache.order.Len() != 0 {
+		t.Errorf("Expected expired entry to be removed, found %d entries", cache.order.Len())
+	}
+}
+
+type mockFindActiveAccountDatabase struct {
+	DataAccessLayer
+	calls int
+	err   error
+}
+
+func (m *mockFindActiveAccountDatabase) FindAccount(q interface{}) (Account, error) {
+	m.calls++
+	if m.err != nil {
+		return Account{}, m.err
+	}
+	return Account{AccountID: string(q.(FindAccountQueryActiveByID))}, nil
+}
+
+func TestPersistenceLayer_findActiveAccount(t *testing.T) {
+	t.Run("without cache", func(t *testing.T) {
+		db := &mockFindActiveAccountDatabase{}
+		p := &persistenceLayer{dal: db}
+		p.findActiveAccount("account-a")
+		p.findActiveAccount("account-a")
+		if db.calls != 2 {
+			t.Errorf("Expected 2 lookups, got %d", db.calls)
+		}
+	})
+	t.Run("with cache", func(t *testing.T) {
+		db := &mockFindActiveAccountDatabase{}
+		p := &persistenceLayer{dal: db, bus: bus.New()}
+		WithAccountCache(NewAccountCache(10, time.Minute))(p)
+		p.invalidateAccountCache()
+		for i := 0; i < 3; i++ {
+			account, err := p.findActiveAccount("account-a")
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if account.AccountID != "account-a" {
+				t.Errorf("Unexpected account %v", account)
+			}
+		}
+		if db.calls != 1 {
+			t.Errorf("Expected 1 lookup, got %d", db.calls)
+		}
+		p.publishAccountChange(AccountChange{AccountID: "account-b"})
+		p.findActiveAccount("account-a")
+		if db.calls != 1 {
+			t.Errorf("Expected changes to other accounts to keep cache, got %d lookups", db.calls)
+		}
+		p.publishAccountChange(AccountChange{AccountID: "account-a"})
+		p.findActiveAccount("account-a")
+		if db.calls != 2 {
+			t.Errorf("Expected lookup after invalidation, got %d lookups", db.calls)
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		db := &mockFindActiveAccountDatabase{err: ErrUnknownAccount("did not work")}
+		p := &persistenceLayer{dal: db}
+		WithAccountCache(NewAccountCache(10, time.Minute))(p)
+		_, err := p.findActiveAccount("account-a")
+		var unknownAccountErr ErrUnknownAccount
+		if !errors.As(err, &unknownAccountErr) {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if _, ok := p.accounts.Get("account-a"); ok {
+			t.Error("Expected failed lookup not to be cached")
+		}
+	})
+}
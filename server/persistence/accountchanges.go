@@ -0,0 +1,75 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"encoding/json"
+
+	"github.com/offen/offen/server/bus"
+)
+
+// TopicAccountChanged is the topic an AccountChange is published on after an
+// account has been changed.
+const TopicAccountChanged = "account-changed"
+
+// AccountChange describes a change that has been made to an account. In case
+// AccountID is empty, all accounts might have changed.
+type AccountChange struct {
+	AccountID string `json:"accountId,omitempty"`
+	Reason    string `json:"reason"`
+}
+
+// Reasons for an account to change
+const (
+	AccountChangeRetired     = "retired"
+	AccountChangeRetention   = "retention"
+	AccountChangeEventQuota  = "event-quota"
+	AccountChangeDomains     = "domains"
+	AccountChangeBanner      = "banner"
+	AccountChangeSettings    = "settings"
+	AccountChangeKeysRotated = "keys-rotated"
+	AccountChangeSaltRotated = "salt-rotated"
+	AccountChangeRestored    = "restored"
+	AccountChangeSynced      = "synced"
+)
+
+// WithBus configures the persistence layer to publish changes to accounts
+// using the given bus, so caches of other instances can subscribe to them.
+// It defaults to a bus that only delivers messages inside the current
+// process.
+func WithBus(b bus.Bus) Config {
+	return func(p *persistenceLayer) {
+		p.bus = b
+	}
+}
+
+// publishAccountChange needs to be called after each change to an account.
+// The change has already been persisted at this point, so failing to notify
+// other instances is not considered an error. Their caches will pick up the
+// change once cached accounts expire.
+func (p *persistenceLayer) publishAccountChange(change AccountChange) {
+	if p.bus == nil {
+		return
+	}
+	payload, err := json.Marshal(change)
+	if err != nil {
+		return
+	}
+	p.bus.Publish(TopicAccountChanged, payload)
+}
+
+// invalidateAccountCache subscribes the account cache to changes to accounts.
+func (p *persistenceLayer) invalidateAccountCache() {
+	p.bus.Subscribe(TopicAccountChanged, func(payload []byte) {
+		var change AccountChange
+		if err := json.Unmarshal(payload, &change); err != nil {
+			return
+		}
+		if change.AccountID == "" {
+			p.accounts.Invalidate()
+			return
+		}
+		p.accounts.Invalidate(change.AccountID)
+	})
+}
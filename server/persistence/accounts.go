@@ -6,44 +6,37 @@ package persistence
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/offen/offen/server/keys"
+	"github.com/offen/offen/server/webhook"
 )
 
 func (p *persistenceLayer) GetAccount(accountID string, includeEvents bool, eventsSince string) (AccountResult, error) {
+	reads := p.reads()
 	var account Account
 	var err error
 	if includeEvents {
-		account, err = p.dal.FindAccount(FindAccountQueryIncludeEvents{
+		account, err = reads.FindAccount(FindAccountQueryIncludeEvents{
 			AccountID: accountID,
 			Since:     eventsSince,
 		})
 	} else {
-		account, err = p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+		account, err = reads.FindAccount(FindAccountQueryActiveByID(accountID))
 	}
 	if err != nil {
 		return AccountResult{}, fmt.Errorf("persistence: error looking up account data: %w", err)
 	}
 
-	result := AccountResult{
-		AccountID: account.AccountID,
-		Name:      account.Name,
-		Created:   account.Created,
-	}
-
-	key, err := account.WrapPublicKey()
+	result, err := accountResult(account, includeEvents)
 	if err != nil {
-		return AccountResult{}, fmt.Errorf("persistence: error wrapping account public key: %v", err)
+		return AccountResult{}, err
 	}
-	result.PublicKey = key
-
 	if !includeEvents {
 		return result, nil
 	}
 
-	result.EncryptedPrivateKey = account.EncryptedPrivateKey
-
 	eventResults := EventsByAccountID{}
 	secrets := EncryptedSecretsByID{}
 	seqs := []string{}
@@ -68,20 +61,12 @@ func (p *persistenceLayer) GetAccount(accountID string, includeEvents bool, even
 	}
 
 	if eventsSince != "" {
-		pruned, err := p.dal.FindTombstones(FindTombstonesQueryByAccounts{
-			AccountIDs: []string{accountID},
-			Since:      eventsSince,
-		})
+		deleted, deletedSeqs, err := p.deletedAccountEvents(reads, accountID, eventsSince)
 		if err != nil {
-			return AccountResult{}, fmt.Errorf("persistence: error finding deleted events: %w", err)
+			return AccountResult{}, err
 		}
-
-		var prunedIDs []string
-		for _, tombstone := range pruned {
-			prunedIDs = append(prunedIDs, tombstone.EventID)
-			seqs = append(seqs, tombstone.Sequence)
-		}
-		result.DeletedEvents = prunedIDs
+		result.DeletedEvents = deleted
+		seqs = append(seqs, deletedSeqs...)
 	}
 
 	result.Sequence = getLatestSeq(seqs)
@@ -89,13 +74,92 @@ func (p *persistenceLayer) GetAccount(accountID string, includeEvents bool, even
 	return result, nil
 }
 
+// deletedAccountEvents returns the ids and sequences of all events of the
+// given account that have been deleted after the given sequence.
+func (p *persistenceLayer) deletedAccountEvents(reads DataAccessLayer, accountID, since string) ([]string, []string, error) {
+	pruned, err := reads.FindTombstones(FindTombstonesQueryByAccounts{
+		AccountIDs: []string{accountID},
+		Since:      since,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("persistence: error finding deleted events: %w", err)
+	}
+	var prunedIDs, seqs []string
+	for _, tombstone := range pruned {
+		prunedIDs = append(prunedIDs, tombstone.EventID)
+		seqs = append(seqs, tombstone.Sequence)
+	}
+	return prunedIDs, seqs, nil
+}
+
+// accountResult returns the data of the given account. Encrypted private
+// keys are only included when requested.
+func accountResult(account Account, includeKeys bool) (AccountResult, error) {
+	result := AccountResult{
+		AccountID:         account.AccountID,
+		Name:              account.Name,
+		KeyAlgorithm:      keyAlgorithmOrDefault(account.KeyAlgorithm),
+		Created:           account.Created,
+		EncryptedSettings: account.EncryptedSettings,
+		LastEventAt:       account.LastEventAt,
+		EventQuota:        account.EventQuota,
+	}
+	if account.Retention > 0 {
+		result.Retention = account.Retention.String()
+	}
+	domains, err := account.domains()
+	if err != nil {
+		return AccountResult{}, err
+	}
+	for _, domain := range domains {
+		result.Domains = append(result.Domains, AccountDomainResult{
+			Domain:   domain.Domain,
+			Token:    domain.Token,
+			Verified: domain.Verified,
+		})
+	}
+
+	if result.Banner, err = account.banner(); err != nil {
+		return AccountResult{}, err
+	}
+
+	key, err := account.WrapPublicKey()
+	if err != nil {
+		return AccountResult{}, fmt.Errorf("persistence: error wrapping account public key: %w", err)
+	}
+	result.PublicKey = key
+
+	for _, deprecated := range account.DeprecatedKeys {
+		key, err := deprecated.WrapPublicKey()
+		if err != nil {
+			return AccountResult{}, fmt.Errorf("persistence: error wrapping deprecated public key: %w", err)
+		}
+		keyResult := DeprecatedKeyResult{
+			PublicKey:    key,
+			KeyAlgorithm: keyAlgorithmOrDefault(deprecated.KeyAlgorithm),
+			Deprecated:   deprecated.Deprecated,
+		}
+		if includeKeys {
+			keyResult.EncryptedPrivateKey = deprecated.EncryptedPrivateKey
+		}
+		result.DeprecatedKeys = append(result.DeprecatedKeys, keyResult)
+	}
+	if includeKeys {
+		result.EncryptedPrivateKey = account.EncryptedPrivateKey
+	}
+	return result, nil
+}
+
 func (p *persistenceLayer) AssociateUserSecret(accountID, userID, encryptedUserSecret string) error {
-	account, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	account, err := p.findActiveAccount(accountID)
 	if err != nil {
 		return fmt.Errorf(`persistence: error looking up account with id "%s": %w`, accountID, err)
 	}
+	if err := p.migrateUserSalts(userID, []Account{account}); err != nil {
+		return err
+	}
 
-	hashedUserID, hashErr := account.HashUserID(userID)
+	hashedUserID, hashErr := p.hashUserID(account, userID)
 	if hashErr != nil {
 		return fmt.Errorf("persistence: erro hashing user id: %w", err)
 	}
@@ -104,7 +168,7 @@ func (p *persistenceLayer) AssociateUserSecret(accountID, userID, encryptedUserS
 	if err != nil {
 		var notFound ErrUnknownSecret
 		if !errors.As(err, &notFound) {
-			return fmt.Errorf("persistence: error looking up user: %v", err)
+			return fmt.Errorf("persistence: error looking up user: %w", err)
 		}
 	} else {
 		// In this branch the following case is covered: a user whose hashed
@@ -118,62 +182,107 @@ func (p *persistenceLayer) AssociateUserSecret(accountID, userID, encryptedUserS
 		// "deleted" by clients.
 		parkedID, parkedIDErr := uuid.NewV4()
 		if parkedIDErr != nil {
-			return fmt.Errorf("persistence: error creating identifier for parking events: %v", parkedIDErr)
+			return fmt.Errorf("persistence: error creating identifier for parking events: %w", parkedIDErr)
 		}
-		parkedHash, parkErr := account.HashUserID(parkedID.String())
+		parkedHash, parkErr := account.HashUserID(parkedID.String(), p.userIDPepper)
 		if parkErr != nil {
-			return fmt.Errorf("persistence: error hashing parked id: %v", parkErr)
+			return fmt.Errorf("persistence: error hashing parked id: %w", parkErr)
 		}
 
-		txn, err := p.dal.Transaction()
-		if err != nil {
-			return fmt.Errorf("persistence: error creating transaction: %w", err)
-		}
-		if err := txn.CreateSecret(&Secret{
+		if err := p.dal.CreateSecret(&Secret{
 			SecretID:        parkedHash,
 			EncryptedSecret: secret.EncryptedSecret,
+			Created:         time.Now(),
 		}); err != nil {
-			txn.Rollback()
 			return fmt.Errorf("persistence: error creating user for use as migration target: %w", err)
 		}
 
-		if err := txn.DeleteSecret(DeleteSecretQueryBySecretID(secret.SecretID)); err != nil {
-			txn.Rollback()
-			return fmt.Errorf("persistence: error deleting existing user: %v", err)
+		// Events are moved in batches so users with a large number of events
+		// do not require a single long running transaction. In case migrating
+		// fails halfway, the remaining events are still associated with the
+		// existing user and will be migrated once the user sends their
+		// secret again.
+		var migrated int
+		for {
+			n, err := p.parkEventBatch(hashedUserID, parkedHash)
+			if err != nil {
+				return fmt.Errorf("persistence: error migrating existing events after %d events: %w", migrated, err)
+			}
+			if n == 0 {
+				break
+			}
+			migrated += n
+			if p.onMigrate != nil {
+				p.onMigrate(accountID, migrated)
+			}
 		}
 
-		// The previous user is now deleted so all orphaned events need to be
-		// copied over to the one used for parking the events.
-		var idsToDelete []string
-		orphanedEvents, err := txn.FindEvents(FindEventsQueryForSecretIDs{
-			SecretIDs: []string{hashedUserID},
-		})
+		if err := p.dal.DeleteSecret(DeleteSecretQueryBySecretID(secret.SecretID)); err != nil {
+			return fmt.Errorf("persistence: error deleting existing user: %w", err)
+		}
+	}
+
+	if err := p.dal.CreateSecret(&Secret{
+		SecretID:        hashedUserID,
+		EncryptedSecret: encryptedUserSecret,
+		Created:         time.Now(),
+	}); err != nil {
+		return fmt.Errorf("persistence: error creating user: %w", err)
+	}
+	return nil
+}
+
+// parkEventsBatchSize is the maximum number of events that are moved to a
+// parked identifier in a single transaction.
+const parkEventsBatchSize = 500
+
+// parkEventBatch moves the next batch of events of the given secret over
+// to the parked secret. Events are assigned new ids, so they are considered
+// "deleted" by clients, and a tombstone is created for each of them. It
+// returns the number of events that have been moved.
+func (p *persistenceLayer) parkEventBatch(secretID, parkedID string) (int, error) {
+	orphanedEvents, err := p.dal.FindEvents(FindEventsQueryMetadataBySecretID{
+		SecretID: secretID,
+		Limit:    parkEventsBatchSize,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("persistence: error looking up orphaned events: %w", err)
+	}
+	if len(orphanedEvents) == 0 {
+		return 0, nil
+	}
+
+	// each batch uses its own sequence so clients that sync in between
+	// batches do not miss any of the following tombstones
+	sequence, err := NewULID()
+	if err != nil {
+		return 0, fmt.Errorf("persistence: error creating sequence for parked events: %w", err)
+	}
+	newIDs := map[string]string{}
+	for _, orphan := range orphanedEvents {
+		newID, err := siblingEventID(orphan.EventID)
 		if err != nil {
-			return fmt.Errorf("persistence: error looking up orphaned events: %w", err)
+			return 0, fmt.Errorf("persistence: error creating new event id: %w", err)
 		}
+		newIDs[orphan.EventID] = newID
+	}
 
-		sequence, seqErr := NewULID()
-		if seqErr != nil {
-			return fmt.Errorf("persistence: error creating sequence for parked events: %w", err)
+	var affected int64
+	if err := WithTransaction(p.dal, func(tx DataAccessLayer) error {
+		affected, err = tx.UpdateEvents(UpdateEventsQueryReassignSecret{
+			SecretID:    secretID,
+			NewSecretID: parkedID,
+			Sequence:    sequence,
+			EventIDs:    newIDs,
+		})
+		if err != nil {
+			return fmt.Errorf("persistence: error moving events: %w", err)
+		}
+		if affected == 0 {
+			return errors.New("persistence: no events could be moved")
 		}
 		for _, orphan := range orphanedEvents {
-			newID, err := siblingEventID(orphan.EventID)
-			if err != nil {
-				txn.Rollback()
-				return fmt.Errorf("persistence: error creating new event id: %w", err)
-			}
-
-			if err := txn.CreateEvent(&Event{
-				EventID:   newID,
-				Sequence:  sequence,
-				AccountID: orphan.AccountID,
-				SecretID:  &parkedHash,
-				Payload:   orphan.Payload,
-			}); err != nil {
-				return fmt.Errorf("persistence: error migrating an existing event: %w", err)
-			}
-
-			if err := txn.CreateTombstone(&Tombstone{
+			if err := tx.CreateTombstone(&Tombstone{
 				EventID:   orphan.EventID,
 				AccountID: orphan.AccountID,
 				SecretID:  orphan.SecretID,
@@ -181,83 +290,65 @@ func (p *persistenceLayer) AssociateUserSecret(accountID, userID, encryptedUserS
 			}); err != nil {
 				return fmt.Errorf("persistence: error creating tombstone for migrated event: %w", err)
 			}
-
-			idsToDelete = append(idsToDelete, orphan.EventID)
-		}
-		if _, err := txn.DeleteEvents(DeleteEventsQueryByEventIDs(idsToDelete)); err != nil {
-			txn.Rollback()
-			return fmt.Errorf("persistence: error deleting orphaned events: %w", err)
 		}
-		if err := txn.Commit(); err != nil {
-			return fmt.Errorf("persistence: error committing transaction: %w", err)
-		}
-	}
-
-	if err := p.dal.CreateSecret(&Secret{
-		SecretID:        hashedUserID,
-		EncryptedSecret: encryptedUserSecret,
+		return nil
 	}); err != nil {
-		return fmt.Errorf("persistence: error creating user: %w", err)
+		return 0, err
 	}
-	return nil
+	return int(affected), nil
 }
 
-func (p *persistenceLayer) CreateAccount(name, emailAddress, password string) error {
+func (p *persistenceLayer) CreateAccount(name, emailAddress, password string) (string, error) {
 	accountUsers, err := p.dal.FindAccountUsers(FindAccountUsersQueryAllAccountUsers{true, false})
 	if err != nil {
-		return fmt.Errorf("persistence: error looking up account users: %w", err)
+		return "", fmt.Errorf("persistence: error looking up account users: %w", err)
 	}
 	match, err := selectAccountUser(accountUsers, emailAddress)
 	if err != nil {
-		return fmt.Errorf("persistence: error looking up account user %s: %w", emailAddress, err)
+		return "", fmt.Errorf("persistence: error looking up account user %s: %w", emailAddress, err)
 	}
 
 	if err := keys.CompareString(password, match.HashedPassword); err != nil {
-		return fmt.Errorf("persistence: passwords did not match: %w", err)
+		return "", fmt.Errorf("persistence: passwords did not match: %w", err)
 	}
 
 	allAccounts, allAccountsErr := p.dal.FindAccounts(FindAccountsQueryAllAccounts{})
 	if allAccountsErr != nil {
-		return fmt.Errorf("persistence: error looking up all existing accounts: %w", err)
+		return "", fmt.Errorf("persistence: error looking up all existing accounts: %w", err)
 	}
 	for _, account := range allAccounts {
 		if account.Name == name {
-			return fmt.Errorf("persistence: account named %s already exists", name)
+			return "", fmt.Errorf("persistence: account named %s already exists", name)
 		}
 	}
 
-	account, key, err := newAccount(name, "")
+	account, key, err := newAccount(name, "", p.keypairs, p.userSalts)
 	if err != nil {
-		return fmt.Errorf("persistence: error creating account: %w", err)
+		return "", fmt.Errorf("persistence: error creating account: %w", err)
 	}
-	relationship, err := newAccountUserRelationship(match.AccountUserID, account.AccountID)
+	relationship, err := newAccountUserRelationship(match.AccountUserID, account.AccountID, AccountUserRoleAdmin)
 	if err != nil {
-		return fmt.Errorf("persistence: error creating relationship: %w", err)
+		return "", fmt.Errorf("persistence: error creating relationship: %w", err)
 	}
 	if err := relationship.addEmailEncryptedKey(key, match.Salt, emailAddress); err != nil {
-		return fmt.Errorf("persistence: error adding email encrypted key: %w", err)
+		return "", fmt.Errorf("persistence: error adding email encrypted key: %w", err)
 	}
 	if err := relationship.addPasswordEncryptedKey(key, match.Salt, password); err != nil {
-		return fmt.Errorf("persistence: error adding password encrypted key: %w", err)
+		return "", fmt.Errorf("persistence: error adding password encrypted key: %w", err)
 	}
 
-	txn, err := p.dal.Transaction()
-	if err != nil {
-		return fmt.Errorf("persistence: error creating transaction: %w", err)
-	}
-	if err := txn.CreateAccount(account); err != nil {
-		txn.Rollback()
-		return fmt.Errorf("persistence: error persisting account: %w", err)
-	}
-	if err := txn.CreateAccountUserRelationship(relationship); err != nil {
-		txn.Rollback()
-		return fmt.Errorf("persistence: error persisting relationship: %w", err)
-	}
-	if err := txn.Commit(); err != nil {
-		return fmt.Errorf("persistence: error committing transaction: %w", err)
+	if err := WithTransaction(p.dal, func(tx DataAccessLayer) error {
+		if err := tx.CreateAccount(account); err != nil {
+			return fmt.Errorf("persistence: error persisting account: %w", err)
+		}
+		if err := tx.CreateAccountUserRelationship(relationship); err != nil {
+			return fmt.Errorf("persistence: error persisting relationship: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return "", err
 	}
-
-	return nil
+	return account.AccountID, nil
 }
 
 func (p *persistenceLayer) RetireAccount(accountID string) error {
@@ -268,22 +359,89 @@ func (p *persistenceLayer) RetireAccount(accountID string) error {
 	if account.Retired {
 		return ErrUnknownAccount(fmt.Sprintf("persistence: account %s already retired", accountID))
 	}
-	txn, txnErr := p.dal.Transaction()
-	if txnErr != nil {
-		return fmt.Errorf("persistence: error creating transaction: %w", txnErr)
-	}
 	account.Retired = true
-	if err := txn.UpdateAccount(&account); err != nil {
-		txn.Rollback()
-		return fmt.Errorf("persistence: error retiring account %s: %w", accountID, err)
+	now := time.Now().UTC()
+	account.RetiredAt = &now
+	if err := WithTransaction(p.dal, func(tx DataAccessLayer) error {
+		if err := tx.UpdateAccount(&account); err != nil {
+			return fmt.Errorf("persistence: error retiring account %s: %w", accountID, err)
+		}
+		if err := tx.DeleteAccountUserRelationships(DeleteAccountUserRelationshipsQueryByAccountID(accountID)); err != nil {
+			return fmt.Errorf("persistence: error deleting account user relationships for retired account %s: %w", accountID, err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	p.publishAccountChange(AccountChange{AccountID: accountID, Reason: AccountChangeRetired})
+	p.notify(webhook.EventAccountRetired, map[string]interface{}{
+		"accountId": accountID,
+		"name":      account.Name,
+		"retiredAt": now,
+	})
+	return nil
+}
+
+// SetAccountRetention updates the retention period of the account with the
+// given id. A zero value will make the account use the instance's default.
+func (p *persistenceLayer) SetAccountRetention(accountID string, retention time.Duration) error {
+	account, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account %s: %w", accountID, err)
+	}
+	account.Retention = retention
+	if err := p.dal.UpdateAccount(&account); err != nil {
+		return fmt.Errorf("persistence: error updating retention of account %s: %w", accountID, err)
 	}
-	if err := txn.DeleteAccountUserRelationships(DeleteAccountUserRelationshipsQueryByAccountID(accountID)); err != nil {
-		txn.Rollback()
-		return fmt.Errorf("persistence: error deleting account user relationships for retired account %s: %w", accountID, err)
+	p.publishAccountChange(AccountChange{AccountID: accountID, Reason: AccountChangeRetention})
+	return nil
+}
+
+// SetAccountEventQuota updates the number of events the account with the
+// given id can receive per day. A zero value will make the account use the
+// instance's default.
+func (p *persistenceLayer) SetAccountEventQuota(accountID string, eventsPerDay int) error {
+	account, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account %s: %w", accountID, err)
 	}
-	if err := txn.Commit(); err != nil {
-		txn.Rollback()
-		return fmt.Errorf("persistence: error committing account retiring: %w", err)
+	account.EventQuota = eventsPerDay
+	if err := p.dal.UpdateAccount(&account); err != nil {
+		return fmt.Errorf("persistence: error updating event quota of account %s: %w", accountID, err)
 	}
+	p.publishAccountChange(AccountChange{AccountID: accountID, Reason: AccountChangeEventQuota})
 	return nil
 }
+
+// decryptKeyEncryptionKey returns the key encryption key of the account with
+// the given id, using the password of the account user with the given email
+// address for decrypting it.
+func (p *persistenceLayer) decryptKeyEncryptionKey(accountID, emailAddress, password string) ([]byte, error) {
+	accountUser, err := p.findAccountUser(emailAddress, true, false)
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up account user: %w", err)
+	}
+	if err := keys.CompareString(password, accountUser.HashedPassword); err != nil {
+		return nil, fmt.Errorf("persistence: error comparing passwords: %w", err)
+	}
+
+	var encryptedKey string
+	for _, relationship := range accountUser.Relationships {
+		if relationship.AccountID == accountID {
+			encryptedKey = relationship.PasswordEncryptedKeyEncryptionKey
+			break
+		}
+	}
+	if encryptedKey == "" {
+		return nil, fmt.Errorf("persistence: account user is not allowed to access account %s", accountID)
+	}
+	pwDerivedKey, err := keys.DeriveKey(password, accountUser.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error deriving key from password: %w", err)
+	}
+	key, err := keys.DecryptWith(pwDerivedKey, encryptedKey)
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error decrypting key encryption key: %w", err)
+	}
+	return key, nil
+}
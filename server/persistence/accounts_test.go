@@ -8,8 +8,11 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/offen/offen/server/keys"
+	"github.com/offen/offen/server/webhook"
 )
 
 var publicKey = `
@@ -95,6 +98,7 @@ func TestPersistenceLayer_GetAccount(t *testing.T) {
 				AccountID:           "account-id",
 				Name:                "name",
 				EncryptedPrivateKey: "encrypted-private-key",
+				KeyAlgorithm:        keys.KeyAlgorithmRSAOAEP,
 				Events: &EventsByAccountID{
 					"account-id": []EventResult{
 						{EventID: "event-a", SecretID: strptr("hashed-user-a"), Payload: "payload-a"},
@@ -146,8 +150,9 @@ func TestPersistenceLayer_GetAccount(t *testing.T) {
 			false,
 			"since",
 			AccountResult{
-				AccountID: "account-id",
-				Name:      "name",
+				AccountID:    "account-id",
+				Name:         "name",
+				KeyAlgorithm: keys.KeyAlgorithmRSAOAEP,
 				PublicKey: (func() jwk.Key {
 					s, _ := jwk.ParseString(publicKey)
 					k, _ := s.Get(0)
@@ -167,6 +172,52 @@ func TestPersistenceLayer_GetAccount(t *testing.T) {
 				},
 			},
 		},
+		{
+			"deprecated keys",
+			&mockGetAccountDatabase{
+				findAccountResult: Account{
+					AccountID:           "account-id",
+					Name:                "name",
+					PublicKey:           publicKey,
+					EncryptedPrivateKey: "encrypted-private-key",
+					DeprecatedKeys: []DeprecatedAccountKey{
+						{KeyID: "key-a", AccountID: "account-id", PublicKey: publicKey, EncryptedPrivateKey: "deprecated-private-key", Deprecated: time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)},
+					},
+				},
+			},
+			false,
+			"",
+			AccountResult{
+				AccountID:    "account-id",
+				Name:         "name",
+				KeyAlgorithm: keys.KeyAlgorithmRSAOAEP,
+				PublicKey: (func() jwk.Key {
+					s, _ := jwk.ParseString(publicKey)
+					k, _ := s.Get(0)
+					return k
+				})(),
+				DeprecatedKeys: []DeprecatedKeyResult{
+					{
+						PublicKey: (func() jwk.Key {
+							s, _ := jwk.ParseString(publicKey)
+							k, _ := s.Get(0)
+							return k
+						})(),
+						KeyAlgorithm: keys.KeyAlgorithmRSAOAEP,
+						Deprecated:   time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC),
+					},
+				},
+			},
+			false,
+			[]assertion{
+				func(q interface{}) error {
+					if _, ok := q.(FindAccountQueryActiveByID); ok {
+						return nil
+					}
+					return fmt.Errorf("Unexpected arg type %v", q)
+				},
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -229,6 +280,126 @@ func TestPersistenceLayer_AssociateUserSecret(t *testing.T) {
 	}
 }
 
+type mockParkEventsDatabase struct {
+	DataAccessLayer
+	secrets    map[string]Secret
+	events     []Event
+	tombstones []Tombstone
+}
+
+func (m *mockParkEventsDatabase) FindAccount(interface{}) (Account, error) {
+	return Account{AccountID: "account-id", UserSalt: "{1,} CaHVhk78uhoPmf5wanA0vg=="}, nil
+}
+
+func (m *mockParkEventsDatabase) FindSecret(q interface{}) (Secret, error) {
+	secret, ok := m.secrets[string(q.(FindSecretQueryBySecretID))]
+	if !ok {
+		return Secret{}, ErrUnknownSecret("not found")
+	}
+	return secret, nil
+}
+
+func (m *mockParkEventsDatabase) CreateSecret(s *Secret) error {
+	m.secrets[s.SecretID] = *s
+	return nil
+}
+
+func (m *mockParkEventsDatabase) DeleteSecret(q interface{}) error {
+	delete(m.secrets, string(q.(DeleteSecretQueryBySecretID)))
+	return nil
+}
+
+func (m *mockParkEventsDatabase) FindEvents(q interface{}) ([]Event, error) {
+	query := q.(FindEventsQueryMetadataBySecretID)
+	var result []Event
+	for _, evt := range m.events {
+		if *evt.SecretID == query.SecretID && len(result) < query.Limit {
+			result = append(result, evt)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockParkEventsDatabase) UpdateEvents(q interface{}) (int64, error) {
+	query := q.(UpdateEventsQueryReassignSecret)
+	var affected int64
+	for i, evt := range m.events {
+		newID, ok := query.EventIDs[evt.EventID]
+		if !ok || *evt.SecretID != query.SecretID {
+			continue
+		}
+		m.events[i].EventID = newID
+		m.events[i].SecretID = &query.NewSecretID
+		m.events[i].Sequence = query.Sequence
+		affected++
+	}
+	return affected, nil
+}
+
+func (m *mockParkEventsDatabase) CreateTombstone(t *Tombstone) error {
+	m.tombstones = append(m.tombstones, *t)
+	return nil
+}
+
+func (m *mockParkEventsDatabase) Transaction() (Transaction, error) {
+	return &mockTxn{m}, nil
+}
+
+func TestPersistenceLayer_AssociateUserSecret_ParkEvents(t *testing.T) {
+	account := Account{AccountID: "account-id", UserSalt: "{1,} CaHVhk78uhoPmf5wanA0vg=="}
+	hashedUserID, err := account.HashUserID("user-id", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	numEvents := parkEventsBatchSize*2 + 1
+	db := &mockParkEventsDatabase{
+		secrets: map[string]Secret{
+			hashedUserID: {SecretID: hashedUserID, EncryptedSecret: "previous-secret"},
+		},
+	}
+	for i := 0; i < numEvents; i++ {
+		eventID, _ := NewULID()
+		db.events = append(db.events, Event{
+			EventID:   eventID,
+			AccountID: "account-id",
+			SecretID:  &hashedUserID,
+			Sequence:  eventID,
+		})
+	}
+
+	var progress []int
+	p := &persistenceLayer{dal: db, onMigrate: func(accountID string, migrated int) {
+		progress = append(progress, migrated)
+	}}
+	if err := p.AssociateUserSecret("account-id", "user-id", "encrypted-user-secret"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if expected := []int{parkEventsBatchSize, parkEventsBatchSize * 2, numEvents}; !reflect.DeepEqual(expected, progress) {
+		t.Errorf("Expected progress of %v, got %v", expected, progress)
+	}
+	if len(db.tombstones) != numEvents {
+		t.Errorf("Expected %d tombstones, got %d", numEvents, len(db.tombstones))
+	}
+	sequences := map[string]bool{}
+	for i, evt := range db.events {
+		if *evt.SecretID == hashedUserID {
+			t.Errorf("Unexpected event %v still associated with user", evt)
+		}
+		if evt.EventID == db.tombstones[i].EventID {
+			t.Errorf("Expected event %v to have received a new id", evt)
+		}
+		sequences[evt.Sequence] = true
+	}
+	if len(sequences) != 3 {
+		t.Errorf("Expected one sequence per batch, got %v", sequences)
+	}
+	if len(db.secrets) != 2 || db.secrets[hashedUserID].EncryptedSecret != "encrypted-user-secret" {
+		t.Errorf("Unexpected secrets %v", db.secrets)
+	}
+}
+
 type mockRetireAccountDatabase struct {
 	DataAccessLayer
 	updateErr         error
@@ -296,11 +467,115 @@ func TestPersistenceLayer_RetireAccount(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			p := persistenceLayer{test.db}
+			hooks := &mockNotifier{}
+			p := persistenceLayer{dal: test.db, webhooks: hooks}
 			err := p.RetireAccount("account-a")
 			if test.expectError != (err != nil) {
 				t.Errorf("Unexpected error value: %v", err)
 			}
+			expectedEvents := []string{webhook.EventAccountRetired}
+			if test.expectError {
+				expectedEvents = nil
+			}
+			if !reflect.DeepEqual(expectedEvents, hooks.events) {
+				t.Errorf("Expected notifications %v, got %v", expectedEvents, hooks.events)
+			}
+		})
+	}
+}
+
+type mockSetAccountRetentionDatabase struct {
+	DataAccessLayer
+	findAccountErr error
+	updateErr      error
+	updated        *Account
+}
+
+func (m *mockSetAccountRetentionDatabase) FindAccount(interface{}) (Account, error) {
+	return Account{AccountID: "account-a"}, m.findAccountErr
+}
+
+func (m *mockSetAccountRetentionDatabase) UpdateAccount(a *Account) error {
+	m.updated = a
+	return m.updateErr
+}
+
+func TestPersistenceLayer_SetAccountRetention(t *testing.T) {
+	tests := []struct {
+		name        string
+		db          *mockSetAccountRetentionDatabase
+		expectError bool
+	}{
+		{
+			"lookup error",
+			&mockSetAccountRetentionDatabase{
+				findAccountErr: ErrUnknownAccount("did not work"),
+			},
+			true,
+		},
+		{
+			"update error",
+			&mockSetAccountRetentionDatabase{
+				updateErr: errors.New("did not work"),
+			},
+			true,
+		},
+		{
+			"ok",
+			&mockSetAccountRetentionDatabase{},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := persistenceLayer{dal: test.db}
+			err := p.SetAccountRetention("account-a", time.Hour)
+			if test.expectError != (err != nil) {
+				t.Errorf("Unexpected error value: %v", err)
+			}
+			if !test.expectError && test.db.updated.Retention != time.Hour {
+				t.Errorf("Unexpected retention %v", test.db.updated.Retention)
+			}
+		})
+	}
+}
+
+func TestPersistenceLayer_SetAccountEventQuota(t *testing.T) {
+	tests := []struct {
+		name        string
+		db          *mockSetAccountRetentionDatabase
+		expectError bool
+	}{
+		{
+			"lookup error",
+			&mockSetAccountRetentionDatabase{
+				findAccountErr: ErrUnknownAccount("did not work"),
+			},
+			true,
+		},
+		{
+			"update error",
+			&mockSetAccountRetentionDatabase{
+				updateErr: errors.New("did not work"),
+			},
+			true,
+		},
+		{
+			"ok",
+			&mockSetAccountRetentionDatabase{},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := persistenceLayer{dal: test.db}
+			err := p.SetAccountEventQuota("account-a", 500)
+			if test.expectError != (err != nil) {
+				t.Errorf("Unexpected error value: %v", err)
+			}
+			if !test.expectError && test.db.updated.EventQuota != 500 {
+				t.Errorf("Unexpected event quota %v", test.db.updated.EventQuota)
+			}
 		})
 	}
 }
@@ -0,0 +1,74 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+	"time"
+)
+
+// AggregateResolution is the size of the buckets events are grouped into
+// when computing aggregates.
+type AggregateResolution string
+
+// Resolutions that can be used for computing aggregates
+const (
+	AggregateResolutionHour AggregateResolution = "hour"
+	AggregateResolutionDay  AggregateResolution = "day"
+)
+
+// size returns the duration of a single bucket.
+func (r AggregateResolution) size() (time.Duration, error) {
+	switch r {
+	case AggregateResolutionHour:
+		return time.Hour, nil
+	case AggregateResolutionDay:
+		return time.Hour * 24, nil
+	default:
+		return 0, ErrInvalidResolution(fmt.Sprintf("persistence: unknown resolution %q", string(r)))
+	}
+}
+
+// GetAccountAggregates returns event counts of the account of the given id
+// between since and until, grouped by the given resolution. Buckets are
+// always aligned to UTC, so the range is extended to cover the buckets
+// since and until fall into. Just like GetAccountStats, all values are
+// derived from metadata only and are counted by the database, so no event
+// has to be loaded or decrypted.
+func (p *persistenceLayer) GetAccountAggregates(accountID string, resolution AggregateResolution, since, until time.Time) (AggregatesResult, error) {
+	size, err := resolution.size()
+	if err != nil {
+		return AggregatesResult{}, err
+	}
+	if _, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID)); err != nil {
+		return AggregatesResult{}, fmt.Errorf("persistence: error looking up account: %w", err)
+	}
+
+	result := AggregatesResult{
+		AccountID:  accountID,
+		Resolution: resolution,
+		Buckets:    []AggregateBucket{},
+	}
+	if until.Before(since) {
+		return result, nil
+	}
+
+	from := since.UTC().Truncate(size)
+	counts, err := p.dal.CountEvents(CountEventsQueryByAccountIDInBuckets{
+		AccountID:  accountID,
+		Boundaries: bucketBoundaries(from, until, size),
+	})
+	if err != nil {
+		return AggregatesResult{}, fmt.Errorf("persistence: error counting events: %w", err)
+	}
+	for _, count := range counts {
+		result.Buckets = append(result.Buckets, AggregateBucket{
+			Start:         from.Add(time.Duration(count.Bucket) * size),
+			Events:        int(count.Events),
+			DistinctUsers: int(count.DistinctUsers),
+			PayloadBytes:  count.PayloadBytes,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type mockGetAccountAggregatesDatabase struct {
+	DataAccessLayer
+	findAccountErr error
+	events         []Event
+	countEventsErr error
+}
+
+func (m *mockGetAccountAggregatesDatabase) FindAccount(q interface{}) (Account, error) {
+	return Account{}, m.findAccountErr
+}
+
+func (m *mockGetAccountAggregatesDatabase) CountEvents(q interface{}) ([]EventCount, error) {
+	if m.countEventsErr != nil {
+		return nil, m.countEventsErr
+	}
+	return mockCountEvents(m.events, q), nil
+}
+
+func TestPersistenceLayer_GetAccountAggregates(t *testing.T) {
+	events := []Event{
+		{EventID: "01E01K4T00000000000000000C", SecretID: strptr("user-a"), Payload: "0123456789"},
+		{EventID: "01DZZ0R300000000000000000A", SecretID: strptr("user-a"), Payload: "01234567890123456789"},
+		{EventID: "01DZZ0R300000000000000000B", SecretID: strptr("user-b"), Payload: "012345678901234567890123456789"},
+		{EventID: "01E01K4T00000000000000000D", Payload: "0123456789012345678901234567890123456789"},
+		{EventID: "01DXT3N800000000000000000E", Payload: "0123456789"},
+	}
+	since := time.Date(2020, 2, 1, 12, 0, 0, 0, time.UTC)
+	until := time.Date(2020, 2, 3, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name           string
+		dal            *mockGetAccountAggregatesDatabase
+		resolution     AggregateResolution
+		since          time.Time
+		expectedResult AggregatesResult
+		expectError    bool
+	}{
+		{
+			"bad resolution",
+			&mockGetAccountAggregatesDatabase{},
+			AggregateResolution("week"),
+			since,
+			AggregatesResult{},
+			true,
+		},
+		{
+			"account lookup error",
+			&mockGetAccountAggregatesDatabase{
+				findAccountErr: errors.New("did not work"),
+			},
+			AggregateResolutionDay,
+			since,
+			AggregatesResult{},
+			true,
+		},
+		{
+			"count error",
+			&mockGetAccountAggregatesDatabase{
+				countEventsErr: errors.New("did not work"),
+			},
+			AggregateResolutionDay,
+			since,
+			AggregatesResult{},
+			true,
+		},
+		{
+			"empty",
+			&mockGetAccountAggregatesDatabase{},
+			AggregateResolutionDay,
+			since,
+			AggregatesResult{
+				AccountID:  "account-a",
+				Resolution: AggregateResolutionDay,
+				Buckets:    []AggregateBucket{},
+			},
+			false,
+		},
+		{
+			"empty range",
+			&mockGetAccountAggregatesDatabase{
+				events: events,
+			},
+			AggregateResolutionDay,
+			until.Add(time.Hour),
+			AggregatesResult{
+				AccountID:  "account-a",
+				Resolution: AggregateResolutionDay,
+				Buckets:    []AggregateBucket{},
+			},
+			false,
+		},
+		{
+			"by day",
+			&mockGetAccountAggregatesDatabase{
+				events: events,
+			},
+			AggregateResolutionDay,
+			since,
+			AggregatesResult{
+				AccountID:  "account-a",
+				Resolution: AggregateResolutionDay,
+				Buckets: []AggregateBucket{
+					{
+						Start:         time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC),
+						Events:        2,
+						DistinctUsers: 2,
+						PayloadBytes:  50,
+					},
+					{
+						Start:         time.Date(2020, 2, 2, 0, 0, 0, 0, time.UTC),
+						Events:        2,
+						DistinctUsers: 1,
+						PayloadBytes:  50,
+					},
+				},
+			},
+			false,
+		},
+		{
+			"by hour",
+			&mockGetAccountAggregatesDatabase{
+				events: events,
+			},
+			AggregateResolutionHour,
+			since,
+			AggregatesResult{
+				AccountID:  "account-a",
+				Resolution: AggregateResolutionHour,
+				Buckets: []AggregateBucket{
+					{
+						Start:         time.Date(2020, 2, 2, 0, 0, 0, 0, time.UTC),
+						Events:        2,
+						DistinctUsers: 1,
+						PayloadBytes:  50,
+					},
+				},
+			},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &persistenceLayer{dal: test.dal}
+			result, err := p.GetAccountAggregates("account-a", test.resolution, test.since, until)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if !reflect.DeepEqual(test.expectedResult, result) {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
+
+func TestAggregateResolution_size(t *testing.T) {
+	if size, err := AggregateResolutionHour.size(); err != nil || size != time.Hour {
+		t.Errorf("Unexpected hour %v, %v", size, err)
+	}
+	if size, err := AggregateResolutionDay.size(); err != nil || size != time.Hour*24 {
+		t.Errorf("Unexpected day %v, %v", size, err)
+	}
+	if _, err := AggregateResolution("").size(); err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
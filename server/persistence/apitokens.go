@@ -0,0 +1,192 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/offen/offen/server/keys"
+)
+
+const apiTokenSecretLength = 32
+
+func (p *persistenceLayer) CreateAPIToken(accountUserID, name string, accountIDs []string, scopes []APITokenScope) (APITokenResult, error) {
+	if strings.TrimSpace(name) == "" {
+		return APITokenResult{}, errors.New("persistence: api token requires a name")
+	}
+	if len(accountIDs) == 0 {
+		return APITokenResult{}, errors.New("persistence: api token requires at least one account")
+	}
+	if len(scopes) == 0 {
+		return APITokenResult{}, errors.New("persistence: api token requires at least one scope")
+	}
+	for _, scope := range scopes {
+		if !isKnownAPITokenScope(scope) {
+			return APITokenResult{}, fmt.Errorf("persistence: unknown api token scope %s", scope)
+		}
+	}
+
+	accountUser, err := p.LookupAccountUser(accountUserID)
+	if err != nil {
+		return APITokenResult{}, fmt.Errorf("persistence: error looking up account user: %w", err)
+	}
+	grantsManage := hasAPITokenScope(scopes, APITokenScopeManageAccount)
+	for _, accountID := range accountIDs {
+		if !accountUser.CanAccessAccount(accountID) {
+			return APITokenResult{}, fmt.Errorf("persistence: account user is not allowed to access account %s", accountID)
+		}
+		if grantsManage && !accountUser.CanManageAccount(accountID) {
+			return APITokenResult{}, fmt.Errorf("persistence: account user is not allowed to manage account %s", accountID)
+		}
+	}
+
+	tokenID, err := uuid.NewV4()
+	if err != nil {
+		return APITokenResult{}, fmt.Errorf("persistence: error creating token id: %w", err)
+	}
+	secret, err := keys.GenerateRandomValueWith(apiTokenSecretLength, base64.RawURLEncoding)
+	if err != nil {
+		return APITokenResult{}, fmt.Errorf("persistence: error creating token secret: %w", err)
+	}
+
+	token := APIToken{
+		TokenID:       tokenID.String(),
+		AccountUserID: accountUserID,
+		Name:          name,
+		HashedSecret:  hashAPITokenSecret(secret),
+		AccountIDs:    accountIDs,
+		Scopes:        scopes,
+		Created:       time.Now(),
+	}
+	if err := p.dal.CreateAPIToken(&token); err != nil {
+		return APITokenResult{}, fmt.Errorf("persistence: error persisting api token: %w", err)
+	}
+	result := token.result()
+	result.Token = fmt.Sprintf("%s.%s", token.TokenID, secret)
+	return result, nil
+}
+
+func (p *persistenceLayer) ListAPITokens(accountUserID string) ([]APITokenResult, error) {
+	tokens, err := p.dal.FindAPITokens(FindAPITokensQueryByAccountUserID(accountUserID))
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up api tokens: %w", err)
+	}
+	result := []APITokenResult{}
+	for _, token := range tokens {
+		result = append(result, token.result())
+	}
+	return result, nil
+}
+
+func (p *persistenceLayer) RevokeAPIToken(accountUserID, tokenID string) error {
+	tokens, err := p.dal.FindAPITokens(FindAPITokensQueryByTokenID(tokenID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up api token: %w", err)
+	}
+	if len(tokens) != 1 || tokens[0].AccountUserID != accountUserID {
+		return fmt.Errorf("persistence: api token %s does not exist", tokenID)
+	}
+	if _, err := p.dal.DeleteAPITokens(DeleteAPITokensQueryByTokenID(tokenID)); err != nil {
+		return fmt.Errorf("persistence: error deleting api token: %w", err)
+	}
+	return nil
+}
+
+// LookupAPIToken returns the login result for the given token. Access is
+// restricted to the intersection of the accounts the token has been created
+// for and the accounts the account user can currently access.
+func (p *persistenceLayer) LookupAPIToken(token string) (LoginResult, error) {
+	chunks := strings.SplitN(token, ".", 2)
+	if len(chunks) != 2 {
+		return LoginResult{}, errors.New("persistence: received malformed api token")
+	}
+	tokens, err := p.dal.FindAPITokens(FindAPITokensQueryByTokenID(chunks[0]))
+	if err != nil {
+		return LoginResult{}, fmt.Errorf("persistence: error looking up api token: %w", err)
+	}
+	if len(tokens) != 1 {
+		return LoginResult{}, errors.New("persistence: api token does not exist")
+	}
+	match := tokens[0]
+	if subtle.ConstantTimeCompare([]byte(hashAPITokenSecret(chunks[1])), []byte(match.HashedSecret)) != 1 {
+		return LoginResult{}, errors.New("persistence: api token secret did not match")
+	}
+
+	accountUser, err := p.LookupAccountUser(match.AccountUserID)
+	if err != nil {
+		return LoginResult{}, fmt.Errorf("persistence: error looking up account user: %w", err)
+	}
+
+	result := LoginResult{
+		AccountUserID: accountUser.AccountUserID,
+		Accounts:      []LoginAccountResult{},
+		Scopes:        append([]APITokenScope{}, match.Scopes...),
+	}
+	grantsManage := hasAPITokenScope(match.Scopes, APITokenScopeManageAccount)
+	for _, account := range accountUser.Accounts {
+		if !containsString(match.AccountIDs, account.AccountID) {
+			continue
+		}
+		if !grantsManage || !accountUser.CanManageAccount(account.AccountID) {
+			account.Role = AccountUserRoleViewer
+		} else {
+			account.Role = AccountUserRoleAdmin
+		}
+		result.Accounts = append(result.Accounts, account)
+	}
+
+	if time.Since(match.LastUsed) > sessionActivityInterval {
+		match.LastUsed = time.Now()
+		if err := p.dal.UpdateAPIToken(&match); err != nil {
+			return LoginResult{}, fmt.Errorf("persistence: error updating api token: %w", err)
+		}
+	}
+	return result, nil
+}
+
+func (a *APIToken) result() APITokenResult {
+	return APITokenResult{
+		TokenID:    a.TokenID,
+		Name:       a.Name,
+		AccountIDs: a.AccountIDs,
+		Scopes:     a.Scopes,
+		Created:    a.Created,
+		LastUsed:   a.LastUsed,
+	}
+}
+
+// hashAPITokenSecret hashes the given secret. As secrets are random values
+// of sufficient length, a fast hash function can be used here.
+func hashAPITokenSecret(secret string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(secret)))
+}
+
+func isKnownAPITokenScope(scope APITokenScope) bool {
+	return hasAPITokenScope(APITokenScopes, scope)
+}
+
+func hasAPITokenScope(scopes []APITokenScope, scope APITokenScope) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
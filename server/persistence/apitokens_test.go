@@ -0,0 +1,191 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockAPITokensDatabase struct {
+	DataAccessLayer
+	accountUser AccountUser
+	tokens      []APIToken
+	created     *APIToken
+}
+
+func (m *mockAPITokensDatabase) FindAccountUser(interface{}) (AccountUser, error) {
+	return m.accountUser, nil
+}
+
+func (m *mockAPITokensDatabase) FindAPITokens(interface{}) ([]APIToken, error) {
+	return m.tokens, nil
+}
+
+func (m *mockAPITokensDatabase) CreateAPIToken(t *APIToken) error {
+	m.created = t
+	return nil
+}
+
+func (m *mockAPITokensDatabase) UpdateAPIToken(*APIToken) error {
+	return nil
+}
+
+func TestPersistenceLayer_CreateAPIToken(t *testing.T) {
+	accountUser := AccountUser{
+		AccountUserID: "account-user-a",
+		Relationships: []AccountUserRelationship{
+			{AccountID: "account-a", Role: AccountUserRoleAdmin},
+			{AccountID: "account-b", Role: AccountUserRoleViewer},
+		},
+	}
+	tests := []struct {
+		name        string
+		tokenName   string
+		accountIDs  []string
+		scopes      []APITokenScope
+		expectError bool
+	}{
+		{
+			"missing name",
+			"",
+			[]string{"account-a"},
+			[]APITokenScope{APITokenScopeReadStats},
+			true,
+		},
+		{
+			"missing scopes",
+			"reporting",
+			[]string{"account-a"},
+			nil,
+			true,
+		},
+		{
+			"unknown scope",
+			"reporting",
+			[]string{"account-a"},
+			[]APITokenScope{"events:write"},
+			true,
+		},
+		{
+			"inaccessible account",
+			"reporting",
+			[]string{"account-z"},
+			[]APITokenScope{APITokenScopeReadStats},
+			true,
+		},
+		{
+			"manage scope as viewer",
+			"reporting",
+			[]string{"account-b"},
+			[]APITokenScope{APITokenScopeManageAccount},
+			true,
+		},
+		{
+			"ok",
+			"reporting",
+			[]string{"account-a", "account-b"},
+			[]APITokenScope{APITokenScopeReadStats},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dal := &mockAPITokensDatabase{accountUser: accountUser}
+			p := &persistenceLayer{dal: dal}
+			result, err := p.CreateAPIToken("account-user-a", test.tokenName, test.accountIDs, test.scopes)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if test.expectError {
+				return
+			}
+			if !strings.HasPrefix(result.Token, result.TokenID+".") {
+				t.Errorf("Unexpected token %v", result.Token)
+			}
+			if strings.Contains(dal.created.HashedSecret, strings.TrimPrefix(result.Token, result.TokenID+".")) {
+				t.Error("Expected secret to be hashed before persisting")
+			}
+		})
+	}
+}
+
+func TestPersistenceLayer_LookupAPIToken(t *testing.T) {
+	accountUser := AccountUser{
+		AccountUserID: "account-user-a",
+		Relationships: []AccountUserRelationship{
+			{AccountID: "account-a", Role: AccountUserRoleAdmin},
+			{AccountID: "account-b", Role: AccountUserRoleViewer},
+			{AccountID: "account-c", Role: AccountUserRoleAdmin},
+		},
+	}
+	token := APIToken{
+		TokenID:       "token-a",
+		AccountUserID: "account-user-a",
+		HashedSecret:  hashAPITokenSecret("secret"),
+		AccountIDs:    []string{"account-a", "account-b", "account-z"},
+		Scopes:        []APITokenScope{APITokenScopeReadStats, APITokenScopeManageAccount},
+		LastUsed:      time.Now(),
+	}
+	tests := []struct {
+		name           string
+		tokens         []APIToken
+		token          string
+		expectedResult LoginResult
+		expectError    bool
+	}{
+		{
+			"malformed token",
+			[]APIToken{token},
+			"token-a",
+			LoginResult{},
+			true,
+		},
+		{
+			"unknown token",
+			[]APIToken{},
+			"token-b.secret",
+			LoginResult{},
+			true,
+		},
+		{
+			"bad secret",
+			[]APIToken{token},
+			"token-a.other",
+			LoginResult{},
+			true,
+		},
+		{
+			"ok",
+			[]APIToken{token},
+			"token-a.secret",
+			LoginResult{
+				AccountUserID: "account-user-a",
+				Accounts: []LoginAccountResult{
+					{AccountID: "account-a", Role: AccountUserRoleAdmin},
+					{AccountID: "account-b", Role: AccountUserRoleViewer},
+				},
+				Scopes: []APITokenScope{APITokenScopeReadStats, APITokenScopeManageAccount},
+			},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &persistenceLayer{dal: &mockAPITokensDatabase{
+				accountUser: accountUser,
+				tokens:      test.tokens,
+			}}
+			result, err := p.LookupAPIToken(test.token)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if !reflect.DeepEqual(test.expectedResult, result) {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
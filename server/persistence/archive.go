@@ -0,0 +1,392 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/offen/offen/server/archive"
+	"github.com/offen/offen/server/keys"
+	"github.com/oklog/ulid"
+)
+
+// ErrNoArchive is returned when trying to archive events without having
+// configured an archive.
+var ErrNoArchive = errors.New("persistence: no archive configured")
+
+// WithArchive configures the persistence layer to use the given archive
+// for storing events that have been moved out of the database. Bundles of
+// events are encrypted using the given key before being stored.
+func WithArchive(a archive.Archive, key []byte) Config {
+	return func(p *persistenceLayer) {
+		p.archive = a
+		p.archiveKey = key
+	}
+}
+
+// archiveBundle contains all archived events of an account for a single day.
+// As user secrets might be pruned once no event in the database references
+// them anymore, the encrypted secret is stored alongside each event.
+type archiveBundle struct {
+	AccountID string          `json:"accountId"`
+	Events    []archivedEvent `json:"events"`
+}
+
+type archivedEvent struct {
+	EventID         string  `json:"eventId"`
+	Sequence        string  `json:"sequence"`
+	SecretID        *string `json:"secretId,omitempty"`
+	EncryptedSecret string  `json:"encryptedSecret,omitempty"`
+	Payload         string  `json:"payload"`
+}
+
+// key returns the key the bundle is stored at. Keys contain the first and
+// last event id so bundles can be expired without having to read them.
+func (b *archiveBundle) key() string {
+	return fmt.Sprintf("%s/%s-%s", b.AccountID, b.Events[0].EventID, b.Events[len(b.Events)-1].EventID)
+}
+
+func parseBundleKey(key string) (accountID, lastEventID string, ok bool) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	ids := strings.Split(parts[1], "-")
+	if len(ids) != 2 {
+		return "", "", false
+	}
+	return parts[0], ids[1], true
+}
+
+// archiveBatchSize is the maximum number of events that are archived at once.
+const archiveBatchSize = 5000
+
+// ArchiveEvents moves all events older than the given threshold out of the
+// database and into the configured archive.
+func (p *persistenceLayer) ArchiveEvents(threshold time.Duration) (int, error) {
+	if p.archive == nil {
+		return 0, ErrNoArchive
+	}
+	deadline, err := EventIDAt(time.Now().Add(-threshold))
+	if err != nil {
+		return 0, fmt.Errorf("persistence: error determining deadline for archiving events: %w", err)
+	}
+	return p.archiveEvents(deadline, archiveBatchSize)
+}
+
+// archiveEvents archives events older than the given deadline in batches of
+// the given size, oldest first. The events of a batch are only deleted from
+// the database after all of its bundles have been stored. In case deleting
+// fails, the next run selects the same batch again and overwrites the bundles
+// that have already been stored, as bundle keys are derived from the events
+// they contain.
+func (p *persistenceLayer) archiveEvents(deadline string, batchSize int) (int, error) {
+	var eventsAffected int64
+	for {
+		events, err := p.dal.FindEvents(FindEventsQueryOlderThanLimit{EventID: deadline, Limit: batchSize})
+		if err != nil {
+			return int(eventsAffected), fmt.Errorf("persistence: error looking up events to archive: %w", err)
+		}
+		if len(events) == 0 {
+			return int(eventsAffected), nil
+		}
+
+		bundles, err := p.bundleEvents(events)
+		if err != nil {
+			return int(eventsAffected), err
+		}
+		var eventIDs []string
+		for _, bundle := range bundles {
+			if err := p.writeBundle(bundle); err != nil {
+				return int(eventsAffected), err
+			}
+			for _, evt := range bundle.Events {
+				eventIDs = append(eventIDs, evt.EventID)
+			}
+		}
+		affected, err := p.dal.DeleteEvents(DeleteEventsQueryByEventIDs(eventIDs))
+		if err != nil {
+			return int(eventsAffected), fmt.Errorf("persistence: error deleting archived events: %w", err)
+		}
+		eventsAffected += affected
+		if len(events) < batchSize {
+			return int(eventsAffected), nil
+		}
+	}
+}
+
+// bundleEvents groups the given events into bundles per account and day.
+func (p *persistenceLayer) bundleEvents(events []Event) ([]*archiveBundle, error) {
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].EventID < events[j].EventID
+	})
+
+	secrets := map[string]string{}
+	bundles := map[string]*archiveBundle{}
+	var result []*archiveBundle
+	for _, evt := range events {
+		archived := archivedEvent{
+			EventID:  evt.EventID,
+			Sequence: evt.Sequence,
+			SecretID: evt.SecretID,
+			Payload:  evt.Payload,
+		}
+		if evt.SecretID != nil {
+			if _, ok := secrets[*evt.SecretID]; !ok {
+				secret, err := p.dal.FindSecret(FindSecretQueryBySecretID(*evt.SecretID))
+				if err != nil {
+					var unknownSecretErr ErrUnknownSecret
+					if !errors.As(err, &unknownSecretErr) {
+						return nil, fmt.Errorf("persistence: error looking up secret for archiving: %w", err)
+					}
+				}
+				secrets[*evt.SecretID] = secret.EncryptedSecret
+			}
+			archived.EncryptedSecret = secrets[*evt.SecretID]
+		}
+
+		group := fmt.Sprintf("%s/%s", evt.AccountID, eventDay(evt.EventID))
+		if _, ok := bundles[group]; !ok {
+			bundles[group] = &archiveBundle{AccountID: evt.AccountID}
+			result = append(result, bundles[group])
+		}
+		bundles[group].Events = append(bundles[group].Events, archived)
+	}
+	return result, nil
+}
+
+// GetAccountWithArchive works like GetAccount including events, but also adds
+// all matching events that have been moved to the archive. In case no archive is
+// configured, only events stored in the database are returned.
+func (p *persistenceLayer) GetAccountWithArchive(accountID, eventsSince string) (AccountResult, error) {
+	result, err := p.GetAccount(accountID, true, eventsSince)
+	if err != nil || p.archive == nil {
+		return result, err
+	}
+
+	_, bundles, err := p.readArchive(accountID)
+	if err != nil {
+		return AccountResult{}, err
+	}
+
+	if result.Events == nil {
+		result.Events = &EventsByAccountID{}
+	}
+	if result.Secrets == nil {
+		result.Secrets = &EncryptedSecretsByID{}
+	}
+	known := map[string]bool{}
+	for _, evt := range (*result.Events)[accountID] {
+		known[evt.EventID] = true
+	}
+
+	seqs := []string{result.Sequence}
+	for _, bundle := range bundles {
+		for _, evt := range bundle.Events {
+			if known[evt.EventID] || (eventsSince != "" && evt.Sequence <= eventsSince) {
+				continue
+			}
+			known[evt.EventID] = true
+			(*result.Events)[accountID] = append((*result.Events)[accountID], EventResult{
+				SecretID: evt.SecretID,
+				EventID:  evt.EventID,
+				Payload:  evt.Payload,
+			})
+			if evt.SecretID != nil && evt.EncryptedSecret != "" {
+				if _, ok := (*result.Secrets)[*evt.SecretID]; !ok {
+					(*result.Secrets)[*evt.SecretID] = evt.EncryptedSecret
+				}
+			}
+			seqs = append(seqs, evt.Sequence)
+		}
+	}
+	if len(*result.Events) == 0 {
+		result.Events = nil
+	}
+	if len(*result.Secrets) == 0 {
+		result.Secrets = nil
+	}
+	result.Sequence = getLatestSeq(seqs)
+	return result, nil
+}
+
+// expireArchive deletes all bundles whose events have all expired.
+func (p *persistenceLayer) expireArchive(deadlines map[string]string, deadline string) error {
+	bundleKeys, err := p.archive.List("")
+	if err != nil {
+		return fmt.Errorf("persistence: error listing archived bundles: %w", err)
+	}
+	for _, key := range bundleKeys {
+		accountID, lastEventID, ok := parseBundleKey(key)
+		if !ok {
+			continue
+		}
+		accountDeadline := deadline
+		if d, ok := deadlines[accountID]; ok {
+			accountDeadline = d
+		}
+		if lastEventID >= accountDeadline {
+			continue
+		}
+		if err := p.archive.Delete(key); err != nil {
+			return fmt.Errorf("persistence: error deleting expired bundle: %w", err)
+		}
+	}
+	return nil
+}
+
+// archivePurge contains the changes needed for removing the events of a user
+// from the archive. As the archive is not part of database transactions, the
+// tombstones are created within the transaction, and the bundles are only
+// updated after it has been committed.
+type archivePurge struct {
+	tombstones []Tombstone
+	writes     []archiveBundle
+	deletes    []string
+}
+
+// planArchivePurge determines the changes needed for removing all events of the
+// given secret ids from the archived bundles of the given account.
+func (p *persistenceLayer) planArchivePurge(purge *archivePurge, accountID string, secretIDs []string, sequence string) error {
+	bundleKeys, bundles, err := p.readArchive(accountID)
+	if err != nil {
+		return err
+	}
+	for i, bundle := range bundles {
+		var retained []archivedEvent
+		for _, evt := range bundle.Events {
+			if evt.SecretID == nil || !containsString(secretIDs, *evt.SecretID) {
+				retained = append(retained, evt)
+				continue
+			}
+			purge.tombstones = append(purge.tombstones, Tombstone{
+				EventID:   evt.EventID,
+				AccountID: accountID,
+				SecretID:  evt.SecretID,
+				Sequence:  sequence,
+			})
+		}
+		if len(retained) == len(bundle.Events) {
+			continue
+		}
+		if len(retained) != 0 {
+			bundle.Events = retained
+			purge.writes = append(purge.writes, bundle)
+			if bundle.key() == bundleKeys[i] {
+				continue
+			}
+		}
+		purge.deletes = append(purge.deletes, bundleKeys[i])
+	}
+	return nil
+}
+
+// createTombstones creates the tombstones for all purged archived events.
+func (a *archivePurge) createTombstones(txn DataAccessLayer) error {
+	for i := range a.tombstones {
+		if err := txn.CreateTombstone(&a.tombstones[i]); err != nil {
+			return fmt.Errorf("persistence: error creating tombstone for purged archived event: %w", err)
+		}
+	}
+	return nil
+}
+
+// applyArchivePurge updates the archive. Bundles are rewritten before the
+// previous versions are deleted so no retained event is lost in case of
+// failure.
+func (p *persistenceLayer) applyArchivePurge(purge *archivePurge) error {
+	for i := range purge.writes {
+		if err := p.writeBundle(&purge.writes[i]); err != nil {
+			return err
+		}
+	}
+	for _, key := range purge.deletes {
+		if err := p.archive.Delete(key); err != nil {
+			return fmt.Errorf("persistence: error deleting purged bundle: %w", err)
+		}
+	}
+	return nil
+}
+
+// readArchive reads all bundles that have been archived for the given account.
+func (p *persistenceLayer) readArchive(accountID string) ([]string, []archiveBundle, error) {
+	bundleKeys, err := p.archive.List(accountID + "/")
+	if err != nil {
+		return nil, nil, fmt.Errorf("persistence: error listing archived bundles: %w", err)
+	}
+	sort.Strings(bundleKeys)
+	var bundles []archiveBundle
+	for _, key := range bundleKeys {
+		bundle, err := p.readBundle(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		bundles = append(bundles, bundle)
+	}
+	return bundleKeys, bundles, nil
+}
+
+func (p *persistenceLayer) writeBundle(bundle *archiveBundle) error {
+	b, err := json.Marshal(bundle)
+	if err != nil {
+		return fmt.Errorf("persistence: error marshaling bundle: %w", err)
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return fmt.Errorf("persistence: error compressing bundle: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("persistence: error compressing bundle: %w", err)
+	}
+	cipher, err := keys.EncryptWith(p.archiveKey, buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("persistence: error encrypting bundle: %w", err)
+	}
+	data := cipher.Marshal()
+	if err := p.archive.Put(bundle.key(), strings.NewReader(data), int64(len(data))); err != nil {
+		return fmt.Errorf("persistence: error storing bundle: %w", err)
+	}
+	return nil
+}
+
+func (p *persistenceLayer) readBundle(key string) (archiveBundle, error) {
+	data, err := p.archive.Get(key)
+	if err != nil {
+		return archiveBundle{}, fmt.Errorf("persistence: error reading bundle: %w", err)
+	}
+	compressed, err := keys.DecryptWith(p.archiveKey, string(data))
+	if err != nil {
+		return archiveBundle{}, fmt.Errorf("persistence: error decrypting bundle: %w", err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return archiveBundle{}, fmt.Errorf("persistence: error decompressing bundle: %w", err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return archiveBundle{}, fmt.Errorf("persistence: error decompressing bundle: %w", err)
+	}
+	var bundle archiveBundle
+	if err := json.Unmarshal(b, &bundle); err != nil {
+		return archiveBundle{}, fmt.Errorf("persistence: error unmarshaling bundle: %w", err)
+	}
+	return bundle, nil
+}
+
+func eventDay(eventID string) string {
+	id, err := ulid.Parse(eventID)
+	if err != nil {
+		return "unknown"
+	}
+	return ulid.Time(id.Time()).UTC().Format("2006-01-02")
+}
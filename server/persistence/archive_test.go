@@ -0,0 +1,271 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/archive"
+)
+
+type mockArchive struct {
+	objects map[string][]byte
+}
+
+func (m *mockArchive) Put(key string, r io.Reader, size int64) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m.objects[key] = data
+	return nil
+}
+
+func (m *mockArchive) Get(key string) ([]byte, error) {
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, archive.ErrNotFound
+	}
+	return data, nil
+}
+
+func (m *mockArchive) List(prefix string) ([]string, error) {
+	keys := []string{}
+	for key := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (m *mockArchive) Delete(key string) error {
+	delete(m.objects, key)
+	return nil
+}
+
+type mockArchiveDatabase struct {
+	DataAccessLayer
+	events     []Event
+	tombstones []Tombstone
+	deleteErr  error
+}
+
+func (m *mockArchiveDatabase) FindEvents(q interface{}) ([]Event, error) {
+	query, ok := q.(FindEventsQueryOlderThanLimit)
+	if !ok {
+		return nil, ErrBadQuery
+	}
+	var result []Event
+	for _, evt := range m.events {
+		if evt.EventID < query.EventID {
+			result = append(result, evt)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].EventID < result[j].EventID
+	})
+	if len(result) > query.Limit {
+		result = result[:query.Limit]
+	}
+	return result, nil
+}
+
+func (m *mockArchiveDatabase) FindSecret(q interface{}) (Secret, error) {
+	secretID := string(q.(FindSecretQueryBySecretID))
+	return Secret{SecretID: secretID, EncryptedSecret: "encrypted-" + secretID}, nil
+}
+
+func (m *mockArchiveDatabase) DeleteEvents(q interface{}) (int64, error) {
+	if m.deleteErr != nil {
+		return 0, m.deleteErr
+	}
+	ids := []string(q.(DeleteEventsQueryByEventIDs))
+	var retained []Event
+	for _, evt := range m.events {
+		if !containsString(ids, evt.EventID) {
+			retained = append(retained, evt)
+		}
+	}
+	affected := int64(len(m.events) - len(retained))
+	m.events = retained
+	return affected, nil
+}
+
+func (m *mockArchiveDatabase) FindAccount(q interface{}) (Account, error) {
+	return Account{AccountID: "account-a", PublicKey: publicKey, Events: m.events}, nil
+}
+
+func (m *mockArchiveDatabase) FindTombstones(q interface{}) ([]Tombstone, error) {
+	return nil, nil
+}
+
+func (m *mockArchiveDatabase) CreateTombstone(t *Tombstone) error {
+	m.tombstones = append(m.tombstones, *t)
+	return nil
+}
+
+func mustEventIDAt(t time.Time) string {
+	id, err := EventIDAt(t)
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+func TestPersistenceLayer_Archive(t *testing.T) {
+	now := time.Now()
+	oldest := mustEventIDAt(now.Add(-72 * time.Hour))
+	older := mustEventIDAt(now.Add(-48 * time.Hour))
+	recent := mustEventIDAt(now.Add(-time.Hour))
+
+	db := &mockArchiveDatabase{
+		events: []Event{
+			{EventID: older, Sequence: older, AccountID: "account-a", SecretID: strptr("user-a"), Payload: "payload-older"},
+			{EventID: oldest, Sequence: oldest, AccountID: "account-a", SecretID: strptr("user-b"), Payload: "payload-oldest"},
+			{EventID: recent, Sequence: recent, AccountID: "account-a", SecretID: strptr("user-a"), Payload: "payload-recent"},
+		},
+	}
+	a := &mockArchive{objects: map[string][]byte{}}
+	p := &persistenceLayer{dal: db}
+
+	if _, err := p.ArchiveEvents(24 * time.Hour); !errors.Is(err, ErrNoArchive) {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	WithArchive(a, []byte("0123456789abcdef"))(p)
+
+	affected, err := p.ArchiveEvents(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if affected != 2 {
+		t.Errorf("Unexpected number of archived events %d", affected)
+	}
+	if len(db.events) != 1 || db.events[0].EventID != recent {
+		t.Errorf("Unexpected events remaining in database %v", db.events)
+	}
+	keys, _ := a.List("account-a/")
+	expectedKeys := []string{"account-a/" + oldest + "-" + oldest, "account-a/" + older + "-" + older}
+	if !reflect.DeepEqual(expectedKeys, keys) {
+		t.Errorf("Expected keys %v, got %v", expectedKeys, keys)
+	}
+
+	t.Run("get account", func(t *testing.T) {
+		result, err := p.GetAccountWithArchive("account-a", "")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		var eventIDs []string
+		for _, evt := range (*result.Events)["account-a"] {
+			eventIDs = append(eventIDs, evt.EventID)
+		}
+		if !reflect.DeepEqual([]string{recent, oldest, older}, eventIDs) {
+			t.Errorf("Unexpected events %v", eventIDs)
+		}
+		if (*result.Secrets)["user-b"] != "encrypted-user-b" {
+			t.Errorf("Unexpected secrets %v", *result.Secrets)
+		}
+		if result.Sequence != recent {
+			t.Errorf("Unexpected sequence %v", result.Sequence)
+		}
+
+		result, err = p.GetAccountWithArchive("account-a", oldest)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len((*result.Events)["account-a"]) != 2 {
+			t.Errorf("Unexpected events %v", *result.Events)
+		}
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		var purge archivePurge
+		if err := p.planArchivePurge(&purge, "account-a", []string{"user-b"}, "sequence"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(a.objects) != 2 {
+			t.Errorf("Expected archive to be unchanged before applying, got %v", a.objects)
+		}
+		if err := purge.createTombstones(&mockTxn{db}); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(db.tombstones) != 1 || db.tombstones[0].EventID != oldest {
+			t.Errorf("Unexpected tombstones %v", db.tombstones)
+		}
+		if err := p.applyArchivePurge(&purge); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		keys, _ := a.List("")
+		if !reflect.DeepEqual([]string{"account-a/" + older + "-" + older}, keys) {
+			t.Errorf("Unexpected keys %v", keys)
+		}
+	})
+
+	t.Run("expire", func(t *testing.T) {
+		if err := p.expireArchive(map[string]string{}, oldest); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(a.objects) != 1 {
+			t.Errorf("Unexpected objects %v", a.objects)
+		}
+		if err := p.expireArchive(map[string]string{"account-a": recent}, oldest); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(a.objects) != 0 {
+			t.Errorf("Unexpected objects %v", a.objects)
+		}
+	})
+}
+
+func TestPersistenceLayer_archiveEvents(t *testing.T) {
+	now := time.Now()
+	var events []Event
+	for i := 5; i > 0; i-- {
+		id := mustEventIDAt(now.Add(time.Duration(-i) * 24 * time.Hour))
+		events = append(events, Event{EventID: id, Sequence: id, AccountID: "account-a", SecretID: strptr("user-a")})
+	}
+	deadline := mustEventIDAt(now)
+
+	db := &mockArchiveDatabase{events: events, deleteErr: errors.New("did not work")}
+	a := &mockArchive{objects: map[string][]byte{}}
+	p := &persistenceLayer{dal: db}
+	WithArchive(a, []byte("0123456789abcdef"))(p)
+
+	if _, err := p.archiveEvents(deadline, 2); err == nil {
+		t.Error("Expected error, got nil")
+	}
+	if len(db.events) != 5 || len(a.objects) != 2 {
+		t.Errorf("Unexpected state after failed deletion: %d events, %d objects", len(db.events), len(a.objects))
+	}
+
+	db.deleteErr = nil
+	affected, err := p.archiveEvents(deadline, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if affected != 5 || len(db.events) != 0 {
+		t.Errorf("Unexpected result %d, remaining events %v", affected, db.events)
+	}
+	// bundles written before the failure are overwritten instead of being
+	// stored twice
+	if len(a.objects) != 5 {
+		t.Errorf("Unexpected objects %v", a.objects)
+	}
+}
+
+type mockTxn struct {
+	DataAccessLayer
+}
+
+func (m *mockTxn) Commit() error   { return nil }
+func (m *mockTxn) Rollback() error { return nil }
@@ -0,0 +1,104 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+	"time"
+)
+
+// Actions that are recorded in the audit log
+const (
+	AuditActionAccountCreate       = "account.create"
+	AuditActionAccountImport       = "account.import"
+	AuditActionAccountRetire       = "account.retire"
+	AuditActionAccountRetention    = "account.retention"
+	AuditActionAccountEventQuota   = "account.quota"
+	AuditActionAccountDomains      = "account.domains"
+	AuditActionAccountDomainVerify = "account.domains.verify"
+	AuditActionAccountBanner       = "account.banner"
+	AuditActionAccountSettings     = "account.settings"
+	AuditActionAccountKeysRotate   = "account.keys.rotate"
+	AuditActionAccountShare        = "account.share"
+	AuditActionMaintenance         = "instance.maintenance"
+	AuditActionAPITokenCreate      = "token.create"
+	AuditActionAPITokenDelete      = "token.delete"
+	AuditActionUserJoin            = "user.join"
+	AuditActionUserPassword        = "user.password"
+	AuditActionUserEmail           = "user.email"
+	AuditActionUserTOTPEnroll      = "user.totp.enroll"
+	AuditActionUserTOTPDisable     = "user.totp.disable"
+)
+
+const (
+	defaultAuditLogLimit = 100
+	maxAuditLogLimit     = 1000
+)
+
+// AuditLogFilter limits the entries returned when listing the audit log.
+// Zero values do not apply any filter.
+type AuditLogFilter struct {
+	AccountID string
+	ActorID   string
+	Action    string
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+}
+
+// RecordAuditEntry appends an entry for the given action to the audit log.
+// Entries are never updated or deleted once they have been recorded.
+func (p *persistenceLayer) RecordAuditEntry(action, actorID, accountID, requestID string) error {
+	now := time.Now().UTC()
+	entryID, err := EventIDAt(now)
+	if err != nil {
+		return fmt.Errorf("persistence: error creating audit entry id: %w", err)
+	}
+	if err := p.dal.CreateAuditEntry(&AuditEntry{
+		EntryID:   entryID,
+		Action:    action,
+		ActorID:   actorID,
+		AccountID: accountID,
+		RequestID: requestID,
+		Created:   now,
+	}); err != nil {
+		return fmt.Errorf("persistence: error recording audit entry: %w", err)
+	}
+	return nil
+}
+
+// ListAuditEntries returns the entries of the audit log matching the given
+// filter, newest first.
+func (p *persistenceLayer) ListAuditEntries(filter AuditLogFilter) ([]AuditEntryResult, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultAuditLogLimit
+	}
+	if limit > maxAuditLogLimit {
+		limit = maxAuditLogLimit
+	}
+	entries, err := p.dal.FindAuditEntries(FindAuditEntriesQueryFiltered{
+		AccountID: filter.AccountID,
+		ActorID:   filter.ActorID,
+		Action:    filter.Action,
+		Since:     filter.Since,
+		Until:     filter.Until,
+		Limit:     limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up audit entries: %w", err)
+	}
+	result := []AuditEntryResult{}
+	for _, entry := range entries {
+		result = append(result, AuditEntryResult{
+			EntryID:   entry.EntryID,
+			Action:    entry.Action,
+			ActorID:   entry.ActorID,
+			AccountID: entry.AccountID,
+			RequestID: entry.RequestID,
+			Created:   entry.Created,
+		})
+	}
+	return result, nil
+}
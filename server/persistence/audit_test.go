@@ -0,0 +1,104 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type mockAuditDatabase struct {
+	DataAccessLayer
+	created []AuditEntry
+	query   interface{}
+	err     error
+}
+
+func (m *mockAuditDatabase) CreateAuditEntry(e *AuditEntry) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.created = append(m.created, *e)
+	return nil
+}
+
+func (m *mockAuditDatabase) FindAuditEntries(q interface{}) ([]AuditEntry, error) {
+	m.query = q
+	return m.created, m.err
+}
+
+func TestPersistenceLayer_RecordAuditEntry(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		db := &mockAuditDatabase{}
+		p := &persistenceLayer{dal: db}
+		if err := p.RecordAuditEntry(AuditActionAccountRetire, "user-a", "account-a", "request-a"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(db.created) != 1 {
+			t.Fatalf("Expected a single entry, got %v", db.created)
+		}
+		entry := db.created[0]
+		if entry.EntryID == "" || time.Since(entry.Created) > time.Minute {
+			t.Errorf("Unexpected entry %v", entry)
+		}
+		if entry.Action != AuditActionAccountRetire || entry.ActorID != "user-a" || entry.AccountID != "account-a" || entry.RequestID != "request-a" {
+			t.Errorf("Unexpected entry %v", entry)
+		}
+	})
+	t.Run("database error", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockAuditDatabase{err: errors.New("did not work")}}
+		if err := p.RecordAuditEntry(AuditActionAccountRetire, "user-a", "account-a", "request-a"); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+}
+
+func TestPersistenceLayer_ListAuditEntries(t *testing.T) {
+	since := time.Date(2021, 3, 14, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name           string
+		filter         AuditLogFilter
+		expectedQuery  FindAuditEntriesQueryFiltered
+		expectedResult []AuditEntryResult
+	}{
+		{
+			"default limit",
+			AuditLogFilter{AccountID: "account-a", Since: since},
+			FindAuditEntriesQueryFiltered{AccountID: "account-a", Since: since, Limit: defaultAuditLogLimit},
+			[]AuditEntryResult{
+				{EntryID: "entry-a", Action: AuditActionAccountCreate, ActorID: "user-a", Created: since},
+			},
+		},
+		{
+			"limit exceeded",
+			AuditLogFilter{Action: AuditActionMaintenance, Limit: 5000},
+			FindAuditEntriesQueryFiltered{Action: AuditActionMaintenance, Limit: maxAuditLogLimit},
+			[]AuditEntryResult{
+				{EntryID: "entry-a", Action: AuditActionAccountCreate, ActorID: "user-a", Created: since},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := &mockAuditDatabase{
+				created: []AuditEntry{
+					{EntryID: "entry-a", Action: AuditActionAccountCreate, ActorID: "user-a", Created: since},
+				},
+			}
+			p := &persistenceLayer{dal: db}
+			result, err := p.ListAuditEntries(test.filter)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(test.expectedQuery, db.query) {
+				t.Errorf("Expected query %v, got %v", test.expectedQuery, db.query)
+			}
+			if !reflect.DeepEqual(test.expectedResult, result) {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Backup writes a consistent snapshot of all data to the given writer.
+func (p *persistenceLayer) Backup(w io.Writer) error {
+	if err := p.dal.Backup(w); err != nil {
+		return fmt.Errorf("persistence: error creating backup: %w", err)
+	}
+	return nil
+}
+
+// Restore replaces all data with the snapshot read from the given reader.
+// Unless force is given, restoring is only allowed for empty databases.
+func (p *persistenceLayer) Restore(r io.Reader, force bool) error {
+	if !force && !p.dal.ProbeEmpty() {
+		return errors.New("persistence: action would overwrite existing data - not allowed")
+	}
+	if err := p.dal.Restore(r); err != nil {
+		return fmt.Errorf("persistence: error restoring backup: %w", err)
+	}
+	p.publishAccountChange(AccountChange{Reason: AccountChangeRestored})
+	return nil
+}
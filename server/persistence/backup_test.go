@@ -0,0 +1,78 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+type mockRestoreDatabase struct {
+	DataAccessLayer
+	empty    bool
+	err      error
+	restored bool
+}
+
+func (m *mockRestoreDatabase) ProbeEmpty() bool {
+	return m.empty
+}
+
+func (m *mockRestoreDatabase) Restore(io.Reader) error {
+	m.restored = true
+	return m.err
+}
+
+func TestPersistenceLayer_Restore(t *testing.T) {
+	tests := []struct {
+		name             string
+		db               *mockRestoreDatabase
+		force            bool
+		expectError      bool
+		expectedRestored bool
+	}{
+		{
+			"not empty",
+			&mockRestoreDatabase{},
+			false,
+			true,
+			false,
+		},
+		{
+			"not empty with force",
+			&mockRestoreDatabase{},
+			true,
+			false,
+			true,
+		},
+		{
+			"empty",
+			&mockRestoreDatabase{empty: true},
+			false,
+			false,
+			true,
+		},
+		{
+			"restore error",
+			&mockRestoreDatabase{empty: true, err: errors.New("did not work")},
+			false,
+			true,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &persistenceLayer{dal: test.db}
+			err := p.Restore(strings.NewReader(""), test.force)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if test.db.restored != test.expectedRestored {
+				t.Errorf("Expected restored to be %v", test.expectedRestored)
+			}
+		})
+	}
+}
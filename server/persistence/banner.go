@@ -0,0 +1,123 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+)
+
+// maxBannerTextLength is the maximum number of characters a single text of
+// the consent banner can have.
+const maxBannerTextLength = 500
+
+// maxBannerLocales is the maximum number of locales texts can be stored for.
+const maxBannerLocales = 20
+
+// AccountBanner customizes the consent banner that is displayed by the script
+// embedded on the sites of an account.
+type AccountBanner struct {
+	// Locale overrides the locale configured for the instance
+	Locale string       `json:"locale,omitempty"`
+	Theme  *BannerTheme `json:"theme,omitempty"`
+	// Texts are keyed by locale. Texts that are not given fall back to
+	// the default texts of the locale.
+	Texts map[string]BannerTexts `json:"texts,omitempty"`
+}
+
+// BannerTheme contains the colors used for displaying the consent banner.
+// Colors are given as hex values.
+type BannerTheme struct {
+	Background string `json:"background,omitempty"`
+	Text       string `json:"text,omitempty"`
+	Button     string `json:"button,omitempty"`
+	ButtonText string `json:"buttonText,omitempty"`
+}
+
+// BannerTexts contains the texts displayed in the consent banner.
+type BannerTexts struct {
+	Body   string `json:"body,omitempty"`
+	Accept string `json:"accept,omitempty"`
+	Deny   string `json:"deny,omitempty"`
+}
+
+var (
+	bannerColorPattern  = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+	bannerLocalePattern = regexp.MustCompile(`^[a-z]{2}(-[A-Z]{2})?$`)
+)
+
+func (b *AccountBanner) validate() error {
+	if b.Locale != "" && !bannerLocalePattern.MatchString(b.Locale) {
+		return ErrInvalidBanner(fmt.Sprintf("persistence: %s is not a valid locale", b.Locale))
+	}
+	if b.Theme != nil {
+		for _, color := range []string{b.Theme.Background, b.Theme.Text, b.Theme.Button, b.Theme.ButtonText} {
+			if color != "" && !bannerColorPattern.MatchString(color) {
+				return ErrInvalidBanner(fmt.Sprintf("persistence: %s is not a valid hex color", color))
+			}
+		}
+	}
+	if len(b.Texts) > maxBannerLocales {
+		return ErrInvalidBanner(fmt.Sprintf("persistence: cannot store texts for more than %d locales", maxBannerLocales))
+	}
+	for locale, texts := range b.Texts {
+		if !bannerLocalePattern.MatchString(locale) {
+			return ErrInvalidBanner(fmt.Sprintf("persistence: %s is not a valid locale", locale))
+		}
+		for _, text := range []string{texts.Body, texts.Accept, texts.Deny} {
+			if utf8.RuneCountInString(text) > maxBannerTextLength {
+				return ErrInvalidBanner(fmt.Sprintf("persistence: banner texts cannot exceed %d characters", maxBannerTextLength))
+			}
+		}
+	}
+	return nil
+}
+
+func (a *Account) banner() (*AccountBanner, error) {
+	if a.Banner == "" {
+		return nil, nil
+	}
+	var result AccountBanner
+	if err := json.Unmarshal([]byte(a.Banner), &result); err != nil {
+		return nil, fmt.Errorf("persistence: error decoding banner: %w", err)
+	}
+	return &result, nil
+}
+
+// setBanner validates and stores the given banner on the account, so that
+// no code path can persist a banner that has not been validated.
+func (a *Account) setBanner(banner *AccountBanner) error {
+	if banner == nil {
+		a.Banner = ""
+		return nil
+	}
+	if err := banner.validate(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(banner)
+	if err != nil {
+		return fmt.Errorf("persistence: error encoding banner: %w", err)
+	}
+	a.Banner = string(b)
+	return nil
+}
+
+// SetAccountBanner replaces the banner customization of the account with the
+// given id. Passing nil resets the account to the default banner.
+func (p *persistenceLayer) SetAccountBanner(accountID string, banner *AccountBanner) error {
+	account, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account %s: %w", accountID, err)
+	}
+	if err := account.setBanner(banner); err != nil {
+		return err
+	}
+	if err := p.dal.UpdateAccount(&account); err != nil {
+		return fmt.Errorf("persistence: error updating banner of account %s: %w", accountID, err)
+	}
+	p.publishAccountChange(AccountChange{AccountID: accountID, Reason: AccountChangeBanner})
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAccountBanner_validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		banner      AccountBanner
+		expectError bool
+	}{
+		{"empty", AccountBanner{}, false},
+		{
+			"ok",
+			AccountBanner{
+				Locale: "de",
+				Theme:  &BannerTheme{Background: "#fff", Button: "#0A0B0C"},
+				Texts:  map[string]BannerTexts{"en": {Body: "We count visits."}, "pt-BR": {Accept: "Sim"}},
+			},
+			false,
+		},
+		{"bad locale", AccountBanner{Locale: "german"}, true},
+		{"bad color", AccountBanner{Theme: &BannerTheme{Text: "red"}}, true},
+		{"bad texts locale", AccountBanner{Texts: map[string]BannerTexts{"EN": {}}}, true},
+		{"text too long", AccountBanner{Texts: map[string]BannerTexts{"en": {Body: strings.Repeat("x", 501)}}}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.banner.validate()
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+		})
+	}
+}
+
+func TestPersistenceLayer_SetAccountBanner(t *testing.T) {
+	tests := []struct {
+		name           string
+		db             *mockAccountDomainsDatabase
+		banner         *AccountBanner
+		expectError    bool
+		expectedBanner *AccountBanner
+	}{
+		{
+			"lookup error",
+			&mockAccountDomainsDatabase{
+				findAccountErr: ErrUnknownAccount("did not work"),
+			},
+			&AccountBanner{Locale: "en"},
+			true,
+			nil,
+		},
+		{
+			"invalid banner",
+			&mockAccountDomainsDatabase{},
+			&AccountBanner{Theme: &BannerTheme{Background: "blue"}},
+			true,
+			nil,
+		},
+		{
+			"update error",
+			&mockAccountDomainsDatabase{
+				updateErr: errors.New("did not work"),
+			},
+			&AccountBanner{Locale: "en"},
+			true,
+			&AccountBanner{Locale: "en"},
+		},
+		{
+			"ok",
+			&mockAccountDomainsDatabase{},
+			&AccountBanner{Locale: "fr", Texts: map[string]BannerTexts{"fr": {Deny: "Non"}}},
+			false,
+			&AccountBanner{Locale: "fr", Texts: map[string]BannerTexts{"fr": {Deny: "Non"}}},
+		},
+		{
+			"reset",
+			&mockAccountDomainsDatabase{
+				account: Account{Banner: `{"locale":"de"}`},
+			},
+			nil,
+			false,
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &persistenceLayer{dal: test.db}
+			err := p.SetAccountBanner("account-a", test.banner)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if test.db.updated == nil {
+				return
+			}
+			banner, _ := test.db.updated.banner()
+			if !reflect.DeepEqual(banner, test.expectedBanner) {
+				t.Errorf("Expected %v, got %v", test.expectedBanner, banner)
+			}
+		})
+	}
+}
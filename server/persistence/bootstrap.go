@@ -77,7 +77,7 @@ func (p *persistenceLayer) Bootstrap(config BootstrapConfig) error {
 		return fmt.Errorf("persistence: error applying initial migrations: %w", err)
 	}
 
-	accounts, accountUsers, relationships, err := bootstrapAccounts(&config)
+	accounts, accountUsers, relationships, err := bootstrapAccounts(&config, p.keypairs, p.userSalts)
 	if err != nil {
 		txn.Rollback()
 		return fmt.Errorf("persistence: error creating seed data: %w", err)
@@ -106,10 +106,10 @@ func (p *persistenceLayer) Bootstrap(config BootstrapConfig) error {
 	return nil
 }
 
-func bootstrapAccounts(config *BootstrapConfig) ([]Account, []AccountUser, []AccountUserRelationship, error) {
+func bootstrapAccounts(config *BootstrapConfig, keypairs keys.KeypairProvider, userSalts keys.UserSaltProvider) ([]Account, []AccountUser, []AccountUserRelationship, error) {
 	accountCreations := []accountCreation{}
 	for _, account := range config.Accounts {
-		record, encryptionKey, err := newAccount(account.Name, account.AccountID)
+		record, encryptionKey, err := newAccount(account.Name, account.AccountID, keypairs, userSalts)
 		if err != nil {
 			return nil, nil, nil, fmt.Errorf("persistence: error creating new account %s: %w", account.Name, err)
 		}
@@ -141,7 +141,7 @@ func bootstrapAccounts(config *BootstrapConfig) ([]Account, []AccountUser, []Acc
 				return nil, nil, nil, fmt.Errorf("account with id %s not found", accountID)
 			}
 
-			r, err := newAccountUserRelationship(accountUser.AccountUserID, accountID)
+			r, err := newAccountUserRelationship(accountUser.AccountUserID, accountID, roleForAdminLevel(accountUser.AdminLevel))
 			if err != nil {
 				return nil, nil, nil, fmt.Errorf("persistence: error creating account user relationship: %w", err)
 			}
@@ -203,7 +203,7 @@ func newAccountUser(email, password string, adminLevel interface{}) (*AccountUse
 	return a, nil
 }
 
-func newAccount(name, accountID string) (*Account, []byte, error) {
+func newAccount(name, accountID string, keypairs keys.KeypairProvider, userSalts keys.UserSaltProvider) (*Account, []byte, error) {
 	if name == "" {
 		return nil, nil, fmt.Errorf("persistence: cannot create an account with an empty name")
 	}
@@ -220,7 +220,7 @@ func newAccount(name, accountID string) (*Account, []byte, error) {
 		}
 	}
 
-	publicKey, privateKey, keyErr := keys.GenerateRSAKeypair(keys.RSAKeyLength)
+	publicKey, privateKey, keyErr := keypairs.GenerateKeypair()
 	if keyErr != nil {
 		return nil, nil, keyErr
 	}
@@ -234,7 +234,7 @@ func newAccount(name, accountID string) (*Account, []byte, error) {
 		return nil, nil, encryptedPrivateKeyErr
 	}
 
-	salt, saltErr := keys.NewFastSalt(keys.DefaultSecretLength)
+	salt, saltErr := userSalts.NewUserSalt()
 	if saltErr != nil {
 		return nil, nil, saltErr
 	}
@@ -244,13 +244,23 @@ func newAccount(name, accountID string) (*Account, []byte, error) {
 		Name:                name,
 		PublicKey:           string(publicKey),
 		EncryptedPrivateKey: encryptedPrivateKey.Marshal(),
+		KeyAlgorithm:        keypairs.Algorithm(),
 		UserSalt:            salt.Marshal(),
 		Retired:             false,
 		Created:             time.Now(),
 	}, encryptionKey, nil
 }
 
-func newAccountUserRelationship(accountUserID, accountID string) (*AccountUserRelationship, error) {
+// roleForAdminLevel returns the default role that is used when relating an
+// account user of the given admin level to an account.
+func roleForAdminLevel(level AccountUserAdminLevel) AccountUserRole {
+	if level == AccountUserAdminLevelSuperAdmin {
+		return AccountUserRoleAdmin
+	}
+	return AccountUserRoleViewer
+}
+
+func newAccountUserRelationship(accountUserID, accountID string, role AccountUserRole) (*AccountUserRelationship, error) {
 	randomID, err := uuid.NewV4()
 	if err != nil {
 		return nil, fmt.Errorf("persistence: error creating random id for relationship: %w", err)
@@ -259,5 +269,6 @@ func newAccountUserRelationship(accountUserID, accountID string) (*AccountUserRe
 		RelationshipID: randomID.String(),
 		AccountUserID:  accountUserID,
 		AccountID:      accountID,
+		Role:           role,
 	}, nil
 }
@@ -6,8 +6,26 @@ package persistence
 import (
 	"strings"
 	"testing"
+
+	"github.com/offen/offen/server/keys"
 )
 
+func newMockKeypairProvider(t *testing.T, algorithm string) keys.KeypairProvider {
+	provider, err := keys.NewKeypairProvider(algorithm, 2048)
+	if err != nil {
+		t.Fatalf("Unexpected error creating keypair provider: %v", err)
+	}
+	return provider
+}
+
+func newMockUserSaltProvider(t *testing.T) keys.UserSaltProvider {
+	provider, err := keys.NewUserSaltProvider(keys.UserIDHashSHA256, keys.Argon2Params{})
+	if err != nil {
+		t.Fatalf("Unexpected error creating user salt provider: %v", err)
+	}
+	return provider
+}
+
 type mockProbeDatabase struct {
 	DataAccessLayer
 	result bool
@@ -18,7 +36,7 @@ func (m *mockProbeDatabase) ProbeEmpty() bool {
 }
 
 func TestProbeEmpty(t *testing.T) {
-	p := persistenceLayer{&mockProbeDatabase{result: true}}
+	p := persistenceLayer{dal: &mockProbeDatabase{result: true}}
 	result := p.ProbeEmpty()
 	if result != true {
 		t.Errorf("Expected true, got %v", result)
@@ -49,7 +67,7 @@ func TestBootstrapAccounts(t *testing.T) {
 			},
 		},
 	}
-	accounts, accountUsers, relationships, err := bootstrapAccounts(&config)
+	accounts, accountUsers, relationships, err := bootstrapAccounts(&config, newMockKeypairProvider(t, keys.KeyAlgorithmRSAOAEP), newMockUserSaltProvider(t))
 
 	if err != nil {
 		t.Fatalf("Unexpected error %v", err)
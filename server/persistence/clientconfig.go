@@ -0,0 +1,36 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+)
+
+// GetClientConfig returns the account specific settings needed by the script
+// embedded on a site. Retired accounts are returned without a public key so
+// clients can stop collecting data.
+func (p *persistenceLayer) GetClientConfig(accountID string) (ClientConfigResult, error) {
+	account, err := p.reads().FindAccount(FindAccountQueryByID(accountID))
+	if err != nil {
+		return ClientConfigResult{}, fmt.Errorf("persistence: error looking up account: %w", err)
+	}
+	result := ClientConfigResult{
+		AccountID: account.AccountID,
+		Retired:   account.Retired,
+		RetiredAt: account.RetiredAt,
+	}
+	if account.Retired {
+		return result, nil
+	}
+	if result.Banner, err = account.banner(); err != nil {
+		return ClientConfigResult{}, err
+	}
+	key, err := account.WrapPublicKey()
+	if err != nil {
+		return ClientConfigResult{}, fmt.Errorf("persistence: error wrapping account public key: %w", err)
+	}
+	result.PublicKey = key
+	result.KeyAlgorithm = keyAlgorithmOrDefault(account.KeyAlgorithm)
+	return result, nil
+}
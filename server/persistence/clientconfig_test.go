@@ -0,0 +1,62 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/offen/offen/server/keys"
+)
+
+type mockGetClientConfigDatabase struct {
+	DataAccessLayer
+	account Account
+	err     error
+}
+
+func (m *mockGetClientConfigDatabase) FindAccount(interface{}) (Account, error) {
+	return m.account, m.err
+}
+
+func TestPersistenceLayer_GetClientConfig(t *testing.T) {
+	account, _, err := newAccount("config", "9b63c4d8-65c0-438c-9d30-cc4b01173393", newMockKeypairProvider(t, keys.KeyAlgorithmRSAOAEP), newMockUserSaltProvider(t))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	t.Run("database error", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockGetClientConfigDatabase{err: errors.New("did not work")}}
+		if _, err := p.GetClientConfig(account.AccountID); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockGetClientConfigDatabase{account: *account}}
+		result, err := p.GetClientConfig(account.AccountID)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if result.AccountID != account.AccountID || result.Retired {
+			t.Errorf("Unexpected result %v", result)
+		}
+		if result.PublicKey == nil || result.KeyAlgorithm != keys.KeyAlgorithmRSAOAEP {
+			t.Errorf("Expected public key to be returned, got %v", result)
+		}
+	})
+
+	t.Run("retired", func(t *testing.T) {
+		retired := *account
+		retired.Retired = true
+		p := &persistenceLayer{dal: &mockGetClientConfigDatabase{account: retired}}
+		result, err := p.GetClientConfig(account.AccountID)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if !result.Retired || result.PublicKey != nil {
+			t.Errorf("Expected retired account without public key, got %v", result)
+		}
+	})
+}
@@ -3,18 +3,30 @@
 
 package persistence
 
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
 // DataAccessLayer provides a database agnostic interface for storing data. All
 // query methods expect certain types to be passed. In case a unknown query is
 // passed, an error can be returned early.
 type DataAccessLayer interface {
 	CreateEvent(*Event) error
+	CreateEvents([]*Event) error
 	FindEvents(interface{}) ([]Event, error)
+	StreamEvents(q interface{}, fn func([]Event) error) error
+	CountEvents(interface{}) ([]EventCount, error)
+	UpdateEvents(interface{}) (int64, error)
 	DeleteEvents(interface{}) (int64, error)
 	CreateSecret(*Secret) error
 	FindSecret(interface{}) (Secret, error)
 	DeleteSecret(interface{}) error
+	DeleteSecrets(interface{}) (int64, error)
 	CreateAccount(*Account) error
 	UpdateAccount(*Account) error
+	UpdateAccounts(interface{}) (int64, error)
 	FindAccount(interface{}) (Account, error)
 	FindAccounts(interface{}) ([]Account, error)
 	CreateAccountUser(*AccountUser) error
@@ -27,7 +39,30 @@ type DataAccessLayer interface {
 	DeleteAccountUserRelationships(interface{}) error
 	CreateTombstone(*Tombstone) error
 	FindTombstones(interface{}) ([]Tombstone, error)
+	CreateWebAuthnCredential(*WebAuthnCredential) error
+	FindWebAuthnCredentials(interface{}) ([]WebAuthnCredential, error)
+	UpdateWebAuthnCredential(*WebAuthnCredential) error
+	CreateSession(*Session) error
+	FindSessions(interface{}) ([]Session, error)
+	UpdateSession(*Session) error
+	DeleteSessions(interface{}) (int64, error)
+	CreateAPIToken(*APIToken) error
+	FindAPITokens(interface{}) ([]APIToken, error)
+	UpdateAPIToken(*APIToken) error
+	DeleteAPITokens(interface{}) (int64, error)
+	AcquireJobLock(lock *JobLock, now time.Time) (bool, error)
+	FindSyncState(interface{}) (SyncState, error)
+	UpdateSyncState(*SyncState) error
+	FindMaintenanceState() (MaintenanceState, error)
+	UpdateMaintenanceState(*MaintenanceState) error
+	CreateAuditEntry(*AuditEntry) error
+	FindPurgeJob(interface{}) (PurgeJob, error)
+	UpdatePurgeJob(*PurgeJob) error
+	DeletePurgeJobs(interface{}) (int64, error)
+	FindAuditEntries(interface{}) ([]AuditEntry, error)
 	Transaction() (Transaction, error)
+	Backup(w io.Writer) error
+	Restore(r io.Reader) error
 	ApplyMigrations() error
 	DropAll() error
 	ProbeEmpty() bool
@@ -42,6 +77,22 @@ type FindEventsQueryForSecretIDs struct {
 	Since     string
 }
 
+// StreamEventsQueryForSecretIDs streams all events that match the list of
+// secret identifiers and have a sequence greater than Since and less than or
+// equal to Until. Zero values are ignored. Events are ordered by account id.
+type StreamEventsQueryForSecretIDs struct {
+	SecretIDs []string
+	Since     string
+	Until     string
+}
+
+// StreamEventsQueryByAccountID streams all events of the given account that
+// have an id greater than Since, including their secrets.
+type StreamEventsQueryByAccountID struct {
+	AccountID string
+	Since     string
+}
+
 // FindEventsQueryByEventIDs requests all events that match the given list of
 // identifiers.
 type FindEventsQueryByEventIDs []string
@@ -49,6 +100,83 @@ type FindEventsQueryByEventIDs []string
 // FindEventsQueryOlderThan looks up all events older than the given event id
 type FindEventsQueryOlderThan string
 
+// FindEventsQueryOlderThanLimit requests up to Limit events older than the
+// given event id, ordered by their id.
+type FindEventsQueryOlderThanLimit struct {
+	EventID string
+	Limit   int
+}
+
+// FindEventsQueryByAccountIDOlderThan looks up all events of the given
+// account that are older than the given event id
+type FindEventsQueryByAccountIDOlderThan struct {
+	AccountID string
+	EventID   string
+}
+
+// CountEventsQueryByAccountID requests a single count of all events of the
+// account of the given id.
+type CountEventsQueryByAccountID string
+
+// CountEventsQueryByAccountIDSince requests a single count of all events of
+// the account of the given id that have an id greater than or equal to Since.
+type CountEventsQueryByAccountIDSince struct {
+	AccountID string
+	Since     string
+}
+
+// CountEventsQueryByAccountIDOlderThan requests a single count of all events
+// of the given account that have an id less than the given one.
+type CountEventsQueryByAccountIDOlderThan struct {
+	AccountID string
+	EventID   string
+}
+
+// CountEventsQueryForSecretIDs requests a single count of all events that
+// match the list of secret identifiers. In case Since is non-zero, only events
+// with a greater sequence are counted.
+type CountEventsQueryForSecretIDs struct {
+	SecretIDs []string
+	Since     string
+}
+
+// CountEventsQueryByAccountIDInBuckets requests counts of the events of the
+// given account grouped into buckets. Bucket i contains all events with an id
+// greater than or equal to Boundaries[i] and less than Boundaries[i+1].
+// Buckets without any events are omitted.
+type CountEventsQueryByAccountIDInBuckets struct {
+	AccountID  string
+	Boundaries []string
+}
+
+// FindEventsQueryMetadataBySecretID requests up to Limit events of the given
+// secret, ordered by their id. Payloads are not expected to be populated.
+type FindEventsQueryMetadataBySecretID struct {
+	SecretID string
+	Limit    int
+}
+
+// FindEventsQueryInRange requests up to Limit events with a sequence greater
+// than Since and less than or equal to Until, ordered by their sequence. A
+// Limit of 0 requests all matching events. The events' secrets are expected
+// to be populated.
+type FindEventsQueryInRange struct {
+	Since string
+	Until string
+	Limit int
+}
+
+// UpdateEventsQueryReassignSecret requests the events of SecretID that are
+// contained in EventIDs to be moved to NewSecretID using the given sequence.
+// EventIDs maps the ids of the affected events to the ids they will be
+// stored under from now on.
+type UpdateEventsQueryReassignSecret struct {
+	SecretID    string
+	NewSecretID string
+	Sequence    string
+	EventIDs    map[string]string
+}
+
 // DeleteEventsQueryBySecretIDs requests deletion of all events that match
 // the given identifiers.
 type DeleteEventsQueryBySecretIDs []string
@@ -61,10 +189,24 @@ type DeleteEventsQueryByEventIDs []string
 // given deadline
 type DeleteEventsQueryOlderThan string
 
+// DeleteEventsQueryByAccountIDOlderThan requests deletion of all events of
+// the given account that are older than the given deadline
+type DeleteEventsQueryByAccountIDOlderThan struct {
+	AccountID string
+	EventID   string
+}
+
 // DeleteSecretQueryBySecretID requests deletion of the secret record with the given
 // secret id.
 type DeleteSecretQueryBySecretID string
 
+// DeleteSecretsQueryOrphaned requests deletion of all secrets that are not
+// referenced by any event anymore and have been created before the given
+// time. Secrets without a creation time are considered to be old enough.
+type DeleteSecretsQueryOrphaned struct {
+	CreatedBefore time.Time
+}
+
 // FindSecretQueryBySecretID requests the secret of the given ID
 type FindSecretQueryBySecretID string
 
@@ -82,6 +224,13 @@ type FindAccountQueryIncludeEvents struct {
 	Since     string
 }
 
+// UpdateAccountsQueryLastEvent requests the time of the last event to be
+// set for all of the given accounts where the stored value is older.
+type UpdateAccountsQueryLastEvent struct {
+	AccountIDs  []string
+	LastEventAt time.Time
+}
+
 // FindAccountsQueryAllAccounts requests all known accounts to be returned.
 type FindAccountsQueryAllAccounts struct{}
 
@@ -120,6 +269,73 @@ type FindTombstonesQueryBySecrets struct {
 	SecretIDs []string
 }
 
+// FindTombstonesQueryInRange requests all tombstones with a sequence greater
+// than Since and less than or equal to Until
+type FindTombstonesQueryInRange struct {
+	Since string
+	Until string
+}
+
+// FindWebAuthnCredentialsQueryByAccountUserID requests all WebAuthn credentials
+// registered by the account user of the given id.
+type FindWebAuthnCredentialsQueryByAccountUserID string
+
+// FindWebAuthnCredentialsQueryByCredentialID requests the WebAuthn credential
+// of the given id.
+type FindWebAuthnCredentialsQueryByCredentialID string
+
+// FindSessionsQueryBySessionID requests the session of the given id.
+type FindSessionsQueryBySessionID string
+
+// FindSessionsQueryByAccountUserID requests all sessions of the account user
+// with the given id.
+type FindSessionsQueryByAccountUserID string
+
+// DeleteSessionsQueryBySessionID requests deletion of the session of the
+// given id.
+type DeleteSessionsQueryBySessionID string
+
+// DeleteSessionsQueryByAccountUserID requests deletion of all sessions of the
+// account user with the given id.
+type DeleteSessionsQueryByAccountUserID string
+
+// DeleteSessionsQueryExpired requests deletion of all sessions that have
+// expired before the given time.
+type DeleteSessionsQueryExpired time.Time
+
+// FindAPITokensQueryByTokenID requests the API token of the given id.
+type FindAPITokensQueryByTokenID string
+
+// FindAPITokensQueryByAccountUserID requests all API tokens created by the
+// account user with the given id.
+type FindAPITokensQueryByAccountUserID string
+
+// DeleteAPITokensQueryByTokenID requests deletion of the API token of the
+// given id.
+type DeleteAPITokensQueryByTokenID string
+
+// FindAuditEntriesQueryFiltered requests the newest audit entries matching
+// all of the given non-zero values, returning at most Limit entries.
+type FindAuditEntriesQueryFiltered struct {
+	AccountID string
+	ActorID   string
+	Action    string
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+}
+
+// FindSyncStateQueryByPrimary requests the sync state recorded for the
+// primary instance of the given URL.
+type FindSyncStateQueryByPrimary string
+
+// FindPurgeJobQueryByID requests the purge job of the given id.
+type FindPurgeJobQueryByID string
+
+// DeletePurgeJobsQueryOlderThan deletes all purge jobs that have been created
+// before the given time.
+type DeletePurgeJobsQueryOlderThan time.Time
+
 // Transaction is a data access layer that does not persist data until commit
 // is called. In case rollback is called before, the underlying database will
 // remain in the same state as before.
@@ -128,3 +344,28 @@ type Transaction interface {
 	Rollback() error
 	Commit() error
 }
+
+// WithTransaction calls fn using a transaction of the given data access
+// layer. The transaction is committed in case fn returns nil and rolled back
+// in case fn returns an error or panics, so multiple steps can be composed
+// atomically without handling the transaction manually.
+func WithTransaction(dal DataAccessLayer, fn func(tx DataAccessLayer) error) error {
+	txn, err := dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			txn.Rollback()
+		}
+	}()
+	if err := fn(txn); err != nil {
+		return err
+	}
+	committed = true
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+)
+
+type mockRecordingTxn struct {
+	DataAccessLayer
+	committed  bool
+	rolledBack bool
+	commitErr  error
+}
+
+func (m *mockRecordingTxn) Commit() error {
+	m.committed = true
+	return m.commitErr
+}
+
+func (m *mockRecordingTxn) Rollback() error {
+	m.rolledBack = true
+	return nil
+}
+
+type mockWithTransactionDatabase struct {
+	DataAccessLayer
+	txn    *mockRecordingTxn
+	txnErr error
+}
+
+func (m *mockWithTransactionDatabase) Transaction() (Transaction, error) {
+	if m.txnErr != nil {
+		return nil, m.txnErr
+	}
+	return m.txn, nil
+}
+
+func TestWithTransaction(t *testing.T) {
+	tests := []struct {
+		name             string
+		dal              *mockWithTransactionDatabase
+		fn               func(DataAccessLayer) error
+		expectError      bool
+		expectCommitted  bool
+		expectRolledBack bool
+	}{
+		{
+			"ok",
+			&mockWithTransactionDatabase{txn: &mockRecordingTxn{}},
+			func(DataAccessLayer) error { return nil },
+			false,
+			true,
+			false,
+		},
+		{
+			"error creating transaction",
+			&mockWithTransactionDatabase{txn: &mockRecordingTxn{}, txnErr: errors.New("did not work")},
+			func(DataAccessLayer) error { return nil },
+			true,
+			false,
+			false,
+		},
+		{
+			"error in function",
+			&mockWithTransactionDatabase{txn: &mockRecordingTxn{}},
+			func(DataAccessLayer) error { return errors.New("did not work") },
+			true,
+			false,
+			true,
+		},
+		{
+			"error committing",
+			&mockWithTransactionDatabase{txn: &mockRecordingTxn{commitErr: errors.New("did not work")}},
+			func(DataAccessLayer) error { return nil },
+			true,
+			true,
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := WithTransaction(test.dal, test.fn)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if test.dal.txn.committed != test.expectCommitted {
+				t.Errorf("Expected committed to be %v", test.expectCommitted)
+			}
+			if test.dal.txn.rolledBack != test.expectRolledBack {
+				t.Errorf("Expected rolled back to be %v", test.expectRolledBack)
+			}
+		})
+	}
+}
+
+func TestWithTransaction_Panic(t *testing.T) {
+	dal := &mockWithTransactionDatabase{txn: &mockRecordingTxn{}}
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic to be propagated")
+		}
+		if !dal.txn.rolledBack || dal.txn.committed {
+			t.Error("Expected transaction to be rolled back")
+		}
+	}()
+	WithTransaction(dal, func(DataAccessLayer) error {
+		panic("did not work")
+	})
+}
@@ -0,0 +1,218 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/offen/offen/server/domainverify"
+	"github.com/offen/offen/server/keys"
+)
+
+// maxAccountDomains is the maximum number of domains that can be stored for
+// a single account.
+const maxAccountDomains = 20
+
+// AccountDomain is a domain an account is expected to receive events from.
+// Only domains that have been verified using their token are enforced.
+type AccountDomain struct {
+	Domain   string     `json:"domain"`
+	Token    string     `json:"token"`
+	Verified *time.Time `json:"verified,omitempty"`
+}
+
+// ErrNoDomainVerifier is returned when trying to verify a domain without
+// having configured a verifier.
+var ErrNoDomainVerifier = errors.New("persistence: no domain verifier configured")
+
+// WithDomainVerifier configures the persistence layer to use the given
+// verifier for checking that the domains of accounts are controlled by their
+// operators.
+func WithDomainVerifier(v domainverify.Verifier) Config {
+	return func(p *persistenceLayer) {
+		p.domainVerifier = v
+	}
+}
+
+func newDomainToken() (string, error) {
+	token, err := keys.GenerateRandomValueWith(16, base64.RawURLEncoding)
+	if err != nil {
+		return "", fmt.Errorf("persistence: error creating domain verification token: %w", err)
+	}
+	return token, nil
+}
+
+var domainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)*[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// normalizeDomain lowercases the given domain and validates it is a valid
+// hostname. In case a URL is given, its hostname is used.
+func normalizeDomain(domain string) (string, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if strings.Contains(domain, "://") {
+		u, err := url.Parse(domain)
+		if err != nil {
+			return "", ErrInvalidDomain(fmt.Sprintf("persistence: error parsing domain %s: %v", domain, err))
+		}
+		domain = u.Hostname()
+	}
+	domain = strings.TrimSuffix(domain, ".")
+	if len(domain) > 253 || !domainPattern.MatchString(domain) {
+		return "", ErrInvalidDomain(fmt.Sprintf("persistence: %s is not a valid domain", domain))
+	}
+	return domain, nil
+}
+
+func (a *Account) domains() ([]AccountDomain, error) {
+	if a.Domains == "" {
+		return nil, nil
+	}
+	var result []AccountDomain
+	if err := json.Unmarshal([]byte(a.Domains), &result); err != nil {
+		return nil, fmt.Errorf("persistence: error decoding domains: %w", err)
+	}
+	return result, nil
+}
+
+func (a *Account) setDomains(domains []AccountDomain) error {
+	if len(domains) == 0 {
+		a.Domains = ""
+		return nil
+	}
+	b, err := json.Marshal(domains)
+	if err != nil {
+		return fmt.Errorf("persistence: error encoding domains: %w", err)
+	}
+	a.Domains = string(b)
+	return nil
+}
+
+// SetAccountDomains replaces the domains of the account with the given id.
+// Passing no domains disables checking the origin of events for the account.
+// Domains that are already stored keep their token and verification status,
+// new domains need to be verified before they are enforced.
+func (p *persistenceLayer) SetAccountDomains(accountID string, domains []string) error {
+	if len(domains) > maxAccountDomains {
+		return ErrInvalidDomain(fmt.Sprintf("persistence: cannot store more than %d domains per account", maxAccountDomains))
+	}
+	var normalizedDomains []string
+	seen := map[string]bool{}
+	for _, domain := range domains {
+		normalized, err := normalizeDomain(domain)
+		if err != nil {
+			return err
+		}
+		if seen[normalized] {
+			continue
+		}
+		seen[normalized] = true
+		normalizedDomains = append(normalizedDomains, normalized)
+	}
+
+	account, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account %s: %w", accountID, err)
+	}
+	existing, err := account.domains()
+	if err != nil {
+		return err
+	}
+	existingByDomain := map[string]AccountDomain{}
+	for _, domain := range existing {
+		existingByDomain[domain.Domain] = domain
+	}
+	var result []AccountDomain
+	for _, domain := range normalizedDomains {
+		if match, ok := existingByDomain[domain]; ok {
+			result = append(result, match)
+			continue
+		}
+		token, err := newDomainToken()
+		if err != nil {
+			return err
+		}
+		result = append(result, AccountDomain{Domain: domain, Token: token})
+	}
+	if err := account.setDomains(result); err != nil {
+		return err
+	}
+	if err := p.dal.UpdateAccount(&account); err != nil {
+		return fmt.Errorf("persistence: error updating domains of account %s: %w", accountID, err)
+	}
+	p.publishAccountChange(AccountChange{AccountID: accountID, Reason: AccountChangeDomains})
+	return nil
+}
+
+// VerifyAccountDomain checks whether the token of the given domain has been
+// published for the domain and marks it as verified in this case.
+func (p *persistenceLayer) VerifyAccountDomain(accountID, domain string) error {
+	if p.domainVerifier == nil {
+		return ErrNoDomainVerifier
+	}
+	account, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account %s: %w", accountID, err)
+	}
+	domains, err := account.domains()
+	if err != nil {
+		return err
+	}
+	normalized, err := normalizeDomain(domain)
+	if err != nil {
+		return err
+	}
+	index := -1
+	for i, d := range domains {
+		if d.Domain == normalized {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		return ErrInvalidDomain(fmt.Sprintf("persistence: domain %s is not registered for account %s", normalized, accountID))
+	}
+	if domains[index].Verified != nil {
+		return nil
+	}
+	if err := p.domainVerifier.Verify(normalized, domains[index].Token); err != nil {
+		return fmt.Errorf("persistence: error verifying domain %s: %w", normalized, err)
+	}
+	now := time.Now().UTC()
+	domains[index].Verified = &now
+	if err := account.setDomains(domains); err != nil {
+		return err
+	}
+	if err := p.dal.UpdateAccount(&account); err != nil {
+		return fmt.Errorf("persistence: error updating domains of account %s: %w", accountID, err)
+	}
+	p.publishAccountChange(AccountChange{AccountID: accountID, Reason: AccountChangeDomains})
+	return nil
+}
+
+// LookupAccountDomains returns the verified domains the account of the given
+// id is expected to receive events from. In case no domains are returned,
+// events from any origin are to be accepted.
+func (p *persistenceLayer) LookupAccountDomains(accountID string) ([]string, error) {
+	account, err := p.findActiveAccount(accountID)
+	if err != nil {
+		return nil, err
+	}
+	domains, err := account.domains()
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, domain := range domains {
+		if domain.Verified != nil {
+			result = append(result, domain.Domain)
+		}
+	}
+	return result, nil
+}
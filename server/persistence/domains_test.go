@@ -0,0 +1,273 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		name           string
+		domain         string
+		expectedResult string
+		expectError    bool
+	}{
+		{"plain", "www.example.com", "www.example.com", false},
+		{"uppercase", " Example.COM. ", "example.com", false},
+		{"url", "https://example.com:8080/path", "example.com", false},
+		{"localhost", "localhost", "localhost", false},
+		{"empty", "", "", true},
+		{"path", "example.com/path", "", true},
+		{"bad label", "-example.com", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := normalizeDomain(test.domain)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if result != test.expectedResult {
+				t.Errorf("Expected %s, got %s", test.expectedResult, result)
+			}
+		})
+	}
+}
+
+type mockAccountDomainsDatabase struct {
+	DataAccessLayer
+	account        Account
+	findAccountErr error
+	updateErr      error
+	updated        *Account
+}
+
+func (m *mockAccountDomainsDatabase) FindAccount(interface{}) (Account, error) {
+	return m.account, m.findAccountErr
+}
+
+func (m *mockAccountDomainsDatabase) UpdateAccount(a *Account) error {
+	m.updated = a
+	return m.updateErr
+}
+
+func TestPersistenceLayer_SetAccountDomains(t *testing.T) {
+	tests := []struct {
+		name            string
+		db              *mockAccountDomainsDatabase
+		domains         []string
+		expectError     bool
+		expectedDomains []string
+	}{
+		{
+			"lookup error",
+			&mockAccountDomainsDatabase{
+				findAccountErr: ErrUnknownAccount("did not work"),
+			},
+			[]string{"example.com"},
+			true,
+			nil,
+		},
+		{
+			"invalid domain",
+			&mockAccountDomainsDatabase{},
+			[]string{"example.com", "not a domain"},
+			true,
+			nil,
+		},
+		{
+			"update error",
+			&mockAccountDomainsDatabase{
+				updateErr: errors.New("did not work"),
+			},
+			[]string{"example.com"},
+			true,
+			[]string{"example.com"},
+		},
+		{
+			"ok",
+			&mockAccountDomainsDatabase{},
+			[]string{"example.com", "www.example.net", "EXAMPLE.com"},
+			false,
+			[]string{"example.com", "www.example.net"},
+		},
+		{
+			"reset",
+			&mockAccountDomainsDatabase{
+				account: Account{Domains: `[{"domain":"example.com","token":"token"}]`},
+			},
+			nil,
+			false,
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &persistenceLayer{dal: test.db}
+			err := p.SetAccountDomains("account-a", test.domains)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if test.db.updated == nil {
+				return
+			}
+			domains, _ := test.db.updated.domains()
+			var names []string
+			for _, domain := range domains {
+				names = append(names, domain.Domain)
+				if domain.Token == "" {
+					t.Errorf("Expected token for domain %s", domain.Domain)
+				}
+			}
+			if !reflect.DeepEqual(names, test.expectedDomains) {
+				t.Errorf("Unexpected domains %v", names)
+			}
+		})
+	}
+	t.Run("keeps verification", func(t *testing.T) {
+		db := &mockAccountDomainsDatabase{
+			account: Account{Domains: `[{"domain":"example.com","token":"token","verified":"2021-03-14T12:00:00Z"}]`},
+		}
+		p := &persistenceLayer{dal: db}
+		if err := p.SetAccountDomains("account-a", []string{"example.net", "example.com"}); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		domains, _ := db.updated.domains()
+		if len(domains) != 2 || domains[1].Token != "token" || domains[1].Verified == nil || domains[0].Verified != nil {
+			t.Errorf("Unexpected domains %v", db.updated.Domains)
+		}
+	})
+}
+
+type mockVerifier struct {
+	err   error
+	calls int
+}
+
+func (m *mockVerifier) Verify(domain, token string) error {
+	m.calls++
+	return m.err
+}
+
+func TestPersistenceLayer_VerifyAccountDomain(t *testing.T) {
+	tests := []struct {
+		name            string
+		db              *mockAccountDomainsDatabase
+		verifier        *mockVerifier
+		domain          string
+		expectError     bool
+		expectVerified  bool
+		expectedLookups int
+	}{
+		{
+			"no verifier",
+			&mockAccountDomainsDatabase{},
+			nil,
+			"example.com",
+			true,
+			false,
+			0,
+		},
+		{
+			"unknown domain",
+			&mockAccountDomainsDatabase{
+				account: Account{Domains: `[{"domain":"example.com","token":"token"}]`},
+			},
+			&mockVerifier{},
+			"example.net",
+			true,
+			false,
+			0,
+		},
+		{
+			"verification error",
+			&mockAccountDomainsDatabase{
+				account: Account{Domains: `[{"domain":"example.com","token":"token"}]`},
+			},
+			&mockVerifier{err: errors.New("did not work")},
+			"example.com",
+			true,
+			false,
+			1,
+		},
+		{
+			"ok",
+			&mockAccountDomainsDatabase{
+				account: Account{Domains: `[{"domain":"example.com","token":"token"}]`},
+			},
+			&mockVerifier{},
+			"Example.com",
+			false,
+			true,
+			1,
+		},
+		{
+			"already verified",
+			&mockAccountDomainsDatabase{
+				account: Account{Domains: `[{"domain":"example.com","token":"token","verified":"2021-03-14T12:00:00Z"}]`},
+			},
+			&mockVerifier{},
+			"example.com",
+			false,
+			false,
+			0,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &persistenceLayer{dal: test.db}
+			if test.verifier != nil {
+				WithDomainVerifier(test.verifier)(p)
+			}
+			err := p.VerifyAccountDomain("account-a", test.domain)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if (test.db.updated != nil) != test.expectVerified {
+				t.Errorf("Unexpected update %v", test.db.updated)
+			}
+			if test.verifier != nil && test.verifier.calls != test.expectedLookups {
+				t.Errorf("Unexpected number of verifications %d", test.verifier.calls)
+			}
+		})
+	}
+}
+
+type mockLookupAccountDomainsDatabase struct {
+	DataAccessLayer
+	account Account
+	err     error
+}
+
+func (m *mockLookupAccountDomainsDatabase) FindAccount(interface{}) (Account, error) {
+	return m.account, m.err
+}
+
+func TestPersistenceLayer_LookupAccountDomains(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockLookupAccountDomainsDatabase{
+			account: Account{
+				AccountID: "account-a",
+				Domains:   `[{"domain":"example.com","token":"a","verified":"2021-03-14T12:00:00Z"},{"domain":"example.net","token":"b"}]`,
+			},
+		}}
+		result, err := p.LookupAccountDomains("account-a")
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(result, []string{"example.com"}) {
+			t.Errorf("Unexpected result %v", result)
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockLookupAccountDomainsDatabase{
+			err: ErrUnknownAccount("did not work"),
+		}}
+		if _, err := p.LookupAccountDomains("account-a"); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+}
@@ -25,6 +25,18 @@ type Event struct {
 	Secret   Secret
 }
 
+// EventCount contains the number of events in a bucket of events and values
+// aggregated from their metadata.
+type EventCount struct {
+	Bucket         int
+	Events         int64
+	DistinctUsers  int64
+	PayloadBytes   int64
+	OldestEventID  string
+	NewestEventID  string
+	NewestSequence string
+}
+
 // A Tombstone replaces an event on its deletion
 type Tombstone struct {
 	EventID   string
@@ -39,6 +51,7 @@ type Tombstone struct {
 type Secret struct {
 	SecretID        string
 	EncryptedSecret string
+	Created         time.Time
 }
 
 // AccountUserAdminLevel is used to describe the privileges granted to an account
@@ -51,6 +64,18 @@ const (
 	AccountUserAdminLevelSuperAdmin AccountUserAdminLevel = 1
 )
 
+// AccountUserRole is used to describe the privileges an account user is
+// granted for a single account it has access to.
+type AccountUserRole int
+
+// An AccountUserRoleAdmin is allowed to manage the account it has been granted
+// access to, i.e. share it with others. An AccountUserRoleViewer can only read
+// the account's data.
+const (
+	AccountUserRoleAdmin  AccountUserRole = 1
+	AccountUserRoleViewer AccountUserRole = 2
+)
+
 // AccountUser is a person that can log in and access data related to all
 // associated accounts.
 type AccountUser struct {
@@ -59,7 +84,17 @@ type AccountUser struct {
 	HashedPassword string
 	Salt           string
 	AdminLevel     AccountUserAdminLevel
-	Relationships  []AccountUserRelationship
+	// the hashed one time key is set when a password reset is requested
+	// and cleared again once it has been used
+	HashedOneTimeKey string
+	// the TOTP secret is set once the account user has enrolled
+	// two factor authentication. It is encrypted using the instance's key.
+	TOTPSecret string
+	// TOTPLastStep is the time step of the last TOTP code that has been
+	// used, so codes cannot be used more than once
+	TOTPLastStep        int64
+	HashedRecoveryCodes string
+	Relationships       []AccountUserRelationship
 }
 
 // AccountUserRelationship contains the encrypted KeyEncryptionKeys needed for
@@ -68,6 +103,7 @@ type AccountUserRelationship struct {
 	RelationshipID                    string
 	AccountUserID                     string
 	AccountID                         string
+	Role                              AccountUserRole
 	PasswordEncryptedKeyEncryptionKey string
 	EmailEncryptedKeyEncryptionKey    string
 	OneTimeEncryptedKeyEncryptionKey  string
@@ -158,16 +194,62 @@ type Account struct {
 	Name                string
 	PublicKey           string
 	EncryptedPrivateKey string
-	UserSalt            string
-	Retired             bool
-	Created             time.Time
-	Events              []Event
+	// the key algorithm is empty for accounts created before algorithms
+	// were configurable, which all use keys.KeyAlgorithmRSAOAEP
+	KeyAlgorithm string
+	UserSalt     string
+	// the previous user salt is set after rotating the user salt until
+	// the data of all users has been migrated
+	PreviousUserSalt string
+	Retired          bool
+	Created          time.Time
+	RetiredAt        *time.Time
+	// the time of the last event is updated with a resolution of
+	// lastEventResolution
+	LastEventAt *time.Time
+	Retention   time.Duration
+	// the event quota overrides the instance's default quota in case it
+	// is positive
+	EventQuota int
+	// the domains the account is expected to receive events from are
+	// stored as a JSON encoded list
+	Domains string
+	// the banner customization is stored as a JSON encoded object
+	Banner string
+	// the settings are encrypted by the client, so their content is
+	// never known to the server
+	EncryptedSettings string
+	Events            []Event
+	DeprecatedKeys    []DeprecatedAccountKey
+}
+
+// A DeprecatedAccountKey is a key pair of an account that has been replaced
+// when rotating the account's keys. It is kept so that user secrets that have
+// been encrypted using its public key can still be decrypted.
+type DeprecatedAccountKey struct {
+	KeyID               string
+	AccountID           string
+	PublicKey           string
+	EncryptedPrivateKey string
+	KeyAlgorithm        string
+	Deprecated          time.Time
 }
 
 // HashUserID uses the account's `UserSalt` to create a hashed version of a
-// user identifier that is unique per account.
-func (a *Account) HashUserID(userID string) (string, error) {
-	result, err := keys.HashFast(userID, a.UserSalt)
+// user identifier that is unique per account. The pepper is only used in case
+// the salt has been created using a peppered provider.
+func (a *Account) HashUserID(userID string, pepper []byte) (string, error) {
+	result, err := keys.HashFastWithPepper(userID, a.UserSalt, pepper)
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// hashUserIDWithPreviousSalt hashes the given user identifier using the
+// account's `PreviousUserSalt`.
+func (a *Account) hashUserIDWithPreviousSalt(userID string, pepper []byte) (string, error) {
+	result, err := keys.HashFastWithPepper(userID, a.PreviousUserSalt, pepper)
 	if err != nil {
 		return "", err
 	}
@@ -177,7 +259,26 @@ func (a *Account) HashUserID(userID string) (string, error) {
 // WrapPublicKey returns the public key of an account's keypair in
 // JSON WebKey format.
 func (a *Account) WrapPublicKey() (jwk.Key, error) {
-	s, err := jwk.ParseString(a.PublicKey)
+	return wrapPublicKey(a.PublicKey)
+}
+
+// WrapPublicKey returns the public key of the deprecated keypair in
+// JSON WebKey format.
+func (k *DeprecatedAccountKey) WrapPublicKey() (jwk.Key, error) {
+	return wrapPublicKey(k.PublicKey)
+}
+
+// keyAlgorithmOrDefault returns the given key algorithm, falling back to
+// the algorithm of legacy key pairs if it is empty.
+func keyAlgorithmOrDefault(algorithm string) string {
+	if algorithm == "" {
+		return keys.KeyAlgorithmRSAOAEP
+	}
+	return algorithm
+}
+
+func wrapPublicKey(publicKey string) (jwk.Key, error) {
+	s, err := jwk.ParseString(publicKey)
 	if err != nil {
 		return nil, errors.New("persistence: failed decoding stored key value")
 	}
@@ -187,3 +288,103 @@ func (a *Account) WrapPublicKey() (jwk.Key, error) {
 	}
 	return key, nil
 }
+
+// WebAuthnCredential is a public key credential an account user can use for
+// logging in instead of using a password.
+type WebAuthnCredential struct {
+	CredentialID  string
+	AccountUserID string
+	PublicKey     string
+	SignCount     int64
+	// WrappedKeys contains the key encryption keys of the account user,
+	// encrypted by the client using a secret that is bound to the credential.
+	// The server has no way of accessing its content.
+	WrappedKeys string
+	Created     time.Time
+}
+
+// Session is a login of an account user. Sessions are persisted so they
+// can be revoked before they expire.
+type Session struct {
+	SessionID     string
+	AccountUserID string
+	UserAgent     string
+	Created       time.Time
+	LastSeen      time.Time
+	Expires       time.Time
+}
+
+// AuditEntry records a privileged action that has been performed by an
+// account user.
+type AuditEntry struct {
+	EntryID   string
+	Action    string
+	ActorID   string
+	AccountID string
+	RequestID string
+	Created   time.Time
+}
+
+// APITokenScope is a capability that is granted to an API token.
+type APITokenScope string
+
+// APITokenScopeReadEvents allows reading the (encrypted) events of an account,
+// APITokenScopeReadStats allows reading statistics derived from unencrypted
+// metadata and APITokenScopeManageAccount allows performing administrative
+// tasks in case the account user owning the token is allowed to do so.
+const (
+	APITokenScopeReadEvents    APITokenScope = "events:read"
+	APITokenScopeReadStats     APITokenScope = "stats:read"
+	APITokenScopeManageAccount APITokenScope = "account:manage"
+)
+
+// APITokenScopes contains all known scopes
+var APITokenScopes = []APITokenScope{
+	APITokenScopeReadEvents,
+	APITokenScopeReadStats,
+	APITokenScopeManageAccount,
+}
+
+// APIToken grants programmatic access to a set of accounts on behalf of the
+// account user that created it. Only a hash of the token's secret is stored.
+type APIToken struct {
+	TokenID       string
+	AccountUserID string
+	Name          string
+	HashedSecret  string
+	AccountIDs    []string
+	Scopes        []APITokenScope
+	Created       time.Time
+	LastUsed      time.Time
+}
+
+// JobLock is held by the server instance that is currently in charge of
+// running a background job.
+type JobLock struct {
+	Name    string
+	Holder  string
+	Expires time.Time
+}
+
+// SyncState records up to which watermark a replica has pulled changes from
+// its primary instance.
+type SyncState struct {
+	PrimaryURL string
+	Watermark  string
+	Updated    time.Time
+}
+
+// MaintenanceState records whether the instance has been put into read-only
+// mode for maintenance.
+type MaintenanceState struct {
+	ReadOnly bool
+	Updated  time.Time
+}
+
+// PurgeJob records the status of a purge that is running in the background.
+type PurgeJob struct {
+	PurgeID string
+	Status  string
+	Created time.Time
+	Updated time.Time
+}
@@ -10,8 +10,8 @@ func TestAccount_HashUserID(t *testing.T) {
 		account := Account{
 			UserSalt: "{1,} b2tpZG9raQ==",
 		}
-		one, _ := account.HashUserID("user-one")
-		two, _ := account.HashUserID("user-two")
+		one, _ := account.HashUserID("user-one", nil)
+		two, _ := account.HashUserID("user-two", nil)
 
 		if one == "" {
 			t.Error("Unexpected empty string")
@@ -26,12 +26,28 @@ func TestAccount_HashUserID(t *testing.T) {
 		otherAccount := Account{
 			UserSalt: "other-salt-value",
 		}
-		otherOne, _ := otherAccount.HashUserID("user-one")
+		otherOne, _ := otherAccount.HashUserID("user-one", nil)
 
 		if one == otherOne {
 			t.Error("Expected different values for same user id on different accounts")
 		}
 	})
+	t.Run("peppered", func(t *testing.T) {
+		account := Account{
+			UserSalt: "{1,1} b2tpZG9raQ==",
+		}
+		if _, err := account.HashUserID("user-one", nil); err == nil {
+			t.Error("Expected error when hashing without pepper")
+		}
+		one, err := account.HashUserID("user-one", []byte("pepper"))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		other, _ := account.HashUserID("user-one", []byte("other-pepper"))
+		if one == other {
+			t.Error("Expected different values for different peppers")
+		}
+	})
 }
 
 func TestAccount_WrapPublicKey(t *testing.T) {
@@ -21,5 +21,69 @@ func (e ErrUnknownSecret) Error() string {
 	return string(e)
 }
 
+// ErrQuotaExceeded will be returned when an insert call would exceed the
+// daily event quota of an account
+type ErrQuotaExceeded string
+
+func (e ErrQuotaExceeded) Error() string {
+	return string(e)
+}
+
+// ErrEventRejected will be returned when an insert call is rejected by one
+// of the configured ingest hooks
+type ErrEventRejected string
+
+func (e ErrEventRejected) Error() string {
+	return string(e)
+}
+
+// ErrInvalidDomain will be returned when a domain that is to be stored for an
+// account is malformed
+type ErrInvalidDomain string
+
+func (e ErrInvalidDomain) Error() string {
+	return string(e)
+}
+
+// ErrInvalidResolution will be returned when aggregates are requested using
+// an unknown resolution
+type ErrInvalidResolution string
+
+func (e ErrInvalidResolution) Error() string {
+	return string(e)
+}
+
+// ErrInvalidBanner will be returned when the banner customization that is
+// to be stored for an account is malformed
+type ErrInvalidBanner string
+
+func (e ErrInvalidBanner) Error() string {
+	return string(e)
+}
+
+// ErrInvalidSettings will be returned when the encrypted settings that are
+// to be stored for an account are malformed
+type ErrInvalidSettings string
+
+func (e ErrInvalidSettings) Error() string {
+	return string(e)
+}
+
+// ErrUnknownPurge will be returned when the status of a purge that does not
+// exist is requested
+type ErrUnknownPurge string
+
+func (e ErrUnknownPurge) Error() string {
+	return string(e)
+}
+
 // ErrBadQuery is returned when a DAL method cannot handle the given query
 var ErrBadQuery = errors.New("persistence: could not match query")
+
+// ErrDuplicateEvent will be returned when an insert call uses an event id
+// that is already used by an event of another account or user
+type ErrDuplicateEvent string
+
+func (e ErrDuplicateEvent) Error() string {
+	return string(e)
+}
@@ -4,9 +4,10 @@
 package persistence
 
 import (
+	"crypto/rand"
 	"fmt"
 	"io"
-	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/oklog/ulid"
@@ -20,23 +21,82 @@ func NewULID() (string, error) {
 	return EventIDAt(time.Now())
 }
 
-var entropy io.Reader
+// ulidGenerator creates ULIDs using a single monotonic entropy source, so
+// ids that are created within the same millisecond keep sorting in the
+// order they have been created in.
+type ulidGenerator struct {
+	mu      sync.Mutex
+	entropy io.Reader
+}
+
+func (g *ulidGenerator) at(t time.Time) (ulid.ULID, error) {
+	// monotonic readers are not safe for concurrent use
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return ulid.New(ulid.Timestamp(t), g.entropy)
+}
+
+// defaultULIDGenerator is shared by the entire process. It is backed by
+// crypto/rand so that event ids cannot be predicted.
+var defaultULIDGenerator = &ulidGenerator{
+	entropy: ulid.Monotonic(rand.Reader, 0),
+}
 
 // EventIDAt creates a new ULID based on the given timestamp
 func EventIDAt(t time.Time) (string, error) {
-	if entropy == nil {
-		entropy = ulid.Monotonic(rand.New(rand.NewSource(t.UnixNano())), 0)
-	}
-	eventID, err := ulid.New(
-		ulid.Timestamp(t),
-		entropy,
-	)
+	eventID, err := defaultULIDGenerator.at(t)
 	if err != nil {
 		return "", fmt.Errorf("persistence: error creating new ULID: %w", err)
 	}
 	return eventID.String(), nil
 }
 
+// maxEventIDClockSkew is the duration event ids are allowed to be in the
+// future, as instances sharing a database might not have perfectly
+// synchronized clocks.
+const maxEventIDClockSkew = time.Minute
+
+// ValidateEventID checks whether the given value is a well formed event id
+// that has not been created in the future.
+func ValidateEventID(id string) error {
+	parsed, err := ulid.ParseStrict(id)
+	if err != nil {
+		return fmt.Errorf("persistence: %s is not a valid event id: %w", id, err)
+	}
+	if created := ulid.Time(parsed.Time()); created.After(time.Now().Add(maxEventIDClockSkew)) {
+		return fmt.Errorf("persistence: event id %s has been created in the future at %s", id, created.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// maxClientEventIDAge is the maximum age of event ids that have been created
+// by clients. Clients create the id right before sending an event and only
+// reuse it when retrying a failed submission, so older ids are rejected, which
+// prevents clients from backdating events.
+const maxClientEventIDAge = 10 * time.Minute
+
+// ValidateClientEventID works like ValidateEventID, but additionally requires
+// the id to have been created within a short window around the current time.
+func ValidateClientEventID(id string) error {
+	if err := ValidateEventID(id); err != nil {
+		return err
+	}
+	parsed, _ := ulid.ParseStrict(id)
+	if created := ulid.Time(parsed.Time()); created.Before(time.Now().Add(-maxClientEventIDAge)) {
+		return fmt.Errorf("persistence: event id %s has been created too long ago at %s", id, created.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// eventIDBoundary returns the smallest event id that can be created at the
+// given time, so all events created at or after that time have an id greater
+// than or equal to it.
+func eventIDBoundary(t time.Time) string {
+	var id ulid.ULID
+	id.SetTime(ulid.Timestamp(t))
+	return id.String()
+}
+
 func siblingEventID(id string) (string, error) {
 	pid, err := ulid.Parse(id)
 	if err != nil {
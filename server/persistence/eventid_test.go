@@ -39,3 +39,103 @@ func TestNewEventID(t *testing.T) {
 		t.Errorf("Expected fixed event id to sort lower, got %s and %s", hourAgo, second)
 	}
 }
+
+func TestNewEventID_Concurrent(t *testing.T) {
+	ids := make(chan string)
+	for i := 0; i < 50; i++ {
+		go func() {
+			id, err := NewULID()
+			if err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+			ids <- id
+		}()
+	}
+	seen := map[string]bool{}
+	for i := 0; i < 50; i++ {
+		id := <-ids
+		if seen[id] {
+			t.Errorf("Unexpected duplicate event id %s", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestEventIDAt_Monotonic(t *testing.T) {
+	now := time.Now()
+	previous, _ := EventIDAt(now)
+	for i := 0; i < 100; i++ {
+		next, err := EventIDAt(now)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if strings.Compare(previous, next) != -1 {
+			t.Fatalf("Expected ids of the same millisecond to sort in creation order, got %s and %s", previous, next)
+		}
+		previous = next
+	}
+}
+
+func TestValidateEventID(t *testing.T) {
+	future, _ := EventIDAt(time.Now().Add(time.Hour))
+	recent, _ := EventIDAt(time.Now().Add(time.Second))
+	tests := []struct {
+		name        string
+		id          string
+		expectError bool
+	}{
+		{"ok", "01F4Z2Q4B5C6D7E8F9G0H1J2K0", false},
+		{"slightly in the future", recent, false},
+		{"malformed", "event-a", true},
+		{"bad characters", "01F4Z2Q4B5C6D7E8F9G0H1J2KU", true},
+		{"future", future, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := ValidateEventID(test.id); (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateClientEventID(t *testing.T) {
+	future, _ := EventIDAt(time.Now().Add(time.Hour))
+	recent, _ := EventIDAt(time.Now().Add(-time.Minute))
+	tests := []struct {
+		name        string
+		id          string
+		expectError bool
+	}{
+		{"ok", recent, false},
+		{"malformed", "event-a", true},
+		{"future", future, true},
+		{"backdated", "01F4Z2Q4B5C6D7E8F9G0H1J2K0", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := ValidateClientEventID(test.id); (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+		})
+	}
+}
+
+func BenchmarkNewULID(b *testing.B) {
+	b.Run("serial", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := NewULID(); err != nil {
+				b.Fatalf("Unexpected error %v", err)
+			}
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := NewULID(); err != nil {
+					b.Fatalf("Unexpected error %v", err)
+				}
+			}
+		})
+	})
+}
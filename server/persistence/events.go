@@ -4,32 +4,175 @@
 package persistence
 
 import (
+	"errors"
 	"fmt"
+	"runtime"
 	"strings"
+	"sync"
 )
 
 func (p *persistenceLayer) Insert(userID, accountID, payload string, idOverride *string) error {
+	// events are validated before being buffered so errors can still be
+	// reported to the caller, only writing the event is deferred
+	evt, err := p.prepareEvent(userID, accountID, payload, idOverride)
+	if err != nil || evt == nil {
+		return err
+	}
+	if err := p.consumeQuota(accountID, 1); err != nil {
+		return err
+	}
+	if p.inserts != nil {
+		if err := p.inserts.push(userID, evt); err != nil {
+			p.releaseQuota(accountID, 1)
+			return err
+		}
+		return nil
+	}
+	if err := p.dal.CreateEvent(evt); err != nil {
+		p.releaseQuota(accountID, 1)
+		return fmt.Errorf("persistence: error inserting event: %w", err)
+	}
+	p.touchAccounts([]*Event{evt})
+	return nil
+}
+
+// InboundEvent is an event that has been sent by a user and is to be
+// inserted using InsertBatch.
+type InboundEvent struct {
+	AccountID string
+	Payload   string
+	EventID   *string
+}
+
+// InsertBatch inserts all of the given events of the given user. All events
+// are validated and checked against the quotas of their accounts before any
+// of them is written, and in case any of them is invalid or exceeds a quota,
+// none of them is inserted. As batches are already written using a single
+// transaction, they are never split up by the insert buffer but written right
+// away.
+func (p *persistenceLayer) InsertBatch(userID string, events []InboundEvent) error {
+	var pending []BufferedEvent
+	seen := map[string]bool{}
+	for _, evt := range events {
+		buffered := BufferedEvent{UserID: userID, AccountID: evt.AccountID, Payload: evt.Payload}
+		if evt.EventID != nil {
+			if seen[*evt.EventID] {
+				continue
+			}
+			seen[*evt.EventID] = true
+			buffered.EventID = *evt.EventID
+		}
+		pending = append(pending, buffered)
+	}
+
+	prepared, errs := p.prepareEvents(pending)
+	var result []*Event
+	for i, evt := range prepared {
+		if errs[i] != nil {
+			return fmt.Errorf("persistence: error preparing event at index %d: %w", i, errs[i])
+		}
+		if evt != nil {
+			result = append(result, evt)
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+
+	perAccount := map[string]int{}
+	for _, evt := range result {
+		perAccount[evt.AccountID]++
+	}
+	if err := p.consumeQuotas(perAccount); err != nil {
+		return err
+	}
+
+	if p.inserts != nil {
+		// events that have been submitted before and are still waiting
+		// in the buffer would otherwise be written twice
+		var unbuffered []*Event
+		skipped := map[string]int{}
+		for _, evt := range result {
+			if p.inserts.markPending(evt.EventID) {
+				unbuffered = append(unbuffered, evt)
+			} else {
+				skipped[evt.AccountID]++
+			}
+		}
+		defer p.inserts.clearPendingIDs(unbuffered)
+		// skipped events have already been counted when being buffered
+		p.releaseQuotas(skipped)
+		result = unbuffered
+		if len(result) == 0 {
+			return nil
+		}
+	}
+	if err := p.dal.CreateEvents(result); err != nil {
+		released := map[string]int{}
+		for _, evt := range result {
+			released[evt.AccountID]++
+		}
+		p.releaseQuotas(released)
+		return fmt.Errorf("persistence: error inserting events: %w", err)
+	}
+	p.touchAccounts(result)
+	return nil
+}
+
+// prepareEvents calls prepareEvent for all of the given events. Events that
+// do not have an id yet are assigned a new one. As hashing user ids is
+// expensive, events are prepared concurrently.
+func (p *persistenceLayer) prepareEvents(events []BufferedEvent) ([]*Event, []error) {
+	prepared := make([]*Event, len(events))
+	errs := make([]error, len(events))
+	sem := make(chan struct{}, runtime.NumCPU())
+	var wg sync.WaitGroup
+	for i, evt := range events {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, evt BufferedEvent) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			var idOverride *string
+			if evt.EventID != "" {
+				idOverride = &evt.EventID
+			}
+			prepared[i], errs[i] = p.prepareEvent(evt.UserID, evt.AccountID, evt.Payload, idOverride)
+		}(i, evt)
+	}
+	wg.Wait()
+	return prepared, errs
+}
+
+// prepareEvent validates the given event data and returns the event to be
+// created. In case the event has already been created, nil is returned.
+func (p *persistenceLayer) prepareEvent(userID, accountID, payload string, idOverride *string) (*Event, error) {
 	var eventID string
 	if idOverride == nil {
 		var err error
 		eventID, err = NewULID()
 		if err != nil {
-			return fmt.Errorf("persistence: error creating new event identifier: %w", err)
+			return nil, fmt.Errorf("persistence: error creating new event identifier: %w", err)
 		}
 	} else {
 		eventID = *idOverride
 	}
 
-	account, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	account, err := p.findActiveAccount(accountID)
 	if err != nil {
-		return fmt.Errorf("persistence: error looking up matching account for given event: %w", err)
+		return nil, fmt.Errorf("persistence: error looking up matching account for given event: %w", err)
+	}
+	if err := p.scheduleUserSaltMigrations(userID, []Account{account}); err != nil {
+		return nil, err
 	}
 
 	var hashedUserID *string
 	if userID != "" {
-		hash, err := account.HashUserID(userID)
+		hash, err := p.hashUserID(account, userID)
 		if err != nil {
-			return fmt.Errorf("persistence: error hashing user id: %w", err)
+			return nil, fmt.Errorf("persistence: error hashing user id: %w", err)
 		}
 		hashedUserID = &hash
 	}
@@ -38,26 +181,49 @@ func (p *persistenceLayer) Insert(userID, accountID, payload string, idOverride
 	// already exists for the account so events can be decrypted lateron
 	if hashedUserID != nil {
 		if _, err := p.dal.FindSecret(FindSecretQueryBySecretID(*hashedUserID)); err != nil {
-			return fmt.Errorf("persistence: error finding secret for given event: %w", err)
+			// in case the user has not been migrated to the account's
+			// current salt yet, only the secret is migrated right away
+			var unknownSecretErr ErrUnknownSecret
+			if !errors.As(err, &unknownSecretErr) || account.PreviousUserSalt == "" {
+				return nil, fmt.Errorf("persistence: error finding secret for given event: %w", err)
+			}
+			if _, _, ok, migrateErr := p.migrateUserSecret(userID, account); migrateErr != nil || !ok {
+				return nil, fmt.Errorf("persistence: error finding secret for given event: %w", err)
+			}
+		}
+	}
+
+	// clients can pass the identifier of the event themselves, which allows
+	// them to safely retry a submission without creating duplicate events
+	if idOverride != nil {
+		existing, err := p.dal.FindEvents(FindEventsQueryByEventIDs{eventID})
+		if err != nil {
+			return nil, fmt.Errorf("persistence: error looking up events by id: %w", err)
+		}
+		if len(existing) != 0 {
+			if match := existing[0]; match.AccountID == accountID && equalSecretIDs(match.SecretID, hashedUserID) {
+				return nil, nil
+			}
+			return nil, ErrDuplicateEvent(fmt.Sprintf("persistence: event id %s is already in use", eventID))
 		}
 	}
 
 	sequence, seqErr := NewULID()
 	if seqErr != nil {
-		return fmt.Errorf("persistence: error creating sequence number: %w", seqErr)
+		return nil, fmt.Errorf("persistence: error creating sequence number: %w", seqErr)
 	}
 
-	insertErr := p.dal.CreateEvent(&Event{
+	evt := &Event{
 		AccountID: accountID,
 		SecretID:  hashedUserID,
 		Payload:   payload,
 		EventID:   eventID,
 		Sequence:  sequence,
-	})
-	if insertErr != nil {
-		return fmt.Errorf("persistence: error inserting event: %w", insertErr)
 	}
-	return nil
+	if err := p.inspectEvent(evt); err != nil {
+		return nil, err
+	}
+	return evt, nil
 }
 
 // Query defines a set of filters to limit the set of results to be returned
@@ -68,14 +234,16 @@ type Query struct {
 }
 
 func (p *persistenceLayer) Query(query Query) (EventsResult, error) {
-	var accounts []Account
-	accounts, err := p.dal.FindAccounts(FindAccountsQueryAllAccounts{})
+	hashedUserIDs, err := p.querySecretIDs(query.UserID)
 	if err != nil {
-		return EventsResult{}, fmt.Errorf("persistence: error looking up all accounts: %v", err)
+		return EventsResult{}, err
 	}
 
-	results, err := p.dal.FindEvents(FindEventsQueryForSecretIDs{
-		SecretIDs: hashUserIDForAccounts(query.UserID, accounts),
+	// accounts are read from the primary as hashing user ids requires up to
+	// date salts, events can be read from the replica
+	reads := p.reads()
+	results, err := reads.FindEvents(FindEventsQueryForSecretIDs{
+		SecretIDs: hashedUserIDs,
 		Since:     query.Since,
 	})
 	if err != nil {
@@ -95,8 +263,8 @@ func (p *persistenceLayer) Query(query Query) (EventsResult, error) {
 	out.Events = &eventResults
 
 	if query.Since != "" {
-		pruned, err := p.dal.FindTombstones(FindTombstonesQueryBySecrets{
-			SecretIDs: hashUserIDForAccounts(query.UserID, accounts),
+		pruned, err := reads.FindTombstones(FindTombstonesQueryBySecrets{
+			SecretIDs: hashedUserIDs,
 			Since:     query.Since,
 		})
 		if err != nil {
@@ -115,77 +283,119 @@ func (p *persistenceLayer) Query(query Query) (EventsResult, error) {
 	return out, nil
 }
 
-func (p *persistenceLayer) Purge(userID string) error {
-	sequence, err := NewULID()
+// querySecretIDs returns the hashed ids the given user's events are stored
+// with across all accounts.
+func (p *persistenceLayer) querySecretIDs(userID string) ([]string, error) {
+	accounts, err := p.dal.FindAccounts(FindAccountsQueryAllAccounts{})
 	if err != nil {
-		return fmt.Errorf("persistence: error creating sequence number: %w", err)
+		return nil, fmt.Errorf("persistence: error looking up all accounts: %w", err)
+	}
+	if err := p.scheduleUserSaltMigrations(userID, accounts); err != nil {
+		return nil, err
 	}
 
-	txn, err := p.dal.Transaction()
+	hashedUserIDs := p.hashUserIDForAccounts(userID, accounts)
+	// events of users that have not been migrated to the current salt of an
+	// account yet are still stored using the previous hashed user id
+	previousHashes, err := p.previousUserIDHashes(userID, accounts)
 	if err != nil {
-		return fmt.Errorf("persistence: error creating transaction: %w", err)
+		return nil, err
 	}
+	return append(hashedUserIDs, previousHashes...), nil
+}
 
-	accounts, err := txn.FindAccounts(FindAccountsQueryAllAccounts{})
+// Purge deletes all events of the given user. In case account ids are given,
+// only events for these accounts are deleted.
+func (p *persistenceLayer) Purge(userID string, accountIDs []string) error {
+	sequence, err := NewULID()
 	if err != nil {
-		txn.Rollback()
-		return fmt.Errorf("persistence: error retrieving available accounts: %w", err)
+		return fmt.Errorf("persistence: error creating sequence number: %w", err)
 	}
 
-	hashedUserIDs := hashUserIDForAccounts(userID, accounts)
-
-	affectedEvents, err := txn.FindEvents(FindEventsQueryForSecretIDs{SecretIDs: hashedUserIDs})
+	accounts, err := p.dal.FindAccounts(FindAccountsQueryAllAccounts{})
 	if err != nil {
-		txn.Rollback()
-		return fmt.Errorf("persistence: error looking up events to purge: %w", err)
+		return fmt.Errorf("persistence: error retrieving available accounts: %w", err)
 	}
-	for _, evt := range affectedEvents {
-		if err := txn.CreateTombstone(&Tombstone{
-			EventID:   evt.EventID,
-			AccountID: evt.AccountID,
-			SecretID:  evt.SecretID,
-			Sequence:  sequence,
-		}); err != nil {
-			txn.Rollback()
-			return fmt.Errorf("persistence: error creating tombstone for purged event: %w", err)
-		}
+	// events are migrated first so clients are notified about all purged
+	// events using the current hashed user id
+	if err := p.migrateUserSalts(userID, accounts); err != nil {
+		return err
 	}
 
-	if _, err := txn.DeleteEvents(DeleteEventsQueryBySecretIDs(hashedUserIDs)); err != nil {
-		txn.Rollback()
-		return fmt.Errorf("persistence: error purging events: %w", err)
+	if len(accountIDs) != 0 {
+		var matching []Account
+		for _, account := range accounts {
+			if containsString(accountIDs, account.AccountID) {
+				matching = append(matching, account)
+			}
+		}
+		accounts = matching
 	}
 
-	if err := txn.Commit(); err != nil {
-		return fmt.Errorf("persistence: error committing pruning of events: %w", err)
-	}
-	return nil
-}
+	hashedUserIDs := p.hashUserIDForAccounts(userID, accounts)
 
-func hashUserIDForAccounts(userID string, accounts []Account) []string {
-	if len(accounts) == 0 {
-		return []string{}
+	// the archive is read before and updated after the transaction so that
+	// requests to remote storage do not keep the transaction open
+	var archived archivePurge
+	if p.archive != nil {
+		// archived events are not migrated when rotating the user salt
+		// so they might still be stored using the previous hashed user id
+		archivedUserIDs := hashedUserIDs
+		for _, account := range accounts {
+			if account.PreviousUserSalt == "" {
+				continue
+			}
+			previousHash, err := account.hashUserIDWithPreviousSalt(userID, p.userIDPepper)
+			if err != nil {
+				return fmt.Errorf("persistence: error hashing user id with previous salt: %w", err)
+			}
+			archivedUserIDs = append(archivedUserIDs, previousHash)
+		}
+		for _, account := range accounts {
+			if err := p.planArchivePurge(&archived, account.AccountID, archivedUserIDs, sequence); err != nil {
+				return err
+			}
+		}
 	}
-	hashes := make(chan string)
-	// in case a user queries for a longer list of account ids (or even all of them)
-	// hashing the user ID against all salts can get relatively expensive, so
-	// computation is being done concurrently
-	for _, account := range accounts {
-		go func(account Account) {
-			hash, _ := account.HashUserID(userID)
-			hashes <- hash
-		}(account)
+
+	if err := WithTransaction(p.dal, func(tx DataAccessLayer) error {
+		affectedEvents, err := tx.FindEvents(FindEventsQueryForSecretIDs{SecretIDs: hashedUserIDs})
+		if err != nil {
+			return fmt.Errorf("persistence: error looking up events to purge: %w", err)
+		}
+		for _, evt := range affectedEvents {
+			if err := tx.CreateTombstone(&Tombstone{
+				EventID:   evt.EventID,
+				AccountID: evt.AccountID,
+				SecretID:  evt.SecretID,
+				Sequence:  sequence,
+			}); err != nil {
+				return fmt.Errorf("persistence: error creating tombstone for purged event: %w", err)
+			}
+		}
+
+		if _, err := tx.DeleteEvents(DeleteEventsQueryBySecretIDs(hashedUserIDs)); err != nil {
+			return fmt.Errorf("persistence: error purging events: %w", err)
+		}
+
+		return archived.createTombstones(tx)
+	}); err != nil {
+		return err
 	}
 
-	var hashedUserIDs []string
-	for result := range hashes {
-		hashedUserIDs = append(hashedUserIDs, result)
-		if len(hashedUserIDs) == len(accounts) {
-			close(hashes)
-			break
+	if p.archive != nil {
+		if err := p.applyArchivePurge(&archived); err != nil {
+			return err
 		}
 	}
-	return hashedUserIDs
+	return nil
+}
+
+func equalSecretIDs(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
 }
 
 func getLatestSeq(s []string) string {
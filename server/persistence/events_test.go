@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 )
 
 type assertion func(interface{}) error
@@ -22,6 +23,10 @@ type mockInsertEventDatabase struct {
 	methodArgs        []interface{}
 }
 
+func (m *mockInsertEventDatabase) UpdateAccounts(interface{}) (int64, error) {
+	return 0, nil
+}
+
 func (m *mockInsertEventDatabase) FindAccount(q interface{}) (Account, error) {
 	m.methodArgs = append(m.methodArgs, q)
 	return m.findAccountResult, m.findAccountErr
@@ -37,6 +42,43 @@ func (m *mockInsertEventDatabase) CreateEvent(e *Event) error {
 	return m.createEventErr
 }
 
+type mockBenchmarkInsertDatabase struct {
+	DataAccessLayer
+	account Account
+}
+
+func (m *mockBenchmarkInsertDatabase) UpdateAccounts(interface{}) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockBenchmarkInsertDatabase) FindAccount(q interface{}) (Account, error) {
+	return m.account, nil
+}
+
+func (m *mockBenchmarkInsertDatabase) FindSecret(q interface{}) (Secret, error) {
+	return Secret{}, nil
+}
+
+func (m *mockBenchmarkInsertDatabase) CreateEvent(e *Event) error {
+	return nil
+}
+
+func BenchmarkPersistenceLayer_Insert(b *testing.B) {
+	p := &persistenceLayer{dal: &mockBenchmarkInsertDatabase{
+		account: Account{
+			AccountID: "account-id",
+			UserSalt:  "{1,} CaHVhk78uhoPmf5wanA0vg==",
+		},
+	}}
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := p.Insert("user-id", "account-id", "payload", nil); err != nil {
+				b.Fatalf("Unexpected error %v", err)
+			}
+		}
+	})
+}
+
 func TestPersistenceLayer_Insert(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -271,10 +313,160 @@ func (m *mockPurgeEventsDatabase) FindEvents(q interface{}) ([]Event, error) {
 	return nil, nil
 }
 
+type mockInsertEventIDDatabase struct {
+	DataAccessLayer
+	account Account
+	events  []Event
+}
+
+func (m *mockInsertEventIDDatabase) UpdateAccounts(interface{}) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockInsertEventIDDatabase) FindAccount(interface{}) (Account, error) {
+	return m.account, nil
+}
+
+func (m *mockInsertEventIDDatabase) FindSecret(interface{}) (Secret, error) {
+	return Secret{}, nil
+}
+
+func (m *mockInsertEventIDDatabase) FindEvents(q interface{}) ([]Event, error) {
+	var result []Event
+	for _, evt := range m.events {
+		if containsString(q.(FindEventsQueryByEventIDs), evt.EventID) {
+			result = append(result, evt)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockInsertEventIDDatabase) CreateEvent(e *Event) error {
+	m.events = append(m.events, *e)
+	return nil
+}
+
+func (m *mockInsertEventIDDatabase) CreateEvents(events []*Event) error {
+	for _, e := range events {
+		m.events = append(m.events, *e)
+	}
+	return nil
+}
+
+func TestPersistenceLayer_Insert_EventID(t *testing.T) {
+	db := &mockInsertEventIDDatabase{
+		account: Account{
+			AccountID: "account-id",
+			UserSalt:  "{1,} CaHVhk78uhoPmf5wanA0vg==",
+		},
+	}
+	p := &persistenceLayer{dal: db}
+	eventID := "01F4Z2Q4B5C6D7E8F9G0H1J2K0"
+
+	for i := 0; i < 3; i++ {
+		if err := p.Insert("user-id", "account-id", "payload", &eventID); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	if len(db.events) != 1 {
+		t.Errorf("Expected repeated submissions to create a single event, got %v", db.events)
+	}
+	if db.events[0].EventID != eventID {
+		t.Errorf("Expected given event id to be used, got %v", db.events[0].EventID)
+	}
+
+	err := p.Insert("other-user-id", "account-id", "payload", &eventID)
+	var duplicateErr ErrDuplicateEvent
+	if !errors.As(err, &duplicateErr) {
+		t.Errorf("Expected duplicate event error for other user, got %v", err)
+	}
+	if len(db.events) != 1 {
+		t.Errorf("Unexpected event creation %v", db.events)
+	}
+}
+
+func TestPersistenceLayer_InsertBatch(t *testing.T) {
+	db := &mockInsertEventIDDatabase{
+		account: Account{
+			AccountID: "account-id",
+			UserSalt:  "{1,} CaHVhk78uhoPmf5wanA0vg==",
+		},
+	}
+	p := &persistenceLayer{dal: db}
+	eventID := "01F4Z2Q4B5C6D7E8F9G0H1J2K0"
+	if err := p.Insert("user-id", "account-id", "payload", &eventID); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	otherEventID := "01F4Z2Q4B5C6D7E8F9G0H1J2K1"
+	if err := p.InsertBatch("user-id", []InboundEvent{
+		{AccountID: "account-id", Payload: "payload-a", EventID: &eventID},
+		{AccountID: "account-id", Payload: "payload-b"},
+		{AccountID: "account-id", Payload: "payload-c", EventID: &otherEventID},
+		{AccountID: "account-id", Payload: "payload-c", EventID: &otherEventID},
+	}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(db.events) != 3 {
+		t.Fatalf("Expected two additional events to be created, got %v", db.events)
+	}
+	if db.events[1].Payload != "payload-b" || db.events[1].EventID == "" {
+		t.Errorf("Expected event to be assigned an id, got %v", db.events[1])
+	}
+	if db.events[2].EventID != otherEventID {
+		t.Errorf("Expected given event id to be used, got %v", db.events[2])
+	}
+
+	err := p.InsertBatch("other-user-id", []InboundEvent{
+		{AccountID: "account-id", Payload: "payload-d"},
+		{AccountID: "account-id", Payload: "payload-e", EventID: &eventID},
+	})
+	var duplicateErr ErrDuplicateEvent
+	if !errors.As(err, &duplicateErr) {
+		t.Errorf("Expected duplicate event error for other user, got %v", err)
+	}
+	if len(db.events) != 3 {
+		t.Errorf("Expected no events to be created on error, got %v", db.events)
+	}
+}
+
+func TestPersistenceLayer_InsertBatch_Buffered(t *testing.T) {
+	db := &mockInsertEventIDDatabase{
+		account: Account{
+			AccountID: "account-id",
+			UserSalt:  "{1,} CaHVhk78uhoPmf5wanA0vg==",
+		},
+	}
+	p := &persistenceLayer{dal: db}
+	WithInsertBuffer(10, 10, time.Hour, nil)(p)
+
+	eventID := "01F4Z2Q4B5C6D7E8F9G0H1J2K0"
+	if err := p.Insert("user-id", "account-id", "payload", &eventID); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := p.InsertBatch("user-id", []InboundEvent{
+		{AccountID: "account-id", Payload: "payload-a", EventID: &eventID},
+		{AccountID: "account-id", Payload: "payload-b"},
+		{AccountID: "account-id", Payload: "payload-c"},
+	}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(db.events) != 2 || db.events[0].Payload != "payload-b" || db.events[1].Payload != "payload-c" {
+		t.Errorf("Expected batch to be written right away without buffered event, got %v", db.events)
+	}
+	if len(p.inserts.queue) != 1 {
+		t.Errorf("Expected single event to be buffered, got %d", len(p.inserts.queue))
+	}
+	if len(p.inserts.pending) != 1 || !p.inserts.pending[eventID] {
+		t.Errorf("Unexpected pending events %v", p.inserts.pending)
+	}
+}
+
 func TestPersistenceLayer_Purge(t *testing.T) {
 	tests := []struct {
 		name          string
 		db            *mockPurgeEventsDatabase
+		accountIDs    []string
 		expectError   bool
 		argAssertions []assertion
 	}{
@@ -283,6 +475,7 @@ func TestPersistenceLayer_Purge(t *testing.T) {
 			&mockPurgeEventsDatabase{
 				findAccountsErr: errors.New("did not work"),
 			},
+			nil,
 			true,
 			[]assertion{
 				func(q interface{}) error {
@@ -302,6 +495,7 @@ func TestPersistenceLayer_Purge(t *testing.T) {
 				},
 				deleteEventsErr: errors.New("did not work"),
 			},
+			nil,
 			true,
 			[]assertion{
 				func(q interface{}) error {
@@ -331,6 +525,7 @@ func TestPersistenceLayer_Purge(t *testing.T) {
 					{UserSalt: "D6xdWYfRqbuWrkg4OWVgGQ=="},
 				},
 			},
+			nil,
 			false,
 			[]assertion{
 				func(q interface{}) error {
@@ -352,13 +547,41 @@ func TestPersistenceLayer_Purge(t *testing.T) {
 				},
 			},
 		},
+		{
+			"scoped to accounts",
+			&mockPurgeEventsDatabase{
+				findAccountsResult: []Account{
+					{AccountID: "account-a", UserSalt: "{1,} JF+rNeViJeJb0jth6ZheWg=="},
+					{AccountID: "account-b", UserSalt: "{1,} D6xdWYfRqbuWrkg4OWVgGQ=="},
+				},
+			},
+			[]string{"account-b", "account-z"},
+			false,
+			[]assertion{
+				func(q interface{}) error {
+					if _, ok := q.(FindAccountsQueryAllAccounts); ok {
+						return nil
+					}
+					return fmt.Errorf("unexpected argument %v", q)
+				},
+				func(q interface{}) error {
+					if hashes, ok := q.(DeleteEventsQueryBySecretIDs); ok {
+						if len(hashes) != 1 {
+							return fmt.Errorf("unexpected number of hashes %d", len(hashes))
+						}
+						return nil
+					}
+					return fmt.Errorf("unexpected argument %v", q)
+				},
+			},
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			r := &persistenceLayer{
 				dal: test.db,
 			}
-			err := r.Purge("user-id")
+			err := r.Purge("user-id", test.accountIDs)
 			if (err != nil) != test.expectError {
 				t.Errorf("Unexpected error value %v", err)
 			}
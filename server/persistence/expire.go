@@ -9,27 +9,29 @@ import (
 )
 
 // Expire deletes all events in the give database that are older than the given
-// retention threshold.
-func (p *persistenceLayer) Expire(retention time.Duration) (int, error) {
-	limit := time.Now().Add(-retention)
-	deadline, deadlineErr := EventIDAt(limit)
-	if deadlineErr != nil {
-		return 0, fmt.Errorf("persistence: error determing deadline for expiring events: %w", deadlineErr)
+// retention threshold. Accounts that define a shorter retention period of
+// their own will have their events expired accordingly. In case an archive is
+// configured, archived bundles that only contain expired events are deleted.
+// The returned report contains the number of expired events per account.
+func (p *persistenceLayer) Expire(retention time.Duration) (ExpireReport, error) {
+	report, deadlines, err := p.expire(retention, ExpireOptions{})
+	if err != nil {
+		return report, err
 	}
-
-	sequence, seqErr := NewULID()
-	if seqErr != nil {
-		return 0, fmt.Errorf("persistence: error creating sequence number: %w", seqErr)
+	if p.archive != nil {
+		if err := p.expireArchive(deadlines, deadlines[""]); err != nil {
+			return report, err
+		}
 	}
+	return report, nil
+}
 
-	txn, err := p.dal.Transaction()
-	if err != nil {
-		return 0, fmt.Errorf("persistence: error creating transaction: %w", err)
-	}
-	expiredEvents, err := txn.FindEvents(FindEventsQueryOlderThan(deadline))
+// expireEvents creates tombstones for all events matching the given query
+// before deleting them. It returns the events that have been expired.
+func expireEvents(txn Transaction, sequence string, findQuery, deleteQuery interface{}) ([]Event, int64, error) {
+	expiredEvents, err := txn.FindEvents(findQuery)
 	if err != nil {
-		txn.Rollback()
-		return 0, fmt.Errorf("persistence: error looking up expired events: %w", err)
+		return nil, 0, fmt.Errorf("persistence: error looking up expired events: %w", err)
 	}
 
 	for _, evt := range expiredEvents {
@@ -39,19 +41,141 @@ func (p *persistenceLayer) Expire(retention time.Duration) (int, error) {
 			SecretID:  evt.SecretID,
 			Sequence:  sequence,
 		}); err != nil {
-			txn.Rollback()
-			return 0, fmt.Errorf("persistence: error creating tombstone: %w", err)
+			return nil, 0, fmt.Errorf("persistence: error creating tombstone: %w", err)
 		}
 	}
 
-	eventsAffected, err := txn.DeleteEvents(DeleteEventsQueryOlderThan(deadline))
+	affected, err := txn.DeleteEvents(deleteQuery)
 	if err != nil {
+		return nil, 0, fmt.Errorf("persistence: error deleting expired events: %w", err)
+	}
+	return expiredEvents, affected, nil
+}
+
+// ExpireOptions restricts which events are affected when calling
+// ExpireAccounts.
+type ExpireOptions struct {
+	// AccountID restricts expiry to the account of the given id. In case
+	// it is empty, all accounts are affected.
+	AccountID string
+	// DryRun only reports the number of events that would be expired
+	// without deleting any of them.
+	DryRun bool
+}
+
+// ExpireAccounts expires events just like Expire does, but allows restricting
+// expiry using the given options. Archived bundles are not affected.
+func (p *persistenceLayer) ExpireAccounts(retention time.Duration, options ExpireOptions) ([]ExpireResult, error) {
+	report, _, err := p.expire(retention, options)
+	if err != nil {
+		return nil, err
+	}
+	return report.Accounts, nil
+}
+
+// expire expires the events of all accounts matching the given options and
+// returns the deadlines that have been applied. The deadline for events of
+// accounts using the instance wide retention is stored using an empty key.
+// Events that do not belong to any known account are only expired in case
+// no account id is given, and are not counted in dry runs.
+func (p *persistenceLayer) expire(retention time.Duration, options ExpireOptions) (ExpireReport, map[string]string, error) {
+	now := time.Now()
+	report := ExpireReport{Started: now.UTC(), Accounts: []ExpireResult{}}
+	deadline, deadlineErr := EventIDAt(now.Add(-retention))
+	if deadlineErr != nil {
+		return report, nil, fmt.Errorf("persistence: error determing deadline for expiring events: %w", deadlineErr)
+	}
+	deadlines := map[string]string{"": deadline}
+
+	sequence, seqErr := NewULID()
+	if seqErr != nil {
+		return report, nil, fmt.Errorf("persistence: error creating sequence number: %w", seqErr)
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return report, nil, fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+
+	accounts, err := txn.FindAccounts(FindAccountsQueryAllAccounts{})
+	if err != nil {
+		txn.Rollback()
+		return report, nil, fmt.Errorf("persistence: error looking up accounts: %w", err)
+	}
+
+	for _, account := range accounts {
+		if options.AccountID != "" && account.AccountID != options.AccountID {
+			continue
+		}
+		// the instance wide retention is the upper bound for all accounts
+		accountRetention, accountDeadline := retention, deadline
+		if account.Retention > 0 && account.Retention < retention {
+			accountRetention = account.Retention
+			accountDeadline, err = EventIDAt(now.Add(-account.Retention))
+			if err != nil {
+				txn.Rollback()
+				return report, nil, fmt.Errorf("persistence: error determing deadline for expiring events of account %s: %w", account.AccountID, err)
+			}
+			deadlines[account.AccountID] = accountDeadline
+		}
+
+		var affected int64
+		if options.DryRun {
+			counts, err := txn.CountEvents(CountEventsQueryByAccountIDOlderThan{AccountID: account.AccountID, EventID: accountDeadline})
+			if err != nil {
+				txn.Rollback()
+				return report, nil, fmt.Errorf("persistence: error counting expired events: %w", err)
+			}
+			if len(counts) != 0 {
+				affected = counts[0].Events
+			}
+		} else {
+			_, affected, err = expireEvents(
+				txn, sequence,
+				FindEventsQueryByAccountIDOlderThan{AccountID: account.AccountID, EventID: accountDeadline},
+				DeleteEventsQueryByAccountIDOlderThan{AccountID: account.AccountID, EventID: accountDeadline},
+			)
+			if err != nil {
+				txn.Rollback()
+				return report, nil, err
+			}
+		}
+		report.Expired += int(affected)
+		report.Accounts = append(report.Accounts, ExpireResult{
+			AccountID: account.AccountID,
+			Name:      account.Name,
+			Retention: accountRetention,
+			Expired:   int(affected),
+		})
+	}
+
+	if options.AccountID != "" && len(report.Accounts) == 0 {
+		txn.Rollback()
+		return report, nil, ErrUnknownAccount(fmt.Sprintf("persistence: account %s does not exist", options.AccountID))
+	}
+
+	if options.DryRun {
 		txn.Rollback()
-		return 0, fmt.Errorf("persistence: error deleting expired events: %w", err)
+		report.Duration = time.Since(now)
+		return report, deadlines, nil
+	}
+
+	if options.AccountID == "" {
+		// all events of known accounts have been expired already, so
+		// only events that do not belong to any of them are left
+		_, affected, err := expireEvents(
+			txn, sequence, FindEventsQueryOlderThan(deadline), DeleteEventsQueryOlderThan(deadline),
+		)
+		if err != nil {
+			txn.Rollback()
+			return report, nil, err
+		}
+		report.Expired += int(affected)
 	}
 
 	if err := txn.Commit(); err != nil {
-		return 0, fmt.Errorf("persistence: error expiring events: %w", err)
+		return report, nil, fmt.Errorf("persistence: error expiring events: %w", err)
 	}
-	return int(eventsAffected), nil
+	report.Duration = time.Since(now)
+	return report, deadlines, nil
 }
@@ -5,17 +5,27 @@ package persistence
 
 import (
 	"errors"
+	"reflect"
 	"testing"
 	"time"
 )
 
 type mockExpireDatabase struct {
 	DataAccessLayer
-	err      error
-	affected int64
+	err           error
+	affected      int64
+	accounts      []Account
+	events        []Event
+	deleteQueries []interface{}
+	committed     bool
+}
+
+func (m *mockExpireDatabase) FindAccounts(q interface{}) ([]Account, error) {
+	return m.accounts, m.err
 }
 
 func (m *mockExpireDatabase) DeleteEvents(q interface{}) (int64, error) {
+	m.deleteQueries = append(m.deleteQueries, q)
 	return m.affected, m.err
 }
 
@@ -24,10 +34,22 @@ func (m *mockExpireDatabase) FindTombstones(q interface{}) ([]Tombstone, error)
 }
 
 func (m *mockExpireDatabase) FindEvents(q interface{}) ([]Event, error) {
-	return nil, m.err
+	return m.events, m.err
+}
+
+func (m *mockExpireDatabase) CountEvents(q interface{}) ([]EventCount, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return []EventCount{{Events: int64(len(m.events))}}, nil
+}
+
+func (m *mockExpireDatabase) CreateTombstone(t *Tombstone) error {
+	return m.err
 }
 
 func (m *mockExpireDatabase) Commit() error {
+	m.committed = true
 	return nil
 }
 
@@ -47,12 +69,12 @@ func TestPersistenceLayer_Expire(t *testing.T) {
 				affected: 9876,
 			},
 		}
-		affected, err := r.Expire(time.Second)
+		report, err := r.Expire(time.Second)
 		if err != nil {
 			t.Errorf("Unexpected error %v", err)
 		}
-		if affected != 9876 {
-			t.Errorf("Expected %d, got %d", 9876, affected)
+		if report.Expired != 9876 {
+			t.Errorf("Expected %d, got %d", 9876, report.Expired)
 		}
 	})
 	t.Run("error", func(t *testing.T) {
@@ -61,12 +83,124 @@ func TestPersistenceLayer_Expire(t *testing.T) {
 				err: errors.New("did not work"),
 			},
 		}
-		affected, err := r.Expire(time.Second)
+		report, err := r.Expire(time.Second)
 		if err == nil {
 			t.Errorf("Unexpected error value %v", err)
 		}
-		if affected != 0 {
-			t.Errorf("Expected %d, got %d", 0, affected)
+		if report.Expired != 0 {
+			t.Errorf("Expected %d, got %d", 0, report.Expired)
+		}
+	})
+	t.Run("account retention", func(t *testing.T) {
+		db := &mockExpireDatabase{
+			affected: 2,
+			accounts: []Account{
+				{AccountID: "account-a", Name: "a"},
+				{AccountID: "account-b", Name: "b", Retention: time.Minute},
+				{AccountID: "account-c", Name: "c", Retention: time.Hour * 2},
+			},
+			events: []Event{{EventID: "event-a", AccountID: "account-b"}, {EventID: "event-b", AccountID: "account-a"}},
+		}
+		r := &persistenceLayer{dal: db}
+		report, err := r.Expire(time.Hour)
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if report.Expired != 8 {
+			t.Errorf("Expected %d, got %d", 8, report.Expired)
+		}
+		expectedAccounts := []ExpireResult{
+			{AccountID: "account-a", Name: "a", Retention: time.Hour, Expired: 2},
+			{AccountID: "account-b", Name: "b", Retention: time.Minute, Expired: 2},
+			{AccountID: "account-c", Name: "c", Retention: time.Hour, Expired: 2},
+		}
+		if !reflect.DeepEqual(expectedAccounts, report.Accounts) {
+			t.Errorf("Expected %v, got %v", expectedAccounts, report.Accounts)
+		}
+		if report.Started.IsZero() || report.Duration <= 0 {
+			t.Errorf("Unexpected timing %v, %v", report.Started, report.Duration)
+		}
+		if len(db.deleteQueries) != 4 {
+			t.Fatalf("Unexpected number of deletions %d", len(db.deleteQueries))
+		}
+		halfHourAgo, _ := EventIDAt(time.Now().Add(-time.Minute * 30))
+		for i, accountID := range []string{"account-a", "account-b", "account-c"} {
+			q, ok := db.deleteQueries[i].(DeleteEventsQueryByAccountIDOlderThan)
+			if !ok || q.AccountID != accountID {
+				t.Errorf("Unexpected query %v", db.deleteQueries[i])
+			}
+			// only account-b uses a retention shorter than the instance's
+			if (q.EventID > halfHourAgo) != (accountID == "account-b") {
+				t.Errorf("Unexpected deadline %v", q)
+			}
+		}
+		if _, ok := db.deleteQueries[3].(DeleteEventsQueryOlderThan); !ok {
+			t.Errorf("Unexpected query %v", db.deleteQueries[3])
+		}
+	})
+}
+
+func TestPersistenceLayer_ExpireAccounts(t *testing.T) {
+	accounts := []Account{
+		{AccountID: "account-a", Name: "a"},
+		{AccountID: "account-b", Name: "b", Retention: time.Minute},
+	}
+	t.Run("dry run", func(t *testing.T) {
+		db := &mockExpireDatabase{
+			accounts: accounts,
+			events:   []Event{{EventID: "event-a"}, {EventID: "event-b"}},
+		}
+		r := &persistenceLayer{dal: db}
+		results, err := r.ExpireAccounts(time.Hour, ExpireOptions{DryRun: true})
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		expected := []ExpireResult{
+			{AccountID: "account-a", Name: "a", Retention: time.Hour, Expired: 2},
+			{AccountID: "account-b", Name: "b", Retention: time.Minute, Expired: 2},
+		}
+		if !reflect.DeepEqual(expected, results) {
+			t.Errorf("Expected %v, got %v", expected, results)
+		}
+		if len(db.deleteQueries) != 0 || db.committed {
+			t.Errorf("Expected no changes to be made, got %v", db.deleteQueries)
+		}
+	})
+	t.Run("single account", func(t *testing.T) {
+		db := &mockExpireDatabase{
+			accounts: accounts,
+			affected: 3,
+		}
+		r := &persistenceLayer{dal: db}
+		results, err := r.ExpireAccounts(time.Hour, ExpireOptions{AccountID: "account-b"})
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		expected := []ExpireResult{
+			{AccountID: "account-b", Name: "b", Retention: time.Minute, Expired: 3},
+		}
+		if !reflect.DeepEqual(expected, results) {
+			t.Errorf("Expected %v, got %v", expected, results)
+		}
+		if len(db.deleteQueries) != 1 || !db.committed {
+			t.Errorf("Unexpected deletions %v", db.deleteQueries)
+		}
+		if q, ok := db.deleteQueries[0].(DeleteEventsQueryByAccountIDOlderThan); !ok || q.AccountID != "account-b" {
+			t.Errorf("Unexpected query %v", db.deleteQueries[0])
+		}
+	})
+	t.Run("unknown account", func(t *testing.T) {
+		r := &persistenceLayer{dal: &mockExpireDatabase{accounts: accounts}}
+		_, err := r.ExpireAccounts(time.Hour, ExpireOptions{AccountID: "account-z"})
+		var unknownAccountErr ErrUnknownAccount
+		if !errors.As(err, &unknownAccountErr) {
+			t.Errorf("Unexpected error %v", err)
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		r := &persistenceLayer{dal: &mockExpireDatabase{err: errors.New("did not work")}}
+		if _, err := r.ExpireAccounts(time.Hour, ExpireOptions{}); err == nil {
+			t.Error("Expected error")
 		}
 	})
 }
@@ -0,0 +1,225 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/oklog/ulid"
+)
+
+// accountExportVersion is incremented whenever the format of account exports
+// changes in a way that prevents older exports from being imported.
+const accountExportVersion = 1
+
+func (p *persistenceLayer) Export(userID string) (ExportResult, error) {
+	accounts, err := p.dal.FindAccounts(FindAccountsQueryAllAccounts{})
+	if err != nil {
+		return ExportResult{}, fmt.Errorf("persistence: error looking up all accounts: %w", err)
+	}
+	if err := p.migrateUserSalts(userID, accounts); err != nil {
+		return ExportResult{}, err
+	}
+
+	var secretIDs []string
+	resultsBySecretID := map[string]*ExportAccountResult{}
+	for _, account := range accounts {
+		secretID, err := p.hashUserID(account, userID)
+		if err != nil {
+			return ExportResult{}, fmt.Errorf("persistence: error hashing user id: %w", err)
+		}
+		secret, err := p.dal.FindSecret(FindSecretQueryBySecretID(secretID))
+		if err != nil {
+			var unknownSecretErr ErrUnknownSecret
+			if !errors.As(err, &unknownSecretErr) {
+				return ExportResult{}, fmt.Errorf("persistence: error looking up user secret: %w", err)
+			}
+		}
+		secretIDs = append(secretIDs, secretID)
+		resultsBySecretID[secretID] = &ExportAccountResult{
+			AccountID:           account.AccountID,
+			SecretID:            secretID,
+			EncryptedUserSecret: secret.EncryptedSecret,
+			Events:              []ExportEventResult{},
+		}
+		// archived events are not migrated when rotating the user salt
+		if account.PreviousUserSalt != "" {
+			previousSecretID, err := account.hashUserIDWithPreviousSalt(userID, p.userIDPepper)
+			if err != nil {
+				return ExportResult{}, fmt.Errorf("persistence: error hashing user id with previous salt: %w", err)
+			}
+			resultsBySecretID[previousSecretID] = resultsBySecretID[secretID]
+		}
+	}
+
+	if len(secretIDs) != 0 {
+		events, err := p.dal.FindEvents(FindEventsQueryForSecretIDs{SecretIDs: secretIDs})
+		if err != nil {
+			return ExportResult{}, fmt.Errorf("persistence: error looking up events: %w", err)
+		}
+		for _, evt := range events {
+			if evt.SecretID == nil {
+				continue
+			}
+			if match, ok := resultsBySecretID[*evt.SecretID]; ok {
+				match.Events = append(match.Events, newExportEventResult(evt.EventID, evt.Payload))
+			}
+		}
+	}
+
+	if p.archive != nil {
+		for _, account := range accounts {
+			_, bundles, err := p.readArchive(account.AccountID)
+			if err != nil {
+				return ExportResult{}, err
+			}
+			for _, bundle := range bundles {
+				for _, evt := range bundle.Events {
+					if evt.SecretID == nil {
+						continue
+					}
+					if match, ok := resultsBySecretID[*evt.SecretID]; ok {
+						match.Events = append(match.Events, newExportEventResult(evt.EventID, evt.Payload))
+						if match.EncryptedUserSecret == "" {
+							match.EncryptedUserSecret = evt.EncryptedSecret
+						}
+					}
+				}
+			}
+		}
+	}
+
+	result := ExportResult{
+		UserID:   userID,
+		Created:  time.Now().UTC(),
+		Accounts: []ExportAccountResult{},
+	}
+	for _, match := range resultsBySecretID {
+		// accounts are only included in case the user has actually been
+		// interacting with them
+		if match.EncryptedUserSecret == "" && len(match.Events) == 0 {
+			continue
+		}
+		result.Accounts = append(result.Accounts, *match)
+	}
+	sort.Slice(result.Accounts, func(i, j int) bool {
+		return result.Accounts[i].AccountID < result.Accounts[j].AccountID
+	})
+	return result, nil
+}
+
+func newExportEventResult(eventID, payload string) ExportEventResult {
+	result := ExportEventResult{
+		EventID: eventID,
+		Payload: payload,
+	}
+	if id, err := ulid.Parse(eventID); err == nil {
+		result.Timestamp = ulid.Time(id.Time()).UTC()
+	}
+	return result
+}
+
+// ExportAccount collects all data stored about the account of the given id, so
+// it can be imported into another instance. The given credentials need to
+// belong to an account user with access to the account, as they are required
+// for decrypting the account's key encryption key. In case an archive is
+// configured, archived events are included too.
+func (p *persistenceLayer) ExportAccount(accountID, emailAddress, password string) (AccountExport, error) {
+	key, err := p.decryptKeyEncryptionKey(accountID, emailAddress, password)
+	if err != nil {
+		return AccountExport{}, err
+	}
+
+	account, err := p.dal.FindAccount(FindAccountQueryIncludeEvents{AccountID: accountID})
+	if err != nil {
+		return AccountExport{}, fmt.Errorf("persistence: error looking up account data: %w", err)
+	}
+	if account.Retired {
+		return AccountExport{}, ErrUnknownAccount(fmt.Sprintf("persistence: account %s is retired", accountID))
+	}
+
+	result := AccountExport{
+		Version:             accountExportVersion,
+		Created:             time.Now().UTC(),
+		AccountID:           account.AccountID,
+		Name:                account.Name,
+		AccountCreated:      account.Created,
+		PublicKey:           account.PublicKey,
+		EncryptedPrivateKey: account.EncryptedPrivateKey,
+		KeyAlgorithm:        account.KeyAlgorithm,
+		UserSalt:            account.UserSalt,
+		PreviousUserSalt:    account.PreviousUserSalt,
+		KeyEncryptionKey:    base64.StdEncoding.EncodeToString(key),
+		EncryptedSettings:   account.EncryptedSettings,
+		EventQuota:          account.EventQuota,
+		Secrets:             EncryptedSecretsByID{},
+		Events:              []AccountExportEvent{},
+	}
+	if account.Retention > 0 {
+		result.Retention = account.Retention.String()
+	}
+	domains, err := account.domains()
+	if err != nil {
+		return AccountExport{}, err
+	}
+	for _, domain := range domains {
+		result.Domains = append(result.Domains, domain.Domain)
+	}
+	if result.Banner, err = account.banner(); err != nil {
+		return AccountExport{}, err
+	}
+	for _, deprecated := range account.DeprecatedKeys {
+		result.DeprecatedKeys = append(result.DeprecatedKeys, AccountExportKey{
+			KeyID:               deprecated.KeyID,
+			PublicKey:           deprecated.PublicKey,
+			EncryptedPrivateKey: deprecated.EncryptedPrivateKey,
+			KeyAlgorithm:        deprecated.KeyAlgorithm,
+			Deprecated:          deprecated.Deprecated,
+		})
+	}
+
+	for _, evt := range account.Events {
+		result.Events = append(result.Events, AccountExportEvent{
+			EventID:  evt.EventID,
+			Sequence: evt.Sequence,
+			SecretID: evt.SecretID,
+			Payload:  evt.Payload,
+		})
+		if evt.SecretID != nil && evt.Secret.EncryptedSecret != "" {
+			result.Secrets[*evt.SecretID] = evt.Secret.EncryptedSecret
+		}
+	}
+
+	if p.archive != nil {
+		_, bundles, err := p.readArchive(accountID)
+		if err != nil {
+			return AccountExport{}, err
+		}
+		for _, bundle := range bundles {
+			for _, evt := range bundle.Events {
+				result.Events = append(result.Events, AccountExportEvent{
+					EventID:  evt.EventID,
+					Sequence: evt.Sequence,
+					SecretID: evt.SecretID,
+					Payload:  evt.Payload,
+				})
+				if evt.SecretID == nil || evt.EncryptedSecret == "" {
+					continue
+				}
+				if _, ok := result.Secrets[*evt.SecretID]; !ok {
+					result.Secrets[*evt.SecretID] = evt.EncryptedSecret
+				}
+			}
+		}
+	}
+
+	sort.Slice(result.Events, func(i, j int) bool {
+		return result.Events[i].EventID < result.Events[j].EventID
+	})
+	return result, nil
+}
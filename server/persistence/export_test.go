@@ -0,0 +1,118 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type mockExportDatabase struct {
+	DataAccessLayer
+	findAccountsResult []Account
+	findAccountsErr    error
+	secrets            map[string]string
+	findEventsResult   []Event
+	findEventsErr      error
+}
+
+func (m *mockExportDatabase) FindAccounts(interface{}) ([]Account, error) {
+	return m.findAccountsResult, m.findAccountsErr
+}
+
+func (m *mockExportDatabase) FindSecret(q interface{}) (Secret, error) {
+	secretID := string(q.(FindSecretQueryBySecretID))
+	if secret, ok := m.secrets[secretID]; ok {
+		return Secret{SecretID: secretID, EncryptedSecret: secret}, nil
+	}
+	return Secret{}, ErrUnknownSecret("not found")
+}
+
+func (m *mockExportDatabase) FindEvents(interface{}) ([]Event, error) {
+	return m.findEventsResult, m.findEventsErr
+}
+
+func TestPersistenceLayer_Export(t *testing.T) {
+	accountA := Account{AccountID: "account-a", UserSalt: "{1,} JF+rNeViJeJb0jth6ZheWg=="}
+	accountB := Account{AccountID: "account-b", UserSalt: "{1,} D6xdWYfRqbuWrkg4OWVgGQ=="}
+	accountC := Account{AccountID: "account-c", UserSalt: "{1,} pCbBkAYBWl2NKR3KDDC3Pw=="}
+	secretA, _ := accountA.HashUserID("user-id", nil)
+	secretB, _ := accountB.HashUserID("user-id", nil)
+	eventID, _ := EventIDAt(time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name           string
+		db             *mockExportDatabase
+		expectedResult []ExportAccountResult
+		expectError    bool
+	}{
+		{
+			"account lookup error",
+			&mockExportDatabase{
+				findAccountsErr: errors.New("did not work"),
+			},
+			nil,
+			true,
+		},
+		{
+			"event lookup error",
+			&mockExportDatabase{
+				findAccountsResult: []Account{accountA},
+				findEventsErr:      errors.New("did not work"),
+			},
+			nil,
+			true,
+		},
+		{
+			"ok",
+			&mockExportDatabase{
+				findAccountsResult: []Account{accountB, accountA, accountC},
+				secrets: map[string]string{
+					secretA: "secret-a",
+					secretB: "secret-b",
+				},
+				findEventsResult: []Event{
+					{EventID: eventID, AccountID: "account-a", SecretID: &secretA, Payload: "payload"},
+				},
+			},
+			[]ExportAccountResult{
+				{
+					AccountID:           "account-a",
+					SecretID:            secretA,
+					EncryptedUserSecret: "secret-a",
+					Events: []ExportEventResult{
+						{EventID: eventID, Payload: "payload", Timestamp: time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)},
+					},
+				},
+				{
+					AccountID:           "account-b",
+					SecretID:            secretB,
+					EncryptedUserSecret: "secret-b",
+					Events:              []ExportEventResult{},
+				},
+			},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &persistenceLayer{dal: test.db}
+			result, err := p.Export("user-id")
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if test.expectError {
+				return
+			}
+			if result.UserID != "user-id" {
+				t.Errorf("Unexpected user id %v", result.UserID)
+			}
+			if !reflect.DeepEqual(test.expectedResult, result.Accounts) {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result.Accounts)
+			}
+		})
+	}
+}
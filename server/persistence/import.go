@@ -0,0 +1,211 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"time"
+
+	uuid "github.com/gofrs/uuid"
+	"github.com/offen/offen/server/keys"
+	"github.com/oklog/ulid"
+)
+
+// ImportAccount creates an account from an export that has been created by
+// another instance, keeping the original identifiers of the account, its user
+// secrets and events. The account user with the given credentials is granted
+// admin access to the imported account.
+func (p *persistenceLayer) ImportAccount(data AccountExport, emailAddress, password string) error {
+	if data.Version != accountExportVersion {
+		return fmt.Errorf("persistence: unsupported account export version %d", data.Version)
+	}
+	if _, err := uuid.FromString(data.AccountID); err != nil {
+		return fmt.Errorf("persistence: received malformed account id, expected valid uuid: %w", err)
+	}
+	if data.Name == "" {
+		return fmt.Errorf("persistence: cannot import an account with an empty name")
+	}
+	for _, evt := range data.Events {
+		if _, err := ulid.Parse(evt.EventID); err != nil {
+			return fmt.Errorf("persistence: received malformed event id %s: %w", evt.EventID, err)
+		}
+	}
+	if data.KeyAlgorithm != "" && !keys.IsKnownKeyAlgorithm(data.KeyAlgorithm) {
+		return fmt.Errorf("persistence: received unknown key algorithm %s", data.KeyAlgorithm)
+	}
+	for _, deprecated := range data.DeprecatedKeys {
+		if _, err := uuid.FromString(deprecated.KeyID); err != nil {
+			return fmt.Errorf("persistence: received malformed key id, expected valid uuid: %w", err)
+		}
+		if deprecated.KeyAlgorithm != "" && !keys.IsKnownKeyAlgorithm(deprecated.KeyAlgorithm) {
+			return fmt.Errorf("persistence: received unknown key algorithm %s", deprecated.KeyAlgorithm)
+		}
+	}
+	var retention time.Duration
+	if data.Retention != "" {
+		var err error
+		retention, err = time.ParseDuration(data.Retention)
+		if err != nil {
+			return fmt.Errorf("persistence: error parsing retention of imported account: %w", err)
+		}
+	}
+	if data.EventQuota < 0 {
+		return fmt.Errorf("persistence: received invalid event quota %d for imported account", data.EventQuota)
+	}
+
+	var domains []AccountDomain
+	for _, domain := range data.Domains {
+		normalized, err := normalizeDomain(domain)
+		if err != nil {
+			return fmt.Errorf("persistence: received invalid domain for imported account: %w", err)
+		}
+		// verification is not carried over as it cannot be told whether the
+		// domain's token has been published
+		token, err := newDomainToken()
+		if err != nil {
+			return err
+		}
+		domains = append(domains, AccountDomain{Domain: normalized, Token: token})
+	}
+
+	if data.EncryptedSettings != "" {
+		if err := validateEncryptedSettings(data.EncryptedSettings); err != nil {
+			return fmt.Errorf("persistence: received invalid settings for imported account: %w", err)
+		}
+	}
+	if data.Banner != nil {
+		if err := data.Banner.validate(); err != nil {
+			return fmt.Errorf("persistence: received invalid banner for imported account: %w", err)
+		}
+	}
+
+	key, err := base64.StdEncoding.DecodeString(data.KeyEncryptionKey)
+	if err != nil {
+		return fmt.Errorf("persistence: error decoding key encryption key: %w", err)
+	}
+	// the key is not needed for decrypting, but this ensures it actually
+	// belongs to the imported account
+	if _, err := keys.DecryptWith(key, data.EncryptedPrivateKey); err != nil {
+		return fmt.Errorf("persistence: key encryption key does not match imported account: %w", err)
+	}
+
+	accountUser, err := p.findAccountUser(emailAddress, false, false)
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account user: %w", err)
+	}
+	if err := keys.CompareString(password, accountUser.HashedPassword); err != nil {
+		return fmt.Errorf("persistence: error comparing passwords: %w", err)
+	}
+
+	allAccounts, err := p.dal.FindAccounts(FindAccountsQueryAllAccounts{})
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up all existing accounts: %w", err)
+	}
+	for _, account := range allAccounts {
+		if account.AccountID == data.AccountID {
+			return fmt.Errorf("persistence: account with id %s already exists", data.AccountID)
+		}
+		if account.Name == data.Name {
+			return fmt.Errorf("persistence: account named %s already exists", data.Name)
+		}
+	}
+
+	relationship, err := newAccountUserRelationship(accountUser.AccountUserID, data.AccountID, AccountUserRoleAdmin)
+	if err != nil {
+		return fmt.Errorf("persistence: error creating relationship: %w", err)
+	}
+	if err := relationship.addEmailEncryptedKey(key, accountUser.Salt, emailAddress); err != nil {
+		return fmt.Errorf("persistence: error adding email encrypted key: %w", err)
+	}
+	if err := relationship.addPasswordEncryptedKey(key, accountUser.Salt, password); err != nil {
+		return fmt.Errorf("persistence: error adding password encrypted key: %w", err)
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	account := &Account{
+		AccountID:           data.AccountID,
+		Name:                data.Name,
+		PublicKey:           data.PublicKey,
+		EncryptedPrivateKey: data.EncryptedPrivateKey,
+		KeyAlgorithm:        data.KeyAlgorithm,
+		UserSalt:            data.UserSalt,
+		PreviousUserSalt:    data.PreviousUserSalt,
+		Created:             data.AccountCreated,
+		Retention:           retention,
+		EventQuota:          data.EventQuota,
+		EncryptedSettings:   data.EncryptedSettings,
+	}
+	if err := account.setDomains(domains); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error setting imported domains: %w", err)
+	}
+	if err := account.setBanner(data.Banner); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error setting imported banner: %w", err)
+	}
+	for _, deprecated := range data.DeprecatedKeys {
+		account.DeprecatedKeys = append(account.DeprecatedKeys, DeprecatedAccountKey{
+			KeyID:               deprecated.KeyID,
+			AccountID:           data.AccountID,
+			PublicKey:           deprecated.PublicKey,
+			EncryptedPrivateKey: deprecated.EncryptedPrivateKey,
+			KeyAlgorithm:        deprecated.KeyAlgorithm,
+			Deprecated:          deprecated.Deprecated,
+		})
+	}
+	if err := txn.CreateAccount(account); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error persisting imported account: %w", err)
+	}
+	if err := txn.CreateAccountUserRelationship(relationship); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error persisting relationship: %w", err)
+	}
+
+	var secretIDs []string
+	for secretID := range data.Secrets {
+		secretIDs = append(secretIDs, secretID)
+	}
+	sort.Strings(secretIDs)
+	for _, secretID := range secretIDs {
+		if err := txn.CreateSecret(&Secret{
+			SecretID:        secretID,
+			EncryptedSecret: data.Secrets[secretID],
+			Created:         time.Now(),
+		}); err != nil {
+			txn.Rollback()
+			return fmt.Errorf("persistence: error persisting imported user secret: %w", err)
+		}
+	}
+	for _, evt := range data.Events {
+		// imported events are new to this instance, so they are assigned
+		// a new sequence making them visible to clients and replicas that
+		// have already synced past their original one
+		sequence, err := NewULID()
+		if err != nil {
+			txn.Rollback()
+			return fmt.Errorf("persistence: error creating sequence for imported event: %w", err)
+		}
+		if err := txn.CreateEvent(&Event{
+			EventID:   evt.EventID,
+			Sequence:  sequence,
+			AccountID: data.AccountID,
+			SecretID:  evt.SecretID,
+			Payload:   evt.Payload,
+		}); err != nil {
+			txn.Rollback()
+			return fmt.Errorf("persistence: error persisting imported event %s: %w", evt.EventID, err)
+		}
+	}
+
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/keys"
+)
+
+type mockAccountTransferDatabase struct {
+	DataAccessLayer
+	accountUsers  []AccountUser
+	accounts      []Account
+	relationships []AccountUserRelationship
+	secrets       []Secret
+	events        []Event
+}
+
+func (m *mockAccountTransferDatabase) FindAccountUsers(interface{}) ([]AccountUser, error) {
+	var result []AccountUser
+	for _, accountUser := range m.accountUsers {
+		for _, relationship := range m.relationships {
+			if relationship.AccountUserID == accountUser.AccountUserID {
+				accountUser.Relationships = append(accountUser.Relationships, relationship)
+			}
+		}
+		result = append(result, accountUser)
+	}
+	return result, nil
+}
+
+func (m *mockAccountTransferDatabase) FindAccounts(interface{}) ([]Account, error) {
+	return m.accounts, nil
+}
+
+func (m *mockAccountTransferDatabase) FindAccount(q interface{}) (Account, error) {
+	query := q.(FindAccountQueryIncludeEvents)
+	for _, account := range m.accounts {
+		if account.AccountID != query.AccountID {
+			continue
+		}
+		for _, evt := range m.events {
+			if evt.AccountID != account.AccountID {
+				continue
+			}
+			for _, secret := range m.secrets {
+				if evt.SecretID != nil && secret.SecretID == *evt.SecretID {
+					evt.Secret = secret
+				}
+			}
+			account.Events = append(account.Events, evt)
+		}
+		return account, nil
+	}
+	return Account{}, ErrUnknownAccount("not found")
+}
+
+func (m *mockAccountTransferDatabase) CreateAccount(a *Account) error {
+	m.accounts = append(m.accounts, *a)
+	return nil
+}
+
+func (m *mockAccountTransferDatabase) CreateAccountUserRelationship(r *AccountUserRelationship) error {
+	m.relationships = append(m.relationships, *r)
+	return nil
+}
+
+func (m *mockAccountTransferDatabase) CreateSecret(s *Secret) error {
+	m.secrets = append(m.secrets, *s)
+	return nil
+}
+
+func (m *mockAccountTransferDatabase) CreateEvent(e *Event) error {
+	m.events = append(m.events, *e)
+	return nil
+}
+
+func (m *mockAccountTransferDatabase) Transaction() (Transaction, error) {
+	return &mockTxn{m}, nil
+}
+
+func newMockAccountUser(t *testing.T, accountUserID, email, password string) AccountUser {
+	hashedEmail, err := keys.HashString(email)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	hashedPassword, err := keys.HashString(password)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	salt, err := keys.NewSalt(keys.DefaultSecretLength)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return AccountUser{
+		AccountUserID:  accountUserID,
+		HashedEmail:    hashedEmail.Marshal(),
+		HashedPassword: hashedPassword.Marshal(),
+		Salt:           salt.Marshal(),
+	}
+}
+
+func TestPersistenceLayer_ExportImportAccount(t *testing.T) {
+	account, key, err := newAccount("transferred", "9b63c4d8-65c0-438c-9d30-cc4b01173393", newMockKeypairProvider(t, keys.KeyAlgorithmRSAOAEP), newMockUserSaltProvider(t))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	account.Retention = time.Hour * 24
+	sourceUser := newMockAccountUser(t, "source-user", "develop@offen.dev", "secret")
+	relationship, _ := newAccountUserRelationship(sourceUser.AccountUserID, account.AccountID, AccountUserRoleAdmin)
+	if err := relationship.addPasswordEncryptedKey(key, sourceUser.Salt, "secret"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	secretID := "secret-a"
+	source := &mockAccountTransferDatabase{
+		accountUsers:  []AccountUser{sourceUser},
+		accounts:      []Account{*account},
+		relationships: []AccountUserRelationship{*relationship},
+		secrets:       []Secret{{SecretID: secretID, EncryptedSecret: "encrypted-a"}},
+		events: []Event{
+			{EventID: "01F4Z2Q4B5C6D7E8F9G0H1J2K3", Sequence: "seq-b", AccountID: account.AccountID, SecretID: &secretID, Payload: "payload-b"},
+			{EventID: "01F4Z2Q4B5C6D7E8F9G0H1J2K0", Sequence: "seq-a", AccountID: account.AccountID, Payload: "anonymous"},
+		},
+	}
+
+	t.Run("export", func(t *testing.T) {
+		p := &persistenceLayer{dal: source}
+		if _, err := p.ExportAccount(account.AccountID, "develop@offen.dev", "other"); err == nil {
+			t.Error("Expected error when using bad password")
+		}
+		if _, err := p.ExportAccount("unknown-account", "develop@offen.dev", "secret"); err == nil {
+			t.Error("Expected error when exporting account without access")
+		}
+	})
+
+	p := &persistenceLayer{dal: source}
+	export, err := p.ExportAccount(account.AccountID, "develop@offen.dev", "secret")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if export.Retention != "24h0m0s" || len(export.Events) != 2 || export.Events[0].Sequence != "seq-a" {
+		t.Errorf("Unexpected export %v", export)
+	}
+	if !reflect.DeepEqual(EncryptedSecretsByID{secretID: "encrypted-a"}, export.Secrets) {
+		t.Errorf("Unexpected secrets %v", export.Secrets)
+	}
+
+	t.Run("import", func(t *testing.T) {
+		targetUser := newMockAccountUser(t, "target-user", "hioffen@posteo.de", "pass")
+		target := &mockAccountTransferDatabase{
+			accountUsers: []AccountUser{targetUser},
+		}
+		p := &persistenceLayer{dal: target}
+		if err := p.ImportAccount(export, "hioffen@posteo.de", "pass"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		if len(target.accounts) != 1 || target.accounts[0].AccountID != account.AccountID || target.accounts[0].UserSalt != account.UserSalt || target.accounts[0].Retention != account.Retention {
+			t.Errorf("Unexpected accounts %v", target.accounts)
+		}
+		for i := range target.secrets {
+			if target.secrets[i].Created.IsZero() {
+				t.Errorf("Expected creation time to be set for %v", target.secrets[i])
+			}
+			target.secrets[i].Created = time.Time{}
+		}
+		if !reflect.DeepEqual(source.secrets, target.secrets) {
+			t.Errorf("Unexpected secrets %v", target.secrets)
+		}
+		if len(target.events) != 2 || target.events[1].EventID != source.events[0].EventID || *target.events[1].SecretID != secretID {
+			t.Errorf("Unexpected events %v", target.events)
+		}
+		if len(target.relationships) != 1 {
+			t.Fatalf("Unexpected relationships %v", target.relationships)
+		}
+		derivedKey, _ := keys.DeriveKey("pass", targetUser.Salt)
+		importedKey, err := keys.DecryptWith(derivedKey, target.relationships[0].PasswordEncryptedKeyEncryptionKey)
+		if err != nil {
+			t.Fatalf("Unexpected error decrypting imported key %v", err)
+		}
+		if !reflect.DeepEqual(key, importedKey) {
+			t.Errorf("Expected imported key to match original key")
+		}
+
+		if err := p.ImportAccount(export, "hioffen@posteo.de", "pass"); err == nil {
+			t.Error("Expected error when importing existing account")
+		}
+	})
+
+	t.Run("bad import", func(t *testing.T) {
+		otherAccount, _, _ := newAccount("other", "", newMockKeypairProvider(t, keys.KeyAlgorithmRSAOAEP), newMockUserSaltProvider(t))
+		for name, mutate := range map[string]func(*AccountExport){
+			"bad version":    func(e *AccountExport) { e.Version = 12 },
+			"bad account id": func(e *AccountExport) { e.AccountID = "account-z" },
+			"bad event id":   func(e *AccountExport) { e.Events = []AccountExportEvent{{EventID: "event-z"}} },
+			"key mismatch":   func(e *AccountExport) { e.EncryptedPrivateKey = otherAccount.EncryptedPrivateKey },
+			"bad banner":     func(e *AccountExport) { e.Banner = &AccountBanner{Theme: &BannerTheme{Text: "red"}} },
+			"bad algorithm":  func(e *AccountExport) { e.KeyAlgorithm = "nacl-box" },
+		} {
+			t.Run(name, func(t *testing.T) {
+				target := &mockAccountTransferDatabase{
+					accountUsers: []AccountUser{newMockAccountUser(t, "target-user", "hioffen@posteo.de", "pass")},
+				}
+				data := export
+				mutate(&data)
+				p := &persistenceLayer{dal: target}
+				if err := p.ImportAccount(data, "hioffen@posteo.de", "pass"); err == nil {
+					t.Error("Expected error, got nil")
+				}
+				if len(target.accounts) != 0 {
+					t.Errorf("Unexpected accounts %v", target.accounts)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,139 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/oklog/ulid"
+)
+
+// InboundEventMetadata describes an event that is about to be stored. It
+// does not contain the event's payload, which cannot be decrypted by the
+// server anyways.
+type InboundEventMetadata struct {
+	AccountID string `json:"accountId"`
+	// HashedUserID is empty for anonymous events
+	HashedUserID string `json:"hashedUserId,omitempty"`
+	EventID      string `json:"eventId"`
+	// Created is the time encoded in the event id, which might have been
+	// created by the client.
+	Created     time.Time `json:"created"`
+	Received    time.Time `json:"received"`
+	PayloadSize int       `json:"payloadSize"`
+}
+
+// IngestVerdict is the outcome of inspecting an inbound event.
+type IngestVerdict struct {
+	// Reject prevents the event from being stored.
+	Reject bool `json:"reject"`
+	// Flag stores the event, but reports it to the configured flag handler.
+	Flag   bool   `json:"flag"`
+	Reason string `json:"reason"`
+}
+
+// IngestHook inspects inbound events before they are stored and can either
+// reject or flag them. Hooks are called concurrently and before the event is
+// persisted, so they need to return quickly.
+type IngestHook interface {
+	InspectEvent(meta InboundEventMetadata) IngestVerdict
+}
+
+// IngestHookFunc adapts a function to be used as an IngestHook.
+type IngestHookFunc func(meta InboundEventMetadata) IngestVerdict
+
+// InspectEvent calls fn.
+func (fn IngestHookFunc) InspectEvent(meta InboundEventMetadata) IngestVerdict {
+	return fn(meta)
+}
+
+// maxIngestVerdictSize is the maximum number of bytes that are read from the
+// response of a remote ingest hook.
+const maxIngestVerdictSize = 4096
+
+// NewRemoteIngestHook creates an IngestHook that posts the metadata of each
+// inbound event as JSON to the given URL and expects the verdict to be
+// returned as JSON. A hook that cannot be reached must not prevent events
+// from being stored, so events are accepted in case the request fails or
+// does not finish within the given timeout, passing the error to onError.
+func NewRemoteIngestHook(url string, timeout time.Duration, onError func(error)) IngestHook {
+	if onError == nil {
+		onError = func(error) {}
+	}
+	client := &http.Client{Timeout: timeout}
+	return IngestHookFunc(func(meta InboundEventMetadata) IngestVerdict {
+		verdict, err := requestIngestVerdict(client, url, meta)
+		if err != nil {
+			onError(err)
+			return IngestVerdict{}
+		}
+		return verdict
+	})
+}
+
+func requestIngestVerdict(client *http.Client, url string, meta InboundEventMetadata) (IngestVerdict, error) {
+	body, err := json.Marshal(meta)
+	if err != nil {
+		return IngestVerdict{}, fmt.Errorf("persistence: error encoding event metadata: %w", err)
+	}
+	res, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return IngestVerdict{}, fmt.Errorf("persistence: error calling ingest hook: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return IngestVerdict{}, fmt.Errorf("persistence: ingest hook responded with status %d", res.StatusCode)
+	}
+	var verdict IngestVerdict
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxIngestVerdictSize)).Decode(&verdict); err != nil {
+		return IngestVerdict{}, fmt.Errorf("persistence: error decoding verdict of ingest hook: %w", err)
+	}
+	return verdict, nil
+}
+
+// WithIngestHooks configures the persistence layer to pass the metadata of
+// each inbound event to the given hooks. Hooks are called in the given order
+// and the first hook rejecting an event stops further inspection. Flagged
+// events are passed to onFlag, which might be nil.
+func WithIngestHooks(onFlag func(meta InboundEventMetadata, reason string), hooks ...IngestHook) Config {
+	return func(p *persistenceLayer) {
+		p.ingestHooks = hooks
+		p.onFlag = onFlag
+	}
+}
+
+// inspectEvent runs all configured hooks against the given event, returning
+// ErrEventRejected in case the event must not be stored.
+func (p *persistenceLayer) inspectEvent(evt *Event) error {
+	if len(p.ingestHooks) == 0 {
+		return nil
+	}
+	meta := InboundEventMetadata{
+		AccountID:   evt.AccountID,
+		EventID:     evt.EventID,
+		Received:    time.Now(),
+		PayloadSize: len(evt.Payload),
+	}
+	if evt.SecretID != nil {
+		meta.HashedUserID = *evt.SecretID
+	}
+	if id, err := ulid.Parse(evt.EventID); err == nil {
+		meta.Created = ulid.Time(id.Time())
+	}
+	for _, hook := range p.ingestHooks {
+		verdict := hook.InspectEvent(meta)
+		if verdict.Reject {
+			return ErrEventRejected(fmt.Sprintf("persistence: event %s has been rejected: %s", evt.EventID, verdict.Reason))
+		}
+		if verdict.Flag && p.onFlag != nil {
+			p.onFlag(meta, verdict.Reason)
+		}
+	}
+	return nil
+}
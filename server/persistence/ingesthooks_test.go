@@ -0,0 +1,129 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPersistenceLayer_Insert_IngestHooks(t *testing.T) {
+	db := &mockInsertEventIDDatabase{
+		account: Account{
+			AccountID: "account-id",
+			UserSalt:  "{1,} CaHVhk78uhoPmf5wanA0vg==",
+		},
+	}
+	var inspected []InboundEventMetadata
+	var flagged []string
+	p := &persistenceLayer{dal: db}
+	WithIngestHooks(
+		func(meta InboundEventMetadata, reason string) {
+			flagged = append(flagged, reason)
+		},
+		IngestHookFunc(func(meta InboundEventMetadata) IngestVerdict {
+			inspected = append(inspected, meta)
+			return IngestVerdict{Flag: meta.PayloadSize > 10, Reason: "large"}
+		}),
+		IngestHookFunc(func(meta InboundEventMetadata) IngestVerdict {
+			return IngestVerdict{Reject: meta.PayloadSize > 20, Reason: "too large"}
+		}),
+	)(p)
+
+	if err := p.Insert("user-id", "account-id", "payload", nil); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := p.Insert("user-id", "account-id", "flagged payload", nil); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	err := p.Insert("user-id", "account-id", "payload that is rejected", nil)
+	var rejectedErr ErrEventRejected
+	if !errors.As(err, &rejectedErr) {
+		t.Errorf("Expected rejection, got %v", err)
+	}
+
+	if len(db.events) != 2 {
+		t.Errorf("Expected two events to be created, got %v", db.events)
+	}
+	if len(flagged) != 2 || flagged[0] != "large" {
+		t.Errorf("Unexpected flags %v", flagged)
+	}
+	if len(inspected) != 3 {
+		t.Fatalf("Unexpected inspections %v", inspected)
+	}
+	meta := inspected[0]
+	if meta.AccountID != "account-id" || meta.HashedUserID == "" || meta.HashedUserID == "user-id" || meta.Created.IsZero() || meta.PayloadSize != 7 {
+		t.Errorf("Unexpected metadata %v", meta)
+	}
+}
+
+func TestNewRemoteIngestHook(t *testing.T) {
+	tests := []struct {
+		name            string
+		handler         http.HandlerFunc
+		expectedVerdict IngestVerdict
+		expectError     bool
+	}{
+		{
+			"reject",
+			func(w http.ResponseWriter, r *http.Request) {
+				var meta InboundEventMetadata
+				if err := json.NewDecoder(r.Body).Decode(&meta); err != nil || meta.AccountID != "account-a" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				w.Write([]byte(`{"reject":true,"reason":"spam"}`))
+			},
+			IngestVerdict{Reject: true, Reason: "spam"},
+			false,
+		},
+		{
+			"flag",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"flag":true,"reason":"suspicious"}`))
+			},
+			IngestVerdict{Flag: true, Reason: "suspicious"},
+			false,
+		},
+		{
+			"bad status",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(`{"reject":true}`))
+			},
+			IngestVerdict{},
+			true,
+		},
+		{
+			"timeout",
+			func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(time.Millisecond * 100)
+				w.Write([]byte(`{"reject":true}`))
+			},
+			IngestVerdict{},
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(test.handler)
+			defer server.Close()
+			var hookErr error
+			hook := NewRemoteIngestHook(server.URL, time.Millisecond*50, func(err error) {
+				hookErr = err
+			})
+			verdict := hook.InspectEvent(InboundEventMetadata{AccountID: "account-a"})
+			if verdict != test.expectedVerdict {
+				t.Errorf("Expected %v, got %v", test.expectedVerdict, verdict)
+			}
+			if (hookErr != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", hookErr)
+			}
+		})
+	}
+}
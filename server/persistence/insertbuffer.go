@@ -0,0 +1,207 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrInsertBufferFull is returned by Insert when events are buffered and the
+// buffer cannot take any more events.
+var ErrInsertBufferFull = errors.New("persistence: insert buffer is full")
+
+// errInsertBufferClosed is returned by Insert after the service has been
+// closed.
+var errInsertBufferClosed = errors.New("persistence: insert buffer is closed")
+
+// insertBufferTimeout is the maximum time Insert waits for space in a full
+// buffer before giving up.
+const insertBufferTimeout = time.Second
+
+// BufferedEvent is an event that has been accepted by Insert but is not
+// yet persisted.
+type BufferedEvent struct {
+	UserID    string
+	AccountID string
+	Payload   string
+	EventID   string
+	event     *Event
+}
+
+// insertBuffer queues events in memory so they can be written to the
+// database in batches.
+type insertBuffer struct {
+	queue     chan BufferedEvent
+	batchSize int
+	interval  time.Duration
+	onError   func([]BufferedEvent, error)
+	closed    bool
+	lock      sync.RWMutex
+	wg        sync.WaitGroup
+	// pending contains the ids of all events that are queued but not yet
+	// written, so retried submissions are not queued twice
+	pending     map[string]bool
+	pendingLock sync.Mutex
+}
+
+// WithInsertBuffer makes Insert return as soon as the event has been validated
+// and queued in memory. Queued events are written in batches of the given
+// size, or after the given interval has passed. In case writing a batch
+// fails, the events and the error are passed to onError, as they cannot be
+// reported to the caller of Insert anymore. Close needs to be called for
+// writing events that are still pending.
+func WithInsertBuffer(capacity, batchSize int, interval time.Duration, onError func([]BufferedEvent, error)) Config {
+	if onError == nil {
+		onError = func([]BufferedEvent, error) {}
+	}
+	return func(p *persistenceLayer) {
+		p.inserts = &insertBuffer{
+			queue:     make(chan BufferedEvent, capacity),
+			batchSize: batchSize,
+			interval:  interval,
+			onError:   onError,
+			pending:   map[string]bool{},
+		}
+	}
+}
+
+// push queues the given event which has already been prepared for being
+// written.
+func (b *insertBuffer) push(userID string, evt *Event) error {
+	buffered := BufferedEvent{
+		UserID:    userID,
+		AccountID: evt.AccountID,
+		Payload:   evt.Payload,
+		EventID:   evt.EventID,
+		event:     evt,
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.closed {
+		return errInsertBufferClosed
+	}
+
+	if !b.markPending(evt.EventID) {
+		return nil
+	}
+	select {
+	case b.queue <- buffered:
+		return nil
+	default:
+	}
+	timer := time.NewTimer(insertBufferTimeout)
+	defer timer.Stop()
+	select {
+	case b.queue <- buffered:
+		return nil
+	case <-timer.C:
+		b.clearPending([]BufferedEvent{buffered})
+		return ErrInsertBufferFull
+	}
+}
+
+// markPending records the given event id as pending. In case it is already
+// pending, false is returned.
+func (b *insertBuffer) markPending(eventID string) bool {
+	b.pendingLock.Lock()
+	defer b.pendingLock.Unlock()
+	if b.pending == nil {
+		b.pending = map[string]bool{}
+	}
+	if b.pending[eventID] {
+		return false
+	}
+	b.pending[eventID] = true
+	return true
+}
+
+func (b *insertBuffer) clearPending(events []BufferedEvent) {
+	b.pendingLock.Lock()
+	defer b.pendingLock.Unlock()
+	for _, evt := range events {
+		delete(b.pending, evt.EventID)
+	}
+}
+
+// clearPendingIDs removes the ids of the given events that have been written
+// without being queued.
+func (b *insertBuffer) clearPendingIDs(events []*Event) {
+	b.pendingLock.Lock()
+	defer b.pendingLock.Unlock()
+	for _, evt := range events {
+		delete(b.pending, evt.EventID)
+	}
+}
+
+func (b *insertBuffer) start(flush func([]BufferedEvent)) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		ticker := time.NewTicker(b.interval)
+		defer ticker.Stop()
+
+		var batch []BufferedEvent
+		for {
+			select {
+			case evt, ok := <-b.queue:
+				if !ok {
+					if len(batch) != 0 {
+						flush(batch)
+					}
+					return
+				}
+				batch = append(batch, evt)
+				if len(batch) >= b.batchSize {
+					flush(batch)
+					batch = nil
+				}
+			case <-ticker.C:
+				if len(batch) != 0 {
+					flush(batch)
+					batch = nil
+				}
+			}
+		}
+	}()
+}
+
+func (b *insertBuffer) close() {
+	b.lock.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.queue)
+	}
+	b.lock.Unlock()
+	b.wg.Wait()
+}
+
+// insertBatch writes the given events using a single multi-row insert. Events
+// have been validated before being queued, so in case the batch cannot be
+// written, all of its events are passed to the error handler.
+func (p *persistenceLayer) insertBatch(batch []BufferedEvent) {
+	defer p.inserts.clearPending(batch)
+	events := make([]*Event, len(batch))
+	for i, buffered := range batch {
+		events[i] = buffered.event
+	}
+	if err := p.dal.CreateEvents(events); err != nil {
+		p.inserts.onError(batch, fmt.Errorf("persistence: error inserting batch of events: %w", err))
+		return
+	}
+	p.touchAccounts(events)
+}
+
+func (p *persistenceLayer) Close() error {
+	if p.inserts != nil {
+		p.inserts.close()
+	}
+	if p.saltMigrations != nil {
+		p.saltMigrations.close()
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mockInsertBufferDatabase struct {
+	DataAccessLayer
+	lock   sync.Mutex
+	events []Event
+}
+
+func (m *mockInsertBufferDatabase) UpdateAccounts(interface{}) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockInsertBufferDatabase) FindAccount(q interface{}) (Account, error) {
+	if string(q.(FindAccountQueryActiveByID)) != "account-id" {
+		return Account{}, ErrUnknownAccount("unknown account")
+	}
+	return Account{AccountID: "account-id", UserSalt: "{1,} CaHVhk78uhoPmf5wanA0vg=="}, nil
+}
+
+func (m *mockInsertBufferDatabase) FindSecret(interface{}) (Secret, error) {
+	return Secret{}, nil
+}
+
+func (m *mockInsertBufferDatabase) FindEvents(interface{}) ([]Event, error) {
+	return nil, nil
+}
+
+func (m *mockInsertBufferDatabase) CountEvents(interface{}) ([]EventCount, error) {
+	return nil, nil
+}
+
+func (m *mockInsertBufferDatabase) CreateEvents(events []*Event) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, e := range events {
+		m.events = append(m.events, *e)
+	}
+	return nil
+}
+
+func TestPersistenceLayer_InsertBuffer(t *testing.T) {
+	db := &mockInsertBufferDatabase{}
+	var failed []BufferedEvent
+	var failedErr error
+	p, err := New(db, WithInsertBuffer(10, 2, time.Hour, func(events []BufferedEvent, err error) {
+		failed = append(failed, events...)
+		failedErr = err
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	eventID := "01F4Z2Q4B5C6D7E8F9G0H1J2K0"
+	for _, args := range [][]string{
+		{"user-a", "account-id"},
+		{"user-b", "account-id"},
+		{"", "account-id"},
+	} {
+		if err := p.Insert(args[0], args[1], "payload", nil); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+	if err := p.Insert("user-c", "account-id", "payload", &eventID); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := p.Insert("user-c", "account-id", "payload", &eventID); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	var unknownAccountErr ErrUnknownAccount
+	if err := p.Insert("user-a", "unknown-account-id", "payload", nil); !errors.As(err, &unknownAccountErr) {
+		t.Errorf("Expected unknown account to be reported on insert, got %v", err)
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatalf("Unexpected error closing %v", err)
+	}
+	if len(db.events) != 4 {
+		t.Errorf("Expected pending events to be written on close, got %v", db.events)
+	}
+	var found bool
+	for _, evt := range db.events {
+		if evt.EventID == eventID {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected given event id to be used, got %v", db.events)
+	}
+
+	if len(failed) != 0 || failedErr != nil {
+		t.Errorf("Unexpected failed events %v, %v", failed, failedErr)
+	}
+
+	if err := p.Insert("user-a", "account-id", "payload", nil); err == nil {
+		t.Error("Expected error when inserting after close")
+	}
+}
+
+func TestPersistenceLayer_InsertBuffer_Quota(t *testing.T) {
+	p, err := New(&mockInsertBufferDatabase{}, WithInsertBuffer(10, 2, time.Hour, nil), WithEventQuota(1))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("Unexpected error closing %v", err)
+	}
+	if err := p.Insert("user-a", "account-id", "payload", nil); err == nil {
+		t.Error("Expected error when inserting after close")
+	}
+	used, _, _ := p.(*persistenceLayer).quotas.usage(quotaDay(time.Now()), "account-id")
+	if used != 0 {
+		t.Errorf("Expected rejected event not to count towards quota, got %d", used)
+	}
+}
+
+func TestInsertBuffer_Full(t *testing.T) {
+	b := &insertBuffer{queue: make(chan BufferedEvent, 1)}
+	if err := b.push("user-a", &Event{AccountID: "account-id", Payload: "payload", EventID: "event-a"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := b.push("user-a", &Event{AccountID: "account-id", Payload: "payload", EventID: "event-a"}); err != nil {
+		t.Errorf("Expected pending event to be skipped, got %v", err)
+	}
+	if err := b.push("user-a", &Event{AccountID: "account-id", Payload: "payload", EventID: "event-b"}); !errors.Is(err, ErrInsertBufferFull) {
+		t.Errorf("Expected buffer to be full, got %v", err)
+	}
+}
@@ -0,0 +1,21 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+	"time"
+)
+
+func (p *persistenceLayer) AcquireJobLock(name, holder string, expires time.Time) (bool, error) {
+	acquired, err := p.dal.AcquireJobLock(&JobLock{
+		Name:    name,
+		Holder:  holder,
+		Expires: expires,
+	}, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("persistence: error acquiring lock for job %s: %w", name, err)
+	}
+	return acquired, nil
+}
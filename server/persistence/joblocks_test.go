@@ -0,0 +1,64 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type mockAcquireJobLockDatabase struct {
+	DataAccessLayer
+	acquired bool
+	err      error
+}
+
+func (m *mockAcquireJobLockDatabase) AcquireJobLock(*JobLock, time.Time) (bool, error) {
+	return m.acquired, m.err
+}
+
+func TestPersistenceLayer_AcquireJobLock(t *testing.T) {
+	tests := []struct {
+		name             string
+		db               *mockAcquireJobLockDatabase
+		expectedAcquired bool
+		expectError      bool
+	}{
+		{
+			"database error",
+			&mockAcquireJobLockDatabase{
+				err: errors.New("did not work"),
+			},
+			false,
+			true,
+		},
+		{
+			"held elsewhere",
+			&mockAcquireJobLockDatabase{},
+			false,
+			false,
+		},
+		{
+			"ok",
+			&mockAcquireJobLockDatabase{
+				acquired: true,
+			},
+			true,
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &persistenceLayer{dal: test.db}
+			acquired, err := p.AcquireJobLock("expire", "instance-a", time.Now().Add(time.Hour))
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if acquired != test.expectedAcquired {
+				t.Errorf("Expected %v, got %v", test.expectedAcquired, acquired)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+
+	"github.com/offen/offen/server/keys"
+)
+
+// VerifyAccountKeys checks that the encrypted private keys of all accounts the
+// account user with the given credentials can access can be decrypted and
+// belong to the public keys stored alongside them. Deprecated keys are
+// checked as well. Problems with single keys are reported in the results
+// instead of returning an error.
+func (p *persistenceLayer) VerifyAccountKeys(emailAddress, password string) ([]KeyCheckResult, error) {
+	accountUser, err := p.findAccountUser(emailAddress, true, false)
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up account user: %w", err)
+	}
+	if err := keys.CompareString(password, accountUser.HashedPassword); err != nil {
+		return nil, fmt.Errorf("persistence: error comparing passwords: %w", err)
+	}
+	pwDerivedKey, err := keys.DeriveKey(password, accountUser.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error deriving key from password: %w", err)
+	}
+
+	results := []KeyCheckResult{}
+	for _, relationship := range accountUser.Relationships {
+		account, err := p.dal.FindAccount(FindAccountQueryByID(relationship.AccountID))
+		if err != nil {
+			return nil, fmt.Errorf("persistence: error looking up account %s: %w", relationship.AccountID, err)
+		}
+		key, err := keys.DecryptWith(pwDerivedKey, relationship.PasswordEncryptedKeyEncryptionKey)
+		if err != nil {
+			results = append(results, KeyCheckResult{
+				AccountID: account.AccountID,
+				Name:      account.Name,
+				Problem:   fmt.Sprintf("key encryption key cannot be decrypted: %v", err),
+			})
+			continue
+		}
+		results = append(results, checkKeypair(key, account.AccountID, account.Name, "", account.KeyAlgorithm, account.PublicKey, account.EncryptedPrivateKey))
+		for _, deprecated := range account.DeprecatedKeys {
+			results = append(results, checkKeypair(key, account.AccountID, account.Name, deprecated.KeyID, deprecated.KeyAlgorithm, deprecated.PublicKey, deprecated.EncryptedPrivateKey))
+		}
+	}
+	return results, nil
+}
+
+func checkKeypair(keyEncryptionKey []byte, accountID, name, keyID, algorithm, publicKey, encryptedPrivateKey string) KeyCheckResult {
+	result := KeyCheckResult{
+		AccountID:    accountID,
+		Name:         name,
+		KeyID:        keyID,
+		KeyAlgorithm: algorithm,
+	}
+	privateKey, err := keys.DecryptWith(keyEncryptionKey, encryptedPrivateKey)
+	if err != nil {
+		result.Problem = fmt.Sprintf("private key cannot be decrypted: %v", err)
+		return result
+	}
+	if err := keys.MatchKeypair([]byte(publicKey), privateKey); err != nil {
+		result.Problem = err.Error()
+		return result
+	}
+	result.Valid = true
+	return result
+}
@@ -0,0 +1,73 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"testing"
+
+	"github.com/offen/offen/server/keys"
+)
+
+func TestPersistenceLayer_VerifyAccountKeys(t *testing.T) {
+	account, key, err := newAccount("checked", "9b63c4d8-65c0-438c-9d30-cc4b01173393", newMockKeypairProvider(t, keys.KeyAlgorithmRSAOAEP), newMockUserSaltProvider(t))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	other, _, err := newAccount("other", "e6b8b1d4-8a8c-4e0f-9d0b-1f8b2c0e9c51", newMockKeypairProvider(t, keys.KeyAlgorithmRSAOAEP), newMockUserSaltProvider(t))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	accountUser := newMockAccountUser(t, "user", "develop@offen.dev", "secret")
+	relationship, _ := newAccountUserRelationship(accountUser.AccountUserID, account.AccountID, AccountUserRoleAdmin)
+	if err := relationship.addPasswordEncryptedKey(key, accountUser.Salt, "secret"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	accountUser.Relationships = []AccountUserRelationship{*relationship}
+
+	t.Run("bad password", func(t *testing.T) {
+		db := &mockRotateAccountKeysDatabase{accountUser: accountUser, account: *account}
+		p := &persistenceLayer{dal: db}
+		if _, err := p.VerifyAccountKeys("develop@offen.dev", "other"); err == nil {
+			t.Error("Expected error when using bad password")
+		}
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		db := &mockRotateAccountKeysDatabase{accountUser: accountUser, account: *account}
+		p := &persistenceLayer{dal: db}
+		results, err := p.VerifyAccountKeys("develop@offen.dev", "secret")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(results) != 1 {
+			t.Fatalf("Expected one result, got %d", len(results))
+		}
+		if !results[0].Valid || results[0].Problem != "" {
+			t.Errorf("Expected key pair to be valid, got %v", results[0])
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		mismatched := *account
+		mismatched.PublicKey = other.PublicKey
+		mismatched.DeprecatedKeys = []DeprecatedAccountKey{
+			{KeyID: "key-1", KeyAlgorithm: account.KeyAlgorithm, PublicKey: account.PublicKey, EncryptedPrivateKey: account.EncryptedPrivateKey},
+		}
+		db := &mockRotateAccountKeysDatabase{accountUser: accountUser, account: mismatched}
+		p := &persistenceLayer{dal: db}
+		results, err := p.VerifyAccountKeys("develop@offen.dev", "secret")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(results) != 2 {
+			t.Fatalf("Expected two results, got %d", len(results))
+		}
+		if results[0].Valid || results[0].Problem == "" {
+			t.Errorf("Expected current key pair to be reported as mismatch, got %v", results[0])
+		}
+		if !results[1].Valid || results[1].KeyID != "key-1" {
+			t.Errorf("Expected deprecated key pair to be valid, got %v", results[1])
+		}
+	})
+}
@@ -0,0 +1,65 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/offen/offen/server/keys"
+)
+
+// RotateAccountKeys replaces the key pair of the account with the given id
+// with a newly generated one. The previous key pair is kept as a deprecated key
+// so user secrets that have been encrypted using it can still be decrypted.
+// The given credentials need to belong to an account user with access to the
+// account, as the account's key encryption key is needed for encrypting the
+// new private key.
+func (p *persistenceLayer) RotateAccountKeys(accountID, emailAddress, password string) error {
+	key, err := p.decryptKeyEncryptionKey(accountID, emailAddress, password)
+	if err != nil {
+		return err
+	}
+
+	account, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account %s: %w", accountID, err)
+	}
+	// the current private key is not needed, but this ensures the new
+	// private key can be decrypted by the same users as the current one
+	if _, err := keys.DecryptWith(key, account.EncryptedPrivateKey); err != nil {
+		return fmt.Errorf("persistence: key encryption key does not match account %s: %w", accountID, err)
+	}
+
+	publicKey, privateKey, err := p.keypairs.GenerateKeypair()
+	if err != nil {
+		return fmt.Errorf("persistence: error generating key pair: %w", err)
+	}
+	encryptedPrivateKey, err := keys.EncryptWith(key, privateKey)
+	if err != nil {
+		return fmt.Errorf("persistence: error encrypting private key: %w", err)
+	}
+	keyID, err := uuid.NewV4()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating key id: %w", err)
+	}
+
+	account.DeprecatedKeys = append(account.DeprecatedKeys, DeprecatedAccountKey{
+		KeyID:               keyID.String(),
+		AccountID:           account.AccountID,
+		PublicKey:           account.PublicKey,
+		EncryptedPrivateKey: account.EncryptedPrivateKey,
+		KeyAlgorithm:        account.KeyAlgorithm,
+		Deprecated:          time.Now().UTC(),
+	})
+	account.PublicKey = string(publicKey)
+	account.EncryptedPrivateKey = encryptedPrivateKey.Marshal()
+	account.KeyAlgorithm = p.keypairs.Algorithm()
+	if err := p.dal.UpdateAccount(&account); err != nil {
+		return fmt.Errorf("persistence: error saving rotated keys of account %s: %w", accountID, err)
+	}
+	p.publishAccountChange(AccountChange{AccountID: accountID, Reason: AccountChangeKeysRotated})
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"testing"
+
+	"github.com/offen/offen/server/keys"
+)
+
+type mockRotateAccountKeysDatabase struct {
+	DataAccessLayer
+	accountUser AccountUser
+	account     Account
+	updated     *Account
+}
+
+func (m *mockRotateAccountKeysDatabase) FindAccountUsers(interface{}) ([]AccountUser, error) {
+	return []AccountUser{m.accountUser}, nil
+}
+
+func (m *mockRotateAccountKeysDatabase) FindAccount(interface{}) (Account, error) {
+	return m.account, nil
+}
+
+func (m *mockRotateAccountKeysDatabase) UpdateAccount(a *Account) error {
+	m.updated = a
+	return nil
+}
+
+func TestPersistenceLayer_RotateAccountKeys(t *testing.T) {
+	account, key, err := newAccount("rotated", "9b63c4d8-65c0-438c-9d30-cc4b01173393", newMockKeypairProvider(t, keys.KeyAlgorithmRSAOAEP), newMockUserSaltProvider(t))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	accountUser := newMockAccountUser(t, "user", "develop@offen.dev", "secret")
+	relationship, _ := newAccountUserRelationship(accountUser.AccountUserID, account.AccountID, AccountUserRoleAdmin)
+	if err := relationship.addPasswordEncryptedKey(key, accountUser.Salt, "secret"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	accountUser.Relationships = []AccountUserRelationship{*relationship}
+
+	t.Run("bad password", func(t *testing.T) {
+		db := &mockRotateAccountKeysDatabase{accountUser: accountUser, account: *account}
+		p := &persistenceLayer{dal: db}
+		if err := p.RotateAccountKeys(account.AccountID, "develop@offen.dev", "other"); err == nil {
+			t.Error("Expected error when using bad password")
+		}
+		if db.updated != nil {
+			t.Error("Unexpected update of account")
+		}
+	})
+
+	t.Run("no access", func(t *testing.T) {
+		db := &mockRotateAccountKeysDatabase{accountUser: accountUser, account: *account}
+		p := &persistenceLayer{dal: db}
+		if err := p.RotateAccountKeys("other-account", "develop@offen.dev", "secret"); err == nil {
+			t.Error("Expected error when rotating keys of account without access")
+		}
+		if db.updated != nil {
+			t.Error("Unexpected update of account")
+		}
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		db := &mockRotateAccountKeysDatabase{accountUser: accountUser, account: *account}
+		p := &persistenceLayer{dal: db, keypairs: newMockKeypairProvider(t, keys.KeyAlgorithmRSAOAEP)}
+		if err := p.RotateAccountKeys(account.AccountID, "develop@offen.dev", "secret"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		rotated := db.updated
+		if rotated == nil {
+			t.Fatal("Expected account to be updated")
+		}
+		if rotated.PublicKey == account.PublicKey || rotated.EncryptedPrivateKey == account.EncryptedPrivateKey {
+			t.Error("Expected key pair to be replaced")
+		}
+		if rotated.KeyAlgorithm != keys.KeyAlgorithmRSAOAEP {
+			t.Errorf("Unexpected key algorithm %v", rotated.KeyAlgorithm)
+		}
+		if _, err := keys.DecryptWith(key, rotated.EncryptedPrivateKey); err != nil {
+			t.Errorf("Expected new private key to be encrypted with key encryption key, got %v", err)
+		}
+		if len(rotated.DeprecatedKeys) != 1 {
+			t.Fatalf("Expected one deprecated key, got %d", len(rotated.DeprecatedKeys))
+		}
+		deprecated := rotated.DeprecatedKeys[0]
+		if deprecated.PublicKey != account.PublicKey || deprecated.EncryptedPrivateKey != account.EncryptedPrivateKey {
+			t.Errorf("Expected previous key pair to be deprecated, got %v", deprecated)
+		}
+		if deprecated.KeyAlgorithm != keys.KeyAlgorithmRSAOAEP {
+			t.Errorf("Unexpected deprecated key algorithm %v", deprecated.KeyAlgorithm)
+		}
+		if deprecated.AccountID != account.AccountID || deprecated.KeyID == "" || deprecated.Deprecated.IsZero() {
+			t.Errorf("Unexpected deprecated key %v", deprecated)
+		}
+	})
+}
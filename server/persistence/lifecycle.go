@@ -0,0 +1,63 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"sync"
+	"time"
+)
+
+// lastEventResolution is the interval in which the time of the last event
+// of an account is updated. Updating it for each event would add a write to
+// the accounts table for each insert.
+const lastEventResolution = time.Minute * 15
+
+// lastEventTracker keeps track of when the time of the last event has been
+// written for each account. Its zero value is ready to use.
+type lastEventTracker struct {
+	lock    sync.Mutex
+	written map[string]time.Time
+}
+
+// due returns the ids of the given accounts whose time of the last event
+// needs to be updated and marks them as updated at the given time.
+func (l *lastEventTracker) due(accountIDs []string, now time.Time) []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.written == nil {
+		l.written = map[string]time.Time{}
+	}
+	var result []string
+	for _, accountID := range accountIDs {
+		if last, ok := l.written[accountID]; ok && now.Sub(last) < lastEventResolution {
+			continue
+		}
+		l.written[accountID] = now
+		result = append(result, accountID)
+	}
+	return result
+}
+
+// touchAccounts updates the time of the last event for the accounts of the
+// given events after they have been persisted. Failing to do so is not
+// considered an error as the events themselves have been stored.
+func (p *persistenceLayer) touchAccounts(events []*Event) {
+	seen := map[string]bool{}
+	var accountIDs []string
+	for _, evt := range events {
+		if !seen[evt.AccountID] {
+			seen[evt.AccountID] = true
+			accountIDs = append(accountIDs, evt.AccountID)
+		}
+	}
+	now := time.Now().UTC()
+	due := p.lastEvents.due(accountIDs, now)
+	if len(due) == 0 {
+		return
+	}
+	p.dal.UpdateAccounts(UpdateAccountsQueryLastEvent{
+		AccountIDs:  due,
+		LastEventAt: now,
+	})
+}
@@ -0,0 +1,54 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLastEventTracker(t *testing.T) {
+	tracker := lastEventTracker{}
+	now := time.Now()
+
+	if due := tracker.due([]string{"account-a", "account-b"}, now); !reflect.DeepEqual(due, []string{"account-a", "account-b"}) {
+		t.Errorf("Unexpected result %v", due)
+	}
+	if due := tracker.due([]string{"account-a", "account-c"}, now.Add(time.Minute)); !reflect.DeepEqual(due, []string{"account-c"}) {
+		t.Errorf("Unexpected result %v", due)
+	}
+	if due := tracker.due([]string{"account-a"}, now.Add(lastEventResolution)); !reflect.DeepEqual(due, []string{"account-a"}) {
+		t.Errorf("Unexpected result %v", due)
+	}
+}
+
+type mockTouchAccountsDatabase struct {
+	DataAccessLayer
+	queries []UpdateAccountsQueryLastEvent
+}
+
+func (m *mockTouchAccountsDatabase) UpdateAccounts(q interface{}) (int64, error) {
+	query := q.(UpdateAccountsQueryLastEvent)
+	m.queries = append(m.queries, query)
+	return int64(len(query.AccountIDs)), nil
+}
+
+func TestPersistenceLayer_touchAccounts(t *testing.T) {
+	db := &mockTouchAccountsDatabase{}
+	p := &persistenceLayer{dal: db}
+
+	p.touchAccounts([]*Event{{AccountID: "account-a"}, {AccountID: "account-b"}, {AccountID: "account-a"}})
+	p.touchAccounts([]*Event{{AccountID: "account-b"}})
+
+	if len(db.queries) != 1 {
+		t.Fatalf("Expected a single update, got %v", db.queries)
+	}
+	if !reflect.DeepEqual(db.queries[0].AccountIDs, []string{"account-a", "account-b"}) {
+		t.Errorf("Unexpected account ids %v", db.queries[0].AccountIDs)
+	}
+	if time.Since(db.queries[0].LastEventAt) > time.Minute {
+		t.Errorf("Unexpected time of last event %v", db.queries[0].LastEventAt)
+	}
+}
@@ -75,7 +75,9 @@ func (p *persistenceLayer) Login(email, password string) (LoginResult, error) {
 		result := LoginAccountResult{
 			AccountName:      account.Name,
 			AccountID:        relationship.AccountID,
+			Role:             relationship.Role,
 			Created:          account.Created,
+			LastEventAt:      account.LastEventAt,
 			KeyEncryptionKey: k,
 		}
 		results = append(results, result)
@@ -84,6 +86,7 @@ func (p *persistenceLayer) Login(email, password string) (LoginResult, error) {
 	return LoginResult{
 		AccountUserID: accountUser.AccountUserID,
 		AdminLevel:    accountUser.AdminLevel,
+		TOTPEnabled:   accountUser.TOTPSecret != "",
 		Accounts:      results,
 	}, nil
 }
@@ -98,11 +101,13 @@ func (p *persistenceLayer) LookupAccountUser(accountUserID string) (LoginResult,
 	result := LoginResult{
 		AccountUserID: accountUser.AccountUserID,
 		AdminLevel:    accountUser.AdminLevel,
+		TOTPEnabled:   accountUser.TOTPSecret != "",
 		Accounts:      []LoginAccountResult{},
 	}
 	for _, relationship := range accountUser.Relationships {
 		result.Accounts = append(result.Accounts, LoginAccountResult{
 			AccountID: relationship.AccountID,
+			Role:      relationship.Role,
 		})
 	}
 	return result, nil
@@ -147,6 +152,9 @@ func (p *persistenceLayer) ChangePassword(userID, currentPassword, changedPasswo
 	if err := p.dal.UpdateAccountUser(&accountUser); err != nil {
 		return fmt.Errorf("persistence: error updating password for user: %w", err)
 	}
+	if err := p.RevokeSessions(accountUser.AccountUserID); err != nil {
+		return fmt.Errorf("persistence: error revoking sessions after changing password: %w", err)
+	}
 	return nil
 }
 
@@ -160,6 +168,12 @@ func (p *persistenceLayer) ResetPassword(emailAddress, password string, oneTimeK
 		return fmt.Errorf("persistence: error validating new password: %w", err)
 	}
 
+	// the one time key is required to match the one that has been issued
+	// last, so each key can only be used once
+	if err := keys.CompareString(base64.StdEncoding.EncodeToString(oneTimeKey), accountUser.HashedOneTimeKey); err != nil {
+		return fmt.Errorf("persistence: error comparing one time key: %w", err)
+	}
+
 	for index, relationship := range accountUser.Relationships {
 		keyEncryptionKey, decryptionErr := keys.DecryptWith(oneTimeKey, relationship.OneTimeEncryptedKeyEncryptionKey)
 		if decryptionErr != nil {
@@ -176,9 +190,13 @@ func (p *persistenceLayer) ResetPassword(emailAddress, password string, oneTimeK
 		return fmt.Errorf("persistence: error hashing password: %w", hashErr)
 	}
 	accountUser.HashedPassword = passwordHash.Marshal()
+	accountUser.HashedOneTimeKey = ""
 	if err := p.dal.UpdateAccountUser(accountUser); err != nil {
 		return fmt.Errorf("persistence: error updating password on account user: %w", err)
 	}
+	if err := p.RevokeSessions(accountUser.AccountUserID); err != nil {
+		return fmt.Errorf("persistence: error revoking sessions after resetting password: %w", err)
+	}
 	return nil
 }
 
@@ -246,11 +264,16 @@ func (p *persistenceLayer) GenerateOneTimeKey(emailAddress string) ([]byte, erro
 	oneTimeKey, _ := keys.GenerateRandomValue(keys.DefaultEncryptionKeySize)
 	oneTimeKeyBytes, _ := base64.StdEncoding.DecodeString(oneTimeKey)
 
+	hashedOneTimeKey, hashErr := keys.HashString(oneTimeKey)
+	if hashErr != nil {
+		return nil, fmt.Errorf("persistence: error hashing one time key: %w", hashErr)
+	}
+
 	txn, err := p.dal.Transaction()
 	if err != nil {
 		return nil, fmt.Errorf("persistence: error creating transaction: %w", err)
 	}
-	for _, relationship := range accountUser.Relationships {
+	for index, relationship := range accountUser.Relationships {
 		decryptedKey, decryptErr := keys.DecryptWith(emailDerivedKey, relationship.EmailEncryptedKeyEncryptionKey)
 		if decryptErr != nil {
 			txn.Rollback()
@@ -260,10 +283,12 @@ func (p *persistenceLayer) GenerateOneTimeKey(emailAddress string) ([]byte, erro
 			txn.Rollback()
 			return nil, fmt.Errorf("persistence: erro adding one time key to relationship: %w", err)
 		}
-		if err := txn.UpdateAccountUserRelationship(&relationship); err != nil {
-			txn.Rollback()
-			return nil, fmt.Errorf("persistence: error updating relationship record: %w", err)
-		}
+		accountUser.Relationships[index] = relationship
+	}
+	accountUser.HashedOneTimeKey = hashedOneTimeKey.Marshal()
+	if err := txn.UpdateAccountUser(accountUser); err != nil {
+		txn.Rollback()
+		return nil, fmt.Errorf("persistence: error updating account user: %w", err)
 	}
 	if err := txn.Commit(); err != nil {
 		return nil, fmt.Errorf("persistence: error committing transaction: %w", err)
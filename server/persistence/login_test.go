@@ -0,0 +1,106 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/offen/offen/server/keys"
+)
+
+type mockResetPasswordDatabase struct {
+	DataAccessLayer
+	findAccountUsersResult []AccountUser
+	findAccountUsersErr    error
+	updateAccountUserErr   error
+	updated                *AccountUser
+}
+
+func (m *mockResetPasswordDatabase) FindAccountUsers(interface{}) ([]AccountUser, error) {
+	return m.findAccountUsersResult, m.findAccountUsersErr
+}
+
+func (m *mockResetPasswordDatabase) UpdateAccountUser(a *AccountUser) error {
+	m.updated = a
+	return m.updateAccountUserErr
+}
+
+func (m *mockResetPasswordDatabase) DeleteSessions(interface{}) (int64, error) {
+	return 0, nil
+}
+
+func TestPersistenceLayer_ResetPassword(t *testing.T) {
+	oneTimeKey, _ := keys.GenerateRandomValue(keys.DefaultEncryptionKeySize)
+	oneTimeKeyBytes, _ := base64.StdEncoding.DecodeString(oneTimeKey)
+	hashedOneTimeKey, _ := keys.HashString(oneTimeKey)
+
+	accountUserWithKey := func(hashedKey string) AccountUser {
+		a, _ := newAccountUser("foo@bar.com", "", 0)
+		a.HashedOneTimeKey = hashedKey
+		return *a
+	}
+
+	tests := []struct {
+		name        string
+		dal         *mockResetPasswordDatabase
+		keyArg      []byte
+		expectError bool
+	}{
+		{
+			"lookup error",
+			&mockResetPasswordDatabase{
+				findAccountUsersErr: errors.New("did not work"),
+			},
+			oneTimeKeyBytes,
+			true,
+		},
+		{
+			"key already used",
+			&mockResetPasswordDatabase{
+				findAccountUsersResult: []AccountUser{accountUserWithKey("")},
+			},
+			oneTimeKeyBytes,
+			true,
+		},
+		{
+			"key mismatch",
+			&mockResetPasswordDatabase{
+				findAccountUsersResult: []AccountUser{accountUserWithKey(hashedOneTimeKey.Marshal())},
+			},
+			[]byte("other-key"),
+			true,
+		},
+		{
+			"update error",
+			&mockResetPasswordDatabase{
+				findAccountUsersResult: []AccountUser{accountUserWithKey(hashedOneTimeKey.Marshal())},
+				updateAccountUserErr:   errors.New("did not work"),
+			},
+			oneTimeKeyBytes,
+			true,
+		},
+		{
+			"ok",
+			&mockResetPasswordDatabase{
+				findAccountUsersResult: []AccountUser{accountUserWithKey(hashedOneTimeKey.Marshal())},
+			},
+			oneTimeKeyBytes,
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &persistenceLayer{dal: test.dal}
+			err := p.ResetPassword("foo@bar.com", "new-secret", test.keyArg)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if !test.expectError && test.dal.updated.HashedOneTimeKey != "" {
+				t.Errorf("Expected one time key to be cleared, got %v", test.dal.updated.HashedOneTimeKey)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+	"time"
+)
+
+// ReadOnly returns whether the instance has been put into read-only mode for
+// maintenance. The state is stored in the database so it is shared by all
+// instances and survives restarts.
+func (p *persistenceLayer) ReadOnly() (bool, error) {
+	state, err := p.dal.FindMaintenanceState()
+	if err != nil {
+		return false, fmt.Errorf("persistence: error looking up maintenance state: %w", err)
+	}
+	return state.ReadOnly, nil
+}
+
+// SetReadOnly persists whether the instance is in read-only mode.
+func (p *persistenceLayer) SetReadOnly(readOnly bool) error {
+	if err := p.dal.UpdateMaintenanceState(&MaintenanceState{
+		ReadOnly: readOnly,
+		Updated:  time.Now().UTC(),
+	}); err != nil {
+		return fmt.Errorf("persistence: error updating maintenance state: %w", err)
+	}
+	return nil
+}
@@ -9,7 +9,7 @@ import (
 	"github.com/offen/offen/server/keys"
 )
 
-func (p *persistenceLayer) ShareAccount(inviteeEmailAddress, providerEmailAddress, providerPassword, accountID string, grantAdminPrivileges bool) (ShareAccountResult, error) {
+func (p *persistenceLayer) ShareAccount(inviteeEmailAddress, providerEmailAddress, providerPassword, accountID string, grantAdminPrivileges bool, role AccountUserRole) (ShareAccountResult, error) {
 	var result ShareAccountResult
 	var invitedAccountUser *AccountUser
 
@@ -31,6 +31,10 @@ func (p *persistenceLayer) ShareAccount(inviteeEmailAddress, providerEmailAddres
 	if grantAdminPrivileges {
 		targetAdminLevel = AccountUserAdminLevelSuperAdmin
 	}
+	targetRole, roleErr := inviteeRole(targetAdminLevel, role)
+	if roleErr != nil {
+		return result, fmt.Errorf("persistence: error determining role for invitee: %w", roleErr)
+	}
 	// Next, we need to check whether the given address is already associated
 	// with an existing account.
 	if match, err := selectAccountUser(accountUsers, inviteeEmailAddress); err == nil {
@@ -89,7 +93,7 @@ outer:
 
 	// we copy over all all eligible relationships of the provider to the invitee
 	for _, providerRelationship := range eligibleRelationships {
-		inviteeRelationship, err := newAccountUserRelationship(invitedAccountUser.AccountUserID, providerRelationship.AccountID)
+		inviteeRelationship, err := newAccountUserRelationship(invitedAccountUser.AccountUserID, providerRelationship.AccountID, targetRole)
 		if err != nil {
 			txn.Rollback()
 			return result, fmt.Errorf("persistence: error creating account user relationship: %w", err)
@@ -116,45 +120,62 @@ outer:
 	return result, nil
 }
 
-func (p *persistenceLayer) Join(emailAddress, password string) error {
+// inviteeRole returns the role an invited account user will be granted for
+// the shared accounts. SuperAdmins are always granted the admin role. In case
+// no role is requested, the default role for the admin level is used.
+func inviteeRole(level AccountUserAdminLevel, requested AccountUserRole) (AccountUserRole, error) {
+	switch requested {
+	case 0:
+		return roleForAdminLevel(level), nil
+	case AccountUserRoleAdmin, AccountUserRoleViewer:
+		if level == AccountUserAdminLevelSuperAdmin {
+			return AccountUserRoleAdmin, nil
+		}
+		return requested, nil
+	default:
+		return 0, fmt.Errorf("persistence: unknown role %d", requested)
+	}
+}
+
+func (p *persistenceLayer) Join(emailAddress, password string) (string, error) {
 	match, err := p.findAccountUser(emailAddress, true, true)
 	if err != nil {
-		return fmt.Errorf("persistence: could not find user with email %s: %w", emailAddress, err)
+		return "", fmt.Errorf("persistence: could not find user with email %s: %w", emailAddress, err)
 	}
 
 	if match.HashedPassword != "" {
-		return fmt.Errorf("persistence: user with email %s has already joined before", emailAddress)
+		return "", fmt.Errorf("persistence: user with email %s has already joined before", emailAddress)
 	}
 
 	if err := keys.ValidatePassword(password); err != nil {
-		return fmt.Errorf("persistence: error validating password: %w", err)
+		return "", fmt.Errorf("persistence: error validating password: %w", err)
 	}
 
 	cipher, err := keys.HashString(password)
 	if err != nil {
-		return fmt.Errorf("persistence: hashing given password: %w", err)
+		return "", fmt.Errorf("persistence: hashing given password: %w", err)
 	}
 	match.HashedPassword = cipher.Marshal()
 
 	emailDerivedKey, deriveErr := keys.DeriveKey(emailAddress, match.Salt)
 	if deriveErr != nil {
-		return fmt.Errorf("persistence: error deriving key from email: %w", deriveErr)
+		return "", fmt.Errorf("persistence: error deriving key from email: %w", deriveErr)
 	}
 
 	for index, relationship := range match.Relationships {
 		key, keyErr := keys.DecryptWith(emailDerivedKey, relationship.EmailEncryptedKeyEncryptionKey)
 		if keyErr != nil {
-			return fmt.Errorf("persistence: error decrypting email encrypted key: %w", keyErr)
+			return "", fmt.Errorf("persistence: error decrypting email encrypted key: %w", keyErr)
 		}
 
 		if err := relationship.addPasswordEncryptedKey(key, match.Salt, password); err != nil {
-			return fmt.Errorf("persistence: error adding password encrypted key: %w", err)
+			return "", fmt.Errorf("persistence: error adding password encrypted key: %w", err)
 		}
 		match.Relationships[index] = relationship
 	}
 
 	if err := p.dal.UpdateAccountUser(match); err != nil {
-		return fmt.Errorf("persistence: failed to update account user: %w", err)
+		return "", fmt.Errorf("persistence: failed to update account user: %w", err)
 	}
-	return nil
+	return match.AccountUserID, nil
 }
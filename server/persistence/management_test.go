@@ -203,8 +203,8 @@ func TestPersistenceLayer_ShareAccount(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			p := persistenceLayer{test.dal}
-			result, err := p.ShareAccount(test.invitee, test.email, test.password, test.accountID, true)
+			p := persistenceLayer{dal: test.dal}
+			result, err := p.ShareAccount(test.invitee, test.email, test.password, test.accountID, true, 0)
 
 			if test.expectErr != (err != nil) {
 				t.Errorf("Unexpected error value %v", err)
@@ -416,11 +416,38 @@ func TestPersistenceLayer_Join(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			p := &persistenceLayer{test.dal}
-			err := p.Join(test.emailArg, test.pwArg)
+			p := &persistenceLayer{dal: test.dal}
+			_, err := p.Join(test.emailArg, test.pwArg)
 			if test.expectError != (err != nil) {
 				t.Errorf("Unexpected error value: %v", err)
 			}
 		})
 	}
 }
+
+func TestInviteeRole(t *testing.T) {
+	tests := []struct {
+		name           string
+		level          AccountUserAdminLevel
+		requested      AccountUserRole
+		expectedResult AccountUserRole
+		expectErr      bool
+	}{
+		{"default super admin", AccountUserAdminLevelSuperAdmin, 0, AccountUserRoleAdmin, false},
+		{"default", 0, 0, AccountUserRoleViewer, false},
+		{"requested admin", 0, AccountUserRoleAdmin, AccountUserRoleAdmin, false},
+		{"super admin requested viewer", AccountUserAdminLevelSuperAdmin, AccountUserRoleViewer, AccountUserRoleAdmin, false},
+		{"unknown role", 0, 7, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := inviteeRole(test.level, test.requested)
+			if (err != nil) != test.expectErr {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if result != test.expectedResult {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
@@ -4,7 +4,17 @@
 package persistence
 
 import (
+	"fmt"
+	"io"
+	"runtime"
 	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/offen/offen/server/archive"
+	"github.com/offen/offen/server/bus"
+	"github.com/offen/offen/server/domainverify"
+	"github.com/offen/offen/server/keys"
+	"github.com/offen/offen/server/webhook"
 )
 
 // Service is a backend-agnostic wrapper for interacting with a persistence
@@ -12,29 +22,98 @@ import (
 // and stored.
 type Service interface {
 	Insert(userID, accountID, payload string, eventID *string) error
+	InsertBatch(userID string, events []InboundEvent) error
 	Query(Query) (EventsResult, error)
+	StreamQuery(Query) (EventsResult, *EventsStream, error)
 	GetAccount(accountID string, events bool, eventsSince string) (AccountResult, error)
-	CreateAccount(name, creatorEmailAddress, creatorPassword string) error
+	GetClientConfig(accountID string) (ClientConfigResult, error)
+	StreamAccount(accountID, eventsSince string) (AccountResult, *EventsStream, error)
+	GetAccountWithArchive(accountID, eventsSince string) (AccountResult, error)
+	GetAccountStats(accountID string) (AccountStatsResult, error)
+	GetAccountAggregates(accountID string, resolution AggregateResolution, since, until time.Time) (AggregatesResult, error)
+	CreateAccount(name, creatorEmailAddress, creatorPassword string) (string, error)
 	RetireAccount(accountID string) error
+	SetAccountRetention(accountID string, retention time.Duration) error
+	SetAccountEventQuota(accountID string, eventsPerDay int) error
+	SetAccountDomains(accountID string, domains []string) error
+	SetAccountBanner(accountID string, banner *AccountBanner) error
+	SetAccountSettings(accountID, encryptedSettings string) error
+	VerifyAccountDomain(accountID, domain string) error
+	LookupAccountDomains(accountID string) ([]string, error)
 	AssociateUserSecret(accountID, userID, encryptedUserSecret string) error
-	Purge(userID string) error
+	Purge(userID string, accountIDs []string) error
+	UpdatePurgeJob(purgeID, status string) error
+	GetPurgeJob(purgeID string) (PurgeJobResult, error)
+	Export(userID string) (ExportResult, error)
+	ExportAccount(accountID, emailAddress, password string) (AccountExport, error)
+	ImportAccount(data AccountExport, emailAddress, password string) error
+	RotateAccountKeys(accountID, emailAddress, password string) error
+	RotateUserSalt(accountID string, force bool) error
 	Login(email, password string) (LoginResult, error)
 	LookupAccountUser(userID string) (LoginResult, error)
 	ChangePassword(userID, currentPassword, changedPassword string) error
 	ChangeEmail(userID, emailAddress, emailCurrent, password string) error
 	GenerateOneTimeKey(emailAddress string) ([]byte, error)
 	ResetPassword(emailAddress, password string, oneTimeKey []byte) error
-	ShareAccount(inviteeEmailAddress, providerEmailAddress, providerPassword, accountID string, grantAdminPrivileges bool) (ShareAccountResult, error)
-	Join(emailAddress, password string) error
-	Expire(retention time.Duration) (int, error)
+	ShareAccount(inviteeEmailAddress, providerEmailAddress, providerPassword, accountID string, grantAdminPrivileges bool, role AccountUserRole) (ShareAccountResult, error)
+	Join(emailAddress, password string) (string, error)
+	EnrollTOTP(accountUserID, password, secret, code string) ([]string, error)
+	VerifyTOTP(accountUserID, code string) error
+	DisableTOTP(accountUserID, password, code string) error
+	ListWebAuthnCredentials(accountUserID string) ([][]byte, error)
+	RegisterWebAuthnCredential(accountUserID string, response *protocol.ParsedCredentialCreationData, ceremony WebAuthnCeremony, wrappedKeys string) error
+	LoginWebAuthn(response *protocol.ParsedCredentialAssertionData, ceremony WebAuthnCeremony) (LoginResult, error)
+	CreateSession(accountUserID, userAgent string, ttl time.Duration) (string, error)
+	ValidateSession(accountUserID, sessionID string) error
+	ListSessions(accountUserID string) ([]SessionResult, error)
+	RevokeSession(accountUserID, sessionID string) error
+	RevokeSessions(accountUserID string) error
+	RecordAuditEntry(action, actorID, accountID, requestID string) error
+	ListAuditEntries(filter AuditLogFilter) ([]AuditEntryResult, error)
+	CreateAPIToken(accountUserID, name string, accountIDs []string, scopes []APITokenScope) (APITokenResult, error)
+	ListAPITokens(accountUserID string) ([]APITokenResult, error)
+	RevokeAPIToken(accountUserID, tokenID string) error
+	LookupAPIToken(token string) (LoginResult, error)
+	Expire(retention time.Duration) (ExpireReport, error)
+	ExpireAccounts(retention time.Duration, options ExpireOptions) ([]ExpireResult, error)
+	VerifyAccountKeys(emailAddress, password string) ([]KeyCheckResult, error)
+	PruneSecrets() (int, error)
+	ArchiveEvents(threshold time.Duration) (int, error)
+	ChangesSince(watermark string) (ChangeSet, error)
+	Replicate(primaryURL string, pull func(watermark string) (ChangeSet, error)) (int, error)
+	Backup(w io.Writer) error
+	Restore(r io.Reader, force bool) error
+	AcquireJobLock(name, holder string, expires time.Time) (bool, error)
+	ReadOnly() (bool, error)
+	SetReadOnly(readOnly bool) error
 	Bootstrap(data BootstrapConfig) error
 	ProbeEmpty() bool
 	CheckHealth() error
 	Migrate() error
+	Close() error
 }
 
 type persistenceLayer struct {
-	dal DataAccessLayer
+	dal            DataAccessLayer
+	archive        archive.Archive
+	archiveKey     []byte
+	keypairs       keys.KeypairProvider
+	userSalts      keys.UserSaltProvider
+	userIDPepper   []byte
+	totpKey        []byte
+	inserts        *insertBuffer
+	replica        *readReplica
+	accounts       AccountCache
+	quotas         *eventQuotas
+	domainVerifier domainverify.Verifier
+	ingestHooks    []IngestHook
+	onFlag         func(meta InboundEventMetadata, reason string)
+	bus            bus.Bus
+	webhooks       webhook.Notifier
+	onMigrate      func(accountID string, migrated int)
+	lastEvents     lastEventTracker
+	hashes         *userIDHasher
+	saltMigrations *saltMigrations
 }
 
 // New creates a persistence service that connects to any database using
@@ -44,8 +123,92 @@ func New(dal DataAccessLayer, configs ...Config) (Service, error) {
 	for _, config := range configs {
 		config(&db)
 	}
+	if db.keypairs == nil {
+		keypairs, err := keys.NewKeypairProvider(keys.DefaultKeyAlgorithm, keys.RSAKeyLength)
+		if err != nil {
+			return nil, fmt.Errorf("persistence: error creating default keypair provider: %w", err)
+		}
+		db.keypairs = keypairs
+	}
+	if db.userSalts == nil {
+		userSalts, err := keys.NewUserSaltProvider(keys.DefaultUserIDHash, keys.Argon2Params{
+			Time:    keys.DefaultArgon2Time,
+			Memory:  keys.DefaultArgon2Memory,
+			Threads: keys.DefaultArgon2Threads,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("persistence: error creating default user salt provider: %w", err)
+		}
+		db.userSalts = userSalts
+	}
+	if len(db.userIDPepper) != 0 {
+		db.userSalts = keys.NewPepperedUserSaltProvider(db.userSalts)
+	}
+	db.hashes = newUserIDHasher(db.userIDPepper, userIDHashCacheSize, runtime.NumCPU())
+	db.saltMigrations = newSaltMigrations(saltMigrationQueueSize)
+	db.saltMigrations.start(db.migrateQueuedUserSalt)
+	if db.bus == nil {
+		db.bus = bus.New()
+	}
+	if db.accounts != nil {
+		db.invalidateAccountCache()
+	}
+	// accounts can define a quota even if the instance does not
+	if db.quotas == nil {
+		db.quotas = newEventQuotas()
+	}
+	db.invalidateQuotas()
+	if db.inserts != nil {
+		db.inserts.start(db.insertBatch)
+	}
 	return &db, nil
 }
 
 // Config is a function that adds a configuration option to the constructor
 type Config func(*persistenceLayer)
+
+// WithMigrationProgress passes the number of events that have been migrated
+// so far to the given function while the events of a user that has sent a new
+// user secret are being moved to a parked identifier.
+func WithMigrationProgress(fn func(accountID string, migrated int)) Config {
+	return func(p *persistenceLayer) {
+		p.onMigrate = fn
+	}
+}
+
+// WithKeypairProvider configures the persistence layer to use the given
+// provider for creating the key pairs of new accounts and when rotating the
+// keys of existing accounts. It defaults to RSA keys of keys.RSAKeyLength.
+func WithKeypairProvider(k keys.KeypairProvider) Config {
+	return func(p *persistenceLayer) {
+		p.keypairs = k
+	}
+}
+
+// WithUserSaltProvider configures the persistence layer to use the given
+// provider for creating the salts new accounts use for hashing user ids and
+// when rotating the salt of existing accounts. It defaults to SHA256.
+func WithUserSaltProvider(u keys.UserSaltProvider) Config {
+	return func(p *persistenceLayer) {
+		p.userSalts = u
+	}
+}
+
+// WithTOTPKey configures the persistence layer to encrypt the TOTP secrets of
+// account users using the given key. In case no key is given, secrets are
+// stored as is.
+func WithTOTPKey(key []byte) Config {
+	return func(p *persistenceLayer) {
+		p.totpKey = key
+	}
+}
+
+// WithUserIDPepper configures the persistence layer to mix the given pepper
+// into the user ids of accounts before hashing them. It only applies to
+// accounts created or having their salt rotated while a pepper is configured,
+// which then require the same pepper to be passed when hashing.
+func WithUserIDPepper(pepper []byte) Config {
+	return func(p *persistenceLayer) {
+		p.userIDPepper = pepper
+	}
+}
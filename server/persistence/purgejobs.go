@@ -0,0 +1,61 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// These are the statuses a purge job can have.
+const (
+	PurgeJobStatusPending   = "pending"
+	PurgeJobStatusCompleted = "completed"
+	PurgeJobStatusFailed    = "failed"
+)
+
+// purgeJobRetention is the duration after which purge jobs are deleted.
+const purgeJobRetention = time.Hour * 24
+
+// UpdatePurgeJob records the given status for the purge job of the given id,
+// creating the job in case it does not exist yet. Jobs are stored in the
+// database so their status can be looked up by any instance and survives
+// restarts.
+func (p *persistenceLayer) UpdatePurgeJob(purgeID, status string) error {
+	now := time.Now().UTC()
+	job, err := p.dal.FindPurgeJob(FindPurgeJobQueryByID(purgeID))
+	if err != nil {
+		var unknownPurgeErr ErrUnknownPurge
+		if !errors.As(err, &unknownPurgeErr) {
+			return fmt.Errorf("persistence: error looking up purge job %s: %w", purgeID, err)
+		}
+		job = PurgeJob{PurgeID: purgeID, Created: now}
+		// jobs are only created when a purge is started, so this is a
+		// good time for cleaning up the ones that are not needed anymore
+		if _, err := p.dal.DeletePurgeJobs(DeletePurgeJobsQueryOlderThan(now.Add(-purgeJobRetention))); err != nil {
+			return fmt.Errorf("persistence: error deleting outdated purge jobs: %w", err)
+		}
+	}
+	job.Status = status
+	job.Updated = now
+	if err := p.dal.UpdatePurgeJob(&job); err != nil {
+		return fmt.Errorf("persistence: error updating purge job %s: %w", purgeID, err)
+	}
+	return nil
+}
+
+// GetPurgeJob returns the purge job of the given id.
+func (p *persistenceLayer) GetPurgeJob(purgeID string) (PurgeJobResult, error) {
+	job, err := p.dal.FindPurgeJob(FindPurgeJobQueryByID(purgeID))
+	if err != nil {
+		return PurgeJobResult{}, fmt.Errorf("persistence: error looking up purge job %s: %w", purgeID, err)
+	}
+	return PurgeJobResult{
+		PurgeID: job.PurgeID,
+		Status:  job.Status,
+		Created: job.Created,
+		Updated: job.Updated,
+	}, nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+)
+
+type mockPurgeJobsDatabase struct {
+	DataAccessLayer
+	jobs    map[string]PurgeJob
+	deleted int
+	err     error
+}
+
+func (m *mockPurgeJobsDatabase) FindPurgeJob(q interface{}) (PurgeJob, error) {
+	if m.err != nil {
+		return PurgeJob{}, m.err
+	}
+	job, ok := m.jobs[string(q.(FindPurgeJobQueryByID))]
+	if !ok {
+		return PurgeJob{}, ErrUnknownPurge("unknown purge")
+	}
+	return job, nil
+}
+
+func (m *mockPurgeJobsDatabase) UpdatePurgeJob(j *PurgeJob) error {
+	m.jobs[j.PurgeID] = *j
+	return nil
+}
+
+func (m *mockPurgeJobsDatabase) DeletePurgeJobs(interface{}) (int64, error) {
+	m.deleted++
+	return 0, nil
+}
+
+func TestPersistenceLayer_UpdatePurgeJob(t *testing.T) {
+	t.Run("database error", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockPurgeJobsDatabase{err: errors.New("did not work")}}
+		if err := p.UpdatePurgeJob("purge-a", PurgeJobStatusPending); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+	t.Run("create and update", func(t *testing.T) {
+		db := &mockPurgeJobsDatabase{jobs: map[string]PurgeJob{}}
+		p := &persistenceLayer{dal: db}
+		if err := p.UpdatePurgeJob("purge-a", PurgeJobStatusPending); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		created := db.jobs["purge-a"].Created
+		if created.IsZero() || db.deleted != 1 {
+			t.Errorf("Expected job to be created and outdated jobs to be deleted, got %v", db.jobs)
+		}
+		if err := p.UpdatePurgeJob("purge-a", PurgeJobStatusCompleted); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		job, err := p.GetPurgeJob("purge-a")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if job.Status != PurgeJobStatusCompleted || !job.Created.Equal(created) || db.deleted != 1 {
+			t.Errorf("Unexpected job %v", job)
+		}
+	})
+	t.Run("unknown job", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockPurgeJobsDatabase{jobs: map[string]PurgeJob{}}}
+		var unknownPurgeErr ErrUnknownPurge
+		if _, err := p.GetPurgeJob("purge-z"); !errors.As(err, &unknownPurgeErr) {
+			t.Errorf("Expected unknown purge error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,278 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/offen/offen/server/webhook"
+)
+
+// WithEventQuota configures the persistence layer to reject events for
+// accounts that have already received the given number of events on the
+// current day (UTC). Accounts can override this default using their own
+// quota. Usage is counted by each instance separately, starting from the
+// number of events already stored when an account is first seen on a day, so
+// instances sharing a database might accept more events than the quota in
+// total.
+func WithEventQuota(eventsPerDay int) Config {
+	return func(p *persistenceLayer) {
+		if p.quotas == nil {
+			p.quotas = newEventQuotas()
+		}
+		if eventsPerDay > 0 {
+			p.quotas.limit = eventsPerDay
+		}
+	}
+}
+
+type eventQuotas struct {
+	limit     int
+	lock      sync.Mutex
+	day       time.Time
+	used      map[string]int
+	limits    map[string]int
+	exhausted map[string]bool
+}
+
+func newEventQuotas() *eventQuotas {
+	return &eventQuotas{used: map[string]int{}, limits: map[string]int{}, exhausted: map[string]bool{}}
+}
+
+// quotaDay returns the start of the day the given time falls into. Quotas
+// are always reset at midnight UTC.
+func quotaDay(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Hour * 24)
+}
+
+// limitOf returns the number of events the given account can receive per
+// day. Zero means the account is not limited at all.
+func (q *eventQuotas) limitOf(account Account) int {
+	if account.EventQuota > 0 {
+		return account.EventQuota
+	}
+	return q.limit
+}
+
+// usage returns the number of events the given account has used on the
+// given day and its limit in case they are known.
+func (q *eventQuotas) usage(day time.Time, accountID string) (int, int, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if !q.day.Equal(day) {
+		return 0, 0, false
+	}
+	limit, ok := q.limits[accountID]
+	return q.used[accountID], limit, ok
+}
+
+// take adds the requested number of events to the usage of each of the
+// given accounts in case none of them exceeds its limit. Otherwise, no usage
+// is added at all. Unknown usage and limits are initialized using the given
+// counts and limits. The accounts that have rejected events for the first
+// time on the given day are returned as exhausted.
+func (q *eventQuotas) take(day time.Time, requested, counts, limits map[string]int) (exhausted []string, err error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if !q.day.Equal(day) {
+		q.day = day
+		q.used = map[string]int{}
+		q.limits = map[string]int{}
+		q.exhausted = map[string]bool{}
+	}
+	accountIDs := make([]string, 0, len(requested))
+	for accountID := range requested {
+		if _, ok := q.limits[accountID]; !ok {
+			q.used[accountID] = counts[accountID]
+			q.limits[accountID] = limits[accountID]
+		}
+		accountIDs = append(accountIDs, accountID)
+	}
+	sort.Strings(accountIDs)
+	for _, accountID := range accountIDs {
+		limit := q.limits[accountID]
+		if limit == 0 || q.used[accountID]+requested[accountID] <= limit {
+			continue
+		}
+		if !q.exhausted[accountID] {
+			exhausted = append(exhausted, accountID)
+			q.exhausted[accountID] = true
+		}
+		if err == nil {
+			err = ErrQuotaExceeded(
+				fmt.Sprintf("persistence: account %s has exceeded its quota of %d events per day", accountID, limit),
+			)
+		}
+	}
+	if err != nil {
+		return exhausted, err
+	}
+	for accountID, n := range requested {
+		q.used[accountID] += n
+	}
+	return nil, nil
+}
+
+// release removes the given number of events from the usage of each of the
+// given accounts. Usage that has been recorded for a previous day is not
+// touched anymore.
+func (q *eventQuotas) release(day time.Time, released map[string]int) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if !q.day.Equal(day) {
+		return
+	}
+	for accountID, n := range released {
+		used, ok := q.used[accountID]
+		if !ok {
+			continue
+		}
+		if used -= n; used < 0 {
+			used = 0
+		}
+		q.used[accountID] = used
+	}
+}
+
+// forget drops the usage and limit of the given accounts, so they are looked
+// up again when the accounts receive their next events. In case no account
+// ids are given, all accounts are dropped.
+func (q *eventQuotas) forget(accountIDs ...string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if len(accountIDs) == 0 {
+		q.used = map[string]int{}
+		q.limits = map[string]int{}
+		q.exhausted = map[string]bool{}
+		return
+	}
+	for _, accountID := range accountIDs {
+		delete(q.used, accountID)
+		delete(q.limits, accountID)
+		delete(q.exhausted, accountID)
+	}
+}
+
+// consumeQuota records that n events are about to be inserted for the given
+// account, returning an error in case this would exceed its daily quota.
+// Callers are expected to call releaseQuota in case the events end up not
+// being inserted.
+func (p *persistenceLayer) consumeQuota(accountID string, n int) error {
+	return p.consumeQuotas(map[string]int{accountID: n})
+}
+
+// consumeQuotas records that the given number of events are about to be
+// inserted for each of the given accounts. In case this would exceed the
+// daily quota of any of the accounts, an error is returned and none of the
+// events count towards the quotas.
+func (p *persistenceLayer) consumeQuotas(requested map[string]int) error {
+	if p.quotas == nil {
+		return nil
+	}
+	day := quotaDay(time.Now())
+	counts := map[string]int{}
+	limits := map[string]int{}
+	for accountID := range requested {
+		if _, _, ok := p.quotas.usage(day, accountID); ok {
+			continue
+		}
+		// unknown accounts are rejected before looking up their usage so
+		// arbitrary account ids do not end up being tracked
+		account, err := p.findActiveAccount(accountID)
+		if err != nil {
+			return fmt.Errorf("persistence: error looking up account for quota: %w", err)
+		}
+		limits[accountID] = p.quotas.limitOf(account)
+		if limits[accountID] == 0 {
+			continue
+		}
+		count, err := p.countEventsSince(accountID, day)
+		if err != nil {
+			return err
+		}
+		counts[accountID] = count
+	}
+	exhausted, err := p.quotas.take(day, requested, counts, limits)
+	for _, accountID := range exhausted {
+		_, limit, _ := p.quotas.usage(day, accountID)
+		p.notify(webhook.EventQuotaExhausted, map[string]interface{}{
+			"accountId": accountID,
+			"limit":     limit,
+			"resetsAt":  day.Add(time.Hour * 24),
+		})
+	}
+	return err
+}
+
+// releaseQuota gives back the usage of n events that have been consumed
+// but have not been inserted.
+func (p *persistenceLayer) releaseQuota(accountID string, n int) {
+	p.releaseQuotas(map[string]int{accountID: n})
+}
+
+// releaseQuotas gives back the usage of the given number of events per
+// account.
+func (p *persistenceLayer) releaseQuotas(released map[string]int) {
+	if p.quotas == nil {
+		return
+	}
+	p.quotas.release(quotaDay(time.Now()), released)
+}
+
+// invalidateQuotas subscribes the quota tracker to changes to accounts, so
+// changed quotas are applied right away.
+func (p *persistenceLayer) invalidateQuotas() {
+	p.bus.Subscribe(TopicAccountChanged, func(payload []byte) {
+		var change AccountChange
+		if err := json.Unmarshal(payload, &change); err != nil {
+			return
+		}
+		if change.AccountID == "" {
+			p.quotas.forget()
+			return
+		}
+		p.quotas.forget(change.AccountID)
+	})
+}
+
+func (p *persistenceLayer) countEventsSince(accountID string, t time.Time) (int, error) {
+	counts, err := p.dal.CountEvents(CountEventsQueryByAccountIDSince{
+		AccountID: accountID,
+		Since:     eventIDBoundary(t),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("persistence: error counting events of account %s: %w", accountID, err)
+	}
+	if len(counts) == 0 {
+		return 0, nil
+	}
+	return int(counts[0].Events), nil
+}
+
+// quotaResult returns the quota consumption of the given account, where used
+// is the number of events stored for the current day.
+func (p *persistenceLayer) quotaResult(account Account, used int) *QuotaResult {
+	if p.quotas == nil {
+		return nil
+	}
+	limit := p.quotas.limitOf(account)
+	if limit == 0 {
+		return nil
+	}
+	day := quotaDay(time.Now())
+	// events that are still waiting in the insert buffer have already been
+	// counted by the tracker, but are not stored yet
+	if tracked, _, ok := p.quotas.usage(day, account.AccountID); ok && tracked > used {
+		used = tracked
+	}
+	return &QuotaResult{
+		Limit:    limit,
+		Used:     used,
+		ResetsAt: day.Add(time.Hour * 24),
+	}
+}
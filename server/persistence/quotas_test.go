@@ -0,0 +1,207 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/bus"
+	"github.com/offen/offen/server/webhook"
+)
+
+type mockQuotaDatabase struct {
+	DataAccessLayer
+	findAccountErr error
+	eventQuotas    map[string]int
+	events         []Event
+	countCalls     int
+	created        int
+}
+
+func (m *mockQuotaDatabase) FindAccount(q interface{}) (Account, error) {
+	if m.findAccountErr != nil {
+		return Account{}, m.findAccountErr
+	}
+	accountID := string(q.(FindAccountQueryActiveByID))
+	return Account{AccountID: accountID, EventQuota: m.eventQuotas[accountID]}, nil
+}
+
+func (m *mockQuotaDatabase) CountEvents(q interface{}) ([]EventCount, error) {
+	query, ok := q.(CountEventsQueryByAccountIDSince)
+	if !ok {
+		return nil, ErrBadQuery
+	}
+	m.countCalls++
+	var result EventCount
+	for _, evt := range m.events {
+		if evt.AccountID == query.AccountID && evt.EventID >= query.Since {
+			result.Events++
+		}
+	}
+	return []EventCount{result}, nil
+}
+
+func TestPersistenceLayer_consumeQuota(t *testing.T) {
+	t.Run("no quota", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockQuotaDatabase{}}
+		if err := p.consumeQuota("account-a", 1000); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	})
+	t.Run("counts existing events", func(t *testing.T) {
+		yesterday, _ := EventIDAt(time.Now().Add(-time.Hour * 48))
+		today, _ := EventIDAt(time.Now())
+		db := &mockQuotaDatabase{
+			events: []Event{
+				{EventID: yesterday, AccountID: "account-a"},
+				{EventID: today, AccountID: "account-a"},
+			},
+		}
+		hooks := &mockNotifier{}
+		p := &persistenceLayer{dal: db, webhooks: hooks}
+		WithEventQuota(3)(p)
+
+		if err := p.consumeQuota("account-a", 1); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if err := p.consumeQuota("account-a", 2); err == nil {
+			t.Error("Expected error, got nil")
+		} else {
+			var quotaErr ErrQuotaExceeded
+			if !errors.As(err, &quotaErr) {
+				t.Errorf("Unexpected error %v", err)
+			}
+		}
+		if err := p.consumeQuota("account-a", 1); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if err := p.consumeQuota("account-a", 1); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if err := p.consumeQuota("account-b", 3); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if db.countCalls != 2 {
+			t.Errorf("Expected usage to be looked up once per account, got %d lookups", db.countCalls)
+		}
+		if !reflect.DeepEqual(hooks.events, []string{webhook.EventQuotaExhausted}) {
+			t.Errorf("Expected a single notification, got %v", hooks.events)
+		}
+
+		result := p.quotaResult(Account{AccountID: "account-a"}, 1)
+		if result.Limit != 3 || result.Used != 3 {
+			t.Errorf("Unexpected result %v", result)
+		}
+		if !result.ResetsAt.After(time.Now()) {
+			t.Errorf("Unexpected reset %v", result.ResetsAt)
+		}
+	})
+	t.Run("multiple accounts", func(t *testing.T) {
+		hooks := &mockNotifier{}
+		p := &persistenceLayer{dal: &mockQuotaDatabase{}, webhooks: hooks}
+		WithEventQuota(3)(p)
+
+		if err := p.consumeQuotas(map[string]int{"account-a": 2, "account-b": 4}); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if err := p.consumeQuotas(map[string]int{"account-a": 3, "account-b": 3}); err != nil {
+			t.Errorf("Expected rejected events not to count towards quota, got %v", err)
+		}
+		if !reflect.DeepEqual(hooks.events, []string{webhook.EventQuotaExhausted}) {
+			t.Errorf("Expected a single notification, got %v", hooks.events)
+		}
+	})
+	t.Run("account quotas", func(t *testing.T) {
+		hooks := &mockNotifier{}
+		p := &persistenceLayer{
+			dal:      &mockQuotaDatabase{eventQuotas: map[string]int{"account-a": 2, "account-b": 5}},
+			webhooks: hooks,
+		}
+		WithEventQuota(3)(p)
+
+		if err := p.consumeQuota("account-a", 3); err == nil {
+			t.Error("Expected account quota to be lower than the default, got nil")
+		}
+		if err := p.consumeQuota("account-b", 5); err != nil {
+			t.Errorf("Expected account quota to be higher than the default, got %v", err)
+		}
+		if err := p.consumeQuota("account-c", 4); err == nil {
+			t.Error("Expected default quota to be applied, got nil")
+		}
+		if result := p.quotaResult(Account{AccountID: "account-b", EventQuota: 5}, 0); result.Limit != 5 || result.Used != 5 {
+			t.Errorf("Unexpected result %v", result)
+		}
+	})
+	t.Run("account quota without default", func(t *testing.T) {
+		db := &mockQuotaDatabase{eventQuotas: map[string]int{"account-a": 2}}
+		p := &persistenceLayer{dal: db, quotas: newEventQuotas(), webhooks: &mockNotifier{}}
+
+		if err := p.consumeQuota("account-a", 3); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if err := p.consumeQuota("account-b", 1000); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if db.countCalls != 1 {
+			t.Errorf("Expected usage of unlimited accounts not to be looked up, got %d lookups", db.countCalls)
+		}
+		if result := p.quotaResult(Account{AccountID: "account-b"}, 0); result != nil {
+			t.Errorf("Expected no result for unlimited account, got %v", result)
+		}
+	})
+	t.Run("changed quota", func(t *testing.T) {
+		db := &mockQuotaDatabase{eventQuotas: map[string]int{"account-a": 2}}
+		p := &persistenceLayer{dal: db, quotas: newEventQuotas(), webhooks: &mockNotifier{}, bus: bus.New()}
+		p.invalidateQuotas()
+
+		if err := p.consumeQuota("account-a", 2); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		db.eventQuotas["account-a"] = 4
+		p.publishAccountChange(AccountChange{AccountID: "account-a", Reason: AccountChangeEventQuota})
+		if err := p.consumeQuota("account-a", 2); err != nil {
+			t.Errorf("Expected changed quota to be applied, got %v", err)
+		}
+	})
+	t.Run("released events", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockQuotaDatabase{}, webhooks: &mockNotifier{}}
+		WithEventQuota(3)(p)
+
+		if err := p.consumeQuota("account-a", 3); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		p.releaseQuota("account-a", 2)
+		p.releaseQuota("account-b", 2)
+		if err := p.consumeQuota("account-a", 2); err != nil {
+			t.Errorf("Expected released events not to count towards quota, got %v", err)
+		}
+		if err := p.consumeQuota("account-a", 1); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if _, _, ok := p.quotas.usage(quotaDay(time.Now()), "account-b"); ok {
+			t.Error("Expected releasing unknown usage to be skipped")
+		}
+	})
+	t.Run("unknown account", func(t *testing.T) {
+		db := &mockQuotaDatabase{findAccountErr: ErrUnknownAccount("unknown")}
+		p := &persistenceLayer{dal: db}
+		WithEventQuota(3)(p)
+		if err := p.consumeQuota("account-z", 1); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if db.countCalls != 0 {
+			t.Errorf("Expected no lookup of usage, got %d", db.countCalls)
+		}
+	})
+}
+
+func TestQuotaDay(t *testing.T) {
+	day := quotaDay(time.Date(2021, 3, 14, 23, 59, 0, 0, time.FixedZone("", -3600)))
+	if !day.Equal(time.Date(2021, 3, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected day %v", day)
+	}
+}
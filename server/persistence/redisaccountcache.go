@@ -0,0 +1,79 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisAccountKeyPrefix = "offen:account:"
+
+// redisScanCount is the number of keys requested per call when scanning for
+// keys to be invalidated.
+const redisScanCount = 100
+
+// redisAccountCache stores accounts in Redis so all instances using the same
+// server share cached accounts and their invalidation. As the cache is only
+// an optimization, errors talking to Redis are treated like cache misses.
+type redisAccountCache struct {
+	client redis.Cmdable
+	ttl    time.Duration
+}
+
+// NewRedisAccountCache returns an AccountCache that stores accounts in Redis
+// for the given duration.
+func NewRedisAccountCache(client redis.Cmdable, ttl time.Duration) AccountCache {
+	return &redisAccountCache{client: client, ttl: ttl}
+}
+
+func (r *redisAccountCache) Get(accountID string) (Account, bool) {
+	value, err := r.client.Get(context.Background(), redisAccountKeyPrefix+accountID).Bytes()
+	if err != nil {
+		return Account{}, false
+	}
+	var account Account
+	if err := json.Unmarshal(value, &account); err != nil {
+		return Account{}, false
+	}
+	return account, true
+}
+
+func (r *redisAccountCache) Set(account Account) {
+	value, err := json.Marshal(account)
+	if err != nil {
+		return
+	}
+	r.client.Set(context.Background(), redisAccountKeyPrefix+account.AccountID, value, r.ttl)
+}
+
+func (r *redisAccountCache) Invalidate(accountIDs ...string) {
+	ctx := context.Background()
+	if len(accountIDs) != 0 {
+		keys := make([]string, len(accountIDs))
+		for i, accountID := range accountIDs {
+			keys[i] = redisAccountKeyPrefix + accountID
+		}
+		r.client.Del(ctx, keys...)
+		return
+	}
+	// SCAN is used instead of KEYS so Redis is not blocked while looking
+	// up all cached accounts
+	iter := r.client.Scan(ctx, 0, redisAccountKeyPrefix+"*", redisScanCount).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	for len(keys) != 0 {
+		n := redisScanCount
+		if len(keys) < n {
+			n = len(keys)
+		}
+		r.client.Del(ctx, keys[:n]...)
+		keys = keys[n:]
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisAccountCache(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Unexpected error starting redis: %v", err)
+	}
+	defer s.Close()
+	client := redis.NewClient(&redis.Options{Addr: s.Addr(), MaxRetries: -1})
+	defer client.Close()
+	cache := NewRedisAccountCache(client, time.Minute)
+
+	if _, ok := cache.Get("account-a"); ok {
+		t.Error("Expected cache miss")
+	}
+
+	cache.Set(Account{AccountID: "account-a", UserSalt: "salt-a", Retention: time.Hour})
+	cache.Set(Account{AccountID: "account-b", UserSalt: "salt-b"})
+	if ttl := s.TTL("offen:account:account-a"); ttl != time.Minute {
+		t.Errorf("Unexpected ttl %v", ttl)
+	}
+
+	account, ok := cache.Get("account-a")
+	if !ok {
+		t.Fatal("Expected cache hit")
+	}
+	if account.UserSalt != "salt-a" || account.Retention != time.Hour {
+		t.Errorf("Unexpected account %v", account)
+	}
+
+	cache.Invalidate("account-a")
+	if _, ok := cache.Get("account-a"); ok {
+		t.Error("Expected account-a to be invalidated")
+	}
+	if _, ok := cache.Get("account-b"); !ok {
+		t.Error("Expected account-b to be cached")
+	}
+
+	// more accounts than are scanned in a single call
+	for i := 0; i < redisScanCount*2+1; i++ {
+		cache.Set(Account{AccountID: fmt.Sprintf("account-%d", i)})
+	}
+	s.Set("other-key", "value")
+	cache.Invalidate()
+	if keys := s.Keys(); len(keys) != 1 || keys[0] != "other-key" {
+		t.Errorf("Expected only unrelated keys to be kept, got %d keys", len(keys))
+	}
+
+	cache.Set(Account{AccountID: "account-c"})
+	s.Close()
+	if _, ok := cache.Get("account-c"); ok {
+		t.Error("Expected errors to be treated as cache miss")
+	}
+}
@@ -27,39 +27,63 @@ func (r *relationalDAL) UpdateAccount(a *persistence.Account) error {
 	return nil
 }
 
+func (r *relationalDAL) UpdateAccounts(q interface{}) (int64, error) {
+	switch query := q.(type) {
+	case persistence.UpdateAccountsQueryLastEvent:
+		update := r.db.Model(&Account{}).
+			Where(
+				"account_id IN (?) AND (last_event_at IS NULL OR last_event_at < ?)",
+				query.AccountIDs, query.LastEventAt,
+			).
+			Update("last_event_at", query.LastEventAt)
+		if err := update.Error; err != nil {
+			return 0, fmt.Errorf("relational: error updating time of last event: %w", err)
+		}
+		return update.RowsAffected, nil
+	default:
+		return 0, persistence.ErrBadQuery
+	}
+}
+
+// accountEventsPageSize is the number of events that is requested at once
+// when looking up an account including its events.
+const accountEventsPageSize = 500
+
 func (r *relationalDAL) FindAccount(q interface{}) (persistence.Account, error) {
 	var account Account
 	switch query := q.(type) {
 	case persistence.FindAccountQueryIncludeEvents:
-		if err := r.db.First(&account, "account_id = ?", query.AccountID).Error; err != nil {
+		if err := r.db.Scopes(withDeprecatedKeys).First(&account, "account_id = ?", query.AccountID).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				return account.export(), persistence.ErrUnknownAccount(fmt.Sprintf(`relational: account id "%s" unknown`, query.AccountID))
 			}
 			return account.export(), fmt.Errorf(`relational: error looking up account with id %s: %w`, query.AccountID, err)
 		}
-		var limit int = 500
-		var offset int
+		// events are paginated by their id instead of using an offset, which
+		// would require the database to scan all previous pages for each page.
+		// Secrets are joined instead of being preloaded as a preload issues
+		// another query with a large IN clause for each page.
 		var events []Event
-		queryDB := r.db.Preload("Secret").Limit(limit)
+		lastEventID := query.Since
 		for {
 			var nextEvents []Event
-			var found int64
-			queryDB = queryDB.Offset(offset)
-			if query.Since == "" {
-				found = queryDB.Find(&nextEvents, "account_id = ?", query.AccountID).RowsAffected
-			} else {
-				found = queryDB.Find(&nextEvents, "account_id = ? AND event_id > ?", query.AccountID, query.Since).RowsAffected
+			if err := r.db.Joins("Secret").
+				Where("events.account_id = ? AND events.event_id > ?", query.AccountID, lastEventID).
+				Order("events.event_id").
+				Limit(accountEventsPageSize).
+				Find(&nextEvents).Error; err != nil {
+				return account.export(), fmt.Errorf("relational: error looking up events for account: %w", err)
 			}
 			events = append(events, nextEvents...)
-			if int(found) < limit {
+			if len(nextEvents) < accountEventsPageSize {
 				break
 			}
-			offset += limit
+			lastEventID = nextEvents[len(nextEvents)-1].EventID
 		}
 		account.Events = events
 		return account.export(), nil
 	case persistence.FindAccountQueryByID:
-		if err := r.db.Where("account_id = ?", string(query)).First(&account).Error; err != nil {
+		if err := r.db.Scopes(withDeprecatedKeys).Where("account_id = ?", string(query)).First(&account).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				return account.export(), persistence.ErrUnknownAccount("relational: no matching account found")
 			}
@@ -67,7 +91,7 @@ func (r *relationalDAL) FindAccount(q interface{}) (persistence.Account, error)
 		}
 		return account.export(), nil
 	case persistence.FindAccountQueryActiveByID:
-		if err := r.db.Where(
+		if err := r.db.Scopes(withDeprecatedKeys).Where(
 			"account_id = ? AND retired = ?",
 			string(query),
 			false,
@@ -87,7 +111,7 @@ func (r *relationalDAL) FindAccounts(q interface{}) ([]persistence.Account, erro
 	var accounts []Account
 	switch q.(type) {
 	case persistence.FindAccountsQueryAllAccounts:
-		if err := r.db.Find(&accounts).Error; err != nil {
+		if err := r.db.Scopes(withDeprecatedKeys).Find(&accounts).Error; err != nil {
 			return nil, fmt.Errorf("relational: error looking up all accounts: %w", err)
 		}
 		result := []persistence.Account{}
@@ -99,3 +123,10 @@ func (r *relationalDAL) FindAccounts(q interface{}) ([]persistence.Account, erro
 		return nil, persistence.ErrBadQuery
 	}
 }
+
+// withDeprecatedKeys preloads the deprecated keys of accounts, oldest first.
+func withDeprecatedKeys(db *gorm.DB) *gorm.DB {
+	return db.Preload("DeprecatedKeys", func(db *gorm.DB) *gorm.DB {
+		return db.Order("deprecated")
+	})
+}
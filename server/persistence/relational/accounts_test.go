@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/offen/offen/server/persistence"
 	"gorm.io/gorm"
@@ -105,6 +106,39 @@ func TestRelationalDAL_UpdateAccount(t *testing.T) {
 				return nil
 			},
 		},
+		{
+			"add deprecated key",
+			func(db *gorm.DB) error {
+				if err := db.Create(&Account{
+					AccountID: "account-a",
+					PublicKey: "old-public-key",
+				}).Error; err != nil {
+					return err
+				}
+				return nil
+			},
+			&persistence.Account{
+				AccountID: "account-a",
+				PublicKey: "new-public-key",
+				DeprecatedKeys: []persistence.DeprecatedAccountKey{
+					{KeyID: "key-a", AccountID: "account-a", PublicKey: "old-public-key"},
+				},
+			},
+			false,
+			func(db *gorm.DB) error {
+				var account Account
+				if err := db.Preload("DeprecatedKeys").First(&account, "account_id = ?", "account-a").Error; err != nil {
+					return err
+				}
+				if account.PublicKey != "new-public-key" {
+					return fmt.Errorf("unexpected public key %v", account.PublicKey)
+				}
+				if len(account.DeprecatedKeys) != 1 || account.DeprecatedKeys[0].PublicKey != "old-public-key" {
+					return fmt.Errorf("unexpected deprecated keys %v", account.DeprecatedKeys)
+				}
+				return nil
+			},
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -129,6 +163,64 @@ func TestRelationalDAL_UpdateAccount(t *testing.T) {
 	}
 }
 
+func TestRelationalDAL_UpdateAccounts(t *testing.T) {
+	earlier := time.Date(2021, 3, 14, 12, 0, 0, 0, time.UTC)
+	now := time.Date(2021, 3, 15, 12, 0, 0, 0, time.UTC)
+	later := time.Date(2021, 3, 16, 12, 0, 0, 0, time.UTC)
+
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+	dal := NewRelationalDAL(db)
+
+	for _, account := range []Account{
+		{AccountID: "account-a"},
+		{AccountID: "account-b", LastEventAt: &earlier},
+		{AccountID: "account-c", LastEventAt: &later},
+		{AccountID: "account-d"},
+	} {
+		if err := db.Create(&account).Error; err != nil {
+			t.Fatalf("Error setting up test: %v", err)
+		}
+	}
+
+	if _, err := dal.UpdateAccounts(struct{}{}); err != persistence.ErrBadQuery {
+		t.Errorf("Expected ErrBadQuery, got %v", err)
+	}
+
+	affected, err := dal.UpdateAccounts(persistence.UpdateAccountsQueryLastEvent{
+		AccountIDs:  []string{"account-a", "account-b", "account-c"},
+		LastEventAt: now,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if affected != 2 {
+		t.Errorf("Expected 2 updated accounts, got %d", affected)
+	}
+
+	expected := map[string]*time.Time{
+		"account-a": &now,
+		"account-b": &now,
+		"account-c": &later,
+		"account-d": nil,
+	}
+	for accountID, expectedTime := range expected {
+		var account Account
+		if err := db.First(&account, "account_id = ?", accountID).Error; err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if expectedTime == nil {
+			if account.LastEventAt != nil {
+				t.Errorf("Expected no time of last event for %s, got %v", accountID, account.LastEventAt)
+			}
+			continue
+		}
+		if account.LastEventAt == nil || !account.LastEventAt.Equal(*expectedTime) {
+			t.Errorf("Expected time of last event %v for %s, got %v", expectedTime, accountID, account.LastEventAt)
+		}
+	}
+}
+
 func TestRelationalDAL_FindAccount(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -229,6 +321,36 @@ func TestRelationalDAL_FindAccount(t *testing.T) {
 			persistence.Account{},
 			true,
 		},
+		{
+			"by id with deprecated keys",
+			func(db *gorm.DB) error {
+				if err := db.Save(&Account{
+					AccountID: "account-a",
+					PublicKey: "public-key",
+					DeprecatedKeys: []DeprecatedAccountKey{
+						{KeyID: "key-a", AccountID: "account-a", PublicKey: "old-public-key", EncryptedPrivateKey: "old-private-key"},
+					},
+				}).Error; err != nil {
+					return fmt.Errorf("error inserting fixture: %v", err)
+				}
+				if err := db.Save(&DeprecatedAccountKey{
+					KeyID:     "key-z",
+					AccountID: "account-z",
+				}).Error; err != nil {
+					return fmt.Errorf("error inserting fixture: %v", err)
+				}
+				return nil
+			},
+			persistence.FindAccountQueryByID("account-a"),
+			persistence.Account{
+				AccountID: "account-a",
+				PublicKey: "public-key",
+				DeprecatedKeys: []persistence.DeprecatedAccountKey{
+					{KeyID: "key-a", AccountID: "account-a", PublicKey: "old-public-key", EncryptedPrivateKey: "old-private-key"},
+				},
+			},
+			false,
+		},
 		{
 			"include events",
 			func(db *gorm.DB) error {
@@ -264,6 +386,55 @@ func TestRelationalDAL_FindAccount(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"include events with secrets",
+			func(db *gorm.DB) error {
+				if err := db.Save(&Account{
+					AccountID: "account-id",
+				}).Error; err != nil {
+					return fmt.Errorf("error inserting fixture: %v", err)
+				}
+				if err := db.Save(&Secret{
+					SecretID:        "secret-id",
+					EncryptedSecret: "encrypted-secret",
+				}).Error; err != nil {
+					return fmt.Errorf("error inserting fixture: %v", err)
+				}
+				if err := db.Save(&Event{
+					EventID:   "event-id-a",
+					Payload:   "payload",
+					AccountID: "account-id",
+					SecretID:  strptr("secret-id"),
+				}).Error; err != nil {
+					return fmt.Errorf("error inserting fixture: %v", err)
+				}
+				if err := db.Save(&Event{
+					EventID:   "event-id-b",
+					Payload:   "anonymous-payload",
+					AccountID: "account-id",
+				}).Error; err != nil {
+					return fmt.Errorf("error inserting fixture: %v", err)
+				}
+				return nil
+			},
+			persistence.FindAccountQueryIncludeEvents{
+				AccountID: "account-id",
+			},
+			persistence.Account{
+				AccountID: "account-id",
+				Events: []persistence.Event{
+					{
+						EventID:   "event-id-a",
+						Payload:   "payload",
+						AccountID: "account-id",
+						SecretID:  strptr("secret-id"),
+						Secret:    persistence.Secret{SecretID: "secret-id", EncryptedSecret: "encrypted-secret"},
+					},
+					{EventID: "event-id-b", Payload: "anonymous-payload", AccountID: "account-id"},
+				},
+			},
+			false,
+		},
 		{
 			"include events unknown account",
 			func(db *gorm.DB) error {
@@ -399,3 +570,57 @@ func TestRelationalDAL_FindAccounts(t *testing.T) {
 		})
 	}
 }
+
+// seedBenchmarkDatabase creates a single account owning the given number of
+// events, spread across the given number of users.
+func seedBenchmarkDatabase(b *testing.B, db *gorm.DB, events, users int) []string {
+	if err := db.Create(&Account{AccountID: "account-a", Name: "name"}).Error; err != nil {
+		b.Fatalf("Unexpected error %v", err)
+	}
+	var secretIDs []string
+	var secrets []Secret
+	for i := 0; i < users; i++ {
+		id := fmt.Sprintf("secret-%d", i)
+		secretIDs = append(secretIDs, id)
+		secrets = append(secrets, Secret{SecretID: id, EncryptedSecret: "encrypted"})
+	}
+	if err := db.CreateInBatches(secrets, 100).Error; err != nil {
+		b.Fatalf("Unexpected error %v", err)
+	}
+	var evts []Event
+	for i := 0; i < events; i++ {
+		evts = append(evts, Event{
+			EventID:   fmt.Sprintf("event-%08d", i),
+			Sequence:  fmt.Sprintf("event-%08d", i),
+			AccountID: "account-a",
+			SecretID:  &secretIDs[i%users],
+			Payload:   "payload",
+		})
+	}
+	if err := db.CreateInBatches(evts, 100).Error; err != nil {
+		b.Fatalf("Unexpected error %v", err)
+	}
+	return secretIDs
+}
+
+func BenchmarkRelationalDAL_FindAccount(b *testing.B) {
+	for _, size := range []int{1000, 10000} {
+		b.Run(fmt.Sprintf("%d events", size), func(b *testing.B) {
+			db, closeDB := createTestDatabase()
+			defer closeDB()
+			seedBenchmarkDatabase(b, db, size, size/10)
+			dal := NewRelationalDAL(db)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				account, err := dal.FindAccount(persistence.FindAccountQueryIncludeEvents{AccountID: "account-a"})
+				if err != nil {
+					b.Fatalf("Unexpected error %v", err)
+				}
+				if len(account.Events) != size {
+					b.Fatalf("Unexpected number of events %d", len(account.Events))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"fmt"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func (r *relationalDAL) CreateAPIToken(t *persistence.APIToken) error {
+	local := importAPIToken(t)
+	if err := r.db.Create(&local).Error; err != nil {
+		return fmt.Errorf("relational: error creating api token: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) FindAPITokens(q interface{}) ([]persistence.APIToken, error) {
+	var tokens []APIToken
+	switch query := q.(type) {
+	case persistence.FindAPITokensQueryByTokenID:
+		if err := r.db.Where("token_id = ?", string(query)).Find(&tokens).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up api token by id: %w", err)
+		}
+	case persistence.FindAPITokensQueryByAccountUserID:
+		if err := r.db.Where("account_user_id = ?", string(query)).Order("created ASC").Find(&tokens).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up api tokens by account user id: %w", err)
+		}
+	default:
+		return nil, persistence.ErrBadQuery
+	}
+	result := []persistence.APIToken{}
+	for _, t := range tokens {
+		result = append(result, t.export())
+	}
+	return result, nil
+}
+
+func (r *relationalDAL) UpdateAPIToken(t *persistence.APIToken) error {
+	local := importAPIToken(t)
+	exists := r.db.Where("token_id = ?", local.TokenID).First(&APIToken{}).Error
+	if exists != nil {
+		return fmt.Errorf("relational: error looking up api token for update: %w", exists)
+	}
+	if err := r.db.Save(&local).Error; err != nil {
+		return fmt.Errorf("relational: error updating api token: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) DeleteAPITokens(q interface{}) (int64, error) {
+	switch query := q.(type) {
+	case persistence.DeleteAPITokensQueryByTokenID:
+		deletion := r.db.Where("token_id = ?", string(query)).Delete(&APIToken{})
+		if err := deletion.Error; err != nil {
+			return 0, fmt.Errorf("relational: error deleting api token by id: %w", err)
+		}
+		return deletion.RowsAffected, nil
+	default:
+		return 0, persistence.ErrBadQuery
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestRelationalDAL_APITokens(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+
+	dal := NewRelationalDAL(db)
+	token := persistence.APIToken{
+		TokenID:       "token-a",
+		AccountUserID: "user-a",
+		Name:          "reporting",
+		HashedSecret:  "hashed",
+		AccountIDs:    []string{"account-a", "account-b"},
+		Scopes:        []persistence.APITokenScope{persistence.APITokenScopeReadStats},
+	}
+	if err := dal.CreateAPIToken(&token); err != nil {
+		t.Fatalf("Unexpected error creating token: %v", err)
+	}
+
+	if _, err := dal.FindAPITokens("token-a"); err != persistence.ErrBadQuery {
+		t.Errorf("Expected bad query error, got %v", err)
+	}
+
+	result, err := dal.FindAPITokens(persistence.FindAPITokensQueryByAccountUserID("user-a"))
+	if err != nil {
+		t.Fatalf("Unexpected error looking up tokens: %v", err)
+	}
+	if !reflect.DeepEqual([]persistence.APIToken{token}, result) {
+		t.Errorf("Unexpected result %v", result)
+	}
+
+	affected, err := dal.DeleteAPITokens(persistence.DeleteAPITokensQueryByTokenID("token-a"))
+	if err != nil || affected != 1 {
+		t.Errorf("Unexpected deletion result %d, %v", affected, err)
+	}
+	result, _ = dal.FindAPITokens(persistence.FindAPITokensQueryByTokenID("token-a"))
+	if len(result) != 0 {
+		t.Errorf("Expected token to be deleted, got %v", result)
+	}
+}
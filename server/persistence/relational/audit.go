@@ -0,0 +1,54 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"fmt"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func (r *relationalDAL) CreateAuditEntry(a *persistence.AuditEntry) error {
+	local := importAuditEntry(a)
+	if err := r.db.Create(&local).Error; err != nil {
+		return fmt.Errorf("relational: error creating audit entry: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) FindAuditEntries(q interface{}) ([]persistence.AuditEntry, error) {
+	var entries []AuditEntry
+	switch query := q.(type) {
+	case persistence.FindAuditEntriesQueryFiltered:
+		db := r.db
+		if query.AccountID != "" {
+			db = db.Where("account_id = ?", query.AccountID)
+		}
+		if query.ActorID != "" {
+			db = db.Where("actor_id = ?", query.ActorID)
+		}
+		if query.Action != "" {
+			db = db.Where("action = ?", query.Action)
+		}
+		if !query.Since.IsZero() {
+			db = db.Where("created >= ?", query.Since)
+		}
+		if !query.Until.IsZero() {
+			db = db.Where("created < ?", query.Until)
+		}
+		if query.Limit > 0 {
+			db = db.Limit(query.Limit)
+		}
+		if err := db.Order("entry_id DESC").Find(&entries).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up audit entries: %w", err)
+		}
+	default:
+		return nil, persistence.ErrBadQuery
+	}
+	result := []persistence.AuditEntry{}
+	for _, e := range entries {
+		result = append(result, e.export())
+	}
+	return result, nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestRelationalDAL_AuditEntries(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+	dal := NewRelationalDAL(db)
+
+	base := time.Date(2021, 3, 14, 12, 0, 0, 0, time.UTC)
+	for i, entry := range []persistence.AuditEntry{
+		{EntryID: "entry-a", Action: "account.create", ActorID: "user-a"},
+		{EntryID: "entry-b", Action: "account.retention", ActorID: "user-a", AccountID: "account-a"},
+		{EntryID: "entry-c", Action: "account.retention", ActorID: "user-b", AccountID: "account-b"},
+		{EntryID: "entry-d", Action: "account.retire", ActorID: "user-a", AccountID: "account-a", RequestID: "request-d"},
+	} {
+		entry.Created = base.Add(time.Duration(i) * time.Hour)
+		if err := dal.CreateAuditEntry(&entry); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	if _, err := dal.FindAuditEntries(struct{}{}); err != persistence.ErrBadQuery {
+		t.Errorf("Expected ErrBadQuery, got %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		query       persistence.FindAuditEntriesQueryFiltered
+		expectedIDs []string
+	}{
+		{"all", persistence.FindAuditEntriesQueryFiltered{}, []string{"entry-d", "entry-c", "entry-b", "entry-a"}},
+		{"by account", persistence.FindAuditEntriesQueryFiltered{AccountID: "account-a"}, []string{"entry-d", "entry-b"}},
+		{"by actor and action", persistence.FindAuditEntriesQueryFiltered{ActorID: "user-a", Action: "account.retention"}, []string{"entry-b"}},
+		{"time range", persistence.FindAuditEntriesQueryFiltered{Since: base.Add(time.Hour), Until: base.Add(3 * time.Hour)}, []string{"entry-c", "entry-b"}},
+		{"limit", persistence.FindAuditEntriesQueryFiltered{Limit: 1}, []string{"entry-d"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := dal.FindAuditEntries(test.query)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			ids := []string{}
+			for _, entry := range result {
+				ids = append(ids, entry.EntryID)
+			}
+			if !reflect.DeepEqual(test.expectedIDs, ids) {
+				t.Errorf("Expected %v, got %v", test.expectedIDs, ids)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const backupVersion = 1
+
+const backupBatchSize = 500
+
+// backupTables lists all tables that are included in a backup. Sessions and
+// job locks are ephemeral and therefore skipped, as are sync states which
+// only apply to the instance that recorded them.
+var backupTables = []interface{}{
+	&Account{},
+	&AccountUser{},
+	&AccountUserRelationship{},
+	&Secret{},
+	&Event{},
+	&Tombstone{},
+	&WebAuthnCredential{},
+	&APIToken{},
+	&DeprecatedAccountKey{},
+	&AuditEntry{},
+}
+
+// backupHeader is the first line of each backup.
+type backupHeader struct {
+	Version    int       `json:"version"`
+	Created    time.Time `json:"created"`
+	Migrations []string  `json:"migrations"`
+}
+
+// backupRecord is a single row of one of the backed up tables.
+type backupRecord struct {
+	Table  string          `json:"table"`
+	Record json.RawMessage `json:"record"`
+}
+
+// Backup writes all rows of all known tables to w as newline delimited JSON.
+// Rows are read in a single read only transaction so the backup is
+// consistent even when the database is being written to concurrently.
+func (r *relationalDAL) Backup(w io.Writer) error {
+	txn := r.db.Begin(&sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err := txn.Error; err != nil {
+		return fmt.Errorf("relational: error beginning transaction for backup: %w", err)
+	}
+	defer txn.Rollback()
+
+	migrations := []string{}
+	if txn.Migrator().HasTable("migrations") {
+		if err := txn.Table("migrations").Order("id").Pluck("id", &migrations).Error; err != nil {
+			return fmt.Errorf("relational: error reading applied migrations: %w", err)
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(backupHeader{
+		Version:    backupVersion,
+		Created:    time.Now().UTC(),
+		Migrations: migrations,
+	}); err != nil {
+		return fmt.Errorf("relational: error writing backup header: %w", err)
+	}
+
+	for _, model := range backupTables {
+		stmt := &gorm.Statement{DB: txn}
+		if err := stmt.Parse(model); err != nil {
+			return fmt.Errorf("relational: error parsing model: %w", err)
+		}
+		table := stmt.Schema.Table
+
+		rows := reflect.New(reflect.SliceOf(reflect.TypeOf(model).Elem()))
+		if err := txn.Model(model).FindInBatches(rows.Interface(), backupBatchSize, func(*gorm.DB, int) error {
+			batch := rows.Elem()
+			for i := 0; i < batch.Len(); i++ {
+				// only columns are included, skipping associations
+				row := map[string]interface{}{}
+				for _, field := range stmt.Schema.Fields {
+					if field.DBName != "" {
+						row[field.Name] = field.ReflectValueOf(batch.Index(i)).Interface()
+					}
+				}
+				b, err := json.Marshal(row)
+				if err != nil {
+					return fmt.Errorf("error marshaling row: %w", err)
+				}
+				if err := enc.Encode(backupRecord{Table: table, Record: b}); err != nil {
+					return fmt.Errorf("error writing row: %w", err)
+				}
+			}
+			return nil
+		}).Error; err != nil {
+			return fmt.Errorf("relational: error backing up table %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// Restore replaces the content of all tables included in backups with the
+// rows read from r, which is expected to contain a backup created by Backup.
+// The restore happens in a single transaction, so in case reading the backup
+// fails at any point, the database is left untouched.
+func (r *relationalDAL) Restore(reader io.Reader) error {
+	dec := json.NewDecoder(reader)
+	var header backupHeader
+	if err := dec.Decode(&header); err != nil {
+		return fmt.Errorf("relational: error reading backup header: %w", err)
+	}
+	if header.Version != backupVersion {
+		return fmt.Errorf("relational: unsupported backup version %d", header.Version)
+	}
+
+	txn := r.db.Begin()
+	if err := txn.Error; err != nil {
+		return fmt.Errorf("relational: error beginning transaction for restore: %w", err)
+	}
+	defer txn.Rollback()
+
+	if len(header.Migrations) != 0 {
+		var applied []string
+		if err := txn.Table("migrations").Pluck("id", &applied).Error; err != nil {
+			return fmt.Errorf("relational: error reading applied migrations: %w", err)
+		}
+		known := map[string]bool{}
+		for _, migration := range applied {
+			known[migration] = true
+		}
+		for _, migration := range header.Migrations {
+			if !known[migration] {
+				return fmt.Errorf("relational: backup requires unknown migration %s, consider upgrading", migration)
+			}
+		}
+	}
+
+	models := map[string]interface{}{}
+	for _, model := range append(backupTables, &Session{}) {
+		stmt := &gorm.Statement{DB: txn}
+		if err := stmt.Parse(model); err != nil {
+			return fmt.Errorf("relational: error parsing model: %w", err)
+		}
+		models[stmt.Schema.Table] = model
+		if err := txn.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(model).Error; err != nil {
+			return fmt.Errorf("relational: error clearing table %s: %w", stmt.Schema.Table, err)
+		}
+	}
+	// sessions are not part of backups and only cleared
+	delete(models, "sessions")
+
+	var batchTable string
+	var batch reflect.Value
+	flush := func() error {
+		if batchTable == "" || batch.Len() == 0 {
+			return nil
+		}
+		if err := txn.Omit(clause.Associations).Create(batch.Interface()).Error; err != nil {
+			return fmt.Errorf("relational: error restoring rows of table %s: %w", batchTable, err)
+		}
+		batch = reflect.MakeSlice(batch.Type(), 0, backupBatchSize)
+		return nil
+	}
+
+	for {
+		var record backupRecord
+		if err := dec.Decode(&record); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return fmt.Errorf("relational: error reading backup record: %w", err)
+		}
+		model, ok := models[record.Table]
+		if !ok {
+			return fmt.Errorf("relational: backup contains unknown table %s", record.Table)
+		}
+		if record.Table != batchTable || batch.Len() == backupBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+			if record.Table != batchTable {
+				batchTable = record.Table
+				batch = reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(model)), 0, backupBatchSize)
+			}
+		}
+		row := reflect.New(reflect.TypeOf(model).Elem())
+		if err := json.Unmarshal(record.Record, row.Interface()); err != nil {
+			return fmt.Errorf("relational: error decoding row of table %s: %w", record.Table, err)
+		}
+		batch = reflect.Append(batch, row)
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	if err := txn.Commit().Error; err != nil {
+		return fmt.Errorf("relational: error committing restore: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRelationalDAL_Backup(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+
+	for _, record := range []interface{}{
+		&Account{AccountID: "account-a", Name: "a"},
+		&Account{AccountID: "account-b", Name: "b"},
+		&Secret{SecretID: "secret-a", EncryptedSecret: "encrypted"},
+		&Event{EventID: "event-a", AccountID: "account-a", SecretID: strptr("secret-a"), Payload: "payload"},
+		&Session{SessionID: "session-a", Expires: time.Now().Add(time.Hour)},
+	} {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatalf("Unexpected error creating fixture %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	dal := NewRelationalDAL(db)
+	if err := dal.Backup(&buf); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	scanner := bufio.NewScanner(&buf)
+	scanner.Scan()
+	var header backupHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		t.Fatalf("Unexpected error decoding header %v", err)
+	}
+	if header.Version != backupVersion {
+		t.Errorf("Unexpected version %v", header.Version)
+	}
+
+	tables := map[string]int{}
+	var event map[string]interface{}
+	for scanner.Scan() {
+		var record backupRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Unexpected error decoding record %v", err)
+		}
+		tables[record.Table]++
+		if record.Table == "events" {
+			json.Unmarshal(record.Record, &event)
+		}
+	}
+	if !reflect.DeepEqual(map[string]int{"accounts": 2, "secrets": 1, "events": 1}, tables) {
+		t.Errorf("Unexpected tables %v", tables)
+	}
+	if event["Payload"] != "payload" || event["SecretID"] != "secret-a" {
+		t.Errorf("Unexpected event %v", event)
+	}
+	if _, ok := event["Secret"]; ok {
+		t.Errorf("Unexpected association in event %v", event)
+	}
+}
+
+func TestRelationalDAL_Restore(t *testing.T) {
+	source, closeSource := createTestDatabase()
+	defer closeSource()
+
+	created := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	fixtures := []interface{}{
+		&Account{AccountID: "account-a", Name: "a", Created: created, Retention: time.Hour},
+		&AccountUser{AccountUserID: "account-user-a", AdminLevel: 1},
+		&AccountUserRelationship{RelationshipID: "relationship-a", AccountUserID: "account-user-a", AccountID: "account-a"},
+		&Secret{SecretID: "secret-a", EncryptedSecret: "encrypted"},
+		&Event{EventID: "event-a", AccountID: "account-a", SecretID: strptr("secret-a"), Payload: "payload"},
+		&Event{EventID: "event-b", AccountID: "account-a", Payload: "anonymous"},
+	}
+	for _, record := range fixtures {
+		if err := source.Create(record).Error; err != nil {
+			t.Fatalf("Unexpected error creating fixture %v", err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := NewRelationalDAL(source).Backup(&buf); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	backup := buf.String()
+
+	t.Run("ok", func(t *testing.T) {
+		target, closeTarget := createTestDatabase()
+		defer closeTarget()
+		for _, record := range []interface{}{
+			&Account{AccountID: "account-z"},
+			&Session{SessionID: "session-z"},
+		} {
+			if err := target.Create(record).Error; err != nil {
+				t.Fatalf("Unexpected error creating fixture %v", err)
+			}
+		}
+
+		if err := NewRelationalDAL(target).Restore(strings.NewReader(backup)); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		var accounts []Account
+		target.Find(&accounts)
+		if len(accounts) != 1 || accounts[0].AccountID != "account-a" || accounts[0].Retention != time.Hour || !accounts[0].Created.Equal(created) {
+			t.Errorf("Unexpected accounts %v", accounts)
+		}
+		var events []Event
+		target.Order("event_id").Find(&events)
+		if len(events) != 2 || *events[0].SecretID != "secret-a" || events[1].SecretID != nil {
+			t.Errorf("Unexpected events %v", events)
+		}
+		for model, expected := range map[interface{}]int64{
+			&AccountUser{}:             1,
+			&AccountUserRelationship{}: 1,
+			&Secret{}:                  1,
+			&Session{}:                 0,
+		} {
+			var count int64
+			target.Model(model).Count(&count)
+			if count != expected {
+				t.Errorf("Expected %d rows for %T, got %d", expected, model, count)
+			}
+		}
+	})
+
+	for name, input := range map[string]string{
+		"bad version":       `{"version":99}`,
+		"unknown table":     `{"version":1}` + "\n" + `{"table":"users","record":{}}`,
+		"unknown migration": `{"version":1,"migrations":["999_from_the_future"]}`,
+		"malformed record":  `{"version":1}` + "\n" + `{"table":"accounts","record":{"AccountID":12}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			target, closeTarget := createTestDatabase()
+			defer closeTarget()
+			target.Exec("CREATE TABLE migrations (id VARCHAR(255) PRIMARY KEY)")
+			if err := target.Create(&Account{AccountID: "account-z"}).Error; err != nil {
+				t.Fatalf("Unexpected error creating fixture %v", err)
+			}
+
+			if err := NewRelationalDAL(target).Restore(strings.NewReader(input)); err == nil {
+				t.Error("Expected error, got nil")
+			}
+
+			var count int64
+			target.Model(&Account{}).Count(&count)
+			if count != 1 {
+				t.Errorf("Expected existing data to be left untouched, got %d accounts", count)
+			}
+		})
+	}
+}
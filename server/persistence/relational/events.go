@@ -5,10 +5,16 @@ package relational
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/offen/offen/server/persistence"
+	"gorm.io/gorm"
 )
 
+// eventIDUpdateChunkSize is the maximum number of event ids that are
+// replaced using a single statement.
+const eventIDUpdateChunkSize = 250
+
 func (r *relationalDAL) CreateEvent(e *persistence.Event) error {
 	local := importEvent(e)
 	if err := r.db.Create(&local).Error; err != nil {
@@ -17,6 +23,21 @@ func (r *relationalDAL) CreateEvent(e *persistence.Event) error {
 	return nil
 }
 
+// eventInsertBatchSize is the maximum number of events that are inserted
+// using a single statement.
+const eventInsertBatchSize = 100
+
+func (r *relationalDAL) CreateEvents(events []*persistence.Event) error {
+	locals := make([]Event, len(events))
+	for i, e := range events {
+		locals[i] = importEvent(e)
+	}
+	if err := r.db.CreateInBatches(&locals, eventInsertBatchSize).Error; err != nil {
+		return fmt.Errorf("relational: error creating events: %w", err)
+	}
+	return nil
+}
+
 func exportEvents(evts []Event) []persistence.Event {
 	result := []persistence.Event{}
 	for _, e := range evts {
@@ -33,6 +54,16 @@ func (r *relationalDAL) FindEvents(q interface{}) ([]persistence.Event, error) {
 			return nil, fmt.Errorf("relational: error looking up events by age: %w", err)
 		}
 		return exportEvents(events), nil
+	case persistence.FindEventsQueryOlderThanLimit:
+		if err := r.db.Where("event_id < ?", query.EventID).Order("event_id").Limit(query.Limit).Find(&events).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up batch of events by age: %w", err)
+		}
+		return exportEvents(events), nil
+	case persistence.FindEventsQueryByAccountIDOlderThan:
+		if err := r.db.Find(&events, "account_id = ? AND event_id < ?", query.AccountID, query.EventID).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up events of account by age: %w", err)
+		}
+		return exportEvents(events), nil
 	case persistence.FindEventsQueryForSecretIDs:
 		var eventConditions []interface{}
 		if query.Since != "" {
@@ -72,11 +103,247 @@ func (r *relationalDAL) FindEvents(q interface{}) ([]persistence.Event, error) {
 			offset += limit
 		}
 		return exportEvents(events), nil
+	case persistence.FindEventsQueryMetadataBySecretID:
+		if err := r.db.Select("event_id", "sequence", "account_id", "secret_id").Where("secret_id = ?", query.SecretID).Order("event_id").Limit(query.Limit).Find(&events).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up event metadata for secret: %w", err)
+		}
+		return exportEvents(events), nil
+	case persistence.FindEventsQueryInRange:
+		q := r.db.Preload("Secret").Where("sequence > ? AND sequence <= ?", query.Since, query.Until).Order("sequence, event_id")
+		if query.Limit > 0 {
+			q = q.Limit(query.Limit)
+		}
+		if err := q.Find(&events).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up events in range: %w", err)
+		}
+		return exportEvents(events), nil
+	default:
+		return nil, persistence.ErrBadQuery
+	}
+}
+
+// eventsStreamPageSize is the number of events that is read from the database
+// at once when streaming events.
+const eventsStreamPageSize = 500
+
+// StreamEvents calls fn for each page of events matching the given query.
+// Pages are requested using the position of the last event of the previous
+// page instead of an offset, which would require the database to scan all
+// previous pages for each page.
+func (r *relationalDAL) StreamEvents(q interface{}, fn func([]persistence.Event) error) error {
+	switch query := q.(type) {
+	case persistence.StreamEventsQueryForSecretIDs:
+		var lastAccountID, lastEventID string
+		for {
+			var events []Event
+			q := r.db.Where("secret_id IN (?)", query.SecretIDs)
+			if query.Since != "" {
+				q = q.Where("sequence > ?", query.Since)
+			}
+			if query.Until != "" {
+				q = q.Where("sequence <= ?", query.Until)
+			}
+			if lastEventID != "" {
+				q = q.Where("(account_id > ? OR (account_id = ? AND event_id > ?))", lastAccountID, lastAccountID, lastEventID)
+			}
+			if err := q.Order("account_id, event_id").Limit(eventsStreamPageSize).Find(&events).Error; err != nil {
+				return fmt.Errorf("relational: error looking up page of events: %w", err)
+			}
+			if len(events) != 0 {
+				if err := fn(exportEvents(events)); err != nil {
+					return err
+				}
+			}
+			if len(events) < eventsStreamPageSize {
+				return nil
+			}
+			last := events[len(events)-1]
+			lastAccountID, lastEventID = last.AccountID, last.EventID
+		}
+	case persistence.StreamEventsQueryByAccountID:
+		// secrets are joined instead of being preloaded as a preload issues
+		// another query with a large IN clause for each page
+		lastEventID := query.Since
+		for {
+			var events []Event
+			if err := r.db.Joins("Secret").
+				Where("events.account_id = ? AND events.event_id > ?", query.AccountID, lastEventID).
+				Order("events.event_id").
+				Limit(eventsStreamPageSize).
+				Find(&events).Error; err != nil {
+				return fmt.Errorf("relational: error looking up page of events for account: %w", err)
+			}
+			if len(events) != 0 {
+				if err := fn(exportEvents(events)); err != nil {
+					return err
+				}
+			}
+			if len(events) < eventsStreamPageSize {
+				return nil
+			}
+			lastEventID = events[len(events)-1].EventID
+		}
+	default:
+		return persistence.ErrBadQuery
+	}
+}
+
+// eventCountBucketsPerQuery is the maximum number of buckets that are counted
+// in a single query, as each bucket adds a parameter to the query.
+const eventCountBucketsPerQuery = 200
+
+// eventCountColumns selects the aggregated values of an EventCount. Payloads
+// are encoded as ASCII, so their length in characters equals their size in
+// bytes for all dialects.
+const eventCountColumns = "COUNT(*) AS events, COUNT(DISTINCT secret_id) AS distinct_users, " +
+	"COALESCE(SUM(LENGTH(payload)), 0) AS payload_bytes, " +
+	"COALESCE(MIN(event_id), '') AS oldest_event_id, COALESCE(MAX(event_id), '') AS newest_event_id, " +
+	"COALESCE(MAX(sequence), '') AS newest_sequence"
+
+type eventCountRow struct {
+	Bucket         int
+	Events         int64
+	DistinctUsers  int64
+	PayloadBytes   int64
+	OldestEventID  string
+	NewestEventID  string
+	NewestSequence string
+}
+
+func (r *relationalDAL) CountEvents(q interface{}) ([]persistence.EventCount, error) {
+	switch query := q.(type) {
+	case persistence.CountEventsQueryByAccountID:
+		var rows []eventCountRow
+		if err := r.db.Model(&Event{}).
+			Select("0 AS bucket, "+eventCountColumns).
+			Where("account_id = ?", string(query)).
+			Scan(&rows).Error; err != nil {
+			return nil, fmt.Errorf("relational: error counting events of account: %w", err)
+		}
+		return exportEventCounts(rows), nil
+	case persistence.CountEventsQueryByAccountIDSince:
+		var rows []eventCountRow
+		if err := r.db.Model(&Event{}).
+			Select("0 AS bucket, "+eventCountColumns).
+			Where("account_id = ? AND event_id >= ?", query.AccountID, query.Since).
+			Scan(&rows).Error; err != nil {
+			return nil, fmt.Errorf("relational: error counting recent events of account: %w", err)
+		}
+		return exportEventCounts(rows), nil
+	case persistence.CountEventsQueryByAccountIDOlderThan:
+		var rows []eventCountRow
+		if err := r.db.Model(&Event{}).
+			Select("0 AS bucket, "+eventCountColumns).
+			Where("account_id = ? AND event_id < ?", query.AccountID, query.EventID).
+			Scan(&rows).Error; err != nil {
+			return nil, fmt.Errorf("relational: error counting events of account by age: %w", err)
+		}
+		return exportEventCounts(rows), nil
+	case persistence.CountEventsQueryForSecretIDs:
+		var rows []eventCountRow
+		q := r.db.Model(&Event{}).
+			Select("0 AS bucket, "+eventCountColumns).
+			Where("secret_id IN (?)", query.SecretIDs)
+		if query.Since != "" {
+			q = q.Where("sequence > ?", query.Since)
+		}
+		if err := q.Scan(&rows).Error; err != nil {
+			return nil, fmt.Errorf("relational: error counting events for secrets: %w", err)
+		}
+		return exportEventCounts(rows), nil
+	case persistence.CountEventsQueryByAccountIDInBuckets:
+		result := []persistence.EventCount{}
+		buckets := len(query.Boundaries) - 1
+		for offset := 0; offset < buckets; offset += eventCountBucketsPerQuery {
+			end := offset + eventCountBucketsPerQuery
+			if end > buckets {
+				end = buckets
+			}
+			// all events of the query are greater than or equal to the
+			// first boundary, so the first upper boundary an event is less
+			// than identifies its bucket
+			var bucket strings.Builder
+			var args []interface{}
+			bucket.WriteString("CASE")
+			for i := offset; i < end; i++ {
+				fmt.Fprintf(&bucket, " WHEN event_id < ? THEN %d", i)
+				args = append(args, query.Boundaries[i+1])
+			}
+			bucket.WriteString(" END AS bucket, ")
+
+			var rows []eventCountRow
+			if err := r.db.Model(&Event{}).
+				Select(bucket.String()+eventCountColumns, args...).
+				Where("account_id = ? AND event_id >= ? AND event_id < ?", query.AccountID, query.Boundaries[offset], query.Boundaries[end]).
+				Group("bucket").
+				Order("bucket").
+				Scan(&rows).Error; err != nil {
+				return nil, fmt.Errorf("relational: error counting events of account in buckets: %w", err)
+			}
+			result = append(result, exportEventCounts(rows)...)
+		}
+		return result, nil
 	default:
 		return nil, persistence.ErrBadQuery
 	}
 }
 
+func exportEventCounts(rows []eventCountRow) []persistence.EventCount {
+	result := []persistence.EventCount{}
+	for _, row := range rows {
+		result = append(result, persistence.EventCount{
+			Bucket:         row.Bucket,
+			Events:         row.Events,
+			DistinctUsers:  row.DistinctUsers,
+			PayloadBytes:   row.PayloadBytes,
+			OldestEventID:  row.OldestEventID,
+			NewestEventID:  row.NewestEventID,
+			NewestSequence: row.NewestSequence,
+		})
+	}
+	return result
+}
+
+func (r *relationalDAL) UpdateEvents(q interface{}) (int64, error) {
+	switch query := q.(type) {
+	case persistence.UpdateEventsQueryReassignSecret:
+		var ids []string
+		for id := range query.EventIDs {
+			ids = append(ids, id)
+		}
+		var affected int64
+		for offset := 0; offset < len(ids); offset += eventIDUpdateChunkSize {
+			end := offset + eventIDUpdateChunkSize
+			if end > len(ids) {
+				end = len(ids)
+			}
+			chunk := ids[offset:end]
+			var cases strings.Builder
+			var args []interface{}
+			cases.WriteString("CASE event_id")
+			for _, id := range chunk {
+				cases.WriteString(" WHEN ? THEN ?")
+				args = append(args, id, query.EventIDs[id])
+			}
+			cases.WriteString(" END")
+			update := r.db.Model(&Event{}).
+				Where("secret_id = ? AND event_id IN (?)", query.SecretID, chunk).
+				Updates(map[string]interface{}{
+					"event_id":  gorm.Expr(cases.String(), args...),
+					"secret_id": query.NewSecretID,
+					"sequence":  query.Sequence,
+				})
+			if err := update.Error; err != nil {
+				return 0, fmt.Errorf("relational: error reassigning events: %w", err)
+			}
+			affected += update.RowsAffected
+		}
+		return affected, nil
+	default:
+		return 0, persistence.ErrBadQuery
+	}
+}
+
 func (r *relationalDAL) DeleteEvents(q interface{}) (int64, error) {
 	switch query := q.(type) {
 	case persistence.DeleteEventsQueryByEventIDs:
@@ -100,6 +367,12 @@ func (r *relationalDAL) DeleteEvents(q interface{}) (int64, error) {
 			return 0, fmt.Errorf("relational: error deleting events: %w", err)
 		}
 		return deletion.RowsAffected, nil
+	case persistence.DeleteEventsQueryByAccountIDOlderThan:
+		deletion := r.db.Where("account_id = ? AND event_id < ?", query.AccountID, query.EventID).Delete(&Event{})
+		if err := deletion.Error; err != nil {
+			return 0, fmt.Errorf("relational: error deleting events of account: %w", err)
+		}
+		return deletion.RowsAffected, nil
 	default:
 		return 0, persistence.ErrBadQuery
 	}
@@ -53,6 +53,39 @@ func TestRelationalDAL_CreateEvent(t *testing.T) {
 	}
 }
 
+func TestRelationalDAL_CreateEvents(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+
+	dal := NewRelationalDAL(db)
+	var events []*persistence.Event
+	for i := 0; i < eventInsertBatchSize+1; i++ {
+		events = append(events, &persistence.Event{
+			EventID:  fmt.Sprintf("event-%04d", i),
+			SecretID: strptr("secret-id"),
+			Payload:  "payload",
+		})
+	}
+	if err := dal.CreateEvents(events); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	var count int64
+	if err := db.Table("events").Count(&count).Error; err != nil {
+		t.Fatalf("Unexpected error counting events %v", err)
+	}
+	if count != eventInsertBatchSize+1 {
+		t.Errorf("Expected %d events, got %d", eventInsertBatchSize+1, count)
+	}
+
+	if err := dal.CreateEvents([]*persistence.Event{{EventID: "event-x"}, {EventID: "event-0000"}}); err == nil {
+		t.Error("Expected error when inserting existing event")
+	}
+	if err := db.Where("event_id = ?", "event-x").First(&Event{}).Error; err == nil {
+		t.Error("Expected no events to be created on error")
+	}
+}
+
 func TestRelationalDAL_FindEvents(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -88,6 +121,31 @@ func TestRelationalDAL_FindEvents(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"metadata by secret id",
+			func(db *gorm.DB) error {
+				for _, token := range []string{"c", "a", "b", "d"} {
+					secretID := "hashed-user-id-a"
+					if token == "d" {
+						secretID = "hashed-user-id-b"
+					}
+					if err := db.Save(&Event{
+						EventID:  fmt.Sprintf("event-%s", token),
+						Payload:  fmt.Sprintf("payload-%s", token),
+						SecretID: strptr(secretID),
+					}).Error; err != nil {
+						return fmt.Errorf("error saving fixture data: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.FindEventsQueryMetadataBySecretID{SecretID: "hashed-user-id-a", Limit: 2},
+			[]persistence.Event{
+				{EventID: "event-a", SecretID: strptr("hashed-user-id-a")},
+				{EventID: "event-b", SecretID: strptr("hashed-user-id-a")},
+			},
+			false,
+		},
 		{
 			"by secret id - all events",
 			func(db *gorm.DB) error {
@@ -110,6 +168,48 @@ func TestRelationalDAL_FindEvents(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"by account id older than",
+			func(db *gorm.DB) error {
+				for _, token := range []string{"a", "b", "c"} {
+					accountID := "account-a"
+					if token == "a" {
+						accountID = "account-b"
+					}
+					if err := db.Save(&Event{
+						EventID:   fmt.Sprintf("event-%s", token),
+						AccountID: accountID,
+					}).Error; err != nil {
+						return fmt.Errorf("error saving fixture data: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.FindEventsQueryByAccountIDOlderThan{AccountID: "account-a", EventID: "event-c"},
+			[]persistence.Event{
+				{EventID: "event-b", AccountID: "account-a"},
+			},
+			false,
+		},
+		{
+			"older than with limit",
+			func(db *gorm.DB) error {
+				for _, token := range []string{"c", "a", "d", "b"} {
+					if err := db.Save(&Event{
+						EventID: fmt.Sprintf("event-%s", token),
+					}).Error; err != nil {
+						return fmt.Errorf("error saving fixture data: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.FindEventsQueryOlderThanLimit{EventID: "event-d", Limit: 2},
+			[]persistence.Event{
+				{EventID: "event-a"},
+				{EventID: "event-b"},
+			},
+			false,
+		},
 		{
 			"by secret id - using since param",
 			func(db *gorm.DB) error {
@@ -158,6 +258,272 @@ func TestRelationalDAL_FindEvents(t *testing.T) {
 	}
 }
 
+func TestRelationalDAL_CountEvents(t *testing.T) {
+	var boundaries []string
+	for i := 0; i <= 450; i++ {
+		boundaries = append(boundaries, fmt.Sprintf("event-%03d", i))
+	}
+	tests := []struct {
+		name           string
+		setup          dbAccess
+		query          interface{}
+		expectedResult []persistence.EventCount
+		expectError    bool
+	}{
+		{
+			"bad query",
+			noop,
+			'z',
+			nil,
+			true,
+		},
+		{
+			"by account id",
+			func(db *gorm.DB) error {
+				for _, evt := range []Event{
+					{EventID: "event-a", AccountID: "account-a", Payload: "payload-a", SecretID: strptr("hashed-user-id-a")},
+					{EventID: "event-b", AccountID: "account-a", Payload: "payload-b", SecretID: strptr("hashed-user-id-a")},
+					{EventID: "event-c", AccountID: "account-a", Payload: "payload-c"},
+					{EventID: "event-d", AccountID: "account-b", Payload: "payload-d"},
+				} {
+					if err := db.Save(&evt).Error; err != nil {
+						return fmt.Errorf("error saving fixture data: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.CountEventsQueryByAccountID("account-a"),
+			[]persistence.EventCount{
+				{Events: 3, DistinctUsers: 1, PayloadBytes: 27, OldestEventID: "event-a", NewestEventID: "event-c"},
+			},
+			false,
+		},
+		{
+			"by account id since",
+			func(db *gorm.DB) error {
+				for _, evt := range []Event{
+					{EventID: "event-a", AccountID: "account-a", Payload: "payload-a"},
+					{EventID: "event-b", AccountID: "account-a", Payload: "payload-b", SecretID: strptr("hashed-user-id-a")},
+					{EventID: "event-c", AccountID: "account-b", Payload: "payload-c"},
+				} {
+					if err := db.Save(&evt).Error; err != nil {
+						return fmt.Errorf("error saving fixture data: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.CountEventsQueryByAccountIDSince{AccountID: "account-a", Since: "event-b"},
+			[]persistence.EventCount{
+				{Events: 1, DistinctUsers: 1, PayloadBytes: 9, OldestEventID: "event-b", NewestEventID: "event-b"},
+			},
+			false,
+		},
+		{
+			"by account id older than",
+			func(db *gorm.DB) error {
+				for _, evt := range []Event{
+					{EventID: "event-a", AccountID: "account-a", Payload: "payload-a", SecretID: strptr("hashed-user-id-a")},
+					{EventID: "event-b", AccountID: "account-a", Payload: "payload-b"},
+					{EventID: "event-0", AccountID: "account-b", Payload: "payload-c"},
+				} {
+					if err := db.Save(&evt).Error; err != nil {
+						return fmt.Errorf("error saving fixture data: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.CountEventsQueryByAccountIDOlderThan{AccountID: "account-a", EventID: "event-b"},
+			[]persistence.EventCount{
+				{Events: 1, DistinctUsers: 1, PayloadBytes: 9, OldestEventID: "event-a", NewestEventID: "event-a"},
+			},
+			false,
+		},
+		{
+			"by account id - no events",
+			noop,
+			persistence.CountEventsQueryByAccountID("account-a"),
+			[]persistence.EventCount{
+				{},
+			},
+			false,
+		},
+		{
+			"in buckets",
+			func(db *gorm.DB) error {
+				for _, evt := range []Event{
+					{EventID: "event-005", AccountID: "account-a", Payload: "payload", SecretID: strptr("hashed-user-id-a")},
+					{EventID: "event-250", AccountID: "account-a", Payload: "payload", SecretID: strptr("hashed-user-id-a")},
+					{EventID: "event-250x", AccountID: "account-a", Payload: "payload", SecretID: strptr("hashed-user-id-b")},
+					{EventID: "event-250y", AccountID: "account-b", Payload: "payload"},
+					{EventID: "event-450", AccountID: "account-a", Payload: "payload"},
+				} {
+					if err := db.Save(&evt).Error; err != nil {
+						return fmt.Errorf("error saving fixture data: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.CountEventsQueryByAccountIDInBuckets{AccountID: "account-a", Boundaries: boundaries},
+			[]persistence.EventCount{
+				{Bucket: 5, Events: 1, DistinctUsers: 1, PayloadBytes: 7, OldestEventID: "event-005", NewestEventID: "event-005"},
+				{Bucket: 250, Events: 2, DistinctUsers: 2, PayloadBytes: 14, OldestEventID: "event-250", NewestEventID: "event-250x"},
+			},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, closeDB := createTestDatabase()
+			defer closeDB()
+
+			dal := NewRelationalDAL(db)
+
+			if err := test.setup(db); err != nil {
+				t.Fatalf("Error setting up test: %v", err)
+			}
+
+			result, err := dal.CountEvents(test.query)
+
+			if !reflect.DeepEqual(test.expectedResult, result) {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+		})
+	}
+}
+
+func TestRelationalDAL_UpdateEvents(t *testing.T) {
+	tests := []struct {
+		name             string
+		setup            dbAccess
+		query            interface{}
+		expectedAffected int64
+		expectError      bool
+		assertion        dbAccess
+	}{
+		{
+			"bad arg",
+			noop,
+			[]string{"hey!"},
+			0,
+			true,
+			noop,
+		},
+		{
+			"reassign secret",
+			func(db *gorm.DB) error {
+				for _, token := range []string{"x", "y", "z"} {
+					secretID := "secret-a"
+					if token == "z" {
+						secretID = "secret-b"
+					}
+					if err := db.Save(&Event{
+						EventID:  fmt.Sprintf("event-%s", token),
+						Sequence: "sequence-a",
+						SecretID: strptr(secretID),
+						Payload:  fmt.Sprintf("payload-%s", token),
+					}).Error; err != nil {
+						return fmt.Errorf("error creating fixture record: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.UpdateEventsQueryReassignSecret{
+				SecretID:    "secret-a",
+				NewSecretID: "secret-c",
+				Sequence:    "sequence-b",
+				EventIDs: map[string]string{
+					"event-x": "event-u",
+					"event-y": "event-v",
+				},
+			},
+			2,
+			false,
+			func(db *gorm.DB) error {
+				var events []Event
+				if err := db.Order("event_id").Find(&events).Error; err != nil {
+					return fmt.Errorf("error looking up events: %v", err)
+				}
+				expected := []Event{
+					{EventID: "event-u", Sequence: "sequence-b", SecretID: strptr("secret-c"), Payload: "payload-x"},
+					{EventID: "event-v", Sequence: "sequence-b", SecretID: strptr("secret-c"), Payload: "payload-y"},
+					{EventID: "event-z", Sequence: "sequence-a", SecretID: strptr("secret-b"), Payload: "payload-z"},
+				}
+				if !reflect.DeepEqual(expected, events) {
+					return fmt.Errorf("unexpected events %v", events)
+				}
+				return nil
+			},
+		},
+		{
+			"more events than fit in a single statement",
+			func(db *gorm.DB) error {
+				for i := 0; i < eventIDUpdateChunkSize*2+1; i++ {
+					if err := db.Save(&Event{
+						EventID:  fmt.Sprintf("event-%04d", i),
+						SecretID: strptr("secret-a"),
+					}).Error; err != nil {
+						return fmt.Errorf("error creating fixture record: %v", err)
+					}
+				}
+				return nil
+			},
+			func() persistence.UpdateEventsQueryReassignSecret {
+				ids := map[string]string{}
+				for i := 0; i < eventIDUpdateChunkSize*2+1; i++ {
+					ids[fmt.Sprintf("event-%04d", i)] = fmt.Sprintf("moved-%04d", i)
+				}
+				return persistence.UpdateEventsQueryReassignSecret{
+					SecretID:    "secret-a",
+					NewSecretID: "secret-b",
+					Sequence:    "sequence-a",
+					EventIDs:    ids,
+				}
+			}(),
+			eventIDUpdateChunkSize*2 + 1,
+			false,
+			func(db *gorm.DB) error {
+				var count int64
+				if err := db.Table("events").Where("event_id LIKE ? AND secret_id = ?", "moved-%", "secret-b").Count(&count).Error; err != nil {
+					return fmt.Errorf("error counting event rows: %v", err)
+				}
+				if count != eventIDUpdateChunkSize*2+1 {
+					return fmt.Errorf("error counting event rows, got %d", count)
+				}
+				return nil
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, closeDB := createTestDatabase()
+			defer closeDB()
+
+			dal := NewRelationalDAL(db)
+
+			if err := test.setup(db); err != nil {
+				t.Fatalf("Unexpected error setting up test: %v", err)
+			}
+
+			affected, err := dal.UpdateEvents(test.query)
+			if test.expectedAffected != affected {
+				t.Errorf("Expected %d, got %d", test.expectedAffected, affected)
+			}
+
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+
+			if err := test.assertion(db); err != nil {
+				t.Errorf("Assertion error validating database content: %v", err)
+			}
+		})
+	}
+}
+
 func TestRelationalDAL_DeleteEvents(t *testing.T) {
 	tests := []struct {
 		name             string
@@ -228,6 +594,37 @@ func TestRelationalDAL_DeleteEvents(t *testing.T) {
 				return nil
 			},
 		},
+		{
+			"by account id older than",
+			func(db *gorm.DB) error {
+				for _, token := range []string{"x", "y", "z"} {
+					accountID := "account-a"
+					if token == "x" {
+						accountID = "account-b"
+					}
+					if err := db.Save(&Event{
+						EventID:   fmt.Sprintf("event-%s", token),
+						AccountID: accountID,
+					}).Error; err != nil {
+						return fmt.Errorf("error creating fixture record: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.DeleteEventsQueryByAccountIDOlderThan{AccountID: "account-a", EventID: "event-z"},
+			1,
+			false,
+			func(db *gorm.DB) error {
+				var count int64
+				if err := db.Table("events").Count(&count).Error; err != nil {
+					return fmt.Errorf("error counting event rows: %v", err)
+				}
+				if count != 2 {
+					return fmt.Errorf("error counting event rows, got %d", count)
+				}
+				return nil
+			},
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -255,3 +652,132 @@ func TestRelationalDAL_DeleteEvents(t *testing.T) {
 		})
 	}
 }
+
+func BenchmarkRelationalDAL_FindEvents(b *testing.B) {
+	for _, size := range []int{1000, 10000} {
+		b.Run(fmt.Sprintf("%d events", size), func(b *testing.B) {
+			db, closeDB := createTestDatabase()
+			defer closeDB()
+			secretIDs := seedBenchmarkDatabase(b, db, size, size/10)
+			dal := NewRelationalDAL(db)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				events, err := dal.FindEvents(persistence.FindEventsQueryForSecretIDs{SecretIDs: secretIDs[:10]})
+				if err != nil {
+					b.Fatalf("Unexpected error %v", err)
+				}
+				if len(events) != 100 {
+					b.Fatalf("Unexpected number of events %d", len(events))
+				}
+			}
+		})
+	}
+}
+
+func TestRelationalDAL_StreamEvents(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+	relational := NewRelationalDAL(db)
+
+	db.Create(&Secret{SecretID: "hashed-user-a", EncryptedSecret: "secret-a"})
+	var events []Event
+	for i := 0; i < eventsStreamPageSize+10; i++ {
+		accountID := "account-a"
+		if i%2 == 0 {
+			accountID = "account-b"
+		}
+		events = append(events, Event{
+			EventID:   fmt.Sprintf("event-%04d", i),
+			Sequence:  fmt.Sprintf("sequence-%04d", i),
+			AccountID: accountID,
+			SecretID:  strptr("hashed-user-a"),
+		})
+	}
+	events = append(events, Event{EventID: "event-z", Sequence: "sequence-z", AccountID: "account-a", SecretID: strptr("hashed-user-b")})
+	if err := db.CreateInBatches(&events, 100).Error; err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	t.Run("for secret ids", func(t *testing.T) {
+		var result []persistence.Event
+		var pages int
+		if err := relational.StreamEvents(persistence.StreamEventsQueryForSecretIDs{
+			SecretIDs: []string{"hashed-user-a"},
+			Since:     "sequence-0000",
+			Until:     "sequence-0500",
+		}, func(page []persistence.Event) error {
+			pages++
+			result = append(result, page...)
+			return nil
+		}); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(result) != 500 || pages != 1 {
+			t.Fatalf("Unexpected result of length %d in %d pages", len(result), pages)
+		}
+		for i, evt := range result {
+			if i > 0 && evt.AccountID < result[i-1].AccountID {
+				t.Fatalf("Expected events to be ordered by account, got %v after %v", evt, result[i-1])
+			}
+		}
+		if result[0].AccountID != "account-a" || result[len(result)-1].EventID != "event-0500" {
+			t.Errorf("Unexpected events %v and %v", result[0], result[len(result)-1])
+		}
+	})
+
+	t.Run("by account id", func(t *testing.T) {
+		var result []persistence.Event
+		var pages int
+		if err := relational.StreamEvents(persistence.StreamEventsQueryByAccountID{
+			AccountID: "account-b",
+		}, func(page []persistence.Event) error {
+			pages++
+			result = append(result, page...)
+			return nil
+		}); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(result) != (eventsStreamPageSize+10)/2 || pages != 1 {
+			t.Fatalf("Unexpected result of length %d in %d pages", len(result), pages)
+		}
+		if result[0].Secret.EncryptedSecret != "secret-a" {
+			t.Errorf("Expected secret to be populated, got %v", result[0].Secret)
+		}
+	})
+
+	t.Run("all pages", func(t *testing.T) {
+		var count, pages int
+		if err := relational.StreamEvents(persistence.StreamEventsQueryForSecretIDs{
+			SecretIDs: []string{"hashed-user-a", "hashed-user-b"},
+		}, func(page []persistence.Event) error {
+			pages++
+			count += len(page)
+			return nil
+		}); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if count != eventsStreamPageSize+11 || pages != 2 {
+			t.Errorf("Unexpected result of length %d in %d pages", count, pages)
+		}
+	})
+
+	t.Run("count", func(t *testing.T) {
+		counts, err := relational.CountEvents(persistence.CountEventsQueryForSecretIDs{
+			SecretIDs: []string{"hashed-user-a"},
+			Since:     "sequence-0100",
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(counts) != 1 || counts[0].Events != eventsStreamPageSize+9-100 || counts[0].NewestSequence != "sequence-0509" {
+			t.Errorf("Unexpected counts %v", counts)
+		}
+	})
+
+	t.Run("bad query", func(t *testing.T) {
+		if err := relational.StreamEvents("account-a", func([]persistence.Event) error { return nil }); err != persistence.ErrBadQuery {
+			t.Errorf("Expected bad query error, got %v", err)
+		}
+	})
+}
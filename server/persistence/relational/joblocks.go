@@ -0,0 +1,42 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+	"gorm.io/gorm"
+)
+
+func (r *relationalDAL) AcquireJobLock(l *persistence.JobLock, now time.Time) (bool, error) {
+	local := importJobLock(l)
+	// a lock can be taken over in case it has expired or is already held
+	// by the same holder
+	update := r.db.Model(&JobLock{}).
+		Where("name = ? AND (expires < ? OR holder = ?)", local.Name, now, local.Holder).
+		Updates(map[string]interface{}{"holder": local.Holder, "expires": local.Expires})
+	if err := update.Error; err != nil {
+		return false, fmt.Errorf("relational: error updating job lock: %w", err)
+	}
+	if update.RowsAffected != 0 {
+		return true, nil
+	}
+
+	createErr := r.db.Create(&local).Error
+	if createErr == nil {
+		return true, nil
+	}
+	// creating the lock fails in case another instance is holding it, which
+	// is not considered an error
+	if err := r.db.Where("name = ?", local.Name).First(&JobLock{}).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, fmt.Errorf("relational: error creating job lock: %w", createErr)
+		}
+		return false, fmt.Errorf("relational: error looking up job lock: %w", err)
+	}
+	return false, nil
+}
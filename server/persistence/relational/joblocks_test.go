@@ -0,0 +1,112 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+	"gorm.io/gorm"
+)
+
+func TestRelationalDAL_AcquireJobLock(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name             string
+		setup            dbAccess
+		arg              *persistence.JobLock
+		expectedAcquired bool
+		expectError      bool
+		assertion        dbAccess
+	}{
+		{
+			"new lock",
+			noop,
+			&persistence.JobLock{Name: "expire", Holder: "instance-a", Expires: now.Add(time.Hour)},
+			true,
+			false,
+			func(db *gorm.DB) error {
+				var lock JobLock
+				if err := db.Where("name = ?", "expire").First(&lock).Error; err != nil {
+					return fmt.Errorf("error looking up lock: %w", err)
+				}
+				if lock.Holder != "instance-a" {
+					return fmt.Errorf("unexpected holder %s", lock.Holder)
+				}
+				return nil
+			},
+		},
+		{
+			"held by other instance",
+			func(db *gorm.DB) error {
+				return db.Create(&JobLock{Name: "expire", Holder: "instance-b", Expires: now.Add(time.Minute)}).Error
+			},
+			&persistence.JobLock{Name: "expire", Holder: "instance-a", Expires: now.Add(time.Hour)},
+			false,
+			false,
+			func(db *gorm.DB) error {
+				var lock JobLock
+				if err := db.Where("name = ?", "expire").First(&lock).Error; err != nil {
+					return fmt.Errorf("error looking up lock: %w", err)
+				}
+				if lock.Holder != "instance-b" {
+					return fmt.Errorf("unexpected holder %s", lock.Holder)
+				}
+				return nil
+			},
+		},
+		{
+			"expired lock",
+			func(db *gorm.DB) error {
+				return db.Create(&JobLock{Name: "expire", Holder: "instance-b", Expires: now.Add(-time.Minute)}).Error
+			},
+			&persistence.JobLock{Name: "expire", Holder: "instance-a", Expires: now.Add(time.Hour)},
+			true,
+			false,
+			func(db *gorm.DB) error {
+				var lock JobLock
+				if err := db.Where("name = ?", "expire").First(&lock).Error; err != nil {
+					return fmt.Errorf("error looking up lock: %w", err)
+				}
+				if lock.Holder != "instance-a" {
+					return fmt.Errorf("unexpected holder %s", lock.Holder)
+				}
+				return nil
+			},
+		},
+		{
+			"held by same instance",
+			func(db *gorm.DB) error {
+				return db.Create(&JobLock{Name: "expire", Holder: "instance-a", Expires: now.Add(time.Minute)}).Error
+			},
+			&persistence.JobLock{Name: "expire", Holder: "instance-a", Expires: now.Add(time.Hour)},
+			true,
+			false,
+			noop,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, closeDB := createTestDatabase()
+			defer closeDB()
+			if err := test.setup(db); err != nil {
+				t.Fatalf("Unexpected error setting up test: %v", err)
+			}
+
+			dal := NewRelationalDAL(db)
+			acquired, err := dal.AcquireJobLock(test.arg, now)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if acquired != test.expectedAcquired {
+				t.Errorf("Expected %v, got %v", test.expectedAcquired, acquired)
+			}
+			if err := test.assertion(db); err != nil {
+				t.Errorf("Assertion error validating database content: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/offen/offen/server/persistence"
+	"gorm.io/gorm"
+)
+
+func (r *relationalDAL) FindMaintenanceState() (persistence.MaintenanceState, error) {
+	var state MaintenanceState
+	if err := r.db.Where("state_id = ?", maintenanceStateID).First(&state).Error; err != nil {
+		// instances that have never been put into maintenance mode are
+		// writable
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return persistence.MaintenanceState{}, nil
+		}
+		return persistence.MaintenanceState{}, fmt.Errorf("relational: error looking up maintenance state: %w", err)
+	}
+	return state.export(), nil
+}
+
+func (r *relationalDAL) UpdateMaintenanceState(s *persistence.MaintenanceState) error {
+	local := importMaintenanceState(s)
+	if err := r.db.Save(&local).Error; err != nil {
+		return fmt.Errorf("relational: error saving maintenance state: %w", err)
+	}
+	return nil
+}
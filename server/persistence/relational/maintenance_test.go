@@ -0,0 +1,47 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestRelationalDAL_MaintenanceState(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+	relational := NewRelationalDAL(db)
+
+	state, err := relational.FindMaintenanceState()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if state.ReadOnly {
+		t.Error("Expected initial state to be writable")
+	}
+
+	for _, readOnly := range []bool{true, false, true} {
+		if err := relational.UpdateMaintenanceState(&persistence.MaintenanceState{
+			ReadOnly: readOnly,
+			Updated:  time.Now().UTC(),
+		}); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	state, err = relational.FindMaintenanceState()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !state.ReadOnly {
+		t.Error("Expected state to be read-only")
+	}
+	var count int64
+	db.Model(&MaintenanceState{}).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected a single maintenance state, got %d", count)
+	}
+}
@@ -330,10 +330,494 @@ func (r *relationalDAL) ApplyMigrations() error {
 				return nil
 			},
 		},
+		{
+			ID: "007_add_relationship_roles",
+			Migrate: func(db *gorm.DB) error {
+				type AccountUserRelationship struct {
+					RelationshipID                    string `gorm:"primary_key;size:36;unique"`
+					AccountUserID                     string `gorm:"size:36"`
+					AccountID                         string `gorm:"size:36"`
+					Role                              int
+					PasswordEncryptedKeyEncryptionKey string `gorm:"type:text"`
+					EmailEncryptedKeyEncryptionKey    string `gorm:"type:text"`
+					OneTimeEncryptedKeyEncryptionKey  string `gorm:"type:text"`
+				}
+				if err := db.AutoMigrate(&AccountUserRelationship{}); err != nil {
+					return err
+				}
+				// existing relationships are assigned a role that grants the
+				// same privileges as before, i.e. only SuperAdmins are allowed
+				// to manage the accounts they have access to
+				if err := db.Model(&AccountUserRelationship{}).
+					Where("1 = 1").
+					UpdateColumn("role", int(persistence.AccountUserRoleViewer)).Error; err != nil {
+					return err
+				}
+				return db.Model(&AccountUserRelationship{}).
+					Where(
+						"account_user_id IN (?)",
+						db.Table("account_users").Select("account_user_id").Where("admin_level = ?", int(persistence.AccountUserAdminLevelSuperAdmin)),
+					).
+					UpdateColumn("role", int(persistence.AccountUserRoleAdmin)).Error
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn("account_user_relationships", "role")
+			},
+		},
+		{
+			ID: "008_add_hashed_one_time_key",
+			Migrate: func(db *gorm.DB) error {
+				type AccountUser struct {
+					AccountUserID    string `gorm:"primary_key;size:36;unique"`
+					HashedEmail      string
+					HashedPassword   string
+					Salt             string
+					AdminLevel       int
+					HashedOneTimeKey string
+				}
+				return db.AutoMigrate(&AccountUser{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn("account_users", "hashed_one_time_key")
+			},
+		},
+		{
+			ID: "009_add_totp",
+			Migrate: func(db *gorm.DB) error {
+				type AccountUser struct {
+					AccountUserID       string `gorm:"primary_key;size:36;unique"`
+					HashedEmail         string
+					HashedPassword      string
+					Salt                string
+					AdminLevel          int
+					HashedOneTimeKey    string
+					TOTPSecret          string
+					HashedRecoveryCodes string `gorm:"type:text"`
+				}
+				return db.AutoMigrate(&AccountUser{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				if err := db.Migrator().DropColumn("account_users", "totp_secret"); err != nil {
+					return err
+				}
+				return db.Migrator().DropColumn("account_users", "hashed_recovery_codes")
+			},
+		},
+		{
+			ID: "010_add_webauthn_credentials",
+			Migrate: func(db *gorm.DB) error {
+				type WebAuthnCredential struct {
+					CredentialID  string `gorm:"primary_key;size:255;unique"`
+					AccountUserID string `gorm:"size:36;index"`
+					PublicKey     string `gorm:"type:text"`
+					SignCount     int64
+					WrappedKeys   string `gorm:"type:text"`
+					Created       time.Time
+				}
+				return db.AutoMigrate(&WebAuthnCredential{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropTable("web_authn_credentials")
+			},
+		},
+		{
+			ID: "011_add_sessions",
+			Migrate: func(db *gorm.DB) error {
+				type Session struct {
+					SessionID     string `gorm:"primary_key;size:36;unique"`
+					AccountUserID string `gorm:"size:36;index"`
+					UserAgent     string
+					Created       time.Time
+					LastSeen      time.Time
+					Expires       time.Time `gorm:"index"`
+				}
+				return db.AutoMigrate(&Session{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropTable("sessions")
+			},
+		},
+		{
+			ID: "012_add_api_tokens",
+			Migrate: func(db *gorm.DB) error {
+				type APIToken struct {
+					TokenID       string `gorm:"primary_key;size:36;unique"`
+					AccountUserID string `gorm:"size:36;index"`
+					Name          string
+					HashedSecret  string
+					AccountIDs    string `gorm:"type:text"`
+					Scopes        string
+					Created       time.Time
+					LastUsed      time.Time
+				}
+				return db.AutoMigrate(&APIToken{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropTable("api_tokens")
+			},
+		},
+		{
+			ID: "013_add_account_retention",
+			Migrate: func(db *gorm.DB) error {
+				type Account struct {
+					AccountID           string `gorm:"primary_key;size:36;unique"`
+					Name                string
+					PublicKey           string `gorm:"type:text"`
+					EncryptedPrivateKey string `gorm:"type:text"`
+					UserSalt            string
+					Retired             bool
+					Created             time.Time
+					Retention           time.Duration
+				}
+				return db.AutoMigrate(&Account{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn("accounts", "retention")
+			},
+		},
+		{
+			ID: "014_add_job_locks",
+			Migrate: func(db *gorm.DB) error {
+				type JobLock struct {
+					Name    string `gorm:"primary_key;size:64;unique"`
+					Holder  string `gorm:"size:36"`
+					Expires time.Time
+				}
+				return db.AutoMigrate(&JobLock{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropTable("job_locks")
+			},
+		},
+		{
+			ID: "015_add_sync_states",
+			Migrate: func(db *gorm.DB) error {
+				type SyncState struct {
+					PrimaryURL string `gorm:"primary_key;size:255;unique"`
+					Watermark  string `gorm:"size:26"`
+					Updated    time.Time
+				}
+				return db.AutoMigrate(&SyncState{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropTable("sync_states")
+			},
+		},
+		{
+			ID: "016_add_deprecated_account_keys",
+			Migrate: func(db *gorm.DB) error {
+				type DeprecatedAccountKey struct {
+					KeyID               string `gorm:"primary_key;size:36;unique"`
+					AccountID           string `gorm:"size:36"`
+					PublicKey           string `gorm:"type:text"`
+					EncryptedPrivateKey string `gorm:"type:text"`
+					Deprecated          time.Time
+				}
+				return db.AutoMigrate(&DeprecatedAccountKey{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropTable("deprecated_account_keys")
+			},
+		},
+		{
+			ID: "017_add_previous_user_salt",
+			Migrate: func(db *gorm.DB) error {
+				type Account struct {
+					AccountID           string `gorm:"primary_key;size:36;unique"`
+					Name                string
+					PublicKey           string `gorm:"type:text"`
+					EncryptedPrivateKey string `gorm:"type:text"`
+					UserSalt            string
+					PreviousUserSalt    string
+					Retired             bool
+					Created             time.Time
+					Retention           time.Duration
+				}
+				return db.AutoMigrate(&Account{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn("accounts", "previous_user_salt")
+			},
+		},
+		{
+			ID: "018_add_key_algorithms",
+			Migrate: func(db *gorm.DB) error {
+				type Account struct {
+					AccountID           string `gorm:"primary_key;size:36;unique"`
+					Name                string
+					PublicKey           string `gorm:"type:text"`
+					EncryptedPrivateKey string `gorm:"type:text"`
+					KeyAlgorithm        string `gorm:"size:16"`
+					UserSalt            string
+					PreviousUserSalt    string
+					Retired             bool
+					Created             time.Time
+					Retention           time.Duration
+				}
+				type DeprecatedAccountKey struct {
+					KeyID               string `gorm:"primary_key;size:36;unique"`
+					AccountID           string `gorm:"size:36"`
+					PublicKey           string `gorm:"type:text"`
+					EncryptedPrivateKey string `gorm:"type:text"`
+					KeyAlgorithm        string `gorm:"size:16"`
+					Deprecated          time.Time
+				}
+				return db.AutoMigrate(&Account{}, &DeprecatedAccountKey{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				if err := db.Migrator().DropColumn("deprecated_account_keys", "key_algorithm"); err != nil {
+					return err
+				}
+				return db.Migrator().DropColumn("accounts", "key_algorithm")
+			},
+		},
+		{
+			ID: "019_add_event_indexes",
+			Migrate: func(db *gorm.DB) error {
+				type Event struct {
+					EventID   string  `gorm:"primaryKey;size:26;unique;index:idx_events_account_id_event_id,priority:2"`
+					Sequence  string  `gorm:"size:26;index"`
+					AccountID string  `gorm:"size:36;index:idx_events_account_id_event_id,priority:1"`
+					SecretID  *string `gorm:"size:64;index"`
+					Payload   string  `gorm:"type:text"`
+				}
+				for _, index := range []string{"idx_events_account_id_event_id", "Sequence", "SecretID"} {
+					if err := db.Migrator().CreateIndex(&Event{}, index); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(db *gorm.DB) error {
+				type Event struct {
+					EventID   string  `gorm:"primaryKey;size:26;unique;index:idx_events_account_id_event_id,priority:2"`
+					Sequence  string  `gorm:"size:26;index"`
+					AccountID string  `gorm:"size:36;index:idx_events_account_id_event_id,priority:1"`
+					SecretID  *string `gorm:"size:64;index"`
+					Payload   string  `gorm:"type:text"`
+				}
+				for _, index := range []string{"idx_events_account_id_event_id", "Sequence", "SecretID"} {
+					if err := db.Migrator().DropIndex(&Event{}, index); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "020_add_account_domains",
+			Migrate: func(db *gorm.DB) error {
+				type Account struct {
+					AccountID           string `gorm:"primary_key;size:36;unique"`
+					Name                string
+					PublicKey           string `gorm:"type:text"`
+					EncryptedPrivateKey string `gorm:"type:text"`
+					KeyAlgorithm        string `gorm:"size:16"`
+					UserSalt            string
+					PreviousUserSalt    string
+					Retired             bool
+					Created             time.Time
+					Retention           time.Duration
+					Domains             string `gorm:"type:text"`
+				}
+				return db.AutoMigrate(&Account{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn("accounts", "domains")
+			},
+		},
+		{
+			ID: "021_add_account_banner",
+			Migrate: func(db *gorm.DB) error {
+				type Account struct {
+					AccountID           string `gorm:"primary_key;size:36;unique"`
+					Name                string
+					PublicKey           string `gorm:"type:text"`
+					EncryptedPrivateKey string `gorm:"type:text"`
+					KeyAlgorithm        string `gorm:"size:16"`
+					UserSalt            string
+					PreviousUserSalt    string
+					Retired             bool
+					Created             time.Time
+					Retention           time.Duration
+					Domains             string `gorm:"type:text"`
+					Banner              string `gorm:"type:text"`
+				}
+				return db.AutoMigrate(&Account{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn("accounts", "banner")
+			},
+		},
+		{
+			ID: "022_add_account_encrypted_settings",
+			Migrate: func(db *gorm.DB) error {
+				type Account struct {
+					AccountID           string `gorm:"primary_key;size:36;unique"`
+					Name                string
+					PublicKey           string `gorm:"type:text"`
+					EncryptedPrivateKey string `gorm:"type:text"`
+					KeyAlgorithm        string `gorm:"size:16"`
+					UserSalt            string
+					PreviousUserSalt    string
+					Retired             bool
+					Created             time.Time
+					Retention           time.Duration
+					Domains             string `gorm:"type:text"`
+					Banner              string `gorm:"type:text"`
+					EncryptedSettings   string `gorm:"type:text"`
+				}
+				return db.AutoMigrate(&Account{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn("accounts", "encrypted_settings")
+			},
+		},
+		{
+			ID: "023_add_account_lifecycle_timestamps",
+			Migrate: func(db *gorm.DB) error {
+				type Account struct {
+					AccountID           string `gorm:"primary_key;size:36;unique"`
+					Name                string
+					PublicKey           string `gorm:"type:text"`
+					EncryptedPrivateKey string `gorm:"type:text"`
+					KeyAlgorithm        string `gorm:"size:16"`
+					UserSalt            string
+					PreviousUserSalt    string
+					Retired             bool
+					Created             time.Time
+					RetiredAt           *time.Time
+					LastEventAt         *time.Time
+					Retention           time.Duration
+					Domains             string `gorm:"type:text"`
+					Banner              string `gorm:"type:text"`
+					EncryptedSettings   string `gorm:"type:text"`
+				}
+				return db.AutoMigrate(&Account{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				for _, column := range []string{"retired_at", "last_event_at"} {
+					if err := db.Migrator().DropColumn("accounts", column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "024_add_audit_entries",
+			Migrate: func(db *gorm.DB) error {
+				type AuditEntry struct {
+					EntryID   string `gorm:"primary_key;size:26;unique"`
+					Action    string `gorm:"size:64;index"`
+					ActorID   string `gorm:"size:36;index"`
+					AccountID string `gorm:"size:36;index"`
+					RequestID string `gorm:"size:128"`
+					Created   time.Time
+				}
+				return db.AutoMigrate(&AuditEntry{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropTable("audit_entries")
+			},
+		},
+		{
+			ID: "025_add_purge_jobs",
+			Migrate: func(db *gorm.DB) error {
+				type PurgeJob struct {
+					PurgeID string `gorm:"primary_key;size:36;unique"`
+					Status  string `gorm:"size:16"`
+					Created time.Time
+					Updated time.Time
+				}
+				return db.AutoMigrate(&PurgeJob{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropTable("purge_jobs")
+			},
+		},
+		{
+			ID: "026_add_totp_last_step",
+			Migrate: func(db *gorm.DB) error {
+				type AccountUser struct {
+					AccountUserID       string `gorm:"primary_key;size:36;unique"`
+					HashedEmail         string
+					HashedPassword      string
+					Salt                string
+					AdminLevel          int
+					HashedOneTimeKey    string
+					TOTPSecret          string
+					TOTPLastStep        int64
+					HashedRecoveryCodes string `gorm:"type:text"`
+				}
+				return db.AutoMigrate(&AccountUser{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn("account_users", "totp_last_step")
+			},
+		},
+		{
+			ID: "027_add_secret_created",
+			Migrate: func(db *gorm.DB) error {
+				type Secret struct {
+					SecretID        string `gorm:"primary_key;size:64;unique"`
+					EncryptedSecret string `gorm:"type:text"`
+					Created         time.Time
+				}
+				return db.AutoMigrate(&Secret{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn("secrets", "created")
+			},
+		},
+		{
+			ID: "028_add_maintenance_states",
+			Migrate: func(db *gorm.DB) error {
+				type MaintenanceState struct {
+					StateID  string `gorm:"primary_key;size:16;unique"`
+					ReadOnly bool
+					Updated  time.Time
+				}
+				return db.AutoMigrate(&MaintenanceState{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropTable("maintenance_states")
+			},
+		},
+		{
+			ID: "029_add_account_event_quota",
+			Migrate: func(db *gorm.DB) error {
+				type Account struct {
+					AccountID           string `gorm:"primary_key;size:36;unique"`
+					Name                string
+					PublicKey           string `gorm:"type:text"`
+					EncryptedPrivateKey string `gorm:"type:text"`
+					KeyAlgorithm        string `gorm:"size:16"`
+					UserSalt            string
+					PreviousUserSalt    string
+					Retired             bool
+					Created             time.Time
+					RetiredAt           *time.Time
+					LastEventAt         *time.Time
+					Retention           time.Duration
+					EventQuota          int
+					Domains             string `gorm:"type:text"`
+					Banner              string `gorm:"type:text"`
+					EncryptedSettings   string `gorm:"type:text"`
+				}
+				return db.AutoMigrate(&Account{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn("accounts", "event_quota")
+			},
+		},
 	})
 
 	m.InitSchema(func(db *gorm.DB) error {
-		return db.AutoMigrate(knownTables...)
+		// job locks, sync states, purge jobs and maintenance states are not
+		// part of knownTables as their content does not indicate whether an
+		// instance has been set up
+		return db.AutoMigrate(append(knownTables, &JobLock{}, &SyncState{}, &PurgeJob{}, &MaintenanceState{})...)
 	})
 
 	return m.Migrate()
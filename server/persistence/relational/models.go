@@ -4,6 +4,7 @@
 package relational
 
 import (
+	"strings"
 	"time"
 
 	"github.com/offen/offen/server/persistence"
@@ -12,13 +13,13 @@ import (
 // Event is any analytics event that will be stored in the database. It is
 // uniquely tied to an Account and a Secret model.
 type Event struct {
-	EventID   string `gorm:"primary_key;size:26;unique"`
-	Sequence  string `gorm:"size:26"`
-	AccountID string `gorm:"size:36"`
+	EventID   string `gorm:"primary_key;size:26;unique;index:idx_events_account_id_event_id,priority:2"`
+	Sequence  string `gorm:"size:26;index"`
+	AccountID string `gorm:"size:36;index:idx_events_account_id_event_id,priority:1"`
 	// the secret id is nullable for anonymous events
-	SecretID *string `gorm:"size:64"`
+	SecretID *string `gorm:"size:64;index"`
 	Payload  string  `gorm:"type:text"`
-	Secret   Secret  `gorm:"foreignkey:SecretID;association_foreignkey:SecretID"`
+	Secret   Secret  `gorm:"foreignKey:SecretID;references:SecretID"`
 }
 
 // A Tombstone replaces an event on its deletion
@@ -35,6 +36,7 @@ type Tombstone struct {
 type Secret struct {
 	SecretID        string `gorm:"primary_key;size:64;unique"`
 	EncryptedSecret string `gorm:"type:text"`
+	Created         time.Time
 }
 
 // Account stores information about an account.
@@ -43,21 +45,46 @@ type Account struct {
 	Name                string
 	PublicKey           string `gorm:"type:text"`
 	EncryptedPrivateKey string `gorm:"type:text"`
+	KeyAlgorithm        string `gorm:"size:16"`
 	UserSalt            string
+	PreviousUserSalt    string
 	Retired             bool
 	Created             time.Time
-	Events              []Event `gorm:"foreignkey:AccountID;association_foreignkey:AccountID"`
+	RetiredAt           *time.Time
+	LastEventAt         *time.Time
+	Retention           time.Duration
+	EventQuota          int
+	Domains             string                 `gorm:"type:text"`
+	Banner              string                 `gorm:"type:text"`
+	EncryptedSettings   string                 `gorm:"type:text"`
+	Events              []Event                `gorm:"foreignKey:AccountID;references:AccountID"`
+	DeprecatedKeys      []DeprecatedAccountKey `gorm:"foreignKey:AccountID;references:AccountID"`
+}
+
+// DeprecatedAccountKey is a key pair of an account that has been replaced
+// when rotating the account's keys.
+type DeprecatedAccountKey struct {
+	KeyID               string `gorm:"primary_key;size:36;unique"`
+	AccountID           string `gorm:"size:36"`
+	PublicKey           string `gorm:"type:text"`
+	EncryptedPrivateKey string `gorm:"type:text"`
+	KeyAlgorithm        string `gorm:"size:16"`
+	Deprecated          time.Time
 }
 
 // AccountUser is a person that can log in and access data related to all
 // associated accounts.
 type AccountUser struct {
-	AccountUserID  string `gorm:"primary_key;size:36;unique"`
-	HashedEmail    string
-	HashedPassword string
-	Salt           string
-	AdminLevel     int
-	Relationships  []AccountUserRelationship `gorm:"foreignkey:AccountUserID;association_foreignkey:AccountUserID"`
+	AccountUserID       string `gorm:"primary_key;size:36;unique"`
+	HashedEmail         string
+	HashedPassword      string
+	Salt                string
+	AdminLevel          int
+	HashedOneTimeKey    string
+	TOTPSecret          string
+	TOTPLastStep        int64
+	HashedRecoveryCodes string                    `gorm:"type:text"`
+	Relationships       []AccountUserRelationship `gorm:"foreignKey:AccountUserID;references:AccountUserID"`
 }
 
 // AccountUserRelationship contains the encrypted KeyEncryptionKeys needed for
@@ -66,6 +93,7 @@ type AccountUserRelationship struct {
 	RelationshipID                    string `gorm:"primary_key;size:36;unique"`
 	AccountUserID                     string `gorm:"size:36"`
 	AccountID                         string `gorm:"size:36"`
+	Role                              int
 	PasswordEncryptedKeyEncryptionKey string `gorm:"type:text"`
 	EmailEncryptedKeyEncryptionKey    string `gorm:"type:text"`
 	OneTimeEncryptedKeyEncryptionKey  string `gorm:"type:text"`
@@ -115,6 +143,7 @@ func (s *Secret) export() persistence.Secret {
 	return persistence.Secret{
 		SecretID:        s.SecretID,
 		EncryptedSecret: s.EncryptedSecret,
+		Created:         s.Created,
 	}
 }
 
@@ -122,6 +151,7 @@ func importSecret(s *persistence.Secret) Secret {
 	return Secret{
 		SecretID:        s.SecretID,
 		EncryptedSecret: s.EncryptedSecret,
+		Created:         s.Created,
 	}
 }
 
@@ -131,12 +161,16 @@ func (a *AccountUser) export() persistence.AccountUser {
 		relationships = append(relationships, r.export())
 	}
 	return persistence.AccountUser{
-		AccountUserID:  a.AccountUserID,
-		HashedEmail:    a.HashedEmail,
-		HashedPassword: a.HashedPassword,
-		Salt:           a.Salt,
-		AdminLevel:     persistence.AccountUserAdminLevel(a.AdminLevel),
-		Relationships:  relationships,
+		AccountUserID:       a.AccountUserID,
+		HashedEmail:         a.HashedEmail,
+		HashedPassword:      a.HashedPassword,
+		Salt:                a.Salt,
+		AdminLevel:          persistence.AccountUserAdminLevel(a.AdminLevel),
+		HashedOneTimeKey:    a.HashedOneTimeKey,
+		TOTPSecret:          a.TOTPSecret,
+		TOTPLastStep:        a.TOTPLastStep,
+		HashedRecoveryCodes: a.HashedRecoveryCodes,
+		Relationships:       relationships,
 	}
 }
 
@@ -146,12 +180,16 @@ func importAccountUser(a *persistence.AccountUser) AccountUser {
 		relationships = append(relationships, importAccountUserRelationship(&r))
 	}
 	return AccountUser{
-		AccountUserID:  a.AccountUserID,
-		HashedEmail:    a.HashedEmail,
-		HashedPassword: a.HashedPassword,
-		Salt:           a.Salt,
-		AdminLevel:     int(a.AdminLevel),
-		Relationships:  relationships,
+		AccountUserID:       a.AccountUserID,
+		HashedEmail:         a.HashedEmail,
+		HashedPassword:      a.HashedPassword,
+		Salt:                a.Salt,
+		AdminLevel:          int(a.AdminLevel),
+		HashedOneTimeKey:    a.HashedOneTimeKey,
+		TOTPSecret:          a.TOTPSecret,
+		TOTPLastStep:        a.TOTPLastStep,
+		HashedRecoveryCodes: a.HashedRecoveryCodes,
+		Relationships:       relationships,
 	}
 }
 
@@ -160,6 +198,7 @@ func (a *AccountUserRelationship) export() persistence.AccountUserRelationship {
 		RelationshipID:                    a.RelationshipID,
 		AccountUserID:                     a.AccountUserID,
 		AccountID:                         a.AccountID,
+		Role:                              persistence.AccountUserRole(a.Role),
 		PasswordEncryptedKeyEncryptionKey: a.PasswordEncryptedKeyEncryptionKey,
 		EmailEncryptedKeyEncryptionKey:    a.EmailEncryptedKeyEncryptionKey,
 		OneTimeEncryptedKeyEncryptionKey:  a.OneTimeEncryptedKeyEncryptionKey,
@@ -171,6 +210,7 @@ func importAccountUserRelationship(a *persistence.AccountUserRelationship) Accou
 		RelationshipID:                    a.RelationshipID,
 		AccountUserID:                     a.AccountUserID,
 		AccountID:                         a.AccountID,
+		Role:                              int(a.Role),
 		PasswordEncryptedKeyEncryptionKey: a.PasswordEncryptedKeyEncryptionKey,
 		EmailEncryptedKeyEncryptionKey:    a.EmailEncryptedKeyEncryptionKey,
 		OneTimeEncryptedKeyEncryptionKey:  a.OneTimeEncryptedKeyEncryptionKey,
@@ -182,15 +222,29 @@ func (a *Account) export() persistence.Account {
 	for _, e := range a.Events {
 		events = append(events, e.export())
 	}
+	var deprecatedKeys []persistence.DeprecatedAccountKey
+	for _, k := range a.DeprecatedKeys {
+		deprecatedKeys = append(deprecatedKeys, k.export())
+	}
 	return persistence.Account{
 		AccountID:           a.AccountID,
 		Name:                a.Name,
 		PublicKey:           a.PublicKey,
 		EncryptedPrivateKey: a.EncryptedPrivateKey,
+		KeyAlgorithm:        a.KeyAlgorithm,
 		UserSalt:            a.UserSalt,
+		PreviousUserSalt:    a.PreviousUserSalt,
 		Retired:             a.Retired,
 		Created:             a.Created,
+		RetiredAt:           a.RetiredAt,
+		LastEventAt:         a.LastEventAt,
+		Retention:           a.Retention,
+		EventQuota:          a.EventQuota,
+		Domains:             a.Domains,
+		Banner:              a.Banner,
+		EncryptedSettings:   a.EncryptedSettings,
 		Events:              events,
+		DeprecatedKeys:      deprecatedKeys,
 	}
 }
 
@@ -199,14 +253,302 @@ func importAccount(a *persistence.Account) Account {
 	for _, e := range a.Events {
 		events = append(events, importEvent(&e))
 	}
+	deprecatedKeys := []DeprecatedAccountKey{}
+	for _, k := range a.DeprecatedKeys {
+		deprecatedKeys = append(deprecatedKeys, importDeprecatedAccountKey(&k))
+	}
 	return Account{
 		AccountID:           a.AccountID,
 		Name:                a.Name,
 		PublicKey:           a.PublicKey,
 		EncryptedPrivateKey: a.EncryptedPrivateKey,
+		KeyAlgorithm:        a.KeyAlgorithm,
 		UserSalt:            a.UserSalt,
+		PreviousUserSalt:    a.PreviousUserSalt,
 		Retired:             a.Retired,
 		Created:             a.Created,
+		RetiredAt:           a.RetiredAt,
+		LastEventAt:         a.LastEventAt,
+		Retention:           a.Retention,
+		EventQuota:          a.EventQuota,
+		Domains:             a.Domains,
+		Banner:              a.Banner,
+		EncryptedSettings:   a.EncryptedSettings,
 		Events:              events,
+		DeprecatedKeys:      deprecatedKeys,
+	}
+}
+
+func (k *DeprecatedAccountKey) export() persistence.DeprecatedAccountKey {
+	return persistence.DeprecatedAccountKey{
+		KeyID:               k.KeyID,
+		AccountID:           k.AccountID,
+		PublicKey:           k.PublicKey,
+		EncryptedPrivateKey: k.EncryptedPrivateKey,
+		KeyAlgorithm:        k.KeyAlgorithm,
+		Deprecated:          k.Deprecated,
+	}
+}
+
+func importDeprecatedAccountKey(k *persistence.DeprecatedAccountKey) DeprecatedAccountKey {
+	return DeprecatedAccountKey{
+		KeyID:               k.KeyID,
+		AccountID:           k.AccountID,
+		PublicKey:           k.PublicKey,
+		EncryptedPrivateKey: k.EncryptedPrivateKey,
+		KeyAlgorithm:        k.KeyAlgorithm,
+		Deprecated:          k.Deprecated,
+	}
+}
+
+// WebAuthnCredential is a public key credential an account user can use for
+// logging in.
+type WebAuthnCredential struct {
+	CredentialID  string `gorm:"primary_key;size:255;unique"`
+	AccountUserID string `gorm:"size:36;index"`
+	PublicKey     string `gorm:"type:text"`
+	SignCount     int64
+	WrappedKeys   string `gorm:"type:text"`
+	Created       time.Time
+}
+
+func (w *WebAuthnCredential) export() persistence.WebAuthnCredential {
+	return persistence.WebAuthnCredential{
+		CredentialID:  w.CredentialID,
+		AccountUserID: w.AccountUserID,
+		PublicKey:     w.PublicKey,
+		SignCount:     w.SignCount,
+		WrappedKeys:   w.WrappedKeys,
+		Created:       w.Created,
+	}
+}
+
+func importWebAuthnCredential(w *persistence.WebAuthnCredential) WebAuthnCredential {
+	return WebAuthnCredential{
+		CredentialID:  w.CredentialID,
+		AccountUserID: w.AccountUserID,
+		PublicKey:     w.PublicKey,
+		SignCount:     w.SignCount,
+		WrappedKeys:   w.WrappedKeys,
+		Created:       w.Created,
+	}
+}
+
+// Session is a login of an account user.
+type Session struct {
+	SessionID     string `gorm:"primary_key;size:36;unique"`
+	AccountUserID string `gorm:"size:36;index"`
+	UserAgent     string
+	Created       time.Time
+	LastSeen      time.Time
+	Expires       time.Time `gorm:"index"`
+}
+
+func (s *Session) export() persistence.Session {
+	return persistence.Session{
+		SessionID:     s.SessionID,
+		AccountUserID: s.AccountUserID,
+		UserAgent:     s.UserAgent,
+		Created:       s.Created,
+		LastSeen:      s.LastSeen,
+		Expires:       s.Expires,
+	}
+}
+
+func importSession(s *persistence.Session) Session {
+	return Session{
+		SessionID:     s.SessionID,
+		AccountUserID: s.AccountUserID,
+		UserAgent:     s.UserAgent,
+		Created:       s.Created,
+		LastSeen:      s.LastSeen,
+		Expires:       s.Expires,
+	}
+}
+
+// AuditEntry records a privileged action that has been performed by an
+// account user.
+type AuditEntry struct {
+	EntryID   string `gorm:"primary_key;size:26;unique"`
+	Action    string `gorm:"size:64;index"`
+	ActorID   string `gorm:"size:36;index"`
+	AccountID string `gorm:"size:36;index"`
+	RequestID string `gorm:"size:128"`
+	Created   time.Time
+}
+
+func (a *AuditEntry) export() persistence.AuditEntry {
+	return persistence.AuditEntry{
+		EntryID:   a.EntryID,
+		Action:    a.Action,
+		ActorID:   a.ActorID,
+		AccountID: a.AccountID,
+		RequestID: a.RequestID,
+		Created:   a.Created,
+	}
+}
+
+func importAuditEntry(a *persistence.AuditEntry) AuditEntry {
+	return AuditEntry{
+		EntryID:   a.EntryID,
+		Action:    a.Action,
+		ActorID:   a.ActorID,
+		AccountID: a.AccountID,
+		RequestID: a.RequestID,
+		Created:   a.Created,
+	}
+}
+
+// APIToken grants programmatic access to a set of accounts. Account ids and
+// scopes are stored as comma separated lists.
+type APIToken struct {
+	TokenID       string `gorm:"primary_key;size:36;unique"`
+	AccountUserID string `gorm:"size:36;index"`
+	Name          string
+	HashedSecret  string
+	AccountIDs    string `gorm:"type:text"`
+	Scopes        string
+	Created       time.Time
+	LastUsed      time.Time
+}
+
+func (a *APIToken) export() persistence.APIToken {
+	var scopes []persistence.APITokenScope
+	for _, scope := range splitList(a.Scopes) {
+		scopes = append(scopes, persistence.APITokenScope(scope))
+	}
+	return persistence.APIToken{
+		TokenID:       a.TokenID,
+		AccountUserID: a.AccountUserID,
+		Name:          a.Name,
+		HashedSecret:  a.HashedSecret,
+		AccountIDs:    splitList(a.AccountIDs),
+		Scopes:        scopes,
+		Created:       a.Created,
+		LastUsed:      a.LastUsed,
+	}
+}
+
+func importAPIToken(a *persistence.APIToken) APIToken {
+	var scopes []string
+	for _, scope := range a.Scopes {
+		scopes = append(scopes, string(scope))
+	}
+	return APIToken{
+		TokenID:       a.TokenID,
+		AccountUserID: a.AccountUserID,
+		Name:          a.Name,
+		HashedSecret:  a.HashedSecret,
+		AccountIDs:    strings.Join(a.AccountIDs, ","),
+		Scopes:        strings.Join(scopes, ","),
+		Created:       a.Created,
+		LastUsed:      a.LastUsed,
+	}
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// JobLock is held by the server instance that is currently in charge of
+// running a background job.
+type JobLock struct {
+	Name    string `gorm:"primary_key;size:64;unique"`
+	Holder  string `gorm:"size:36"`
+	Expires time.Time
+}
+
+func (j *JobLock) export() persistence.JobLock {
+	return persistence.JobLock{
+		Name:    j.Name,
+		Holder:  j.Holder,
+		Expires: j.Expires,
+	}
+}
+
+func importJobLock(j *persistence.JobLock) JobLock {
+	return JobLock{
+		Name:    j.Name,
+		Holder:  j.Holder,
+		Expires: j.Expires,
+	}
+}
+
+// SyncState records up to which watermark a replica has pulled changes from
+// its primary instance.
+type SyncState struct {
+	PrimaryURL string `gorm:"primary_key;size:255;unique"`
+	Watermark  string `gorm:"size:26"`
+	Updated    time.Time
+}
+
+func (s *SyncState) export() persistence.SyncState {
+	return persistence.SyncState{
+		PrimaryURL: s.PrimaryURL,
+		Watermark:  s.Watermark,
+		Updated:    s.Updated,
+	}
+}
+
+func importSyncState(s *persistence.SyncState) SyncState {
+	return SyncState{
+		PrimaryURL: s.PrimaryURL,
+		Watermark:  s.Watermark,
+		Updated:    s.Updated,
+	}
+}
+
+// maintenanceStateID is the key of the single maintenance state row.
+const maintenanceStateID = "default"
+
+// MaintenanceState records whether the instance has been put into read-only
+// mode for maintenance.
+type MaintenanceState struct {
+	StateID  string `gorm:"primary_key;size:16;unique"`
+	ReadOnly bool
+	Updated  time.Time
+}
+
+func (m *MaintenanceState) export() persistence.MaintenanceState {
+	return persistence.MaintenanceState{
+		ReadOnly: m.ReadOnly,
+		Updated:  m.Updated,
+	}
+}
+
+func importMaintenanceState(m *persistence.MaintenanceState) MaintenanceState {
+	return MaintenanceState{
+		StateID:  maintenanceStateID,
+		ReadOnly: m.ReadOnly,
+		Updated:  m.Updated,
+	}
+}
+
+// PurgeJob records the status of a purge that is running in the background.
+type PurgeJob struct {
+	PurgeID string `gorm:"primary_key;size:36;unique"`
+	Status  string `gorm:"size:16"`
+	Created time.Time
+	Updated time.Time
+}
+
+func (p *PurgeJob) export() persistence.PurgeJob {
+	return persistence.PurgeJob{
+		PurgeID: p.PurgeID,
+		Status:  p.Status,
+		Created: p.Created,
+		Updated: p.Updated,
+	}
+}
+
+func importPurgeJob(p *persistence.PurgeJob) PurgeJob {
+	return PurgeJob{
+		PurgeID: p.PurgeID,
+		Status:  p.Status,
+		Created: p.Created,
+		Updated: p.Updated,
 	}
 }
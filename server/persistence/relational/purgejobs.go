@@ -0,0 +1,50 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+	"gorm.io/gorm"
+)
+
+func (r *relationalDAL) FindPurgeJob(q interface{}) (persistence.PurgeJob, error) {
+	switch query := q.(type) {
+	case persistence.FindPurgeJobQueryByID:
+		var job PurgeJob
+		if err := r.db.Where("purge_id = ?", string(query)).First(&job).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return persistence.PurgeJob{}, persistence.ErrUnknownPurge(fmt.Sprintf("relational: purge id %s unknown", string(query)))
+			}
+			return persistence.PurgeJob{}, fmt.Errorf("relational: error looking up purge job: %w", err)
+		}
+		return job.export(), nil
+	default:
+		return persistence.PurgeJob{}, persistence.ErrBadQuery
+	}
+}
+
+func (r *relationalDAL) UpdatePurgeJob(p *persistence.PurgeJob) error {
+	local := importPurgeJob(p)
+	if err := r.db.Save(&local).Error; err != nil {
+		return fmt.Errorf("relational: error saving purge job: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) DeletePurgeJobs(q interface{}) (int64, error) {
+	switch query := q.(type) {
+	case persistence.DeletePurgeJobsQueryOlderThan:
+		result := r.db.Where("created < ?", time.Time(query)).Delete(&PurgeJob{})
+		if err := result.Error; err != nil {
+			return 0, fmt.Errorf("relational: error deleting purge jobs: %w", err)
+		}
+		return result.RowsAffected, nil
+	default:
+		return 0, persistence.ErrBadQuery
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestRelationalDAL_PurgeJobs(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+	relational := NewRelationalDAL(db)
+
+	now := time.Now().UTC()
+	for _, job := range []persistence.PurgeJob{
+		{PurgeID: "purge-a", Status: "pending", Created: now.Add(-time.Hour * 48), Updated: now.Add(-time.Hour * 48)},
+		{PurgeID: "purge-b", Status: "pending", Created: now, Updated: now},
+	} {
+		if err := relational.UpdatePurgeJob(&job); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	if err := relational.UpdatePurgeJob(&persistence.PurgeJob{PurgeID: "purge-b", Status: "completed", Created: now, Updated: now}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	job, err := relational.FindPurgeJob(persistence.FindPurgeJobQueryByID("purge-b"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if job.Status != "completed" {
+		t.Errorf("Unexpected status %v", job.Status)
+	}
+
+	deleted, err := relational.DeletePurgeJobs(persistence.DeletePurgeJobsQueryOlderThan(now.Add(-time.Hour * 24)))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("Expected one job to be deleted, got %d", deleted)
+	}
+	var unknownPurgeErr persistence.ErrUnknownPurge
+	if _, err := relational.FindPurgeJob(persistence.FindPurgeJobQueryByID("purge-a")); !errors.As(err, &unknownPurgeErr) {
+		t.Errorf("Expected unknown purge error, got %v", err)
+	}
+
+	if _, err := relational.FindPurgeJob("purge-b"); err != persistence.ErrBadQuery {
+		t.Errorf("Expected bad query error, got %v", err)
+	}
+	if _, err := relational.DeletePurgeJobs("purge-b"); err != persistence.ErrBadQuery {
+		t.Errorf("Expected bad query error, got %v", err)
+	}
+}
@@ -8,11 +8,6 @@ import (
 
 	"github.com/offen/offen/server/persistence"
 	"gorm.io/gorm"
-
-	// GORM imports the dialects for side effects only
-	_ "github.com/jinzhu/gorm/dialects/mysql"
-	_ "github.com/jinzhu/gorm/dialects/postgres"
-	_ "github.com/jinzhu/gorm/dialects/sqlite"
 )
 
 type relationalDAL struct {
@@ -43,6 +38,11 @@ var knownTables = []interface{}{
 	&Event{},
 	&Secret{},
 	&Tombstone{},
+	&WebAuthnCredential{},
+	&Session{},
+	&APIToken{},
+	&DeprecatedAccountKey{},
+	&AuditEntry{},
 }
 
 func (r *relationalDAL) ProbeEmpty() bool {
@@ -76,6 +76,15 @@ func (r *relationalDAL) DropAll() error {
 		&Secret{},
 		&AccountUser{},
 		&AccountUserRelationship{},
+		&WebAuthnCredential{},
+		&Session{},
+		&APIToken{},
+		&JobLock{},
+		&SyncState{},
+		&PurgeJob{},
+		&MaintenanceState{},
+		&DeprecatedAccountKey{},
+		&AuditEntry{},
 		"migrations",
 	); err != nil {
 		return fmt.Errorf("relational: error dropping tables: %w,", err)
@@ -31,6 +31,24 @@ func (r *relationalDAL) DeleteSecret(q interface{}) error {
 	}
 }
 
+func (r *relationalDAL) DeleteSecrets(q interface{}) (int64, error) {
+	switch query := q.(type) {
+	case persistence.DeleteSecretsQueryOrphaned:
+		deletion := r.db.Where(
+			"secret_id NOT IN (?)",
+			r.db.Model(&Event{}).Select("secret_id").Where("secret_id IS NOT NULL"),
+		).Where(
+			"created IS NULL OR created < ?", query.CreatedBefore,
+		).Delete(&Secret{})
+		if err := deletion.Error; err != nil {
+			return 0, fmt.Errorf("relational: error deleting orphaned secrets: %w", err)
+		}
+		return deletion.RowsAffected, nil
+	default:
+		return 0, persistence.ErrBadQuery
+	}
+}
+
 func (r *relationalDAL) FindSecret(q interface{}) (persistence.Secret, error) {
 	var secret Secret
 	switch query := q.(type) {
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/offen/offen/server/persistence"
 	"gorm.io/gorm"
@@ -132,6 +133,93 @@ func TestRelationalDAL_DeleteSecret(t *testing.T) {
 	}
 }
 
+func TestRelationalDAL_DeleteSecrets(t *testing.T) {
+	tests := []struct {
+		name             string
+		setup            dbAccess
+		arg              interface{}
+		expectedAffected int64
+		expectError      bool
+		assertion        dbAccess
+	}{
+		{
+			"bad arg",
+			noop,
+			12,
+			0,
+			true,
+			noop,
+		},
+		{
+			"orphaned secrets",
+			func(db *gorm.DB) error {
+				for _, id := range []string{"hashed-user-id-1", "hashed-user-id-2", "hashed-user-id-3"} {
+					if err := db.Save(&Secret{
+						SecretID: id,
+					}).Error; err != nil {
+						return fmt.Errorf("error inserting secret: %w", err)
+					}
+				}
+				if err := db.Save(&Secret{
+					SecretID: "hashed-user-id-4",
+					Created:  time.Now(),
+				}).Error; err != nil {
+					return fmt.Errorf("error inserting secret: %w", err)
+				}
+				if err := db.Save(&Event{
+					EventID:  "event-a",
+					SecretID: strptr("hashed-user-id-2"),
+				}).Error; err != nil {
+					return fmt.Errorf("error inserting event: %w", err)
+				}
+				if err := db.Save(&Event{
+					EventID: "event-b",
+				}).Error; err != nil {
+					return fmt.Errorf("error inserting event: %w", err)
+				}
+				return nil
+			},
+			persistence.DeleteSecretsQueryOrphaned{CreatedBefore: time.Now().Add(-time.Hour)},
+			2,
+			false,
+			func(db *gorm.DB) error {
+				var secrets []Secret
+				if err := db.Order("secret_id").Find(&secrets).Error; err != nil {
+					return fmt.Errorf("error looking up secrets: %w", err)
+				}
+				if len(secrets) != 2 || secrets[0].SecretID != "hashed-user-id-2" || secrets[1].SecretID != "hashed-user-id-4" {
+					return fmt.Errorf("unexpected secrets %v", secrets)
+				}
+				return nil
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, closeDB := createTestDatabase()
+			defer closeDB()
+
+			dal := NewRelationalDAL(db)
+
+			if err := test.setup(db); err != nil {
+				t.Fatalf("Unexpected error setting up test: %v", err)
+			}
+
+			affected, err := dal.DeleteSecrets(test.arg)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if affected != test.expectedAffected {
+				t.Errorf("Expected %d, got %d", test.expectedAffected, affected)
+			}
+
+			if err := test.assertion(db); err != nil {
+				t.Errorf("Unexpected assertion error: %v", err)
+			}
+		})
+	}
+}
+
 func TestRelationalDAL_FindSecret(t *testing.T) {
 	tests := []struct {
 		name           string
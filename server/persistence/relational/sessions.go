@@ -0,0 +1,77 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func (r *relationalDAL) CreateSession(s *persistence.Session) error {
+	local := importSession(s)
+	if err := r.db.Create(&local).Error; err != nil {
+		return fmt.Errorf("relational: error creating session: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) FindSessions(q interface{}) ([]persistence.Session, error) {
+	var sessions []Session
+	switch query := q.(type) {
+	case persistence.FindSessionsQueryBySessionID:
+		if err := r.db.Where("session_id = ?", string(query)).Find(&sessions).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up session by id: %w", err)
+		}
+	case persistence.FindSessionsQueryByAccountUserID:
+		if err := r.db.Where("account_user_id = ?", string(query)).Order("created ASC").Find(&sessions).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up sessions by account user id: %w", err)
+		}
+	default:
+		return nil, persistence.ErrBadQuery
+	}
+	result := []persistence.Session{}
+	for _, s := range sessions {
+		result = append(result, s.export())
+	}
+	return result, nil
+}
+
+func (r *relationalDAL) UpdateSession(s *persistence.Session) error {
+	local := importSession(s)
+	exists := r.db.Where("session_id = ?", local.SessionID).First(&Session{}).Error
+	if exists != nil {
+		return fmt.Errorf("relational: error looking up session for update: %w", exists)
+	}
+	if err := r.db.Save(&local).Error; err != nil {
+		return fmt.Errorf("relational: error updating session: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) DeleteSessions(q interface{}) (int64, error) {
+	switch query := q.(type) {
+	case persistence.DeleteSessionsQueryBySessionID:
+		deletion := r.db.Where("session_id = ?", string(query)).Delete(&Session{})
+		if err := deletion.Error; err != nil {
+			return 0, fmt.Errorf("relational: error deleting session by id: %w", err)
+		}
+		return deletion.RowsAffected, nil
+	case persistence.DeleteSessionsQueryByAccountUserID:
+		deletion := r.db.Where("account_user_id = ?", string(query)).Delete(&Session{})
+		if err := deletion.Error; err != nil {
+			return 0, fmt.Errorf("relational: error deleting sessions by account user id: %w", err)
+		}
+		return deletion.RowsAffected, nil
+	case persistence.DeleteSessionsQueryExpired:
+		deletion := r.db.Where("expires < ?", time.Time(query)).Delete(&Session{})
+		if err := deletion.Error; err != nil {
+			return 0, fmt.Errorf("relational: error deleting expired sessions: %w", err)
+		}
+		return deletion.RowsAffected, nil
+	default:
+		return 0, persistence.ErrBadQuery
+	}
+}
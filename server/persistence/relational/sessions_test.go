@@ -0,0 +1,81 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+	"gorm.io/gorm"
+)
+
+func TestRelationalDAL_DeleteSessions(t *testing.T) {
+	now := time.Now()
+	setup := func(db *gorm.DB) error {
+		for index, token := range []string{"a", "b", "c"} {
+			if err := db.Save(&Session{
+				SessionID:     fmt.Sprintf("session-%s", token),
+				AccountUserID: fmt.Sprintf("user-%d", index%2),
+				Expires:       now.Add(time.Duration(index-1) * time.Hour),
+			}).Error; err != nil {
+				return fmt.Errorf("error saving fixture data: %v", err)
+			}
+		}
+		return nil
+	}
+	tests := []struct {
+		name             string
+		query            interface{}
+		expectedAffected int64
+		expectError      bool
+	}{
+		{
+			"bad query",
+			"session-a",
+			0,
+			true,
+		},
+		{
+			"by session id",
+			persistence.DeleteSessionsQueryBySessionID("session-b"),
+			1,
+			false,
+		},
+		{
+			"by account user id",
+			persistence.DeleteSessionsQueryByAccountUserID("user-0"),
+			2,
+			false,
+		},
+		{
+			"expired",
+			persistence.DeleteSessionsQueryExpired(now),
+			1,
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, closeDB := createTestDatabase()
+			defer closeDB()
+
+			dal := NewRelationalDAL(db)
+
+			if err := setup(db); err != nil {
+				t.Fatalf("Unexpected error setting up test: %v", err)
+			}
+
+			affected, err := dal.DeleteSessions(test.query)
+			if test.expectedAffected != affected {
+				t.Errorf("Expected %d, got %d", test.expectedAffected, affected)
+			}
+
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/offen/offen/server/persistence"
+	"gorm.io/gorm"
+)
+
+func (r *relationalDAL) FindSyncState(q interface{}) (persistence.SyncState, error) {
+	switch query := q.(type) {
+	case persistence.FindSyncStateQueryByPrimary:
+		var state SyncState
+		if err := r.db.Where("primary_url = ?", string(query)).First(&state).Error; err != nil {
+			// a replica that has never synced before starts from scratch
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return persistence.SyncState{PrimaryURL: string(query)}, nil
+			}
+			return persistence.SyncState{}, fmt.Errorf("relational: error looking up sync state: %w", err)
+		}
+		return state.export(), nil
+	default:
+		return persistence.SyncState{}, persistence.ErrBadQuery
+	}
+}
+
+func (r *relationalDAL) UpdateSyncState(s *persistence.SyncState) error {
+	local := importSyncState(s)
+	if err := r.db.Save(&local).Error; err != nil {
+		return fmt.Errorf("relational: error saving sync state: %w", err)
+	}
+	return nil
+}
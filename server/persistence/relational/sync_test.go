@@ -0,0 +1,93 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestRelationalDAL_SyncState(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+	relational := NewRelationalDAL(db)
+
+	state, err := relational.FindSyncState(persistence.FindSyncStateQueryByPrimary("https://primary.offen.dev"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(persistence.SyncState{PrimaryURL: "https://primary.offen.dev"}, state) {
+		t.Errorf("Unexpected initial state %v", state)
+	}
+
+	for _, watermark := range []string{"watermark-a", "watermark-b"} {
+		state.Watermark = watermark
+		state.Updated = time.Now().UTC()
+		if err := relational.UpdateSyncState(&state); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	state, err = relational.FindSyncState(persistence.FindSyncStateQueryByPrimary("https://primary.offen.dev"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if state.Watermark != "watermark-b" {
+		t.Errorf("Unexpected watermark %v", state.Watermark)
+	}
+	var count int64
+	db.Model(&SyncState{}).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected a single sync state, got %d", count)
+	}
+
+	if _, err := relational.FindSyncState("https://primary.offen.dev"); err != persistence.ErrBadQuery {
+		t.Errorf("Expected bad query error, got %v", err)
+	}
+}
+
+func TestRelationalDAL_FindInRange(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+	relational := NewRelationalDAL(db)
+
+	db.Create(&Secret{SecretID: "secret-a", EncryptedSecret: "encrypted"})
+	for _, eventID := range []string{"event-a", "event-b", "event-c", "event-d"} {
+		db.Create(&Event{EventID: eventID, Sequence: eventID, SecretID: strptr("secret-a")})
+	}
+	// events that have been moved keep their id but receive a new sequence
+	db.Create(&Event{EventID: "event-0", Sequence: "event-b", SecretID: strptr("secret-a")})
+	for _, sequence := range []string{"event-a", "event-c"} {
+		db.Create(&Tombstone{EventID: "deleted-" + sequence, Sequence: sequence})
+	}
+
+	events, err := relational.FindEvents(persistence.FindEventsQueryInRange{
+		Since: "event-a",
+		Until: "event-d",
+		Limit: 2,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(events) != 2 || events[0].EventID != "event-0" || events[1].EventID != "event-b" {
+		t.Errorf("Unexpected events %v", events)
+	}
+	if events[0].Secret.EncryptedSecret != "encrypted" {
+		t.Errorf("Expected secret to be populated, got %v", events[0].Secret)
+	}
+
+	tombstones, err := relational.FindTombstones(persistence.FindTombstonesQueryInRange{
+		Since: "event-a",
+		Until: "event-d",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(tombstones) != 1 || tombstones[0].EventID != "deleted-event-c" {
+		t.Errorf("Unexpected tombstones %v", tombstones)
+	}
+}
@@ -39,6 +39,16 @@ func (r *relationalDAL) FindTombstones(q interface{}) ([]persistence.Tombstone,
 			export = append(export, t.export())
 		}
 		return export, nil
+	case persistence.FindTombstonesQueryInRange:
+		var result []Tombstone
+		if err := r.db.Find(&result, "sequence > ? AND sequence <= ?", query.Since, query.Until).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up tombstones in range: %w", err)
+		}
+		var export []persistence.Tombstone
+		for _, t := range result {
+			export = append(export, t.export())
+		}
+		return export, nil
 	default:
 		return nil, persistence.ErrBadQuery
 	}
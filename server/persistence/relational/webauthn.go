@@ -0,0 +1,51 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"fmt"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func (r *relationalDAL) CreateWebAuthnCredential(c *persistence.WebAuthnCredential) error {
+	local := importWebAuthnCredential(c)
+	if err := r.db.Create(&local).Error; err != nil {
+		return fmt.Errorf("relational: error creating webauthn credential: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) FindWebAuthnCredentials(q interface{}) ([]persistence.WebAuthnCredential, error) {
+	var credentials []WebAuthnCredential
+	switch query := q.(type) {
+	case persistence.FindWebAuthnCredentialsQueryByAccountUserID:
+		if err := r.db.Where("account_user_id = ?", string(query)).Find(&credentials).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up webauthn credentials: %w", err)
+		}
+	case persistence.FindWebAuthnCredentialsQueryByCredentialID:
+		if err := r.db.Where("credential_id = ?", string(query)).Find(&credentials).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up webauthn credentials: %w", err)
+		}
+	default:
+		return nil, persistence.ErrBadQuery
+	}
+	result := []persistence.WebAuthnCredential{}
+	for _, c := range credentials {
+		result = append(result, c.export())
+	}
+	return result, nil
+}
+
+func (r *relationalDAL) UpdateWebAuthnCredential(c *persistence.WebAuthnCredential) error {
+	local := importWebAuthnCredential(c)
+	exists := r.db.Where("credential_id = ?", local.CredentialID).First(&WebAuthnCredential{}).Error
+	if exists != nil {
+		return fmt.Errorf("relational: error looking up webauthn credential to update: %w", exists)
+	}
+	if err := r.db.Save(&local).Error; err != nil {
+		return fmt.Errorf("relational: error updating webauthn credential: %w", err)
+	}
+	return nil
+}
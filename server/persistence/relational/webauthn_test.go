@@ -0,0 +1,104 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/offen/offen/server/persistence"
+	"gorm.io/gorm"
+)
+
+func TestRelationalDAL_FindWebAuthnCredentials(t *testing.T) {
+	tests := []struct {
+		name           string
+		setup          dbAccess
+		query          interface{}
+		expectedResult []persistence.WebAuthnCredential
+		expectError    bool
+	}{
+		{
+			"bad query",
+			noop,
+			12,
+			nil,
+			true,
+		},
+		{
+			"by account user id",
+			func(db *gorm.DB) error {
+				for _, token := range []string{"a", "b", "c"} {
+					accountUserID := "user-a"
+					if token == "c" {
+						accountUserID = "user-b"
+					}
+					if err := db.Save(&WebAuthnCredential{
+						CredentialID:  fmt.Sprintf("credential-%s", token),
+						AccountUserID: accountUserID,
+					}).Error; err != nil {
+						return fmt.Errorf("error saving fixture data: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.FindWebAuthnCredentialsQueryByAccountUserID("user-a"),
+			[]persistence.WebAuthnCredential{
+				{CredentialID: "credential-a", AccountUserID: "user-a"},
+				{CredentialID: "credential-b", AccountUserID: "user-a"},
+			},
+			false,
+		},
+		{
+			"by credential id",
+			func(db *gorm.DB) error {
+				for _, token := range []string{"a", "b"} {
+					if err := db.Save(&WebAuthnCredential{
+						CredentialID:  fmt.Sprintf("credential-%s", token),
+						AccountUserID: "user-a",
+						SignCount:     12,
+					}).Error; err != nil {
+						return fmt.Errorf("error saving fixture data: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.FindWebAuthnCredentialsQueryByCredentialID("credential-b"),
+			[]persistence.WebAuthnCredential{
+				{CredentialID: "credential-b", AccountUserID: "user-a", SignCount: 12},
+			},
+			false,
+		},
+		{
+			"no match",
+			noop,
+			persistence.FindWebAuthnCredentialsQueryByCredentialID("credential-z"),
+			[]persistence.WebAuthnCredential{},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, closeDB := createTestDatabase()
+			defer closeDB()
+
+			dal := NewRelationalDAL(db)
+
+			if err := test.setup(db); err != nil {
+				t.Fatalf("Error setting up test: %v", err)
+			}
+
+			result, err := dal.FindWebAuthnCredentials(test.query)
+
+			if !reflect.DeepEqual(test.expectedResult, result) {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+		})
+	}
+}
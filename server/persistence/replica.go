@@ -0,0 +1,49 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"sync"
+	"time"
+)
+
+// replicaCheckInterval defines how long the result of checking the
+// availability of the read replica is reused for.
+const replicaCheckInterval = time.Second * 5
+
+// readReplica wraps a data access layer that is used for reading data only.
+type readReplica struct {
+	dal       DataAccessLayer
+	available bool
+	checked   time.Time
+	lock      sync.Mutex
+}
+
+// WithReadReplica configures the persistence layer to read the data for
+// GetAccount and Query from the given access layer. In case the replica
+// cannot be reached, the primary database is used instead.
+func WithReadReplica(dal DataAccessLayer) Config {
+	return func(p *persistenceLayer) {
+		p.replica = &readReplica{dal: dal}
+	}
+}
+
+func (r *readReplica) isAvailable() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if time.Since(r.checked) > replicaCheckInterval {
+		r.available = r.dal.Ping() == nil
+		r.checked = time.Now()
+	}
+	return r.available
+}
+
+// reads returns the access layer to be used for reads that can tolerate
+// being slightly out of date.
+func (p *persistenceLayer) reads() DataAccessLayer {
+	if p.replica == nil || !p.replica.isAvailable() {
+		return p.dal
+	}
+	return p.replica.dal
+}
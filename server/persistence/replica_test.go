@@ -0,0 +1,43 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type mockReplicaDatabase struct {
+	DataAccessLayer
+	pingErr error
+}
+
+func (m *mockReplicaDatabase) Ping() error {
+	return m.pingErr
+}
+
+func TestPersistenceLayer_Reads(t *testing.T) {
+	primary := &mockReplicaDatabase{}
+	replica := &mockReplicaDatabase{}
+
+	p := &persistenceLayer{dal: primary}
+	if p.reads() != primary {
+		t.Error("Expected primary to be used when no replica is configured")
+	}
+
+	WithReadReplica(replica)(p)
+	if p.reads() != replica {
+		t.Error("Expected replica to be used")
+	}
+
+	replica.pingErr = errors.New("did not work")
+	if p.reads() != replica {
+		t.Error("Expected result of availability check to be reused")
+	}
+	p.replica.checked = time.Now().Add(-time.Minute)
+	if p.reads() != primary {
+		t.Error("Expected primary to be used when replica is unavailable")
+	}
+}
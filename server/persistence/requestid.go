@@ -0,0 +1,287 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+)
+
+// RequestError annotates an error returned by the persistence layer with the
+// id of the request it has been returned for, so errors can be correlated
+// with the request that caused them.
+type RequestError struct {
+	RequestID string
+	Err       error
+}
+
+func (r *RequestError) Error() string {
+	return fmt.Sprintf("%v (request id %s)", r.Err, r.RequestID)
+}
+
+func (r *RequestError) Unwrap() error {
+	return r.Err
+}
+
+// WithRequestID returns a Service that annotates errors returned by s with
+// the given request id. Methods that are only used by background jobs and
+// commands are passed through unchanged.
+func WithRequestID(s Service, requestID string) Service {
+	if requestID == "" {
+		return s
+	}
+	return &requestService{Service: s, requestID: requestID}
+}
+
+type requestService struct {
+	Service
+	requestID string
+}
+
+func (r *requestService) wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &RequestError{RequestID: r.requestID, Err: err}
+}
+
+func (r *requestService) Insert(userID, accountID, payload string, eventID *string) error {
+	return r.wrap(r.Service.Insert(userID, accountID, payload, eventID))
+}
+
+func (r *requestService) InsertBatch(userID string, events []InboundEvent) error {
+	return r.wrap(r.Service.InsertBatch(userID, events))
+}
+
+func (r *requestService) StreamQuery(q Query) (EventsResult, *EventsStream, error) {
+	result, stream, err := r.Service.StreamQuery(q)
+	return result, stream, r.wrap(err)
+}
+
+func (r *requestService) GetAccount(accountID string, events bool, eventsSince string) (AccountResult, error) {
+	result, err := r.Service.GetAccount(accountID, events, eventsSince)
+	return result, r.wrap(err)
+}
+
+func (r *requestService) GetClientConfig(accountID string) (ClientConfigResult, error) {
+	result, err := r.Service.GetClientConfig(accountID)
+	return result, r.wrap(err)
+}
+
+func (r *requestService) StreamAccount(accountID, eventsSince string) (AccountResult, *EventsStream, error) {
+	result, stream, err := r.Service.StreamAccount(accountID, eventsSince)
+	return result, stream, r.wrap(err)
+}
+
+func (r *requestService) GetAccountWithArchive(accountID, eventsSince string) (AccountResult, error) {
+	result, err := r.Service.GetAccountWithArchive(accountID, eventsSince)
+	return result, r.wrap(err)
+}
+
+func (r *requestService) GetAccountStats(accountID string) (AccountStatsResult, error) {
+	result, err := r.Service.GetAccountStats(accountID)
+	return result, r.wrap(err)
+}
+
+func (r *requestService) GetAccountAggregates(accountID string, resolution AggregateResolution, since, until time.Time) (AggregatesResult, error) {
+	result, err := r.Service.GetAccountAggregates(accountID, resolution, since, until)
+	return result, r.wrap(err)
+}
+
+func (r *requestService) CreateAccount(name, creatorEmailAddress, creatorPassword string) (string, error) {
+	result, err := r.Service.CreateAccount(name, creatorEmailAddress, creatorPassword)
+	return result, r.wrap(err)
+}
+
+func (r *requestService) RetireAccount(accountID string) error {
+	return r.wrap(r.Service.RetireAccount(accountID))
+}
+
+func (r *requestService) SetAccountRetention(accountID string, retention time.Duration) error {
+	return r.wrap(r.Service.SetAccountRetention(accountID, retention))
+}
+
+func (r *requestService) SetAccountEventQuota(accountID string, eventsPerDay int) error {
+	return r.wrap(r.Service.SetAccountEventQuota(accountID, eventsPerDay))
+}
+
+func (r *requestService) SetAccountDomains(accountID string, domains []string) error {
+	return r.wrap(r.Service.SetAccountDomains(accountID, domains))
+}
+
+func (r *requestService) SetAccountBanner(accountID string, banner *AccountBanner) error {
+	return r.wrap(r.Service.SetAccountBanner(accountID, banner))
+}
+
+func (r *requestService) SetAccountSettings(accountID, encryptedSettings string) error {
+	return r.wrap(r.Service.SetAccountSettings(accountID, encryptedSettings))
+}
+
+func (r *requestService) VerifyAccountDomain(accountID, domain string) error {
+	return r.wrap(r.Service.VerifyAccountDomain(accountID, domain))
+}
+
+func (r *requestService) LookupAccountDomains(accountID string) ([]string, error) {
+	result, err := r.Service.LookupAccountDomains(accountID)
+	return result, r.wrap(err)
+}
+
+func (r *requestService) AssociateUserSecret(accountID, userID, encryptedUserSecret string) error {
+	return r.wrap(r.Service.AssociateUserSecret(accountID, userID, encryptedUserSecret))
+}
+
+func (r *requestService) Purge(userID string, accountIDs []string) error {
+	return r.wrap(r.Service.Purge(userID, accountIDs))
+}
+
+func (r *requestService) Export(userID string) (ExportResult, error) {
+	result, err := r.Service.Export(userID)
+	return result, r.wrap(err)
+}
+
+func (r *requestService) ImportAccount(data AccountExport, emailAddress, password string) error {
+	return r.wrap(r.Service.ImportAccount(data, emailAddress, password))
+}
+
+func (r *requestService) RotateAccountKeys(accountID, emailAddress, password string) error {
+	return r.wrap(r.Service.RotateAccountKeys(accountID, emailAddress, password))
+}
+
+func (r *requestService) Login(email, password string) (LoginResult, error) {
+	result, err := r.Service.Login(email, password)
+	return result, r.wrap(err)
+}
+
+func (r *requestService) LookupAccountUser(userID string) (LoginResult, error) {
+	result, err := r.Service.LookupAccountUser(userID)
+	return result, r.wrap(err)
+}
+
+func (r *requestService) ChangePassword(userID, currentPassword, changedPassword string) error {
+	return r.wrap(r.Service.ChangePassword(userID, currentPassword, changedPassword))
+}
+
+func (r *requestService) ChangeEmail(userID, emailAddress, emailCurrent, password string) error {
+	return r.wrap(r.Service.ChangeEmail(userID, emailAddress, emailCurrent, password))
+}
+
+func (r *requestService) GenerateOneTimeKey(emailAddress string) ([]byte, error) {
+	result, err := r.Service.GenerateOneTimeKey(emailAddress)
+	return result, r.wrap(err)
+}
+
+func (r *requestService) ResetPassword(emailAddress, password string, oneTimeKey []byte) error {
+	return r.wrap(r.Service.ResetPassword(emailAddress, password, oneTimeKey))
+}
+
+func (r *requestService) ShareAccount(inviteeEmailAddress, providerEmailAddress, providerPassword, accountID string, grantAdminPrivileges bool, role AccountUserRole) (ShareAccountResult, error) {
+	result, err := r.Service.ShareAccount(inviteeEmailAddress, providerEmailAddress, providerPassword, accountID, grantAdminPrivileges, role)
+	return result, r.wrap(err)
+}
+
+func (r *requestService) Join(emailAddress, password string) (string, error) {
+	result, err := r.Service.Join(emailAddress, password)
+	return result, r.wrap(err)
+}
+
+func (r *requestService) EnrollTOTP(accountUserID, password, secret, code string) ([]string, error) {
+	result, err := r.Service.EnrollTOTP(accountUserID, password, secret, code)
+	return result, r.wrap(err)
+}
+
+func (r *requestService) VerifyTOTP(accountUserID, code string) error {
+	return r.wrap(r.Service.VerifyTOTP(accountUserID, code))
+}
+
+func (r *requestService) DisableTOTP(accountUserID, password, code string) error {
+	return r.wrap(r.Service.DisableTOTP(accountUserID, password, code))
+}
+
+func (r *requestService) ListWebAuthnCredentials(accountUserID string) ([][]byte, error) {
+	result, err := r.Service.ListWebAuthnCredentials(accountUserID)
+	return result, r.wrap(err)
+}
+
+func (r *requestService) RegisterWebAuthnCredential(accountUserID string, response *protocol.ParsedCredentialCreationData, ceremony WebAuthnCeremony, wrappedKeys string) error {
+	return r.wrap(r.Service.RegisterWebAuthnCredential(accountUserID, response, ceremony, wrappedKeys))
+}
+
+func (r *requestService) LoginWebAuthn(response *protocol.ParsedCredentialAssertionData, ceremony WebAuthnCeremony) (LoginResult, error) {
+	result, err := r.Service.LoginWebAuthn(response, ceremony)
+	return result, r.wrap(err)
+}
+
+func (r *requestService) CreateSession(accountUserID, userAgent string, ttl time.Duration) (string, error) {
+	result, err := r.Service.CreateSession(accountUserID, userAgent, ttl)
+	return result, r.wrap(err)
+}
+
+func (r *requestService) ValidateSession(accountUserID, sessionID string) error {
+	return r.wrap(r.Service.ValidateSession(accountUserID, sessionID))
+}
+
+func (r *requestService) ListSessions(accountUserID string) ([]SessionResult, error) {
+	result, err := r.Service.ListSessions(accountUserID)
+	return result, r.wrap(err)
+}
+
+func (r *requestService) RevokeSession(accountUserID, sessionID string) error {
+	return r.wrap(r.Service.RevokeSession(accountUserID, sessionID))
+}
+
+func (r *requestService) RevokeSessions(accountUserID string) error {
+	return r.wrap(r.Service.RevokeSessions(accountUserID))
+}
+
+func (r *requestService) RecordAuditEntry(action, actorID, accountID, requestID string) error {
+	return r.wrap(r.Service.RecordAuditEntry(action, actorID, accountID, requestID))
+}
+
+func (r *requestService) ListAuditEntries(filter AuditLogFilter) ([]AuditEntryResult, error) {
+	result, err := r.Service.ListAuditEntries(filter)
+	return result, r.wrap(err)
+}
+
+func (r *requestService) CreateAPIToken(accountUserID, name string, accountIDs []string, scopes []APITokenScope) (APITokenResult, error) {
+	result, err := r.Service.CreateAPIToken(accountUserID, name, accountIDs, scopes)
+	return result, r.wrap(err)
+}
+
+func (r *requestService) ListAPITokens(accountUserID string) ([]APITokenResult, error) {
+	result, err := r.Service.ListAPITokens(accountUserID)
+	return result, r.wrap(err)
+}
+
+func (r *requestService) RevokeAPIToken(accountUserID, tokenID string) error {
+	return r.wrap(r.Service.RevokeAPIToken(accountUserID, tokenID))
+}
+
+func (r *requestService) LookupAPIToken(token string) (LoginResult, error) {
+	result, err := r.Service.LookupAPIToken(token)
+	return result, r.wrap(err)
+}
+
+func (r *requestService) ChangesSince(watermark string) (ChangeSet, error) {
+	result, err := r.Service.ChangesSince(watermark)
+	return result, r.wrap(err)
+}
+
+func (r *requestService) ReadOnly() (bool, error) {
+	result, err := r.Service.ReadOnly()
+	return result, r.wrap(err)
+}
+
+func (r *requestService) SetReadOnly(readOnly bool) error {
+	return r.wrap(r.Service.SetReadOnly(readOnly))
+}
+
+func (r *requestService) Bootstrap(data BootstrapConfig) error {
+	return r.wrap(r.Service.Bootstrap(data))
+}
+
+func (r *requestService) CheckHealth() error {
+	return r.wrap(r.Service.CheckHealth())
+}
@@ -0,0 +1,48 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+)
+
+type mockRequestIDService struct {
+	Service
+	err error
+}
+
+func (m *mockRequestIDService) RetireAccount(accountID string) error {
+	return m.err
+}
+
+func TestWithRequestID(t *testing.T) {
+	t.Run("error", func(t *testing.T) {
+		s := WithRequestID(&mockRequestIDService{err: ErrUnknownAccount("did not work")}, "request-a")
+		err := s.RetireAccount("account-a")
+		var requestErr *RequestError
+		if !errors.As(err, &requestErr) || requestErr.RequestID != "request-a" {
+			t.Errorf("Expected request error, got %v", err)
+		}
+		var unknownErr ErrUnknownAccount
+		if !errors.As(err, &unknownErr) {
+			t.Errorf("Expected wrapped error to be preserved, got %v", err)
+		}
+		if err.Error() != "did not work (request id request-a)" {
+			t.Errorf("Unexpected error message %v", err)
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		s := WithRequestID(&mockRequestIDService{}, "request-a")
+		if err := s.RetireAccount("account-a"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	})
+	t.Run("no request id", func(t *testing.T) {
+		db := &mockRequestIDService{}
+		if s := WithRequestID(db, ""); s != db {
+			t.Errorf("Expected service to be returned unchanged, got %v", s)
+		}
+	})
+}
@@ -28,6 +28,86 @@ type EventResult struct {
 	Payload   string  `json:"payload"`
 }
 
+// ExportResult contains all data stored about a single user across all
+// accounts.
+type ExportResult struct {
+	UserID   string                `json:"userId"`
+	Created  time.Time             `json:"created"`
+	Accounts []ExportAccountResult `json:"accounts"`
+}
+
+// ExportAccountResult contains the data stored about a user for a single
+// account.
+type ExportAccountResult struct {
+	AccountID           string              `json:"accountId"`
+	SecretID            string              `json:"secretId"`
+	EncryptedUserSecret string              `json:"encryptedUserSecret,omitempty"`
+	Events              []ExportEventResult `json:"events"`
+}
+
+// ExportEventResult is a single encrypted event contained in an export.
+type ExportEventResult struct {
+	EventID   string    `json:"eventId"`
+	Timestamp time.Time `json:"timestamp"`
+	Payload   string    `json:"payload"`
+}
+
+// AccountExport contains all data stored about an account, so it can be
+// imported into another instance. As it contains the account's key encryption
+// key, it grants access to all of the account's data.
+type AccountExport struct {
+	Version             int                  `json:"version"`
+	Created             time.Time            `json:"created"`
+	AccountID           string               `json:"accountId"`
+	Name                string               `json:"name"`
+	AccountCreated      time.Time            `json:"accountCreated"`
+	Retention           string               `json:"retention,omitempty"`
+	EventQuota          int                  `json:"eventQuota,omitempty"`
+	Domains             []string             `json:"domains,omitempty"`
+	Banner              *AccountBanner       `json:"banner,omitempty"`
+	EncryptedSettings   string               `json:"encryptedSettings,omitempty"`
+	PublicKey           string               `json:"publicKey"`
+	EncryptedPrivateKey string               `json:"encryptedPrivateKey"`
+	KeyAlgorithm        string               `json:"keyAlgorithm,omitempty"`
+	UserSalt            string               `json:"userSalt"`
+	PreviousUserSalt    string               `json:"previousUserSalt,omitempty"`
+	KeyEncryptionKey    string               `json:"keyEncryptionKey"`
+	Secrets             EncryptedSecretsByID `json:"secrets"`
+	Events              []AccountExportEvent `json:"events"`
+	DeprecatedKeys      []AccountExportKey   `json:"deprecatedKeys,omitempty"`
+}
+
+// AccountExportKey is a deprecated key pair of an account contained in an
+// account export.
+type AccountExportKey struct {
+	KeyID               string    `json:"keyId"`
+	PublicKey           string    `json:"publicKey"`
+	EncryptedPrivateKey string    `json:"encryptedPrivateKey"`
+	KeyAlgorithm        string    `json:"keyAlgorithm,omitempty"`
+	Deprecated          time.Time `json:"deprecated"`
+}
+
+// AccountExportEvent is a single encrypted event contained in an account
+// export, keeping its original identifiers.
+type AccountExportEvent struct {
+	EventID  string  `json:"eventId"`
+	Sequence string  `json:"sequence"`
+	SecretID *string `json:"secretId,omitempty"`
+	Payload  string  `json:"payload"`
+}
+
+// ChangeSet contains the changes a primary instance has recorded after the
+// given watermark. Accounts are always included in full. In case More is
+// true, further changes are available after the returned watermark.
+type ChangeSet struct {
+	Accounts   []Account   `json:"accounts"`
+	Secrets    []Secret    `json:"secrets"`
+	Events     []Event     `json:"events"`
+	Tombstones []Tombstone `json:"tombstones"`
+	Watermark  string      `json:"watermark"`
+	More       bool        `json:"more"`
+}
+
 // EventsByAccountID groups a list of events by AccountID in a response
 type EventsByAccountID map[string][]EventResult
 
@@ -41,11 +121,116 @@ type AccountResult struct {
 	Name                string                `json:"name"`
 	PublicKey           interface{}           `json:"publicKey,omitempty"`
 	EncryptedPrivateKey string                `json:"encryptedPrivateKey,omitempty"`
+	KeyAlgorithm        string                `json:"keyAlgorithm,omitempty"`
 	Events              *EventsByAccountID    `json:"events,omitempty"`
 	DeletedEvents       []string              `json:"deletedEvents,omitempty"`
 	Sequence            string                `json:"sequence,omitempty"`
 	Secrets             *EncryptedSecretsByID `json:"secrets,omitempty"`
 	Created             time.Time             `json:"created,omitempty"`
+	Retention           string                `json:"retention,omitempty"`
+	EventQuota          int                   `json:"eventQuota,omitempty"`
+	Domains             []AccountDomainResult `json:"domains,omitempty"`
+	Banner              *AccountBanner        `json:"banner,omitempty"`
+	EncryptedSettings   string                `json:"encryptedSettings,omitempty"`
+	LastEventAt         *time.Time            `json:"lastEventAt,omitempty"`
+	DeprecatedKeys      []DeprecatedKeyResult `json:"deprecatedKeys,omitempty"`
+}
+
+// ClientConfigResult contains the account specific settings needed by the
+// script embedded on a site.
+type ClientConfigResult struct {
+	AccountID    string         `json:"accountId"`
+	PublicKey    interface{}    `json:"publicKey,omitempty"`
+	KeyAlgorithm string         `json:"keyAlgorithm,omitempty"`
+	Retired      bool           `json:"retired"`
+	RetiredAt    *time.Time     `json:"retiredAt,omitempty"`
+	Banner       *AccountBanner `json:"banner,omitempty"`
+}
+
+// AccountDomainResult is a domain an account is expected to receive events
+// from.
+type AccountDomainResult struct {
+	Domain   string     `json:"domain"`
+	Token    string     `json:"token"`
+	Verified *time.Time `json:"verified,omitempty"`
+}
+
+// DeprecatedKeyResult is a key pair of an account that has been replaced when
+// rotating the account's keys. The encrypted private key is only included
+// when the account's events are requested.
+type DeprecatedKeyResult struct {
+	PublicKey           interface{} `json:"publicKey"`
+	EncryptedPrivateKey string      `json:"encryptedPrivateKey,omitempty"`
+	KeyAlgorithm        string      `json:"keyAlgorithm,omitempty"`
+	Deprecated          time.Time   `json:"deprecated"`
+}
+
+// AccountStatsResult contains statistics about an account that can be derived
+// from unencrypted metadata only.
+type AccountStatsResult struct {
+	AccountID     string         `json:"accountId"`
+	TotalEvents   int            `json:"totalEvents"`
+	EventsPerDay  map[string]int `json:"eventsPerDay"`
+	DistinctUsers int            `json:"distinctUsers"`
+	OldestEventID string         `json:"oldestEventId,omitempty"`
+	NewestEventID string         `json:"newestEventId,omitempty"`
+	Quota         *QuotaResult   `json:"quota,omitempty"`
+}
+
+// AggregatesResult contains counts derived from the unencrypted metadata of
+// the events of an account, grouped into buckets of the given resolution.
+// Buckets without any events are omitted.
+type AggregatesResult struct {
+	AccountID  string              `json:"accountId"`
+	Resolution AggregateResolution `json:"resolution"`
+	Buckets    []AggregateBucket   `json:"buckets"`
+}
+
+// AggregateBucket contains the counts for all events in a single bucket.
+// Distinct users are counted using the hashed user ids, so anonymous events
+// do not count towards them.
+type AggregateBucket struct {
+	Start         time.Time `json:"start"`
+	Events        int       `json:"events"`
+	DistinctUsers int       `json:"distinctUsers"`
+	PayloadBytes  int64     `json:"payloadBytes"`
+}
+
+// QuotaResult describes how much of its daily event quota an account has used.
+type QuotaResult struct {
+	Limit    int       `json:"limit"`
+	Used     int       `json:"used"`
+	ResetsAt time.Time `json:"resetsAt"`
+}
+
+// ExpireResult contains the number of events that have been expired for a
+// single account.
+type ExpireResult struct {
+	AccountID string        `json:"accountId"`
+	Name      string        `json:"name"`
+	Retention time.Duration `json:"retention"`
+	Expired   int           `json:"expired"`
+}
+
+// ExpireReport summarizes a single run of expiring events. Expired is the
+// total number of events that have been expired, including events that do
+// not belong to any known account.
+type ExpireReport struct {
+	Started  time.Time      `json:"started"`
+	Duration time.Duration  `json:"duration"`
+	Expired  int            `json:"expired"`
+	Accounts []ExpireResult `json:"accounts"`
+}
+
+// KeyCheckResult describes whether a key pair of an account is usable. KeyID
+// is empty for the account's current key pair.
+type KeyCheckResult struct {
+	AccountID    string `json:"accountId"`
+	Name         string `json:"name"`
+	KeyID        string `json:"keyId,omitempty"`
+	KeyAlgorithm string `json:"keyAlgorithm,omitempty"`
+	Valid        bool   `json:"valid"`
+	Problem      string `json:"problem,omitempty"`
 }
 
 // ShareAccountResult is a successful invitation of a user
@@ -58,7 +243,12 @@ type ShareAccountResult struct {
 type LoginResult struct {
 	AccountUserID string                `json:"accountUserId"`
 	AdminLevel    AccountUserAdminLevel `json:"adminLevel"`
+	TOTPEnabled   bool                  `json:"totpEnabled"`
 	Accounts      []LoginAccountResult  `json:"accounts"`
+	WrappedKeys   string                `json:"wrappedKeys,omitempty"`
+	// Scopes is only populated when authenticating using an API token and
+	// restricts the capabilities of the login to the listed scopes.
+	Scopes []APITokenScope `json:"scopes,omitempty"`
 }
 
 // CanAccessAccount checks whether the login result is allowed to access the
@@ -72,16 +262,86 @@ func (l *LoginResult) CanAccessAccount(accountID string) bool {
 	return false
 }
 
+// CanManageAccount checks whether the login result is allowed to perform
+// administrative tasks on the account of the given identifier. SuperAdmins
+// are allowed to manage all accounts they have access to.
+func (l *LoginResult) CanManageAccount(accountID string) bool {
+	for _, account := range l.Accounts {
+		if accountID == account.AccountID {
+			return l.IsSuperAdmin() || account.Role == AccountUserRoleAdmin
+		}
+	}
+	return false
+}
+
+// HasScope checks whether the login result has been granted the given scope.
+// Logins that have not been created from an API token are not restricted.
+func (l *LoginResult) HasScope(scope APITokenScope) bool {
+	if l.Scopes == nil {
+		return true
+	}
+	for _, s := range l.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
 // IsSuperAdmin checks whether the login result is a SuperAdmin.
 func (l *LoginResult) IsSuperAdmin() bool {
 	return l.AdminLevel == AccountUserAdminLevelSuperAdmin
 }
 
+// PurgeJobResult contains the status of a purge that is running in the
+// background.
+type PurgeJobResult struct {
+	PurgeID string
+	Status  string
+	Created time.Time
+	Updated time.Time
+}
+
+// AuditEntryResult is a single entry of the audit log.
+type AuditEntryResult struct {
+	EntryID   string    `json:"entryId"`
+	Action    string    `json:"action"`
+	ActorID   string    `json:"actorId,omitempty"`
+	AccountID string    `json:"accountId,omitempty"`
+	RequestID string    `json:"requestId,omitempty"`
+	Created   time.Time `json:"created"`
+}
+
+// SessionResult contains information about an active session of an
+// account user.
+type SessionResult struct {
+	SessionID string    `json:"sessionId"`
+	UserAgent string    `json:"userAgent"`
+	Current   bool      `json:"current"`
+	Created   time.Time `json:"created"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Expires   time.Time `json:"expires"`
+}
+
+// APITokenResult contains information about an API token. The token itself
+// is only returned once after it has been created.
+type APITokenResult struct {
+	TokenID    string          `json:"tokenId"`
+	Name       string          `json:"name"`
+	Token      string          `json:"token,omitempty"`
+	AccountIDs []string        `json:"accountIds"`
+	Scopes     []APITokenScope `json:"scopes"`
+	Created    time.Time       `json:"created"`
+	LastUsed   time.Time       `json:"lastUsed"`
+}
+
 // LoginAccountResult contains information for the client to handle an account
 // in the client at runtime.
 type LoginAccountResult struct {
-	AccountName      string      `json:"accountName"`
-	AccountID        string      `json:"accountId"`
-	KeyEncryptionKey interface{} `json:"keyEncryptionKey"`
-	Created          time.Time   `json:"created"`
+	AccountName      string          `json:"accountName"`
+	AccountID        string          `json:"accountId"`
+	Role             AccountUserRole `json:"role"`
+	KeyEncryptionKey interface{}     `json:"keyEncryptionKey"`
+	Created          time.Time       `json:"created"`
+	LastEventAt      *time.Time      `json:"lastEventAt,omitempty"`
 }
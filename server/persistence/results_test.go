@@ -0,0 +1,64 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import "testing"
+
+func TestLoginResult_CanManageAccount(t *testing.T) {
+	tests := []struct {
+		name           string
+		result         LoginResult
+		accountID      string
+		expectedResult bool
+	}{
+		{
+			"no access",
+			LoginResult{
+				Accounts: []LoginAccountResult{
+					{AccountID: "account-a", Role: AccountUserRoleAdmin},
+				},
+			},
+			"account-b",
+			false,
+		},
+		{
+			"viewer",
+			LoginResult{
+				Accounts: []LoginAccountResult{
+					{AccountID: "account-a", Role: AccountUserRoleViewer},
+				},
+			},
+			"account-a",
+			false,
+		},
+		{
+			"account admin",
+			LoginResult{
+				Accounts: []LoginAccountResult{
+					{AccountID: "account-a", Role: AccountUserRoleAdmin},
+				},
+			},
+			"account-a",
+			true,
+		},
+		{
+			"super admin",
+			LoginResult{
+				AdminLevel: AccountUserAdminLevelSuperAdmin,
+				Accounts: []LoginAccountResult{
+					{AccountID: "account-a", Role: AccountUserRoleViewer},
+				},
+			},
+			"account-a",
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := test.result.CanManageAccount(test.accountID); result != test.expectedResult {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
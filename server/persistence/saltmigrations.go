@@ -0,0 +1,102 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sync"
+)
+
+// saltMigrationQueueSize is the maximum number of users that can be waiting
+// for their data to be migrated to the current salt of an account.
+const saltMigrationQueueSize = 1024
+
+type saltMigration struct {
+	userID    string
+	accountID string
+}
+
+// saltMigrations migrates the data of users to the current salt of an account
+// in the background. Migrating requires the user id, which is only known while
+// handling a request of the user, but rehashing all of a user's events must
+// not delay the response to the request.
+type saltMigrations struct {
+	queue   chan saltMigration
+	lock    sync.Mutex
+	closed  bool
+	pending map[[sha256.Size]byte]bool
+	wg      sync.WaitGroup
+}
+
+func newSaltMigrations(size int) *saltMigrations {
+	return &saltMigrations{
+		queue:   make(chan saltMigration, size),
+		pending: map[[sha256.Size]byte]bool{},
+	}
+}
+
+func (m saltMigration) key() [sha256.Size]byte {
+	return sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s", m.accountID, m.userID)))
+}
+
+// schedule queues the migration of the given user for each of the given
+// accounts whose user salt has been rotated. In case the queue is full,
+// migrations are skipped as they are scheduled again on the next request of
+// the user.
+func (s *saltMigrations) schedule(userID string, accounts []Account) {
+	if userID == "" {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return
+	}
+	for _, account := range accounts {
+		if account.PreviousUserSalt == "" {
+			continue
+		}
+		migration := saltMigration{userID: userID, accountID: account.AccountID}
+		key := migration.key()
+		if s.pending[key] {
+			continue
+		}
+		select {
+		case s.queue <- migration:
+			s.pending[key] = true
+		default:
+			return
+		}
+	}
+}
+
+func (s *saltMigrations) done(migration saltMigration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.pending, migration.key())
+}
+
+// start migrates queued users using the given function. Failed migrations are
+// not retried, as they are scheduled again on the next request of the user.
+func (s *saltMigrations) start(migrate func(userID, accountID string) error) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for migration := range s.queue {
+			migrate(migration.userID, migration.accountID)
+			s.done(migration)
+		}
+	}()
+}
+
+func (s *saltMigrations) close() {
+	s.lock.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.lock.Unlock()
+	s.wg.Wait()
+}
@@ -0,0 +1,41 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestSaltMigrations(t *testing.T) {
+	s := newSaltMigrations(2)
+	var lock sync.Mutex
+	var migrated []string
+	s.schedule("user-a", []Account{
+		{AccountID: "account-a", PreviousUserSalt: "salt"},
+		{AccountID: "account-b"},
+		{AccountID: "account-c", PreviousUserSalt: "salt"},
+	})
+	s.schedule("user-a", []Account{{AccountID: "account-a", PreviousUserSalt: "salt"}})
+	// the queue is full, so this is skipped
+	s.schedule("user-b", []Account{{AccountID: "account-a", PreviousUserSalt: "salt"}})
+	s.schedule("", []Account{{AccountID: "account-a", PreviousUserSalt: "salt"}})
+
+	s.start(func(userID, accountID string) error {
+		lock.Lock()
+		defer lock.Unlock()
+		migrated = append(migrated, userID+"/"+accountID)
+		return nil
+	})
+	s.close()
+	s.schedule("user-c", []Account{{AccountID: "account-a", PreviousUserSalt: "salt"}})
+
+	if !reflect.DeepEqual([]string{"user-a/account-a", "user-a/account-c"}, migrated) {
+		t.Errorf("Unexpected migrations %v", migrated)
+	}
+	if len(s.pending) != 0 {
+		t.Errorf("Unexpected pending migrations %v", s.pending)
+	}
+}
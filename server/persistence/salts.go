@@ -0,0 +1,232 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// saltMigrationBatchSize is the maximum number of events that are migrated
+// in a single transaction when rehashing a user id after its account's user
+// salt has been rotated.
+const saltMigrationBatchSize = 500
+
+// RotateUserSalt replaces the salt that is used for hashing user ids of the
+// account with the given id. As user ids are only known to users themselves,
+// existing secrets and events cannot be rehashed right away. Instead, the
+// previous salt is kept and the data of each user is migrated the next time
+// they interact with the account. In case the account still has a previous
+// salt, force needs to be passed, which discards it, so users that have not
+// been migrated yet lose access to their data.
+func (p *persistenceLayer) RotateUserSalt(accountID string, force bool) error {
+	account, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account %s: %w", accountID, err)
+	}
+	if account.PreviousUserSalt != "" && !force {
+		return fmt.Errorf("persistence: user salt of account %s has been rotated before, pass force to discard the previous salt", accountID)
+	}
+
+	salt, err := p.userSalts.NewUserSalt()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating salt: %w", err)
+	}
+	account.PreviousUserSalt = account.UserSalt
+	account.UserSalt = salt.Marshal()
+	if err := p.dal.UpdateAccount(&account); err != nil {
+		return fmt.Errorf("persistence: error saving rotated salt of account %s: %w", accountID, err)
+	}
+	p.publishAccountChange(AccountChange{AccountID: accountID, Reason: AccountChangeSaltRotated})
+	return nil
+}
+
+// scheduleUserSaltMigrations works like migrateUserSalts, but migrates users
+// in the background so callers do not have to wait for all events being
+// rehashed. Until the migration is done, the user's events are stored using
+// either of the hashed user ids.
+func (p *persistenceLayer) scheduleUserSaltMigrations(userID string, accounts []Account) error {
+	if p.saltMigrations == nil {
+		return p.migrateUserSalts(userID, accounts)
+	}
+	p.saltMigrations.schedule(userID, accounts)
+	return nil
+}
+
+// migrateQueuedUserSalt migrates a user that has been queued for the given
+// account. The account is looked up again as its salts might have changed
+// since the user has been queued.
+func (p *persistenceLayer) migrateQueuedUserSalt(userID, accountID string) error {
+	account, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account %s: %w", accountID, err)
+	}
+	return p.migrateUserSalts(userID, []Account{account})
+}
+
+// previousUserIDHashes returns the user id hashed using the previous salt of
+// each of the given accounts whose user salt has been rotated.
+func (p *persistenceLayer) previousUserIDHashes(userID string, accounts []Account) ([]string, error) {
+	var hashes []string
+	if userID == "" {
+		return hashes, nil
+	}
+	for _, account := range accounts {
+		if account.PreviousUserSalt == "" {
+			continue
+		}
+		hash, err := account.hashUserIDWithPreviousSalt(userID, p.userIDPepper)
+		if err != nil {
+			return nil, fmt.Errorf("persistence: error hashing user id with previous salt: %w", err)
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
+
+// migrateUserSalts migrates the secrets and events of the given user to the
+// current salt of each of the given accounts whose user salt has been rotated.
+func (p *persistenceLayer) migrateUserSalts(userID string, accounts []Account) error {
+	if userID == "" {
+		return nil
+	}
+	for _, account := range accounts {
+		if account.PreviousUserSalt == "" {
+			continue
+		}
+		if err := p.migrateUserSalt(userID, account); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateUserSalt moves the secret and all events of the given user from the
+// id hashed using the account's previous salt to the id hashed using its
+// current salt. Events are migrated in batches, each batch being its own
+// transaction, and receive new event ids so clients consider the previous
+// ones deleted. The previous secret is only deleted after all events have
+// been migrated, so an interrupted migration is continued on the next call.
+func (p *persistenceLayer) migrateUserSalt(userID string, account Account) error {
+	previousHash, hash, ok, err := p.migrateUserSecret(userID, account)
+	if err != nil || !ok {
+		return err
+	}
+
+	events, err := p.dal.FindEvents(FindEventsQueryForSecretIDs{
+		SecretIDs: []string{previousHash},
+	})
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up events to migrate: %w", err)
+	}
+	for len(events) > 0 {
+		batch := events
+		if len(batch) > saltMigrationBatchSize {
+			batch = events[:saltMigrationBatchSize]
+		}
+		events = events[len(batch):]
+		if err := p.migrateUserSaltBatch(batch, hash); err != nil {
+			return err
+		}
+	}
+
+	if err := p.dal.DeleteSecret(DeleteSecretQueryBySecretID(previousHash)); err != nil {
+		return fmt.Errorf("persistence: error deleting secret for previous salt: %w", err)
+	}
+	return nil
+}
+
+// migrateUserSecret copies the secret of the given user from the id hashed
+// using the account's previous salt to the id hashed using its current salt.
+// In case the user does not have a secret for the previous salt, false is
+// returned.
+func (p *persistenceLayer) migrateUserSecret(userID string, account Account) (string, string, bool, error) {
+	previousHash, err := account.hashUserIDWithPreviousSalt(userID, p.userIDPepper)
+	if err != nil {
+		return "", "", false, fmt.Errorf("persistence: error hashing user id with previous salt: %w", err)
+	}
+	secret, err := p.dal.FindSecret(FindSecretQueryBySecretID(previousHash))
+	if err != nil {
+		var unknownSecretErr ErrUnknownSecret
+		if errors.As(err, &unknownSecretErr) {
+			return "", "", false, nil
+		}
+		return "", "", false, fmt.Errorf("persistence: error looking up secret for previous salt: %w", err)
+	}
+
+	hash, err := p.hashUserID(account, userID)
+	if err != nil {
+		return "", "", false, fmt.Errorf("persistence: error hashing user id: %w", err)
+	}
+	if _, err := p.dal.FindSecret(FindSecretQueryBySecretID(hash)); err != nil {
+		var unknownSecretErr ErrUnknownSecret
+		if !errors.As(err, &unknownSecretErr) {
+			return "", "", false, fmt.Errorf("persistence: error looking up secret: %w", err)
+		}
+		if err := p.dal.CreateSecret(&Secret{
+			SecretID:        hash,
+			EncryptedSecret: secret.EncryptedSecret,
+			Created:         time.Now(),
+		}); err != nil {
+			return "", "", false, fmt.Errorf("persistence: error creating secret for current salt: %w", err)
+		}
+	}
+	return previousHash, hash, true, nil
+}
+
+func (p *persistenceLayer) migrateUserSaltBatch(events []Event, hash string) error {
+	sequence, err := NewULID()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating sequence for migrated events: %w", err)
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	var idsToDelete []string
+	for _, evt := range events {
+		newID, err := siblingEventID(evt.EventID)
+		if err != nil {
+			txn.Rollback()
+			return fmt.Errorf("persistence: error creating new event id: %w", err)
+		}
+		if err := txn.CreateEvent(&Event{
+			EventID:   newID,
+			Sequence:  sequence,
+			AccountID: evt.AccountID,
+			SecretID:  &hash,
+			Payload:   evt.Payload,
+		}); err != nil {
+			txn.Rollback()
+			return fmt.Errorf("persistence: error migrating event: %w", err)
+		}
+		if err := txn.CreateTombstone(&Tombstone{
+			EventID:   evt.EventID,
+			AccountID: evt.AccountID,
+			SecretID:  evt.SecretID,
+			Sequence:  sequence,
+		}); err != nil {
+			txn.Rollback()
+			return fmt.Errorf("persistence: error creating tombstone for migrated event: %w", err)
+		}
+		idsToDelete = append(idsToDelete, evt.EventID)
+	}
+	affected, err := txn.DeleteEvents(DeleteEventsQueryByEventIDs(idsToDelete))
+	if err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error deleting migrated events: %w", err)
+	}
+	// in case the same user is migrated concurrently, the batch might have
+	// been migrated already and must not be duplicated
+	if affected != int64(len(idsToDelete)) {
+		txn.Rollback()
+		return errors.New("persistence: events have been migrated concurrently")
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing migrated events: %w", err)
+	}
+	return nil
+}
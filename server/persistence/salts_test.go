@@ -0,0 +1,233 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/offen/offen/server/keys"
+)
+
+type mockUserSaltDatabase struct {
+	DataAccessLayer
+	account    Account
+	secrets    map[string]Secret
+	events     []Event
+	tombstones []Tombstone
+}
+
+func (m *mockUserSaltDatabase) FindAccount(interface{}) (Account, error) {
+	return m.account, nil
+}
+
+func (m *mockUserSaltDatabase) UpdateAccount(a *Account) error {
+	m.account = *a
+	return nil
+}
+
+func (m *mockUserSaltDatabase) FindSecret(q interface{}) (Secret, error) {
+	secret, ok := m.secrets[string(q.(FindSecretQueryBySecretID))]
+	if !ok {
+		return Secret{}, ErrUnknownSecret("not found")
+	}
+	return secret, nil
+}
+
+func (m *mockUserSaltDatabase) CreateSecret(s *Secret) error {
+	m.secrets[s.SecretID] = *s
+	return nil
+}
+
+func (m *mockUserSaltDatabase) DeleteSecret(q interface{}) error {
+	delete(m.secrets, string(q.(DeleteSecretQueryBySecretID)))
+	return nil
+}
+
+func (m *mockUserSaltDatabase) FindEvents(q interface{}) ([]Event, error) {
+	query := q.(FindEventsQueryForSecretIDs)
+	var result []Event
+	for _, evt := range m.events {
+		for _, secretID := range query.SecretIDs {
+			if evt.SecretID != nil && *evt.SecretID == secretID {
+				result = append(result, evt)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (m *mockUserSaltDatabase) CreateEvent(e *Event) error {
+	m.events = append(m.events, *e)
+	return nil
+}
+
+func (m *mockUserSaltDatabase) DeleteEvents(q interface{}) (int64, error) {
+	ids := map[string]bool{}
+	for _, id := range q.(DeleteEventsQueryByEventIDs) {
+		ids[id] = true
+	}
+	var remaining []Event
+	for _, evt := range m.events {
+		if !ids[evt.EventID] {
+			remaining = append(remaining, evt)
+		}
+	}
+	affected := int64(len(m.events) - len(remaining))
+	m.events = remaining
+	return affected, nil
+}
+
+func (m *mockUserSaltDatabase) CreateTombstone(t *Tombstone) error {
+	m.tombstones = append(m.tombstones, *t)
+	return nil
+}
+
+func (m *mockUserSaltDatabase) Transaction() (Transaction, error) {
+	return &mockTxn{m}, nil
+}
+
+func TestPersistenceLayer_RotateUserSalt(t *testing.T) {
+	account, _, err := newAccount("salted", "9b63c4d8-65c0-438c-9d30-cc4b01173393", newMockKeypairProvider(t, keys.KeyAlgorithmRSAOAEP), newMockUserSaltProvider(t))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	previousHash, _ := account.HashUserID("user-a", nil)
+	otherHash, _ := account.HashUserID("user-b", nil)
+
+	db := &mockUserSaltDatabase{
+		account: *account,
+		secrets: map[string]Secret{
+			previousHash: {SecretID: previousHash, EncryptedSecret: "secret-a"},
+			otherHash:    {SecretID: otherHash, EncryptedSecret: "secret-b"},
+		},
+		events: []Event{
+			{EventID: "01F4Z2Q4B5C6D7E8F9G0H1J2K0", AccountID: account.AccountID, SecretID: &previousHash, Payload: "payload-a"},
+			{EventID: "01F4Z2Q4B5C6D7E8F9G0H1J2K3", AccountID: account.AccountID, SecretID: &previousHash, Payload: "payload-b"},
+			{EventID: "01F4Z2Q4B5C6D7E8F9G0H1J2K5", AccountID: account.AccountID, SecretID: &otherHash, Payload: "payload-c"},
+		},
+	}
+	// rotating is also the migration path for moving accounts to another
+	// hashing algorithm
+	userSalts, err := keys.NewUserSaltProvider(keys.UserIDHashArgon2id, keys.Argon2Params{Time: 1, Memory: 64, Threads: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	p := &persistenceLayer{dal: db, userSalts: userSalts}
+
+	if err := p.RotateUserSalt(account.AccountID, false); err != nil {
+		t.Fatalf("Unexpected error rotating salt %v", err)
+	}
+	if db.account.PreviousUserSalt != account.UserSalt || db.account.UserSalt == account.UserSalt {
+		t.Fatalf("Unexpected salts after rotation %v", db.account)
+	}
+	if !strings.HasPrefix(db.account.UserSalt, "{2,}") {
+		t.Errorf("Expected rotated salt to use argon2id, got %v", db.account.UserSalt)
+	}
+	if err := p.RotateUserSalt(account.AccountID, false); err == nil {
+		t.Error("Expected error when rotating salt again without force")
+	}
+
+	if err := p.migrateUserSalts("user-a", []Account{db.account}); err != nil {
+		t.Fatalf("Unexpected error migrating user %v", err)
+	}
+	hash, _ := db.account.HashUserID("user-a", nil)
+	if _, ok := db.secrets[previousHash]; ok {
+		t.Error("Expected previous secret to be deleted")
+	}
+	if secret, ok := db.secrets[hash]; !ok || secret.EncryptedSecret != "secret-a" {
+		t.Errorf("Expected secret to be migrated, got %v", db.secrets)
+	}
+	if _, ok := db.secrets[otherHash]; !ok {
+		t.Error("Unexpected migration of other user's secret")
+	}
+
+	var migrated, other int
+	for _, evt := range db.events {
+		switch *evt.SecretID {
+		case hash:
+			migrated++
+			if evt.EventID == "01F4Z2Q4B5C6D7E8F9G0H1J2K0" || evt.EventID == "01F4Z2Q4B5C6D7E8F9G0H1J2K3" {
+				t.Errorf("Expected migrated event to receive new id, got %s", evt.EventID)
+			}
+		case otherHash:
+			other++
+		default:
+			t.Errorf("Unexpected event %v", evt)
+		}
+	}
+	if migrated != 2 || other != 1 {
+		t.Errorf("Unexpected events after migration %v", db.events)
+	}
+	if len(db.tombstones) != 2 {
+		t.Errorf("Expected tombstones for migrated events, got %v", db.tombstones)
+	}
+
+	// migrating again is a no-op
+	if err := p.migrateUserSalts("user-a", []Account{db.account}); err != nil {
+		t.Fatalf("Unexpected error migrating user again %v", err)
+	}
+	if len(db.events) != 3 || len(db.tombstones) != 2 {
+		t.Errorf("Unexpected changes when migrating again")
+	}
+
+	if err := p.RotateUserSalt(account.AccountID, true); err != nil {
+		t.Errorf("Unexpected error forcing rotation %v", err)
+	}
+}
+
+func TestPersistenceLayer_ScheduleUserSaltMigrations(t *testing.T) {
+	account, _, err := newAccount("salted", "9b63c4d8-65c0-438c-9d30-cc4b01173393", newMockKeypairProvider(t, keys.KeyAlgorithmRSAOAEP), newMockUserSaltProvider(t))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	previousHash, _ := account.HashUserID("user-a", nil)
+	db := &mockUserSaltDatabase{
+		account: *account,
+		secrets: map[string]Secret{
+			previousHash: {SecretID: previousHash, EncryptedSecret: "secret-a"},
+		},
+		events: []Event{
+			{EventID: "01F4Z2Q4B5C6D7E8F9G0H1J2K0", AccountID: account.AccountID, SecretID: &previousHash, Payload: "payload-a"},
+		},
+	}
+	p := &persistenceLayer{dal: db, userSalts: newMockUserSaltProvider(t), saltMigrations: newSaltMigrations(1)}
+	if err := p.RotateUserSalt(account.AccountID, false); err != nil {
+		t.Fatalf("Unexpected error rotating salt %v", err)
+	}
+	hash, _ := db.account.HashUserID("user-a", nil)
+
+	evt, err := p.prepareEvent("user-a", account.AccountID, "payload-b", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if *evt.SecretID != hash {
+		t.Errorf("Expected event to use current hash, got %v", *evt.SecretID)
+	}
+	if _, ok := db.secrets[hash]; !ok {
+		t.Error("Expected secret to be migrated right away")
+	}
+	if len(db.events) != 1 || *db.events[0].SecretID != previousHash {
+		t.Errorf("Expected events not to be migrated right away, got %v", db.events)
+	}
+
+	// scheduling again does not queue the same user twice
+	if _, err := p.prepareEvent("user-a", account.AccountID, "payload-c", nil); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(p.saltMigrations.queue) != 1 {
+		t.Fatalf("Unexpected queue length %d", len(p.saltMigrations.queue))
+	}
+
+	migration := <-p.saltMigrations.queue
+	if err := p.migrateQueuedUserSalt(migration.userID, migration.accountID); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(db.events) != 1 || *db.events[0].SecretID != hash {
+		t.Errorf("Expected events to be migrated, got %v", db.events)
+	}
+	if _, ok := db.secrets[previousHash]; ok {
+		t.Error("Expected previous secret to be deleted")
+	}
+}
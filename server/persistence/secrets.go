@@ -0,0 +1,28 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+	"time"
+)
+
+// secretsGracePeriod is the minimum age of secrets that are pruned. Secrets
+// are created before the first event of a user is stored, so secrets that have
+// only just been created are not considered to be orphaned.
+const secretsGracePeriod = time.Hour
+
+// PruneSecrets deletes all user secrets that are not referenced by any event
+// anymore, e.g. because all of the user's events have expired or have been
+// purged. In case such a user returns, the router will signal an unknown
+// secret so a new one can be associated.
+func (p *persistenceLayer) PruneSecrets() (int, error) {
+	affected, err := p.dal.DeleteSecrets(DeleteSecretsQueryOrphaned{
+		CreatedBefore: time.Now().Add(-secretsGracePeriod),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("persistence: error pruning orphaned secrets: %w", err)
+	}
+	return int(affected), nil
+}
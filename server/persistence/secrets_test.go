@@ -0,0 +1,67 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type mockPruneSecretsDatabase struct {
+	DataAccessLayer
+	affected int64
+	err      error
+	query    interface{}
+}
+
+func (m *mockPruneSecretsDatabase) DeleteSecrets(q interface{}) (int64, error) {
+	m.query = q
+	return m.affected, m.err
+}
+
+func TestPersistenceLayer_PruneSecrets(t *testing.T) {
+	tests := []struct {
+		name             string
+		db               *mockPruneSecretsDatabase
+		expectedAffected int
+		expectError      bool
+	}{
+		{
+			"database error",
+			&mockPruneSecretsDatabase{
+				err: errors.New("did not work"),
+			},
+			0,
+			true,
+		},
+		{
+			"ok",
+			&mockPruneSecretsDatabase{
+				affected: 3,
+			},
+			3,
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &persistenceLayer{dal: test.db}
+			affected, err := p.PruneSecrets()
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if affected != test.expectedAffected {
+				t.Errorf("Expected %d, got %d", test.expectedAffected, affected)
+			}
+			query, ok := test.db.query.(DeleteSecretsQueryOrphaned)
+			if !ok {
+				t.Fatalf("Unexpected query %v", test.db.query)
+			}
+			if age := time.Since(query.CreatedBefore); age < secretsGracePeriod {
+				t.Errorf("Expected grace period to be applied, got %v", age)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+const (
+	// sessionActivityInterval limits how often the last seen value of a
+	// session is written, so not each request causes a database write
+	sessionActivityInterval = time.Minute
+	maxUserAgentLength      = 255
+)
+
+func (p *persistenceLayer) CreateSession(accountUserID, userAgent string, ttl time.Duration) (string, error) {
+	sessionID, err := uuid.NewV4()
+	if err != nil {
+		return "", fmt.Errorf("persistence: error creating session id: %w", err)
+	}
+
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	now := time.Now()
+	// expired sessions are cleaned up whenever a new one is created so the
+	// table does not grow indefinitely
+	if _, err := p.dal.DeleteSessions(DeleteSessionsQueryExpired(now)); err != nil {
+		return "", fmt.Errorf("persistence: error deleting expired sessions: %w", err)
+	}
+
+	if err := p.dal.CreateSession(&Session{
+		SessionID:     sessionID.String(),
+		AccountUserID: accountUserID,
+		UserAgent:     userAgent,
+		Created:       now,
+		LastSeen:      now,
+		Expires:       now.Add(ttl),
+	}); err != nil {
+		return "", fmt.Errorf("persistence: error persisting session: %w", err)
+	}
+	return sessionID.String(), nil
+}
+
+func (p *persistenceLayer) ValidateSession(accountUserID, sessionID string) error {
+	session, err := p.findSession(accountUserID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if now.After(session.Expires) {
+		return fmt.Errorf("persistence: session %s has expired", sessionID)
+	}
+	if now.Sub(session.LastSeen) < sessionActivityInterval {
+		return nil
+	}
+	session.LastSeen = now
+	if err := p.dal.UpdateSession(session); err != nil {
+		return fmt.Errorf("persistence: error updating session: %w", err)
+	}
+	return nil
+}
+
+func (p *persistenceLayer) ListSessions(accountUserID string) ([]SessionResult, error) {
+	sessions, err := p.dal.FindSessions(FindSessionsQueryByAccountUserID(accountUserID))
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up sessions: %w", err)
+	}
+	now := time.Now()
+	result := []SessionResult{}
+	for _, session := range sessions {
+		if now.After(session.Expires) {
+			continue
+		}
+		result = append(result, SessionResult{
+			SessionID: session.SessionID,
+			UserAgent: session.UserAgent,
+			Created:   session.Created,
+			LastSeen:  session.LastSeen,
+			Expires:   session.Expires,
+		})
+	}
+	return result, nil
+}
+
+func (p *persistenceLayer) RevokeSession(accountUserID, sessionID string) error {
+	if _, err := p.findSession(accountUserID, sessionID); err != nil {
+		return err
+	}
+	if _, err := p.dal.DeleteSessions(DeleteSessionsQueryBySessionID(sessionID)); err != nil {
+		return fmt.Errorf("persistence: error deleting session: %w", err)
+	}
+	return nil
+}
+
+func (p *persistenceLayer) RevokeSessions(accountUserID string) error {
+	if _, err := p.dal.DeleteSessions(DeleteSessionsQueryByAccountUserID(accountUserID)); err != nil {
+		return fmt.Errorf("persistence: error deleting sessions: %w", err)
+	}
+	return nil
+}
+
+// findSession looks up the session of the given id, making sure it belongs
+// to the given account user.
+func (p *persistenceLayer) findSession(accountUserID, sessionID string) (*Session, error) {
+	if sessionID == "" {
+		return nil, errors.New("persistence: received empty session id")
+	}
+	sessions, err := p.dal.FindSessions(FindSessionsQueryBySessionID(sessionID))
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up session: %w", err)
+	}
+	if len(sessions) != 1 {
+		return nil, fmt.Errorf("persistence: session %s does not exist", sessionID)
+	}
+	if sessions[0].AccountUserID != accountUserID {
+		return nil, fmt.Errorf("persistence: session %s does not belong to account user %s", sessionID, accountUserID)
+	}
+	return &sessions[0], nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type mockSessionsDatabase struct {
+	DataAccessLayer
+	findSessionsResult []Session
+	findSessionsErr    error
+	updated            *Session
+	deleted            interface{}
+}
+
+func (m *mockSessionsDatabase) FindSessions(interface{}) ([]Session, error) {
+	return m.findSessionsResult, m.findSessionsErr
+}
+
+func (m *mockSessionsDatabase) UpdateSession(s *Session) error {
+	m.updated = s
+	return nil
+}
+
+func (m *mockSessionsDatabase) DeleteSessions(q interface{}) (int64, error) {
+	m.deleted = q
+	return 1, nil
+}
+
+func TestPersistenceLayer_ValidateSession(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name          string
+		dal           *mockSessionsDatabase
+		sessionID     string
+		expectError   bool
+		expectUpdated bool
+	}{
+		{
+			"empty session id",
+			&mockSessionsDatabase{},
+			"",
+			true,
+			false,
+		},
+		{
+			"lookup error",
+			&mockSessionsDatabase{
+				findSessionsErr: errors.New("did not work"),
+			},
+			"session-a",
+			true,
+			false,
+		},
+		{
+			"unknown session",
+			&mockSessionsDatabase{
+				findSessionsResult: []Session{},
+			},
+			"session-a",
+			true,
+			false,
+		},
+		{
+			"other account user",
+			&mockSessionsDatabase{
+				findSessionsResult: []Session{
+					{SessionID: "session-a", AccountUserID: "account-user-b", LastSeen: now, Expires: now.Add(time.Hour)},
+				},
+			},
+			"session-a",
+			true,
+			false,
+		},
+		{
+			"expired",
+			&mockSessionsDatabase{
+				findSessionsResult: []Session{
+					{SessionID: "session-a", AccountUserID: "account-user-a", LastSeen: now, Expires: now.Add(-time.Hour)},
+				},
+			},
+			"session-a",
+			true,
+			false,
+		},
+		{
+			"ok recently seen",
+			&mockSessionsDatabase{
+				findSessionsResult: []Session{
+					{SessionID: "session-a", AccountUserID: "account-user-a", LastSeen: now, Expires: now.Add(time.Hour)},
+				},
+			},
+			"session-a",
+			false,
+			false,
+		},
+		{
+			"ok update last seen",
+			&mockSessionsDatabase{
+				findSessionsResult: []Session{
+					{SessionID: "session-a", AccountUserID: "account-user-a", LastSeen: now.Add(-time.Hour), Expires: now.Add(time.Hour)},
+				},
+			},
+			"session-a",
+			false,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &persistenceLayer{dal: test.dal}
+			err := p.ValidateSession("account-user-a", test.sessionID)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if (test.dal.updated != nil) != test.expectUpdated {
+				t.Errorf("Unexpected update %v", test.dal.updated)
+			}
+		})
+	}
+}
+
+func TestPersistenceLayer_RevokeSession(t *testing.T) {
+	t.Run("other account user", func(t *testing.T) {
+		dal := &mockSessionsDatabase{
+			findSessionsResult: []Session{
+				{SessionID: "session-a", AccountUserID: "account-user-b"},
+			},
+		}
+		p := &persistenceLayer{dal: dal}
+		if err := p.RevokeSession("account-user-a", "session-a"); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if dal.deleted != nil {
+			t.Errorf("Unexpected deletion %v", dal.deleted)
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		dal := &mockSessionsDatabase{
+			findSessionsResult: []Session{
+				{SessionID: "session-a", AccountUserID: "account-user-a"},
+			},
+		}
+		p := &persistenceLayer{dal: dal}
+		if err := p.RevokeSession("account-user-a", "session-a"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if dal.deleted != DeleteSessionsQueryBySessionID("session-a") {
+			t.Errorf("Unexpected deletion %v", dal.deleted)
+		}
+	})
+}
@@ -0,0 +1,46 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+
+	"github.com/offen/offen/server/keys"
+)
+
+// maxEncryptedSettingsSize is the maximum size in bytes of the encrypted
+// settings that can be stored for a single account.
+const maxEncryptedSettingsSize = 64 * 1024
+
+func validateEncryptedSettings(encryptedSettings string) error {
+	if len(encryptedSettings) > maxEncryptedSettingsSize {
+		return ErrInvalidSettings(fmt.Sprintf("persistence: settings cannot exceed %d bytes", maxEncryptedSettingsSize))
+	}
+	if !keys.IsVersionedCipher(encryptedSettings) {
+		return ErrInvalidSettings("persistence: settings are expected to be encrypted")
+	}
+	return nil
+}
+
+// SetAccountSettings replaces the encrypted settings of the account with the
+// given id. Settings are encrypted by clients before being sent, so the server
+// only checks they look like a ciphertext. Passing an empty string clears
+// the settings.
+func (p *persistenceLayer) SetAccountSettings(accountID, encryptedSettings string) error {
+	if encryptedSettings != "" {
+		if err := validateEncryptedSettings(encryptedSettings); err != nil {
+			return err
+		}
+	}
+	account, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account %s: %w", accountID, err)
+	}
+	account.EncryptedSettings = encryptedSettings
+	if err := p.dal.UpdateAccount(&account); err != nil {
+		return fmt.Errorf("persistence: error updating settings of account %s: %w", accountID, err)
+	}
+	p.publishAccountChange(AccountChange{AccountID: accountID, Reason: AccountChangeSettings})
+	return nil
+}
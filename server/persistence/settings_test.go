@@ -0,0 +1,84 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPersistenceLayer_SetAccountSettings(t *testing.T) {
+	tests := []struct {
+		name             string
+		db               *mockAccountDomainsDatabase
+		settings         string
+		expectError      bool
+		expectedSettings string
+	}{
+		{
+			"lookup error",
+			&mockAccountDomainsDatabase{
+				findAccountErr: ErrUnknownAccount("did not work"),
+			},
+			"{1,} YWJj eHl6",
+			true,
+			"",
+		},
+		{
+			"plaintext",
+			&mockAccountDomainsDatabase{},
+			`{"allowlist":["PAGEVIEW"]}`,
+			true,
+			"",
+		},
+		{
+			"too large",
+			&mockAccountDomainsDatabase{},
+			"{1,} " + strings.Repeat("a", maxEncryptedSettingsSize),
+			true,
+			"",
+		},
+		{
+			"update error",
+			&mockAccountDomainsDatabase{
+				updateErr: errors.New("did not work"),
+			},
+			"{1,} YWJj eHl6",
+			true,
+			"{1,} YWJj eHl6",
+		},
+		{
+			"ok",
+			&mockAccountDomainsDatabase{},
+			"{1,} YWJj eHl6",
+			false,
+			"{1,} YWJj eHl6",
+		},
+		{
+			"reset",
+			&mockAccountDomainsDatabase{
+				account: Account{EncryptedSettings: "{1,} YWJj eHl6"},
+			},
+			"",
+			false,
+			"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &persistenceLayer{dal: test.db}
+			err := p.SetAccountSettings("account-a", test.settings)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if test.db.updated == nil {
+				return
+			}
+			if test.db.updated.EncryptedSettings != test.expectedSettings {
+				t.Errorf("Expected %s, got %s", test.expectedSettings, test.db.updated.EncryptedSettings)
+			}
+		})
+	}
+}
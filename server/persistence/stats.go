@@ -0,0 +1,75 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/oklog/ulid"
+)
+
+// GetAccountStats returns statistics about the account of the given id. All
+// values are derived from metadata only, so no event has to be decrypted
+// for computing them. Events are counted by the database, so no event has to
+// be loaded either.
+func (p *persistenceLayer) GetAccountStats(accountID string) (AccountStatsResult, error) {
+	account, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return AccountStatsResult{}, fmt.Errorf("persistence: error looking up account: %w", err)
+	}
+
+	totals, err := p.dal.CountEvents(CountEventsQueryByAccountID(accountID))
+	if err != nil {
+		return AccountStatsResult{}, fmt.Errorf("persistence: error counting events: %w", err)
+	}
+
+	result := AccountStatsResult{
+		AccountID:    accountID,
+		EventsPerDay: map[string]int{},
+	}
+	today := quotaDay(time.Now())
+	if len(totals) == 0 || totals[0].Events == 0 {
+		result.Quota = p.quotaResult(account, 0)
+		return result, nil
+	}
+	total := totals[0]
+	result.TotalEvents = int(total.Events)
+	result.DistinctUsers = int(total.DistinctUsers)
+	result.OldestEventID = total.OldestEventID
+	result.NewestEventID = total.NewestEventID
+
+	// events are expected to use ULIDs as identifiers, but in case a malformed
+	// one is found, it is still counted towards the total
+	oldest, oldestErr := ulid.Parse(total.OldestEventID)
+	newest, newestErr := ulid.Parse(total.NewestEventID)
+	if oldestErr == nil && newestErr == nil {
+		from := ulid.Time(oldest.Time()).UTC().Truncate(time.Hour * 24)
+		boundaries := bucketBoundaries(from, ulid.Time(newest.Time()), time.Hour*24)
+		counts, err := p.dal.CountEvents(CountEventsQueryByAccountIDInBuckets{
+			AccountID:  accountID,
+			Boundaries: boundaries,
+		})
+		if err != nil {
+			return AccountStatsResult{}, fmt.Errorf("persistence: error counting events per day: %w", err)
+		}
+		for _, count := range counts {
+			day := from.Add(time.Duration(count.Bucket) * time.Hour * 24)
+			result.EventsPerDay[day.Format("2006-01-02")] = int(count.Events)
+		}
+	}
+	result.Quota = p.quotaResult(account, result.EventsPerDay[today.Format("2006-01-02")])
+	return result, nil
+}
+
+// bucketBoundaries returns the event id boundaries of buckets of the given
+// size, starting at from, so that the last bucket contains until.
+func bucketBoundaries(from, until time.Time, size time.Duration) []string {
+	boundaries := []string{eventIDBoundary(from)}
+	for start := from; !start.After(until); {
+		start = start.Add(size)
+		boundaries = append(boundaries, eventIDBoundary(start))
+	}
+	return boundaries
+}
@@ -0,0 +1,146 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type mockGetAccountStatsDatabase struct {
+	DataAccessLayer
+	findAccountErr error
+	events         []Event
+	countEventsErr error
+}
+
+func (m *mockGetAccountStatsDatabase) FindAccount(q interface{}) (Account, error) {
+	return Account{}, m.findAccountErr
+}
+
+func (m *mockGetAccountStatsDatabase) CountEvents(q interface{}) ([]EventCount, error) {
+	if m.countEventsErr != nil {
+		return nil, m.countEventsErr
+	}
+	return mockCountEvents(m.events, q), nil
+}
+
+// mockCountEvents counts the given events like the database would do.
+func mockCountEvents(events []Event, q interface{}) []EventCount {
+	bucketOf := func(evt Event) (int, bool) { return 0, true }
+	if query, ok := q.(CountEventsQueryByAccountIDInBuckets); ok {
+		bucketOf = func(evt Event) (int, bool) {
+			for i := 0; i < len(query.Boundaries)-1; i++ {
+				if evt.EventID >= query.Boundaries[i] && evt.EventID < query.Boundaries[i+1] {
+					return i, true
+				}
+			}
+			return 0, false
+		}
+	}
+	counts := map[int]*EventCount{}
+	users := map[int]map[string]bool{}
+	var result []EventCount
+	for _, evt := range events {
+		bucket, ok := bucketOf(evt)
+		if !ok {
+			continue
+		}
+		count, ok := counts[bucket]
+		if !ok {
+			count = &EventCount{Bucket: bucket, OldestEventID: evt.EventID}
+			counts[bucket] = count
+			users[bucket] = map[string]bool{}
+		}
+		count.Events++
+		count.PayloadBytes += int64(len(evt.Payload))
+		if evt.SecretID != nil && !users[bucket][*evt.SecretID] {
+			users[bucket][*evt.SecretID] = true
+			count.DistinctUsers++
+		}
+		if evt.EventID < count.OldestEventID {
+			count.OldestEventID = evt.EventID
+		}
+		if evt.EventID > count.NewestEventID {
+			count.NewestEventID = evt.EventID
+		}
+	}
+	for i := 0; len(result) < len(counts); i++ {
+		if count, ok := counts[i]; ok {
+			result = append(result, *count)
+		}
+	}
+	return result
+}
+
+func TestPersistenceLayer_GetAccountStats(t *testing.T) {
+	tests := []struct {
+		name           string
+		dal            *mockGetAccountStatsDatabase
+		expectedResult AccountStatsResult
+		expectError    bool
+	}{
+		{
+			"account lookup error",
+			&mockGetAccountStatsDatabase{
+				findAccountErr: errors.New("did not work"),
+			},
+			AccountStatsResult{},
+			true,
+		},
+		{
+			"events lookup error",
+			&mockGetAccountStatsDatabase{
+				countEventsErr: errors.New("did not work"),
+			},
+			AccountStatsResult{},
+			true,
+		},
+		{
+			"empty",
+			&mockGetAccountStatsDatabase{},
+			AccountStatsResult{
+				AccountID:    "account-a",
+				EventsPerDay: map[string]int{},
+			},
+			false,
+		},
+		{
+			"ok",
+			&mockGetAccountStatsDatabase{
+				events: []Event{
+					{EventID: "01DZZ0R300000000000000000A", SecretID: strptr("user-a")},
+					{EventID: "01DZZ0R300000000000000000B", SecretID: strptr("user-b")},
+					{EventID: "01E01K4T00000000000000000C", SecretID: strptr("user-a")},
+					{EventID: "01E01K4T00000000000000000D"},
+				},
+			},
+			AccountStatsResult{
+				AccountID:   "account-a",
+				TotalEvents: 4,
+				EventsPerDay: map[string]int{
+					"2020-02-01": 2,
+					"2020-02-02": 2,
+				},
+				DistinctUsers: 2,
+				OldestEventID: "01DZZ0R300000000000000000A",
+				NewestEventID: "01E01K4T00000000000000000D",
+			},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &persistenceLayer{dal: test.dal}
+			result, err := p.GetAccountStats("account-a")
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if !reflect.DeepEqual(test.expectedResult, result) {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
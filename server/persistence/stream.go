@@ -0,0 +1,173 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+	"sort"
+)
+
+// EventsStream yields the events matched by a query. Events are read from the
+// database in pages while iterating, so they never have to be held in memory
+// at once.
+type EventsStream struct {
+	// Count is the number of events the stream yields. It is only known
+	// upfront for streams created by StreamQuery or NewEventsStream.
+	Count    int
+	each     func(fn func(accountID string, evt EventResult) error) error
+	sequence string
+	secrets  EncryptedSecretsByID
+}
+
+// NewEventsStream creates a stream yielding the given events that are
+// already held in memory.
+func NewEventsStream(events EventsByAccountID) *EventsStream {
+	// accounts are sorted so the stream yields a stable order
+	var accountIDs []string
+	var count int
+	for accountID, accountEvents := range events {
+		accountIDs = append(accountIDs, accountID)
+		count += len(accountEvents)
+	}
+	sort.Strings(accountIDs)
+	return &EventsStream{
+		Count: count,
+		each: func(fn func(string, EventResult) error) error {
+			for _, accountID := range accountIDs {
+				for _, evt := range events[accountID] {
+					if err := fn(accountID, evt); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// newDatabaseEventsStream creates a stream that reads the events matching the
+// given query from the database.
+func newDatabaseEventsStream(dal DataAccessLayer, query interface{}, includeSecrets bool) *EventsStream {
+	s := &EventsStream{}
+	s.each = func(fn func(string, EventResult) error) error {
+		return dal.StreamEvents(query, func(events []Event) error {
+			for _, evt := range events {
+				result := EventResult{
+					EventID: evt.EventID,
+					Payload: evt.Payload,
+				}
+				if includeSecrets {
+					result.SecretID = evt.SecretID
+					if evt.SecretID != nil {
+						if s.secrets == nil {
+							s.secrets = EncryptedSecretsByID{}
+						}
+						s.secrets[*evt.SecretID] = evt.Secret.EncryptedSecret
+					}
+				} else {
+					result.AccountID = evt.AccountID
+				}
+				s.sequence = getLatestSeq([]string{s.sequence, evt.Sequence})
+				if err := fn(evt.AccountID, result); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	return s
+}
+
+// Each calls fn for each event of the stream along with the id of the
+// account the event belongs to. Events are grouped by account.
+func (s *EventsStream) Each(fn func(accountID string, evt EventResult) error) error {
+	return s.each(fn)
+}
+
+// Complete adds the values that depend on all events that have been yielded
+// by Each, i.e. the latest sequence and the secrets of the users that have
+// sent them, to the given result.
+func (s *EventsStream) Complete(result *AccountResult) {
+	result.Sequence = getLatestSeq([]string{result.Sequence, s.sequence})
+	if len(s.secrets) != 0 {
+		result.Secrets = &s.secrets
+	}
+}
+
+// StreamQuery works like Query, but returns a stream for the matching events
+// instead of adding them to the result. The latest sequence of the result is
+// computed before streaming and the stream only yields events up to this
+// sequence, so a result always matches its sequence.
+func (p *persistenceLayer) StreamQuery(query Query) (EventsResult, *EventsStream, error) {
+	hashedUserIDs, err := p.querySecretIDs(query.UserID)
+	if err != nil {
+		return EventsResult{}, nil, err
+	}
+
+	reads := p.reads()
+	counts, err := reads.CountEvents(CountEventsQueryForSecretIDs{
+		SecretIDs: hashedUserIDs,
+		Since:     query.Since,
+	})
+	if err != nil {
+		return EventsResult{}, nil, fmt.Errorf("persistence: error counting events: %w", err)
+	}
+	var total int
+	seqs := []string{}
+	for _, count := range counts {
+		total += int(count.Events)
+		seqs = append(seqs, count.NewestSequence)
+	}
+	stream := newDatabaseEventsStream(reads, StreamEventsQueryForSecretIDs{
+		SecretIDs: hashedUserIDs,
+		Since:     query.Since,
+		Until:     getLatestSeq(seqs),
+	}, false)
+	stream.Count = total
+
+	out := EventsResult{}
+	if query.Since != "" {
+		pruned, err := reads.FindTombstones(FindTombstonesQueryBySecrets{
+			SecretIDs: hashedUserIDs,
+			Since:     query.Since,
+		})
+		if err != nil {
+			return EventsResult{}, nil, fmt.Errorf("persistence: error finding deleted events: %w", err)
+		}
+		for _, tombstone := range pruned {
+			out.DeletedEvents = append(out.DeletedEvents, tombstone.EventID)
+			seqs = append(seqs, tombstone.Sequence)
+		}
+	}
+	out.Sequence = getLatestSeq(seqs)
+	return out, stream, nil
+}
+
+// StreamAccount works like GetAccount including events, but returns a stream
+// for the account's events instead of adding them to the result. Values that
+// depend on the events are added to the result by calling Complete on the
+// stream after all events have been read.
+func (p *persistenceLayer) StreamAccount(accountID, eventsSince string) (AccountResult, *EventsStream, error) {
+	reads := p.reads()
+	account, err := reads.FindAccount(FindAccountQueryByID(accountID))
+	if err != nil {
+		return AccountResult{}, nil, fmt.Errorf("persistence: error looking up account data: %w", err)
+	}
+	result, err := accountResult(account, true)
+	if err != nil {
+		return AccountResult{}, nil, err
+	}
+	if eventsSince != "" {
+		deleted, seqs, err := p.deletedAccountEvents(reads, accountID, eventsSince)
+		if err != nil {
+			return AccountResult{}, nil, err
+		}
+		result.DeletedEvents = deleted
+		result.Sequence = getLatestSeq(seqs)
+	}
+	return result, newDatabaseEventsStream(reads, StreamEventsQueryByAccountID{
+		AccountID: accountID,
+		Since:     eventsSince,
+	}, true), nil
+}
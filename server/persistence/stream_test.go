@@ -0,0 +1,170 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type mockStreamEventsDatabase struct {
+	DataAccessLayer
+	accounts   []Account
+	events     []Event
+	tombstones []Tombstone
+	streamErr  error
+	queries    []interface{}
+}
+
+func (m *mockStreamEventsDatabase) FindAccounts(interface{}) ([]Account, error) {
+	return m.accounts, nil
+}
+
+func (m *mockStreamEventsDatabase) FindAccount(interface{}) (Account, error) {
+	return m.accounts[0], nil
+}
+
+func (m *mockStreamEventsDatabase) FindTombstones(interface{}) ([]Tombstone, error) {
+	return m.tombstones, nil
+}
+
+func (m *mockStreamEventsDatabase) CountEvents(q interface{}) ([]EventCount, error) {
+	m.queries = append(m.queries, q)
+	count := EventCount{Events: int64(len(m.events))}
+	for _, evt := range m.events {
+		count.NewestSequence = getLatestSeq([]string{count.NewestSequence, evt.Sequence})
+	}
+	return []EventCount{count}, nil
+}
+
+func (m *mockStreamEventsDatabase) StreamEvents(q interface{}, fn func([]Event) error) error {
+	m.queries = append(m.queries, q)
+	if m.streamErr != nil {
+		return m.streamErr
+	}
+	// events are yielded in pages of a single event
+	for _, evt := range m.events {
+		if err := fn([]Event{evt}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestPersistenceLayer_StreamQuery(t *testing.T) {
+	db := &mockStreamEventsDatabase{
+		accounts: []Account{
+			{AccountID: "account-a", UserSalt: "LEWtq55DKObqPK+XEQbnZA=="},
+			{AccountID: "account-b", UserSalt: "kxwkHp6yPBd0tQ85XlayDg=="},
+		},
+		events: []Event{
+			{AccountID: "account-a", EventID: "event-a", Sequence: "sequence-a", Payload: "payload-a"},
+			{AccountID: "account-b", EventID: "event-b", Sequence: "sequence-c", Payload: "payload-b"},
+		},
+		tombstones: []Tombstone{
+			{EventID: "event-z", Sequence: "sequence-b"},
+		},
+	}
+	p := &persistenceLayer{dal: db}
+	result, stream, err := p.StreamQuery(Query{UserID: "user-a", Since: "sequence-0"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(EventsResult{DeletedEvents: []string{"event-z"}, Sequence: "sequence-c"}, result) {
+		t.Errorf("Unexpected result %v", result)
+	}
+	if stream.Count != 2 {
+		t.Errorf("Unexpected count %d", stream.Count)
+	}
+
+	var events []EventResult
+	if err := stream.Each(func(accountID string, evt EventResult) error {
+		if accountID != evt.AccountID {
+			t.Errorf("Unexpected account id %s for %v", accountID, evt)
+		}
+		events = append(events, evt)
+		return nil
+	}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !reflect.DeepEqual([]EventResult{
+		{AccountID: "account-a", EventID: "event-a", Payload: "payload-a"},
+		{AccountID: "account-b", EventID: "event-b", Payload: "payload-b"},
+	}, events) {
+		t.Errorf("Unexpected events %v", events)
+	}
+	query, ok := db.queries[len(db.queries)-1].(StreamEventsQueryForSecretIDs)
+	if !ok || len(query.SecretIDs) != 2 || query.Since != "sequence-0" || query.Until != "sequence-c" {
+		t.Errorf("Unexpected query %v", db.queries[len(db.queries)-1])
+	}
+
+	db.streamErr = errors.New("did not work")
+	if err := stream.Each(func(string, EventResult) error { return nil }); err == nil {
+		t.Error("Expected error when streaming fails")
+	}
+}
+
+func TestPersistenceLayer_StreamAccount(t *testing.T) {
+	db := &mockStreamEventsDatabase{
+		accounts: []Account{
+			{AccountID: "account-a", PublicKey: `{"kty":"RSA","n":"abc","e":"AQAB"}`},
+		},
+		events: []Event{
+			{AccountID: "account-a", EventID: "event-a", Sequence: "sequence-a", Payload: "payload-a", SecretID: strptr("user-a"), Secret: Secret{EncryptedSecret: "secret-a"}},
+			{AccountID: "account-a", EventID: "event-b", Sequence: "sequence-c", Payload: "payload-b"},
+		},
+		tombstones: []Tombstone{
+			{EventID: "event-z", Sequence: "sequence-b"},
+		},
+	}
+	p := &persistenceLayer{dal: db}
+	result, stream, err := p.StreamAccount("account-a", "event-0")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if result.AccountID != "account-a" || result.Sequence != "sequence-b" || !reflect.DeepEqual([]string{"event-z"}, result.DeletedEvents) {
+		t.Errorf("Unexpected result %v", result)
+	}
+
+	var events []EventResult
+	if err := stream.Each(func(accountID string, evt EventResult) error {
+		events = append(events, evt)
+		return nil
+	}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !reflect.DeepEqual([]EventResult{
+		{SecretID: strptr("user-a"), EventID: "event-a", Payload: "payload-a"},
+		{EventID: "event-b", Payload: "payload-b"},
+	}, events) {
+		t.Errorf("Unexpected events %v", events)
+	}
+
+	stream.Complete(&result)
+	if result.Sequence != "sequence-c" {
+		t.Errorf("Unexpected sequence %v", result.Sequence)
+	}
+	if result.Secrets == nil || !reflect.DeepEqual(EncryptedSecretsByID{"user-a": "secret-a"}, *result.Secrets) {
+		t.Errorf("Unexpected secrets %v", result.Secrets)
+	}
+}
+
+func TestNewEventsStream(t *testing.T) {
+	stream := NewEventsStream(EventsByAccountID{
+		"account-b": []EventResult{{EventID: "event-c"}},
+		"account-a": []EventResult{{EventID: "event-a"}, {EventID: "event-b"}},
+	})
+	if stream.Count != 3 {
+		t.Errorf("Unexpected count %d", stream.Count)
+	}
+	var ids []string
+	stream.Each(func(accountID string, evt EventResult) error {
+		ids = append(ids, accountID+"/"+evt.EventID)
+		return nil
+	})
+	if !reflect.DeepEqual([]string{"account-a/event-a", "account-a/event-b", "account-b/event-c"}, ids) {
+		t.Errorf("Unexpected order %v", ids)
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// syncBatchSize is the maximum number of events contained in a single
+// change set.
+const syncBatchSize = 1000
+
+// syncLag is subtracted from the current time when determining the upper
+// bound of a change set. Sequences are created before the event is committed,
+// so this ensures events in transactions that are still pending are not
+// skipped by a replica.
+const syncLag = time.Second * 10
+
+// ChangesSince returns all changes recorded after the given watermark. Passing
+// an empty watermark returns changes from the very beginning. The watermark is
+// the sequence of the last change, which is updated each time an event is
+// written. Event ids cannot be used for this, as events that are moved to a
+// new id keep the time of their original id.
+func (p *persistenceLayer) ChangesSince(watermark string) (ChangeSet, error) {
+	until, err := EventIDAt(time.Now().Add(-syncLag))
+	if err != nil {
+		return ChangeSet{}, fmt.Errorf("persistence: error determining upper bound for changes: %w", err)
+	}
+	result := ChangeSet{
+		Accounts:   []Account{},
+		Secrets:    []Secret{},
+		Events:     []Event{},
+		Tombstones: []Tombstone{},
+		Watermark:  watermark,
+	}
+	if watermark >= until {
+		return result, nil
+	}
+
+	accounts, err := p.dal.FindAccounts(FindAccountsQueryAllAccounts{})
+	if err != nil {
+		return ChangeSet{}, fmt.Errorf("persistence: error looking up accounts: %w", err)
+	}
+	result.Accounts = append(result.Accounts, accounts...)
+
+	// one more event than fits into the batch is requested so it is known
+	// whether the batch is complete
+	events, err := p.dal.FindEvents(FindEventsQueryInRange{
+		Since: watermark,
+		Until: until,
+		Limit: syncBatchSize + 1,
+	})
+	if err != nil {
+		return ChangeSet{}, fmt.Errorf("persistence: error looking up events: %w", err)
+	}
+	// in case more events are pending, the change set ends at the last event
+	// so tombstones are not skipped. Events that have been written in the
+	// same batch share a sequence, so the change set needs to contain all or
+	// none of them.
+	if len(events) > syncBatchSize {
+		result.More = true
+		next := events[syncBatchSize].Sequence
+		events = events[:syncBatchSize]
+		for len(events) > 0 && events[len(events)-1].Sequence == next {
+			events = events[:len(events)-1]
+		}
+		if len(events) > 0 {
+			until = events[len(events)-1].Sequence
+		} else {
+			until = next
+			events, err = p.dal.FindEvents(FindEventsQueryInRange{
+				Since: watermark,
+				Until: until,
+			})
+			if err != nil {
+				return ChangeSet{}, fmt.Errorf("persistence: error looking up events: %w", err)
+			}
+		}
+	}
+
+	secrets := map[string]bool{}
+	for _, evt := range events {
+		if evt.SecretID != nil && evt.Secret.SecretID != "" && !secrets[*evt.SecretID] {
+			secrets[*evt.SecretID] = true
+			result.Secrets = append(result.Secrets, evt.Secret)
+		}
+		evt.Secret = Secret{}
+		result.Events = append(result.Events, evt)
+	}
+
+	tombstones, err := p.dal.FindTombstones(FindTombstonesQueryInRange{
+		Since: watermark,
+		Until: until,
+	})
+	if err != nil {
+		return ChangeSet{}, fmt.Errorf("persistence: error looking up tombstones: %w", err)
+	}
+	result.Tombstones = append(result.Tombstones, tombstones...)
+	result.Watermark = until
+	return result, nil
+}
+
+// Replicate pulls all changes from the primary instance of the given URL
+// using pull and applies them, starting from the watermark recorded by the
+// previous run. It returns the number of events that have been added.
+func (p *persistenceLayer) Replicate(primaryURL string, pull func(watermark string) (ChangeSet, error)) (int, error) {
+	state, err := p.dal.FindSyncState(FindSyncStateQueryByPrimary(primaryURL))
+	if err != nil {
+		return 0, fmt.Errorf("persistence: error looking up sync state: %w", err)
+	}
+
+	var eventsAdded int
+	for {
+		changes, err := pull(state.Watermark)
+		if err != nil {
+			return eventsAdded, fmt.Errorf("persistence: error pulling changes from primary: %w", err)
+		}
+		if changes.Watermark < state.Watermark {
+			return eventsAdded, fmt.Errorf("persistence: primary returned watermark %s older than %s", changes.Watermark, state.Watermark)
+		}
+		added, err := p.applyChanges(&state, changes)
+		if err != nil {
+			return eventsAdded, err
+		}
+		eventsAdded += added
+		if !changes.More {
+			return eventsAdded, nil
+		}
+	}
+}
+
+// applyChanges applies the given change set and advances the given sync state
+// in a single transaction. Records that already exist are skipped, so
+// applying the same change set twice is safe. Secrets are the exception, as
+// users re-sending their secret replace it using the same id.
+func (p *persistenceLayer) applyChanges(state *SyncState, changes ChangeSet) (int, error) {
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return 0, fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+
+	for _, account := range changes.Accounts {
+		account.Events = nil
+		_, err := txn.FindAccount(FindAccountQueryByID(account.AccountID))
+		if err == nil {
+			err = txn.UpdateAccount(&account)
+		} else {
+			var unknownAccountErr ErrUnknownAccount
+			if !errors.As(err, &unknownAccountErr) {
+				txn.Rollback()
+				return 0, fmt.Errorf("persistence: error looking up account %s: %w", account.AccountID, err)
+			}
+			err = txn.CreateAccount(&account)
+		}
+		if err != nil {
+			txn.Rollback()
+			return 0, fmt.Errorf("persistence: error syncing account %s: %w", account.AccountID, err)
+		}
+	}
+
+	for _, secret := range changes.Secrets {
+		existing, err := txn.FindSecret(FindSecretQueryBySecretID(secret.SecretID))
+		if err == nil {
+			if existing.EncryptedSecret == secret.EncryptedSecret {
+				continue
+			}
+			if err := txn.DeleteSecret(DeleteSecretQueryBySecretID(secret.SecretID)); err != nil {
+				txn.Rollback()
+				return 0, fmt.Errorf("persistence: error deleting outdated secret: %w", err)
+			}
+		} else {
+			var unknownSecretErr ErrUnknownSecret
+			if !errors.As(err, &unknownSecretErr) {
+				txn.Rollback()
+				return 0, fmt.Errorf("persistence: error looking up secret: %w", err)
+			}
+		}
+		if err := txn.CreateSecret(&secret); err != nil {
+			txn.Rollback()
+			return 0, fmt.Errorf("persistence: error syncing secret: %w", err)
+		}
+	}
+
+	var eventIDs []string
+	for _, evt := range changes.Events {
+		eventIDs = append(eventIDs, evt.EventID)
+	}
+	known := map[string]bool{}
+	if len(eventIDs) != 0 {
+		existing, err := txn.FindEvents(FindEventsQueryByEventIDs(eventIDs))
+		if err != nil {
+			txn.Rollback()
+			return 0, fmt.Errorf("persistence: error looking up existing events: %w", err)
+		}
+		for _, evt := range existing {
+			known[evt.EventID] = true
+		}
+	}
+	var eventsAdded int
+	for _, evt := range changes.Events {
+		if known[evt.EventID] {
+			continue
+		}
+		evt.Secret = Secret{}
+		if err := txn.CreateEvent(&evt); err != nil {
+			txn.Rollback()
+			return 0, fmt.Errorf("persistence: error syncing event %s: %w", evt.EventID, err)
+		}
+		eventsAdded++
+	}
+
+	if len(changes.Tombstones) != 0 {
+		var deletedIDs []string
+		for _, tombstone := range changes.Tombstones {
+			deletedIDs = append(deletedIDs, tombstone.EventID)
+		}
+		if _, err := txn.DeleteEvents(DeleteEventsQueryByEventIDs(deletedIDs)); err != nil {
+			txn.Rollback()
+			return 0, fmt.Errorf("persistence: error deleting events: %w", err)
+		}
+		existing, err := txn.FindTombstones(FindTombstonesQueryInRange{
+			Since: state.Watermark,
+			Until: changes.Watermark,
+		})
+		if err != nil {
+			txn.Rollback()
+			return 0, fmt.Errorf("persistence: error looking up existing tombstones: %w", err)
+		}
+		knownTombstones := map[string]bool{}
+		for _, tombstone := range existing {
+			knownTombstones[tombstone.EventID] = true
+		}
+		for _, tombstone := range changes.Tombstones {
+			if knownTombstones[tombstone.EventID] {
+				continue
+			}
+			if err := txn.CreateTombstone(&tombstone); err != nil {
+				txn.Rollback()
+				return 0, fmt.Errorf("persistence: error syncing tombstone: %w", err)
+			}
+		}
+	}
+
+	next := *state
+	next.Watermark = changes.Watermark
+	next.Updated = time.Now().UTC()
+	if err := txn.UpdateSyncState(&next); err != nil {
+		txn.Rollback()
+		return 0, fmt.Errorf("persistence: error saving sync state: %w", err)
+	}
+
+	if err := txn.Commit(); err != nil {
+		return 0, fmt.Errorf("persistence: error committing transaction: %w", err)
+	}
+	for _, account := range changes.Accounts {
+		p.publishAccountChange(AccountChange{AccountID: account.AccountID, Reason: AccountChangeSynced})
+	}
+	*state = next
+	return eventsAdded, nil
+}
@@ -0,0 +1,349 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+type mockSyncDatabase struct {
+	DataAccessLayer
+	accounts   map[string]Account
+	secrets    map[string]Secret
+	events     map[string]Event
+	tombstones map[string]Tombstone
+	state      SyncState
+}
+
+func newMockSyncDatabase() *mockSyncDatabase {
+	return &mockSyncDatabase{
+		accounts:   map[string]Account{},
+		secrets:    map[string]Secret{},
+		events:     map[string]Event{},
+		tombstones: map[string]Tombstone{},
+	}
+}
+
+func (m *mockSyncDatabase) FindAccounts(interface{}) ([]Account, error) {
+	var result []Account
+	for _, account := range m.accounts {
+		result = append(result, account)
+	}
+	return result, nil
+}
+
+func (m *mockSyncDatabase) FindAccount(q interface{}) (Account, error) {
+	if account, ok := m.accounts[string(q.(FindAccountQueryByID))]; ok {
+		return account, nil
+	}
+	return Account{}, ErrUnknownAccount("not found")
+}
+
+func (m *mockSyncDatabase) CreateAccount(a *Account) error {
+	m.accounts[a.AccountID] = *a
+	return nil
+}
+
+func (m *mockSyncDatabase) UpdateAccount(a *Account) error {
+	m.accounts[a.AccountID] = *a
+	return nil
+}
+
+func (m *mockSyncDatabase) FindSecret(q interface{}) (Secret, error) {
+	if secret, ok := m.secrets[string(q.(FindSecretQueryBySecretID))]; ok {
+		return secret, nil
+	}
+	return Secret{}, ErrUnknownSecret("not found")
+}
+
+func (m *mockSyncDatabase) CreateSecret(s *Secret) error {
+	m.secrets[s.SecretID] = *s
+	return nil
+}
+
+func (m *mockSyncDatabase) DeleteSecret(q interface{}) error {
+	delete(m.secrets, string(q.(DeleteSecretQueryBySecretID)))
+	return nil
+}
+
+func (m *mockSyncDatabase) FindEvents(q interface{}) ([]Event, error) {
+	var result []Event
+	switch query := q.(type) {
+	case FindEventsQueryInRange:
+		for _, evt := range m.events {
+			if evt.Sequence > query.Since && evt.Sequence <= query.Until {
+				if evt.SecretID != nil {
+					evt.Secret = m.secrets[*evt.SecretID]
+				}
+				result = append(result, evt)
+			}
+		}
+		sort.Slice(result, func(i, j int) bool {
+			if result[i].Sequence == result[j].Sequence {
+				return result[i].EventID < result[j].EventID
+			}
+			return result[i].Sequence < result[j].Sequence
+		})
+		if query.Limit > 0 && len(result) > query.Limit {
+			result = result[:query.Limit]
+		}
+	case FindEventsQueryByEventIDs:
+		for _, eventID := range query {
+			if evt, ok := m.events[eventID]; ok {
+				result = append(result, evt)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (m *mockSyncDatabase) CreateEvent(e *Event) error {
+	if _, ok := m.events[e.EventID]; ok {
+		return errors.New("duplicate event")
+	}
+	m.events[e.EventID] = *e
+	return nil
+}
+
+func (m *mockSyncDatabase) DeleteEvents(q interface{}) (int64, error) {
+	var affected int64
+	for _, eventID := range q.(DeleteEventsQueryByEventIDs) {
+		if _, ok := m.events[eventID]; ok {
+			delete(m.events, eventID)
+			affected++
+		}
+	}
+	return affected, nil
+}
+
+func (m *mockSyncDatabase) FindTombstones(q interface{}) ([]Tombstone, error) {
+	query := q.(FindTombstonesQueryInRange)
+	var result []Tombstone
+	for _, tombstone := range m.tombstones {
+		if tombstone.Sequence > query.Since && tombstone.Sequence <= query.Until {
+			result = append(result, tombstone)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockSyncDatabase) CreateTombstone(t *Tombstone) error {
+	if _, ok := m.tombstones[t.EventID]; ok {
+		return errors.New("duplicate tombstone")
+	}
+	m.tombstones[t.EventID] = *t
+	return nil
+}
+
+func (m *mockSyncDatabase) FindSyncState(q interface{}) (SyncState, error) {
+	if m.state.PrimaryURL != string(q.(FindSyncStateQueryByPrimary)) {
+		return SyncState{PrimaryURL: string(q.(FindSyncStateQueryByPrimary))}, nil
+	}
+	return m.state, nil
+}
+
+func (m *mockSyncDatabase) UpdateSyncState(s *SyncState) error {
+	m.state = *s
+	return nil
+}
+
+func (m *mockSyncDatabase) Transaction() (Transaction, error) {
+	return &mockTxn{m}, nil
+}
+
+func TestPersistenceLayer_Replicate(t *testing.T) {
+	mustID := func(t time.Time) string {
+		id, _ := EventIDAt(t)
+		return id
+	}
+	now := time.Now()
+	first, second, third := mustID(now.Add(-time.Hour*3)), mustID(now.Add(-time.Hour*2)), mustID(now.Add(-time.Hour))
+	// events that are too recent are skipped until the next run
+	pending := mustID(now)
+
+	secretID := "secret-a"
+	primary := newMockSyncDatabase()
+	primary.accounts["account-a"] = Account{AccountID: "account-a", Name: "a"}
+	primary.secrets[secretID] = Secret{SecretID: secretID, EncryptedSecret: "encrypted"}
+	for _, eventID := range []string{first, second, third, pending} {
+		primary.events[eventID] = Event{EventID: eventID, Sequence: eventID, AccountID: "account-a", SecretID: &secretID, Payload: "payload"}
+	}
+	p := &persistenceLayer{dal: primary}
+
+	replica := newMockSyncDatabase()
+	replica.events[first] = primary.events[first]
+	r := &persistenceLayer{dal: replica}
+
+	var pulls []string
+	pull := func(watermark string) (ChangeSet, error) {
+		pulls = append(pulls, watermark)
+		return p.ChangesSince(watermark)
+	}
+
+	added, err := r.Replicate("https://primary.offen.dev", pull)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if added != 2 {
+		t.Errorf("Unexpected number of added events %d", added)
+	}
+	if _, ok := replica.events[pending]; ok {
+		t.Error("Expected pending event to be skipped")
+	}
+	if !reflect.DeepEqual(primary.accounts, replica.accounts) || !reflect.DeepEqual(primary.secrets, replica.secrets) {
+		t.Errorf("Unexpected replica state %v %v", replica.accounts, replica.secrets)
+	}
+	if replica.state.PrimaryURL != "https://primary.offen.dev" || replica.state.Watermark <= third {
+		t.Errorf("Unexpected sync state %v", replica.state)
+	}
+
+	// deleting an event on the primary replaces it with a tombstone
+	delete(primary.events, second)
+	primary.tombstones[second] = Tombstone{EventID: second, AccountID: "account-a", SecretID: &secretID, Sequence: mustID(now.Add(-time.Minute))}
+	primary.accounts["account-a"] = Account{AccountID: "account-a", Name: "renamed"}
+	// re-sending a secret replaces it using the same id
+	primary.secrets[secretID] = Secret{SecretID: secretID, EncryptedSecret: "re-encrypted"}
+	resent := mustID(now.Add(-time.Minute * 30))
+	primary.events[resent] = Event{EventID: resent, Sequence: resent, AccountID: "account-a", SecretID: &secretID, Payload: "payload"}
+	replica.state.Watermark = third
+
+	added, err = r.Replicate("https://primary.offen.dev", pull)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if added != 1 {
+		t.Errorf("Unexpected number of added events %d", added)
+	}
+	if replica.secrets[secretID].EncryptedSecret != "re-encrypted" {
+		t.Errorf("Expected secret to be updated, got %v", replica.secrets[secretID])
+	}
+	if _, ok := replica.events[second]; ok {
+		t.Error("Expected deleted event to be removed")
+	}
+	if _, ok := replica.tombstones[second]; !ok {
+		t.Error("Expected tombstone to be synced")
+	}
+	if replica.accounts["account-a"].Name != "renamed" {
+		t.Errorf("Expected account to be updated, got %v", replica.accounts["account-a"])
+	}
+	if len(pulls) != 2 || pulls[0] != "" || pulls[1] != third {
+		t.Errorf("Unexpected pulls %v", pulls)
+	}
+
+	t.Run("pull error", func(t *testing.T) {
+		_, err := r.Replicate("https://primary.offen.dev", func(string) (ChangeSet, error) {
+			return ChangeSet{}, errors.New("did not work")
+		})
+		if err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+	t.Run("watermark moving backwards", func(t *testing.T) {
+		_, err := r.Replicate("https://primary.offen.dev", func(string) (ChangeSet, error) {
+			return ChangeSet{Watermark: first}, nil
+		})
+		if err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+}
+
+func TestPersistenceLayer_ChangesSince(t *testing.T) {
+	now := time.Now().Add(-time.Hour)
+	db := newMockSyncDatabase()
+	var eventIDs []string
+	for i := 0; i < syncBatchSize+10; i++ {
+		eventID, _ := EventIDAt(now.Add(time.Duration(i) * time.Millisecond))
+		eventIDs = append(eventIDs, eventID)
+		db.events[eventID] = Event{EventID: eventID, Sequence: eventID, AccountID: "account-a"}
+	}
+	// this tombstone is newer than the last event of the first batch so it
+	// is expected to be part of the second one
+	tombstoneSequence, _ := EventIDAt(now.Add(time.Second * 10))
+	db.tombstones["event-z"] = Tombstone{EventID: "event-z", Sequence: tombstoneSequence}
+	p := &persistenceLayer{dal: db}
+
+	changes, err := p.ChangesSince("")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !changes.More || len(changes.Events) != syncBatchSize || changes.Watermark != eventIDs[syncBatchSize-1] || len(changes.Tombstones) != 0 {
+		t.Errorf("Unexpected first batch with %d events, watermark %s", len(changes.Events), changes.Watermark)
+	}
+
+	changes, err = p.ChangesSince(changes.Watermark)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if changes.More || len(changes.Events) != 10 || len(changes.Tombstones) != 1 {
+		t.Errorf("Unexpected second batch with %d events", len(changes.Events))
+	}
+}
+
+func TestPersistenceLayer_ChangesSince_MovedEvents(t *testing.T) {
+	now := time.Now()
+	db := newMockSyncDatabase()
+	original, _ := EventIDAt(now.Add(-time.Hour * 24))
+	watermark, _ := EventIDAt(now.Add(-time.Hour))
+	moved, _ := EventIDAt(now.Add(-time.Hour * 24))
+	sequence, _ := EventIDAt(now.Add(-time.Minute))
+	// the event has been moved after the replica has synced, so its id is
+	// older than the watermark while its sequence is not
+	db.events[moved] = Event{EventID: moved, Sequence: sequence, AccountID: "account-a"}
+	db.tombstones[original] = Tombstone{EventID: original, Sequence: sequence}
+	p := &persistenceLayer{dal: db}
+
+	changes, err := p.ChangesSince(watermark)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(changes.Events) != 1 || changes.Events[0].EventID != moved || len(changes.Tombstones) != 1 {
+		t.Errorf("Unexpected changes %v", changes)
+	}
+}
+
+func TestPersistenceLayer_ChangesSince_SharedSequence(t *testing.T) {
+	now := time.Now().Add(-time.Hour)
+	db := newMockSyncDatabase()
+	single, _ := EventIDAt(now)
+	db.events[single] = Event{EventID: single, Sequence: single}
+	// all of these have been written in a single batch which is larger than
+	// a change set
+	shared, _ := EventIDAt(now.Add(time.Second))
+	for i := 0; i < syncBatchSize+10; i++ {
+		eventID, _ := EventIDAt(now.Add(-time.Duration(i) * time.Millisecond))
+		eventID = eventID[:20] + fmt.Sprintf("%06d", i)
+		db.events[eventID] = Event{EventID: eventID, Sequence: shared}
+	}
+	p := &persistenceLayer{dal: db}
+
+	changes, err := p.ChangesSince("")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !changes.More || len(changes.Events) != 1 || changes.Watermark != single {
+		t.Errorf("Unexpected first batch with %d events, watermark %s", len(changes.Events), changes.Watermark)
+	}
+
+	changes, err = p.ChangesSince(changes.Watermark)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !changes.More || len(changes.Events) != syncBatchSize+10 || changes.Watermark != shared {
+		t.Errorf("Unexpected second batch with %d events, watermark %s", len(changes.Events), changes.Watermark)
+	}
+
+	changes, err = p.ChangesSince(changes.Watermark)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if changes.More || len(changes.Events) != 0 {
+		t.Errorf("Unexpected third batch with %d events", len(changes.Events))
+	}
+}
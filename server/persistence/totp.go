@@ -0,0 +1,207 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/offen/offen/server/keys"
+)
+
+// numRecoveryCodes is the number of recovery codes issued when enrolling
+// a TOTP secret.
+const numRecoveryCodes = 10
+
+func (p *persistenceLayer) EnrollTOTP(accountUserID, password, secret, code string) ([]string, error) {
+	accountUser, err := p.dal.FindAccountUser(
+		FindAccountUserQueryByAccountUserIDIncludeRelationships(accountUserID),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up account user: %w", err)
+	}
+	if err := keys.CompareString(password, accountUser.HashedPassword); err != nil {
+		return nil, fmt.Errorf("persistence: passwords did not match: %w", err)
+	}
+	if accountUser.TOTPSecret != "" {
+		return nil, errors.New("persistence: account user has already enrolled a totp secret")
+	}
+
+	step, ok, err := keys.ValidateTOTPStep(secret, code, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error validating totp code: %w", err)
+	} else if !ok {
+		return nil, errors.New("persistence: given totp code is not valid")
+	}
+	sealed, err := p.sealTOTPSecret(secret)
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error encrypting totp secret: %w", err)
+	}
+
+	var recoveryCodes, hashedRecoveryCodes []string
+	for i := 0; i < numRecoveryCodes; i++ {
+		recoveryCode, err := keys.GenerateRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("persistence: error generating recovery code: %w", err)
+		}
+		hashedCode, err := keys.HashString(recoveryCode)
+		if err != nil {
+			return nil, fmt.Errorf("persistence: error hashing recovery code: %w", err)
+		}
+		recoveryCodes = append(recoveryCodes, recoveryCode)
+		hashedRecoveryCodes = append(hashedRecoveryCodes, hashedCode.Marshal())
+	}
+
+	if err := accountUser.setHashedRecoveryCodes(hashedRecoveryCodes); err != nil {
+		return nil, fmt.Errorf("persistence: error setting recovery codes: %w", err)
+	}
+	accountUser.TOTPSecret = sealed
+	accountUser.TOTPLastStep = step
+	if err := p.dal.UpdateAccountUser(&accountUser); err != nil {
+		return nil, fmt.Errorf("persistence: error updating account user: %w", err)
+	}
+	return recoveryCodes, nil
+}
+
+func (p *persistenceLayer) VerifyTOTP(accountUserID, code string) error {
+	accountUser, err := p.dal.FindAccountUser(
+		FindAccountUserQueryByAccountUserIDIncludeRelationships(accountUserID),
+	)
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account user: %w", err)
+	}
+	return p.verifyTOTP(&accountUser, code)
+}
+
+func (p *persistenceLayer) DisableTOTP(accountUserID, password, code string) error {
+	accountUser, err := p.dal.FindAccountUser(
+		FindAccountUserQueryByAccountUserIDIncludeRelationships(accountUserID),
+	)
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account user: %w", err)
+	}
+	if err := keys.CompareString(password, accountUser.HashedPassword); err != nil {
+		return fmt.Errorf("persistence: passwords did not match: %w", err)
+	}
+	if err := p.verifyTOTP(&accountUser, code); err != nil {
+		return fmt.Errorf("persistence: error verifying totp code: %w", err)
+	}
+	accountUser.TOTPSecret = ""
+	accountUser.TOTPLastStep = 0
+	accountUser.HashedRecoveryCodes = ""
+	if err := p.dal.UpdateAccountUser(&accountUser); err != nil {
+		return fmt.Errorf("persistence: error updating account user: %w", err)
+	}
+	return nil
+}
+
+// verifyTOTP checks the given code against the account user's TOTP secret. In
+// case this fails, the code is checked against the remaining recovery codes.
+// Both TOTP codes and recovery codes can only be used once.
+func (p *persistenceLayer) verifyTOTP(accountUser *AccountUser, code string) error {
+	if accountUser.TOTPSecret == "" {
+		return nil
+	}
+	// in case the secret cannot be decrypted, e.g. because the instance's
+	// secret has changed, recovery codes can still be used
+	secret, sealed, openErr := p.openTOTPSecret(accountUser.TOTPSecret)
+	if openErr == nil {
+		step, ok, err := keys.ValidateTOTPStep(secret, code, time.Now())
+		if err != nil {
+			return fmt.Errorf("persistence: error validating totp code: %w", err)
+		}
+		if ok {
+			if step <= accountUser.TOTPLastStep {
+				return errors.New("persistence: given totp code has already been used")
+			}
+			accountUser.TOTPLastStep = step
+			// secrets that have been stored before a key has been configured
+			// are encrypted once they are used
+			if !sealed && p.totpKey != nil {
+				if accountUser.TOTPSecret, err = p.sealTOTPSecret(secret); err != nil {
+					return fmt.Errorf("persistence: error encrypting totp secret: %w", err)
+				}
+			}
+			if err := p.dal.UpdateAccountUser(accountUser); err != nil {
+				return fmt.Errorf("persistence: error persisting used totp code: %w", err)
+			}
+			return nil
+		}
+	}
+
+	hashedRecoveryCodes, err := accountUser.hashedRecoveryCodes()
+	if err != nil {
+		return fmt.Errorf("persistence: error reading recovery codes: %w", err)
+	}
+	code = strings.ToUpper(strings.TrimSpace(code))
+	for index, hashedCode := range hashedRecoveryCodes {
+		if err := keys.CompareString(code, hashedCode); err != nil {
+			continue
+		}
+		remaining := append(hashedRecoveryCodes[:index:index], hashedRecoveryCodes[index+1:]...)
+		if err := accountUser.setHashedRecoveryCodes(remaining); err != nil {
+			return fmt.Errorf("persistence: error updating recovery codes: %w", err)
+		}
+		if err := p.dal.UpdateAccountUser(accountUser); err != nil {
+			return fmt.Errorf("persistence: error persisting used recovery code: %w", err)
+		}
+		return nil
+	}
+	if openErr != nil {
+		return fmt.Errorf("persistence: error decrypting totp secret: %w", openErr)
+	}
+	return errors.New("persistence: given code did not match")
+}
+
+// sealTOTPSecret encrypts the given secret using the configured key.
+func (p *persistenceLayer) sealTOTPSecret(secret string) (string, error) {
+	if p.totpKey == nil {
+		return secret, nil
+	}
+	cipher, err := keys.EncryptWith(p.totpKey, []byte(secret))
+	if err != nil {
+		return "", err
+	}
+	return cipher.Marshal(), nil
+}
+
+// openTOTPSecret returns the plaintext version of the given stored secret and
+// whether it has been encrypted. Secrets stored before a key has been
+// configured are returned as is.
+func (p *persistenceLayer) openTOTPSecret(stored string) (string, bool, error) {
+	if keys.ValidateSymmetricCipher(stored) != nil {
+		return stored, false, nil
+	}
+	if p.totpKey == nil {
+		return "", true, errors.New("persistence: totp secret is encrypted but no key is configured")
+	}
+	secret, err := keys.DecryptWith(p.totpKey, stored)
+	if err != nil {
+		return "", true, err
+	}
+	return string(secret), true, nil
+}
+
+func (a *AccountUser) hashedRecoveryCodes() ([]string, error) {
+	if a.HashedRecoveryCodes == "" {
+		return nil, nil
+	}
+	var result []string
+	if err := json.Unmarshal([]byte(a.HashedRecoveryCodes), &result); err != nil {
+		return nil, fmt.Errorf("persistence: error decoding recovery codes: %w", err)
+	}
+	return result, nil
+}
+
+func (a *AccountUser) setHashedRecoveryCodes(codes []string) error {
+	b, err := json.Marshal(codes)
+	if err != nil {
+		return fmt.Errorf("persistence: error encoding recovery codes: %w", err)
+	}
+	a.HashedRecoveryCodes = string(b)
+	return nil
+}
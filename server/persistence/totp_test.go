@@ -0,0 +1,190 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/keys"
+)
+
+// totpCodeAt computes the TOTP code for the given secret as an authenticator
+// app would do.
+func totpCodeAt(secret string, t time.Time) string {
+	key, _ := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(t.Unix()/int64(keys.TOTPPeriod.Seconds())))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+type mockTOTPDatabase struct {
+	DataAccessLayer
+	findAccountUserResult AccountUser
+	findAccountUserErr    error
+	updateAccountUserErr  error
+	updated               *AccountUser
+}
+
+func (m *mockTOTPDatabase) FindAccountUser(interface{}) (AccountUser, error) {
+	return m.findAccountUserResult, m.findAccountUserErr
+}
+
+func (m *mockTOTPDatabase) UpdateAccountUser(a *AccountUser) error {
+	m.updated = a
+	return m.updateAccountUserErr
+}
+
+func TestPersistenceLayer_EnrollTOTP(t *testing.T) {
+	secret, _ := keys.GenerateTOTPSecret()
+	accountUser, _ := newAccountUser("foo@bar.com", "secret", 0)
+	tests := []struct {
+		name        string
+		dal         *mockTOTPDatabase
+		password    string
+		code        string
+		expectError bool
+	}{
+		{
+			"lookup error",
+			&mockTOTPDatabase{
+				findAccountUserErr: errors.New("did not work"),
+			},
+			"secret",
+			"",
+			true,
+		},
+		{
+			"bad password",
+			&mockTOTPDatabase{
+				findAccountUserResult: *accountUser,
+			},
+			"other",
+			"",
+			true,
+		},
+		{
+			"bad code",
+			&mockTOTPDatabase{
+				findAccountUserResult: *accountUser,
+			},
+			"secret",
+			"000000!",
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &persistenceLayer{dal: test.dal}
+			_, err := p.EnrollTOTP("account-user-id", test.password, secret, test.code)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+		})
+	}
+	t.Run("ok", func(t *testing.T) {
+		key, _ := keys.GenerateRandomBytes(32)
+		dal := &mockTOTPDatabase{findAccountUserResult: *accountUser}
+		p := &persistenceLayer{dal: dal, totpKey: key}
+		codes, err := p.EnrollTOTP("account-user-id", "secret", secret, totpCodeAt(secret, time.Now()))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(codes) != numRecoveryCodes {
+			t.Errorf("Unexpected recovery codes %v", codes)
+		}
+		if dal.updated.TOTPSecret == secret {
+			t.Error("Expected totp secret to be encrypted")
+		}
+		if dal.updated.TOTPLastStep == 0 {
+			t.Error("Expected time step of enrollment code to be stored")
+		}
+		// the code used for enrolling cannot be used for logging in
+		if err := p.verifyTOTP(dal.updated, totpCodeAt(secret, time.Now())); err == nil {
+			t.Error("Expected error when reusing enrollment code")
+		}
+	})
+}
+
+func TestPersistenceLayer_verifyTOTP(t *testing.T) {
+	secret, _ := keys.GenerateTOTPSecret()
+	hashedCode, _ := keys.HashString("RECOVERY")
+
+	t.Run("not enrolled", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockTOTPDatabase{}}
+		if err := p.verifyTOTP(&AccountUser{}, ""); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	})
+	t.Run("bad code", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockTOTPDatabase{}}
+		a := &AccountUser{TOTPSecret: secret}
+		a.setHashedRecoveryCodes([]string{hashedCode.Marshal()})
+		if err := p.verifyTOTP(a, "123"); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+	t.Run("reused code", func(t *testing.T) {
+		key, _ := keys.GenerateRandomBytes(32)
+		dal := &mockTOTPDatabase{}
+		p := &persistenceLayer{dal: dal, totpKey: key}
+		// secrets stored before a key has been configured are encrypted
+		// once they are used
+		a := &AccountUser{TOTPSecret: secret}
+		code := totpCodeAt(secret, time.Now())
+		if err := p.verifyTOTP(a, code); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if dal.updated == nil || dal.updated.TOTPLastStep == 0 || dal.updated.TOTPSecret == secret {
+			t.Errorf("Unexpected update %v", dal.updated)
+		}
+		if err := p.verifyTOTP(a, code); err == nil {
+			t.Error("Expected error when reusing code, got nil")
+		}
+	})
+	t.Run("undecryptable secret", func(t *testing.T) {
+		key, _ := keys.GenerateRandomBytes(32)
+		other, _ := keys.GenerateRandomBytes(32)
+		sealed, _ := (&persistenceLayer{totpKey: other}).sealTOTPSecret(secret)
+		p := &persistenceLayer{dal: &mockTOTPDatabase{}, totpKey: key}
+		a := &AccountUser{TOTPSecret: sealed}
+		a.setHashedRecoveryCodes([]string{hashedCode.Marshal()})
+		if err := p.verifyTOTP(a, totpCodeAt(secret, time.Now())); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if err := p.verifyTOTP(a, "recovery"); err != nil {
+			t.Errorf("Expected recovery code to be accepted, got %v", err)
+		}
+	})
+	t.Run("recovery code", func(t *testing.T) {
+		dal := &mockTOTPDatabase{}
+		p := &persistenceLayer{dal: dal}
+		a := &AccountUser{TOTPSecret: secret}
+		a.setHashedRecoveryCodes([]string{hashedCode.Marshal()})
+		if err := p.verifyTOTP(a, "recovery"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if dal.updated == nil {
+			t.Fatal("Expected account user to be updated")
+		}
+		remaining, _ := dal.updated.hashedRecoveryCodes()
+		if len(remaining) != 0 {
+			t.Errorf("Expected recovery code to be consumed, got %v", remaining)
+		}
+		if err := p.verifyTOTP(a, "recovery"); err == nil {
+			t.Error("Expected error when reusing recovery code, got nil")
+		}
+	})
+}
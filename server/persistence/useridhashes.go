@@ -0,0 +1,118 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+
+	"github.com/offen/offen/server/keys"
+)
+
+// userIDHashCacheSize is the number of hashed user ids that are kept in memory
+const userIDHashCacheSize = 10000
+
+// userIDHasher hashes user ids for accounts. Depending on the salt of the
+// account, hashing can be expensive, so results are cached and the number of
+// hashes that are computed at the same time is limited, as these are
+// computed for requests by anonymous users.
+type userIDHasher struct {
+	pepper  []byte
+	slots   chan struct{}
+	size    int
+	lock    sync.Mutex
+	order   *list.List
+	entries map[[sha256.Size]byte]*list.Element
+}
+
+type userIDHashEntry struct {
+	key  [sha256.Size]byte
+	hash string
+}
+
+func newUserIDHasher(pepper []byte, size, concurrency int) *userIDHasher {
+	return &userIDHasher{
+		pepper:  pepper,
+		slots:   make(chan struct{}, concurrency),
+		size:    size,
+		order:   list.New(),
+		entries: map[[sha256.Size]byte]*list.Element{},
+	}
+}
+
+// hash returns the hashed version of the given user id for the given salt.
+func (h *userIDHasher) hash(userID, salt string) (string, error) {
+	// the key is derived from both values so user ids are not kept in memory
+	// and a rotated salt does not return stale hashes
+	key := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s", salt, userID)))
+	if hash, ok := h.get(key); ok {
+		return hash, nil
+	}
+	h.slots <- struct{}{}
+	hash, err := keys.HashFastWithPepper(userID, salt, h.pepper)
+	<-h.slots
+	if err != nil {
+		return "", err
+	}
+	h.set(key, hash)
+	return hash, nil
+}
+
+func (h *userIDHasher) get(key [sha256.Size]byte) (string, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	elem, ok := h.entries[key]
+	if !ok {
+		return "", false
+	}
+	h.order.MoveToFront(elem)
+	return elem.Value.(*userIDHashEntry).hash, true
+}
+
+func (h *userIDHasher) set(key [sha256.Size]byte, hash string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if elem, ok := h.entries[key]; ok {
+		h.order.MoveToFront(elem)
+		return
+	}
+	h.entries[key] = h.order.PushFront(&userIDHashEntry{key: key, hash: hash})
+	for h.order.Len() > h.size {
+		oldest := h.order.Back()
+		h.order.Remove(oldest)
+		delete(h.entries, oldest.Value.(*userIDHashEntry).key)
+	}
+}
+
+// hashUserID hashes the given user id using the account's current salt.
+func (p *persistenceLayer) hashUserID(account Account, userID string) (string, error) {
+	if p.hashes == nil {
+		return account.HashUserID(userID, p.userIDPepper)
+	}
+	return p.hashes.hash(userID, account.UserSalt)
+}
+
+// hashUserIDForAccounts hashes the given user id for each of the given
+// accounts.
+func (p *persistenceLayer) hashUserIDForAccounts(userID string, accounts []Account) []string {
+	if len(accounts) == 0 {
+		return []string{}
+	}
+	// in case a user queries for a longer list of account ids (or even all of them)
+	// hashing the user ID against all salts can get relatively expensive, so
+	// computation is being done concurrently
+	hashes := make([]string, len(accounts))
+	var wg sync.WaitGroup
+	for i, account := range accounts {
+		wg.Add(1)
+		go func(i int, account Account) {
+			defer wg.Done()
+			hashes[i], _ = p.hashUserID(account, userID)
+		}(i, account)
+	}
+	wg.Wait()
+	return hashes
+}
@@ -0,0 +1,46 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"testing"
+
+	"github.com/offen/offen/server/keys"
+)
+
+func TestUserIDHasher(t *testing.T) {
+	provider, err := keys.NewUserSaltProvider(keys.UserIDHashArgon2id, keys.Argon2Params{Time: 1, Memory: 64, Threads: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	a, _ := provider.NewUserSalt()
+	b, _ := provider.NewUserSalt()
+	saltA, saltB := a.Marshal(), b.Marshal()
+
+	h := newUserIDHasher(nil, 2, 1)
+	hashA, err := h.hash("user-a", saltA)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expected, _ := keys.HashFastWithPepper("user-a", saltA, nil)
+	if hashA != expected {
+		t.Errorf("Expected %v, got %v", expected, hashA)
+	}
+	if cached, _ := h.hash("user-a", saltA); cached != hashA {
+		t.Errorf("Expected cached hash %v, got %v", hashA, cached)
+	}
+	if other, _ := h.hash("user-a", saltB); other == hashA {
+		t.Error("Expected different salts to produce different hashes")
+	}
+	h.hash("user-b", saltA)
+	if len(h.entries) != 2 || h.order.Len() != 2 {
+		t.Errorf("Expected cache to be bounded, got %d entries", len(h.entries))
+	}
+	if _, err := h.hash("user-a", "not a salt"); err == nil {
+		t.Error("Expected error, got nil")
+	}
+	if len(h.slots) != 0 {
+		t.Errorf("Expected all slots to be released, got %d", len(h.slots))
+	}
+}
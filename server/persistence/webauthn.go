@@ -0,0 +1,176 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// WebAuthnCeremony contains the relying party a registration or login
+// ceremony is performed for and the session data that has been created
+// when starting the ceremony.
+type WebAuthnCeremony struct {
+	RelyingParty *webauthn.WebAuthn
+	Session      webauthn.SessionData
+}
+
+// webAuthnUser adapts an account user and its credentials to the user
+// interface expected when verifying ceremonies.
+type webAuthnUser struct {
+	accountUserID string
+	credentials   []webauthn.Credential
+}
+
+func (w *webAuthnUser) WebAuthnID() []byte                         { return []byte(w.accountUserID) }
+func (w *webAuthnUser) WebAuthnName() string                       { return w.accountUserID }
+func (w *webAuthnUser) WebAuthnDisplayName() string                { return w.accountUserID }
+func (w *webAuthnUser) WebAuthnIcon() string                       { return "" }
+func (w *webAuthnUser) WebAuthnCredentials() []webauthn.Credential { return w.credentials }
+
+func (p *persistenceLayer) ListWebAuthnCredentials(accountUserID string) ([][]byte, error) {
+	credentials, err := p.dal.FindWebAuthnCredentials(FindWebAuthnCredentialsQueryByAccountUserID(accountUserID))
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up credentials: %w", err)
+	}
+	result := [][]byte{}
+	for _, credential := range credentials {
+		id, err := base64.RawURLEncoding.DecodeString(credential.CredentialID)
+		if err != nil {
+			return nil, fmt.Errorf("persistence: error decoding credential id: %w", err)
+		}
+		result = append(result, id)
+	}
+	return result, nil
+}
+
+func (p *persistenceLayer) RegisterWebAuthnCredential(accountUserID string, response *protocol.ParsedCredentialCreationData, ceremony WebAuthnCeremony, wrappedKeys string) error {
+	if _, err := p.dal.FindAccountUser(FindAccountUserQueryByAccountUserIDIncludeRelationships(accountUserID)); err != nil {
+		return fmt.Errorf("persistence: error looking up account user: %w", err)
+	}
+
+	// verifying the registration includes verifying the attestation
+	// statement in the format the authenticator has chosen
+	credential, err := ceremony.RelyingParty.CreateCredential(
+		&webAuthnUser{accountUserID: accountUserID}, ceremony.Session, response,
+	)
+	if err != nil {
+		return fmt.Errorf("persistence: error verifying registration: %w", err)
+	}
+
+	credentialID := base64.RawURLEncoding.EncodeToString(credential.ID)
+	existing, err := p.dal.FindWebAuthnCredentials(FindWebAuthnCredentialsQueryByCredentialID(credentialID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up existing credentials: %w", err)
+	}
+	if len(existing) != 0 {
+		return errors.New("persistence: credential has already been registered")
+	}
+
+	if err := p.dal.CreateWebAuthnCredential(&WebAuthnCredential{
+		CredentialID:  credentialID,
+		AccountUserID: accountUserID,
+		PublicKey:     base64.RawURLEncoding.EncodeToString(credential.PublicKey),
+		SignCount:     int64(credential.Authenticator.SignCount),
+		WrappedKeys:   wrappedKeys,
+		Created:       time.Now(),
+	}); err != nil {
+		return fmt.Errorf("persistence: error persisting credential: %w", err)
+	}
+	return nil
+}
+
+func (p *persistenceLayer) LoginWebAuthn(response *protocol.ParsedCredentialAssertionData, ceremony WebAuthnCeremony) (LoginResult, error) {
+	var stored WebAuthnCredential
+	// the user handle is required for discoverable credentials and needs to
+	// match the account user the credential has been registered for
+	lookup := func(rawID, userHandle []byte) (webauthn.User, error) {
+		credentials, err := p.dal.FindWebAuthnCredentials(
+			FindWebAuthnCredentialsQueryByCredentialID(base64.RawURLEncoding.EncodeToString(rawID)),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("persistence: error looking up credential: %w", err)
+		}
+		if len(credentials) != 1 {
+			return nil, errors.New("persistence: unknown credential")
+		}
+		stored = credentials[0]
+		if string(userHandle) != stored.AccountUserID {
+			return nil, errors.New("persistence: user handle did not match credential")
+		}
+		credential, err := stored.credential()
+		if err != nil {
+			return nil, fmt.Errorf("persistence: error reading stored credential: %w", err)
+		}
+		return &webAuthnUser{
+			accountUserID: stored.AccountUserID,
+			credentials:   []webauthn.Credential{credential},
+		}, nil
+	}
+
+	credential, err := ceremony.RelyingParty.ValidateDiscoverableLogin(lookup, ceremony.Session, response)
+	if err != nil {
+		return LoginResult{}, fmt.Errorf("persistence: error verifying assertion: %w", err)
+	}
+	// counters are optional, but in case they are used by the authenticator
+	// a non-increasing value signals a cloned authenticator
+	if credential.Authenticator.CloneWarning {
+		return LoginResult{}, errors.New("persistence: signature counter did not increase")
+	}
+	stored.SignCount = int64(credential.Authenticator.SignCount)
+	if err := p.dal.UpdateWebAuthnCredential(&stored); err != nil {
+		return LoginResult{}, fmt.Errorf("persistence: error updating credential: %w", err)
+	}
+
+	accountUser, err := p.dal.FindAccountUser(
+		FindAccountUserQueryByAccountUserIDIncludeRelationships(stored.AccountUserID),
+	)
+	if err != nil {
+		return LoginResult{}, fmt.Errorf("persistence: error looking up account user: %w", err)
+	}
+
+	result := LoginResult{
+		AccountUserID: accountUser.AccountUserID,
+		AdminLevel:    accountUser.AdminLevel,
+		TOTPEnabled:   accountUser.TOTPSecret != "",
+		Accounts:      []LoginAccountResult{},
+		WrappedKeys:   stored.WrappedKeys,
+	}
+	for _, relationship := range accountUser.Relationships {
+		account, err := p.dal.FindAccount(FindAccountQueryByID(relationship.AccountID))
+		if err != nil {
+			return LoginResult{}, fmt.Errorf(`persistence: error looking up account with id "%s": %w`, relationship.AccountID, err)
+		}
+		result.Accounts = append(result.Accounts, LoginAccountResult{
+			AccountName: account.Name,
+			AccountID:   relationship.AccountID,
+			Role:        relationship.Role,
+			Created:     account.Created,
+		})
+	}
+	return result, nil
+}
+
+func (w *WebAuthnCredential) credential() (webauthn.Credential, error) {
+	id, err := base64.RawURLEncoding.DecodeString(w.CredentialID)
+	if err != nil {
+		return webauthn.Credential{}, err
+	}
+	publicKey, err := base64.RawURLEncoding.DecodeString(w.PublicKey)
+	if err != nil {
+		return webauthn.Credential{}, err
+	}
+	return webauthn.Credential{
+		ID:        id,
+		PublicKey: publicKey,
+		Authenticator: webauthn.Authenticator{
+			SignCount: uint32(w.SignCount),
+		},
+	}, nil
+}
@@ -0,0 +1,291 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const (
+	testWebAuthnRPID   = "offen.example.com"
+	testWebAuthnOrigin = "https://offen.example.com"
+)
+
+type mockWebAuthnDatabase struct {
+	DataAccessLayer
+	credentials []WebAuthnCredential
+}
+
+func (m *mockWebAuthnDatabase) FindAccountUser(interface{}) (AccountUser, error) {
+	return AccountUser{AccountUserID: "user-a"}, nil
+}
+
+func (m *mockWebAuthnDatabase) FindWebAuthnCredentials(q interface{}) ([]WebAuthnCredential, error) {
+	var result []WebAuthnCredential
+	for _, c := range m.credentials {
+		switch query := q.(type) {
+		case FindWebAuthnCredentialsQueryByCredentialID:
+			if c.CredentialID == string(query) {
+				result = append(result, c)
+			}
+		case FindWebAuthnCredentialsQueryByAccountUserID:
+			if c.AccountUserID == string(query) {
+				result = append(result, c)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (m *mockWebAuthnDatabase) CreateWebAuthnCredential(c *WebAuthnCredential) error {
+	m.credentials = append(m.credentials, *c)
+	return nil
+}
+
+func (m *mockWebAuthnDatabase) UpdateWebAuthnCredential(c *WebAuthnCredential) error {
+	for i, existing := range m.credentials {
+		if existing.CredentialID == c.CredentialID {
+			m.credentials[i] = *c
+			return nil
+		}
+	}
+	return errors.New("not found")
+}
+
+type testAuthenticator struct {
+	t            *testing.T
+	credentialID []byte
+	key          *ecdsa.PrivateKey
+	signCount    uint32
+	// skipVerification creates assertions that signal user presence only
+	skipVerification bool
+}
+
+func newTestAuthenticator(t *testing.T) *testAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return &testAuthenticator{t: t, credentialID: []byte("credential-a"), key: key}
+}
+
+func (a *testAuthenticator) sign(data ...[]byte) []byte {
+	hash := sha256.Sum256(bytes.Join(data, nil))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, hash[:])
+	if err != nil {
+		a.t.Fatalf("Unexpected error %v", err)
+	}
+	return sig
+}
+
+func (a *testAuthenticator) authData(attested bool) []byte {
+	hash := sha256.Sum256([]byte(testWebAuthnRPID))
+	flags := byte(0x01 | 0x04)
+	if a.skipVerification {
+		flags = 0x01
+	}
+	if attested {
+		flags |= 0x40
+	}
+	result := append(hash[:], flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(result[33:], a.signCount)
+	if !attested {
+		return result
+	}
+	result = append(result, make([]byte, 16)...)
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(len(a.credentialID)))
+	result = append(result, length...)
+	result = append(result, a.credentialID...)
+	key, err := cbor.Marshal(map[int]interface{}{
+		1:  2,
+		3:  -7,
+		-1: 1,
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		a.t.Fatalf("Unexpected error %v", err)
+	}
+	return append(result, key...)
+}
+
+func (a *testAuthenticator) clientData(typ, challenge string) []byte {
+	b, _ := json.Marshal(map[string]string{
+		"type":      typ,
+		"challenge": challenge,
+		"origin":    testWebAuthnOrigin,
+	})
+	return b
+}
+
+// register creates a credential using packed self attestation. Passing true
+// for tamper creates an attestation statement with an invalid signature.
+func (a *testAuthenticator) register(session *webauthn.SessionData, tamper bool) *protocol.ParsedCredentialCreationData {
+	clientData := a.clientData("webauthn.create", session.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	authData := a.authData(true)
+	sig := a.sign(authData, clientDataHash[:])
+	if tamper {
+		sig = a.sign([]byte("something else"))
+	}
+	attestationObject, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      "packed",
+		"attStmt":  map[string]interface{}{"alg": -7, "sig": sig},
+		"authData": authData,
+	})
+	if err != nil {
+		a.t.Fatalf("Unexpected error %v", err)
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"rawId": base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData),
+			"attestationObject": base64.RawURLEncoding.EncodeToString(attestationObject),
+		},
+	})
+	response, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(body))
+	if err != nil {
+		a.t.Fatalf("Unexpected error %v", err)
+	}
+	return response
+}
+
+func (a *testAuthenticator) assert(session *webauthn.SessionData, userHandle string) *protocol.ParsedCredentialAssertionData {
+	clientData := a.clientData("webauthn.get", session.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	authData := a.authData(false)
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"rawId": base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData),
+			"authenticatorData": base64.RawURLEncoding.EncodeToString(authData),
+			"signature":         base64.RawURLEncoding.EncodeToString(a.sign(authData, clientDataHash[:])),
+			"userHandle":        base64.RawURLEncoding.EncodeToString([]byte(userHandle)),
+		},
+	})
+	response, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(body))
+	if err != nil {
+		a.t.Fatalf("Unexpected error %v", err)
+	}
+	return response
+}
+
+func newTestRelyingParty(t *testing.T) *webauthn.WebAuthn {
+	rp, err := webauthn.New(&webauthn.Config{
+		RPDisplayName: "Offen",
+		RPID:          testWebAuthnRPID,
+		RPOrigin:      testWebAuthnOrigin,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			UserVerification: protocol.VerificationRequired,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return rp
+}
+
+func TestPersistenceLayer_WebAuthn(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	authenticator := newTestAuthenticator(t)
+	db := &mockWebAuthnDatabase{}
+	p := &persistenceLayer{dal: db}
+
+	register := func(tamper bool) error {
+		_, session, err := rp.BeginRegistration(&webAuthnUser{accountUserID: "user-a"})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		return p.RegisterWebAuthnCredential(
+			"user-a", authenticator.register(session, tamper),
+			WebAuthnCeremony{RelyingParty: rp, Session: *session}, "wrapped",
+		)
+	}
+	login := func(userHandle string) (LoginResult, error) {
+		_, session, err := rp.BeginDiscoverableLogin()
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		return p.LoginWebAuthn(
+			authenticator.assert(session, userHandle),
+			WebAuthnCeremony{RelyingParty: rp, Session: *session},
+		)
+	}
+
+	t.Run("bad attestation", func(t *testing.T) {
+		if err := register(true); err == nil {
+			t.Error("Expected error when attestation signature is invalid")
+		}
+		if len(db.credentials) != 0 {
+			t.Errorf("Unexpected credentials %v", db.credentials)
+		}
+	})
+
+	t.Run("register", func(t *testing.T) {
+		if err := register(false); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(db.credentials) != 1 || db.credentials[0].AccountUserID != "user-a" || db.credentials[0].WrappedKeys != "wrapped" {
+			t.Errorf("Unexpected credentials %v", db.credentials)
+		}
+		if err := register(false); err == nil {
+			t.Error("Expected error when registering the same credential twice")
+		}
+	})
+
+	t.Run("login", func(t *testing.T) {
+		authenticator.signCount = 1
+		result, err := login("user-a")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if result.AccountUserID != "user-a" || result.WrappedKeys != "wrapped" {
+			t.Errorf("Unexpected result %v", result)
+		}
+		if db.credentials[0].SignCount != 1 {
+			t.Errorf("Expected sign count to be updated, got %d", db.credentials[0].SignCount)
+		}
+	})
+
+	t.Run("user not verified", func(t *testing.T) {
+		authenticator.signCount = 2
+		authenticator.skipVerification = true
+		defer func() { authenticator.skipVerification = false }()
+		if _, err := login("user-a"); err == nil {
+			t.Error("Expected error when user has not been verified")
+		}
+	})
+
+	t.Run("replayed counter", func(t *testing.T) {
+		authenticator.signCount = 1
+		if _, err := login("user-a"); err == nil {
+			t.Error("Expected error when signature counter does not increase")
+		}
+	})
+
+	t.Run("bad user handle", func(t *testing.T) {
+		authenticator.signCount = 2
+		if _, err := login("user-b"); err == nil {
+			t.Error("Expected error when user handle does not match")
+		}
+	})
+}
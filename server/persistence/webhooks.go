@@ -0,0 +1,22 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import "github.com/offen/offen/server/webhook"
+
+// WithWebhooks configures the persistence layer to notify operators about
+// retired accounts and exhausted quotas using the given notifier.
+func WithWebhooks(n webhook.Notifier) Config {
+	return func(p *persistenceLayer) {
+		p.webhooks = n
+	}
+}
+
+// notify passes the given event to the configured webhooks, if any.
+func (p *persistenceLayer) notify(event string, data interface{}) {
+	if p.webhooks == nil {
+		return
+	}
+	p.webhooks.Notify(event, data)
+}
@@ -0,0 +1,35 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/offen/offen/server/webhook"
+)
+
+type mockNotifier struct {
+	events []string
+}
+
+func (m *mockNotifier) Notify(event string, data interface{}) {
+	m.events = append(m.events, event)
+}
+
+func TestPersistenceLayer_notify(t *testing.T) {
+	t.Run("not configured", func(t *testing.T) {
+		p := &persistenceLayer{}
+		p.notify(webhook.EventAccountRetired, nil)
+	})
+	t.Run("configured", func(t *testing.T) {
+		hooks := &mockNotifier{}
+		p := &persistenceLayer{}
+		WithWebhooks(hooks)(p)
+		p.notify(webhook.EventAccountRetired, nil)
+		if !reflect.DeepEqual(hooks.events, []string{webhook.EventAccountRetired}) {
+			t.Errorf("Unexpected notifications %v", hooks.events)
+		}
+	})
+}
@@ -0,0 +1,110 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package public
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Integrity maps the paths of served scripts to their Subresource Integrity
+// hashes.
+type Integrity map[string]string
+
+const (
+	integrityScript = "/script.js"
+	integrityVault  = "/vault/index.html"
+)
+
+var (
+	scriptTagRe = regexp.MustCompile(`<script[^>]*>`)
+	srcAttrRe   = regexp.MustCompile(`\ssrc="([^"]+)"`)
+	sriAttrRe   = regexp.MustCompile(`\sintegrity="([^"]+)"`)
+)
+
+// Integrity computes the SRI hashes of the script and the scripts loaded
+// by the vault. In case the integrity attributes used in the vault do not
+// match the scripts that are served, an error is returned. Assets that are
+// not part of the file system are skipped.
+func (l *LocalizedFS) Integrity() (Integrity, error) {
+	result := Integrity{}
+	script, err := l.readAsset(integrityScript)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if script != nil {
+		result[integrityScript] = sriHash("sha384", script)
+	}
+
+	vault, err := l.readAsset(integrityVault)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return result, nil
+		}
+		return nil, err
+	}
+	for _, tag := range scriptTagRe.FindAllString(string(vault), -1) {
+		src := srcAttrRe.FindStringSubmatch(tag)
+		if src == nil || strings.Contains(src[1], "://") {
+			continue
+		}
+		location := src[1]
+		if !strings.HasPrefix(location, "/") {
+			location = path.Join(path.Dir(integrityVault), location)
+		}
+		content, err := l.readAsset(location)
+		if err != nil {
+			return nil, fmt.Errorf("public: error reading script %s referenced by vault: %w", location, err)
+		}
+		declared := sriAttrRe.FindStringSubmatch(tag)
+		if declared == nil {
+			result[location] = sriHash("sha384", content)
+			continue
+		}
+		algorithm := strings.SplitN(declared[1], "-", 2)[0]
+		actual := sriHash(algorithm, content)
+		if actual != declared[1] {
+			return nil, fmt.Errorf("public: served script %s does not match integrity %s declared by vault", location, declared[1])
+		}
+		result[location] = actual
+	}
+	return result, nil
+}
+
+func (l *LocalizedFS) readAsset(location string) ([]byte, error) {
+	f, err := l.Open(location)
+	if err != nil {
+		return nil, fmt.Errorf("public: error opening %s: %w", location, err)
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("public: error reading %s: %w", location, err)
+	}
+	return b, nil
+}
+
+func sriHash(algorithm string, content []byte) string {
+	var h hash.Hash
+	switch algorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		algorithm = "sha384"
+		h = sha512.New384()
+	}
+	h.Write(content)
+	return algorithm + "-" + base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,57 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package public
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestLocalizedFS_Integrity(t *testing.T) {
+	tests := []struct {
+		name           string
+		prefix         string
+		expectedResult Integrity
+		expectError    bool
+	}{
+		{
+			"ok",
+			"/testdata/integrity",
+			Integrity{
+				"/script.js":                 "sha384-69N1Qobn1wt+eFSU1yQUNmQL2MufrCX8f07DBZ75ZM0AbjHDHIzgabG9q04ST+hO",
+				"/vault/index-abc1234567.js": "sha384-TjemkBJeb/51Zj/MKda9ONAufBc8dILHPIfrQOOPWJSvQcubMStduJdIph7aFWma",
+			},
+			false,
+		},
+		{
+			"tampered",
+			"/testdata/tampered",
+			nil,
+			true,
+		},
+		{
+			"no assets",
+			"/testdata/fr",
+			Integrity{},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := &LocalizedFS{
+				locale: "en",
+				root:   http.FS(testFS),
+				prefix: test.prefix,
+			}
+			result, err := l.Integrity()
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if !reflect.DeepEqual(test.expectedResult, result) {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Locker counts failed attempts per identifier and locks out identifiers
+// once the number of failures reaches a threshold.
+type Locker interface {
+	// Locked returns the remaining lockout duration in case the given
+	// identifier is currently locked out.
+	Locked(identifier string) (time.Duration, bool)
+	// Fail records a failed attempt for the given identifier and returns
+	// the number of attempts left before it is locked out.
+	Fail(identifier string) int
+	// Reset clears all failures recorded for the given identifier.
+	Reset(identifier string)
+}
+
+// Lockout implements Locker using the given cache. It is meant to be used
+// by a single instance, use RedisLockout in case failures need to be shared
+// between multiple instances.
+type Lockout struct {
+	threshold int
+	duration  time.Duration
+	cache     GetSetter
+	salt      []byte
+	lock      sync.Mutex
+}
+
+type lockoutItem struct {
+	failures    int
+	lockedUntil time.Time
+}
+
+// NewLockout creates a new Lockout. Failures are forgotten after the given
+// duration has passed without any further failure.
+func NewLockout(threshold int, duration time.Duration, cache GetSetter) (*Lockout, error) {
+	salt, err := randomBytes(16)
+	if err != nil {
+		return nil, fmt.Errorf("ratelimiter: error creating salt for lockout: %w", err)
+	}
+	return &Lockout{
+		threshold: threshold,
+		duration:  duration,
+		cache:     cache,
+		salt:      salt,
+	}, nil
+}
+
+func (l *Lockout) hash(s string) string {
+	return hashIdentifier(s, l.salt)
+}
+
+func (l *Lockout) get(key string) lockoutItem {
+	if value, found := l.cache.Get(key); found {
+		if item, ok := value.(lockoutItem); ok {
+			return item
+		}
+	}
+	return lockoutItem{}
+}
+
+// Locked returns the remaining lockout duration in case the given identifier
+// is currently locked out.
+func (l *Lockout) Locked(identifier string) (time.Duration, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	remaining := time.Until(l.get(l.hash(identifier)).lockedUntil)
+	return remaining, remaining > 0
+}
+
+// Fail records a failed attempt for the given identifier. It returns the
+// number of attempts left before the identifier is locked out, which is zero
+// in case the lockout has just been applied.
+func (l *Lockout) Fail(identifier string) int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	key := l.hash(identifier)
+	item := l.get(key)
+	item.failures++
+	if item.failures >= l.threshold {
+		l.cache.Set(key, lockoutItem{lockedUntil: time.Now().Add(l.duration)}, l.duration)
+		return 0
+	}
+	l.cache.Set(key, item, l.duration)
+	return l.threshold - item.failures
+}
+
+// Reset clears all failures recorded for the given identifier.
+func (l *Lockout) Reset(identifier string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.cache.Set(l.hash(identifier), lockoutItem{}, l.duration)
+}
@@ -0,0 +1,61 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockout(t *testing.T) {
+	t.Run("locks after threshold", func(t *testing.T) {
+		lockout, err := NewLockout(3, time.Hour, &mockGetSetter{})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		for expected := 2; expected >= 0; expected-- {
+			if _, locked := lockout.Locked("a"); locked {
+				t.Fatalf("Unexpected lockout with %d attempts left", expected)
+			}
+			if left := lockout.Fail("a"); left != expected {
+				t.Errorf("Expected %d attempts left, got %d", expected, left)
+			}
+		}
+		remaining, locked := lockout.Locked("a")
+		if !locked {
+			t.Error("Expected identifier to be locked")
+		}
+		if remaining <= 0 || remaining > time.Hour {
+			t.Errorf("Unexpected remaining duration %v", remaining)
+		}
+		if _, locked := lockout.Locked("b"); locked {
+			t.Error("Unexpected lockout of other identifier")
+		}
+	})
+	t.Run("reset", func(t *testing.T) {
+		lockout, err := NewLockout(2, time.Hour, &mockGetSetter{})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		lockout.Fail("a")
+		lockout.Reset("a")
+		if left := lockout.Fail("a"); left != 1 {
+			t.Errorf("Expected failures to be reset, got %d attempts left", left)
+		}
+	})
+	t.Run("expiry", func(t *testing.T) {
+		lockout, err := NewLockout(1, time.Millisecond*10, &mockGetSetter{})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		lockout.Fail("a")
+		if _, locked := lockout.Locked("a"); !locked {
+			t.Error("Expected identifier to be locked")
+		}
+		time.Sleep(time.Millisecond * 20)
+		if _, locked := lockout.Locked("a"); locked {
+			t.Error("Expected lockout to have expired")
+		}
+	})
+}
@@ -5,7 +5,6 @@ package ratelimiter
 
 import (
 	"crypto/rand"
-	"crypto/sha256"
 	"errors"
 	"fmt"
 	"time"
@@ -44,8 +43,7 @@ type Result struct {
 }
 
 func (l *Limiter) hash(s string) string {
-	joined := append([]byte(s), l.salt...)
-	return fmt.Sprintf("%x", sha256.Sum256(joined))
+	return hashIdentifier(s, l.salt)
 }
 
 type cacheItem struct {
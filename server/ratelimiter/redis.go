@@ -0,0 +1,184 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisUnavailableRetryAfter is the duration reported to clients that are
+// locked out because the lockout status could not be looked up.
+const redisUnavailableRetryAfter = time.Second * 30
+
+// throttleScript applies a throttle atomically, so multiple instances can
+// share a limit. It returns the number of milliseconds the caller needs to
+// wait, or -1 in case the wait would exceed the given timeout.
+var throttleScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local threshold = tonumber(ARGV[2])
+local exponential = ARGV[3] == "1"
+local timeout = tonumber(ARGV[4])
+
+local item = redis.call("HMGET", KEYS[1], "until", "len")
+if not item[1] then
+	redis.call("HSET", KEYS[1], "until", now + threshold, "len", 1)
+	redis.call("PEXPIRE", KEYS[1], threshold)
+	return 0
+end
+
+local blockUntil = tonumber(item[1])
+local queueLen = tonumber(item[2])
+local remaining = blockUntil - now
+if remaining > timeout then
+	return -1
+end
+
+local factor = 1
+if exponential then
+	factor = queueLen
+end
+local next = blockUntil + threshold * factor
+redis.call("HSET", KEYS[1], "until", next, "len", queueLen + 1)
+redis.call("PEXPIRE", KEYS[1], math.max(next - now, 1))
+return math.max(remaining, 0)
+`)
+
+// redisLimiter implements Throttler using Redis, so multiple instances
+// enforce the same limits.
+type redisLimiter struct {
+	client  redis.Cmdable
+	prefix  string
+	timeout time.Duration
+	salt    []byte
+}
+
+// NewRedisThrottler returns a Throttler that stores limits in Redis using
+// keys that start with the given prefix. Identifiers are hashed using the
+// given salt, which needs to be the same for all instances. In case Redis
+// cannot be reached, requests are not throttled so the instance keeps
+// accepting events.
+func NewRedisThrottler(client redis.Cmdable, prefix string, timeout time.Duration, salt []byte) Throttler {
+	return &redisLimiter{client: client, prefix: prefix, timeout: timeout, salt: salt}
+}
+
+// LinearThrottle throttles using the given threshold.
+func (r *redisLimiter) LinearThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return r.throttle(threshold, identifier, false)
+}
+
+// ExponentialThrottle throttles using exponentially increasing thresholds.
+func (r *redisLimiter) ExponentialThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return r.throttle(threshold, identifier, true)
+}
+
+func (r *redisLimiter) throttle(threshold time.Duration, identifier string, exponential bool) <-chan Result {
+	out := make(chan Result)
+	go func() {
+		defer close(out)
+		exp := "0"
+		if exponential {
+			exp = "1"
+		}
+		wait, err := throttleScript.Run(
+			context.Background(), r.client, []string{r.prefix + hashIdentifier(identifier, r.salt)},
+			time.Now().UnixMilli(), threshold.Milliseconds(), exp, r.timeout.Milliseconds(),
+		).Int64()
+		if err != nil {
+			out <- Result{}
+			return
+		}
+		if wait < 0 {
+			out <- Result{Error: errWouldExceedDeadline}
+			return
+		}
+		remaining := time.Duration(wait) * time.Millisecond
+		time.Sleep(remaining)
+		out <- Result{Delay: remaining}
+	}()
+	return out
+}
+
+// RedisLockout implements Locker using Redis, so failures are counted across
+// multiple instances.
+type RedisLockout struct {
+	client    redis.Cmdable
+	prefix    string
+	threshold int
+	duration  time.Duration
+	salt      []byte
+}
+
+// NewRedisLockout creates a Locker that stores failures in Redis using keys
+// that start with the given prefix. Identifiers are hashed using the given
+// salt, which needs to be the same for all instances. In case Redis cannot
+// be reached, identifiers are considered to be locked out.
+func NewRedisLockout(client redis.Cmdable, prefix string, threshold int, duration time.Duration, salt []byte) *RedisLockout {
+	return &RedisLockout{
+		client:    client,
+		prefix:    prefix,
+		threshold: threshold,
+		duration:  duration,
+		salt:      salt,
+	}
+}
+
+func (r *RedisLockout) keys(identifier string) (string, string) {
+	key := r.prefix + hashIdentifier(identifier, r.salt)
+	return key + ":failures", key + ":locked"
+}
+
+// Locked returns the remaining lockout duration in case the given identifier
+// is currently locked out.
+func (r *RedisLockout) Locked(identifier string) (time.Duration, bool) {
+	_, lockedKey := r.keys(identifier)
+	remaining, err := r.client.PTTL(context.Background(), lockedKey).Result()
+	if err != nil {
+		return redisUnavailableRetryAfter, true
+	}
+	// PTTL returns negative values for keys that do not exist
+	return remaining, remaining > 0
+}
+
+// Fail records a failed attempt for the given identifier. It returns the
+// number of attempts left before the identifier is locked out, which is zero
+// in case the lockout has just been applied or failures cannot be counted.
+func (r *RedisLockout) Fail(identifier string) int {
+	ctx := context.Background()
+	failuresKey, lockedKey := r.keys(identifier)
+	var failures *redis.IntCmd
+	if _, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		failures = pipe.Incr(ctx, failuresKey)
+		// failures are forgotten once the duration has passed without any
+		// further failure
+		pipe.PExpire(ctx, failuresKey, r.duration)
+		return nil
+	}); err != nil {
+		return 0
+	}
+	if failures.Val() < int64(r.threshold) {
+		return r.threshold - int(failures.Val())
+	}
+	r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, lockedKey, 1, r.duration)
+		pipe.Del(ctx, failuresKey)
+		return nil
+	})
+	return 0
+}
+
+// Reset clears all failures recorded for the given identifier.
+func (r *RedisLockout) Reset(identifier string) {
+	failuresKey, lockedKey := r.keys(identifier)
+	r.client.Del(context.Background(), failuresKey, lockedKey)
+}
+
+func hashIdentifier(s string, salt []byte) string {
+	joined := append([]byte(s), salt...)
+	return fmt.Sprintf("%x", sha256.Sum256(joined))
+}
@@ -0,0 +1,98 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Unexpected error starting redis: %v", err)
+	}
+	t.Cleanup(s.Close)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	return s, client
+}
+
+func TestRedisThrottler(t *testing.T) {
+	s, client := newTestRedis(t)
+	salt := []byte("salt")
+	a := NewRedisThrottler(client, "limiter:", time.Millisecond*150, salt)
+	b := NewRedisThrottler(client, "limiter:", time.Millisecond*150, salt)
+
+	if result := <-a.LinearThrottle(time.Millisecond*100, "client"); result.Error != nil || result.Delay != 0 {
+		t.Errorf("Expected first call to pass, got %v", result)
+	}
+	delayed := b.LinearThrottle(time.Millisecond*100, "client")
+	time.Sleep(time.Millisecond * 20)
+	if result := <-a.LinearThrottle(time.Millisecond*100, "client"); result.Error != errWouldExceedDeadline {
+		t.Errorf("Expected deadline to be exceeded, got %v", result)
+	}
+	if result := <-delayed; result.Error != nil || result.Delay == 0 {
+		t.Errorf("Expected second call to be delayed, got %v", result)
+	}
+	if result := <-a.LinearThrottle(time.Millisecond*100, "other"); result.Error != nil || result.Delay != 0 {
+		t.Errorf("Expected other identifier to pass, got %v", result)
+	}
+	for _, key := range s.Keys() {
+		if key[:len("limiter:")] != "limiter:" {
+			t.Errorf("Expected key to be prefixed, got %s", key)
+		}
+	}
+
+	s.Close()
+	if result := <-a.LinearThrottle(time.Millisecond*100, "client"); result.Error != nil {
+		t.Errorf("Expected requests to pass when redis is unavailable, got %v", result)
+	}
+}
+
+func TestRedisLockout(t *testing.T) {
+	s, client := newTestRedis(t)
+	salt := []byte("salt")
+	a := NewRedisLockout(client, "lockout:", 3, time.Minute, salt)
+	b := NewRedisLockout(client, "lockout:", 3, time.Minute, salt)
+
+	if left := a.Fail("user"); left != 2 {
+		t.Errorf("Expected 2 attempts left, got %d", left)
+	}
+	if left := b.Fail("user"); left != 1 {
+		t.Errorf("Expected failures of both instances to be counted, got %d", left)
+	}
+	if _, locked := a.Locked("user"); locked {
+		t.Error("Unexpected lockout")
+	}
+	if left := a.Fail("user"); left != 0 {
+		t.Errorf("Expected lockout to be applied, got %d", left)
+	}
+	remaining, locked := b.Locked("user")
+	if !locked || remaining <= 0 || remaining > time.Minute {
+		t.Errorf("Expected user to be locked, got %v %v", remaining, locked)
+	}
+	if _, locked := b.Locked("other"); locked {
+		t.Error("Unexpected lockout of other identifier")
+	}
+
+	b.Reset("user")
+	if _, locked := a.Locked("user"); locked {
+		t.Error("Expected lockout to be reset")
+	}
+
+	a.Fail("user")
+	s.FastForward(time.Minute * 2)
+	if left := a.Fail("user"); left != 2 {
+		t.Errorf("Expected failures to expire, got %d attempts left", left)
+	}
+
+	s.Close()
+	if _, locked := a.Locked("user"); !locked {
+		t.Error("Expected identifiers to be locked when redis is unavailable")
+	}
+}
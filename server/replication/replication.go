@@ -0,0 +1,69 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package replication pulls changes from a primary instance so they can be
+// applied to the database of a replica.
+package replication
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+// Client pulls change sets from the sync endpoint of a primary instance.
+type Client struct {
+	primaryURL string
+	token      string
+	client     *http.Client
+}
+
+// NewClient creates a client for the primary instance running at the given
+// URL. Requests are authenticated using the given token, which needs to match
+// the one configured on the primary.
+func NewClient(primaryURL, token string) *Client {
+	return &Client{
+		primaryURL: strings.TrimSuffix(primaryURL, "/"),
+		token:      token,
+		client:     &http.Client{Timeout: time.Minute},
+	}
+}
+
+// Pull requests all changes the primary has recorded after the given
+// watermark.
+func (c *Client) Pull(watermark string) (persistence.ChangeSet, error) {
+	target, err := url.Parse(c.primaryURL + "/api/sync")
+	if err != nil {
+		return persistence.ChangeSet{}, fmt.Errorf("replication: error parsing primary url: %w", err)
+	}
+	target.RawQuery = url.Values{"since": []string{watermark}}.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, target.String(), nil)
+	if err != nil {
+		return persistence.ChangeSet{}, fmt.Errorf("replication: error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return persistence.ChangeSet{}, fmt.Errorf("replication: error requesting changes: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return persistence.ChangeSet{}, fmt.Errorf("replication: unexpected status code %d: %s", res.StatusCode, message)
+	}
+
+	var changes persistence.ChangeSet
+	if err := json.NewDecoder(res.Body).Decode(&changes); err != nil {
+		return persistence.ChangeSet{}, fmt.Errorf("replication: error decoding changes: %w", err)
+	}
+	return changes, nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package replication
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestClient_Pull(t *testing.T) {
+	tests := []struct {
+		name          string
+		handler       http.HandlerFunc
+		expectedLen   int
+		expectedError bool
+	}{
+		{
+			"ok",
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/sync" || r.URL.Query().Get("since") != "watermark-a" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				if r.Header.Get("Authorization") != "Bearer token" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				json.NewEncoder(w).Encode(persistence.ChangeSet{
+					Events:    []persistence.Event{{EventID: "event-a"}},
+					Watermark: "watermark-b",
+				})
+			},
+			1,
+			false,
+		},
+		{
+			"bad status",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+			},
+			0,
+			true,
+		},
+		{
+			"bad payload",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("}}"))
+			},
+			0,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := httptest.NewServer(test.handler)
+			defer srv.Close()
+
+			changes, err := NewClient(srv.URL+"/", "token").Pull("watermark-a")
+			if (err != nil) != test.expectedError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if len(changes.Events) != test.expectedLen {
+				t.Errorf("Unexpected changes %v", changes)
+			}
+		})
+	}
+}
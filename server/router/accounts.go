@@ -8,9 +8,11 @@ import (
 	"fmt"
 	"html"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/domainverify"
 	"github.com/offen/offen/server/persistence"
 )
 
@@ -40,7 +42,35 @@ func (rt *router) getAccount(c *gin.Context) {
 		return
 	}
 
-	result, err := rt.db.GetAccount(accountID, true, c.Query("since"))
+	if since := c.Query("since"); since != "" {
+		if err := persistence.ValidateEventID(since); err != nil {
+			newJSONError(
+				fmt.Errorf("router: invalid value for since parameter: %w", err),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+	}
+
+	// archived events are only included on demand as reading them
+	// requires fetching all archived bundles of the account, which are
+	// held in memory
+	var result persistence.AccountResult
+	var stream *persistence.EventsStream
+	var err error
+	if archived, _ := strconv.ParseBool(c.Query("archived")); archived {
+		result, err = rt.database(c).GetAccountWithArchive(accountID, c.Query("since"))
+		if err == nil {
+			var events persistence.EventsByAccountID
+			if result.Events != nil {
+				events = *result.Events
+			}
+			result.Events = nil
+			stream = persistence.NewEventsStream(events)
+		}
+	} else {
+		result, stream, err = rt.database(c).StreamAccount(accountID, c.Query("since"))
+	}
 	if err != nil {
 		var errUnknown persistence.ErrUnknownAccount
 		if errors.As(err, &errUnknown) {
@@ -56,7 +86,10 @@ func (rt *router) getAccount(c *gin.Context) {
 		).Pipe(c)
 		return
 	}
-	c.JSON(http.StatusOK, result)
+	rt.streamEvents(c, stream, func() interface{} {
+		stream.Complete(&result)
+		return result
+	})
 }
 
 func (rt *router) deleteAccount(c *gin.Context) {
@@ -87,7 +120,7 @@ func (rt *router) deleteAccount(c *gin.Context) {
 		return
 	}
 
-	err := rt.db.RetireAccount(accountID)
+	err := rt.database(c).RetireAccount(accountID)
 	if err != nil {
 		var errUnknown persistence.ErrUnknownAccount
 		if errors.As(err, &errUnknown) {
@@ -139,7 +172,7 @@ func (rt *router) postAccount(c *gin.Context) {
 		return
 	}
 
-	accountInRequest, err := rt.db.Login(req.EmailAddress, req.Password)
+	accountInRequest, err := rt.database(c).Login(req.EmailAddress, req.Password)
 	if err != nil {
 		newJSONError(
 			fmt.Errorf("router: error validating given credentials: %w", err),
@@ -165,12 +198,563 @@ func (rt *router) postAccount(c *gin.Context) {
 		return
 	}
 
-	if err := rt.db.CreateAccount(html.UnescapeString(rt.sanitizer.Sanitize(req.AccountName)), req.EmailAddress, req.Password); err != nil {
+	accountID, err := rt.database(c).CreateAccount(html.UnescapeString(rt.sanitizer.Sanitize(req.AccountName)), req.EmailAddress, req.Password)
+	if err != nil {
 		newJSONError(
 			fmt.Errorf("router: error creating account %s: %w", req.AccountName, err),
 			http.StatusInternalServerError,
 		).Pipe(c)
 		return
 	}
+	c.Set(contextKeyAuditAccount, accountID)
 	c.JSON(http.StatusCreated, nil)
 }
+
+type importAccountRequest struct {
+	EmailAddress string                    `json:"emailAddress"`
+	Password     string                    `json:"password"`
+	Export       persistence.AccountExport `json:"export"`
+}
+
+func (rt *router) postImportAccount(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusUnauthorized,
+		).Pipe(c)
+		return
+	}
+
+	var req importAccountRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	if l := <-rt.getLimiter().LinearThrottle(time.Second*5, fmt.Sprintf("postImportAccount-%s", req.EmailAddress)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	accountInRequest, err := rt.database(c).Login(req.EmailAddress, req.Password)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error validating given credentials: %w", err),
+			http.StatusUnauthorized,
+		).Pipe(c)
+		return
+	}
+	if accountInRequest.AccountUserID != accountUser.AccountUserID {
+		newJSONError(
+			fmt.Errorf("router: given credentials belong to user other than requester with id %s", accountUser.AccountUserID),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	if ok := accountUser.IsSuperAdmin(); !ok {
+		newJSONError(
+			errors.New("router: account user does not have permissions to import account"),
+			http.StatusForbidden,
+		).Pipe(c)
+		return
+	}
+
+	req.Export.Name = html.UnescapeString(rt.sanitizer.Sanitize(req.Export.Name))
+	if err := rt.database(c).ImportAccount(req.Export, req.EmailAddress, req.Password); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error importing account %s: %w", req.Export.AccountID, err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+	c.Set(contextKeyAuditAccount, req.Export.AccountID)
+	c.JSON(http.StatusCreated, nil)
+}
+
+func (rt *router) getAccountStats(c *gin.Context) {
+	accountID := c.Param("accountID")
+	if l := <-rt.getLimiter().LinearThrottle(time.Second, fmt.Sprintf("getAccountStats-%s", accountID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+
+	if ok := accountUser.CanAccessAccount(accountID); !ok {
+		newJSONError(
+			fmt.Errorf("router: account user does not have permissions to access account %s", accountID),
+			http.StatusForbidden,
+		).Pipe(c)
+		return
+	}
+
+	result, err := rt.database(c).GetAccountStats(accountID)
+	if err != nil {
+		var errUnknown persistence.ErrUnknownAccount
+		if errors.As(err, &errUnknown) {
+			newJSONError(
+				fmt.Errorf("router: account %s not found", accountID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error looking up account stats: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (rt *router) getAccountAggregates(c *gin.Context) {
+	accountID := c.Param("accountID")
+	if l := <-rt.getLimiter().LinearThrottle(time.Second, fmt.Sprintf("getAccountAggregates-%s", accountID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+
+	if ok := accountUser.CanAccessAccount(accountID); !ok {
+		newJSONError(
+			fmt.Errorf("router: account user does not have permissions to access account %s", accountID),
+			http.StatusForbidden,
+		).Pipe(c)
+		return
+	}
+
+	resolution := persistence.AggregateResolutionDay
+	if r := c.Query("resolution"); r != "" {
+		resolution = persistence.AggregateResolution(r)
+	}
+
+	// events older than the retention period have already been expired,
+	// so the range defaults to and never exceeds the retention period
+	until := time.Now()
+	oldest := until.Add(-rt.config.Retention())
+	since := oldest
+	for param, target := range map[string]*time.Time{
+		"since": &since,
+		"until": &until,
+	} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			newJSONError(
+				fmt.Errorf("router: error parsing %s parameter: %w", param, err),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+		*target = t
+	}
+	if until.Before(since) {
+		newJSONError(
+			errors.New("router: since parameter must not be after until parameter"),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+	if since.Before(oldest) {
+		since = oldest
+	}
+
+	result, err := rt.database(c).GetAccountAggregates(accountID, resolution, since, until)
+	if err != nil {
+		var errResolution persistence.ErrInvalidResolution
+		if errors.As(err, &errResolution) {
+			newJSONError(
+				fmt.Errorf("router: invalid resolution %s", string(resolution)),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+		var errUnknown persistence.ErrUnknownAccount
+		if errors.As(err, &errUnknown) {
+			newJSONError(
+				fmt.Errorf("router: account %s not found", accountID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error looking up account aggregates: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+type accountRetentionRequest struct {
+	Retention string `json:"retention"`
+}
+
+func (rt *router) putAccountRetention(c *gin.Context) {
+	accountID := c.Param("accountID")
+
+	var req accountRetentionRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	// an empty value resets the account to the instance's default
+	var retention time.Duration
+	if req.Retention != "" {
+		var err error
+		if retention, err = time.ParseDuration(req.Retention); err != nil || retention < 0 {
+			newJSONError(
+				fmt.Errorf("router: received invalid retention period %s", req.Retention),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+	}
+	if max := rt.config.Retention(); retention > max {
+		newJSONError(
+			fmt.Errorf("router: retention period cannot exceed the instance maximum of %s", max),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	if err := rt.database(c).SetAccountRetention(accountID, retention); err != nil {
+		var errUnknown persistence.ErrUnknownAccount
+		if errors.As(err, &errUnknown) {
+			newJSONError(
+				fmt.Errorf("router: account %s not found", accountID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error updating account retention: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+type accountEventQuotaRequest struct {
+	EventQuota int `json:"eventQuota"`
+}
+
+func (rt *router) putAccountEventQuota(c *gin.Context) {
+	accountID := c.Param("accountID")
+
+	var req accountEventQuotaRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	// a value of zero resets the account to the instance's default
+	if req.EventQuota < 0 {
+		newJSONError(
+			fmt.Errorf("router: received invalid event quota %d", req.EventQuota),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+	if max := rt.config.App.EventQuota; max > 0 && req.EventQuota > max {
+		newJSONError(
+			fmt.Errorf("router: event quota cannot exceed the instance maximum of %d", max),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	if err := rt.database(c).SetAccountEventQuota(accountID, req.EventQuota); err != nil {
+		var errUnknown persistence.ErrUnknownAccount
+		if errors.As(err, &errUnknown) {
+			newJSONError(
+				fmt.Errorf("router: account %s not found", accountID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error updating account event quota: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+type accountDomainsRequest struct {
+	Domains []string `json:"domains"`
+}
+
+func (rt *router) putAccountDomains(c *gin.Context) {
+	accountID := c.Param("accountID")
+
+	var req accountDomainsRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	if err := rt.database(c).SetAccountDomains(accountID, req.Domains); err != nil {
+		var errUnknown persistence.ErrUnknownAccount
+		if errors.As(err, &errUnknown) {
+			newJSONError(
+				fmt.Errorf("router: account %s not found", accountID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		var errInvalid persistence.ErrInvalidDomain
+		if errors.As(err, &errInvalid) {
+			newJSONError(
+				fmt.Errorf("router: received invalid domains: %w", err),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error updating account domains: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+type accountBannerRequest struct {
+	Banner *persistence.AccountBanner `json:"banner"`
+}
+
+func (rt *router) putAccountBanner(c *gin.Context) {
+	accountID := c.Param("accountID")
+
+	var req accountBannerRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	// passing no banner resets the account to the default banner
+	if err := rt.database(c).SetAccountBanner(accountID, req.Banner); err != nil {
+		var errUnknown persistence.ErrUnknownAccount
+		if errors.As(err, &errUnknown) {
+			newJSONError(
+				fmt.Errorf("router: account %s not found", accountID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		var errInvalid persistence.ErrInvalidBanner
+		if errors.As(err, &errInvalid) {
+			newJSONError(
+				fmt.Errorf("router: received invalid banner: %w", err),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error updating account banner: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+type accountSettingsRequest struct {
+	EncryptedSettings string `json:"encryptedSettings"`
+}
+
+func (rt *router) putAccountSettings(c *gin.Context) {
+	accountID := c.Param("accountID")
+
+	var req accountSettingsRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	if err := rt.database(c).SetAccountSettings(accountID, req.EncryptedSettings); err != nil {
+		var errUnknown persistence.ErrUnknownAccount
+		if errors.As(err, &errUnknown) {
+			newJSONError(
+				fmt.Errorf("router: account %s not found", accountID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		var errInvalid persistence.ErrInvalidSettings
+		if errors.As(err, &errInvalid) {
+			newJSONError(
+				fmt.Errorf("router: received invalid settings: %w", err),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error updating account settings: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (rt *router) postVerifyAccountDomain(c *gin.Context) {
+	accountID := c.Param("accountID")
+	domain := c.Param("domain")
+
+	if l := <-rt.getLimiter().LinearThrottle(time.Second*5, fmt.Sprintf("postVerifyAccountDomain-%s", accountID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	if err := rt.database(c).VerifyAccountDomain(accountID, domain); err != nil {
+		var errUnknown persistence.ErrUnknownAccount
+		if errors.As(err, &errUnknown) {
+			newJSONError(
+				fmt.Errorf("router: account %s not found", accountID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		var errInvalid persistence.ErrInvalidDomain
+		if errors.As(err, &errInvalid) {
+			newJSONError(
+				fmt.Errorf("router: received invalid domain: %w", err),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		if errors.Is(err, domainverify.ErrNotVerified) {
+			newJSONError(
+				fmt.Errorf("router: error verifying domain: %w", err),
+				http.StatusUnprocessableEntity,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error verifying domain: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+type rotateAccountKeysRequest struct {
+	EmailAddress string `json:"emailAddress"`
+	Password     string `json:"password"`
+}
+
+func (rt *router) postRotateAccountKeys(c *gin.Context) {
+	accountID := c.Param("accountID")
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusUnauthorized,
+		).Pipe(c)
+		return
+	}
+
+	var req rotateAccountKeysRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	if l := <-rt.getLimiter().LinearThrottle(time.Second*5, fmt.Sprintf("postRotateAccountKeys-%s", req.EmailAddress)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	accountInRequest, err := rt.database(c).Login(req.EmailAddress, req.Password)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error validating given credentials: %w", err),
+			http.StatusUnauthorized,
+		).Pipe(c)
+		return
+	}
+	if accountInRequest.AccountUserID != accountUser.AccountUserID {
+		newJSONError(
+			fmt.Errorf("router: given credentials belong to user other than requester with id %s", accountUser.AccountUserID),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	if err := rt.database(c).RotateAccountKeys(accountID, req.EmailAddress, req.Password); err != nil {
+		var errUnknown persistence.ErrUnknownAccount
+		if errors.As(err, &errUnknown) {
+			newJSONError(
+				fmt.Errorf("router: account %s not found", accountID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error rotating keys of account %s: %w", accountID, err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -9,12 +9,16 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/securecookie"
 	"github.com/microcosm-cc/bluemonday"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/domainverify"
 	"github.com/offen/offen/server/persistence"
 )
 
@@ -24,7 +28,15 @@ type mockGetAccountDatabase struct {
 	err    error
 }
 
-func (m *mockGetAccountDatabase) GetAccount(string, bool, string) (persistence.AccountResult, error) {
+func (m *mockGetAccountDatabase) StreamAccount(string, string) (persistence.AccountResult, *persistence.EventsStream, error) {
+	if m.err != nil {
+		return persistence.AccountResult{}, nil, m.err
+	}
+	return m.result, persistence.NewEventsStream(nil), nil
+}
+
+func (m *mockGetAccountDatabase) GetAccountWithArchive(string, string) (persistence.AccountResult, error) {
+	m.result.Name = "archived"
 	return m.result, m.err
 }
 
@@ -32,6 +44,7 @@ func TestRouter_GetAccount(t *testing.T) {
 	tests := []struct {
 		name               string
 		accountID          string
+		query              string
 		database           persistence.Service
 		expectedStatusCode int
 		expectedBody       string
@@ -39,20 +52,31 @@ func TestRouter_GetAccount(t *testing.T) {
 		{
 			"ok",
 			"account-a",
+			"",
+			&mockGetAccountDatabase{
+				result: persistence.AccountResult{},
+			},
+			http.StatusOK,
+			`{"events":{},"accountId":"","name":"","created":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			"include archive",
+			"account-a",
+			"?archived=true",
 			&mockGetAccountDatabase{
 				result: persistence.AccountResult{},
 			},
 			http.StatusOK,
-			`{"accountId":"","name":"","created":"0001-01-01T00:00:00Z"}`,
+			`{"events":{},"accountId":"","name":"archived","created":"0001-01-01T00:00:00Z"}`,
 		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			cookieSigner := securecookie.New([]byte("abc123"), nil)
 			auth, _ := cookieSigner.Encode("auth", test.accountID)
-			rt := router{db: test.database, cookieSigner: cookieSigner}
+			rt := router{db: test.database, signers: newSigners([]byte("abc123"), 0)}
 			w := httptest.NewRecorder()
-			r := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/%s", test.accountID), nil)
+			r := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/%s%s", test.accountID, test.query), nil)
 			m := gin.New()
 			m.GET("/:accountID", func(c *gin.Context) {
 				c.Set(
@@ -138,7 +162,7 @@ func TestRouter_DeleteAccount(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			cookieSigner := securecookie.New([]byte("abc123"), nil)
 			auth, _ := cookieSigner.Encode("auth", test.accountID)
-			rt := router{db: test.database, cookieSigner: cookieSigner}
+			rt := router{db: test.database, signers: newSigners([]byte("abc123"), 0)}
 			w := httptest.NewRecorder()
 			r := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/%s", test.accountID), nil)
 			m := gin.New()
@@ -173,8 +197,8 @@ func (m *mockPostAccountDatabase) Login(string, string) (persistence.LoginResult
 	return m.loginResult, m.loginErr
 }
 
-func (m *mockPostAccountDatabase) CreateAccount(string, string, string) error {
-	return m.createAccountErr
+func (m *mockPostAccountDatabase) CreateAccount(string, string, string) (string, error) {
+	return "account-a", m.createAccountErr
 }
 
 func TestRouter_postAccount(t *testing.T) {
@@ -308,3 +332,938 @@ func TestRouter_postAccount(t *testing.T) {
 		})
 	}
 }
+
+type mockPostImportAccountDatabase struct {
+	persistence.Service
+	loginResult      persistence.LoginResult
+	loginErr         error
+	importAccountErr error
+}
+
+func (m *mockPostImportAccountDatabase) Login(string, string) (persistence.LoginResult, error) {
+	return m.loginResult, m.loginErr
+}
+
+func (m *mockPostImportAccountDatabase) ImportAccount(persistence.AccountExport, string, string) error {
+	return m.importAccountErr
+}
+
+func TestRouter_postImportAccount(t *testing.T) {
+	superAdmin := persistence.LoginResult{
+		AccountUserID: "account-a",
+		AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
+	}
+	payload := `{"emailAddress":"hioffen@posteo.de","password":"pass","export":{"version":1,"accountId":"account-z","name":"imported"}}`
+	tests := []struct {
+		name               string
+		db                 mockPostImportAccountDatabase
+		userContext        interface{}
+		body               string
+		expectedStatusCode int
+	}{
+		{
+			"bad user context",
+			mockPostImportAccountDatabase{loginResult: superAdmin},
+			40,
+			payload,
+			http.StatusUnauthorized,
+		},
+		{
+			"bad payload",
+			mockPostImportAccountDatabase{loginResult: superAdmin},
+			superAdmin,
+			`"}##`,
+			http.StatusBadRequest,
+		},
+		{
+			"login error",
+			mockPostImportAccountDatabase{loginErr: errors.New("did not work")},
+			superAdmin,
+			payload,
+			http.StatusUnauthorized,
+		},
+		{
+			"account user mismatch",
+			mockPostImportAccountDatabase{loginResult: superAdmin},
+			persistence.LoginResult{
+				AccountUserID: "account-b",
+				AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
+			},
+			payload,
+			http.StatusBadRequest,
+		},
+		{
+			"account user is missing permissions",
+			mockPostImportAccountDatabase{loginResult: superAdmin},
+			persistence.LoginResult{
+				AccountUserID: "account-a",
+			},
+			payload,
+			http.StatusForbidden,
+		},
+		{
+			"import error",
+			mockPostImportAccountDatabase{
+				loginResult:      superAdmin,
+				importAccountErr: errors.New("did not work"),
+			},
+			superAdmin,
+			payload,
+			http.StatusBadRequest,
+		},
+		{
+			"ok",
+			mockPostImportAccountDatabase{loginResult: superAdmin},
+			superAdmin,
+			payload,
+			http.StatusCreated,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{
+				db:        &test.db,
+				sanitizer: bluemonday.StrictPolicy(),
+			}
+
+			m := gin.New()
+			m.POST("/", func(c *gin.Context) {
+				c.Set(contextKeyAuth, test.userContext)
+			}, rt.postImportAccount)
+
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
+
+type mockGetAccountStatsDatabase struct {
+	persistence.Service
+	result persistence.AccountStatsResult
+	err    error
+}
+
+func (m *mockGetAccountStatsDatabase) GetAccountStats(string) (persistence.AccountStatsResult, error) {
+	return m.result, m.err
+}
+
+func TestRouter_getAccountStats(t *testing.T) {
+	tests := []struct {
+		name               string
+		accountID          string
+		database           persistence.Service
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			"account out of scope",
+			"account-b",
+			&mockGetAccountStatsDatabase{},
+			http.StatusForbidden,
+			"",
+		},
+		{
+			"unknown account",
+			"account-a",
+			&mockGetAccountStatsDatabase{
+				err: persistence.ErrUnknownAccount("did not work"),
+			},
+			http.StatusNotFound,
+			"",
+		},
+		{
+			"database error",
+			"account-a",
+			&mockGetAccountStatsDatabase{
+				err: errors.New("did not work"),
+			},
+			http.StatusInternalServerError,
+			"",
+		},
+		{
+			"ok",
+			"account-a",
+			&mockGetAccountStatsDatabase{
+				result: persistence.AccountStatsResult{
+					AccountID:     "account-a",
+					TotalEvents:   2,
+					EventsPerDay:  map[string]int{"2020-01-01": 2},
+					DistinctUsers: 1,
+				},
+			},
+			http.StatusOK,
+			`{"accountId":"account-a","totalEvents":2,"eventsPerDay":{"2020-01-01":2},"distinctUsers":1}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.database}
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/%s/stats", test.accountID), nil)
+			m := gin.New()
+			m.GET("/:accountID/stats", func(c *gin.Context) {
+				c.Set(
+					contextKeyAuth,
+					persistence.LoginResult{
+						Accounts: []persistence.LoginAccountResult{
+							{AccountID: "account-a"},
+						},
+					},
+				)
+				c.Next()
+			}, rt.getAccountStats)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if !strings.Contains(w.Body.String(), test.expectedBody) {
+				t.Errorf("Unexpected response body %s", w.Body.String())
+			}
+		})
+	}
+}
+
+type mockGetAccountAggregatesDatabase struct {
+	persistence.Service
+	result     persistence.AggregatesResult
+	err        error
+	resolution persistence.AggregateResolution
+	since      time.Time
+	until      time.Time
+}
+
+func (m *mockGetAccountAggregatesDatabase) GetAccountAggregates(accountID string, resolution persistence.AggregateResolution, since, until time.Time) (persistence.AggregatesResult, error) {
+	m.resolution = resolution
+	m.since = since
+	m.until = until
+	return m.result, m.err
+}
+
+func TestRouter_getAccountAggregates(t *testing.T) {
+	tests := []struct {
+		name               string
+		accountID          string
+		query              string
+		database           *mockGetAccountAggregatesDatabase
+		expectedStatusCode int
+		expectedResolution persistence.AggregateResolution
+		expectedBody       string
+	}{
+		{
+			"account out of scope",
+			"account-b",
+			"",
+			&mockGetAccountAggregatesDatabase{},
+			http.StatusForbidden,
+			"",
+			"",
+		},
+		{
+			"bad resolution",
+			"account-a",
+			"?resolution=week",
+			&mockGetAccountAggregatesDatabase{
+				err: persistence.ErrInvalidResolution("did not work"),
+			},
+			http.StatusBadRequest,
+			persistence.AggregateResolution("week"),
+			"",
+		},
+		{
+			"bad since",
+			"account-a",
+			"?since=yesterday",
+			&mockGetAccountAggregatesDatabase{},
+			http.StatusBadRequest,
+			"",
+			"",
+		},
+		{
+			"since after until",
+			"account-a",
+			"?since=2020-01-02T00:00:00Z&until=2020-01-01T00:00:00Z",
+			&mockGetAccountAggregatesDatabase{},
+			http.StatusBadRequest,
+			"",
+			"",
+		},
+		{
+			"unknown account",
+			"account-a",
+			"",
+			&mockGetAccountAggregatesDatabase{
+				err: persistence.ErrUnknownAccount("did not work"),
+			},
+			http.StatusNotFound,
+			persistence.AggregateResolutionDay,
+			"",
+		},
+		{
+			"database error",
+			"account-a",
+			"",
+			&mockGetAccountAggregatesDatabase{
+				err: errors.New("did not work"),
+			},
+			http.StatusInternalServerError,
+			persistence.AggregateResolutionDay,
+			"",
+		},
+		{
+			"ok",
+			"account-a",
+			"?resolution=hour",
+			&mockGetAccountAggregatesDatabase{
+				result: persistence.AggregatesResult{
+					AccountID:  "account-a",
+					Resolution: persistence.AggregateResolutionHour,
+					Buckets: []persistence.AggregateBucket{
+						{
+							Start:         time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC),
+							Events:        2,
+							DistinctUsers: 1,
+							PayloadBytes:  300,
+						},
+					},
+				},
+			},
+			http.StatusOK,
+			persistence.AggregateResolutionHour,
+			`{"accountId":"account-a","resolution":"hour","buckets":[{"start":"2020-01-01T12:00:00Z","events":2,"distinctUsers":1,"payloadBytes":300}]}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.database, config: &config.Config{}}
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/%s/aggregate%s", test.accountID, test.query), nil)
+			m := gin.New()
+			m.GET("/:accountID/aggregate", func(c *gin.Context) {
+				c.Set(
+					contextKeyAuth,
+					persistence.LoginResult{
+						Accounts: []persistence.LoginAccountResult{
+							{AccountID: "account-a"},
+						},
+					},
+				)
+				c.Next()
+			}, rt.getAccountAggregates)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.database.resolution != test.expectedResolution {
+				t.Errorf("Unexpected resolution %v", test.database.resolution)
+			}
+			if !strings.Contains(w.Body.String(), test.expectedBody) {
+				t.Errorf("Unexpected response body %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouter_getAccountAggregates_range(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		expectedSince time.Duration
+		expectedUntil time.Time
+	}{
+		{"default", "", -config.EventRetention, time.Time{}},
+		{"since before retention", "?since=2000-01-01T00:00:00Z", -config.EventRetention, time.Time{}},
+		{"since and until", "?since=2000-01-01T00:00:00Z&until=2000-01-02T00:00:00Z", -config.EventRetention, time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := &mockGetAccountAggregatesDatabase{}
+			rt := router{db: db, config: &config.Config{}}
+			m := gin.New()
+			m.GET("/:accountID/aggregate", func(c *gin.Context) {
+				c.Set(contextKeyAuth, persistence.LoginResult{
+					Accounts: []persistence.LoginAccountResult{{AccountID: "account-a"}},
+				})
+				c.Next()
+			}, rt.getAccountAggregates)
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/account-a/aggregate"+test.query, nil))
+			if w.Code != http.StatusOK {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if since := time.Now().Add(test.expectedSince); db.since.Sub(since) > time.Minute || since.Sub(db.since) > time.Minute {
+				t.Errorf("Unexpected since %v", db.since)
+			}
+			if !test.expectedUntil.IsZero() && !db.until.Equal(test.expectedUntil) {
+				t.Errorf("Unexpected until %v", db.until)
+			}
+		})
+	}
+}
+
+type mockPutAccountRetentionDatabase struct {
+	persistence.Service
+	err error
+}
+
+func (m *mockPutAccountRetentionDatabase) SetAccountRetention(string, time.Duration) error {
+	return m.err
+}
+
+func TestRouter_putAccountRetention(t *testing.T) {
+	tests := []struct {
+		name               string
+		database           persistence.Service
+		body               string
+		expectedStatusCode int
+	}{
+		{
+			"bad payload",
+			&mockPutAccountRetentionDatabase{},
+			`{"retention":`,
+			http.StatusBadRequest,
+		},
+		{
+			"bad duration",
+			&mockPutAccountRetentionDatabase{},
+			`{"retention":"two weeks"}`,
+			http.StatusBadRequest,
+		},
+		{
+			"exceeds maximum",
+			&mockPutAccountRetentionDatabase{},
+			`{"retention":"10000h"}`,
+			http.StatusBadRequest,
+		},
+		{
+			"unknown account",
+			&mockPutAccountRetentionDatabase{
+				err: persistence.ErrUnknownAccount("did not work"),
+			},
+			`{"retention":"720h"}`,
+			http.StatusNotFound,
+		},
+		{
+			"database error",
+			&mockPutAccountRetentionDatabase{
+				err: errors.New("did not work"),
+			},
+			`{"retention":"720h"}`,
+			http.StatusInternalServerError,
+		},
+		{
+			"ok",
+			&mockPutAccountRetentionDatabase{},
+			`{"retention":"720h"}`,
+			http.StatusNoContent,
+		},
+		{
+			"reset",
+			&mockPutAccountRetentionDatabase{},
+			`{"retention":""}`,
+			http.StatusNoContent,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.database, config: &config.Config{}}
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPut, "/account-a/retention", strings.NewReader(test.body))
+			m := gin.New()
+			m.PUT("/:accountID/retention", rt.putAccountRetention)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
+
+type mockPutAccountEventQuotaDatabase struct {
+	persistence.Service
+	err error
+}
+
+func (m *mockPutAccountEventQuotaDatabase) SetAccountEventQuota(string, int) error {
+	return m.err
+}
+
+func TestRouter_putAccountEventQuota(t *testing.T) {
+	tests := []struct {
+		name               string
+		database           persistence.Service
+		body               string
+		expectedStatusCode int
+	}{
+		{
+			"bad payload",
+			&mockPutAccountEventQuotaDatabase{},
+			`{"eventQuota":`,
+			http.StatusBadRequest,
+		},
+		{
+			"negative quota",
+			&mockPutAccountEventQuotaDatabase{},
+			`{"eventQuota":-1}`,
+			http.StatusBadRequest,
+		},
+		{
+			"exceeds maximum",
+			&mockPutAccountEventQuotaDatabase{},
+			`{"eventQuota":20000}`,
+			http.StatusBadRequest,
+		},
+		{
+			"unknown account",
+			&mockPutAccountEventQuotaDatabase{
+				err: persistence.ErrUnknownAccount("did not work"),
+			},
+			`{"eventQuota":500}`,
+			http.StatusNotFound,
+		},
+		{
+			"database error",
+			&mockPutAccountEventQuotaDatabase{
+				err: errors.New("did not work"),
+			},
+			`{"eventQuota":500}`,
+			http.StatusInternalServerError,
+		},
+		{
+			"ok",
+			&mockPutAccountEventQuotaDatabase{},
+			`{"eventQuota":500}`,
+			http.StatusNoContent,
+		},
+		{
+			"reset",
+			&mockPutAccountEventQuotaDatabase{},
+			`{"eventQuota":0}`,
+			http.StatusNoContent,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.App.EventQuota = 10000
+			rt := router{db: test.database, config: cfg}
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPut, "/account-a/quota", strings.NewReader(test.body))
+			m := gin.New()
+			m.PUT("/:accountID/quota", rt.putAccountEventQuota)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
+
+type mockPutAccountDomainsDatabase struct {
+	persistence.Service
+	err error
+}
+
+func (m *mockPutAccountDomainsDatabase) SetAccountDomains(string, []string) error {
+	return m.err
+}
+
+func TestRouter_putAccountDomains(t *testing.T) {
+	tests := []struct {
+		name               string
+		database           persistence.Service
+		body               string
+		expectedStatusCode int
+	}{
+		{
+			"bad payload",
+			&mockPutAccountDomainsDatabase{},
+			`{"domains":`,
+			http.StatusBadRequest,
+		},
+		{
+			"invalid domain",
+			&mockPutAccountDomainsDatabase{
+				err: persistence.ErrInvalidDomain("did not work"),
+			},
+			`{"domains":["not a domain"]}`,
+			http.StatusBadRequest,
+		},
+		{
+			"unknown account",
+			&mockPutAccountDomainsDatabase{
+				err: persistence.ErrUnknownAccount("did not work"),
+			},
+			`{"domains":["example.com"]}`,
+			http.StatusNotFound,
+		},
+		{
+			"database error",
+			&mockPutAccountDomainsDatabase{
+				err: errors.New("did not work"),
+			},
+			`{"domains":["example.com"]}`,
+			http.StatusInternalServerError,
+		},
+		{
+			"ok",
+			&mockPutAccountDomainsDatabase{},
+			`{"domains":["example.com"]}`,
+			http.StatusNoContent,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.database, config: &config.Config{}}
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPut, "/account-a/domains", strings.NewReader(test.body))
+			m := gin.New()
+			m.PUT("/:accountID/domains", rt.putAccountDomains)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
+
+type mockPutAccountBannerDatabase struct {
+	persistence.Service
+	err      error
+	received *persistence.AccountBanner
+}
+
+func (m *mockPutAccountBannerDatabase) SetAccountBanner(accountID string, banner *persistence.AccountBanner) error {
+	m.received = banner
+	return m.err
+}
+
+func TestRouter_putAccountBanner(t *testing.T) {
+	tests := []struct {
+		name               string
+		database           *mockPutAccountBannerDatabase
+		body               string
+		expectedStatusCode int
+		expectedBanner     *persistence.AccountBanner
+	}{
+		{
+			"bad payload",
+			&mockPutAccountBannerDatabase{},
+			`{"banner":`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"invalid banner",
+			&mockPutAccountBannerDatabase{
+				err: persistence.ErrInvalidBanner("did not work"),
+			},
+			`{"banner":{"locale":"german"}}`,
+			http.StatusBadRequest,
+			&persistence.AccountBanner{Locale: "german"},
+		},
+		{
+			"unknown account",
+			&mockPutAccountBannerDatabase{
+				err: persistence.ErrUnknownAccount("did not work"),
+			},
+			`{"banner":{"locale":"de"}}`,
+			http.StatusNotFound,
+			&persistence.AccountBanner{Locale: "de"},
+		},
+		{
+			"database error",
+			&mockPutAccountBannerDatabase{
+				err: errors.New("did not work"),
+			},
+			`{"banner":{"locale":"de"}}`,
+			http.StatusInternalServerError,
+			&persistence.AccountBanner{Locale: "de"},
+		},
+		{
+			"ok",
+			&mockPutAccountBannerDatabase{},
+			`{"banner":{"theme":{"background":"#000"},"texts":{"en":{"accept":"Sure"}}}}`,
+			http.StatusNoContent,
+			&persistence.AccountBanner{
+				Theme: &persistence.BannerTheme{Background: "#000"},
+				Texts: map[string]persistence.BannerTexts{"en": {Accept: "Sure"}},
+			},
+		},
+		{
+			"reset",
+			&mockPutAccountBannerDatabase{},
+			`{}`,
+			http.StatusNoContent,
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.database, config: &config.Config{}}
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPut, "/account-a/banner", strings.NewReader(test.body))
+			m := gin.New()
+			m.PUT("/:accountID/banner", rt.putAccountBanner)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if !reflect.DeepEqual(test.database.received, test.expectedBanner) {
+				t.Errorf("Expected %v, got %v", test.expectedBanner, test.database.received)
+			}
+		})
+	}
+}
+
+type mockPutAccountSettingsDatabase struct {
+	persistence.Service
+	err error
+}
+
+func (m *mockPutAccountSettingsDatabase) SetAccountSettings(string, string) error {
+	return m.err
+}
+
+func TestRouter_putAccountSettings(t *testing.T) {
+	tests := []struct {
+		name               string
+		database           persistence.Service
+		body               string
+		expectedStatusCode int
+	}{
+		{
+			"bad payload",
+			&mockPutAccountSettingsDatabase{},
+			`{"encryptedSettings":`,
+			http.StatusBadRequest,
+		},
+		{
+			"invalid settings",
+			&mockPutAccountSettingsDatabase{
+				err: persistence.ErrInvalidSettings("did not work"),
+			},
+			`{"encryptedSettings":"plaintext"}`,
+			http.StatusBadRequest,
+		},
+		{
+			"unknown account",
+			&mockPutAccountSettingsDatabase{
+				err: persistence.ErrUnknownAccount("did not work"),
+			},
+			`{"encryptedSettings":"{1,} YWJj eHl6"}`,
+			http.StatusNotFound,
+		},
+		{
+			"database error",
+			&mockPutAccountSettingsDatabase{
+				err: errors.New("did not work"),
+			},
+			`{"encryptedSettings":"{1,} YWJj eHl6"}`,
+			http.StatusInternalServerError,
+		},
+		{
+			"ok",
+			&mockPutAccountSettingsDatabase{},
+			`{"encryptedSettings":"{1,} YWJj eHl6"}`,
+			http.StatusNoContent,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.database, config: &config.Config{}}
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPut, "/account-a/settings", strings.NewReader(test.body))
+			m := gin.New()
+			m.PUT("/:accountID/settings", rt.putAccountSettings)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
+
+type mockPostVerifyAccountDomainDatabase struct {
+	persistence.Service
+	err error
+}
+
+func (m *mockPostVerifyAccountDomainDatabase) VerifyAccountDomain(string, string) error {
+	return m.err
+}
+
+func TestRouter_postVerifyAccountDomain(t *testing.T) {
+	tests := []struct {
+		name               string
+		database           persistence.Service
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			"unknown account",
+			&mockPostVerifyAccountDomainDatabase{
+				err: persistence.ErrUnknownAccount("did not work"),
+			},
+			http.StatusNotFound,
+			"",
+		},
+		{
+			"unknown domain",
+			&mockPostVerifyAccountDomainDatabase{
+				err: persistence.ErrInvalidDomain("did not work"),
+			},
+			http.StatusNotFound,
+			"",
+		},
+		{
+			"not verified",
+			&mockPostVerifyAccountDomainDatabase{
+				err: fmt.Errorf("persistence: %w", domainverify.ErrNotVerified),
+			},
+			http.StatusUnprocessableEntity,
+			`"code":"DOMAIN_NOT_VERIFIED"`,
+		},
+		{
+			"database error",
+			&mockPostVerifyAccountDomainDatabase{
+				err: errors.New("did not work"),
+			},
+			http.StatusInternalServerError,
+			"",
+		},
+		{
+			"ok",
+			&mockPostVerifyAccountDomainDatabase{},
+			http.StatusNoContent,
+			"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.database, config: &config.Config{}}
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/account-a/domains/example.com/verify", nil)
+			m := gin.New()
+			m.POST("/:accountID/domains/:domain/verify", rt.postVerifyAccountDomain)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if !strings.Contains(w.Body.String(), test.expectedBody) {
+				t.Errorf("Unexpected body %s", w.Body.String())
+			}
+		})
+	}
+}
+
+type mockPostRotateAccountKeysDatabase struct {
+	persistence.Service
+	loginResult persistence.LoginResult
+	loginErr    error
+	rotateErr   error
+}
+
+func (m *mockPostRotateAccountKeysDatabase) Login(string, string) (persistence.LoginResult, error) {
+	return m.loginResult, m.loginErr
+}
+
+func (m *mockPostRotateAccountKeysDatabase) RotateAccountKeys(string, string, string) error {
+	return m.rotateErr
+}
+
+func TestRouter_postRotateAccountKeys(t *testing.T) {
+	accountUser := persistence.LoginResult{
+		AccountUserID: "account-user-a",
+	}
+	payload := `{"emailAddress":"hioffen@posteo.de","password":"pass"}`
+	tests := []struct {
+		name               string
+		db                 mockPostRotateAccountKeysDatabase
+		userContext        interface{}
+		body               string
+		expectedStatusCode int
+	}{
+		{
+			"bad user context",
+			mockPostRotateAccountKeysDatabase{loginResult: accountUser},
+			40,
+			payload,
+			http.StatusUnauthorized,
+		},
+		{
+			"bad payload",
+			mockPostRotateAccountKeysDatabase{loginResult: accountUser},
+			accountUser,
+			`"}##`,
+			http.StatusBadRequest,
+		},
+		{
+			"login error",
+			mockPostRotateAccountKeysDatabase{loginErr: errors.New("did not work")},
+			accountUser,
+			payload,
+			http.StatusUnauthorized,
+		},
+		{
+			"account user mismatch",
+			mockPostRotateAccountKeysDatabase{loginResult: accountUser},
+			persistence.LoginResult{
+				AccountUserID: "account-user-b",
+			},
+			payload,
+			http.StatusBadRequest,
+		},
+		{
+			"unknown account",
+			mockPostRotateAccountKeysDatabase{
+				loginResult: accountUser,
+				rotateErr:   persistence.ErrUnknownAccount("did not work"),
+			},
+			accountUser,
+			payload,
+			http.StatusNotFound,
+		},
+		{
+			"rotation error",
+			mockPostRotateAccountKeysDatabase{
+				loginResult: accountUser,
+				rotateErr:   errors.New("did not work"),
+			},
+			accountUser,
+			payload,
+			http.StatusInternalServerError,
+		},
+		{
+			"ok",
+			mockPostRotateAccountKeysDatabase{loginResult: accountUser},
+			accountUser,
+			payload,
+			http.StatusNoContent,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: &test.db}
+
+			m := gin.New()
+			m.POST("/:accountID/keys", func(c *gin.Context) {
+				c.Set(contextKeyAuth, test.userContext)
+			}, rt.postRotateAccountKeys)
+
+			r := httptest.NewRequest(http.MethodPost, "/account-a/keys", strings.NewReader(test.body))
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ampSourceOriginParam = "__amp_source_origin"
+
+// ampCacheSuffixes contains the hosts of known AMP caches. Pages served
+// from a cache use a subdomain of the cache's host as their origin.
+var ampCacheSuffixes = []string{
+	"cdn.ampproject.org",
+	"amp.cloudflare.com",
+	"bing-amp.com",
+}
+
+func isAMPCacheOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme != "https" {
+		return false
+	}
+	return matchesDomain(strings.ToLower(u.Hostname()), ampCacheSuffixes)
+}
+
+// ampCORSMiddleware implements CORS for AMP pages as described in
+// https://amp.dev/documentation/guides-and-tutorials/learn/amp-caches-and-cors/amp-cors-requests/
+// Requests are only accepted from AMP caches or the page's origin itself. The
+// source origin parameter is controlled by the client, so it is only attached
+// to the request's context using the given key when the request has been sent
+// from a known AMP cache, where it is used instead of the cache's origin. In
+// all other cases, the origin of the request is used as is.
+func ampCORSMiddleware(contextKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sourceOrigin := c.Query(ampSourceOriginParam)
+		if origin := c.GetHeader("Origin"); origin != "" && c.GetHeader("AMP-Same-Origin") != "true" {
+			fromCache := isAMPCacheOrigin(origin)
+			if !fromCache && origin != sourceOrigin {
+				newJSONError(
+					fmt.Errorf("router: origin %s is not allowed to send AMP requests", origin),
+					http.StatusForbidden,
+				).Pipe(c)
+				c.Abort()
+				return
+			}
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Access-Control-Allow-Credentials", "true")
+			c.Header("Vary", "Origin")
+			if fromCache && sourceOrigin != "" {
+				c.Set(contextKey, sourceOrigin)
+			}
+		}
+		if sourceOrigin != "" {
+			c.Header("AMP-Access-Control-Allow-Source-Origin", sourceOrigin)
+			c.Header("Access-Control-Expose-Headers", "AMP-Access-Control-Allow-Source-Origin")
+		}
+		if c.Request.Method == http.MethodOptions {
+			c.Header("Access-Control-Allow-Methods", "GET, POST")
+			c.Status(http.StatusNoContent)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// postAMP records an anonymous event for a request sent by `amp-analytics`.
+// The account is passed using the `accountId` query parameter, all other
+// variables sent by AMP are ignored.
+func (rt *router) postAMP(c *gin.Context) {
+	accountID := c.Query("accountId")
+	if accountID == "" {
+		newJSONError(
+			errors.New("router: missing accountId query parameter"),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+	if !rt.insertAnonymousEvent(c, accountID, "amp") {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,160 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+)
+
+func TestIsAMPCacheOrigin(t *testing.T) {
+	tests := []struct {
+		origin   string
+		expected bool
+	}{
+		{"https://www-example-com.cdn.ampproject.org", true},
+		{"https://cdn.ampproject.org", true},
+		{"https://www-example-com.amp.cloudflare.com", true},
+		{"http://www-example-com.cdn.ampproject.org", false},
+		{"https://cdn.ampproject.org.example.com", false},
+		{"https://www.example.com", false},
+	}
+	for _, test := range tests {
+		t.Run(test.origin, func(t *testing.T) {
+			if result := isAMPCacheOrigin(test.origin); result != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestRouter_postAMP(t *testing.T) {
+	tests := []struct {
+		name                 string
+		method               string
+		url                  string
+		headers              map[string]string
+		expectedStatus       int
+		expectedHeaders      map[string]string
+		expectedSourceOrigin string
+	}{
+		{
+			"missing account id",
+			http.MethodPost,
+			"/amp",
+			nil,
+			http.StatusBadRequest,
+			nil,
+			"",
+		},
+		{
+			"amp cache",
+			http.MethodPost,
+			"/amp?accountId=account-a&__amp_source_origin=https%3A%2F%2Fwww.example.com",
+			map[string]string{"Origin": "https://www-example-com.cdn.ampproject.org"},
+			http.StatusNoContent,
+			map[string]string{
+				"Access-Control-Allow-Origin":            "https://www-example-com.cdn.ampproject.org",
+				"Access-Control-Allow-Credentials":       "true",
+				"AMP-Access-Control-Allow-Source-Origin": "https://www.example.com",
+			},
+			"https://www.example.com",
+		},
+		{
+			"source origin",
+			http.MethodGet,
+			"/amp?accountId=account-a&__amp_source_origin=https%3A%2F%2Fwww.example.com",
+			map[string]string{"Origin": "https://www.example.com"},
+			http.StatusNoContent,
+			map[string]string{
+				"Access-Control-Allow-Origin": "https://www.example.com",
+			},
+			"",
+		},
+		{
+			"same origin",
+			http.MethodGet,
+			"/amp?accountId=account-a&__amp_source_origin=https%3A%2F%2Fwww.example.com",
+			map[string]string{"Origin": "https://www.other.com", "AMP-Same-Origin": "true"},
+			http.StatusNoContent,
+			map[string]string{
+				"Access-Control-Allow-Origin":            "",
+				"AMP-Access-Control-Allow-Source-Origin": "https://www.example.com",
+			},
+			"",
+		},
+		{
+			"no origin",
+			http.MethodGet,
+			"/amp?accountId=account-a&__amp_source_origin=https%3A%2F%2Fwww.example.com",
+			nil,
+			http.StatusNoContent,
+			nil,
+			"",
+		},
+		{
+			"bad origin",
+			http.MethodPost,
+			"/amp?accountId=account-a&__amp_source_origin=https%3A%2F%2Fwww.example.com",
+			map[string]string{"Origin": "https://www.other.com"},
+			http.StatusForbidden,
+			map[string]string{
+				"Access-Control-Allow-Origin": "",
+			},
+			"",
+		},
+		{
+			"preflight",
+			http.MethodOptions,
+			"/amp?__amp_source_origin=https%3A%2F%2Fwww.example.com",
+			map[string]string{"Origin": "https://www-example-com.cdn.ampproject.org"},
+			http.StatusNoContent,
+			map[string]string{
+				"Access-Control-Allow-Methods": "GET, POST",
+			},
+			"",
+		},
+	}
+	publicKey, _ := newPixelTestKey(t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := &mockGetPixelService{publicKey: publicKey}
+			rt := router{db: db, config: &config.Config{}}
+			var sourceOrigin string
+			m := gin.New()
+			amp := m.Group("/amp", ampCORSMiddleware(contextKeySourceOrigin), func(c *gin.Context) {
+				sourceOrigin = c.GetString(contextKeySourceOrigin)
+			})
+			amp.OPTIONS("")
+			amp.GET("", rt.postAMP)
+			amp.POST("", rt.postAMP)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(test.method, test.url, nil)
+			for key, value := range test.headers {
+				r.Header.Set(key, value)
+			}
+			m.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
+			}
+			for key, value := range test.expectedHeaders {
+				if actual := w.Header().Get(key); actual != value {
+					t.Errorf("Expected %s header to be %q, got %q", key, value, actual)
+				}
+			}
+			if sourceOrigin != test.expectedSourceOrigin {
+				t.Errorf("Expected source origin %q, got %q", test.expectedSourceOrigin, sourceOrigin)
+			}
+			if w.Code == http.StatusNoContent && test.method != http.MethodOptions && db.accountID != "account-a" {
+				t.Errorf("Expected event to be inserted for account-a, got %q", db.accountID)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+)
+
+func (rt *router) getAPITokens(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: account user object not found on request context"),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	tokens, err := rt.database(c).ListAPITokens(accountUser.AccountUserID)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error looking up api tokens: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+type createAPITokenRequest struct {
+	Name       string                      `json:"name"`
+	AccountIDs []string                    `json:"accountIds"`
+	Scopes     []persistence.APITokenScope `json:"scopes"`
+}
+
+func (rt *router) postAPIToken(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: account user object not found on request context"),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	var req createAPITokenRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	result, err := rt.database(c).CreateAPIToken(
+		accountUser.AccountUserID, rt.sanitizer.Sanitize(req.Name), req.AccountIDs, req.Scopes,
+	)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error creating api token: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusCreated, result)
+}
+
+func (rt *router) deleteAPIToken(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: account user object not found on request context"),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	tokenID := c.Param("tokenID")
+	if err := rt.database(c).RevokeAPIToken(accountUser.AccountUserID, tokenID); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error revoking api token %s: %w", tokenID, err),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
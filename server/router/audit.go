@@ -0,0 +1,95 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+)
+
+// auditMiddleware records the given action in the audit log once the
+// wrapped handler has responded successfully. Failed requests are not
+// recorded as they did not change anything. Handlers for routes that do not
+// carry the affected account in their path (e.g. when creating an account)
+// set it on the request context instead.
+func (rt *router) auditMiddleware(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if c.Writer.Status() >= http.StatusBadRequest {
+			return
+		}
+		var actorID string
+		if accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult); ok {
+			actorID = accountUser.AccountUserID
+		}
+		accountID := c.Param("accountID")
+		if accountID == "" {
+			accountID = c.GetString(contextKeyAuditAccount)
+		}
+		rt.recordAudit(c, action, actorID, accountID)
+	}
+}
+
+// recordAudit records the given action in the audit log. Errors are logged
+// only, as the action itself has already been performed.
+func (rt *router) recordAudit(c *gin.Context, action, actorID, accountID string) {
+	if err := rt.database(c).RecordAuditEntry(
+		action, actorID, accountID, c.GetString(contextKeyRequestID),
+	); err != nil {
+		rt.logError(c, err, "error recording audit entry")
+	}
+}
+
+func (rt *router) getAuditLog(c *gin.Context) {
+	filter := persistence.AuditLogFilter{
+		AccountID: c.Query("accountId"),
+		ActorID:   c.Query("actorId"),
+		Action:    c.Query("action"),
+	}
+	for param, target := range map[string]*time.Time{
+		"since": &filter.Since,
+		"until": &filter.Until,
+	} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			newJSONError(
+				fmt.Errorf("router: error parsing %s parameter: %w", param, err),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+		*target = t
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			newJSONError(
+				fmt.Errorf("router: limit parameter must be a positive integer, got %q", value),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+		filter.Limit = limit
+	}
+
+	entries, err := rt.database(c).ListAuditEntries(filter)
+	if err != nil {
+		rt.logError(c, err, "error listing audit entries")
+		newJSONError(
+			fmt.Errorf("router: error listing audit entries: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,151 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockAuditDatabase struct {
+	persistence.Service
+	recorded []string
+	filter   *persistence.AuditLogFilter
+	err      error
+}
+
+func (m *mockAuditDatabase) RecordAuditEntry(action, actorID, accountID, requestID string) error {
+	m.recorded = append(m.recorded, action, actorID, accountID, requestID)
+	return m.err
+}
+
+func (m *mockAuditDatabase) ListAuditEntries(filter persistence.AuditLogFilter) ([]persistence.AuditEntryResult, error) {
+	m.filter = &filter
+	return []persistence.AuditEntryResult{}, m.err
+}
+
+func TestRouter_auditMiddleware(t *testing.T) {
+	tests := []struct {
+		name             string
+		path             string
+		status           int
+		expectedRecorded []string
+	}{
+		{
+			"success",
+			"/account-a",
+			http.StatusNoContent,
+			[]string{persistence.AuditActionAccountRetention, "user-a", "account-a", "request-a"},
+		},
+		{
+			"account from handler",
+			"/",
+			http.StatusCreated,
+			[]string{persistence.AuditActionAccountRetention, "user-a", "account-b", "request-a"},
+		},
+		{
+			"failure",
+			"/account-a",
+			http.StatusForbidden,
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := &mockAuditDatabase{}
+			rt := &router{db: db, config: &config.Config{}}
+			m := gin.New()
+			setup := func(c *gin.Context) {
+				c.Set(contextKeyAuth, persistence.LoginResult{AccountUserID: "user-a"})
+				c.Set(contextKeyRequestID, "request-a")
+				c.Next()
+			}
+			handler := func(c *gin.Context) {
+				c.Set(contextKeyAuditAccount, "account-b")
+				c.Status(test.status)
+			}
+			m.PUT("/:accountID", setup, rt.auditMiddleware(persistence.AuditActionAccountRetention), handler)
+			m.PUT("/", setup, rt.auditMiddleware(persistence.AuditActionAccountRetention), handler)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPut, test.path, nil)
+			m.ServeHTTP(w, r)
+			if w.Code != test.status {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if !reflect.DeepEqual(test.expectedRecorded, db.recorded) {
+				t.Errorf("Expected %v, got %v", test.expectedRecorded, db.recorded)
+			}
+		})
+	}
+}
+
+func TestRouter_getAuditLog(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		err            error
+		expectedStatus int
+		expectedFilter *persistence.AuditLogFilter
+	}{
+		{
+			"bad since",
+			"?since=yesterday",
+			nil,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"bad limit",
+			"?limit=-1",
+			nil,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"database error",
+			"",
+			errors.New("did not work"),
+			http.StatusInternalServerError,
+			&persistence.AuditLogFilter{},
+		},
+		{
+			"ok",
+			"?accountId=account-a&actorId=user-a&action=account.retire&since=2021-03-14T12:00:00Z&limit=20",
+			nil,
+			http.StatusOK,
+			&persistence.AuditLogFilter{
+				AccountID: "account-a",
+				ActorID:   "user-a",
+				Action:    "account.retire",
+				Since:     time.Date(2021, 3, 14, 12, 0, 0, 0, time.UTC),
+				Limit:     20,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := &mockAuditDatabase{err: test.err}
+			rt := &router{db: db, config: &config.Config{}}
+			m := gin.New()
+			m.GET("/", rt.getAuditLog)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/"+test.query, nil)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatus {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if !reflect.DeepEqual(test.expectedFilter, db.filter) {
+				t.Errorf("Expected filter %v, got %v", test.expectedFilter, db.filter)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultBotUserAgents contains fragments of user agents sent by well known
+// crawlers, bots and HTTP libraries. User agents are matched case
+// insensitively.
+var defaultBotUserAgents = []string{
+	"bot",
+	"crawler",
+	"spider",
+	"slurp",
+	"mediapartners-google",
+	"facebookexternalhit",
+	"headlesschrome",
+	"phantomjs",
+	"lighthouse",
+	"pingdom",
+	"uptimerobot",
+	"curl/",
+	"wget/",
+	"python-requests",
+	"python-urllib",
+	"go-http-client",
+	"okhttp",
+	"java/",
+}
+
+// isBot checks whether the given user agent contains any of the given
+// fragments, which are expected to be lowercase.
+func isBot(userAgent string, fragments []string) bool {
+	userAgent = strings.ToLower(userAgent)
+	for _, fragment := range fragments {
+		if fragment != "" && strings.Contains(userAgent, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// botFilterMiddleware drops events sent by user agents matching any of the
+// given fragments. Such requests are still acknowledged so bots do not
+// retry sending them.
+func (rt *router) botFilterMiddleware(fragments []string) gin.HandlerFunc {
+	var lower []string
+	for _, fragment := range fragments {
+		lower = append(lower, strings.ToLower(strings.TrimSpace(fragment)))
+	}
+	return func(c *gin.Context) {
+		if !isBot(c.Request.UserAgent(), lower) {
+			c.Next()
+			return
+		}
+		atomic.AddUint64(&rt.bots, 1)
+		c.AbortWithStatusJSON(http.StatusCreated, ackResponse{true})
+	}
+}
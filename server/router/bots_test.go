@@ -0,0 +1,59 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRouter_botFilterMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		userAgent      string
+		expectedStatus int
+		expectedBots   uint64
+	}{
+		{
+			"browser",
+			"Mozilla/5.0 (X11; Linux x86_64; rv:86.0) Gecko/20100101 Firefox/86.0",
+			http.StatusNoContent,
+			0,
+		},
+		{
+			"crawler",
+			"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			http.StatusCreated,
+			1,
+		},
+		{
+			"custom fragment",
+			"Mozilla/5.0 MonitoringAgent/1.0",
+			http.StatusCreated,
+			1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := &router{}
+			m := gin.New()
+			m.POST("/", rt.botFilterMiddleware(append(defaultBotUserAgents, "MonitoringAgent")), func(c *gin.Context) {
+				c.Status(http.StatusNoContent)
+			})
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r.Header.Set("User-Agent", test.userAgent)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatus {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if rt.bots != test.expectedBots {
+				t.Errorf("Unexpected bot count %d", rt.bots)
+			}
+		})
+	}
+}
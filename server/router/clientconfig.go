@@ -0,0 +1,69 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+)
+
+// clientConfigMaxAge is the duration clients are allowed to cache their
+// configuration before revalidating it.
+const clientConfigMaxAge = time.Minute * 5
+
+const (
+	cookieModeCookie = "cookie"
+	cookieModeHeader = "header"
+)
+
+type clientConfigResponse struct {
+	persistence.ClientConfigResult
+	CookieMode   string  `json:"cookieMode"`
+	SamplingRate float64 `json:"samplingRate"`
+	Locale       string  `json:"locale"`
+}
+
+// getClientConfig returns the settings the script embedded on a site needs
+// for the given account, so client behavior can be changed without
+// updating the sites embedding the script.
+func (rt *router) getClientConfig(c *gin.Context) {
+	result, err := rt.database(c).GetClientConfig(c.Param("accountID"))
+	if err != nil {
+		var unknownAccountErr persistence.ErrUnknownAccount
+		if errors.As(err, &unknownAccountErr) {
+			newJSONError(
+				fmt.Errorf("router: unknown account: %w", unknownAccountErr),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error looking up client config: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	response := clientConfigResponse{
+		ClientConfigResult: result,
+		CookieMode:         cookieModeCookie,
+		SamplingRate:       rt.config.App.SamplingRate,
+		Locale:             rt.config.App.Locale.String(),
+	}
+	if rt.cookieless() {
+		response.CookieMode = cookieModeHeader
+	}
+	if result.Banner != nil && result.Banner.Locale != "" {
+		response.Locale = result.Banner.Locale
+	}
+	// the configuration does not contain any private data and is requested
+	// by the script running on the embedding site
+	c.Header("Access-Control-Allow-Origin", "*")
+	writeCacheableJSON(c, response, clientConfigMaxAge)
+}
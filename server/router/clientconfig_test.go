@@ -0,0 +1,126 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockGetClientConfigService struct {
+	persistence.Service
+	result persistence.ClientConfigResult
+	err    error
+}
+
+func (m *mockGetClientConfigService) GetClientConfig(string) (persistence.ClientConfigResult, error) {
+	return m.result, m.err
+}
+
+func TestRouter_getClientConfig(t *testing.T) {
+	tests := []struct {
+		name             string
+		db               persistence.Service
+		cookieless       bool
+		expectedStatus   int
+		expectedResponse *clientConfigResponse
+	}{
+		{
+			"unknown account",
+			&mockGetClientConfigService{err: persistence.ErrUnknownAccount("unknown")},
+			false,
+			http.StatusNotFound,
+			nil,
+		},
+		{
+			"database error",
+			&mockGetClientConfigService{err: errors.New("did not work")},
+			false,
+			http.StatusInternalServerError,
+			nil,
+		},
+		{
+			"ok",
+			&mockGetClientConfigService{result: persistence.ClientConfigResult{AccountID: "account-a", KeyAlgorithm: "rsa-oaep"}},
+			false,
+			http.StatusOK,
+			&clientConfigResponse{
+				ClientConfigResult: persistence.ClientConfigResult{AccountID: "account-a", KeyAlgorithm: "rsa-oaep"},
+				CookieMode:         "cookie",
+				SamplingRate:       0.5,
+				Locale:             "fr",
+			},
+		},
+		{
+			"banner locale",
+			&mockGetClientConfigService{result: persistence.ClientConfigResult{
+				AccountID: "account-a",
+				Banner:    &persistence.AccountBanner{Locale: "de", Texts: map[string]persistence.BannerTexts{"de": {Accept: "Ja"}}},
+			}},
+			false,
+			http.StatusOK,
+			&clientConfigResponse{
+				ClientConfigResult: persistence.ClientConfigResult{
+					AccountID: "account-a",
+					Banner:    &persistence.AccountBanner{Locale: "de", Texts: map[string]persistence.BannerTexts{"de": {Accept: "Ja"}}},
+				},
+				CookieMode:   "cookie",
+				SamplingRate: 0.5,
+				Locale:       "de",
+			},
+		},
+		{
+			"cookieless retired",
+			&mockGetClientConfigService{result: persistence.ClientConfigResult{AccountID: "account-a", Retired: true}},
+			true,
+			http.StatusOK,
+			&clientConfigResponse{
+				ClientConfigResult: persistence.ClientConfigResult{AccountID: "account-a", Retired: true},
+				CookieMode:         "header",
+				SamplingRate:       0.5,
+				Locale:             "fr",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.App.SamplingRate = 0.5
+			cfg.App.Locale = "fr"
+			cfg.UserCookie.Disabled = test.cookieless
+			rt := router{db: test.db, config: cfg}
+			m := gin.New()
+			m.GET("/config/:accountID", rt.getClientConfig)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/config/account-a", nil)
+			m.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
+			}
+			if test.expectedResponse == nil {
+				return
+			}
+			if w.Header().Get("Etag") == "" || w.Header().Get("Cache-Control") == "" {
+				t.Error("Expected response to be cacheable")
+			}
+			var response clientConfigResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(response, *test.expectedResponse) {
+				t.Errorf("Expected %v, got %v", *test.expectedResponse, response)
+			}
+		})
+	}
+}
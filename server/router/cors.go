@@ -0,0 +1,39 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// corsMiddleware allows the origins configured by the operator to send
+// cross-origin requests including credentials to all routes starting with the
+// given prefix. Preflight requests are answered directly. Requests from any
+// other origin are passed on without adding any headers. As the allowed
+// origins can be reloaded at runtime, they are looked up on each request.
+func (rt *router) corsMiddleware(prefix string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" || !strings.HasPrefix(c.Request.URL.Path, prefix) || rt.config == nil || !rt.config.AllowsCORSOrigin(origin) {
+			c.Next()
+			return
+		}
+		c.Header("Access-Control-Allow-Origin", origin)
+		c.Header("Access-Control-Allow-Credentials", "true")
+		c.Header("Vary", "Origin")
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			c.Header("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, DELETE")
+			if headers := c.GetHeader("Access-Control-Request-Headers"); headers != "" {
+				c.Header("Access-Control-Allow-Headers", headers)
+			}
+			c.Header("Access-Control-Max-Age", "600")
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+)
+
+func TestRouter_corsMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		origin         string
+		expectedStatus int
+		expectedOrigin string
+	}{
+		{
+			"no origin",
+			http.MethodGet,
+			"/api/events",
+			"",
+			http.StatusOK,
+			"",
+		},
+		{
+			"unknown origin",
+			http.MethodGet,
+			"/api/events",
+			"https://www.example.net",
+			http.StatusOK,
+			"",
+		},
+		{
+			"allowed origin",
+			http.MethodGet,
+			"/api/events",
+			"https://dashboard.example.com",
+			http.StatusOK,
+			"https://dashboard.example.com",
+		},
+		{
+			"preflight",
+			http.MethodOptions,
+			"/api/events",
+			"https://dashboard.example.com",
+			http.StatusNoContent,
+			"https://dashboard.example.com",
+		},
+		{
+			"other prefix",
+			http.MethodGet,
+			"/events",
+			"https://dashboard.example.com",
+			http.StatusOK,
+			"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.App.CORSOrigins = []string{"https://dashboard.example.com"}
+			rt := &router{config: cfg}
+			m := gin.New()
+			m.Use(rt.corsMiddleware("/api/"))
+			handler := func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			}
+			m.GET("/api/events", handler)
+			m.GET("/events", handler)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(test.method, test.path, nil)
+			if test.origin != "" {
+				r.Header.Set("Origin", test.origin)
+			}
+			r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatus {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != test.expectedOrigin {
+				t.Errorf("Unexpected allowed origin %v", origin)
+			}
+		})
+	}
+}
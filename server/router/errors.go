@@ -3,14 +3,70 @@
 
 package router
 
-import "github.com/gin-gonic/gin"
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/domainverify"
+	"github.com/offen/offen/server/mailer"
+	"github.com/offen/offen/server/persistence"
+)
+
+const (
+	errorCodeInvalidCredentials = "INVALID_CREDENTIALS"
+	errorCodeTOTPRequired       = "TOTP_REQUIRED"
+	errorCodeLoginLocked        = "LOGIN_LOCKED"
+	errorCodeUnknownAccount     = "UNKNOWN_ACCOUNT"
+	errorCodeUnknownUser        = "UNKNOWN_USER"
+	errorCodeBadRequest         = "BAD_REQUEST"
+	errorCodeUnauthorized       = "UNAUTHORIZED"
+	errorCodeForbidden          = "FORBIDDEN"
+	errorCodeNotFound           = "NOT_FOUND"
+	errorCodeConflict           = "CONFLICT"
+	errorCodePayloadTooLarge    = "PAYLOAD_TOO_LARGE"
+	errorCodeRateLimited        = "RATE_LIMITED"
+	errorCodeQuotaExceeded      = "QUOTA_EXCEEDED"
+	errorCodeOriginMismatch     = "ORIGIN_MISMATCH"
+	errorCodeDomainNotVerified  = "DOMAIN_NOT_VERIFIED"
+	errorCodeEventRejected      = "EVENT_REJECTED"
+	errorCodeUnavailable        = "SERVICE_UNAVAILABLE"
+	errorCodeInternal           = "INTERNAL_ERROR"
+)
+
+// statusErrorCodes are the codes used for errors that cannot be mapped to a
+// more specific code.
+var statusErrorCodes = map[int]string{
+	http.StatusBadRequest:            errorCodeBadRequest,
+	http.StatusUnauthorized:          errorCodeUnauthorized,
+	http.StatusForbidden:             errorCodeForbidden,
+	http.StatusNotFound:              errorCodeNotFound,
+	http.StatusConflict:              errorCodeConflict,
+	http.StatusRequestEntityTooLarge: errorCodePayloadTooLarge,
+	http.StatusTooManyRequests:       errorCodeRateLimited,
+	http.StatusInternalServerError:   errorCodeInternal,
+	http.StatusServiceUnavailable:    errorCodeUnavailable,
+}
 
 type errorResponse struct {
 	Error  string `json:"error"`
 	Status int    `json:"status"`
+	// Code is a machine readable identifier clients can use for rendering
+	// a matching message
+	Code string `json:"code,omitempty"`
+	// AttemptsLeft is the number of failed attempts that are allowed before
+	// a lockout is applied
+	AttemptsLeft int `json:"attemptsLeft,omitempty"`
+	// RetryAfter is the number of seconds a client needs to wait before
+	// retrying the request
+	RetryAfter int `json:"retryAfter,omitempty"`
+	// RequestID identifies the request that caused the error, so it can be
+	// correlated with log entries
+	RequestID string `json:"requestId,omitempty"`
 }
 
 func (e *errorResponse) Pipe(c *gin.Context) {
+	e.RequestID = c.GetString(contextKeyRequestID)
 	c.AbortWithStatusJSON(e.Status, e)
 }
 
@@ -18,5 +74,45 @@ func newJSONError(err error, status int) *errorResponse {
 	return &errorResponse{
 		Error:  err.Error(),
 		Status: status,
+		Code:   errorCodeFor(err, status),
+	}
+}
+
+// errorCodeFor maps well known persistence errors to their code and falls
+// back to a code derived from the given status.
+func errorCodeFor(err error, status int) string {
+	var unknownAccountErr persistence.ErrUnknownAccount
+	if errors.As(err, &unknownAccountErr) {
+		return errorCodeUnknownAccount
+	}
+	var unknownSecretErr persistence.ErrUnknownSecret
+	if errors.As(err, &unknownSecretErr) {
+		return errorCodeUnknownUser
+	}
+	var originMismatchErr errOriginMismatch
+	if errors.As(err, &originMismatchErr) {
+		return errorCodeOriginMismatch
+	}
+	var rejectedErr persistence.ErrEventRejected
+	if errors.As(err, &rejectedErr) {
+		return errorCodeEventRejected
+	}
+	if errors.Is(err, domainverify.ErrNotVerified) {
+		return errorCodeDomainNotVerified
+	}
+	var quotaExceededErr persistence.ErrQuotaExceeded
+	if errors.As(err, &quotaExceededErr) {
+		return errorCodeQuotaExceeded
+	}
+	return statusErrorCodes[status]
+}
+
+// mailErrorStatus returns the status used for responding to requests whose
+// email could not be sent. Instances without any way of delivering email
+// are considered to be unavailable.
+func mailErrorStatus(err error) int {
+	if errors.Is(err, mailer.ErrUnavailable) {
+		return http.StatusServiceUnavailable
 	}
+	return http.StatusInternalServerError
 }
@@ -5,11 +5,13 @@ package router
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
 )
 
 func TestJSONError(t *testing.T) {
@@ -26,7 +28,48 @@ func TestJSONError(t *testing.T) {
 	if w.Code != http.StatusInternalServerError {
 		t.Errorf("Unexpected status code %d", w.Code)
 	}
-	if w.Body.String() != `{"error":"does not work","status":500}` {
+	if w.Body.String() != `{"error":"does not work","status":500,"code":"INTERNAL_ERROR"}` {
 		t.Errorf("Unexpected response body %s", w.Body.String())
 	}
 }
+
+func TestErrorCodeFor(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		status       int
+		expectedCode string
+	}{
+		{
+			"unknown account",
+			fmt.Errorf("router: error: %w", persistence.ErrUnknownAccount("did not work")),
+			http.StatusNotFound,
+			errorCodeUnknownAccount,
+		},
+		{
+			"unknown user",
+			fmt.Errorf("router: error: %w", persistence.ErrUnknownSecret("did not work")),
+			http.StatusBadRequest,
+			errorCodeUnknownUser,
+		},
+		{
+			"status",
+			errors.New("did not work"),
+			http.StatusTooManyRequests,
+			errorCodeRateLimited,
+		},
+		{
+			"unmapped status",
+			errors.New("did not work"),
+			http.StatusTeapot,
+			"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if code := errorCodeFor(test.err, test.status); code != test.expectedCode {
+				t.Errorf("Unexpected code %v", code)
+			}
+		})
+	}
+}
@@ -4,18 +4,27 @@
 package router
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/deadletter"
+	"github.com/offen/offen/server/keys"
 	"github.com/offen/offen/server/persistence"
+	"github.com/patrickmn/go-cache"
 )
 
 type inboundEventPayload struct {
 	AccountID string `json:"accountId"`
 	Payload   string `json:"payload"`
+	// EventID optionally contains a client generated event id. Submitting
+	// an event id that has already been used by the same user is a no-op.
+	EventID string `json:"eventId"`
 }
 
 type ackResponse struct {
@@ -24,9 +33,14 @@ type ackResponse struct {
 
 var errBadRequestContext = errors.New("could not use user id in request context")
 
+// eventEnvelopeSize is the number of bytes a request for posting an event
+// is allowed to exceed the maximum payload size by.
+const eventEnvelopeSize = 1024
+
 func (rt *router) postEvents(c *gin.Context) {
 	userID := c.GetString(contextKeyCookie)
-	if l := <-rt.getLimiter().LinearThrottle(time.Second/2, fmt.Sprintf("postEvents-%s", userID)); l.Error != nil {
+	anonymous := c.GetBool(contextKeyAnonymous)
+	if l := <-rt.getLimiter().LinearThrottle(rt.ingestRateLimit(), fmt.Sprintf("postEvents-%s", ingestThrottleKey(c))); l.Error != nil {
 		newJSONError(
 			fmt.Errorf("router: error rate limiting request: %w", l.Error),
 			http.StatusTooManyRequests,
@@ -34,45 +48,275 @@ func (rt *router) postEvents(c *gin.Context) {
 		return
 	}
 
+	maxSize := rt.maxEventPayloadSize()
+	if maxSize > 0 && !limitRequestBody(c, int64(maxSize+eventEnvelopeSize)) {
+		return
+	}
+
 	evt := inboundEventPayload{}
-	if err := c.BindJSON(&evt); err != nil {
+	if !bindLimitedJSON(c, &evt) {
+		return
+	}
+
+	eventID, status, err := rt.validateInboundEvent(c, evt, maxSize)
+	if err != nil {
+		newJSONError(err, status).Pipe(c)
+		return
+	}
+
+	// duplicate events are acknowledged without being persisted so clients
+	// do not retry sending them
+	duplicate, release := rt.suppressDuplicateEvent(userID, evt.AccountID, evt.Payload)
+	if !duplicate {
+		err = rt.database(c).Insert(userID, evt.AccountID, evt.Payload, eventID)
+	}
+	if err != nil {
+		release()
+		if resp := insertErrorResponse(c, err); resp != nil {
+			resp.Pipe(c)
+			return
+		}
+		if !rt.storeDeadLetter(c, err, userID, evt.AccountID, evt.Payload, eventID) {
+			newJSONError(
+				fmt.Errorf("router: error persisting event: %w", err),
+				http.StatusInternalServerError,
+			).Pipe(c)
+			return
+		}
+	}
+	rt.ackEvents(c, userID, anonymous)
+}
+
+// maxEventBatchSize is the maximum number of events that can be posted
+// using a single request.
+const maxEventBatchSize = 100
+
+type inboundEventBatchPayload struct {
+	Events []inboundEventPayload `json:"events"`
+}
+
+func (rt *router) postEventsBatch(c *gin.Context) {
+	userID := c.GetString(contextKeyCookie)
+	anonymous := c.GetBool(contextKeyAnonymous)
+	if l := <-rt.getLimiter().LinearThrottle(rt.ingestRateLimit(), fmt.Sprintf("postEvents-%s", ingestThrottleKey(c))); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	maxSize := rt.maxEventPayloadSize()
+	if maxSize > 0 && !limitRequestBody(c, int64((maxSize+eventEnvelopeSize)*maxEventBatchSize)) {
+		return
+	}
+
+	batch := inboundEventBatchPayload{}
+	if !bindLimitedJSON(c, &batch) {
+		return
+	}
+	if len(batch.Events) == 0 || len(batch.Events) > maxEventBatchSize {
 		newJSONError(
-			fmt.Errorf("router: error decoding request payload: %v", err),
+			fmt.Errorf("router: batches need to contain between 1 and %d events, got %d", maxEventBatchSize, len(batch.Events)),
 			http.StatusBadRequest,
 		).Pipe(c)
 		return
 	}
 
-	if err := rt.db.Insert(userID, evt.AccountID, evt.Payload, nil); err != nil {
-		var unknownAccountErr persistence.ErrUnknownAccount
-		if errors.As(err, &unknownAccountErr) {
-			newJSONError(
-				fmt.Errorf("router: error inserting event: %w", unknownAccountErr),
-				http.StatusNotFound,
-			).Pipe(c)
+	// all events are validated before any of them is inserted, so a batch
+	// is either accepted or rejected as a whole
+	events := make([]persistence.InboundEvent, len(batch.Events))
+	for i, evt := range batch.Events {
+		eventID, status, err := rt.validateInboundEvent(c, evt, maxSize)
+		if err != nil {
+			newJSONError(fmt.Errorf("router: invalid event at index %d: %w", i, err), status).Pipe(c)
 			return
 		}
+		events[i] = persistence.InboundEvent{AccountID: evt.AccountID, Payload: evt.Payload, EventID: eventID}
+	}
 
-		var unknownSecretErr persistence.ErrUnknownSecret
-		if errors.As(err, &unknownSecretErr) {
-			newJSONError(
-				fmt.Errorf("router: error inserting event: %w", unknownSecretErr),
-				http.StatusBadRequest,
-			).Pipe(c)
+	if err := rt.database(c).InsertBatch(userID, events); err != nil {
+		if resp := insertErrorResponse(c, err); resp != nil {
+			resp.Pipe(c)
 			return
 		}
+		for _, evt := range events {
+			if !rt.storeDeadLetter(c, err, userID, evt.AccountID, evt.Payload, evt.EventID) {
+				newJSONError(
+					fmt.Errorf("router: error persisting events: %w", err),
+					http.StatusInternalServerError,
+				).Pipe(c)
+				return
+			}
+		}
+	}
+	rt.ackEvents(c, userID, anonymous)
+}
 
+// ingestThrottleKey returns the key requests posting events are throttled
+// by. Anonymous requests do not carry a user id, so they are throttled using
+// the client's address instead.
+func ingestThrottleKey(c *gin.Context) string {
+	if c.GetBool(contextKeyAnonymous) {
+		return c.ClientIP()
+	}
+	return c.GetString(contextKeyCookie)
+}
+
+// limitRequestBody rejects requests that announce a body larger than limit
+// and limits reading the body to limit bytes otherwise. In case the request
+// has been rejected, false is returned.
+func limitRequestBody(c *gin.Context, limit int64) bool {
+	if c.Request.ContentLength > limit {
 		newJSONError(
-			fmt.Errorf("router: error persisting event: %v", err),
-			http.StatusInternalServerError,
+			fmt.Errorf("router: request body exceeds maximum size of %d bytes", limit),
+			http.StatusRequestEntityTooLarge,
 		).Pipe(c)
+		return false
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	return true
+}
+
+// bindLimitedJSON decodes the JSON body of the request into obj. Bodies that
+// turn out to exceed the limit set by limitRequestBody while being read,
+// e.g. when using chunked encoding, are rejected with a status of 413. In
+// case the request has been rejected, false is returned.
+func bindLimitedJSON(c *gin.Context, obj interface{}) bool {
+	err := c.ShouldBindJSON(obj)
+	if err == nil {
+		return true
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		newJSONError(
+			fmt.Errorf("router: request body exceeds maximum size of %d bytes", maxBytesErr.Limit),
+			http.StatusRequestEntityTooLarge,
+		).Pipe(c)
+		return false
+	}
+	newJSONError(
+		fmt.Errorf("router: error decoding request payload: %w", err),
+		http.StatusBadRequest,
+	).Pipe(c)
+	return false
+}
+
+// validateInboundEvent checks whether the given event can be inserted. It
+// returns the client generated event id in case one has been given. In case
+// the event is invalid, the status code to respond with is returned along
+// with the error.
+func (rt *router) validateInboundEvent(c *gin.Context, evt inboundEventPayload, maxSize int) (*string, int, error) {
+	if err := rt.checkOrigin(c, evt.AccountID); err != nil {
+		var originMismatchErr errOriginMismatch
+		if errors.As(err, &originMismatchErr) {
+			return nil, http.StatusForbidden, err
+		}
+		var unknownAccountErr persistence.ErrUnknownAccount
+		if errors.As(err, &unknownAccountErr) {
+			return nil, http.StatusNotFound, err
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if maxSize > 0 && len(evt.Payload) > maxSize {
+		return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("router: event payload exceeds maximum size of %d bytes", maxSize)
+	}
+
+	// the server cannot decrypt event payloads, but it can still make sure
+	// it does not persist values that no client will ever be able to decrypt
+	if err := keys.ValidateSymmetricCipher(evt.Payload); err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("router: received malformed event payload: %w", err)
+	}
+
+	if evt.EventID == "" {
+		return nil, 0, nil
+	}
+	if err := persistence.ValidateClientEventID(evt.EventID); err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("router: received invalid event id: %w", err)
+	}
+	eventID := evt.EventID
+	return &eventID, 0, nil
+}
+
+// insertErrorResponse returns the response for errors caused by events that
+// cannot be inserted. In case the given error is not caused by the events,
+// nil is returned.
+func insertErrorResponse(c *gin.Context, err error) *errorResponse {
+	var unknownAccountErr persistence.ErrUnknownAccount
+	if errors.As(err, &unknownAccountErr) {
+		return newJSONError(
+			fmt.Errorf("router: error inserting event: %w", unknownAccountErr),
+			http.StatusNotFound,
+		)
+	}
+
+	var duplicateEventErr persistence.ErrDuplicateEvent
+	if errors.As(err, &duplicateEventErr) {
+		return newJSONError(
+			fmt.Errorf("router: error inserting event: %w", duplicateEventErr),
+			http.StatusConflict,
+		)
+	}
+
+	var rejectedErr persistence.ErrEventRejected
+	if errors.As(err, &rejectedErr) {
+		return newJSONError(
+			fmt.Errorf("router: error inserting event: %w", rejectedErr),
+			http.StatusForbidden,
+		)
+	}
+
+	// quotas are reset at midnight UTC, so clients know when they can
+	// start sending events again
+	var quotaExceededErr persistence.ErrQuotaExceeded
+	if errors.As(err, &quotaExceededErr) {
+		now := time.Now().UTC()
+		retryAfter := int(now.Truncate(time.Hour*24).Add(time.Hour*24).Sub(now).Seconds()) + 1
+		c.Header("Retry-After", fmt.Sprintf("%d", retryAfter))
+		resp := newJSONError(
+			fmt.Errorf("router: error inserting event: %w", quotaExceededErr),
+			http.StatusTooManyRequests,
+		)
+		resp.RetryAfter = retryAfter
+		return resp
+	}
+
+	// a full buffer means the database cannot keep up, so clients need
+	// to back off instead of events being written to the dead letter file
+	if errors.Is(err, persistence.ErrInsertBufferFull) {
+		c.Header("Retry-After", "1")
+		return newJSONError(
+			fmt.Errorf("router: error inserting event: %w", err),
+			http.StatusServiceUnavailable,
+		)
+	}
+
+	var unknownSecretErr persistence.ErrUnknownSecret
+	if errors.As(err, &unknownSecretErr) {
+		return newJSONError(
+			fmt.Errorf("router: error inserting event: %w", unknownSecretErr),
+			http.StatusBadRequest,
+		)
+	}
+	return nil
+}
+
+// ackEvents acknowledges events that have been accepted and refreshes the
+// user id of users that are not anonymous.
+func (rt *router) ackEvents(c *gin.Context, userID string, anonymous bool) {
+	if anonymous {
+		c.JSON(http.StatusCreated, ackResponse{true})
 		return
 	}
 
-	http.SetCookie(
-		c.Writer,
-		rt.userCookie(userID, c.GetBool(contextKeySecureContext)),
-	)
+	if err := rt.writeUserID(c, userID); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error writing user id: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
 	c.JSON(http.StatusCreated, ackResponse{true})
 }
 
@@ -85,18 +329,51 @@ func (rt *router) getEvents(c *gin.Context) {
 		).Pipe(c)
 		return
 	}
-	result, err := rt.db.Query(persistence.Query{
+	if since := c.Query("since"); since != "" {
+		if err := persistence.ValidateEventID(since); err != nil {
+			newJSONError(
+				fmt.Errorf("router: invalid value for since parameter: %w", err),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+	}
+	result, stream, err := rt.database(c).StreamQuery(persistence.Query{
 		UserID: userID,
 		Since:  c.Query("since"),
 	})
 	if err != nil {
 		newJSONError(
-			fmt.Errorf("router: error performing event query: %v", err),
+			fmt.Errorf("router: error performing event query: %w", err),
 			http.StatusInternalServerError,
 		).Pipe(c)
 		return
 	}
-	c.JSON(http.StatusOK, result)
+
+	// clients poll for new events frequently, so unchanged results are not
+	// transferred again
+	etag := eventsETag(c.Query("since"), result, stream.Count)
+	c.Header("Etag", etag)
+	c.Header("Cache-Control", "private, no-cache")
+	if match := c.GetHeader("If-None-Match"); match != "" && strings.Contains(match, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	rt.streamEvents(c, stream, func() interface{} {
+		return result
+	})
+}
+
+// eventsETag computes an ETag for the given result of querying the given
+// number of events without having to read the events. The latest sequence
+// changes whenever events are added or deleted by the user, the number of
+// events changes when events expire.
+func eventsETag(since string, result persistence.EventsResult, count int) string {
+	checksum := sha256.Sum256([]byte(fmt.Sprintf(
+		"%s-%s-%d-%d", since, result.Sequence, count, len(result.DeletedEvents),
+	)))
+	return fmt.Sprintf(`"%s"`, hex.EncodeToString(checksum[:16]))
 }
 
 func (rt *router) purgeEvents(c *gin.Context) {
@@ -108,18 +385,100 @@ func (rt *router) purgeEvents(c *gin.Context) {
 		).Pipe(c)
 		return
 	}
-	if err := rt.db.Purge(userID); err != nil {
+	// in case account ids are given, only data for these accounts is purged
+	accountIDs := c.QueryArray("accountId")
+
+	// users with a huge number of events can request the purge to be
+	// performed in the background so their requests do not time out
+	if c.Query("async") != "" {
+		rt.enqueuePurge(c, userID, accountIDs)
+		return
+	}
+	if err := rt.database(c).Purge(userID, accountIDs); err != nil {
 		newJSONError(
-			fmt.Errorf("router: error purging user events: %v", err),
+			fmt.Errorf("router: error purging user events: %w", err),
 			http.StatusInternalServerError,
 		).Pipe(c)
 		return
 	}
-	if c.Query("user") != "" {
-		http.SetCookie(
-			c.Writer,
-			rt.userCookie("", c.GetBool(contextKeySecureContext)),
-		)
+	// the user id is only forgotten when all of the user's data has been
+	// purged, as it is still needed for accessing the remaining accounts
+	if c.Query("user") != "" && len(accountIDs) == 0 {
+		rt.writeUserID(c, "")
 	}
 	c.Status(http.StatusNoContent)
 }
+
+func (rt *router) getExport(c *gin.Context) {
+	userID := c.GetString(contextKeyCookie)
+	if l := <-rt.getLimiter().LinearThrottle(time.Second*5, fmt.Sprintf("getExport-%s", userID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+	result, err := rt.database(c).Export(userID)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error exporting user data: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.Header(
+		"Content-Disposition",
+		fmt.Sprintf(`attachment; filename="offen-export-%s.json"`, result.Created.Format("2006-01-02")),
+	)
+	c.JSON(http.StatusOK, result)
+}
+
+// suppressDuplicateEvent reports whether the same event has already been
+// received within the configured suppression window. The returned func
+// can be used to forget about the event again in case it could not be
+// persisted.
+func (rt *router) suppressDuplicateEvent(userID, accountID, payload string) (bool, func()) {
+	duplicates := rt.getDuplicates()
+	if duplicates == nil {
+		return false, func() {}
+	}
+	checksum := sha256.Sum256([]byte(fmt.Sprintf("%s-%s-%s", userID, accountID, payload)))
+	key := hex.EncodeToString(checksum[:])
+	if err := duplicates.Add(key, true, cache.DefaultExpiration); err != nil {
+		return true, func() {}
+	}
+	return false, func() {
+		duplicates.Delete(key)
+	}
+}
+
+// storeDeadLetter keeps an event that could not be persisted so it can be
+// replayed later on. It reports whether the event has been stored.
+func (rt *router) storeDeadLetter(c *gin.Context, err error, userID, accountID, payload string, eventID *string) bool {
+	if rt.deadLetters == nil {
+		return false
+	}
+	// the event id is fixed at the time of receiving the event, which also
+	// makes it safe to replay the same entry more than once
+	entry := deadletter.Entry{
+		UserID:     userID,
+		AccountID:  accountID,
+		Payload:    payload,
+		ReceivedAt: time.Now(),
+	}
+	if eventID != nil {
+		entry.EventID = *eventID
+	} else {
+		id, idErr := persistence.NewULID()
+		if idErr != nil {
+			return false
+		}
+		entry.EventID = id
+	}
+	if writeErr := rt.deadLetters.Write(entry); writeErr != nil {
+		rt.logError(c, writeErr, "error writing event to dead letter file")
+		return false
+	}
+	rt.logError(c, err, "error persisting event, wrote event to dead letter file")
+	return true
+}
@@ -5,13 +5,20 @@ package router
 
 import (
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/deadletter"
 	"github.com/offen/offen/server/persistence"
 )
 
@@ -21,30 +28,72 @@ func strptr(s string) *string {
 
 type mockPurgeEventsService struct {
 	persistence.Service
-	err error
+	err  error
+	lock sync.Mutex
+	jobs map[string]persistence.PurgeJobResult
 }
 
-func (m *mockPurgeEventsService) Purge(string) error {
+func (m *mockPurgeEventsService) Purge(string, []string) error {
 	return m.err
 }
 
+func (m *mockPurgeEventsService) UpdatePurgeJob(purgeID, status string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.jobs == nil {
+		m.jobs = map[string]persistence.PurgeJobResult{}
+	}
+	m.jobs[purgeID] = persistence.PurgeJobResult{PurgeID: purgeID, Status: status, Updated: time.Now()}
+	return nil
+}
+
+func (m *mockPurgeEventsService) GetPurgeJob(purgeID string) (persistence.PurgeJobResult, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	job, ok := m.jobs[purgeID]
+	if !ok {
+		return persistence.PurgeJobResult{}, persistence.ErrUnknownPurge("unknown purge")
+	}
+	return job, nil
+}
+
 func TestRouter_purgeEvents(t *testing.T) {
 	tests := []struct {
-		name           string
-		db             persistence.Service
-		expectedStatus int
+		name            string
+		db              persistence.Service
+		query           string
+		expectedStatus  int
+		expectedCleared bool
 	}{
 		{
 			"not ok",
 			&mockPurgeEventsService{
 				err: errors.New("did not work"),
 			},
+			"",
 			http.StatusInternalServerError,
+			false,
 		},
 		{
 			"ok",
 			&mockPurgeEventsService{},
+			"",
+			http.StatusNoContent,
+			false,
+		},
+		{
+			"forget user",
+			&mockPurgeEventsService{},
+			"?user=1",
+			http.StatusNoContent,
+			true,
+		},
+		{
+			"forget user scoped to accounts",
+			&mockPurgeEventsService{},
+			"?user=1&accountId=account-a",
 			http.StatusNoContent,
+			false,
 		},
 	}
 
@@ -52,7 +101,9 @@ func TestRouter_purgeEvents(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			m := gin.New()
 			rt := router{
-				db: test.db,
+				db:      test.db,
+				config:  &config.Config{},
+				signers: newSigners([]byte("abc"), 0),
 			}
 			m.POST("/", func(c *gin.Context) {
 				c.Set(contextKeyCookie, "user-id")
@@ -60,13 +111,16 @@ func TestRouter_purgeEvents(t *testing.T) {
 			}, rt.purgeEvents)
 
 			w := httptest.NewRecorder()
-			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r := httptest.NewRequest(http.MethodPost, "/"+test.query, nil)
 
 			m.ServeHTTP(w, r)
 
 			if w.Code != test.expectedStatus {
 				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
 			}
+			if cleared := w.Header().Get("Set-Cookie") != ""; cleared != test.expectedCleared {
+				t.Errorf("Unexpected cookie header %v", w.Header().Get("Set-Cookie"))
+			}
 		})
 	}
 }
@@ -77,27 +131,62 @@ type mockGetEventsService struct {
 	err    error
 }
 
-func (m *mockGetEventsService) Query(persistence.Query) (persistence.EventsResult, error) {
-	return m.result, m.err
+func (m *mockGetEventsService) StreamQuery(persistence.Query) (persistence.EventsResult, *persistence.EventsStream, error) {
+	if m.err != nil {
+		return persistence.EventsResult{}, nil, m.err
+	}
+	result := m.result
+	events := persistence.EventsByAccountID{}
+	if result.Events != nil {
+		events = *result.Events
+	}
+	result.Events = nil
+	return result, persistence.NewEventsStream(events), nil
 }
 
 func TestRouter_getEvents(t *testing.T) {
 	tests := []struct {
 		name           string
+		query          string
 		db             persistence.Service
 		expectedStatus int
 		expectedBody   string
 	}{
 		{
 			"database error",
+			"",
 			&mockGetEventsService{
 				err: errors.New("did not work"),
 			},
 			http.StatusInternalServerError,
 			"",
 		},
+		{
+			"unknown account",
+			"",
+			&mockGetEventsService{
+				err: persistence.ErrUnknownAccount("did not work"),
+			},
+			http.StatusInternalServerError,
+			`"code":"UNKNOWN_ACCOUNT"`,
+		},
+		{
+			"bad since",
+			"?since=event-a",
+			&mockGetEventsService{},
+			http.StatusBadRequest,
+			"",
+		},
+		{
+			"since in the future",
+			"?since=7ZZZZZZZZZZZZZZZZZZZZZZZZZ",
+			&mockGetEventsService{},
+			http.StatusBadRequest,
+			"",
+		},
 		{
 			"StatusOK",
+			"?since=01F4Z2Q4B5C6D7E8F9G0H1J2K0",
 			&mockGetEventsService{
 				result: persistence.EventsResult{
 					Events: &persistence.EventsByAccountID{
@@ -124,7 +213,7 @@ func TestRouter_getEvents(t *testing.T) {
 			}, rt.getEvents)
 
 			w := httptest.NewRecorder()
-			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r := httptest.NewRequest(http.MethodGet, "/"+test.query, nil)
 
 			m.ServeHTTP(w, r)
 
@@ -141,6 +230,63 @@ func TestRouter_getEvents(t *testing.T) {
 	}
 }
 
+func TestRouter_getEvents_ETag(t *testing.T) {
+	db := &mockGetEventsService{
+		result: persistence.EventsResult{
+			Events: &persistence.EventsByAccountID{
+				"account-a": []persistence.EventResult{
+					{AccountID: "account-a", EventID: "event-a", Payload: "payload"},
+				},
+			},
+			Sequence: "sequence-a",
+		},
+	}
+	rt := router{db: db}
+	m := gin.New()
+	m.GET("/", func(c *gin.Context) {
+		c.Set(contextKeyCookie, "user-id")
+		c.Next()
+	}, rt.getEvents)
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code %d", w.Code)
+	}
+	etag := w.Header().Get("Etag")
+	if etag == "" {
+		t.Fatal("Expected Etag header to be set")
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("If-None-Match", etag)
+	m.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotModified, w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("Unexpected response body %s", w.Body.String())
+	}
+
+	db.result.DeletedEvents = []string{"event-z"}
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("If-None-Match", etag)
+	m.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d after result changed, got %d", http.StatusOK, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/?since=01F4Z2Q4B5C6D7E8F9G0H1J2K0", nil)
+	r.Header.Set("If-None-Match", etag)
+	m.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d for different query, got %d", http.StatusOK, w.Code)
+	}
+}
+
 type mockPostEventsService struct {
 	persistence.Service
 	err error
@@ -151,6 +297,7 @@ func (m *mockPostEventsService) Insert(string, string, string, *string) error {
 }
 
 func TestRouter_postEvents(t *testing.T) {
+	eventID, _ := persistence.NewULID()
 	tests := []struct {
 		name           string
 		db             persistence.Service
@@ -165,12 +312,19 @@ func TestRouter_postEvents(t *testing.T) {
 			http.StatusBadRequest,
 			"",
 		},
+		{
+			"malformed event payload",
+			&mockPostEventsService{},
+			`{"accountId":"account-a","payload":"some-payload"}`,
+			http.StatusBadRequest,
+			"",
+		},
 		{
 			"database error",
 			&mockPostEventsService{
 				err: errors.New("did not work"),
 			},
-			`{"accountId":"account-a","payload":"some-payload"}`,
+			`{"accountId":"account-a","payload":"{1,} AAAAAAAAAAAAAAAAAAAAAA== AAAAAAAAAAAAAAAA"}`,
 			http.StatusInternalServerError,
 			"",
 		},
@@ -179,7 +333,7 @@ func TestRouter_postEvents(t *testing.T) {
 			&mockPostEventsService{
 				err: persistence.ErrUnknownAccount("unknown account"),
 			},
-			`{"accountId":"account-a","payload":"some-payload"}`,
+			`{"accountId":"account-a","payload":"{1,} AAAAAAAAAAAAAAAAAAAAAA== AAAAAAAAAAAAAAAA"}`,
 			http.StatusNotFound,
 			"",
 		},
@@ -188,26 +342,285 @@ func TestRouter_postEvents(t *testing.T) {
 			&mockPostEventsService{
 				err: persistence.ErrUnknownSecret("unknown secret"),
 			},
-			`{"accountId":"account-a","payload":"some-payload"}`,
+			`{"accountId":"account-a","payload":"{1,} AAAAAAAAAAAAAAAAAAAAAA== AAAAAAAAAAAAAAAA"}`,
 			http.StatusBadRequest,
 			"",
 		},
+		{
+			"insert buffer full",
+			&mockPostEventsService{
+				err: persistence.ErrInsertBufferFull,
+			},
+			`{"accountId":"account-a","payload":"{1,} AAAAAAAAAAAAAAAAAAAAAA== AAAAAAAAAAAAAAAA"}`,
+			http.StatusServiceUnavailable,
+			`"code":"SERVICE_UNAVAILABLE"`,
+		},
+		{
+			"rejected by hook",
+			&mockPostEventsService{
+				err: persistence.ErrEventRejected("rejected"),
+			},
+			`{"accountId":"account-a","payload":"{1,} AAAAAAAAAAAAAAAAAAAAAA== AAAAAAAAAAAAAAAA"}`,
+			http.StatusForbidden,
+			`"code":"EVENT_REJECTED"`,
+		},
+		{
+			"quota exceeded",
+			&mockPostEventsService{
+				err: persistence.ErrQuotaExceeded("quota exceeded"),
+			},
+			`{"accountId":"account-a","payload":"{1,} AAAAAAAAAAAAAAAAAAAAAA== AAAAAAAAAAAAAAAA"}`,
+			http.StatusTooManyRequests,
+			`"code":"QUOTA_EXCEEDED"`,
+		},
+		{
+			"invalid event id",
+			&mockPostEventsService{},
+			`{"accountId":"account-a","payload":"{1,} AAAAAAAAAAAAAAAAAAAAAA== AAAAAAAAAAAAAAAA","eventId":"event-a"}`,
+			http.StatusBadRequest,
+			"",
+		},
+		{
+			"backdated event id",
+			&mockPostEventsService{},
+			`{"accountId":"account-a","payload":"{1,} AAAAAAAAAAAAAAAAAAAAAA== AAAAAAAAAAAAAAAA","eventId":"01F4Z2Q4B5C6D7E8F9G0H1J2K0"}`,
+			http.StatusBadRequest,
+			"",
+		},
+		{
+			"duplicate event id",
+			&mockPostEventsService{
+				err: persistence.ErrDuplicateEvent("duplicate event"),
+			},
+			fmt.Sprintf(`{"accountId":"account-a","payload":"{1,} AAAAAAAAAAAAAAAAAAAAAA== AAAAAAAAAAAAAAAA","eventId":"%s"}`, eventID),
+			http.StatusConflict,
+			"",
+		},
 		{
 			"ok",
 			&mockPostEventsService{},
-			`{"accountId":"account-a","payload":"some-payload"}`,
+			`{"accountId":"account-a","payload":"{1,} AAAAAAAAAAAAAAAAAAAAAA== AAAAAAAAAAAAAAAA"}`,
 			http.StatusCreated,
 			`{"ack":true}`,
 		},
+		{
+			"ok with event id",
+			&mockPostEventsService{},
+			fmt.Sprintf(`{"accountId":"account-a","payload":"{1,} AAAAAAAAAAAAAAAAAAAAAA== AAAAAAAAAAAAAAAA","eventId":"%s"}`, eventID),
+			http.StatusCreated,
+			`{"ack":true}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := gin.New()
+			rt := router{
+				db:      test.db,
+				config:  &config.Config{},
+				signers: newSigners([]byte("abc"), 0),
+			}
+			m.POST("/", func(c *gin.Context) {
+				c.Set(contextKeyCookie, "user-id")
+				c.Set(contextKeySecureContext, false)
+				c.Next()
+			}, rt.postEvents)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+
+			m.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
+			}
+
+			if test.expectedBody != "" {
+				if !strings.Contains(w.Body.String(), test.expectedBody) {
+					t.Errorf("Expected response body %s to contain %s", w.Body.String(), test.expectedBody)
+				}
+			}
+		})
+	}
+}
+
+type mockPostEventsBatchService struct {
+	persistence.Service
+	err    error
+	events []persistence.InboundEvent
+}
+
+func (m *mockPostEventsBatchService) InsertBatch(userID string, events []persistence.InboundEvent) error {
+	m.events = events
+	return m.err
+}
+
+func TestRouter_postEventsBatch(t *testing.T) {
+	eventID, _ := persistence.NewULID()
+	validEvent := `{"accountId":"account-a","payload":"{1,} AAAAAAAAAAAAAAAAAAAAAA== AAAAAAAAAAAAAAAA"}`
+	tests := []struct {
+		name           string
+		db             *mockPostEventsBatchService
+		body           string
+		expectedStatus int
+		expectedEvents int
+	}{
+		{
+			"bad payload",
+			&mockPostEventsBatchService{},
+			"o hai!",
+			http.StatusBadRequest,
+			0,
+		},
+		{
+			"empty batch",
+			&mockPostEventsBatchService{},
+			`{"events":[]}`,
+			http.StatusBadRequest,
+			0,
+		},
+		{
+			"batch too large",
+			&mockPostEventsBatchService{},
+			fmt.Sprintf(`{"events":[%s]}`, strings.TrimSuffix(strings.Repeat(validEvent+",", maxEventBatchSize+1), ",")),
+			http.StatusBadRequest,
+			0,
+		},
+		{
+			"malformed event payload",
+			&mockPostEventsBatchService{},
+			fmt.Sprintf(`{"events":[%s,{"accountId":"account-a","payload":"some-payload"}]}`, validEvent),
+			http.StatusBadRequest,
+			0,
+		},
+		{
+			"quota exceeded",
+			&mockPostEventsBatchService{
+				err: persistence.ErrQuotaExceeded("quota exceeded"),
+			},
+			fmt.Sprintf(`{"events":[%s]}`, validEvent),
+			http.StatusTooManyRequests,
+			1,
+		},
+		{
+			"database error",
+			&mockPostEventsBatchService{
+				err: errors.New("did not work"),
+			},
+			fmt.Sprintf(`{"events":[%s]}`, validEvent),
+			http.StatusInternalServerError,
+			1,
+		},
+		{
+			"ok",
+			&mockPostEventsBatchService{},
+			fmt.Sprintf(`{"events":[%s,{"accountId":"account-a","payload":"{1,} AAAAAAAAAAAAAAAAAAAAAA== AAAAAAAAAAAAAAAA","eventId":"%s"}]}`, validEvent, eventID),
+			http.StatusCreated,
+			2,
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			m := gin.New()
 			rt := router{
-				db:     test.db,
-				config: &config.Config{},
+				db:      test.db,
+				config:  &config.Config{},
+				signers: newSigners([]byte("abc"), 0),
 			}
+			m.POST("/", func(c *gin.Context) {
+				c.Set(contextKeyCookie, "user-id")
+				c.Set(contextKeySecureContext, false)
+				c.Next()
+			}, rt.postEventsBatch)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+
+			m.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
+			}
+			if len(test.db.events) != test.expectedEvents {
+				t.Errorf("Expected %d events to be inserted, got %v", test.expectedEvents, test.db.events)
+			}
+		})
+	}
+}
+
+func TestRouter_postEvents_Anonymous(t *testing.T) {
+	m := gin.New()
+	rt := router{
+		db:      &mockPostEventsService{},
+		config:  &config.Config{},
+		signers: newSigners([]byte("abc"), 0),
+	}
+	m.POST("/", func(c *gin.Context) {
+		c.Set(contextKeyAnonymous, true)
+		c.Next()
+	}, rt.postEvents)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"accountId":"account-a","payload":"{1,} AAAAAAAAAAAAAAAAAAAAAA== AAAAAAAAAAAAAAAA"}`))
+	m.ServeHTTP(w, r)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("Unexpected status code %d", w.Code)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("Unexpected cookies %v", cookies)
+	}
+}
+
+func TestRouter_postEvents_MaxPayloadSize(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		chunked        bool
+		expectedStatus int
+	}{
+		{
+			"ok",
+			`{"accountId":"account-a","payload":"{1,} AAAAAAAAAAAAAAAAAAAAAA== AAAAAAAAAAAAAAAA"}`,
+			false,
+			http.StatusCreated,
+		},
+		{
+			"payload too large",
+			fmt.Sprintf(`{"accountId":"account-a","payload":"{1,} %s AAAAAAAAAAAAAAAA"}`, strings.Repeat("A", 64)),
+			false,
+			http.StatusRequestEntityTooLarge,
+		},
+		{
+			"body too large",
+			fmt.Sprintf(`{"accountId":"%s","payload":"{1,} AAAAAAAAAAAAAAAAAAAAAA== AAAAAAAAAAAAAAAA"}`, strings.Repeat("a", 2048)),
+			false,
+			http.StatusRequestEntityTooLarge,
+		},
+		{
+			"chunked body too large",
+			fmt.Sprintf(`{"accountId":"%s","payload":"{1,} AAAAAAAAAAAAAAAAAAAAAA== AAAAAAAAAAAAAAAA"}`, strings.Repeat("a", 2048)),
+			true,
+			http.StatusRequestEntityTooLarge,
+		},
+		{
+			"bad payload",
+			`{"accountId":`,
+			true,
+			http.StatusBadRequest,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.App.MaxEventPayloadSize = 64
+			rt := router{
+				db:      &mockPostEventsService{},
+				config:  cfg,
+				signers: newSigners([]byte("abc"), 0),
+			}
+			m := gin.New()
 			m.POST("/", func(c *gin.Context) {
 				c.Set(contextKeyCookie, "user-id")
 				c.Set(contextKeySecureContext, false)
@@ -216,6 +629,166 @@ func TestRouter_postEvents(t *testing.T) {
 
 			w := httptest.NewRecorder()
 			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+			if test.chunked {
+				// requests using chunked encoding do not announce their length
+				r.ContentLength = -1
+			}
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
+			}
+			if w.Code == http.StatusRequestEntityTooLarge && !strings.Contains(w.Body.String(), errorCodePayloadTooLarge) {
+				t.Errorf("Expected error code in body, got %s", w.Body.String())
+			}
+		})
+	}
+}
+
+type mockCountingPostEventsService struct {
+	persistence.Service
+	inserts int
+	err     error
+}
+
+func (m *mockCountingPostEventsService) Insert(string, string, string, *string) error {
+	m.inserts++
+	return m.err
+}
+
+func TestRouter_postEvents_DuplicateEventWindow(t *testing.T) {
+	db := &mockCountingPostEventsService{}
+	cfg := &config.Config{}
+	cfg.App.DuplicateEventWindow = time.Minute
+	rt := router{
+		db:      db,
+		config:  cfg,
+		signers: newSigners([]byte("abc"), 0),
+	}
+	m := gin.New()
+	m.POST("/", func(c *gin.Context) {
+		c.Set(contextKeyCookie, c.Query("user"))
+		c.Set(contextKeySecureContext, false)
+		c.Next()
+	}, rt.postEvents)
+
+	post := func(user, body string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/?user="+user, strings.NewReader(body))
+		m.ServeHTTP(w, r)
+		return w.Code
+	}
+	body := `{"accountId":"account-a","payload":"{1,} AAAAAAAAAAAAAAAAAAAAAA== AAAAAAAAAAAAAAAA"}`
+	otherBody := `{"accountId":"account-a","payload":"{1,} AQAAAAAAAAAAAAAAAAAAAA== AAAAAAAAAAAAAAAA"}`
+
+	db.err = errors.New("did not work")
+	if code := post("user-a", body); code != http.StatusInternalServerError {
+		t.Errorf("Unexpected status code %d", code)
+	}
+	db.err = nil
+
+	for _, code := range []int{post("user-a", body), post("user-a", body), post("user-b", body), post("user-a", otherBody)} {
+		if code != http.StatusCreated {
+			t.Errorf("Unexpected status code %d", code)
+		}
+	}
+	if db.inserts != 4 {
+		t.Errorf("Expected duplicate event to be dropped, got %d inserts", db.inserts)
+	}
+}
+
+func TestRouter_postEvents_DeadLetters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletters")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	deadLetters := deadletter.New(filepath.Join(dir, "events"))
+	rt := router{
+		db:          &mockPostEventsService{err: errors.New("did not work")},
+		config:      &config.Config{},
+		signers:     newSigners([]byte("abc"), 0),
+		deadLetters: deadLetters,
+	}
+	m := gin.New()
+	m.POST("/", func(c *gin.Context) {
+		c.Set(contextKeyCookie, "user-id")
+		c.Set(contextKeySecureContext, false)
+		c.Next()
+	}, rt.postEvents)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"accountId":"account-a","payload":"{1,} AAAAAAAAAAAAAAAAAAAAAA== AAAAAAAAAAAAAAAA"}`))
+	m.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Errorf("Unexpected status code %d", w.Code)
+	}
+
+	var entries []deadletter.Entry
+	if _, _, err := deadLetters.Replay(func(e deadletter.Entry) error {
+		entries = append(entries, e)
+		return nil
+	}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(entries) != 1 || entries[0].UserID != "user-id" || entries[0].AccountID != "account-a" || entries[0].EventID == "" {
+		t.Errorf("Unexpected dead letter entries %v", entries)
+	}
+}
+
+type mockGetExportService struct {
+	persistence.Service
+	result persistence.ExportResult
+	err    error
+}
+
+func (m *mockGetExportService) Export(string) (persistence.ExportResult, error) {
+	return m.result, m.err
+}
+
+func TestRouter_getExport(t *testing.T) {
+	tests := []struct {
+		name           string
+		db             persistence.Service
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			"database error",
+			&mockGetExportService{
+				err: errors.New("did not work"),
+			},
+			http.StatusInternalServerError,
+			"",
+		},
+		{
+			"ok",
+			&mockGetExportService{
+				result: persistence.ExportResult{
+					UserID: "user-id",
+					Accounts: []persistence.ExportAccountResult{
+						{AccountID: "account-a", SecretID: "hashed-user-a", EncryptedUserSecret: "secret", Events: []persistence.ExportEventResult{}},
+					},
+				},
+			},
+			http.StatusOK,
+			`"accounts":[{"accountId":"account-a","secretId":"hashed-user-a","encryptedUserSecret":"secret","events":[]}]`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := gin.New()
+			rt := router{
+				db: test.db,
+			}
+			m.GET("/", func(c *gin.Context) {
+				c.Set(contextKeyCookie, "user-id")
+				c.Next()
+			}, rt.getExport)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
 
 			m.ServeHTTP(w, r)
 
@@ -227,6 +800,9 @@ func TestRouter_postEvents(t *testing.T) {
 				if !strings.Contains(w.Body.String(), test.expectedBody) {
 					t.Errorf("Expected response body %s to contain %s", w.Body.String(), test.expectedBody)
 				}
+				if !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment") {
+					t.Errorf("Unexpected Content-Disposition header %s", w.Header().Get("Content-Disposition"))
+				}
 			}
 		})
 	}
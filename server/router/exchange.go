@@ -4,9 +4,14 @@
 package router
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,7 +20,7 @@ import (
 )
 
 func (rt *router) getPublicKey(c *gin.Context) {
-	account, err := rt.db.GetAccount(c.Query("accountId"), false, "")
+	account, err := rt.database(c).GetAccount(c.Query("accountId"), false, "")
 	if err != nil {
 		var unknownAccountErr persistence.ErrUnknownAccount
 		if errors.As(err, &unknownAccountErr) {
@@ -31,25 +36,58 @@ func (rt *router) getPublicKey(c *gin.Context) {
 		).Pipe(c)
 		return
 	}
-	c.JSON(http.StatusOK, account)
+
+	// the public key is requested by the script on every page load, but
+	// only changes when the account's keys are rotated, so it can be cached
+	// for a short amount of time and revalidated afterwards
+	writeCacheableJSON(c, account, publicKeyMaxAge)
 }
 
+// writeCacheableJSON writes the given value as JSON, allowing clients to
+// cache it for the given duration and revalidate it using its Etag.
+func writeCacheableJSON(c *gin.Context, value interface{}, maxAge time.Duration) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error encoding response: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	checksum := sha256.Sum256(body)
+	etag := fmt.Sprintf(`"%s"`, hex.EncodeToString(checksum[:16]))
+	c.Header("Etag", etag)
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+	if match := c.GetHeader("If-None-Match"); match != "" && strings.Contains(match, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	if c.Request.Method == http.MethodHead {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.Header("Content-Length", strconv.Itoa(len(body)))
+		c.Status(http.StatusOK)
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// publicKeyMaxAge is the duration clients are allowed to cache an account's
+// public key before revalidating it.
+const publicKeyMaxAge = time.Minute * 5
+
 type userSecretPayload struct {
 	EncryptedUserSecret string `json:"encryptedSecret"`
 	AccountID           string `json:"accountId"`
 }
 
 func (rt *router) postUserSecret(c *gin.Context) {
-	var userID string
-
-	ck, err := c.Request.Cookie(cookieKey)
-	if err == nil {
-		userID = ck.Value
-	} else {
+	// a user id that cannot be verified is replaced with a new identifier
+	userID, err := rt.readUserID(c)
+	if err != nil {
 		newID, newIDErr := uuid.NewV4()
 		if newIDErr != nil {
 			newJSONError(
-				fmt.Errorf("router: error generating new user id: %v", newIDErr),
+				fmt.Errorf("router: error generating new user id: %w", newIDErr),
 				http.StatusInternalServerError,
 			).Pipe(c)
 			return
@@ -60,7 +98,7 @@ func (rt *router) postUserSecret(c *gin.Context) {
 	payload := userSecretPayload{}
 	if err := c.BindJSON(&payload); err != nil {
 		newJSONError(
-			fmt.Errorf("router: error decoding response body: %v", err),
+			fmt.Errorf("router: error decoding response body: %w", err),
 			http.StatusBadRequest,
 		).Pipe(c)
 		return
@@ -74,17 +112,20 @@ func (rt *router) postUserSecret(c *gin.Context) {
 		return
 	}
 
-	if err := rt.db.AssociateUserSecret(payload.AccountID, userID, payload.EncryptedUserSecret); err != nil {
+	if err := rt.database(c).AssociateUserSecret(payload.AccountID, userID, payload.EncryptedUserSecret); err != nil {
 		newJSONError(
-			fmt.Errorf("router: error associating user secret: %v", err),
+			fmt.Errorf("router: error associating user secret: %w", err),
 			http.StatusBadRequest,
 		).Pipe(c)
 		return
 	}
 
-	http.SetCookie(
-		c.Writer,
-		rt.userCookie(userID, c.GetBool(contextKeySecureContext)),
-	)
+	if err := rt.writeUserID(c, userID); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error writing user id: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
 	c.Status(http.StatusNoContent)
 }
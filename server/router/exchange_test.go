@@ -13,6 +13,7 @@ import (
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/securecookie"
 	"github.com/offen/offen/server/config"
 	"github.com/offen/offen/server/persistence"
 )
@@ -77,6 +78,72 @@ func TestRouter_GetPublicKey(t *testing.T) {
 	}
 }
 
+func TestRouter_GetPublicKey_Caching(t *testing.T) {
+	db := &mockAccountsDatabase{
+		result: persistence.AccountResult{
+			AccountID: "12345",
+			PublicKey: "public-key",
+		},
+	}
+	rt := router{db: db, config: &config.Config{}}
+	m := gin.New()
+	m.GET("/", rt.getPublicKey)
+	m.HEAD("/", rt.getPublicKey)
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?accountId=12345", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code %d", w.Code)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=300" {
+		t.Errorf("Unexpected Cache-Control header %s", cc)
+	}
+	etag := w.Header().Get("Etag")
+	if etag == "" {
+		t.Fatal("Expected Etag header to be set")
+	}
+	body := w.Body.String()
+
+	w = httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/?accountId=12345", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Unexpected status code %d for HEAD request", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("Unexpected body %s for HEAD request", w.Body.String())
+	}
+	if l := w.Header().Get("Content-Length"); l != fmt.Sprintf("%d", len(body)) {
+		t.Errorf("Unexpected Content-Length header %s", l)
+	}
+	if w.Header().Get("Etag") != etag {
+		t.Errorf("Expected Etag %s for HEAD request, got %s", etag, w.Header().Get("Etag"))
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/?accountId=12345", nil)
+	r.Header.Set("If-None-Match", etag)
+	m.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotModified, w.Code)
+	}
+
+	db.result.PublicKey = "rotated-key"
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/?accountId=12345", nil)
+	r.Header.Set("If-None-Match", etag)
+	m.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d after key changed, got %d", http.StatusOK, w.Code)
+	}
+}
+
+var testCookieSigner = securecookie.New([]byte("abc"), nil)
+
+func signedUserID(userID string) string {
+	value, _ := testCookieSigner.Encode(cookieKey, userID)
+	return value
+}
+
 type mockUserSecretDatabase struct {
 	persistence.Service
 	err error
@@ -142,15 +209,31 @@ func TestRouter_PostUserSecret(t *testing.T) {
 			`),
 			&http.Cookie{
 				Name:  cookieKey,
-				Value: "existing-user-id",
+				Value: signedUserID("existing-user-id"),
 			},
 			http.StatusNoContent,
 			func(input string) bool { return input == "existing-user-id" },
 		},
+		{
+			"forged user id",
+			&mockUserSecretDatabase{},
+			strings.NewReader(`
+			{
+				"encrypted_user_secret": "a value",
+				"accountId": "another value"
+			}
+			`),
+			&http.Cookie{
+				Name:  cookieKey,
+				Value: "existing-user-id",
+			},
+			http.StatusNoContent,
+			func(input string) bool { return input != "" && input != "existing-user-id" },
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			rt := router{db: test.db, config: &config.Config{}}
+			rt := router{db: test.db, config: &config.Config{}, signers: newSigners([]byte("abc"), 0)}
 			m := gin.New()
 			m.POST("/", rt.postUserSecret)
 			w := httptest.NewRecorder()
@@ -163,7 +246,9 @@ func TestRouter_PostUserSecret(t *testing.T) {
 			cookies := w.Result().Cookies()
 			for _, cookie := range cookies {
 				if cookie.Name == cookieKey {
-					if !test.expectedUserID(cookie.Value) {
+					var userID string
+					testCookieSigner.Decode(cookieKey, cookie.Value, &userID)
+					if !test.expectedUserID(userID) {
 						t.Errorf("Unexpected cookie value %s", cookie.Value)
 					}
 				}
@@ -171,3 +256,26 @@ func TestRouter_PostUserSecret(t *testing.T) {
 		})
 	}
 }
+
+func TestRouter_PostUserSecret_Cookieless(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.UserCookie.Disabled = true
+	rt := router{db: &mockUserSecretDatabase{}, config: cfg, signers: newSigners([]byte("abc"), 0)}
+	m := gin.New()
+	m.POST("/", rt.postUserSecret)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"accountId": "account-a"}`))
+	r.Header.Set(userHeaderKey, signedUserID("existing-user-id"))
+	m.ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Unexpected status code %d", w.Code)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("Unexpected cookies %v", cookies)
+	}
+	var userID string
+	testCookieSigner.Decode(cookieKey, w.Header().Get(userHeaderKey), &userID)
+	if userID != "existing-user-id" {
+		t.Errorf("Unexpected user id %s", userID)
+	}
+}
@@ -0,0 +1,16 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getFeatures lists all known feature flags and whether they are enabled
+// for the instance.
+func (rt *router) getFeatures(c *gin.Context) {
+	c.JSON(http.StatusOK, rt.features.List())
+}
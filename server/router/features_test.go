@@ -0,0 +1,39 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/features"
+)
+
+func TestRouter_getFeatures(t *testing.T) {
+	flags, _ := features.New("insert-buffer")
+	rt := router{features: flags}
+	m := gin.New()
+	m.GET("/", rt.getFeatures)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	m.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Unexpected status code %v", w.Code)
+	}
+	var result []features.State
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	for _, state := range result {
+		if state.Name == features.InsertBuffer && !state.Enabled {
+			t.Errorf("Expected %s to be enabled", state.Name)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultCSP = "default-src 'self'; style-src 'self' 'unsafe-inline'; img-src 'self' data:"
+	vaultPath  = "/vault"
+)
+
+// securityHeaders contains the response headers that are set for requests
+// to the vault and for all other requests. The Strict-Transport-Security
+// header is only sent in secure contexts.
+type securityHeaders struct {
+	vault    map[string]string
+	fallback map[string]string
+	sts      string
+}
+
+func (s *securityHeaders) forPath(path string) map[string]string {
+	if path == vaultPath || strings.HasPrefix(path, vaultPath+"/") {
+		return s.vault
+	}
+	return s.fallback
+}
+
+// newSecurityHeaders builds the security related response headers from the
+// application configuration. The vault is embedded as an iframe on the sites
+// using Offen, so it can be framed by any origin unless configured otherwise,
+// while all other pages can only be framed by Offen itself.
+func (rt *router) newSecurityHeaders() *securityHeaders {
+	common := map[string]string{
+		"X-Content-Type-Options": "nosniff",
+		"X-XSS-Protection":       "1; mode=block",
+	}
+	if policy := rt.config.Headers.ReferrerPolicy; policy != "" {
+		common["Referrer-Policy"] = policy
+	}
+
+	vaultCSP := rt.config.Headers.VaultContentSecurityPolicy
+	if vaultCSP == "" {
+		ancestors := "*"
+		if len(rt.config.Headers.VaultFrameAncestors) != 0 {
+			ancestors = strings.Join(rt.config.Headers.VaultFrameAncestors, " ")
+		}
+		vaultCSP = defaultCSP + "; frame-ancestors " + ancestors
+	}
+	fallbackCSP := rt.config.Headers.ContentSecurityPolicy
+	if fallbackCSP == "" {
+		fallbackCSP = defaultCSP + "; frame-ancestors 'self'"
+	}
+
+	result := &securityHeaders{
+		vault:    map[string]string{"Content-Security-Policy": vaultCSP},
+		fallback: map[string]string{"Content-Security-Policy": fallbackCSP},
+	}
+	if maxAge := rt.config.Server.HSTSMaxAge; maxAge > 0 {
+		result.sts = fmt.Sprintf("max-age=%d", int(maxAge.Seconds()))
+		// preloading is only accepted for policies that include subdomains
+		if rt.config.Server.HSTSPreload {
+			result.sts += "; includeSubDomains; preload"
+		}
+	}
+	for key, value := range common {
+		result.vault[key] = value
+		result.fallback[key] = value
+	}
+	return result
+}
+
+// securityHeadersMiddleware sets security related response headers on all
+// responses. In case headers are managed by a reverse proxy, the middleware
+// can be disabled using configuration.
+func (rt *router) securityHeadersMiddleware() gin.HandlerFunc {
+	if rt.config.Headers.Disabled {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+	headers := rt.newSecurityHeaders()
+	return func(c *gin.Context) {
+		for key, value := range headers.forPath(c.Request.URL.Path) {
+			c.Header(key, value)
+		}
+		if headers.sts != "" && c.GetBool(contextKeySecureContext) {
+			c.Header("Strict-Transport-Security", headers.sts)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-contrib/location"
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+)
+
+func TestRouter_securityHeadersMiddleware(t *testing.T) {
+	tests := []struct {
+		name            string
+		config          func(*config.Config)
+		path            string
+		expectedHeaders map[string]string
+	}{
+		{
+			"defaults",
+			func(*config.Config) {},
+			"/auditorium/",
+			map[string]string{
+				"Content-Security-Policy": defaultCSP + "; frame-ancestors 'self'",
+				"X-Content-Type-Options":  "nosniff",
+				"Referrer-Policy":         "origin-when-cross-origin",
+			},
+		},
+		{
+			"vault defaults",
+			func(*config.Config) {},
+			"/vault/",
+			map[string]string{
+				"Content-Security-Policy": defaultCSP + "; frame-ancestors *",
+				"X-Content-Type-Options":  "nosniff",
+			},
+		},
+		{
+			"vault frame ancestors",
+			func(c *config.Config) {
+				c.Headers.VaultFrameAncestors = []string{"https://www.example.net", "https://blog.example.net"}
+			},
+			"/vault",
+			map[string]string{
+				"Content-Security-Policy": defaultCSP + "; frame-ancestors https://www.example.net https://blog.example.net",
+			},
+		},
+		{
+			"overrides",
+			func(c *config.Config) {
+				c.Headers.ContentSecurityPolicy = "default-src 'none'"
+				c.Headers.VaultContentSecurityPolicy = "default-src 'self'"
+				c.Headers.ReferrerPolicy = "no-referrer"
+			},
+			"/",
+			map[string]string{
+				"Content-Security-Policy": "default-src 'none'",
+				"Referrer-Policy":         "no-referrer",
+			},
+		},
+		{
+			"vault overrides",
+			func(c *config.Config) {
+				c.Headers.VaultContentSecurityPolicy = "default-src 'self'"
+			},
+			"/vault/index.html",
+			map[string]string{
+				"Content-Security-Policy": "default-src 'self'",
+			},
+		},
+		{
+			"prefix only",
+			func(*config.Config) {},
+			"/vaults/",
+			map[string]string{
+				"Content-Security-Policy": defaultCSP + "; frame-ancestors 'self'",
+			},
+		},
+		{
+			"hsts",
+			func(c *config.Config) {
+				c.Server.HSTSMaxAge = time.Hour
+			},
+			"/",
+			map[string]string{
+				"Strict-Transport-Security": "max-age=3600",
+			},
+		},
+		{
+			"hsts preload",
+			func(c *config.Config) {
+				c.Server.HSTSMaxAge = time.Hour * 24 * 365
+				c.Server.HSTSPreload = true
+			},
+			"/vault/",
+			map[string]string{
+				"Strict-Transport-Security": "max-age=31536000; includeSubDomains; preload",
+			},
+		},
+		{
+			"hsts insecure context",
+			func(c *config.Config) {
+				c.Server.HSTSMaxAge = time.Hour
+				c.App.Development = true
+			},
+			"/",
+			map[string]string{
+				"Strict-Transport-Security": "",
+			},
+		},
+		{
+			"disabled",
+			func(c *config.Config) {
+				c.Headers.Disabled = true
+			},
+			"/",
+			map[string]string{
+				"Content-Security-Policy": "",
+				"X-Content-Type-Options":  "",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Headers.ReferrerPolicy = "origin-when-cross-origin"
+			test.config(cfg)
+			rt := router{config: cfg}
+			m := gin.New()
+			m.Use(
+				location.Default(),
+				secureContextMiddleware(contextKeySecureContext, cfg.App.Development),
+				rt.securityHeadersMiddleware(),
+			)
+			m.GET("/*any", func(c *gin.Context) {
+				c.Status(http.StatusNoContent)
+			})
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "https://offen.example.net"+test.path, nil)
+			m.ServeHTTP(w, r)
+
+			for key, value := range test.expectedHeaders {
+				if actual := w.Header().Get(key); actual != value {
+					t.Errorf("Expected %s header to be %q, got %q", key, value, actual)
+				}
+			}
+		})
+	}
+}
@@ -11,9 +11,9 @@ import (
 )
 
 func (rt *router) getHealth(c *gin.Context) {
-	if err := rt.db.CheckHealth(); err != nil {
+	if err := rt.database(c).CheckHealth(); err != nil {
 		newJSONError(
-			fmt.Errorf("router: failed checking health of connected persistence layer: %v", err),
+			fmt.Errorf("router: failed checking health of connected persistence layer: %w", err),
 			http.StatusBadGateway,
 		).Pipe(c)
 		return
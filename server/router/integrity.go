@@ -0,0 +1,20 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getIntegrity returns the Subresource Integrity hashes of the scripts that
+// are currently served, so embedding pages can pin them.
+func (rt *router) getIntegrity(c *gin.Context) {
+	result := map[string]string{}
+	for location, hash := range rt.integrity {
+		result[location] = hash
+	}
+	c.JSON(http.StatusOK, result)
+}
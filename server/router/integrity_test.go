@@ -0,0 +1,55 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRouter_getIntegrity(t *testing.T) {
+	tests := []struct {
+		name           string
+		integrity      map[string]string
+		expectedResult map[string]string
+	}{
+		{
+			"none",
+			nil,
+			map[string]string{},
+		},
+		{
+			"ok",
+			map[string]string{"/script.js": "sha384-abc"},
+			map[string]string{"/script.js": "sha384-abc"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{integrity: test.integrity}
+			m := gin.New()
+			m.GET("/", rt.getIntegrity)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			m.ServeHTTP(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			var result map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(test.expectedResult, result) {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/locales"
+)
+
+// catalogMaxAge is the duration clients are allowed to cache a message
+// catalog before revalidating it.
+const catalogMaxAge = time.Hour
+
+type localesResponse struct {
+	Default string   `json:"default"`
+	Locales []string `json:"locales"`
+}
+
+// getLocales returns the locales message catalogs are available for.
+func (rt *router) getLocales(c *gin.Context) {
+	available, err := rt.locales.Locales()
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error looking up available locales: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.Header("Access-Control-Allow-Origin", "*")
+	writeCacheableJSON(c, localesResponse{
+		Default: rt.config.App.Locale.String(),
+		Locales: available,
+	}, catalogMaxAge)
+}
+
+// getCatalog returns the translated messages used by the consent banner and
+// the vault for the requested locale.
+func (rt *router) getCatalog(c *gin.Context) {
+	locale := c.Param("locale")
+	catalog, err := rt.locales.Load(locale)
+	if err != nil {
+		if errors.Is(err, locales.ErrUnknownLocale) {
+			newJSONError(
+				fmt.Errorf("router: no catalog available for locale %s", locale),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error loading catalog: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.Header("Access-Control-Allow-Origin", "*")
+	writeCacheableJSON(c, catalog, catalogMaxAge)
+}
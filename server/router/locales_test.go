@@ -0,0 +1,124 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/locales"
+)
+
+type mockLoader struct {
+	locales []string
+	catalog locales.Catalog
+	err     error
+}
+
+func (m *mockLoader) Locales() ([]string, error) {
+	return m.locales, m.err
+}
+
+func (m *mockLoader) Load(string) (locales.Catalog, error) {
+	return m.catalog, m.err
+}
+
+func TestRouter_getLocales(t *testing.T) {
+	tests := []struct {
+		name           string
+		loader         locales.Loader
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			"error",
+			&mockLoader{err: errors.New("did not work")},
+			http.StatusInternalServerError,
+			"",
+		},
+		{
+			"ok",
+			&mockLoader{locales: []string{"de", "en"}},
+			http.StatusOK,
+			`{"default":"en","locales":["de","en"]}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.App.Locale = "en"
+			rt := router{locales: test.loader, config: cfg}
+			m := gin.New()
+			m.GET("/", rt.getLocales)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			m.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
+			}
+			if test.expectedBody != "" && strings.TrimSpace(w.Body.String()) != test.expectedBody {
+				t.Errorf("Unexpected body %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouter_getCatalog(t *testing.T) {
+	tests := []struct {
+		name           string
+		loader         locales.Loader
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			"unknown locale",
+			&mockLoader{err: locales.ErrUnknownLocale},
+			http.StatusNotFound,
+			"",
+		},
+		{
+			"error",
+			&mockLoader{err: errors.New("did not work")},
+			http.StatusInternalServerError,
+			"",
+		},
+		{
+			"ok",
+			&mockLoader{catalog: locales.Catalog{"Yes": "Ja"}},
+			http.StatusOK,
+			`{"Yes":"Ja"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{locales: test.loader, config: &config.Config{}}
+			m := gin.New()
+			m.GET("/:locale", rt.getCatalog)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/de", nil)
+			m.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
+			}
+			if test.expectedBody == "" {
+				return
+			}
+			if strings.TrimSpace(w.Body.String()) != test.expectedBody {
+				t.Errorf("Unexpected body %s", w.Body.String())
+			}
+			if w.Header().Get("Etag") == "" {
+				t.Error("Expected Etag header to be set")
+			}
+		})
+	}
+}
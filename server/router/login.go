@@ -4,7 +4,6 @@
 package router
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"net/http"
@@ -12,16 +11,27 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/mailer"
 	"github.com/offen/offen/server/persistence"
 )
 
 type loginCredentials struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	TOTPCode string `json:"totpCode"`
 }
 
 func (rt *router) postLogout(c *gin.Context) {
-	authCookie, authCookieErr := rt.authCookie("", c.GetBool(contextKeySecureContext))
+	if ck, err := c.Request.Cookie(authKey); err == nil {
+		var token authToken
+		if err := rt.signers.session.Decode(authKey, ck.Value, &token); err == nil {
+			if err := rt.database(c).RevokeSession(token.AccountUserID, token.SessionID); err != nil {
+				rt.logError(c, err, "error revoking session on logout")
+			}
+		}
+	}
+
+	authCookie, authCookieErr := rt.authCookie(nil, c.GetBool(contextKeySecureContext))
 	if authCookieErr != nil {
 		newJSONError(
 			fmt.Errorf("router: error creating auth cookie: %w", authCookieErr),
@@ -34,6 +44,45 @@ func (rt *router) postLogout(c *gin.Context) {
 	c.JSON(http.StatusNoContent, nil)
 }
 
+// loginLocked checks whether the given account user or the requesting source
+// is currently locked out because of too many failed login attempts.
+func (rt *router) loginLocked(c *gin.Context, username string) bool {
+	remaining, locked := rt.lockouts.accountUser.Locked(strings.ToLower(username))
+	if !locked {
+		remaining, locked = rt.lockouts.source.Locked(c.ClientIP())
+	}
+	if !locked {
+		return false
+	}
+	retryAfter := int(remaining.Round(time.Second).Seconds())
+	c.Header("Retry-After", fmt.Sprintf("%d", retryAfter))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, &errorResponse{
+		Error:      "router: too many failed login attempts",
+		Status:     http.StatusTooManyRequests,
+		Code:       errorCodeLoginLocked,
+		RetryAfter: retryAfter,
+	})
+	return true
+}
+
+// loginFailed records a failed login attempt and responds with an error
+// that tells the client about the number of attempts left.
+func (rt *router) loginFailed(c *gin.Context, username string, err error) {
+	attemptsLeft := rt.lockouts.accountUser.Fail(strings.ToLower(username))
+	if sourceLeft := rt.lockouts.source.Fail(c.ClientIP()); sourceLeft < attemptsLeft {
+		attemptsLeft = sourceLeft
+	}
+	if attemptsLeft == 0 && rt.loginLocked(c, username) {
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusUnauthorized, &errorResponse{
+		Error:        err.Error(),
+		Status:       http.StatusUnauthorized,
+		Code:         errorCodeInvalidCredentials,
+		AttemptsLeft: attemptsLeft,
+	})
+}
+
 func (rt *router) postLogin(c *gin.Context) {
 	var credentials loginCredentials
 	if err := c.BindJSON(&credentials); err != nil {
@@ -44,6 +93,10 @@ func (rt *router) postLogin(c *gin.Context) {
 		return
 	}
 
+	if rt.loginLocked(c, credentials.Username) {
+		return
+	}
+
 	if l := <-rt.getLimiter().ExponentialThrottle(time.Second, fmt.Sprintf("postLogin-%s", credentials.Username)); l.Error != nil {
 		newJSONError(
 			fmt.Errorf("router: error applying rate limit: %w", l.Error),
@@ -61,21 +114,31 @@ func (rt *router) postLogin(c *gin.Context) {
 		return
 	}
 
-	result, err := rt.db.Login(credentials.Username, credentials.Password)
+	result, err := rt.database(c).Login(credentials.Username, credentials.Password)
 	if err != nil {
-		newJSONError(
-			fmt.Errorf("router: error logging in: %w", err),
-			http.StatusUnauthorized,
-		).Pipe(c)
+		rt.loginFailed(c, credentials.Username, fmt.Errorf("router: error logging in: %w", err))
 		return
 	}
 
-	authCookie, authCookieErr := rt.authCookie(result.AccountUserID, c.GetBool(contextKeySecureContext))
+	if result.TOTPEnabled {
+		if credentials.TOTPCode == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, &errorResponse{
+				Error:  "router: account user requires a two factor authentication code",
+				Status: http.StatusUnauthorized,
+				Code:   errorCodeTOTPRequired,
+			})
+			return
+		}
+		if err := rt.database(c).VerifyTOTP(result.AccountUserID, credentials.TOTPCode); err != nil {
+			rt.loginFailed(c, credentials.Username, fmt.Errorf("router: error verifying two factor authentication code: %w", err))
+			return
+		}
+	}
+	rt.lockouts.accountUser.Reset(strings.ToLower(credentials.Username))
+
+	authCookie, authCookieErr := rt.newSession(c, result.AccountUserID, result.TOTPEnabled)
 	if authCookieErr != nil {
-		newJSONError(
-			fmt.Errorf("router: error creating auth cookie: %w", authCookieErr),
-			http.StatusInternalServerError,
-		).Pipe(c)
+		newJSONError(authCookieErr, http.StatusInternalServerError).Pipe(c)
 		return
 	}
 
@@ -86,7 +149,7 @@ func (rt *router) postLogin(c *gin.Context) {
 func (rt *router) getLogin(c *gin.Context) {
 	result, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
 	if !ok {
-		authCookie, _ := rt.authCookie("", c.GetBool(contextKeySecureContext))
+		authCookie, _ := rt.authCookie(nil, c.GetBool(contextKeySecureContext))
 		http.SetCookie(c.Writer, authCookie)
 		newJSONError(
 			errors.New("could not authorize request"),
@@ -128,14 +191,14 @@ func (rt *router) postChangePassword(c *gin.Context) {
 		).Pipe(c)
 		return
 	}
-	if err := rt.db.ChangePassword(user.AccountUserID, req.CurrentPassword, req.ChangedPassword); err != nil {
+	if err := rt.database(c).ChangePassword(user.AccountUserID, req.CurrentPassword, req.ChangedPassword); err != nil {
 		newJSONError(
 			fmt.Errorf("router: error changing password: %w", err),
 			http.StatusBadRequest,
 		).Pipe(c)
 		return
 	}
-	cookie, _ := rt.authCookie("", c.GetBool(contextKeySecureContext))
+	cookie, _ := rt.authCookie(nil, c.GetBool(contextKeySecureContext))
 	http.SetCookie(c.Writer, cookie)
 	c.Status(http.StatusNoContent)
 }
@@ -172,14 +235,14 @@ func (rt *router) postChangeEmail(c *gin.Context) {
 		).Pipe(c)
 		return
 	}
-	if err := rt.db.ChangeEmail(accountUser.AccountUserID, req.EmailAddress, req.EmailCurrent, req.Password); err != nil {
+	if err := rt.database(c).ChangeEmail(accountUser.AccountUserID, req.EmailAddress, req.EmailCurrent, req.Password); err != nil {
 		newJSONError(
-			fmt.Errorf("router: error changing email address: %v", err),
+			fmt.Errorf("router: error changing email address: %w", err),
 			http.StatusBadRequest,
 		).Pipe(c)
 		return
 	}
-	cookie, _ := rt.authCookie("", c.GetBool(contextKeySecureContext))
+	cookie, _ := rt.authCookie(nil, c.GetBool(contextKeySecureContext))
 	http.SetCookie(c.Writer, cookie)
 	c.Status(http.StatusNoContent)
 }
@@ -224,44 +287,38 @@ func (rt *router) postForgotPassword(c *gin.Context) {
 		return
 	}
 
-	token, err := rt.db.GenerateOneTimeKey(req.EmailAddress)
+	token, err := rt.database(c).GenerateOneTimeKey(req.EmailAddress)
 	if err != nil {
-		rt.logError(err, "error generating one time key")
+		rt.logError(c, err, "error generating one time key")
 		c.Status(http.StatusNoContent)
 		return
 	}
-	signedCredentials, signErr := rt.cookieSigner.MaxAge(24*60*60).Encode("credentials", forgotPasswordCredentials{
+	signedCredentials, signErr := rt.signers.reset.Encode("credentials", forgotPasswordCredentials{
 		Token:        token,
 		EmailAddress: req.EmailAddress,
 	})
 	if signErr != nil {
-		rt.logError(signErr, "error signing token")
+		rt.logError(c, signErr, "error signing token")
 		c.Status(http.StatusNoContent)
 		return
 	}
 
 	resetURL := strings.Replace(req.URLTemplate, "{token}", signedCredentials, -1)
 
-	subject, body := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
-	if err := rt.emails.ExecuteTemplate(subject, "subject_reset_password", nil); err != nil {
-		newJSONError(
-			fmt.Errorf("router: error rendering email subject: %v", err),
-			http.StatusInternalServerError,
-		).Pipe(c)
-		return
-	}
-	if err := rt.emails.ExecuteTemplate(body, "body_reset_password", map[string]string{"url": resetURL}); err != nil {
+	subject, body, err := mailer.Render(rt.emails, "reset_password", map[string]string{"url": resetURL})
+	if err != nil {
 		newJSONError(
-			fmt.Errorf("router: error rendering email body: %v", err),
+			fmt.Errorf("router: error rendering email message: %w", err),
 			http.StatusInternalServerError,
 		).Pipe(c)
 		return
 	}
 
-	if err := rt.mailer.Send(rt.config.SMTP.Sender, req.EmailAddress, subject.String(), body.String()); err != nil {
+	if err := rt.mailer.Send(rt.config.SMTP.Sender, req.EmailAddress, subject, body); err != nil {
+		rt.logError(c, err, "error sending password reset email, dropping message")
 		newJSONError(
-			fmt.Errorf("error sending email message: %v", err),
-			http.StatusInternalServerError,
+			fmt.Errorf("router: error sending email message: %w", err),
+			mailErrorStatus(err),
 		).Pipe(c)
 		return
 	}
@@ -284,7 +341,7 @@ func (rt *router) postResetPassword(c *gin.Context) {
 		return
 	}
 	var credentials forgotPasswordCredentials
-	if err := rt.cookieSigner.Decode("credentials", req.Token, &credentials); err != nil {
+	if err := rt.signers.reset.Decode("credentials", req.Token, &credentials); err != nil {
 		newJSONError(
 			fmt.Errorf("error decoding signed token: %w", err),
 			http.StatusBadRequest,
@@ -308,10 +365,10 @@ func (rt *router) postResetPassword(c *gin.Context) {
 		return
 	}
 
-	if err := rt.db.ResetPassword(req.EmailAddress, req.Password, credentials.Token); err != nil {
+	if err := rt.database(c).ResetPassword(req.EmailAddress, req.Password, credentials.Token); err != nil {
 		// on error a successful status is sent in order not to leak information
 		// to attackers
-		rt.logError(err, "error resetting password")
+		rt.logError(c, err, "error resetting password")
 	}
 	c.Status(http.StatusNoContent)
 }
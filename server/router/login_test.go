@@ -17,13 +17,16 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/securecookie"
 	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/mailer"
 	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/ratelimiter"
 )
 
 func TestRouter_postLogout(t *testing.T) {
 	m := gin.New()
 	rt := router{
-		config: &config.Config{},
+		config:  &config.Config{},
+		signers: newSigners([]byte("abc"), 0),
 	}
 	m.POST("/", rt.postLogout)
 	r := httptest.NewRequest(http.MethodPost, "/", nil)
@@ -53,13 +56,23 @@ func TestRouter_postLogout(t *testing.T) {
 
 type mockPostLoginDatabase struct {
 	persistence.Service
-	result persistence.LoginResult
-	err    error
+	result    persistence.LoginResult
+	err       error
+	verifyErr error
 }
 
 func (m *mockPostLoginDatabase) Login(string, string) (persistence.LoginResult, error) {
 	return m.result, m.err
 }
+
+func (m *mockPostLoginDatabase) VerifyTOTP(string, string) error {
+	return m.verifyErr
+}
+
+func (m *mockPostLoginDatabase) CreateSession(string, string, time.Duration) (string, error) {
+	return "session-a", nil
+}
+
 func TestRouter_postLogin(t *testing.T) {
 	tests := []struct {
 		name               string
@@ -95,14 +108,52 @@ func TestRouter_postLogin(t *testing.T) {
 			http.StatusOK,
 			true,
 		},
+		{
+			"totp code missing",
+			mockPostLoginDatabase{
+				result: persistence.LoginResult{
+					AccountUserID: "user-a",
+					TOTPEnabled:   true,
+				},
+			},
+			strings.NewReader(`{"username":"mail@offen.dev","password":"secret!"}`),
+			http.StatusUnauthorized,
+			false,
+		},
+		{
+			"bad totp code",
+			mockPostLoginDatabase{
+				result: persistence.LoginResult{
+					AccountUserID: "user-a",
+					TOTPEnabled:   true,
+				},
+				verifyErr: errors.New("did not work"),
+			},
+			strings.NewReader(`{"username":"mail@offen.dev","password":"secret!","totpCode":"123456"}`),
+			http.StatusUnauthorized,
+			false,
+		},
+		{
+			"ok totp",
+			mockPostLoginDatabase{
+				result: persistence.LoginResult{
+					AccountUserID: "user-a",
+					TOTPEnabled:   true,
+				},
+			},
+			strings.NewReader(`{"username":"mail@offen.dev","password":"secret!","totpCode":"123456"}`),
+			http.StatusOK,
+			true,
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			m := gin.New()
 			rt := router{
-				config:       &config.Config{},
-				db:           &test.db,
-				cookieSigner: securecookie.New([]byte("abc"), nil),
+				config:   &config.Config{},
+				db:       &test.db,
+				signers:  newSigners([]byte("abc"), 0),
+				lockouts: newTestLockouts(t, loginFailuresPerAccountUser, loginFailuresPerSource),
 			}
 			m.POST("/", rt.postLogin)
 			r := httptest.NewRequest(http.MethodPost, "/", test.body)
@@ -134,6 +185,44 @@ func TestRouter_postLogin(t *testing.T) {
 	}
 }
 
+func TestRouter_postLogin_Lockout(t *testing.T) {
+	rt := router{
+		config:   &config.Config{},
+		db:       &mockPostLoginDatabase{err: errors.New("bad login")},
+		signers:  newSigners([]byte("abc"), 0),
+		limiter:  ratelimiter.NewNoopRateLimiter(),
+		lockouts: newTestLockouts(t, 2, 10),
+	}
+	m := gin.New()
+	m.POST("/", rt.postLogin)
+
+	for _, expected := range []struct {
+		status int
+		body   string
+	}{
+		{http.StatusUnauthorized, `"code":"INVALID_CREDENTIALS","attemptsLeft":1`},
+		{http.StatusTooManyRequests, `"code":"LOGIN_LOCKED","retryAfter":3600`},
+		{http.StatusTooManyRequests, `"code":"LOGIN_LOCKED"`},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"username":"Mail@offen.dev","password":"secret!"}`))
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, r)
+		if w.Code != expected.status {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+		if !strings.Contains(w.Body.String(), expected.body) {
+			t.Errorf("Unexpected body %s", w.Body.String())
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"username":"other@offen.dev","password":"secret!"}`))
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Unexpected status code for other account user %v", w.Code)
+	}
+}
+
 func TestRouter_getLogin(t *testing.T) {
 	t.Run("ok", func(t *testing.T) {
 		m := gin.New()
@@ -441,9 +530,9 @@ func TestRouter_postResetPassword(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			m := gin.New()
 			rt := router{
-				config:       &config.Config{},
-				db:           &test.db,
-				cookieSigner: signer,
+				config:  &config.Config{},
+				db:      &test.db,
+				signers: newSigners([]byte("abc"), 0),
 			}
 			m.POST("/", rt.postResetPassword)
 			r := httptest.NewRequest(http.MethodPost, "/", test.body)
@@ -510,6 +599,17 @@ func TestRouter_postForgotPassword(t *testing.T) {
 			strings.NewReader(`{"emailAddress":"mail@offen.dev","urlTemplate":"/reset/{token}/"}`),
 			http.StatusInternalServerError,
 		},
+		{
+			"mailer unavailable",
+			mockPostForgotPasswordDatabase{
+				result: []byte("i'm a token"),
+			},
+			mockMailer{
+				err: mailer.ErrUnavailable,
+			},
+			strings.NewReader(`{"emailAddress":"mail@offen.dev","urlTemplate":"/reset/{token}/"}`),
+			http.StatusServiceUnavailable,
+		},
 		{
 			"ok",
 			mockPostForgotPasswordDatabase{
@@ -525,10 +625,10 @@ func TestRouter_postForgotPassword(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			m := gin.New()
 			rt := router{
-				config:       &config.Config{},
-				db:           &test.db,
-				cookieSigner: securecookie.New([]byte("abc"), nil),
-				mailer:       &test.mailer,
+				config:  &config.Config{},
+				db:      &test.db,
+				signers: newSigners([]byte("abc"), 0),
+				mailer:  &test.mailer,
 				emails: func() *template.Template {
 					t := template.New("emails")
 					t, _ = t.Parse(`
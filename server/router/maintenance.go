@@ -0,0 +1,118 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// topicMaintenance is the bus topic changes to maintenance mode are
+// published on.
+const topicMaintenance = "maintenance"
+
+// maintenanceRetryAfter is the number of seconds clients are asked to wait
+// before retrying requests that have been rejected in maintenance mode.
+const maintenanceRetryAfter = 60
+
+type maintenancePayload struct {
+	ReadOnly bool `json:"readOnly"`
+}
+
+func (rt *router) isReadOnly() bool {
+	return atomic.LoadInt32(&rt.readOnly) == 1
+}
+
+func (rt *router) setReadOnly(readOnly bool) {
+	var value int32
+	if readOnly {
+		value = 1
+	}
+	atomic.StoreInt32(&rt.readOnly, value)
+}
+
+func (rt *router) receiveMaintenance(payload []byte) {
+	var p maintenancePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return
+	}
+	rt.setReadOnly(p.ReadOnly)
+}
+
+// readOnlyMiddleware rejects requests that would write data while the
+// instance is in maintenance mode.
+func (rt *router) readOnlyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !rt.isReadOnly() {
+			c.Next()
+			return
+		}
+		c.Header("Retry-After", fmt.Sprintf("%d", maintenanceRetryAfter))
+		resp := newJSONError(
+			errors.New("router: instance is in read-only mode for maintenance"),
+			http.StatusServiceUnavailable,
+		)
+		resp.RetryAfter = maintenanceRetryAfter
+		resp.Pipe(c)
+	}
+}
+
+// readOnlyWritesMiddleware rejects all requests using a method other than
+// GET, HEAD or OPTIONS while the instance is in maintenance mode. Requests
+// for the given route paths are exempt.
+func (rt *router) readOnlyWritesMiddleware(exempt ...string) gin.HandlerFunc {
+	reject := rt.readOnlyMiddleware()
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		for _, path := range exempt {
+			if c.FullPath() == path {
+				c.Next()
+				return
+			}
+		}
+		reject(c)
+	}
+}
+
+func (rt *router) getMaintenance(c *gin.Context) {
+	c.JSON(http.StatusOK, maintenancePayload{ReadOnly: rt.isReadOnly()})
+}
+
+func (rt *router) putMaintenance(c *gin.Context) {
+	var req maintenancePayload
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+	// the state is persisted so it applies to instances that are started
+	// later on and survives restarts
+	if err := rt.database(c).SetReadOnly(req.ReadOnly); err != nil {
+		rt.logError(c, err, "error persisting maintenance mode")
+		newJSONError(
+			errors.New("router: error persisting maintenance mode"),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	rt.setReadOnly(req.ReadOnly)
+	if rt.bus != nil {
+		payload, _ := json.Marshal(req)
+		if err := rt.bus.Publish(topicMaintenance, payload); err != nil {
+			rt.logError(c, err, "error sharing maintenance mode with other instances")
+		}
+	}
+	c.JSON(http.StatusOK, req)
+}
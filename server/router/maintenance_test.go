@@ -0,0 +1,189 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/bus"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockMaintenanceDatabase struct {
+	persistence.Service
+	readOnly bool
+	err      error
+}
+
+func (m *mockMaintenanceDatabase) SetReadOnly(readOnly bool) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.readOnly = readOnly
+	return nil
+}
+
+func TestRouter_readOnlyMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		readOnly       bool
+		expectedStatus int
+	}{
+		{
+			"writable",
+			false,
+			http.StatusNoContent,
+		},
+		{
+			"read only",
+			true,
+			http.StatusServiceUnavailable,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := &router{}
+			rt.setReadOnly(test.readOnly)
+			m := gin.New()
+			m.POST("/", rt.readOnlyMiddleware(), func(c *gin.Context) {
+				c.Status(http.StatusNoContent)
+			})
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatus {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.readOnly && w.Header().Get("Retry-After") != "60" {
+				t.Errorf("Unexpected Retry-After header %v", w.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
+
+func TestRouter_readOnlyWritesMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{
+			"read",
+			http.MethodGet,
+			"/api/events",
+			http.StatusNoContent,
+		},
+		{
+			"write",
+			http.MethodPost,
+			"/api/events",
+			http.StatusServiceUnavailable,
+		},
+		{
+			"delete",
+			http.MethodDelete,
+			"/api/events",
+			http.StatusServiceUnavailable,
+		},
+		{
+			"exempt",
+			http.MethodPost,
+			"/api/login",
+			http.StatusNoContent,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := &router{}
+			rt.setReadOnly(true)
+			m := gin.New()
+			api := m.Group("/api", rt.readOnlyWritesMiddleware("/api/login"))
+			handler := func(c *gin.Context) {
+				c.Status(http.StatusNoContent)
+			}
+			api.Handle(test.method, "/events", handler)
+			api.Handle(test.method, "/login", handler)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(test.method, test.path, nil)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatus {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
+
+func TestRouter_putMaintenance(t *testing.T) {
+	tests := []struct {
+		name             string
+		body             string
+		dbErr            error
+		expectedStatus   int
+		expectedReadOnly bool
+	}{
+		{
+			"bad payload",
+			`{"readOnly":`,
+			nil,
+			http.StatusBadRequest,
+			false,
+		},
+		{
+			"database error",
+			`{"readOnly":true}`,
+			errors.New("did not work"),
+			http.StatusInternalServerError,
+			false,
+		},
+		{
+			"enable",
+			`{"readOnly":true}`,
+			nil,
+			http.StatusOK,
+			true,
+		},
+		{
+			"disable",
+			`{"readOnly":false}`,
+			nil,
+			http.StatusOK,
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := bus.New()
+			db := &mockMaintenanceDatabase{err: test.dbErr}
+			rt := &router{bus: b, db: db}
+			// a second instance sharing the bus is expected to pick up
+			// the change too
+			other := &router{}
+			b.Subscribe(topicMaintenance, other.receiveMaintenance)
+
+			m := gin.New()
+			m.PUT("/", rt.putMaintenance)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(test.body))
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatus {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if rt.isReadOnly() != test.expectedReadOnly {
+				t.Errorf("Unexpected read only state %v", rt.isReadOnly())
+			}
+			if other.isReadOnly() != test.expectedReadOnly {
+				t.Errorf("Unexpected read only state on other instance %v", other.isReadOnly())
+			}
+			if db.readOnly != test.expectedReadOnly {
+				t.Errorf("Unexpected persisted read only state %v", db.readOnly)
+			}
+		})
+	}
+}
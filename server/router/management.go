@@ -4,7 +4,6 @@
 package router
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"net/http"
@@ -12,15 +11,17 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/mailer"
 	"github.com/offen/offen/server/persistence"
 )
 
 type shareAccountRequest struct {
-	InviteeEmailAddress  string `json:"invitee"`
-	ProviderEmailAddress string `json:"emailAddress"`
-	ProviderPassword     string `json:"password"`
-	URLTemplate          string `json:"urlTemplate"`
-	GrantAdminPrivileges bool   `json:"grantAdminPrivileges"`
+	InviteeEmailAddress  string                      `json:"invitee"`
+	ProviderEmailAddress string                      `json:"emailAddress"`
+	ProviderPassword     string                      `json:"password"`
+	URLTemplate          string                      `json:"urlTemplate"`
+	GrantAdminPrivileges bool                        `json:"grantAdminPrivileges"`
+	Role                 persistence.AccountUserRole `json:"role"`
 }
 
 func (rt *router) postShareAccount(c *gin.Context) {
@@ -62,7 +63,7 @@ func (rt *router) postShareAccount(c *gin.Context) {
 	}
 
 	// the given credentials might not be valid
-	accountInRequest, err := rt.db.Login(req.ProviderEmailAddress, req.ProviderPassword)
+	accountInRequest, err := rt.database(c).Login(req.ProviderEmailAddress, req.ProviderPassword)
 	if err != nil {
 		newJSONError(
 			fmt.Errorf("router: error validating given credentials: %w", err),
@@ -81,7 +82,9 @@ func (rt *router) postShareAccount(c *gin.Context) {
 		return
 	}
 
-	if !accountInRequest.IsSuperAdmin() {
+	// SuperAdmins are allowed to share all of their accounts, while account
+	// admins can only share the single account they are managing
+	if !accountInRequest.IsSuperAdmin() && (accountID == "" || !accountInRequest.CanManageAccount(accountID)) {
 		newJSONError(
 			errors.New("router: given credentials are not allowed to share accounts"),
 			http.StatusBadRequest,
@@ -89,7 +92,15 @@ func (rt *router) postShareAccount(c *gin.Context) {
 		return
 	}
 
-	result, err := rt.db.ShareAccount(req.InviteeEmailAddress, req.ProviderEmailAddress, req.ProviderPassword, c.Param("accountID"), req.GrantAdminPrivileges)
+	if req.GrantAdminPrivileges && !accountInRequest.IsSuperAdmin() {
+		newJSONError(
+			errors.New("router: given credentials are not allowed to grant admin privileges"),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	result, err := rt.database(c).ShareAccount(req.InviteeEmailAddress, req.ProviderEmailAddress, req.ProviderPassword, c.Param("accountID"), req.GrantAdminPrivileges, req.Role)
 	if err != nil {
 		newJSONError(
 			fmt.Errorf("router: error inviting user: %w", err),
@@ -108,40 +119,35 @@ func (rt *router) postShareAccount(c *gin.Context) {
 		return
 	}
 
-	var bodyErr error
-	var subjectErr error
-	body, subject := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+	var subject, body string
+	var renderErr error
 	if result.UserExistsWithPassword {
-		bodyErr = rt.emails.ExecuteTemplate(body, "body_existing_user_invite", map[string]interface{}{"accountNames": result.AccountNames})
-		subjectErr = rt.emails.ExecuteTemplate(subject, "subject_existing_user_invite", nil)
+		subject, body, renderErr = mailer.Render(rt.emails, "existing_user_invite", map[string]interface{}{"accountNames": result.AccountNames})
 	} else {
-		signedCredentials, signErr := rt.cookieSigner.MaxAge(7*24*60*60).Encode("credentials", req.InviteeEmailAddress)
+		signedCredentials, signErr := rt.signers.invite.Encode("credentials", req.InviteeEmailAddress)
 		if signErr != nil {
-			rt.logError(signErr, "error signing token")
+			rt.logError(c, signErr, "error signing token")
 			c.Status(http.StatusNoContent)
 			return
 		}
 		joinURL := strings.Replace(req.URLTemplate, "{token}", signedCredentials, -1)
-		bodyErr = rt.emails.ExecuteTemplate(body, "body_new_user_invite", map[string]interface{}{"url": joinURL})
-		subjectErr = rt.emails.ExecuteTemplate(subject, "subject_new_user_invite", nil)
+		subject, body, renderErr = mailer.Render(rt.emails, "new_user_invite", map[string]interface{}{"url": joinURL})
 	}
-
-	for _, err := range []error{bodyErr, subjectErr} {
-		if err != nil {
-			newJSONError(
-				fmt.Errorf("router: error rendering email message: %v", err),
-				http.StatusInternalServerError,
-			).Pipe(c)
-			return
-		}
-	}
-	if err := rt.mailer.Send(rt.config.SMTP.Sender, req.InviteeEmailAddress, subject.String(), body.String()); err != nil {
+	if renderErr != nil {
 		newJSONError(
-			fmt.Errorf("router: error sending email message: %v", err),
+			fmt.Errorf("router: error rendering email message: %w", renderErr),
 			http.StatusInternalServerError,
 		).Pipe(c)
 		return
 	}
+	if err := rt.mailer.Send(rt.config.SMTP.Sender, req.InviteeEmailAddress, subject, body); err != nil {
+		rt.logError(c, err, "error sending invite email, dropping message")
+		newJSONError(
+			fmt.Errorf("router: error sending email message: %w", err),
+			mailErrorStatus(err),
+		).Pipe(c)
+		return
+	}
 	c.Status(http.StatusNoContent)
 }
 
@@ -161,7 +167,7 @@ func (rt *router) postJoin(c *gin.Context) {
 		return
 	}
 	var email string
-	if err := rt.cookieSigner.Decode("credentials", req.Token, &email); err != nil {
+	if err := rt.signers.invite.Decode("credentials", req.Token, &email); err != nil {
 		newJSONError(
 			fmt.Errorf("error decoding signed token: %w", err),
 			http.StatusBadRequest,
@@ -193,8 +199,12 @@ func (rt *router) postJoin(c *gin.Context) {
 		return
 	}
 
-	if err := rt.db.Join(req.EmailAddress, req.Password); err != nil {
-		rt.logError(err, "error joining")
+	// the response does not signal whether joining succeeded, so the audit
+	// entry is recorded here instead of using the audit middleware
+	if accountUserID, err := rt.database(c).Join(req.EmailAddress, req.Password); err != nil {
+		rt.logError(c, err, "error joining")
+	} else {
+		rt.recordAudit(c, persistence.AuditActionUserJoin, accountUserID, "")
 	}
 	c.Status(http.StatusNoContent)
 }
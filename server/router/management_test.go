@@ -10,6 +10,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -27,7 +28,7 @@ type mockPostShareAccountDatabase struct {
 	loginErr           error
 }
 
-func (m *mockPostShareAccountDatabase) ShareAccount(string, string, string, string, bool) (persistence.ShareAccountResult, error) {
+func (m *mockPostShareAccountDatabase) ShareAccount(string, string, string, string, bool, persistence.AccountUserRole) (persistence.ShareAccountResult, error) {
 	return m.shareAccountResult, m.shareAccountErr
 }
 
@@ -36,7 +37,6 @@ func (m *mockPostShareAccountDatabase) Login(string, string) (persistence.LoginR
 }
 
 func TestRouter_postShareAccount(t *testing.T) {
-	signer := securecookie.New([]byte("ABC"), nil)
 	tests := []struct {
 		name               string
 		accountID          string
@@ -170,6 +170,52 @@ func TestRouter_postShareAccount(t *testing.T) {
 			mockMailer{},
 			http.StatusBadRequest,
 		},
+		{
+			"requester is account admin",
+			"account-a-id",
+			mockPostShareAccountDatabase{
+				loginResult: persistence.LoginResult{
+					AccountUserID: "account-user-id",
+					Accounts: []persistence.LoginAccountResult{
+						{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
+					},
+				},
+				shareAccountResult: persistence.ShareAccountResult{
+					UserExistsWithPassword: true,
+					AccountNames:           []string{"Account A"},
+				},
+			},
+			persistence.LoginResult{
+				AccountUserID: "account-user-id",
+				Accounts: []persistence.LoginAccountResult{
+					{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
+				},
+			},
+			strings.NewReader(`{"invitee":"mail@offen.dev","emailAddress":"hioffen@posteo.de","password":"ok","urlTemplate":"/join/{token}","grantAdminPrivileges":false}`),
+			mockMailer{},
+			http.StatusNoContent,
+		},
+		{
+			"account admin granting admin privileges",
+			"account-a-id",
+			mockPostShareAccountDatabase{
+				loginResult: persistence.LoginResult{
+					AccountUserID: "account-user-id",
+					Accounts: []persistence.LoginAccountResult{
+						{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
+					},
+				},
+			},
+			persistence.LoginResult{
+				AccountUserID: "account-user-id",
+				Accounts: []persistence.LoginAccountResult{
+					{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
+				},
+			},
+			strings.NewReader(`{"invitee":"mail@offen.dev","emailAddress":"hioffen@posteo.de","password":"ok","urlTemplate":"/join/{token}","grantAdminPrivileges":true}`),
+			mockMailer{},
+			http.StatusBadRequest,
+		},
 		{
 			"share error",
 			"account-a-id",
@@ -309,10 +355,10 @@ func TestRouter_postShareAccount(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			rt := router{
-				config:       &config.Config{},
-				db:           &test.db,
-				cookieSigner: signer,
-				mailer:       &test.mailer,
+				config:  &config.Config{},
+				db:      &test.db,
+				signers: newSigners([]byte("ABC"), 0),
+				mailer:  &test.mailer,
 				emails: func() *template.Template {
 					t := template.New("emails")
 					t, _ = t.Parse(`
@@ -343,11 +389,17 @@ func TestRouter_postShareAccount(t *testing.T) {
 
 type mockPostJoinDatabase struct {
 	persistence.Service
-	err error
+	err     error
+	audited []string
 }
 
-func (m *mockPostJoinDatabase) Join(string, string) error {
-	return m.err
+func (m *mockPostJoinDatabase) Join(string, string) (string, error) {
+	return "user-a", m.err
+}
+
+func (m *mockPostJoinDatabase) RecordAuditEntry(action, actorID, accountID, requestID string) error {
+	m.audited = append(m.audited, action, actorID)
+	return nil
 }
 
 func TestRouter_postJoin(t *testing.T) {
@@ -357,18 +409,21 @@ func TestRouter_postJoin(t *testing.T) {
 		db                 mockPostJoinDatabase
 		body               io.Reader
 		expectedStatusCode int
+		expectedAudited    []string
 	}{
 		{
 			"bad payload",
 			mockPostJoinDatabase{},
 			strings.NewReader("xxx"),
 			http.StatusBadRequest,
+			nil,
 		},
 		{
 			"bad token",
 			mockPostJoinDatabase{},
 			strings.NewReader(`{"emailAddress":"hioffen@posteo.de","password":"pass","token":"something something"}`),
 			http.StatusBadRequest,
+			nil,
 		},
 		{
 			"email mismatch",
@@ -383,6 +438,7 @@ func TestRouter_postJoin(t *testing.T) {
 				)
 			}(),
 			http.StatusBadRequest,
+			nil,
 		},
 		{
 			"database error",
@@ -399,6 +455,7 @@ func TestRouter_postJoin(t *testing.T) {
 				)
 			}(),
 			http.StatusNoContent,
+			nil,
 		},
 		{
 			"ok",
@@ -413,14 +470,15 @@ func TestRouter_postJoin(t *testing.T) {
 				)
 			}(),
 			http.StatusNoContent,
+			[]string{persistence.AuditActionUserJoin, "user-a"},
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			rt := router{
-				db:           &test.db,
-				cookieSigner: signer,
+				db:      &test.db,
+				signers: newSigners([]byte("abc"), 0),
 			}
 
 			m := gin.New()
@@ -433,6 +491,9 @@ func TestRouter_postJoin(t *testing.T) {
 			if w.Code != test.expectedStatusCode {
 				t.Errorf("Unexpected status code %v", w.Code)
 			}
+			if !reflect.DeepEqual(test.expectedAudited, test.db.audited) {
+				t.Errorf("Expected audit entries %v, got %v", test.expectedAudited, test.db.audited)
+			}
 		})
 	}
 }
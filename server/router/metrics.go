@@ -0,0 +1,61 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getMetrics exposes metrics about background jobs and request handling
+// using the Prometheus text exposition format.
+func (rt *router) getMetrics(c *gin.Context) {
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, "# HELP offen_http_panics_total The number of panics that have been recovered from when handling requests.")
+	fmt.Fprintln(&buf, "# TYPE offen_http_panics_total counter")
+	fmt.Fprintf(&buf, "offen_http_panics_total %d\n", atomic.LoadUint64(&rt.panics))
+	fmt.Fprintln(&buf, "# HELP offen_ingest_shed_total The number of requests inserting events that have been rejected as the maximum number of concurrent inserts has been reached.")
+	fmt.Fprintln(&buf, "# TYPE offen_ingest_shed_total counter")
+	fmt.Fprintf(&buf, "offen_ingest_shed_total %d\n", atomic.LoadUint64(&rt.shed))
+	fmt.Fprintln(&buf, "# HELP offen_ingest_bots_total The number of events that have been dropped as they have been sent by a bot.")
+	fmt.Fprintln(&buf, "# TYPE offen_ingest_bots_total counter")
+	fmt.Fprintf(&buf, "offen_ingest_bots_total %d\n", atomic.LoadUint64(&rt.bots))
+	if rt.scheduler != nil {
+		stats := rt.scheduler.Stats()
+		fmt.Fprintln(&buf, "# HELP offen_job_runs_total The number of times a background job has been run.")
+		fmt.Fprintln(&buf, "# TYPE offen_job_runs_total counter")
+		for _, s := range stats {
+			fmt.Fprintf(&buf, "offen_job_runs_total{job=%q} %d\n", s.Name, s.Runs)
+		}
+		fmt.Fprintln(&buf, "# HELP offen_job_skipped_total The number of times a background job has been skipped as another instance is in charge of it.")
+		fmt.Fprintln(&buf, "# TYPE offen_job_skipped_total counter")
+		for _, s := range stats {
+			fmt.Fprintf(&buf, "offen_job_skipped_total{job=%q} %d\n", s.Name, s.Skipped)
+		}
+		fmt.Fprintln(&buf, "# HELP offen_job_failures_total The number of times a background job has failed.")
+		fmt.Fprintln(&buf, "# TYPE offen_job_failures_total counter")
+		for _, s := range stats {
+			fmt.Fprintf(&buf, "offen_job_failures_total{job=%q} %d\n", s.Name, s.Failures)
+		}
+		fmt.Fprintln(&buf, "# HELP offen_job_last_duration_seconds The duration of the last run of a background job.")
+		fmt.Fprintln(&buf, "# TYPE offen_job_last_duration_seconds gauge")
+		for _, s := range stats {
+			fmt.Fprintf(&buf, "offen_job_last_duration_seconds{job=%q} %f\n", s.Name, s.LastDuration.Seconds())
+		}
+		fmt.Fprintln(&buf, "# HELP offen_job_last_run_timestamp_seconds The time of the last run of a background job.")
+		fmt.Fprintln(&buf, "# TYPE offen_job_last_run_timestamp_seconds gauge")
+		for _, s := range stats {
+			var timestamp int64
+			if !s.LastRun.IsZero() {
+				timestamp = s.LastRun.Unix()
+			}
+			fmt.Fprintf(&buf, "offen_job_last_run_timestamp_seconds{job=%q} %d\n", s.Name, timestamp)
+		}
+	}
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", buf.Bytes())
+}
@@ -0,0 +1,50 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/scheduler"
+)
+
+func TestRouter_getMetrics(t *testing.T) {
+	t.Run("no scheduler", func(t *testing.T) {
+		rt := router{}
+		m := gin.New()
+		m.GET("/", rt.getMetrics)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		m.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+		if !strings.Contains(w.Body.String(), "offen_http_panics_total 0") {
+			t.Errorf("Unexpected body %s", w.Body.String())
+		}
+		if strings.Contains(w.Body.String(), "offen_job_") {
+			t.Errorf("Unexpected job metrics %s", w.Body.String())
+		}
+	})
+	t.Run("with jobs", func(t *testing.T) {
+		rt := router{
+			scheduler: scheduler.New(0, nil, scheduler.Job{Name: "expire"}),
+		}
+		m := gin.New()
+		m.GET("/", rt.getMetrics)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		m.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+		if !strings.Contains(w.Body.String(), `offen_job_runs_total{job="expire"} 0`) {
+			t.Errorf("Unexpected body %s", w.Body.String())
+		}
+	})
+}
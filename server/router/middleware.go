@@ -6,13 +6,22 @@ package router
 import (
 	"bytes"
 	"crypto/md5"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
+	"runtime/debug"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-contrib/location"
 	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+	"github.com/sirupsen/logrus"
 )
 
 func secureContextMiddleware(contextKey string, isDevelopment bool) gin.HandlerFunc {
@@ -36,20 +45,63 @@ func optinMiddleware(cookieName, passWhen string) gin.HandlerFunc {
 	}
 }
 
-// userCookieMiddleware ensures a cookie of the given name is present and
-// attaches its value to the request's context using the given key, before
-// passing it on to the wrapped handler.
-func userCookieMiddleware(cookieKey, contextKey string) gin.HandlerFunc {
+// optinHeaderMiddleware drops all requests to the given handler that are
+// missing a consent header. It is used instead of optinMiddleware when the
+// server is running in cookieless mode.
+func optinHeaderMiddleware(headerName, passWhen string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ck, err := c.Request.Cookie(cookieKey)
+		if c.GetHeader(headerName) != passWhen {
+			c.Status(http.StatusNoContent)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// privacySignalMiddleware handles requests carrying a Do-Not-Track or Global
+// Privacy Control signal. Depending on the given mode, such requests are
+// either dropped or flagged as anonymous using the given context key.
+func privacySignalMiddleware(mode config.PrivacySignals, contextKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("DNT") != "1" && c.GetHeader("Sec-GPC") != "1" {
+			c.Next()
+			return
+		}
+		switch mode {
+		case config.PrivacySignalsDrop:
+			c.Status(http.StatusNoContent)
+			c.Abort()
+			return
+		case config.PrivacySignalsAnonymous:
+			c.Set(contextKey, true)
+		}
+		c.Next()
+	}
+}
+
+// userIDMiddleware ensures a signed user id is present and attaches its value
+// to the request's context using the given key, before passing it on to the
+// wrapped handler. Requests that have been flagged as anonymous are passed on
+// without a user id.
+func (rt *router) userIDMiddleware(contextKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool(contextKeyAnonymous) {
+			c.Next()
+			return
+		}
+		userID, err := rt.readUserID(c)
 		if err != nil {
+			if !errors.Is(err, errNoUserID) {
+				rt.writeUserID(c, "")
+			}
 			newJSONError(
-				errors.New("user cookie: received no or blank identifier"),
+				fmt.Errorf("router: error reading user id: %w", err),
 				http.StatusBadRequest,
 			).Pipe(c)
 			return
 		}
-		c.Set(contextKey, ck.Value)
+		c.Set(contextKey, userID)
 		c.Next()
 	}
 }
@@ -65,28 +117,321 @@ func (rt *router) accountUserMiddleware(cookieKey, contextKey string) gin.Handle
 			return
 		}
 
-		var userID string
-		if err := rt.cookieSigner.Decode(authKey, authCookie.Value, &userID); err != nil {
-			authCookie, _ = rt.authCookie("", c.GetBool(contextKeySecureContext))
+		var token authToken
+		if err := rt.signers.session.Decode(authKey, authCookie.Value, &token); err != nil {
+			authCookie, _ = rt.authCookie(nil, c.GetBool(contextKeySecureContext))
+			http.SetCookie(c.Writer, authCookie)
+			newJSONError(
+				fmt.Errorf("error decoding cookie value: %w", err),
+				http.StatusUnauthorized,
+			).Pipe(c)
+			return
+		}
+
+		if err := rt.database(c).ValidateSession(token.AccountUserID, token.SessionID); err != nil {
+			authCookie, _ = rt.authCookie(nil, c.GetBool(contextKeySecureContext))
 			http.SetCookie(c.Writer, authCookie)
 			newJSONError(
-				fmt.Errorf("error decoding cookie value: %v", err),
+				fmt.Errorf("session is not valid anymore: %w", err),
 				http.StatusUnauthorized,
 			).Pipe(c)
 			return
 		}
 
-		user, userErr := rt.db.LookupAccountUser(userID)
+		user, userErr := rt.database(c).LookupAccountUser(token.AccountUserID)
 		if userErr != nil {
-			authCookie, _ = rt.authCookie("", c.GetBool(contextKeySecureContext))
+			authCookie, _ = rt.authCookie(nil, c.GetBool(contextKeySecureContext))
+			http.SetCookie(c.Writer, authCookie)
+			newJSONError(
+				fmt.Errorf("user with id %s does not exist: %w", token.AccountUserID, userErr),
+				http.StatusUnauthorized,
+			).Pipe(c)
+			return
+		}
+		// sessions that have been created before the account user enrolled
+		// two factor authentication are not valid anymore
+		if user.TOTPEnabled && !token.TOTPVerified {
+			authCookie, _ = rt.authCookie(nil, c.GetBool(contextKeySecureContext))
 			http.SetCookie(c.Writer, authCookie)
 			newJSONError(
-				fmt.Errorf("user with id %s does not exist: %v", userID, userErr),
+				fmt.Errorf("user with id %s is required to use two factor authentication", token.AccountUserID),
 				http.StatusUnauthorized,
 			).Pipe(c)
 			return
 		}
 		c.Set(contextKey, user)
+		c.Set(contextKeySession, token.SessionID)
+		c.Next()
+	}
+}
+
+// apiTokenMiddleware authenticates requests that carry an API token in their
+// Authorization header. Requests without such a header are passed on to the
+// given cookie based middleware.
+func (rt *router) apiTokenMiddleware(fallback gin.HandlerFunc, contextKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			fallback(c)
+			return
+		}
+
+		source := c.ClientIP()
+		if _, locked := rt.lockouts.source.Locked(source); locked {
+			newJSONError(
+				errors.New("router: too many failed authentication attempts"),
+				http.StatusTooManyRequests,
+			).Pipe(c)
+			return
+		}
+
+		user, err := rt.database(c).LookupAPIToken(strings.TrimPrefix(header, "Bearer "))
+		if err != nil {
+			rt.lockouts.source.Fail(source)
+			newJSONError(
+				fmt.Errorf("router: error looking up api token: %w", err),
+				http.StatusUnauthorized,
+			).Pipe(c)
+			return
+		}
+		c.Set(contextKey, user)
+		c.Next()
+	}
+}
+
+// tokenMiddleware ensures the request carries the given token in its
+// Authorization header.
+func (rt *router) tokenMiddleware(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		source := c.ClientIP()
+		if _, locked := rt.lockouts.source.Locked(source); locked {
+			newJSONError(
+				errors.New("router: too many failed authentication attempts"),
+				http.StatusTooManyRequests,
+			).Pipe(c)
+			return
+		}
+		header := c.GetHeader("Authorization")
+		if subtle.ConstantTimeCompare([]byte(header), []byte("Bearer "+token)) != 1 {
+			rt.lockouts.source.Fail(source)
+			newJSONError(
+				errors.New("router: invalid token"),
+				http.StatusUnauthorized,
+			).Pipe(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// metricsTokenMiddleware accepts requests carrying the given token in their
+// Authorization header, so metrics can be collected without logging in.
+// Such requests are marked using the given context key. Requests without a
+// bearer token are passed on, so they can be authenticated otherwise.
+func (rt *router) metricsTokenMiddleware(token, contextKey string) gin.HandlerFunc {
+	checkToken := rt.tokenMiddleware(token)
+	return func(c *gin.Context) {
+		if token == "" || !strings.HasPrefix(c.GetHeader("Authorization"), "Bearer ") {
+			c.Next()
+			return
+		}
+		c.Set(contextKey, true)
+		checkToken(c)
+	}
+}
+
+// skipWhenSetMiddleware skips the given handler for requests that have been
+// marked using the given context key.
+func skipWhenSetMiddleware(contextKey string, handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool(contextKey) {
+			c.Next()
+			return
+		}
+		handler(c)
+	}
+}
+
+// scopeMiddleware ensures the account user found in the request context under
+// the given key has been granted the given scope. This only restricts logins
+// that have been created from API tokens.
+func scopeMiddleware(scope persistence.APITokenScope, contextKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountUser, ok := c.Value(contextKey).(persistence.LoginResult)
+		if !ok {
+			newJSONError(
+				errors.New("router: could not find account user object in request context"),
+				http.StatusUnauthorized,
+			).Pipe(c)
+			return
+		}
+		if !accountUser.HasScope(scope) {
+			newJSONError(
+				fmt.Errorf("router: api token has not been granted scope %s", scope),
+				http.StatusForbidden,
+			).Pipe(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// accountAccessMiddleware ensures the account user found in the request
+// context under the given key is allowed to access the account identified
+// by the given route parameter. In case the route parameter is empty, the
+// request is passed on to the wrapped handler.
+func accountAccessMiddleware(paramName, contextKey string) gin.HandlerFunc {
+	return accountPermissionMiddleware(paramName, contextKey, (*persistence.LoginResult).CanAccessAccount)
+}
+
+// accountAdminMiddleware ensures the account user found in the request
+// context under the given key is allowed to manage the account identified
+// by the given route parameter. In case the route parameter is empty, the
+// request is passed on to the wrapped handler.
+func accountAdminMiddleware(paramName, contextKey string) gin.HandlerFunc {
+	return accountPermissionMiddleware(paramName, contextKey, (*persistence.LoginResult).CanManageAccount)
+}
+
+func accountPermissionMiddleware(paramName, contextKey string, check func(*persistence.LoginResult, string) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountID := c.Param(paramName)
+		if accountID == "" {
+			c.Next()
+			return
+		}
+		accountUser, ok := c.Value(contextKey).(persistence.LoginResult)
+		if !ok {
+			newJSONError(
+				errors.New("router: could not find account user object in request context"),
+				http.StatusUnauthorized,
+			).Pipe(c)
+			return
+		}
+		if !check(&accountUser, accountID) {
+			newJSONError(
+				fmt.Errorf("router: account user does not have the required permissions for account %s", accountID),
+				http.StatusForbidden,
+			).Pipe(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// superAdminMiddleware ensures the account user found in the request context
+// under the given key is a SuperAdmin, i.e. allowed to manage accounts and
+// account users for the entire instance.
+func superAdminMiddleware(contextKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountUser, ok := c.Value(contextKey).(persistence.LoginResult)
+		if !ok {
+			newJSONError(
+				errors.New("router: could not find account user object in request context"),
+				http.StatusUnauthorized,
+			).Pipe(c)
+			return
+		}
+		if !accountUser.IsSuperAdmin() {
+			newJSONError(
+				errors.New("router: account user is not allowed to manage this instance"),
+				http.StatusForbidden,
+			).Pipe(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+var validRequestID = regexp.MustCompile(`^[a-zA-Z0-9._:-]{1,128}$`)
+
+// requestIDMiddleware attaches an identifier to each request that can be
+// used for correlating log entries and error responses. Well formed values
+// that are passed by the client, e.g. by a reverse proxy, are kept.
+func requestIDMiddleware(headerName, contextKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(headerName)
+		if !validRequestID.MatchString(requestID) {
+			id, err := uuid.NewV4()
+			if err != nil {
+				newJSONError(
+					fmt.Errorf("router: error creating request id: %w", err),
+					http.StatusInternalServerError,
+				).Pipe(c)
+				return
+			}
+			requestID = id.String()
+		}
+		c.Set(contextKey, requestID)
+		c.Header(headerName, requestID)
+		c.Next()
+	}
+}
+
+// ingestRetryAfter is the number of seconds clients are asked to wait before
+// retrying in case their request has been shed.
+const ingestRetryAfter = 1
+
+// ingestLimitMiddleware caps the number of requests inserting events that
+// are handled concurrently. Requests that cannot acquire a slot within the
+// given timeout are rejected right away, so a database that cannot keep up
+// does not cause requests and connections to pile up.
+func (rt *router) ingestLimitMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rt.ingest == nil {
+			c.Next()
+			return
+		}
+		select {
+		case rt.ingest <- struct{}{}:
+		default:
+			timer := time.NewTimer(timeout)
+			select {
+			case rt.ingest <- struct{}{}:
+				timer.Stop()
+			case <-timer.C:
+				atomic.AddUint64(&rt.shed, 1)
+				c.Header("Retry-After", fmt.Sprintf("%d", ingestRetryAfter))
+				c.AbortWithStatusJSON(http.StatusServiceUnavailable, &errorResponse{
+					Error:      "router: too many concurrent inserts, shedding load",
+					Status:     http.StatusServiceUnavailable,
+					Code:       errorCodeUnavailable,
+					RetryAfter: ingestRetryAfter,
+					RequestID:  c.GetString(contextKeyRequestID),
+				})
+				return
+			}
+		}
+		defer func() { <-rt.ingest }()
+		c.Next()
+	}
+}
+
+// recoveryMiddleware recovers from panics in handlers, responding with a
+// JSON error and logging the stack trace together with the request id.
+func (rt *router) recoveryMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			// aborted handlers are expected to panic and are handled by
+			// net/http itself
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			atomic.AddUint64(&rt.panics, 1)
+			if rt.logger != nil {
+				rt.logger.WithFields(logrus.Fields{
+					"requestId": c.GetString(contextKeyRequestID),
+					"stack":     string(debug.Stack()),
+				}).Errorf("router: recovered from panic: %v", rec)
+			}
+			newJSONError(
+				errors.New("router: internal error"),
+				http.StatusInternalServerError,
+			).Pipe(c)
+		}()
 		c.Next()
 	}
 }
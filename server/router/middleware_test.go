@@ -4,6 +4,7 @@
 package router
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -12,7 +13,9 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
 	"github.com/gorilla/securecookie"
+	"github.com/offen/offen/server/config"
 	"github.com/offen/offen/server/persistence"
 )
 
@@ -70,9 +73,70 @@ func TestOptinMiddleware(t *testing.T) {
 	})
 }
 
-func TestUserCookieMiddleware(t *testing.T) {
+func TestPrivacySignalMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		mode           config.PrivacySignals
+		headers        map[string]string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			"no signal",
+			config.PrivacySignalsDrop,
+			nil,
+			http.StatusOK,
+			"anonymous is false",
+		},
+		{
+			"ignore",
+			config.PrivacySignalsIgnore,
+			map[string]string{"DNT": "1"},
+			http.StatusOK,
+			"anonymous is false",
+		},
+		{
+			"anonymous",
+			config.PrivacySignalsAnonymous,
+			map[string]string{"Sec-GPC": "1"},
+			http.StatusOK,
+			"anonymous is true",
+		},
+		{
+			"drop",
+			config.PrivacySignalsDrop,
+			map[string]string{"DNT": "1"},
+			http.StatusNoContent,
+			"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := gin.New()
+			m.GET("/", privacySignalMiddleware(test.mode, "anonymous"), func(c *gin.Context) {
+				c.String(http.StatusOK, "anonymous is %v", c.GetBool("anonymous"))
+			})
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for key, value := range test.headers {
+				r.Header.Set(key, value)
+			}
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatus {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if w.Body.String() != test.expectedBody {
+				t.Errorf("Unexpected body %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestUserIDMiddleware(t *testing.T) {
+	cookieSigner := securecookie.New([]byte("keyboard cat"), nil)
+	rt := router{signers: newSigners([]byte("keyboard cat"), 0), config: &config.Config{}}
 	m := gin.New()
-	m.GET("/", userCookieMiddleware("user", "1"), func(c *gin.Context) {
+	m.GET("/", rt.userIDMiddleware("1"), func(c *gin.Context) {
 		value := c.Value("1")
 		c.String(http.StatusOK, "value is %v", value)
 	})
@@ -104,7 +168,7 @@ func TestUserCookieMiddleware(t *testing.T) {
 		}
 	})
 
-	t.Run("ok", func(t *testing.T) {
+	t.Run("unsigned value", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		r := httptest.NewRequest(http.MethodGet, "/", nil)
 		r.AddCookie(&http.Cookie{
@@ -112,6 +176,107 @@ func TestUserCookieMiddleware(t *testing.T) {
 			Value: "token",
 		})
 		m.ServeHTTP(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+		if !strings.Contains(w.Body.String(), "received invalid identifier") {
+			t.Errorf("Unexpected body %s", w.Body.String())
+		}
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		value, _ := cookieSigner.Encode("user", "token")
+		r.AddCookie(&http.Cookie{
+			Name:  "user",
+			Value: value,
+		})
+		m.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+		if w.Body.String() != "value is token" {
+			t.Errorf("Unexpected body %s", w.Body.String())
+		}
+	})
+}
+
+func TestUserIDMiddleware_AcceptUnsigned(t *testing.T) {
+	legacyID := "4e9a8bd6-1f8a-4b8a-9d0e-3c4a5d6e7f80"
+	tests := []struct {
+		name           string
+		acceptUnsigned bool
+		value          string
+		expectedStatus int
+	}{
+		{"legacy value accepted", true, legacyID, http.StatusOK},
+		{"legacy value rejected", false, legacyID, http.StatusBadRequest},
+		{"no uuid", true, "token", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.UserCookie.AcceptUnsigned = test.acceptUnsigned
+			rt := router{signers: newSigners([]byte("keyboard cat"), 0), config: cfg}
+			m := gin.New()
+			m.GET("/", rt.userIDMiddleware("1"), func(c *gin.Context) {
+				c.String(http.StatusOK, "value is %v", c.Value("1"))
+			})
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.AddCookie(&http.Cookie{Name: "user", Value: test.value})
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatus {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.expectedStatus != http.StatusOK {
+				return
+			}
+			if w.Body.String() != "value is "+legacyID {
+				t.Errorf("Unexpected body %s", w.Body.String())
+			}
+			cookies := w.Result().Cookies()
+			if len(cookies) != 1 {
+				t.Fatalf("Expected upgraded cookie, got %v", cookies)
+			}
+			var userID string
+			if err := rt.signers.user.Decode("user", cookies[0].Value, &userID); err != nil || userID != legacyID {
+				t.Errorf("Unexpected upgraded cookie %v, %v", userID, err)
+			}
+		})
+	}
+}
+
+func TestUserIDMiddleware_Cookieless(t *testing.T) {
+	cookieSigner := securecookie.New([]byte("keyboard cat"), nil)
+	cfg := &config.Config{}
+	cfg.UserCookie.Disabled = true
+	rt := router{signers: newSigners([]byte("keyboard cat"), 0), config: cfg}
+	m := gin.New()
+	m.GET("/", rt.userIDMiddleware("1"), func(c *gin.Context) {
+		value := c.Value("1")
+		c.String(http.StatusOK, "value is %v", value)
+	})
+	t.Run("cookie only", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		value, _ := cookieSigner.Encode("user", "token")
+		r.AddCookie(&http.Cookie{
+			Name:  "user",
+			Value: value,
+		})
+		m.ServeHTTP(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		value, _ := cookieSigner.Encode("user", "token")
+		r.Header.Set(userHeaderKey, value)
+		m.ServeHTTP(w, r)
 		if w.Code != http.StatusOK {
 			t.Errorf("Unexpected status code %v", w.Code)
 		}
@@ -125,20 +290,33 @@ type mockUserLookupDatabase struct {
 	persistence.Service
 }
 
+func (*mockUserLookupDatabase) ValidateSession(accountUserID, sessionID string) error {
+	if sessionID == "revoked-session" {
+		return errors.New("session has been revoked")
+	}
+	return nil
+}
+
 func (*mockUserLookupDatabase) LookupAccountUser(accountUserID string) (persistence.LoginResult, error) {
 	if accountUserID == "account-user-id-1" {
 		return persistence.LoginResult{
 			AccountUserID: "account-user-id-1",
 		}, nil
 	}
+	if accountUserID == "account-user-id-3" {
+		return persistence.LoginResult{
+			AccountUserID: "account-user-id-3",
+			TOTPEnabled:   true,
+		}, nil
+	}
 	return persistence.LoginResult{}, fmt.Errorf("account user with id %s not found", accountUserID)
 }
 
 func TestAccountUserMiddleware(t *testing.T) {
 	cookieSigner := securecookie.New([]byte("keyboard cat"), nil)
 	rt := router{
-		cookieSigner: cookieSigner,
-		db:           &mockUserLookupDatabase{},
+		signers: newSigners([]byte("keyboard cat"), 0),
+		db:      &mockUserLookupDatabase{},
 	}
 	m := gin.New()
 	m.GET("/", rt.accountUserMiddleware("auth", "1"), func(c *gin.Context) {
@@ -168,10 +346,24 @@ func TestAccountUserMiddleware(t *testing.T) {
 		}
 	})
 
+	t.Run("revoked session", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		cookieValue, _ := cookieSigner.Encode("auth", authToken{AccountUserID: "account-user-id-1", SessionID: "revoked-session"})
+		r.AddCookie(&http.Cookie{
+			Name:  "auth",
+			Value: cookieValue,
+		})
+		m.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+	})
+
 	t.Run("bad db lookup", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		r := httptest.NewRequest(http.MethodGet, "/", nil)
-		cookieValue, _ := cookieSigner.Encode("auth", "account-user-id-2")
+		cookieValue, _ := cookieSigner.Encode("auth", authToken{AccountUserID: "account-user-id-2"})
 		r.AddCookie(&http.Cookie{
 			Name:  "auth",
 			Value: cookieValue,
@@ -182,10 +374,38 @@ func TestAccountUserMiddleware(t *testing.T) {
 		}
 	})
 
+	t.Run("totp not verified", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		cookieValue, _ := cookieSigner.Encode("auth", authToken{AccountUserID: "account-user-id-3"})
+		r.AddCookie(&http.Cookie{
+			Name:  "auth",
+			Value: cookieValue,
+		})
+		m.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+	})
+
+	t.Run("ok totp verified", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		cookieValue, _ := cookieSigner.Encode("auth", authToken{AccountUserID: "account-user-id-3", TOTPVerified: true})
+		r.AddCookie(&http.Cookie{
+			Name:  "auth",
+			Value: cookieValue,
+		})
+		m.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+	})
+
 	t.Run("ok", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		r := httptest.NewRequest(http.MethodGet, "/", nil)
-		cookieValue, _ := cookieSigner.Encode("auth", "account-user-id-1")
+		cookieValue, _ := cookieSigner.Encode("auth", authToken{AccountUserID: "account-user-id-1"})
 		r.AddCookie(&http.Cookie{
 			Name:  "auth",
 			Value: cookieValue,
@@ -239,6 +459,110 @@ func TestHeaderMiddleware(t *testing.T) {
 	}
 }
 
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		header         string
+		expectGenerate bool
+	}{
+		{"no header", "", true},
+		{"valid header", "proxy-request-1", false},
+		{"malformed header", "not valid\n", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := gin.New()
+			m.GET("/", requestIDMiddleware("X-Request-Id", contextKeyRequestID), func(c *gin.Context) {
+				newJSONError(errors.New("did not work"), http.StatusBadRequest).Pipe(c)
+			})
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.header != "" {
+				r.Header.Set("X-Request-Id", test.header)
+			}
+			m.ServeHTTP(w, r)
+
+			requestID := w.Header().Get("X-Request-Id")
+			if test.expectGenerate {
+				if _, err := uuid.FromString(requestID); err != nil {
+					t.Errorf("Expected generated request id, got %v", requestID)
+				}
+			} else if requestID != test.header {
+				t.Errorf("Expected request id of %v, got %v", test.header, requestID)
+			}
+			if !strings.Contains(w.Body.String(), fmt.Sprintf(`"requestId":"%s"`, requestID)) {
+				t.Errorf("Expected error response to contain request id, got %v", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouter_recoveryMiddleware(t *testing.T) {
+	rt := &router{}
+	m := gin.New()
+	m.GET("/", requestIDMiddleware("X-Request-Id", contextKeyRequestID), rt.recoveryMiddleware(), func(c *gin.Context) {
+		panic("did not work")
+	})
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Request-Id", "request-a")
+	m.ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Unexpected status code %v", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"requestId":"request-a"`) {
+		t.Errorf("Unexpected body %s", w.Body.String())
+	}
+	if rt.panics != 1 {
+		t.Errorf("Expected panic to be counted, got %d", rt.panics)
+	}
+}
+
+func TestRouter_ingestLimitMiddleware(t *testing.T) {
+	rt := &router{ingest: make(chan struct{}, 1)}
+	release := make(chan struct{})
+	entered := make(chan struct{})
+	m := gin.New()
+	m.POST("/", rt.ingestLimitMiddleware(time.Millisecond*10), func(c *gin.Context) {
+		entered <- struct{}{}
+		<-release
+		c.Status(http.StatusCreated)
+	})
+
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		m.ServeHTTP(first, httptest.NewRequest(http.MethodPost, "/", nil))
+		close(done)
+	}()
+	<-entered
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected status code %v", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "1" {
+		t.Errorf("Unexpected Retry-After header %v", w.Header().Get("Retry-After"))
+	}
+	if rt.shed != 1 {
+		t.Errorf("Expected shed request to be counted, got %d", rt.shed)
+	}
+
+	close(release)
+	<-done
+	if first.Code != http.StatusCreated {
+		t.Errorf("Unexpected status code %v", first.Code)
+	}
+
+	go func() { <-entered }()
+	w = httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected slot to be released, got status code %v", w.Code)
+	}
+}
+
 func TestEtagMiddleware(t *testing.T) {
 	m := gin.New()
 	m.GET("/", etagMiddleware(), func(c *gin.Context) {
@@ -273,3 +597,374 @@ func TestEtagMiddleware(t *testing.T) {
 		t.Errorf("Unexpected status code %v", w2.Code)
 	}
 }
+
+func TestAccountAccessMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		user           interface{}
+		expectedStatus int
+	}{
+		{
+			"no account id",
+			"/",
+			nil,
+			http.StatusOK,
+		},
+		{
+			"bad context",
+			"/account-a",
+			"account-user-id-1",
+			http.StatusUnauthorized,
+		},
+		{
+			"account out of scope",
+			"/account-b",
+			persistence.LoginResult{
+				Accounts: []persistence.LoginAccountResult{
+					{AccountID: "account-a"},
+				},
+			},
+			http.StatusForbidden,
+		},
+		{
+			"ok",
+			"/account-a",
+			persistence.LoginResult{
+				Accounts: []persistence.LoginAccountResult{
+					{AccountID: "account-a"},
+				},
+			},
+			http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := gin.New()
+			handler := func(c *gin.Context) {
+				c.String(http.StatusOK, "OK")
+			}
+			setUser := func(c *gin.Context) {
+				c.Set("1", test.user)
+			}
+			m.GET("/", setUser, accountAccessMiddleware("accountID", "1"), handler)
+			m.GET("/:accountID", setUser, accountAccessMiddleware("accountID", "1"), handler)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, test.path, nil)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatus {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
+
+func TestAccountAdminMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		user           interface{}
+		expectedStatus int
+	}{
+		{
+			"bad context",
+			"account-user-id-1",
+			http.StatusUnauthorized,
+		},
+		{
+			"viewer",
+			persistence.LoginResult{
+				Accounts: []persistence.LoginAccountResult{
+					{AccountID: "account-a", Role: persistence.AccountUserRoleViewer},
+				},
+			},
+			http.StatusForbidden,
+		},
+		{
+			"account admin",
+			persistence.LoginResult{
+				Accounts: []persistence.LoginAccountResult{
+					{AccountID: "account-a", Role: persistence.AccountUserRoleAdmin},
+				},
+			},
+			http.StatusOK,
+		},
+		{
+			"super admin",
+			persistence.LoginResult{
+				AdminLevel: persistence.AccountUserAdminLevelSuperAdmin,
+				Accounts: []persistence.LoginAccountResult{
+					{AccountID: "account-a", Role: persistence.AccountUserRoleViewer},
+				},
+			},
+			http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := gin.New()
+			m.GET("/:accountID", func(c *gin.Context) {
+				c.Set("1", test.user)
+			}, accountAdminMiddleware("accountID", "1"), func(c *gin.Context) {
+				c.String(http.StatusOK, "OK")
+			})
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/account-a", nil)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatus {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
+
+type mockAPITokenDatabase struct {
+	persistence.Service
+}
+
+func (*mockAPITokenDatabase) LookupAPIToken(token string) (persistence.LoginResult, error) {
+	if token == "token-a.secret" {
+		return persistence.LoginResult{
+			AccountUserID: "account-user-id-1",
+			Scopes:        []persistence.APITokenScope{persistence.APITokenScopeReadStats},
+		}, nil
+	}
+	return persistence.LoginResult{}, errors.New("unknown token")
+}
+
+func TestAPITokenMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		header         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			"no header",
+			"",
+			http.StatusOK,
+			"fallback",
+		},
+		{
+			"other scheme",
+			"Basic abc",
+			http.StatusOK,
+			"fallback",
+		},
+		{
+			"bad token",
+			"Bearer token-a.other",
+			http.StatusUnauthorized,
+			"",
+		},
+		{
+			"ok",
+			"Bearer token-a.secret",
+			http.StatusOK,
+			"user id is account-user-id-1",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: &mockAPITokenDatabase{}, lockouts: newTestLockouts(t, loginFailuresPerAccountUser, loginFailuresPerSource)}
+			fallback := func(c *gin.Context) {
+				c.String(http.StatusOK, "fallback")
+				c.Abort()
+			}
+			m := gin.New()
+			m.GET("/", rt.apiTokenMiddleware(fallback, "1"), func(c *gin.Context) {
+				user, _ := c.Value("1").(persistence.LoginResult)
+				c.String(http.StatusOK, "user id is %v", user.AccountUserID)
+			})
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.header != "" {
+				r.Header.Set("Authorization", test.header)
+			}
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatus {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if !strings.Contains(w.Body.String(), test.expectedBody) {
+				t.Errorf("Unexpected body %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestTokenMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		header         string
+		expectedStatus int
+	}{
+		{"no header", "", http.StatusUnauthorized},
+		{"bad token", "Bearer other", http.StatusUnauthorized},
+		{"other scheme", "Basic token", http.StatusUnauthorized},
+		{"ok", "Bearer token", http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{lockouts: newTestLockouts(t, loginFailuresPerAccountUser, loginFailuresPerSource)}
+			m := gin.New()
+			m.GET("/", rt.tokenMiddleware("token"), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.header != "" {
+				r.Header.Set("Authorization", test.header)
+			}
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatus {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
+
+func TestMetricsTokenMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		token          string
+		header         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"no header", "token", "", http.StatusForbidden, "fallback"},
+		{"no token configured", "", "Bearer token", http.StatusForbidden, "fallback"},
+		{"bad token", "token", "Bearer other", http.StatusUnauthorized, ""},
+		{"ok", "token", "Bearer token", http.StatusOK, "metrics"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{lockouts: newTestLockouts(t, loginFailuresPerAccountUser, loginFailuresPerSource)}
+			fallback := func(c *gin.Context) {
+				c.String(http.StatusForbidden, "fallback")
+				c.Abort()
+			}
+			m := gin.New()
+			m.GET(
+				"/",
+				rt.metricsTokenMiddleware(test.token, "1"),
+				skipWhenSetMiddleware("1", fallback),
+				func(c *gin.Context) {
+					c.String(http.StatusOK, "metrics")
+				},
+			)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.header != "" {
+				r.Header.Set("Authorization", test.header)
+			}
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatus {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if !strings.Contains(w.Body.String(), test.expectedBody) {
+				t.Errorf("Unexpected body %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestScopeMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		user           interface{}
+		expectedStatus int
+	}{
+		{
+			"bad context",
+			"account-user-id-1",
+			http.StatusUnauthorized,
+		},
+		{
+			"cookie login",
+			persistence.LoginResult{},
+			http.StatusOK,
+		},
+		{
+			"token missing scope",
+			persistence.LoginResult{
+				Scopes: []persistence.APITokenScope{persistence.APITokenScopeReadEvents},
+			},
+			http.StatusForbidden,
+		},
+		{
+			"token with scope",
+			persistence.LoginResult{
+				Scopes: []persistence.APITokenScope{persistence.APITokenScopeReadStats},
+			},
+			http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := gin.New()
+			m.GET("/", func(c *gin.Context) {
+				c.Set("1", test.user)
+			}, scopeMiddleware(persistence.APITokenScopeReadStats, "1"), func(c *gin.Context) {
+				c.String(http.StatusOK, "OK")
+			})
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatus {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
+
+func TestSuperAdminMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		user           interface{}
+		expectedStatus int
+	}{
+		{
+			"bad context",
+			"account-user-id-1",
+			http.StatusUnauthorized,
+		},
+		{
+			"account admin",
+			persistence.LoginResult{
+				Accounts: []persistence.LoginAccountResult{
+					{AccountID: "account-a", Role: persistence.AccountUserRoleAdmin},
+				},
+			},
+			http.StatusForbidden,
+		},
+		{
+			"super admin",
+			persistence.LoginResult{
+				AdminLevel: persistence.AccountUserAdminLevelSuperAdmin,
+			},
+			http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := gin.New()
+			m.GET("/", func(c *gin.Context) {
+				c.Set("1", test.user)
+			}, superAdminMiddleware("1"), func(c *gin.Context) {
+				c.String(http.StatusOK, "OK")
+			})
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatus {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gin-contrib/location"
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+)
+
+// requestOrigin returns the hostname of the site the given request has been
+// sent from, using the Origin header and falling back to the Referer. In case
+// neither is present, an empty string is returned. Requests that have been
+// sent by a known AMP cache on behalf of a site use the site's origin instead,
+// which is only set after the request's origin has been checked against the
+// list of caches.
+func requestOrigin(c *gin.Context) string {
+	for _, value := range []string{c.GetString(contextKeySourceOrigin), c.GetHeader("Origin"), c.GetHeader("Referer")} {
+		if host := originHost(value); host != "" {
+			return host
+		}
+	}
+	return ""
+}
+
+// originHost returns the lowercased hostname of the given origin or URL. In
+// case it cannot be parsed, an empty string is returned.
+func originHost(value string) string {
+	if value == "" || value == "null" {
+		return ""
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// matchesDomain checks whether the given host is one of the given domains or
+// a subdomain of one of them.
+func matchesDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOrigin verifies the given request has been sent from one of the
+// domains of the given account. Accounts without any domains accept events
+// from any origin. Requests sent by the instance itself, i.e. by the vault
+// that is embedded by a site, are checked using the origin of the embedding
+// site which is sent by the vault.
+func (rt *router) checkOrigin(c *gin.Context, accountID string) error {
+	mode := rt.config.OriginCheckMode()
+	if mode == "" || mode == config.OriginCheckOff {
+		return nil
+	}
+	domains, err := rt.database(c).LookupAccountDomains(accountID)
+	if err != nil {
+		return fmt.Errorf("router: error looking up domains of account %s: %w", accountID, err)
+	}
+	if len(domains) == 0 {
+		return nil
+	}
+	origin := requestOrigin(c)
+	if u := location.Get(c); u != nil && origin != "" && origin == strings.ToLower(u.Hostname()) {
+		// the vault reads the origin of the embedding site from the messages
+		// it receives, which cannot be forged by the site. The header is only
+		// trusted when sent by the vault itself.
+		origin = originHost(c.GetHeader(embedderHeaderKey))
+	}
+	if origin == "" {
+		if mode == config.OriginCheckStrict {
+			return errOriginMismatch(fmt.Sprintf("router: request for account %s does not carry an origin", accountID))
+		}
+		return nil
+	}
+	if matchesDomain(origin, domains) {
+		return nil
+	}
+	return errOriginMismatch(fmt.Sprintf("router: origin %s does not match domains of account %s", origin, accountID))
+}
+
+// errOriginMismatch is returned when a request has been sent from an origin
+// that does not match the domains of an account.
+type errOriginMismatch string
+
+func (e errOriginMismatch) Error() string {
+	return string(e)
+}
@@ -0,0 +1,148 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-contrib/location"
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockLookupAccountDomainsDatabase struct {
+	persistence.Service
+	domains []string
+	err     error
+}
+
+func (m *mockLookupAccountDomainsDatabase) LookupAccountDomains(string) ([]string, error) {
+	return m.domains, m.err
+}
+
+func TestRouter_checkOrigin(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        config.OriginCheck
+		database    *mockLookupAccountDomainsDatabase
+		headers     map[string]string
+		expectError bool
+	}{
+		{
+			"off",
+			config.OriginCheckOff,
+			&mockLookupAccountDomainsDatabase{domains: []string{"example.com"}},
+			map[string]string{"Origin": "https://evil.example.net"},
+			false,
+		},
+		{
+			"lookup error",
+			config.OriginCheckLenient,
+			&mockLookupAccountDomainsDatabase{err: errors.New("did not work")},
+			map[string]string{"Origin": "https://www.example.com"},
+			true,
+		},
+		{
+			"no domains",
+			config.OriginCheckStrict,
+			&mockLookupAccountDomainsDatabase{},
+			map[string]string{"Origin": "https://evil.example.net"},
+			false,
+		},
+		{
+			"matching subdomain",
+			config.OriginCheckStrict,
+			&mockLookupAccountDomainsDatabase{domains: []string{"example.com"}},
+			map[string]string{"Origin": "https://www.example.com"},
+			false,
+		},
+		{
+			"matching referer",
+			config.OriginCheckStrict,
+			&mockLookupAccountDomainsDatabase{domains: []string{"example.com"}},
+			map[string]string{"Referer": "https://example.com/page?query"},
+			false,
+		},
+		{
+			"mismatch",
+			config.OriginCheckLenient,
+			&mockLookupAccountDomainsDatabase{domains: []string{"example.com"}},
+			map[string]string{"Origin": "https://notexample.com"},
+			true,
+		},
+		{
+			"vault with matching embedder",
+			config.OriginCheckStrict,
+			&mockLookupAccountDomainsDatabase{domains: []string{"example.com"}},
+			map[string]string{"Origin": "https://offen.example.net", "X-Offen-Origin": "https://www.example.com"},
+			false,
+		},
+		{
+			"vault with mismatching embedder",
+			config.OriginCheckLenient,
+			&mockLookupAccountDomainsDatabase{domains: []string{"example.com"}},
+			map[string]string{"Origin": "https://offen.example.net", "X-Offen-Origin": "https://evil.example.net"},
+			true,
+		},
+		{
+			"vault without embedder lenient",
+			config.OriginCheckLenient,
+			&mockLookupAccountDomainsDatabase{domains: []string{"example.com"}},
+			map[string]string{"Origin": "https://offen.example.net"},
+			false,
+		},
+		{
+			"vault without embedder strict",
+			config.OriginCheckStrict,
+			&mockLookupAccountDomainsDatabase{domains: []string{"example.com"}},
+			map[string]string{"Origin": "https://offen.example.net"},
+			true,
+		},
+		{
+			"embedder header from other origin",
+			config.OriginCheckLenient,
+			&mockLookupAccountDomainsDatabase{domains: []string{"example.com"}},
+			map[string]string{"Origin": "https://evil.example.net", "X-Offen-Origin": "https://www.example.com"},
+			true,
+		},
+		{
+			"missing origin lenient",
+			config.OriginCheckLenient,
+			&mockLookupAccountDomainsDatabase{domains: []string{"example.com"}},
+			nil,
+			false,
+		},
+		{
+			"missing origin strict",
+			config.OriginCheckStrict,
+			&mockLookupAccountDomainsDatabase{domains: []string{"example.com"}},
+			nil,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := &router{db: test.database, config: &config.Config{}}
+			rt.config.App.OriginCheck = test.mode
+			var err error
+			m := gin.New()
+			m.Use(location.Default())
+			m.POST("/", func(c *gin.Context) {
+				err = rt.checkOrigin(c, "account-a")
+			})
+			r := httptest.NewRequest(http.MethodPost, "https://offen.example.net/", nil)
+			for key, value := range test.headers {
+				r.Header.Set(key, value)
+			}
+			m.ServeHTTP(httptest.NewRecorder(), r)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/offen/offen/server/keys"
+	"github.com/offen/offen/server/persistence"
+)
+
+// transparentGIF is a 1x1 pixel transparent GIF image.
+var transparentGIF = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00,
+	0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00,
+	0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+type anonymousPayload struct {
+	Type      string    `json:"type"`
+	Href      string    `json:"href,omitempty"`
+	Title     string    `json:"title,omitempty"`
+	Referrer  string    `json:"referrer,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	SessionID string    `json:"sessionId"`
+	Source    string    `json:"source"`
+}
+
+// maxAnonymousURLLength is the maximum length of URLs that are stored for
+// anonymous events, matching the limits the vault applies to regular events.
+const maxAnonymousURLLength = 2000
+
+// getPixel records an anonymous event for visitors that do not run
+// JavaScript and responds with a transparent image.
+func (rt *router) getPixel(c *gin.Context) {
+	accountID := c.Query("accountId")
+	if accountID == "" {
+		newJSONError(
+			errors.New("router: missing accountId query parameter"),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+	if !rt.insertAnonymousEvent(c, accountID, "noscript") {
+		return
+	}
+	c.Data(http.StatusOK, "image/gif", transparentGIF)
+}
+
+// insertAnonymousEvent stores an anonymous event for the given account on
+// behalf of a client that cannot encrypt events itself. Each event is stored
+// for a new random user whose secret is encrypted using the account's public
+// key, so operators can decrypt such events like any other event. In case the
+// event cannot be stored, an error response is written and false is returned.
+func (rt *router) insertAnonymousEvent(c *gin.Context, accountID, source string) bool {
+	if l := <-rt.getLimiter().LinearThrottle(rt.ingestRateLimit(), fmt.Sprintf("anonymousEvent-%s", c.ClientIP())); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return false
+	}
+
+	if err := rt.checkOrigin(c, accountID); err != nil {
+		var originMismatchErr errOriginMismatch
+		if errors.As(err, &originMismatchErr) {
+			newJSONError(err, http.StatusForbidden).Pipe(c)
+			return false
+		}
+		var unknownAccountErr persistence.ErrUnknownAccount
+		if errors.As(err, &unknownAccountErr) {
+			newJSONError(err, http.StatusNotFound).Pipe(c)
+			return false
+		}
+		newJSONError(err, http.StatusInternalServerError).Pipe(c)
+		return false
+	}
+
+	account, err := rt.database(c).GetAccount(accountID, false, "")
+	if err != nil {
+		var unknownAccountErr persistence.ErrUnknownAccount
+		if errors.As(err, &unknownAccountErr) {
+			newJSONError(
+				fmt.Errorf("router: error looking up account: %w", err),
+				http.StatusNotFound,
+			).Pipe(c)
+			return false
+		}
+		newJSONError(
+			fmt.Errorf("router: error looking up account: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return false
+	}
+
+	userID, encryptedSecret, payload, err := newAnonymousEvent(account.PublicKey, anonymousPayload{
+		Type:      "PAGEVIEW",
+		Href:      anonymousURL(c.Query("href"), c.GetHeader("Referer")),
+		Title:     c.Query("title"),
+		Referrer:  anonymousURL(c.Query("referrer")),
+		Timestamp: time.Now().UTC(),
+		Source:    source,
+	})
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error creating event payload: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return false
+	}
+
+	if err := rt.database(c).AssociateUserSecret(accountID, userID, encryptedSecret); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error persisting user secret: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return false
+	}
+
+	if err := rt.database(c).Insert(userID, accountID, payload, nil); err != nil {
+		status := http.StatusInternalServerError
+		var unknownAccountErr persistence.ErrUnknownAccount
+		var rejectedErr persistence.ErrEventRejected
+		var quotaExceededErr persistence.ErrQuotaExceeded
+		switch {
+		case errors.As(err, &unknownAccountErr):
+			status = http.StatusNotFound
+		case errors.As(err, &rejectedErr):
+			status = http.StatusForbidden
+		case errors.As(err, &quotaExceededErr):
+			status = http.StatusTooManyRequests
+		case errors.Is(err, persistence.ErrInsertBufferFull):
+			status = http.StatusServiceUnavailable
+		}
+		newJSONError(
+			fmt.Errorf("router: error inserting event: %w", err),
+			status,
+		).Pipe(c)
+		return false
+	}
+	return true
+}
+
+// anonymousURL returns the first of the given values that is an absolute
+// http(s) URL of acceptable length. In case none of them is, an empty string
+// is returned.
+func anonymousURL(values ...string) string {
+	for _, value := range values {
+		if value == "" || len(value) > maxAnonymousURLLength {
+			continue
+		}
+		u, err := url.Parse(value)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		return u.String()
+	}
+	return ""
+}
+
+// newAnonymousEvent creates a random user and a secret for it. The secret is
+// encrypted using the given public key, and the given payload is encrypted
+// using the secret. Each anonymous event uses its own user and session as
+// there is no way of recognizing returning visitors.
+func newAnonymousEvent(publicKey interface{}, payload anonymousPayload) (string, string, string, error) {
+	userID, err := uuid.NewV4()
+	if err != nil {
+		return "", "", "", fmt.Errorf("router: error creating user id: %w", err)
+	}
+	sessionID, err := uuid.NewV4()
+	if err != nil {
+		return "", "", "", fmt.Errorf("router: error creating session id: %w", err)
+	}
+	payload.SessionID = sessionID.String()
+
+	key, err := keys.GenerateRandomBytes(keys.DefaultSecretLength)
+	if err != nil {
+		return "", "", "", fmt.Errorf("router: error creating key: %w", err)
+	}
+	j, err := jwk.New(key)
+	if err != nil {
+		return "", "", "", fmt.Errorf("router: error wrapping key as jwk: %w", err)
+	}
+	j.Set(jwk.AlgorithmKey, "A128GCM")
+	j.Set("ext", true)
+	j.Set(jwk.KeyOpsKey, jwk.KeyOperationList{jwk.KeyOpEncrypt, jwk.KeyOpDecrypt})
+	jwkBytes, err := json.Marshal(j)
+	if err != nil {
+		return "", "", "", fmt.Errorf("router: error marshaling jwk: %w", err)
+	}
+	encryptedSecret, err := keys.EncryptAsymmetricWith(publicKey, jwkBytes)
+	if err != nil {
+		return "", "", "", fmt.Errorf("router: error encrypting user secret: %w", err)
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return "", "", "", fmt.Errorf("router: error marshaling payload: %w", err)
+	}
+	cipher, err := keys.EncryptWith(key, b)
+	if err != nil {
+		return "", "", "", fmt.Errorf("router: error encrypting payload: %w", err)
+	}
+	return userID.String(), encryptedSecret.Marshal(), cipher.Marshal(), nil
+}
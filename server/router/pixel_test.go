@@ -0,0 +1,193 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/keys"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockGetPixelService struct {
+	persistence.Service
+	err        error
+	accountErr error
+	publicKey  interface{}
+	userID     string
+	accountID  string
+	secret     string
+	payload    string
+}
+
+func (m *mockGetPixelService) GetAccount(accountID string, includeEvents bool, since string) (persistence.AccountResult, error) {
+	if m.accountErr != nil {
+		return persistence.AccountResult{}, m.accountErr
+	}
+	return persistence.AccountResult{AccountID: accountID, PublicKey: m.publicKey}, nil
+}
+
+func (m *mockGetPixelService) AssociateUserSecret(accountID, userID, encryptedUserSecret string) error {
+	m.secret = encryptedUserSecret
+	return nil
+}
+
+func (m *mockGetPixelService) Insert(userID, accountID, payload string, eventID *string) error {
+	m.userID = userID
+	m.accountID = accountID
+	m.payload = payload
+	return m.err
+}
+
+func newPixelTestKey(t *testing.T) (jwk.Key, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unexpected error creating key: %v", err)
+	}
+	j, err := jwk.New(key.Public())
+	if err != nil {
+		t.Fatalf("Unexpected error wrapping key: %v", err)
+	}
+	return j, key
+}
+
+func decryptPixelPayload(t *testing.T, key *rsa.PrivateKey, secret, payload string) anonymousPayload {
+	b, err := base64.StdEncoding.DecodeString(strings.Split(secret, " ")[1])
+	if err != nil {
+		t.Fatalf("Unexpected error decoding secret: %v", err)
+	}
+	jwkBytes, err := key.Decrypt(rand.Reader, b, &rsa.OAEPOptions{Hash: crypto.SHA256})
+	if err != nil {
+		t.Fatalf("Unexpected error decrypting secret: %v", err)
+	}
+	j, err := jwk.ParseKey(jwkBytes)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing secret: %v", err)
+	}
+	var symmetricKey []byte
+	if err := j.Raw(&symmetricKey); err != nil {
+		t.Fatalf("Unexpected error materializing secret: %v", err)
+	}
+	plaintext, err := keys.DecryptWith(symmetricKey, payload)
+	if err != nil {
+		t.Fatalf("Unexpected error decrypting payload: %v", err)
+	}
+	var result anonymousPayload
+	if err := json.Unmarshal(plaintext, &result); err != nil {
+		t.Fatalf("Unexpected error unmarshaling payload: %v", err)
+	}
+	return result
+}
+
+func TestRouter_getPixel(t *testing.T) {
+	publicKey, privateKey := newPixelTestKey(t)
+	tests := []struct {
+		name           string
+		db             *mockGetPixelService
+		query          string
+		headers        map[string]string
+		expectedStatus int
+		expectedHref   string
+		expectedTitle  string
+	}{
+		{
+			"missing account id",
+			&mockGetPixelService{},
+			"",
+			nil,
+			http.StatusBadRequest,
+			"",
+			"",
+		},
+		{
+			"unknown account",
+			&mockGetPixelService{accountErr: persistence.ErrUnknownAccount("unknown account")},
+			"?accountId=account-a",
+			nil,
+			http.StatusNotFound,
+			"",
+			"",
+		},
+		{
+			"database error",
+			&mockGetPixelService{publicKey: publicKey, err: errors.New("did not work")},
+			"?accountId=account-a",
+			nil,
+			http.StatusInternalServerError,
+			"",
+			"",
+		},
+		{
+			"ok",
+			&mockGetPixelService{publicKey: publicKey},
+			"?accountId=account-a",
+			map[string]string{"Referer": "https://www.example.net/about/"},
+			http.StatusOK,
+			"https://www.example.net/about/",
+			"",
+		},
+		{
+			"ok with query",
+			&mockGetPixelService{publicKey: publicKey},
+			"?accountId=account-a&href=https%3A%2F%2Fwww.example.net%2Fblog%2F&title=Blog&referrer=javascript%3Aalert(1)",
+			map[string]string{"Referer": "https://www.example.net/about/"},
+			http.StatusOK,
+			"https://www.example.net/blog/",
+			"Blog",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.db, config: &config.Config{}}
+			m := gin.New()
+			m.GET("/p.gif", rt.getPixel)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/p.gif"+test.query, nil)
+			for key, value := range test.headers {
+				r.Header.Set(key, value)
+			}
+			m.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			if w.Header().Get("Content-Type") != "image/gif" {
+				t.Errorf("Unexpected content type %v", w.Header().Get("Content-Type"))
+			}
+			if !bytes.Equal(w.Body.Bytes(), transparentGIF) {
+				t.Error("Expected transparent image to be returned")
+			}
+			if w.Header().Get("Set-Cookie") != "" {
+				t.Errorf("Unexpected cookie %v", w.Header().Get("Set-Cookie"))
+			}
+			if test.db.userID == "" || test.db.accountID != "account-a" {
+				t.Errorf("Expected event for a random user of account-a, got %q for %q", test.db.userID, test.db.accountID)
+			}
+			payload := decryptPixelPayload(t, privateKey, test.db.secret, test.db.payload)
+			if payload.Type != "PAGEVIEW" || payload.Source != "noscript" || payload.SessionID == "" {
+				t.Errorf("Unexpected payload %v", payload)
+			}
+			if payload.Href != test.expectedHref || payload.Title != test.expectedTitle || payload.Referrer != "" {
+				t.Errorf("Unexpected payload content %v", payload)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2020-2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/offen/offen/server/persistence"
+)
+
+type purgeStatus string
+
+const (
+	purgeStatusPending   purgeStatus = persistence.PurgeJobStatusPending
+	purgeStatusCompleted purgeStatus = persistence.PurgeJobStatusCompleted
+	purgeStatusFailed    purgeStatus = persistence.PurgeJobStatusFailed
+)
+
+const (
+	purgeReceiptKey = "purge"
+	purgeReceiptTTL = time.Hour * 24
+	// purgeTimeout is the duration after which a purge that is still
+	// pending is considered to have failed, e.g. because the instance
+	// running it has been stopped.
+	purgeTimeout = time.Hour
+)
+
+// purgeReceipt is the signed value handed out to users that have requested
+// an asynchronous purge of their data. It can be used to poll for completion.
+type purgeReceipt struct {
+	PurgeID string
+	Issued  time.Time
+}
+
+// purgeQueue runs asynchronous purges and keeps track of their status. The
+// status is stored in the database so it can be looked up on any instance.
+type purgeQueue struct {
+	db persistence.Service
+}
+
+// enqueue runs the given purge in the background and returns the identifier
+// that can be used for looking up its status.
+func (q *purgeQueue) enqueue(purge func() error) (string, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", fmt.Errorf("router: error creating purge id: %w", err)
+	}
+	purgeID := id.String()
+	if err := q.db.UpdatePurgeJob(purgeID, string(purgeStatusPending)); err != nil {
+		return "", fmt.Errorf("router: error recording purge: %w", err)
+	}
+	go func() {
+		status := purgeStatusCompleted
+		if err := purge(); err != nil {
+			status = purgeStatusFailed
+		}
+		// the outcome cannot be reported anywhere else, in case it cannot
+		// be recorded the purge is reported as failed after timing out
+		_ = q.db.UpdatePurgeJob(purgeID, string(status))
+	}()
+	return purgeID, nil
+}
+
+func (q *purgeQueue) status(purgeID string) (purgeStatus, error) {
+	job, err := q.db.GetPurgeJob(purgeID)
+	if err != nil {
+		return "", err
+	}
+	status := purgeStatus(job.Status)
+	if status == purgeStatusPending && time.Since(job.Updated) > purgeTimeout {
+		return purgeStatusFailed, nil
+	}
+	return status, nil
+}
+
+type purgeReceiptResponse struct {
+	Receipt string `json:"receipt"`
+}
+
+type purgeStatusResponse struct {
+	Status purgeStatus `json:"status"`
+}
+
+func (rt *router) enqueuePurge(c *gin.Context, userID string, accountIDs []string) {
+	// the context must not be used after the request has been handled
+	cCopy := c.Copy()
+	purgeID, err := rt.purges.enqueue(func() error {
+		if err := rt.database(cCopy).Purge(userID, accountIDs); err != nil {
+			rt.logError(cCopy, err, "error purging user events")
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error enqueuing purge: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	receipt, err := rt.signers.receipt.Encode(purgeReceiptKey, purgeReceipt{
+		PurgeID: purgeID,
+		Issued:  time.Now(),
+	})
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error signing purge receipt: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	if c.Query("user") != "" && len(accountIDs) == 0 {
+		rt.writeUserID(c, "")
+	}
+	c.JSON(http.StatusAccepted, purgeReceiptResponse{receipt})
+}
+
+func (rt *router) getPurge(c *gin.Context) {
+	var receipt purgeReceipt
+	if err := rt.signers.receipt.Decode(purgeReceiptKey, c.Param("receipt"), &receipt); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error verifying purge receipt: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+	if time.Since(receipt.Issued) > purgeReceiptTTL {
+		newJSONError(
+			errors.New("router: purge receipt has expired"),
+			http.StatusGone,
+		).Pipe(c)
+		return
+	}
+	status, err := rt.purges.status(receipt.PurgeID)
+	if err != nil {
+		var unknownPurgeErr persistence.ErrUnknownPurge
+		if errors.As(err, &unknownPurgeErr) {
+			newJSONError(
+				fmt.Errorf("router: unknown purge %s: %w", receipt.PurgeID, err),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error looking up purge %s: %w", receipt.PurgeID, err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, purgeStatusResponse{status})
+}
@@ -0,0 +1,130 @@
+// Copyright 2020-2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/securecookie"
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestRouter_asyncPurge(t *testing.T) {
+	tests := []struct {
+		name           string
+		db             *mockPurgeEventsService
+		expectedStatus purgeStatus
+	}{
+		{
+			"purge error",
+			&mockPurgeEventsService{
+				err: errors.New("did not work"),
+			},
+			purgeStatusFailed,
+		},
+		{
+			"ok",
+			&mockPurgeEventsService{},
+			purgeStatusCompleted,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{
+				db:      test.db,
+				signers: newSigners([]byte("abc"), 0),
+				purges:  &purgeQueue{db: test.db},
+			}
+			m := gin.New()
+			m.POST("/", func(c *gin.Context) {
+				c.Set(contextKeyCookie, "user-id")
+				c.Next()
+			}, rt.purgeEvents)
+			m.GET("/:receipt", rt.getPurge)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/?async=1", nil)
+			m.ServeHTTP(w, r)
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("Unexpected status code %d", w.Code)
+			}
+			var receipt purgeReceiptResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &receipt); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+
+			var status purgeStatusResponse
+			deadline := time.Now().Add(time.Second * 5)
+			for time.Now().Before(deadline) {
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/%s", receipt.Receipt), nil)
+				m.ServeHTTP(w, r)
+				if w.Code != http.StatusOK {
+					t.Fatalf("Unexpected status code %d", w.Code)
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+				if status.Status != purgeStatusPending {
+					break
+				}
+				time.Sleep(time.Millisecond * 10)
+			}
+			if status.Status != test.expectedStatus {
+				t.Errorf("Expected status %v, got %v", test.expectedStatus, status.Status)
+			}
+		})
+	}
+}
+
+func TestRouter_getPurge(t *testing.T) {
+	cookieSigner := securecookie.New([]byte("abc"), nil)
+	expired, _ := cookieSigner.Encode(purgeReceiptKey, purgeReceipt{
+		PurgeID: "purge-a", Issued: time.Now().Add(-purgeReceiptTTL * 2),
+	})
+	unknown, _ := cookieSigner.Encode(purgeReceiptKey, purgeReceipt{
+		PurgeID: "purge-z", Issued: time.Now(),
+	})
+	stale, _ := cookieSigner.Encode(purgeReceiptKey, purgeReceipt{
+		PurgeID: "purge-b", Issued: time.Now(),
+	})
+	tests := []struct {
+		name           string
+		receipt        string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"forged receipt", "purge-a", http.StatusBadRequest, ""},
+		{"expired receipt", expired, http.StatusGone, ""},
+		{"unknown purge", unknown, http.StatusNotFound, ""},
+		{"stale purge", stale, http.StatusOK, `{"status":"failed"}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := &mockPurgeEventsService{jobs: map[string]persistence.PurgeJobResult{
+				"purge-b": {PurgeID: "purge-b", Status: "pending", Updated: time.Now().Add(-purgeTimeout * 2)},
+			}}
+			rt := router{signers: newSigners([]byte("abc"), 0), purges: &purgeQueue{db: db}}
+			m := gin.New()
+			m.GET("/:receipt", rt.getPurge)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/%s", test.receipt), nil)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
+			}
+			if test.expectedBody != "" && strings.TrimSpace(w.Body.String()) != test.expectedBody {
+				t.Errorf("Unexpected body %s", w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// NewHTTPSRedirect returns a handler that redirects all GET and HEAD requests
+// to the same location on the given HTTPS port. Requests using other methods
+// are rejected instead of being redirected, so clients sending data over an
+// insecure connection fail instead of silently succeeding.
+func NewHTTPSRedirect(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Use HTTPS", http.StatusBadRequest)
+			return
+		}
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, fmt.Sprintf("%d", httpsPort))
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,59 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		name             string
+		port             int
+		method           string
+		url              string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{
+			"default port",
+			443,
+			http.MethodGet,
+			"http://offen.example.net/auditorium/?x=y",
+			http.StatusMovedPermanently,
+			"https://offen.example.net/auditorium/?x=y",
+		},
+		{
+			"custom port",
+			8443,
+			http.MethodHead,
+			"http://offen.example.net:8080/script.js",
+			http.StatusMovedPermanently,
+			"https://offen.example.net:8443/script.js",
+		},
+		{
+			"post",
+			443,
+			http.MethodPost,
+			"http://offen.example.net/api/events",
+			http.StatusBadRequest,
+			"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(test.method, test.url, nil)
+			NewHTTPSRedirect(test.port).ServeHTTP(w, r)
+			if w.Code != test.expectedStatus {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if location := w.Header().Get("Location"); location != test.expectedLocation {
+				t.Errorf("Expected location %q, got %q", test.expectedLocation, location)
+			}
+		})
+	}
+}
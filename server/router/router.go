@@ -4,6 +4,7 @@
 package router
 
 import (
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
@@ -13,33 +14,114 @@ import (
 	"github.com/felixge/httpsnoop"
 	"github.com/gin-contrib/location"
 	"github.com/gin-gonic/gin"
-	"github.com/gorilla/securecookie"
+	"github.com/gofrs/uuid"
 	"github.com/microcosm-cc/bluemonday"
+	"github.com/offen/offen/server/bus"
 	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/deadletter"
+	"github.com/offen/offen/server/features"
+	"github.com/offen/offen/server/locales"
 	"github.com/offen/offen/server/mailer"
 	"github.com/offen/offen/server/persistence"
 	ratelimiter "github.com/offen/offen/server/ratelimiter"
+	"github.com/offen/offen/server/scheduler"
+	"github.com/offen/offen/server/webhook"
 	"github.com/patrickmn/go-cache"
+	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 )
 
 type router struct {
-	db           persistence.Service
-	mailer       mailer.Mailer
-	fs           http.FileSystem
-	logger       *logrus.Logger
-	cookieSigner *securecookie.SecureCookie
-	template     *template.Template
-	emails       *template.Template
-	config       *config.Config
-	sanitizer    *bluemonday.Policy
-	limiter      ratelimiter.Throttler
+	db          persistence.Service
+	mailer      mailer.Mailer
+	fs          http.FileSystem
+	logger      *logrus.Logger
+	signers     *signers
+	template    *template.Template
+	emails      *template.Template
+	config      *config.Config
+	sanitizer   *bluemonday.Policy
+	limiter     ratelimiter.Throttler
+	lockouts    *loginLockouts
+	purges      *purgeQueue
+	duplicates  *cache.Cache
+	deadLetters *deadletter.File
+	scheduler   *scheduler.Scheduler
+	redis       redis.Cmdable
+	bus         bus.Bus
+	features    *features.Set
+	integrity   map[string]string
+	locales     locales.Loader
+	webhooks    *webhook.Dispatcher
+	// readOnly is set to 1 while the instance is in maintenance mode. It
+	// needs to be accessed atomically.
+	readOnly int32
+	ingest   chan struct{}
+	// shed counts the requests that have been rejected as the maximum number
+	// of concurrent inserts has been reached. It needs to be accessed
+	// atomically.
+	shed uint64
+	// bots counts the events that have been dropped as they have been sent
+	// by a bot. It needs to be accessed atomically.
+	bots uint64
+	// panics counts the handler panics that have been recovered from. It
+	// needs to be accessed atomically.
+	panics uint64
+}
+
+// loginLockouts keeps track of failed login attempts, both per account user
+// and per source address
+type loginLockouts struct {
+	accountUser ratelimiter.Locker
+	source      ratelimiter.Locker
+}
+
+const (
+	loginFailuresPerAccountUser = 10
+	loginFailuresPerSource      = 50
+	loginLockoutDuration        = time.Minute * 15
+)
+
+// newLoginLockouts creates the lockouts for failed logins. In case a Redis
+// client is given, lockouts are shared using Redis.
+func newLoginLockouts(client redis.Cmdable, salt []byte) (*loginLockouts, error) {
+	if client != nil {
+		// lockouts need to be shared so clients cannot circumvent them by
+		// having their requests handled by other instances
+		return &loginLockouts{
+			accountUser: ratelimiter.NewRedisLockout(
+				client, "offen:lockout:accountuser:",
+				loginFailuresPerAccountUser, loginLockoutDuration, salt,
+			),
+			source: ratelimiter.NewRedisLockout(
+				client, "offen:lockout:source:",
+				loginFailuresPerSource, loginLockoutDuration, salt,
+			),
+		}, nil
+	}
+	accountUser, err := ratelimiter.NewLockout(
+		loginFailuresPerAccountUser, loginLockoutDuration, cache.New(loginLockoutDuration, time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("router: error creating account user lockout: %w", err)
+	}
+	source, err := ratelimiter.NewLockout(
+		loginFailuresPerSource, loginLockoutDuration, cache.New(loginLockoutDuration, time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("router: error creating source lockout: %w", err)
+	}
+	return &loginLockouts{accountUser: accountUser, source: source}, nil
 }
 
 func (rt *router) getLimiter() ratelimiter.Throttler {
 	if rt.limiter == nil {
 		if rt.config != nil && rt.config.Server.ReverseProxy {
 			rt.limiter = ratelimiter.NewNoopRateLimiter()
+		} else if rt.redis != nil {
+			rt.limiter = ratelimiter.NewRedisThrottler(
+				rt.redis, "offen:limiter:", time.Second*30, rt.config.CacheSalt(),
+			)
 		} else {
 			rt.limiter = ratelimiter.New(time.Second*30, cache.New(time.Minute, time.Minute*2))
 		}
@@ -47,44 +129,193 @@ func (rt *router) getLimiter() ratelimiter.Throttler {
 	return rt.limiter
 }
 
-func (rt *router) logError(err error, message string) {
+func (rt *router) logError(c *gin.Context, err error, message string) {
 	if rt.logger != nil {
-		rt.logger.WithError(err).Error(message)
+		rt.logger.WithError(err).WithField("requestId", c.GetString(contextKeyRequestID)).Error(message)
 	}
 }
 
+// database returns the persistence layer used for handling the given
+// request. Errors it returns carry the id of the request.
+func (rt *router) database(c *gin.Context) persistence.Service {
+	return persistence.WithRequestID(rt.db, c.GetString(contextKeyRequestID))
+}
+
 const (
 	cookieKey               = "user"
 	optinKey                = "consent"
 	optinValue              = "allow"
+	userHeaderKey           = "X-Offen-User"
+	optinHeaderKey          = "X-Offen-Consent"
+	embedderHeaderKey       = "X-Offen-Origin"
+	requestIDHeaderKey      = "X-Request-Id"
 	authKey                 = "auth"
 	contextKeyCookie        = "contextKeyCookie"
 	contextKeyAuth          = "contextKeyAuth"
+	contextKeySession       = "contextKeySession"
 	contextKeySecureContext = "contextKeySecure"
+	contextKeyAnonymous     = "contextKeyAnonymous"
+	contextKeySourceOrigin  = "contextKeySourceOrigin"
+	contextKeyRequestID     = "contextKeyRequestID"
+	contextKeyAuditAccount  = "contextKeyAuditAccount"
+	contextKeyMetricsToken  = "contextKeyMetricsToken"
 )
 
-func (rt *router) userCookie(userID string, secure bool) *http.Cookie {
-	sameSite := http.SameSiteNoneMode
-	if !secure {
-		sameSite = http.SameSiteLaxMode
+// userCookie creates the cookie identifying a user. The user id is signed so
+// that forged or corrupted values can be rejected. Passing an empty user id
+// will clear the cookie.
+func (rt *router) userCookie(userID string, secure bool) (*http.Cookie, error) {
+	cfg := rt.config.UserCookie
+	path := cfg.Path
+	if path == "" {
+		path = "/api"
 	}
-
 	c := &http.Cookie{
 		Name:     cookieKey,
-		Value:    userID,
 		Expires:  time.Unix(0, 0),
 		HttpOnly: true,
-		Secure:   secure,
-		SameSite: sameSite,
-		Path:     "/api",
+		Secure:   cfg.Secure.Value(secure),
+		SameSite: cfg.SameSite.Mode(secure),
+		Domain:   cfg.Domain,
+		Path:     path,
 	}
 	if userID != "" {
-		c.Expires = time.Now().Add(config.EventRetention)
+		value, err := rt.signers.user.Encode(cookieKey, userID)
+		if err != nil {
+			return nil, err
+		}
+		c.Value = value
+		c.Expires = time.Now().Add(rt.userCookieMaxAge())
 	}
-	return c
+	return c, nil
 }
 
-func (rt *router) authCookie(userID string, secure bool) (*http.Cookie, error) {
+func (rt *router) userCookieMaxAge() time.Duration {
+	if maxAge := rt.config.UserCookie.MaxAge; maxAge > 0 {
+		return maxAge
+	}
+	return rt.config.Retention()
+}
+
+// cookieless reports whether the server is configured to never set cookies
+// identifying users. In this mode, the client is expected to store the signed
+// user id itself and send it using a request header.
+func (rt *router) cookieless() bool {
+	return rt.config != nil && rt.config.UserCookie.Disabled
+}
+
+// maxEventPayloadSize returns the maximum length of event payloads that are
+// accepted. A value of 0 disables the check.
+func (rt *router) maxEventPayloadSize() int {
+	if rt.config == nil {
+		return 0
+	}
+	return rt.config.MaxEventPayloadSize()
+}
+
+// ingestRateLimit returns the minimum interval between two requests for
+// inserting events sent by the same client.
+func (rt *router) ingestRateLimit() time.Duration {
+	if rt.config == nil {
+		return time.Second / 2
+	}
+	return rt.config.IngestRateLimit()
+}
+
+// getDuplicates returns the cache used for suppressing duplicate events. In
+// case suppression is disabled, nil is returned.
+func (rt *router) getDuplicates() *cache.Cache {
+	if rt.config == nil || rt.config.App.DuplicateEventWindow <= 0 {
+		return nil
+	}
+	if rt.duplicates == nil {
+		window := rt.config.App.DuplicateEventWindow
+		rt.duplicates = cache.New(window, window)
+	}
+	return rt.duplicates
+}
+
+var errNoUserID = errors.New("received no or blank identifier")
+
+// readUserID reads and verifies the signed user id sent with the given
+// request, either as a cookie or as a header in case of cookieless mode.
+func (rt *router) readUserID(c *gin.Context) (string, error) {
+	var value string
+	if rt.cookieless() {
+		value = c.GetHeader(userHeaderKey)
+	} else if ck, err := c.Request.Cookie(cookieKey); err == nil {
+		value = ck.Value
+	}
+	if value == "" {
+		return "", errNoUserID
+	}
+	var userID string
+	if err := rt.signers.user.Decode(cookieKey, value, &userID); err != nil {
+		if legacyID, ok := rt.unsignedUserID(value); ok {
+			// the cookie was issued before user ids have been signed, so it
+			// is upgraded to a signed one in place
+			if err := rt.writeUserID(c, legacyID); err != nil {
+				return "", fmt.Errorf("error upgrading unsigned identifier: %w", err)
+			}
+			return legacyID, nil
+		}
+		return "", fmt.Errorf("received invalid identifier: %w", err)
+	}
+	return userID, nil
+}
+
+// unsignedUserID checks whether the given value is a plain user id as set in
+// user cookies by versions that did not sign user ids yet. These are only
+// accepted when configured to do so.
+func (rt *router) unsignedUserID(value string) (string, bool) {
+	if rt.cookieless() || rt.config == nil || !rt.config.UserCookie.AcceptUnsigned {
+		return "", false
+	}
+	id, err := uuid.FromString(value)
+	if err != nil || id.Version() != uuid.V4 {
+		return "", false
+	}
+	return id.String(), true
+}
+
+// writeUserID sends the signed user id to the client, either as a cookie or
+// as a response header in case of cookieless mode. Passing an empty user id
+// will clear the identifier.
+func (rt *router) writeUserID(c *gin.Context, userID string) error {
+	if !rt.cookieless() {
+		ck, err := rt.userCookie(userID, c.GetBool(contextKeySecureContext))
+		if err != nil {
+			return err
+		}
+		http.SetCookie(c.Writer, ck)
+		return nil
+	}
+	var value string
+	if userID != "" {
+		var err error
+		if value, err = rt.signers.user.Encode(cookieKey, userID); err != nil {
+			return err
+		}
+	}
+	c.Header(userHeaderKey, value)
+	return nil
+}
+
+// sessionTTL is the maximum lifetime of a login
+const sessionTTL = time.Hour * 24
+
+// authToken is the value stored in the auth cookie of a logged in account user.
+type authToken struct {
+	AccountUserID string
+	// SessionID references the persisted session, which allows for revoking
+	// the token before it expires
+	SessionID string
+	// TOTPVerified is set when the account user has passed two factor
+	// authentication when logging in
+	TOTPVerified bool
+}
+
+func (rt *router) authCookie(token *authToken, secure bool) (*http.Cookie, error) {
 	c := http.Cookie{
 		Name:     authKey,
 		HttpOnly: true,
@@ -92,10 +323,10 @@ func (rt *router) authCookie(userID string, secure bool) (*http.Cookie, error) {
 		Secure:   secure,
 		Path:     "/api",
 	}
-	if userID == "" {
+	if token == nil {
 		c.Expires = time.Unix(0, 0)
 	} else {
-		value, err := rt.cookieSigner.MaxAge(24*60*60).Encode(authKey, userID)
+		value, err := rt.signers.session.Encode(authKey, token)
 		if err != nil {
 			return nil, err
 		}
@@ -105,6 +336,24 @@ func (rt *router) authCookie(userID string, secure bool) (*http.Cookie, error) {
 
 }
 
+// newSession persists a new session for the given account user and returns
+// the auth cookie referencing it.
+func (rt *router) newSession(c *gin.Context, accountUserID string, totpVerified bool) (*http.Cookie, error) {
+	sessionID, err := rt.database(c).CreateSession(accountUserID, c.Request.UserAgent(), sessionTTL)
+	if err != nil {
+		return nil, fmt.Errorf("router: error creating session: %w", err)
+	}
+	authCookie, err := rt.authCookie(&authToken{
+		AccountUserID: accountUserID,
+		SessionID:     sessionID,
+		TOTPVerified:  totpVerified,
+	}, c.GetBool(contextKeySecureContext))
+	if err != nil {
+		return nil, fmt.Errorf("router: error creating auth cookie: %w", err)
+	}
+	return authCookie, nil
+}
+
 // Config adds a configuration value to the router
 type Config func(*router)
 
@@ -159,34 +408,145 @@ func WithMailer(m mailer.Mailer) Config {
 	}
 }
 
+// WithScheduler attaches the scheduler running background jobs so metrics
+// about these can be exposed
+func WithScheduler(s *scheduler.Scheduler) Config {
+	return func(r *router) {
+		r.scheduler = s
+	}
+}
+
+// WithDeadLetters attaches a store for events that could not be persisted
+// because of a database error.
+func WithDeadLetters(d *deadletter.File) Config {
+	return func(r *router) {
+		r.deadLetters = d
+	}
+}
+
+// WithRedis makes the router share rate limits and login lockouts with
+// other instances using the given Redis client. It requires a config to be
+// passed using WithConfig as well.
+func WithRedis(c redis.Cmdable) Config {
+	return func(r *router) {
+		r.redis = c
+	}
+}
+
+// WithBus makes the router share runtime settings like maintenance mode
+// with other instances using the given bus.
+func WithBus(b bus.Bus) Config {
+	return func(r *router) {
+		r.bus = b
+	}
+}
+
+// WithFeatures sets the feature flags enabled for the instance.
+func WithFeatures(f *features.Set) Config {
+	return func(r *router) {
+		r.features = f
+	}
+}
+
+// WithIntegrity sets the Subresource Integrity hashes of the served scripts.
+func WithIntegrity(i map[string]string) Config {
+	return func(r *router) {
+		r.integrity = i
+	}
+}
+
+// WithLocales sets the loader for the message catalogs served to clients.
+// In case it is not given, the catalogs bundled with the application are
+// used.
+func WithLocales(l locales.Loader) Config {
+	return func(r *router) {
+		r.locales = l
+	}
+}
+
+// WithWebhooks attaches the dispatcher used for sending webhooks, so
+// SuperAdmins can inspect recent deliveries.
+func WithWebhooks(d *webhook.Dispatcher) Config {
+	return func(r *router) {
+		r.webhooks = d
+	}
+}
+
 // New creates a new application router that reads and writes data
 // to the given database implementation. In the context of the application
 // this expects to be the only top level router in charge of handling all
 // incoming HTTP requests.
-func New(opts ...Config) http.Handler {
+func New(opts ...Config) (http.Handler, error) {
 	rt := router{}
 	for _, opt := range opts {
 		opt(&rt)
 	}
 
 	rt.sanitizer = bluemonday.StrictPolicy()
-	rt.cookieSigner = securecookie.New(rt.config.Secret.Bytes(), nil)
+	if rt.locales == nil {
+		rt.locales = locales.DefaultLoader()
+	}
+	if rt.config.App.ReadOnly {
+		rt.readOnly = 1
+	} else if rt.db != nil {
+		readOnly, err := rt.db.ReadOnly()
+		if err != nil {
+			return nil, fmt.Errorf("router: error reading maintenance state: %w", err)
+		}
+		rt.setReadOnly(readOnly)
+	}
+	if rt.bus != nil {
+		rt.bus.Subscribe(topicMaintenance, rt.receiveMaintenance)
+	}
+	// caches and limiters are created upfront as handlers run concurrently
+	rt.getDuplicates()
+	rt.getLimiter()
+	rt.purges = &purgeQueue{db: rt.db}
+	if rt.lockouts == nil {
+		lockouts, err := newLoginLockouts(rt.redis, rt.config.CacheSalt())
+		if err != nil {
+			return nil, fmt.Errorf("router: error creating login lockouts: %w", err)
+		}
+		rt.lockouts = lockouts
+	}
+	if rt.config.App.IngestConcurrency > 0 {
+		rt.ingest = make(chan struct{}, rt.config.App.IngestConcurrency)
+	}
+	rt.signers = newSigners(rt.config.Secret.Bytes(), rt.userCookieMaxAge())
 
-	optin := optinMiddleware(optinKey, optinValue)
-	userCookie := userCookieMiddleware(cookieKey, contextKeyCookie)
+	var optin gin.HandlerFunc
+	if rt.cookieless() {
+		optin = optinHeaderMiddleware(optinHeaderKey, optinValue)
+	} else {
+		optin = optinMiddleware(optinKey, optinValue)
+	}
+	userCookie := rt.userIDMiddleware(contextKeyCookie)
+	privacySignals := privacySignalMiddleware(rt.config.App.PrivacySignals, contextKeyAnonymous)
 	accountAuth := rt.accountUserMiddleware(authKey, contextKeyAuth)
+	accountAccess := accountAccessMiddleware("accountID", contextKeyAuth)
+	accountAdmin := accountAdminMiddleware("accountID", contextKeyAuth)
+	superAdmin := superAdminMiddleware(contextKeyAuth)
+	apiAuth := rt.apiTokenMiddleware(accountAuth, contextKeyAuth)
+	readEvents := scopeMiddleware(persistence.APITokenScopeReadEvents, contextKeyAuth)
+	readStats := scopeMiddleware(persistence.APITokenScopeReadStats, contextKeyAuth)
+	manageAccount := scopeMiddleware(persistence.APITokenScopeManageAccount, contextKeyAuth)
 	noStore := headerMiddleware(map[string]func() string{
 		"Cache-Control": func() string {
 			return "no-store"
 		},
 	})
 
-	csp := headerMiddleware(map[string]func() string{
-		"Content-Security-Policy": func() string {
-			return defaultCSP
-		},
-	})
 	etag := etagMiddleware()
+	ingestLimit := rt.ingestLimitMiddleware(rt.config.App.IngestQueueTimeout)
+	readOnly := rt.readOnlyMiddleware()
+	// account users need to be able to log in for leaving maintenance mode
+	readOnlyWrites := rt.readOnlyWritesMiddleware(
+		"/api/login", "/api/logout", "/api/webauthn/login", "/api/maintenance",
+	)
+	var botFilter gin.HandlerFunc = func(c *gin.Context) { c.Next() }
+	if rt.config.App.BotFilter {
+		botFilter = rt.botFilterMiddleware(append(defaultBotUserAgents, rt.config.App.BotUserAgents...))
+	}
 
 	if !rt.config.App.Development {
 		gin.SetMode(gin.ReleaseMode)
@@ -194,53 +554,121 @@ func New(opts ...Config) http.Handler {
 
 	app := gin.New()
 	app.Use(
-		gin.Recovery(),
+		requestIDMiddleware(requestIDHeaderKey, contextKeyRequestID),
+		rt.recoveryMiddleware(),
 		location.Default(),
 		secureContextMiddleware(contextKeySecureContext, rt.config.App.Development),
+		rt.securityHeadersMiddleware(),
+		rt.corsMiddleware("/api/"),
 	)
 
 	root := gin.New()
 	root.SetHTMLTemplate(rt.template)
-	root.GET("/*any", etag, csp, rt.getIndex)
+	root.GET("/*any", etag, rt.getIndex)
 	app.GET("/", gin.WrapH(root))
 
 	app.Any("/healthz", noStore, rt.getHealth)
 	app.GET("/versionz", noStore, rt.getVersion)
+	app.GET(
+		"/metricsz", noStore,
+		rt.metricsTokenMiddleware(rt.config.App.MetricsToken, contextKeyMetricsToken),
+		skipWhenSetMiddleware(contextKeyMetricsToken, accountAuth),
+		skipWhenSetMiddleware(contextKeyMetricsToken, superAdmin),
+		rt.getMetrics,
+	)
+	app.GET("/config/:accountID", rt.getClientConfig)
+	app.HEAD("/config/:accountID", rt.getClientConfig)
+	app.GET("/p.gif", noStore, readOnly, botFilter, privacySignals, ingestLimit, rt.getPixel)
 	{
 		api := app.Group("/api")
-		api.Use(noStore)
+		api.Use(noStore, readOnlyWrites)
 		api.GET("/exchange", rt.getPublicKey)
+		api.HEAD("/exchange", rt.getPublicKey)
 		api.POST("/exchange", rt.postUserSecret)
 
-		api.GET("/accounts/:accountID", accountAuth, rt.getAccount)
-		api.DELETE("/accounts/:accountID", accountAuth, rt.deleteAccount)
-		api.POST("/accounts", accountAuth, rt.postAccount)
+		accounts := api.Group("/accounts", apiAuth)
+		accounts.POST("", superAdmin, rt.auditMiddleware(persistence.AuditActionAccountCreate), rt.postAccount)
+		{
+			account := accounts.Group("/:accountID", accountAccess)
+			account.GET("", readEvents, rt.getAccount)
+			account.GET("/stats", readStats, rt.getAccountStats)
+			account.GET("/aggregate", readStats, rt.getAccountAggregates)
+			account.PUT("/retention", manageAccount, accountAdmin, rt.auditMiddleware(persistence.AuditActionAccountRetention), rt.putAccountRetention)
+			account.PUT("/quota", manageAccount, accountAdmin, rt.auditMiddleware(persistence.AuditActionAccountEventQuota), rt.putAccountEventQuota)
+			account.PUT("/domains", manageAccount, accountAdmin, rt.auditMiddleware(persistence.AuditActionAccountDomains), rt.putAccountDomains)
+			account.POST("/domains/:domain/verify", manageAccount, accountAdmin, rt.auditMiddleware(persistence.AuditActionAccountDomainVerify), rt.postVerifyAccountDomain)
+			account.PUT("/banner", manageAccount, accountAdmin, rt.auditMiddleware(persistence.AuditActionAccountBanner), rt.putAccountBanner)
+			account.PUT("/settings", manageAccount, accountAdmin, rt.auditMiddleware(persistence.AuditActionAccountSettings), rt.putAccountSettings)
+			account.POST("/keys", manageAccount, accountAdmin, rt.auditMiddleware(persistence.AuditActionAccountKeysRotate), rt.postRotateAccountKeys)
+			account.DELETE("", superAdmin, rt.auditMiddleware(persistence.AuditActionAccountRetire), rt.deleteAccount)
+		}
+
+		api.POST("/import", apiAuth, superAdmin, rt.auditMiddleware(persistence.AuditActionAccountImport), rt.postImportAccount)
+
+		api.GET("/maintenance", accountAuth, superAdmin, rt.getMaintenance)
+		api.PUT("/maintenance", accountAuth, superAdmin, rt.auditMiddleware(persistence.AuditActionMaintenance), rt.putMaintenance)
+		api.GET("/features", accountAuth, superAdmin, rt.getFeatures)
+		api.GET("/audit", accountAuth, superAdmin, noStore, rt.getAuditLog)
+		api.GET("/webhooks/deliveries", accountAuth, superAdmin, noStore, rt.getWebhookDeliveries)
+		api.GET("/integrity", rt.getIntegrity)
+		api.GET("/locales", rt.getLocales)
+		api.GET("/locales/:locale", rt.getCatalog)
+
+		share := api.Group("/share-account", apiAuth, rt.auditMiddleware(persistence.AuditActionAccountShare))
+		share.POST("/:accountID", manageAccount, accountAdmin, rt.postShareAccount)
+		share.POST("", superAdmin, rt.postShareAccount)
+
+		tokens := api.Group("/tokens", accountAuth)
+		tokens.GET("", rt.getAPITokens)
+		tokens.POST("", rt.auditMiddleware(persistence.AuditActionAPITokenCreate), rt.postAPIToken)
+		tokens.DELETE("/:tokenID", rt.auditMiddleware(persistence.AuditActionAPITokenDelete), rt.deleteAPIToken)
 
 		api.POST("/purge", userCookie, rt.purgeEvents)
+		api.GET("/purge/:receipt", rt.getPurge)
 
 		api.GET("/login", accountAuth, rt.getLogin)
 		api.POST("/login", rt.postLogin)
 		api.POST("/logout", rt.postLogout)
 
-		api.POST("/change-password", accountAuth, rt.postChangePassword)
-		api.POST("/change-email", accountAuth, rt.postChangeEmail)
+		api.POST("/change-password", accountAuth, rt.auditMiddleware(persistence.AuditActionUserPassword), rt.postChangePassword)
+		api.POST("/change-email", accountAuth, rt.auditMiddleware(persistence.AuditActionUserEmail), rt.postChangeEmail)
+		api.GET("/totp", accountAuth, rt.getTOTP)
+		api.POST("/enroll-totp", accountAuth, rt.auditMiddleware(persistence.AuditActionUserTOTPEnroll), rt.postEnrollTOTP)
+		api.POST("/disable-totp", accountAuth, rt.auditMiddleware(persistence.AuditActionUserTOTPDisable), rt.postDisableTOTP)
+		api.GET("/sessions", accountAuth, rt.getSessions)
+		api.DELETE("/sessions", accountAuth, rt.deleteSessions)
+		api.DELETE("/sessions/:sessionID", accountAuth, rt.deleteSession)
+		api.GET("/webauthn/register", accountAuth, rt.getWebAuthnRegister)
+		api.POST("/webauthn/register", accountAuth, rt.postWebAuthnRegister)
+		api.GET("/webauthn/login", rt.getWebAuthnLogin)
+		api.POST("/webauthn/login", rt.postWebAuthnLogin)
 		api.POST("/forgot-password", rt.postForgotPassword)
 		api.POST("/reset-password", rt.postResetPassword)
-		api.POST("/share-account/:accountID", accountAuth, rt.postShareAccount)
-		api.POST("/share-account", accountAuth, rt.postShareAccount)
 		api.POST("/join", rt.postJoin)
 		api.GET("/setup", rt.getSetup)
 		api.POST("/setup", rt.postSetup)
 
+		if rt.config.Sync.Token != "" {
+			api.GET("/sync", rt.tokenMiddleware(rt.config.Sync.Token), rt.getSync)
+		}
+
 		api.GET("/events", userCookie, rt.getEvents)
-		api.POST("/events", optin, userCookie, rt.postEvents)
+		api.GET("/export", userCookie, rt.getExport)
+		api.POST("/events", botFilter, privacySignals, optin, userCookie, ingestLimit, rt.postEvents)
+		api.POST("/events/batch", botFilter, privacySignals, optin, userCookie, ingestLimit, rt.postEventsBatch)
+
+		amp := api.Group("/amp", ampCORSMiddleware(contextKeySourceOrigin))
+		amp.OPTIONS("")
+		// the GET variant of the endpoint writes events too
+		amp.GET("", readOnly, botFilter, privacySignals, ingestLimit, rt.postAMP)
+		amp.POST("", botFilter, privacySignals, ingestLimit, rt.postAMP)
 	}
 
 	fileServer := http.FileServer(rt.fs)
 	app.Use(staticMiddleware(fileServer, root))
 
 	if rt.config.Server.ReverseProxy {
-		return app
+		return app, nil
 	}
 
 	withGzip := gziphandler.GzipHandler(app)
@@ -249,7 +677,7 @@ func New(opts ...Config) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		metrics := httpsnoop.CaptureMetrics(withGzip, w, r)
 		fmt.Printf(
-			"%s %s %s [%s] \"%s %s %s\" %d %s\n",
+			"%s %s %s [%s] \"%s %s %s\" %d %s %s\n",
 			"-",
 			"-",
 			"-",
@@ -259,8 +687,9 @@ func New(opts ...Config) http.Handler {
 			r.Proto,
 			anonymizeStatusCode(metrics.Code),
 			"-",
+			w.Header().Get(requestIDHeaderKey),
 		)
-	})
+	}), nil
 }
 
 // anonymizeStatusCode turns all non-error status codes into http.StatusOK
@@ -5,18 +5,28 @@ package router
 
 import (
 	"html/template"
+	"net/http"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/gin-gonic/gin"
 	"github.com/offen/offen/server/config"
 	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/ratelimiter"
+	"github.com/patrickmn/go-cache"
+	"github.com/redis/go-redis/v9"
 )
 
 type mockDatabase struct {
 	persistence.Service
 }
 
+func (m *mockDatabase) ReadOnly() (bool, error) {
+	return false, nil
+}
+
 func TestMain(m *testing.M) {
 	gin.SetMode(gin.ReleaseMode)
 	os.Exit(m.Run())
@@ -29,3 +39,86 @@ func TestNew(t *testing.T) {
 		WithTemplate(template.New("a test")),
 	)
 }
+
+func TestRouter_userCookie(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		rt := router{
+			config:  &config.Config{},
+			signers: newSigners([]byte("abc"), 0),
+		}
+		c, err := rt.userCookie("user-a", true)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if c.Path != "/api" || !c.Secure || c.SameSite != http.SameSiteNoneMode || c.Domain != "" {
+			t.Errorf("Unexpected cookie %v", c)
+		}
+		if c.Expires.Before(time.Now().Add(config.EventRetention - time.Minute)) {
+			t.Errorf("Unexpected expiry %v", c.Expires)
+		}
+	})
+	t.Run("configured", func(t *testing.T) {
+		cfg := &config.Config{}
+		cfg.UserCookie.SameSite = "strict"
+		cfg.UserCookie.Secure = "false"
+		cfg.UserCookie.Domain = "example.net"
+		cfg.UserCookie.Path = "/"
+		cfg.UserCookie.MaxAge = time.Hour
+		rt := router{
+			config:  cfg,
+			signers: newSigners([]byte("abc"), 0),
+		}
+		c, err := rt.userCookie("user-a", true)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if c.Path != "/" || c.Secure || c.SameSite != http.SameSiteStrictMode || c.Domain != "example.net" {
+			t.Errorf("Unexpected cookie %v", c)
+		}
+		if c.Expires.After(time.Now().Add(time.Hour)) {
+			t.Errorf("Unexpected expiry %v", c.Expires)
+		}
+	})
+}
+
+func TestNewLoginLockouts_Redis(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Unexpected error starting redis: %v", err)
+	}
+	defer s.Close()
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer client.Close()
+	cfg := &config.Config{Secret: config.Bytes("secret")}
+	a, err := newLoginLockouts(client, cfg.CacheSalt())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	b, err := newLoginLockouts(client, cfg.CacheSalt())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	for i := 0; i < loginFailuresPerAccountUser/2; i++ {
+		a.accountUser.Fail("user@offen.dev")
+		b.accountUser.Fail("user@offen.dev")
+	}
+	if _, locked := a.accountUser.Locked("user@offen.dev"); !locked {
+		t.Error("Expected lockout to be shared between routers")
+	}
+	if _, locked := b.source.Locked("user@offen.dev"); locked {
+		t.Error("Expected source lockouts to be kept separately")
+	}
+}
+
+func newTestLockouts(t *testing.T, accountUser, source int) *loginLockouts {
+	accountUserLockout, err := ratelimiter.NewLockout(accountUser, time.Hour, cache.New(time.Hour, time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	sourceLockout, err := ratelimiter.NewLockout(source, time.Hour, cache.New(time.Hour, time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return &loginLockouts{accountUser: accountUserLockout, source: sourceLockout}
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+)
+
+func (rt *router) getSessions(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: account user object not found on request context"),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	sessions, err := rt.database(c).ListSessions(accountUser.AccountUserID)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error looking up sessions: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	current := c.GetString(contextKeySession)
+	for index, session := range sessions {
+		sessions[index].Current = session.SessionID == current
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+func (rt *router) deleteSession(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: account user object not found on request context"),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	sessionID := c.Param("sessionID")
+	if err := rt.database(c).RevokeSession(accountUser.AccountUserID, sessionID); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error revoking session %s: %w", sessionID, err),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+	if sessionID == c.GetString(contextKeySession) {
+		authCookie, _ := rt.authCookie(nil, c.GetBool(contextKeySecureContext))
+		http.SetCookie(c.Writer, authCookie)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// deleteSessions revokes all sessions of the account user, including the
+// one that is used for making the request.
+func (rt *router) deleteSessions(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: account user object not found on request context"),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	if err := rt.database(c).RevokeSessions(accountUser.AccountUserID); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error revoking sessions: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	authCookie, _ := rt.authCookie(nil, c.GetBool(contextKeySecureContext))
+	http.SetCookie(c.Writer, authCookie)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockRevokeSessionDatabase struct {
+	persistence.Service
+	err error
+}
+
+func (m *mockRevokeSessionDatabase) RevokeSession(string, string) error {
+	return m.err
+}
+
+func TestRouter_deleteSession(t *testing.T) {
+	tests := []struct {
+		name               string
+		db                 mockRevokeSessionDatabase
+		sessionID          string
+		expectedStatusCode int
+		expectCookie       bool
+	}{
+		{
+			"database error",
+			mockRevokeSessionDatabase{
+				err: errors.New("did not work"),
+			},
+			"session-b",
+			http.StatusNotFound,
+			false,
+		},
+		{
+			"other session",
+			mockRevokeSessionDatabase{},
+			"session-b",
+			http.StatusNoContent,
+			false,
+		},
+		{
+			"current session",
+			mockRevokeSessionDatabase{},
+			"session-a",
+			http.StatusNoContent,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{
+				config:  &config.Config{},
+				db:      &test.db,
+				signers: newSigners([]byte("abc"), 0),
+			}
+			m := gin.New()
+			m.DELETE("/:sessionID", func(c *gin.Context) {
+				c.Set(contextKeyAuth, persistence.LoginResult{AccountUserID: "user-a"})
+				c.Set(contextKeySession, "session-a")
+			}, rt.deleteSession)
+			r := httptest.NewRequest(http.MethodDelete, "/"+test.sessionID, nil)
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if cookies := w.Result().Cookies(); (len(cookies) != 0) != test.expectCookie {
+				t.Errorf("Unexpected cookies %v", cookies)
+			}
+		})
+	}
+}
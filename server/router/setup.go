@@ -54,7 +54,7 @@ func (rt *router) postSetup(c *gin.Context) {
 		return
 	}
 
-	if err := rt.db.Bootstrap(persistence.BootstrapConfig{
+	if err := rt.database(c).Bootstrap(persistence.BootstrapConfig{
 		Accounts: []persistence.BootstrapAccount{
 			{
 				Name:      html.UnescapeString(rt.sanitizer.Sanitize(req.AccountName)),
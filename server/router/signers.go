@@ -0,0 +1,45 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+const (
+	resetTokenTTL  = time.Hour * 24
+	inviteTokenTTL = time.Hour * 24 * 7
+)
+
+// signers holds a separate signer for each kind of signed value the router
+// hands out. Signers enforce the maximum age of the values they verify, so
+// they are created once and their maximum age must never be changed
+// afterwards, as this would affect all other values signed by them and is not
+// safe for concurrent use.
+type signers struct {
+	user      *securecookie.SecureCookie
+	session   *securecookie.SecureCookie
+	reset     *securecookie.SecureCookie
+	invite    *securecookie.SecureCookie
+	challenge *securecookie.SecureCookie
+	receipt   *securecookie.SecureCookie
+}
+
+// newSigners creates the signers for the given secret. User ids are valid for
+// the given duration. A duration of 0 disables the check.
+func newSigners(secret []byte, userIDMaxAge time.Duration) *signers {
+	newSigner := func(maxAge time.Duration) *securecookie.SecureCookie {
+		return securecookie.New(secret, nil).MaxAge(int(maxAge.Seconds()))
+	}
+	return &signers{
+		user:      newSigner(userIDMaxAge),
+		session:   newSigner(sessionTTL),
+		reset:     newSigner(resetTokenTTL),
+		invite:    newSigner(inviteTokenTTL),
+		challenge: newSigner(webAuthnChallengeTTL),
+		receipt:   newSigner(purgeReceiptTTL),
+	}
+}
@@ -5,6 +5,7 @@ package router
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -17,18 +18,12 @@ import (
 )
 
 var (
-	defaultCSP             = "default-src 'self'; style-src 'self' 'unsafe-inline'; img-src 'self' data:"
-	defaultSTS             = "max-age=15768000"
-	revisionedJSRe         = regexp.MustCompile("-[0-9a-z]{10}\\.js$")
-	webfontRe              = regexp.MustCompile("\\.(woff|woff2|ttf)$")
-	scriptRe               = regexp.MustCompile("script\\.js$")
-	stylesheetRe           = regexp.MustCompile("\\.css$")
-	assetRe                = regexp.MustCompile("\\.svg$")
-	defaultResponseHeaders = map[string]string{
-		"Referrer-Policy":        "origin-when-cross-origin",
-		"X-Content-Type-Options": "no-sniff",
-		"X-XSS-Protection":       "1; mode=block",
-	}
+	farFutureExpiry = time.Hour * 24 * 365
+	revisionedJSRe  = regexp.MustCompile("-[0-9a-z]{10}\\.js$")
+	webfontRe       = regexp.MustCompile("\\.(woff|woff2|ttf)$")
+	scriptRe        = regexp.MustCompile("script\\.js$")
+	stylesheetRe    = regexp.MustCompile("\\.css$")
+	assetRe         = regexp.MustCompile("\\.svg$")
 )
 
 // muteRequest suppresses all error logging that is happening from inside the
@@ -48,7 +43,6 @@ func staticMiddleware(fileServer, fallback http.Handler) gin.HandlerFunc {
 	}
 
 	return func(c *gin.Context) {
-		secureContext := c.GetBool(contextKeySecureContext)
 		status, contentType := tryStatic(c.Request.Method, c.Request.URL.String())
 		// Right now, we manually trigger an error when trying to read a directory
 		// so we can skip the directory listings provided by the Go FileServer.
@@ -60,28 +54,22 @@ func staticMiddleware(fileServer, fallback http.Handler) gin.HandlerFunc {
 
 		if strings.HasPrefix(contentType, "text/html") {
 			c.Header("Cache-Control", "no-cache")
-			c.Header("Content-Security-Policy", defaultCSP)
-			if secureContext {
-				c.Header("Strict-Transport-Security", defaultSTS)
-			}
 		}
 
 		switch uri := c.Request.URL.Path; {
-		case revisionedJSRe.MatchString(uri), webfontRe.MatchString(uri):
-			expires := time.Now().Add(time.Hour * 24 * 365).Format(time.RFC1123)
-			c.Header("Expires", expires)
+		case revisionedJSRe.MatchString(uri):
+			// revisioned assets are named after a hash of their content
+			// so they never change and can be cached forever
+			c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", int(farFutureExpiry.Seconds())))
+			c.Header("Expires", time.Now().Add(farFutureExpiry).UTC().Format(http.TimeFormat))
+		case webfontRe.MatchString(uri):
+			c.Header("Expires", time.Now().Add(farFutureExpiry).UTC().Format(http.TimeFormat))
 		case stylesheetRe.MatchString(uri), assetRe.MatchString(uri):
 			c.Header("Cache-Control", "no-cache")
 		case scriptRe.MatchString(uri):
 			c.Header("Cache-Control", "no-cache")
-			if secureContext {
-				c.Header("Strict-Transport-Security", defaultSTS)
-			}
 		}
 
-		for key, value := range defaultResponseHeaders {
-			c.Header(key, value)
-		}
 		fileServer.ServeHTTP(c.Writer, muteRequest(c.Request))
 	}
 }
@@ -38,8 +38,8 @@ func TestStaticMiddleware(t *testing.T) {
 			t.Errorf("Unexpected Content-Type %v", w.Header().Get("Content-Type"))
 		}
 
-		if w.Header().Get("Content-Security-Policy") == "" {
-			t.Error("Unexpected empty CSP header")
+		if w.Header().Get("Cache-Control") != "no-cache" {
+			t.Errorf("Unexpected Cache-Control header %v", w.Header().Get("Cache-Control"))
 		}
 	}
 
@@ -67,6 +67,10 @@ func TestStaticMiddleware(t *testing.T) {
 		if w.Header().Get("Expires") != "" {
 			t.Errorf("Unexpected expires header on unrevisioned asset %v", w.Header().Get("Expires"))
 		}
+
+		if w.Header().Get("Cache-Control") != "no-cache" {
+			t.Errorf("Unexpected Cache-Control header on unrevisioned asset %v", w.Header().Get("Cache-Control"))
+		}
 	}
 
 	{
@@ -82,6 +86,14 @@ func TestStaticMiddleware(t *testing.T) {
 		if w.Header().Get("Expires") == "" {
 			t.Error("Unexpected empty Expires header on revisioned asset")
 		}
+
+		if _, err := http.ParseTime(w.Header().Get("Expires")); err != nil {
+			t.Errorf("Unexpected Expires header format %v", err)
+		}
+
+		if !strings.Contains(w.Header().Get("Cache-Control"), "immutable") {
+			t.Errorf("Unexpected Cache-Control header on revisioned asset %v", w.Header().Get("Cache-Control"))
+		}
 	}
 
 	{
@@ -0,0 +1,97 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+)
+
+// streamEvents writes a JSON response consisting of the events yielded by the
+// given stream and the fields of the value returned by tail, which is called
+// after all events have been written. In contrast to c.JSON, events are read
+// from the database, marshalled and written to the client one by one, so
+// responses for users or accounts with a large number of events do not need
+// to be held in memory at once. The value returned by tail is expected to
+// encode to a JSON object that does not contain any events itself.
+func (rt *router) streamEvents(c *gin.Context, stream *persistence.EventsStream, tail func() interface{}) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := writeEvents(c.Writer, stream, tail); err != nil {
+		// output is buffered, so in case nothing has been sent yet, the
+		// error can still be reported to the client. Otherwise, the status
+		// code cannot be changed anymore and errors can only be logged.
+		if !c.Writer.Written() {
+			newJSONError(
+				fmt.Errorf("router: error streaming events: %w", err),
+				http.StatusInternalServerError,
+			).Pipe(c)
+			return
+		}
+		rt.logError(c, err, "error streaming events")
+	}
+}
+
+func writeEvents(w io.Writer, stream *persistence.EventsStream, tail func() interface{}) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(`{"events":{`)
+
+	var currentAccountID string
+	var started bool
+	if err := stream.Each(func(accountID string, evt persistence.EventResult) error {
+		if !started || accountID != currentAccountID {
+			if started {
+				bw.WriteString("],")
+			}
+			key, err := json.Marshal(accountID)
+			if err != nil {
+				return fmt.Errorf("router: error encoding account id: %w", err)
+			}
+			bw.Write(key)
+			bw.WriteString(":[")
+			currentAccountID = accountID
+			started = true
+		} else {
+			bw.WriteString(",")
+		}
+		b, err := json.Marshal(evt)
+		if err != nil {
+			return fmt.Errorf("router: error encoding event %s: %w", evt.EventID, err)
+		}
+		if _, err := bw.Write(b); err != nil {
+			return fmt.Errorf("router: error writing event %s: %w", evt.EventID, err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if started {
+		bw.WriteString("]")
+	}
+	bw.WriteString("}")
+
+	rest, err := json.Marshal(tail())
+	if err != nil {
+		return fmt.Errorf("router: error encoding response: %w", err)
+	}
+	if !bytes.HasPrefix(rest, []byte("{")) {
+		return fmt.Errorf("router: cannot stream events into non-object value %s", rest)
+	}
+	rest = rest[1:]
+	if !bytes.Equal(rest, []byte("}")) {
+		bw.WriteString(",")
+	}
+	bw.Write(rest)
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("router: error flushing events: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestWriteEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		result persistence.EventsResult
+	}{
+		{
+			"no events",
+			persistence.EventsResult{
+				Events:   &persistence.EventsByAccountID{},
+				Sequence: "seq-a",
+			},
+		},
+		{
+			"empty result",
+			persistence.EventsResult{
+				Events: &persistence.EventsByAccountID{},
+			},
+		},
+		{
+			"multiple accounts",
+			persistence.EventsResult{
+				Events: &persistence.EventsByAccountID{
+					"account-b": []persistence.EventResult{
+						{AccountID: "account-b", EventID: "event-c", Payload: "payload-c"},
+					},
+					"account-a": []persistence.EventResult{
+						{AccountID: "account-a", SecretID: strptr("hashed-user-a"), EventID: "event-a", Payload: "payload-a"},
+						{AccountID: "account-a", EventID: "event-b", Payload: "<payload-b>"},
+					},
+				},
+				DeletedEvents: []string{"event-z"},
+				Sequence:      "seq-a",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expected, _ := json.Marshal(test.result)
+
+			stream := persistence.NewEventsStream(*test.result.Events)
+			test.result.Events = nil
+
+			var buf bytes.Buffer
+			if err := writeEvents(&buf, stream, func() interface{} {
+				return test.result
+			}); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+
+			var expectedValue, actualValue interface{}
+			if err := json.Unmarshal(buf.Bytes(), &actualValue); err != nil {
+				t.Fatalf("Unexpected error decoding %s: %v", buf.String(), err)
+			}
+			json.Unmarshal(expected, &expectedValue)
+			a, _ := json.Marshal(actualValue)
+			e, _ := json.Marshal(expectedValue)
+			if !bytes.Equal(a, e) {
+				t.Errorf("Expected %s, got %s", e, a)
+			}
+		})
+	}
+}
+
+func TestWriteEvents_NonObject(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeEvents(&buf, persistence.NewEventsStream(nil), func() interface{} {
+		return []string{}
+	}); err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
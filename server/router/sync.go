@@ -0,0 +1,33 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+)
+
+func (rt *router) getSync(c *gin.Context) {
+	if since := c.Query("since"); since != "" {
+		if err := persistence.ValidateEventID(since); err != nil {
+			newJSONError(
+				fmt.Errorf("router: invalid value for since parameter: %w", err),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+	}
+	changes, err := rt.database(c).ChangesSince(c.Query("since"))
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error looking up changes: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, changes)
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockGetSyncDatabase struct {
+	persistence.Service
+	since  string
+	result persistence.ChangeSet
+	err    error
+}
+
+func (m *mockGetSyncDatabase) ChangesSince(since string) (persistence.ChangeSet, error) {
+	m.since = since
+	return m.result, m.err
+}
+
+func TestRouter_getSync(t *testing.T) {
+	tests := []struct {
+		name               string
+		since              string
+		db                 *mockGetSyncDatabase
+		expectedStatusCode int
+		expectedWatermark  string
+	}{
+		{
+			"bad watermark",
+			"watermark-a",
+			&mockGetSyncDatabase{},
+			http.StatusBadRequest,
+			"",
+		},
+		{
+			"database error",
+			"01F4Z2Q4B5C6D7E8F9G0H1J2K0",
+			&mockGetSyncDatabase{err: errors.New("did not work")},
+			http.StatusInternalServerError,
+			"",
+		},
+		{
+			"ok",
+			"01F4Z2Q4B5C6D7E8F9G0H1J2K0",
+			&mockGetSyncDatabase{result: persistence.ChangeSet{Watermark: "01F4Z2Q4B5C6D7E8F9G0H1J2K3"}},
+			http.StatusOK,
+			"01F4Z2Q4B5C6D7E8F9G0H1J2K3",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.db}
+			m := gin.New()
+			m.GET("/", rt.getSync)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/?since="+test.since, nil)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if w.Code == http.StatusBadRequest {
+				return
+			}
+			if test.db.since != test.since {
+				t.Errorf("Unexpected watermark passed %v", test.db.since)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var changes persistence.ChangeSet
+			json.NewDecoder(w.Body).Decode(&changes)
+			if changes.Watermark != test.expectedWatermark {
+				t.Errorf("Unexpected watermark %v", changes.Watermark)
+			}
+		})
+	}
+}
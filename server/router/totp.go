@@ -0,0 +1,145 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/keys"
+	"github.com/offen/offen/server/persistence"
+)
+
+const totpIssuer = "Offen"
+
+type totpSecretResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// getTOTP returns a newly generated TOTP secret. The secret will only be
+// persisted after the account user has verified it by calling postEnrollTOTP.
+func (rt *router) getTOTP(c *gin.Context) {
+	secret, err := keys.GenerateTOTPSecret()
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error generating totp secret: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, totpSecretResponse{
+		Secret: secret,
+		URI:    keys.TOTPURI(secret, totpIssuer, c.Query("emailAddress")),
+	})
+}
+
+type enrollTOTPRequest struct {
+	Password string `json:"password"`
+	Secret   string `json:"secret"`
+	Code     string `json:"code"`
+}
+
+type enrollTOTPResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+func (rt *router) postEnrollTOTP(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: account user object not found on request context"),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	if l := <-rt.getLimiter().LinearThrottle(time.Second*5, fmt.Sprintf("postEnrollTOTP-%s", accountUser.AccountUserID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error applying rate limit: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	var req enrollTOTPRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	recoveryCodes, err := rt.database(c).EnrollTOTP(accountUser.AccountUserID, req.Password, req.Secret, req.Code)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error enrolling totp secret: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	// the current session has just been verified using a valid code, so it
+	// can be upgraded instead of requiring the account user to log in again
+	authCookie, authCookieErr := rt.authCookie(&authToken{
+		AccountUserID: accountUser.AccountUserID,
+		SessionID:     c.GetString(contextKeySession),
+		TOTPVerified:  true,
+	}, c.GetBool(contextKeySecureContext))
+	if authCookieErr != nil {
+		newJSONError(
+			fmt.Errorf("router: error creating auth cookie: %w", authCookieErr),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	http.SetCookie(c.Writer, authCookie)
+	c.JSON(http.StatusOK, enrollTOTPResponse{RecoveryCodes: recoveryCodes})
+}
+
+type disableTOTPRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+func (rt *router) postDisableTOTP(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: account user object not found on request context"),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	if l := <-rt.getLimiter().LinearThrottle(time.Second*5, fmt.Sprintf("postDisableTOTP-%s", accountUser.AccountUserID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error applying rate limit: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	var req disableTOTPRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	if err := rt.database(c).DisableTOTP(accountUser.AccountUserID, req.Password, req.Code); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error disabling totp: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/securecookie"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockEnrollTOTPDatabase struct {
+	persistence.Service
+	result []string
+	err    error
+}
+
+func (m *mockEnrollTOTPDatabase) EnrollTOTP(string, string, string, string) ([]string, error) {
+	return m.result, m.err
+}
+
+func TestRouter_postEnrollTOTP(t *testing.T) {
+	tests := []struct {
+		name               string
+		db                 mockEnrollTOTPDatabase
+		userContext        interface{}
+		body               io.Reader
+		expectedStatusCode int
+		expectCookie       bool
+	}{
+		{
+			"bad user context",
+			mockEnrollTOTPDatabase{},
+			nil,
+			strings.NewReader(`{"password":"secret","secret":"ABC","code":"123456"}`),
+			http.StatusInternalServerError,
+			false,
+		},
+		{
+			"bad payload",
+			mockEnrollTOTPDatabase{},
+			persistence.LoginResult{AccountUserID: "user-a"},
+			strings.NewReader(`{{88`),
+			http.StatusBadRequest,
+			false,
+		},
+		{
+			"database error",
+			mockEnrollTOTPDatabase{
+				err: errors.New("did not work"),
+			},
+			persistence.LoginResult{AccountUserID: "user-a"},
+			strings.NewReader(`{"password":"secret","secret":"ABC","code":"123456"}`),
+			http.StatusBadRequest,
+			false,
+		},
+		{
+			"ok",
+			mockEnrollTOTPDatabase{
+				result: []string{"code-a", "code-b"},
+			},
+			persistence.LoginResult{AccountUserID: "user-a"},
+			strings.NewReader(`{"password":"secret","secret":"ABC","code":"123456"}`),
+			http.StatusOK,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cookieSigner := securecookie.New([]byte("abc"), nil)
+			rt := router{
+				config:  &config.Config{},
+				db:      &test.db,
+				signers: newSigners([]byte("abc"), 0),
+			}
+			m := gin.New()
+			m.POST("/", func(c *gin.Context) {
+				c.Set(contextKeyAuth, test.userContext)
+			}, rt.postEnrollTOTP)
+			r := httptest.NewRequest(http.MethodPost, "/", test.body)
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+
+			cookies := w.Result().Cookies()
+			if test.expectCookie {
+				if len(cookies) != 1 {
+					t.Fatalf("Expected 1 cookie in response, received %v", len(cookies))
+				}
+				var token authToken
+				if err := cookieSigner.Decode(authKey, cookies[0].Value, &token); err != nil {
+					t.Fatalf("Unexpected error decoding cookie %v", err)
+				}
+				if !token.TOTPVerified {
+					t.Errorf("Expected upgraded token, got %v", token)
+				}
+			} else if len(cookies) != 0 {
+				t.Errorf("Expected no cookie in response, received %v", len(cookies))
+			}
+		})
+	}
+}
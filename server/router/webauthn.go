@@ -0,0 +1,298 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/location"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/offen/offen/server/persistence"
+)
+
+const (
+	webAuthnKey          = "webauthn"
+	webAuthnRPName       = "Offen"
+	webAuthnChallengeTTL = time.Minute * 5
+	// webAuthnTimeout is the time in milliseconds the browser is asked to
+	// wait for the user to complete a ceremony.
+	webAuthnTimeout = 120000
+)
+
+type webAuthnChallenge struct {
+	Session webauthn.SessionData
+	Expires time.Time
+}
+
+// webAuthnCookie stores the session data of a pending registration or login
+// ceremony. Passing nil will clear the cookie.
+func (rt *router) webAuthnCookie(session *webauthn.SessionData, secure bool) (*http.Cookie, error) {
+	c := http.Cookie{
+		Name:     webAuthnKey,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		Secure:   secure,
+		Path:     "/api/webauthn",
+	}
+	if session == nil {
+		c.Expires = time.Unix(0, 0)
+	} else {
+		value, err := rt.signers.challenge.Encode(webAuthnKey, webAuthnChallenge{
+			Session: *session,
+			Expires: time.Now().Add(webAuthnChallengeTTL),
+		})
+		if err != nil {
+			return nil, err
+		}
+		c.Value = value
+		c.MaxAge = int(webAuthnChallengeTTL.Seconds())
+	}
+	return &c, nil
+}
+
+// relyingParty returns the relying party for the host the request has been
+// made to. Attestation statements are requested and verified when
+// registering credentials. User verification is required, as logging in
+// using a passkey skips two factor authentication.
+func relyingParty(c *gin.Context) (*webauthn.WebAuthn, error) {
+	u := location.Get(c)
+	requireResidentKey := true
+	rp, err := webauthn.New(&webauthn.Config{
+		RPDisplayName:         webAuthnRPName,
+		RPID:                  u.Hostname(),
+		RPOrigin:              fmt.Sprintf("%s://%s", u.Scheme, u.Host),
+		AttestationPreference: protocol.PreferDirectAttestation,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			RequireResidentKey: &requireResidentKey,
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			UserVerification:   protocol.VerificationRequired,
+		},
+		Timeout: webAuthnTimeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("router: error creating webauthn relying party: %w", err)
+	}
+	return rp, nil
+}
+
+// webAuthnCeremony returns the ceremony for verifying a response using the
+// session data that has been stored in the request's cookie. The cookie is
+// cleared as each challenge can only be used once.
+func (rt *router) webAuthnCeremony(c *gin.Context) (persistence.WebAuthnCeremony, error) {
+	ck, err := c.Request.Cookie(webAuthnKey)
+	if err != nil {
+		return persistence.WebAuthnCeremony{}, errors.New("router: no pending webauthn challenge found")
+	}
+	var challenge webAuthnChallenge
+	if err := rt.signers.challenge.Decode(webAuthnKey, ck.Value, &challenge); err != nil {
+		return persistence.WebAuthnCeremony{}, fmt.Errorf("router: error decoding webauthn challenge: %w", err)
+	}
+	if time.Now().After(challenge.Expires) {
+		return persistence.WebAuthnCeremony{}, errors.New("router: webauthn challenge has expired")
+	}
+	if clear, err := rt.webAuthnCookie(nil, c.GetBool(contextKeySecureContext)); err == nil {
+		http.SetCookie(c.Writer, clear)
+	}
+	rp, err := relyingParty(c)
+	if err != nil {
+		return persistence.WebAuthnCeremony{}, err
+	}
+	return persistence.WebAuthnCeremony{RelyingParty: rp, Session: challenge.Session}, nil
+}
+
+// storeWebAuthnSession stores the session data of a ceremony that has been
+// started in a cookie.
+func (rt *router) storeWebAuthnSession(c *gin.Context, session *webauthn.SessionData) error {
+	ck, err := rt.webAuthnCookie(session, c.GetBool(contextKeySecureContext))
+	if err != nil {
+		return fmt.Errorf("router: error creating webauthn cookie: %w", err)
+	}
+	http.SetCookie(c.Writer, ck)
+	return nil
+}
+
+// webAuthnRegistrant is the account user a new credential is created for.
+type webAuthnRegistrant struct {
+	accountUserID string
+	emailAddress  string
+}
+
+func (w *webAuthnRegistrant) WebAuthnID() []byte                         { return []byte(w.accountUserID) }
+func (w *webAuthnRegistrant) WebAuthnName() string                       { return w.emailAddress }
+func (w *webAuthnRegistrant) WebAuthnDisplayName() string                { return w.emailAddress }
+func (w *webAuthnRegistrant) WebAuthnIcon() string                       { return "" }
+func (w *webAuthnRegistrant) WebAuthnCredentials() []webauthn.Credential { return nil }
+
+func (rt *router) getWebAuthnRegister(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: account user object not found on request context"),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	existing, err := rt.database(c).ListWebAuthnCredentials(accountUser.AccountUserID)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error looking up existing credentials: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	rp, err := relyingParty(c)
+	if err != nil {
+		newJSONError(err, http.StatusInternalServerError).Pipe(c)
+		return
+	}
+	// the same authenticator is not registered twice
+	exclude := []protocol.CredentialDescriptor{}
+	for _, id := range existing {
+		exclude = append(exclude, protocol.CredentialDescriptor{
+			Type:         protocol.PublicKeyCredentialType,
+			CredentialID: id,
+		})
+	}
+	options, session, err := rp.BeginRegistration(
+		&webAuthnRegistrant{accountUserID: accountUser.AccountUserID, emailAddress: c.Query("emailAddress")},
+		webauthn.WithExclusions(exclude),
+	)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error creating registration options: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	if err := rt.storeWebAuthnSession(c, session); err != nil {
+		newJSONError(err, http.StatusInternalServerError).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, options.Response)
+}
+
+type webAuthnRegisterRequest struct {
+	Credential  json.RawMessage `json:"credential"`
+	WrappedKeys string          `json:"wrappedKeys"`
+}
+
+func (rt *router) postWebAuthnRegister(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: account user object not found on request context"),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	var req webAuthnRegisterRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	response, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(req.Credential))
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error parsing credential: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	ceremony, err := rt.webAuthnCeremony(c)
+	if err != nil {
+		newJSONError(err, http.StatusBadRequest).Pipe(c)
+		return
+	}
+
+	if err := rt.database(c).RegisterWebAuthnCredential(accountUser.AccountUserID, response, ceremony, req.WrappedKeys); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error registering credential: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (rt *router) getWebAuthnLogin(c *gin.Context) {
+	rp, err := relyingParty(c)
+	if err != nil {
+		newJSONError(err, http.StatusInternalServerError).Pipe(c)
+		return
+	}
+	options, session, err := rp.BeginDiscoverableLogin()
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error creating login options: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	if err := rt.storeWebAuthnSession(c, session); err != nil {
+		newJSONError(err, http.StatusInternalServerError).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, options.Response)
+}
+
+func (rt *router) postWebAuthnLogin(c *gin.Context) {
+	response, err := protocol.ParseCredentialRequestResponseBody(c.Request.Body)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	if l := <-rt.getLimiter().LinearThrottle(time.Second/2, "postWebAuthnLogin-*"); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error applying rate limit: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	ceremony, err := rt.webAuthnCeremony(c)
+	if err != nil {
+		newJSONError(err, http.StatusBadRequest).Pipe(c)
+		return
+	}
+
+	result, err := rt.database(c).LoginWebAuthn(response, ceremony)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error logging in: %w", err),
+			http.StatusUnauthorized,
+		).Pipe(c)
+		return
+	}
+
+	// a passkey is bound to the device and the relying party requires the
+	// authenticator to verify the user (e.g. using a PIN or biometrics), so it
+	// satisfies two factor authentication on its own
+	authCookie, authCookieErr := rt.newSession(c, result.AccountUserID, true)
+	if authCookieErr != nil {
+		newJSONError(authCookieErr, http.StatusInternalServerError).Pipe(c)
+		return
+	}
+
+	http.SetCookie(c.Writer, authCookie)
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,164 @@
+// Copyright 2020 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-contrib/location"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gorilla/securecookie"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockLoginWebAuthnDatabase struct {
+	persistence.Service
+	ceremony persistence.WebAuthnCeremony
+	result   persistence.LoginResult
+	err      error
+}
+
+func (m *mockLoginWebAuthnDatabase) LoginWebAuthn(response *protocol.ParsedCredentialAssertionData, ceremony persistence.WebAuthnCeremony) (persistence.LoginResult, error) {
+	m.ceremony = ceremony
+	return m.result, m.err
+}
+
+// newTestAssertion returns a well formed assertion. Its signature is not
+// valid, which is fine as verification is done by the database.
+func newTestAssertion() io.Reader {
+	encode := base64.RawURLEncoding.EncodeToString
+	rpIDHash := sha256.Sum256([]byte("localhost"))
+	clientData, _ := json.Marshal(map[string]string{
+		"type":      "webauthn.get",
+		"challenge": "challenge",
+		"origin":    "http://localhost:9876",
+	})
+	b, _ := json.Marshal(map[string]interface{}{
+		"id":    encode([]byte("abc")),
+		"rawId": encode([]byte("abc")),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    encode(clientData),
+			"authenticatorData": encode(append(rpIDHash[:], 1, 0, 0, 0, 1)),
+			"signature":         encode([]byte("signature")),
+			"userHandle":        encode([]byte("user-a")),
+		},
+	})
+	return strings.NewReader(string(b))
+}
+
+func (m *mockLoginWebAuthnDatabase) CreateSession(string, string, time.Duration) (string, error) {
+	return "session-a", nil
+}
+
+func TestRouter_postWebAuthnLogin(t *testing.T) {
+	tests := []struct {
+		name               string
+		db                 mockLoginWebAuthnDatabase
+		session            *webauthn.SessionData
+		body               io.Reader
+		expectedStatusCode int
+		expectAuthCookie   bool
+	}{
+		{
+			"bad payload",
+			mockLoginWebAuthnDatabase{},
+			&webauthn.SessionData{Challenge: "challenge"},
+			strings.NewReader(`{{88`),
+			http.StatusBadRequest,
+			false,
+		},
+		{
+			"missing challenge",
+			mockLoginWebAuthnDatabase{},
+			nil,
+			newTestAssertion(),
+			http.StatusBadRequest,
+			false,
+		},
+		{
+			"database error",
+			mockLoginWebAuthnDatabase{
+				err: errors.New("did not work"),
+			},
+			&webauthn.SessionData{Challenge: "challenge"},
+			newTestAssertion(),
+			http.StatusUnauthorized,
+			false,
+		},
+		{
+			"ok",
+			mockLoginWebAuthnDatabase{
+				result: persistence.LoginResult{AccountUserID: "user-a"},
+			},
+			&webauthn.SessionData{Challenge: "challenge"},
+			newTestAssertion(),
+			http.StatusOK,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cookieSigner := securecookie.New([]byte("abc"), nil)
+			rt := router{
+				config:  &config.Config{},
+				db:      &test.db,
+				signers: newSigners([]byte("abc"), 0),
+			}
+			m := gin.New()
+			m.Use(location.Default())
+			m.POST("/", rt.postWebAuthnLogin)
+			r := httptest.NewRequest(http.MethodPost, "http://localhost:9876/", test.body)
+			if test.session != nil {
+				ck, _ := rt.webAuthnCookie(test.session, false)
+				r.AddCookie(ck)
+			}
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+
+			var token *authToken
+			for _, ck := range w.Result().Cookies() {
+				if ck.Name != authKey {
+					continue
+				}
+				token = &authToken{}
+				if err := cookieSigner.Decode(authKey, ck.Value, token); err != nil {
+					t.Fatalf("Unexpected error decoding cookie %v", err)
+				}
+			}
+			if test.expectAuthCookie {
+				if token == nil {
+					t.Fatal("Expected auth cookie in response")
+				}
+				if token.AccountUserID != "user-a" || token.SessionID != "session-a" || !token.TOTPVerified {
+					t.Errorf("Unexpected token %v", token)
+				}
+				if test.db.ceremony.Session.Challenge != "challenge" {
+					t.Errorf("Unexpected session %v", test.db.ceremony.Session)
+				}
+				if rp := test.db.ceremony.RelyingParty; rp == nil || rp.Config.RPID != "localhost" || rp.Config.RPOrigin != "http://localhost:9876" {
+					t.Errorf("Unexpected relying party %v", rp)
+				}
+			} else if token != nil {
+				t.Errorf("Unexpected auth cookie %v", token)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/webhook"
+)
+
+func (rt *router) getWebhookDeliveries(c *gin.Context) {
+	if rt.webhooks == nil {
+		c.JSON(http.StatusOK, []webhook.Delivery{})
+		return
+	}
+	c.JSON(http.StatusOK, rt.webhooks.Deliveries())
+}
@@ -0,0 +1,66 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/webhook"
+)
+
+func TestRouter_getWebhookDeliveries(t *testing.T) {
+	t.Run("not configured", func(t *testing.T) {
+		rt := &router{config: &config.Config{}}
+		m := gin.New()
+		m.GET("/", rt.getWebhookDeliveries)
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+		if w.Body.String() != "[]" {
+			t.Errorf("Unexpected body %v", w.Body.String())
+		}
+	})
+	t.Run("configured", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		delivered := make(chan webhook.Delivery, 1)
+		d := webhook.New([]webhook.Endpoint{{URL: server.URL, Secret: "secret"}}, 1, func(delivery webhook.Delivery) {
+			delivered <- delivery
+		})
+		defer d.Close()
+		d.Notify(webhook.EventAccountRetired, nil)
+		select {
+		case <-delivered:
+		case <-time.After(time.Second * 5):
+			t.Fatal("Timed out waiting for delivery")
+		}
+
+		rt := &router{config: &config.Config{}, webhooks: d}
+		m := gin.New()
+		m.GET("/", rt.getWebhookDeliveries)
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+		var deliveries []webhook.Delivery
+		if err := json.Unmarshal(w.Body.Bytes(), &deliveries); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(deliveries) != 1 || !deliveries[0].Delivered || deliveries[0].URL != server.URL {
+			t.Errorf("Unexpected deliveries %v", deliveries)
+		}
+	})
+}
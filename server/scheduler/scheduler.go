@@ -0,0 +1,183 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package scheduler runs recurring background jobs inside the server process.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule describes when a job is supposed to run next.
+type Schedule interface {
+	Next(time.Time) time.Time
+}
+
+// Parse parses the given cron expression. Standard five field expressions
+// are supported, as well as descriptors like `@hourly` or `@every 10m`.
+func Parse(spec string) (Schedule, error) {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("scheduler: error parsing cron expression %s: %w", spec, err)
+	}
+	return schedule, nil
+}
+
+// Job is a named task that is run according to its schedule.
+type Job struct {
+	Name       string
+	Schedule   Schedule
+	RunOnStart bool
+	Run        func() error
+}
+
+// Locker is used to ensure a job is only run by a single instance in case
+// multiple instances share the same database. Acquire is expected to return
+// true if the caller has acquired the lock of the given name until the given
+// time.
+type Locker interface {
+	Acquire(name string, until time.Time) (bool, error)
+}
+
+// LockerFunc adapts an ordinary function to satisfy the Locker interface.
+type LockerFunc func(name string, until time.Time) (bool, error)
+
+// Acquire calls f.
+func (f LockerFunc) Acquire(name string, until time.Time) (bool, error) {
+	return f(name, until)
+}
+
+// Stats contains metrics about the past runs of a job.
+type Stats struct {
+	Name         string
+	Runs         int
+	Skipped      int
+	Failures     int
+	LastRun      time.Time
+	LastDuration time.Duration
+	LastError    error
+}
+
+// Scheduler runs the jobs it has been created with. Each run is delayed
+// by a random duration of up to the given jitter so that multiple instances
+// do not run the same job at the very same time. In case a Locker is given,
+// runs are skipped when another instance is already in charge of a job.
+type Scheduler struct {
+	jobs   []Job
+	jitter time.Duration
+	locker Locker
+	mu     sync.Mutex
+	stats  map[string]*Stats
+	random *rand.Rand
+}
+
+// New creates a new Scheduler for the given jobs. Passing a nil Locker will
+// run all jobs without coordinating with other instances.
+func New(jitter time.Duration, locker Locker, jobs ...Job) *Scheduler {
+	s := &Scheduler{
+		jobs:   jobs,
+		jitter: jitter,
+		locker: locker,
+		stats:  map[string]*Stats{},
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, job := range jobs {
+		s.stats[job.Name] = &Stats{Name: job.Name}
+	}
+	return s
+}
+
+// Start runs all jobs in the background until the given context is canceled.
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, job := range s.jobs {
+		go s.loop(ctx, job)
+	}
+}
+
+// Stats returns metrics for all jobs, sorted by name.
+func (s *Scheduler) Stats() []Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []Stats
+	for _, stats := range s.stats {
+		result = append(result, *stats)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	if job.RunOnStart {
+		s.execute(job, job.Schedule.Next(time.Now()))
+	}
+	for {
+		scheduled := job.Schedule.Next(time.Now())
+		timer := time.NewTimer(time.Until(scheduled) + s.jitterDuration())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			// the lock is held until the next scheduled run so that each
+			// interval is handled by exactly one instance
+			s.execute(job, job.Schedule.Next(scheduled))
+		}
+	}
+}
+
+func (s *Scheduler) execute(job Job, lockUntil time.Time) {
+	if s.locker != nil {
+		acquired, err := s.locker.Acquire(job.Name, lockUntil)
+		if err != nil {
+			s.record(job.Name, func(stats *Stats) {
+				stats.Failures++
+				stats.LastError = err
+			})
+			return
+		}
+		if !acquired {
+			s.record(job.Name, func(stats *Stats) {
+				stats.Skipped++
+			})
+			return
+		}
+	}
+
+	start := time.Now()
+	err := job.Run()
+	duration := time.Since(start)
+
+	s.record(job.Name, func(stats *Stats) {
+		stats.Runs++
+		stats.LastRun = start
+		stats.LastDuration = duration
+		stats.LastError = err
+		if err != nil {
+			stats.Failures++
+		}
+	})
+}
+
+func (s *Scheduler) record(name string, update func(*Stats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update(s.stats[name])
+}
+
+func (s *Scheduler) jitterDuration() time.Duration {
+	if s.jitter <= 0 {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Duration(s.random.Int63n(int64(s.jitter)))
+}
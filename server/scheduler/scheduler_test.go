@@ -0,0 +1,132 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		spec        string
+		expectError bool
+	}{
+		{"descriptor", "@hourly", false},
+		{"interval", "@every 10m", false},
+		{"expression", "30 3 * * 1-5", false},
+		{"bad expression", "every now and then", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(test.spec)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+		})
+	}
+}
+
+type everyMillisecond struct{}
+
+func (everyMillisecond) Next(t time.Time) time.Time {
+	return t.Add(time.Millisecond)
+}
+
+func TestScheduler(t *testing.T) {
+	results := make(chan struct{}, 8)
+	s := New(
+		time.Millisecond,
+		nil,
+		Job{
+			Name:       "ok",
+			Schedule:   everyMillisecond{},
+			RunOnStart: true,
+			Run: func() error {
+				select {
+				case results <- struct{}{}:
+				default:
+				}
+				return nil
+			},
+		},
+		Job{
+			Name:     "failing",
+			Schedule: everyMillisecond{},
+			Run: func() error {
+				return errors.New("did not work")
+			},
+		},
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+	for i := 0; i < 3; i++ {
+		select {
+		case <-results:
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for job to run")
+		}
+	}
+	time.Sleep(time.Millisecond * 20)
+	cancel()
+
+	stats := s.Stats()
+	if len(stats) != 2 {
+		t.Fatalf("Unexpected number of stats %d", len(stats))
+	}
+	if stats[0].Name != "failing" || stats[0].Failures == 0 || stats[0].Failures != stats[0].Runs || stats[0].LastError == nil {
+		t.Errorf("Unexpected stats %v", stats[0])
+	}
+	if stats[1].Name != "ok" || stats[1].Runs < 3 || stats[1].Failures != 0 || stats[1].LastRun.IsZero() {
+		t.Errorf("Unexpected stats %v", stats[1])
+	}
+}
+
+func TestScheduler_Locker(t *testing.T) {
+	var runs int
+	var mu sync.Mutex
+	locker := LockerFunc(func(name string, until time.Time) (bool, error) {
+		if name == "broken" {
+			return false, errors.New("did not work")
+		}
+		return name == "leader", nil
+	})
+	job := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		runs++
+		return nil
+	}
+	s := New(
+		0,
+		locker,
+		Job{Name: "leader", Schedule: everyMillisecond{}, RunOnStart: true, Run: job},
+		Job{Name: "follower", Schedule: everyMillisecond{}, RunOnStart: true, Run: job},
+		Job{Name: "broken", Schedule: everyMillisecond{}, RunOnStart: true, Run: job},
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+	time.Sleep(time.Millisecond * 20)
+	cancel()
+
+	stats := s.Stats()
+	if stats[0].Name != "broken" || stats[0].Runs != 0 || stats[0].Failures == 0 {
+		t.Errorf("Unexpected stats %v", stats[0])
+	}
+	if stats[1].Name != "follower" || stats[1].Runs != 0 || stats[1].Skipped == 0 {
+		t.Errorf("Unexpected stats %v", stats[1])
+	}
+	if stats[2].Name != "leader" || stats[2].Runs == 0 || stats[2].Skipped != 0 {
+		t.Errorf("Unexpected stats %v", stats[2])
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if runs != stats[2].Runs {
+		t.Errorf("Unexpected number of runs %d", runs)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package systemd implements the parts of the sd_notify protocol needed for
+// signaling service state and sending watchdog pings to systemd.
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// States that can be sent to systemd.
+const (
+	Ready     = "READY=1"
+	Reloading = "RELOADING=1"
+	Stopping  = "STOPPING=1"
+	Watchdog  = "WATCHDOG=1"
+)
+
+// Notify sends the given state to the socket systemd passes in NOTIFY_SOCKET.
+// In case the process is not run by systemd, Notify returns false and does
+// nothing.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	// a leading @ denotes a socket in the abstract namespace
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("systemd: error connecting to notify socket: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("systemd: error sending state %s: %w", state, err)
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns the interval in which systemd expects watchdog
+// pings. In case the watchdog is not enabled for the current process, a zero
+// duration is returned.
+func WatchdogInterval() (time.Duration, error) {
+	usec := os.Getenv("WATCHDOG_USEC")
+	if usec == "" {
+		return 0, nil
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+	value, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("systemd: invalid value %q for WATCHDOG_USEC", usec)
+	}
+	return time.Duration(value) * time.Microsecond, nil
+}
+
+// RunWatchdog sends a watchdog ping every half of the given interval until
+// the context is cancelled. Pings are only sent in case check does not
+// return an error, so systemd restarts the service once it stops being
+// healthy. Errors are passed to onError.
+func RunWatchdog(ctx context.Context, interval time.Duration, check func() error, onError func(error)) {
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := check(); err != nil {
+				onError(fmt.Errorf("systemd: skipping watchdog ping for failing health check: %w", err))
+				continue
+			}
+			if _, err := Notify(Watchdog); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package systemd
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func listen(t *testing.T) *net.UnixConn {
+	dir, err := ioutil.TempDir("", "offen-systemd")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	os.Setenv("NOTIFY_SOCKET", socket)
+	t.Cleanup(func() { os.Unsetenv("NOTIFY_SOCKET") })
+	return conn
+}
+
+func receive(t *testing.T, conn *net.UnixConn) string {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	b := make([]byte, 256)
+	n, err := conn.Read(b)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return string(b[:n])
+}
+
+func TestNotify(t *testing.T) {
+	t.Run("no socket", func(t *testing.T) {
+		os.Unsetenv("NOTIFY_SOCKET")
+		sent, err := Notify(Ready)
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if sent {
+			t.Error("Expected no state to be sent")
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		conn := listen(t)
+		sent, err := Notify(Ready)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if !sent {
+			t.Error("Expected state to be sent")
+		}
+		if state := receive(t, conn); state != Ready {
+			t.Errorf("Unexpected state %v", state)
+		}
+	})
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	defer os.Unsetenv("WATCHDOG_USEC")
+	defer os.Unsetenv("WATCHDOG_PID")
+	tests := []struct {
+		name          string
+		usec          string
+		pid           string
+		expectedValue time.Duration
+		expectError   bool
+	}{
+		{"disabled", "", "", 0, false},
+		{"ok", "30000000", "", time.Second * 30, false},
+		{"matching pid", "1000", strconv.Itoa(os.Getpid()), time.Millisecond, false},
+		{"other pid", "1000", "1", 0, false},
+		{"bad value", "abc", "", 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			os.Setenv("WATCHDOG_USEC", test.usec)
+			os.Setenv("WATCHDOG_PID", test.pid)
+			value, err := WatchdogInterval()
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if value != test.expectedValue {
+				t.Errorf("Expected %v, got %v", test.expectedValue, value)
+			}
+		})
+	}
+}
+
+func TestRunWatchdog(t *testing.T) {
+	conn := listen(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	healthy := make(chan error, 1)
+	healthy <- errors.New("did not work")
+	var failures int32
+	go RunWatchdog(ctx, time.Millisecond*20, func() error {
+		select {
+		case err := <-healthy:
+			return err
+		default:
+			return nil
+		}
+	}, func(err error) {
+		atomic.AddInt32(&failures, 1)
+	})
+
+	if state := receive(t, conn); state != Watchdog {
+		t.Errorf("Unexpected state %v", state)
+	}
+	cancel()
+	if failures := atomic.LoadInt32(&failures); failures != 1 {
+		t.Errorf("Expected one skipped ping, got %d", failures)
+	}
+}
@@ -0,0 +1,299 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package webhook notifies operators about events on an instance, e.g. an
+// account being retired, by sending signed HTTP requests to the URLs they
+// have configured.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// Events that are sent to webhooks
+const (
+	EventAccountRetired     = "account.retired"
+	EventRetentionCompleted = "retention.completed"
+	EventQuotaExhausted     = "quota.exhausted"
+	EventHealthDegraded     = "health.degraded"
+	EventHealthRecovered    = "health.recovered"
+)
+
+// Headers that are added to each request
+const (
+	HeaderEvent     = "X-Offen-Event"
+	HeaderDelivery  = "X-Offen-Delivery"
+	HeaderSignature = "X-Offen-Signature"
+	HeaderTimestamp = "X-Offen-Timestamp"
+)
+
+// Tolerance is the maximum difference between the timestamp of a request
+// and the receiver's clock that receivers are expected to accept. Rejecting
+// requests outside of this window prevents captured requests from being
+// replayed later on.
+const Tolerance = time.Minute * 5
+
+const (
+	defaultTimeout = time.Second * 10
+	// maxDeliveries is the number of deliveries kept for inspection.
+	maxDeliveries = 100
+)
+
+// Notifier sends notifications about events. Notify must not block.
+type Notifier interface {
+	Notify(event string, data interface{})
+}
+
+// Payload is the JSON encoded body of each request.
+type Payload struct {
+	DeliveryID string      `json:"deliveryId"`
+	Event      string      `json:"event"`
+	Created    time.Time   `json:"created"`
+	Data       interface{} `json:"data"`
+}
+
+// Delivery describes the outcome of sending a notification to a single URL.
+type Delivery struct {
+	DeliveryID string    `json:"deliveryId"`
+	Event      string    `json:"event"`
+	URL        string    `json:"url"`
+	Attempts   int       `json:"attempts"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Delivered  bool      `json:"delivered"`
+	Created    time.Time `json:"created"`
+	Finished   time.Time `json:"finished"`
+}
+
+// Endpoint is a URL notifications are sent to and the secret used for
+// signing the requests sent to it.
+type Endpoint struct {
+	URL    string
+	Secret string
+}
+
+// Sign returns the value of the signature header for the given timestamp
+// and body. It is the hex encoded HMAC-SHA256 of the timestamp, a dot and
+// the body using the given secret. Signing the timestamp allows receivers
+// to reject replayed requests.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks that the given signature and timestamp have been created
+// for the given body using the given secret and that the timestamp is within
+// Tolerance of now.
+func Verify(secret []byte, signature, timestamp string, body []byte, now time.Time) error {
+	if !hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body))) {
+		return errors.New("webhook: signature did not match")
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("webhook: error parsing timestamp: %w", err)
+	}
+	if math.Abs(now.Sub(time.Unix(seconds, 0)).Seconds()) > Tolerance.Seconds() {
+		return errors.New("webhook: timestamp is outside of tolerance window")
+	}
+	return nil
+}
+
+// Dispatcher sends notifications to all configured endpoints in the
+// background. Failed requests are retried using an exponential backoff.
+type Dispatcher struct {
+	endpoints   []Endpoint
+	maxAttempts int
+	backoff     time.Duration
+	client      *http.Client
+	onDelivery  func(Delivery)
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+	lock        sync.Mutex
+	deliveries  []Delivery
+}
+
+// New creates a Dispatcher that sends notifications to the given endpoints,
+// trying each one at most maxAttempts times. onDelivery is called with the
+// outcome of each delivery once it has succeeded or all attempts have failed.
+func New(endpoints []Endpoint, maxAttempts int, onDelivery func(Delivery)) *Dispatcher {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		endpoints:   endpoints,
+		maxAttempts: maxAttempts,
+		backoff:     time.Second,
+		client:      &http.Client{Timeout: defaultTimeout},
+		onDelivery:  onDelivery,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Notify sends the given event to all endpoints. Data is JSON encoded and
+// sent as part of the payload.
+func (d *Dispatcher) Notify(event string, data interface{}) {
+	for _, endpoint := range d.endpoints {
+		deliveryID, err := uuid.NewV4()
+		if err != nil {
+			d.finish(Delivery{Event: event, URL: endpoint.URL, Error: err.Error(), Created: time.Now()})
+			continue
+		}
+		payload := Payload{
+			DeliveryID: deliveryID.String(),
+			Event:      event,
+			Created:    time.Now().UTC(),
+			Data:       data,
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			d.finish(Delivery{DeliveryID: payload.DeliveryID, Event: event, URL: endpoint.URL, Error: err.Error(), Created: payload.Created})
+			continue
+		}
+		d.wg.Add(1)
+		go func(endpoint Endpoint) {
+			defer d.wg.Done()
+			d.deliver(endpoint, payload, body)
+		}(endpoint)
+	}
+}
+
+func (d *Dispatcher) deliver(endpoint Endpoint, payload Payload, body []byte) {
+	delivery := Delivery{
+		DeliveryID: payload.DeliveryID,
+		Event:      payload.Event,
+		URL:        endpoint.URL,
+		Created:    payload.Created,
+	}
+	backoff := d.backoff
+	for {
+		delivery.Attempts++
+		status, retry, err := d.send(endpoint, payload, body)
+		delivery.StatusCode = status
+		if err == nil {
+			delivery.Delivered = true
+			delivery.Error = ""
+			break
+		}
+		delivery.Error = err.Error()
+		if !retry || delivery.Attempts >= d.maxAttempts {
+			break
+		}
+		select {
+		case <-d.ctx.Done():
+			delivery.Error = fmt.Sprintf("%s, giving up as dispatcher has been closed", delivery.Error)
+			d.finish(delivery)
+			return
+		case <-time.After(backoff):
+			backoff *= 2
+		}
+	}
+	d.finish(delivery)
+}
+
+// send performs a single request, returning whether a failed request is
+// worth retrying. Each attempt is signed using the current time, so retried
+// requests are not rejected by receivers enforcing a tolerance window.
+func (d *Dispatcher) send(endpoint Endpoint, payload Payload, body []byte) (int, bool, error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, fmt.Errorf("webhook: error creating request: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, payload.Event)
+	req.Header.Set(HeaderDelivery, payload.DeliveryID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign([]byte(endpoint.Secret), timestamp, body))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, true, fmt.Errorf("webhook: error sending request: %w", err)
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 1024))
+
+	if res.StatusCode >= http.StatusOK && res.StatusCode < http.StatusMultipleChoices {
+		return res.StatusCode, false, nil
+	}
+	// client errors other than rate limiting will not go away when retrying
+	retry := res.StatusCode >= http.StatusInternalServerError || res.StatusCode == http.StatusTooManyRequests
+	return res.StatusCode, retry, fmt.Errorf("webhook: received unexpected status code %d", res.StatusCode)
+}
+
+func (d *Dispatcher) finish(delivery Delivery) {
+	delivery.Finished = time.Now().UTC()
+	d.lock.Lock()
+	d.deliveries = append(d.deliveries, delivery)
+	if len(d.deliveries) > maxDeliveries {
+		d.deliveries = d.deliveries[len(d.deliveries)-maxDeliveries:]
+	}
+	d.lock.Unlock()
+	if d.onDelivery != nil {
+		d.onDelivery(delivery)
+	}
+}
+
+// Deliveries returns the most recent deliveries that have been finished,
+// newest first.
+func (d *Dispatcher) Deliveries() []Delivery {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	result := make([]Delivery, 0, len(d.deliveries))
+	for i := len(d.deliveries) - 1; i >= 0; i-- {
+		result = append(result, d.deliveries[i])
+	}
+	return result
+}
+
+// Close aborts pending retries and waits for all requests in flight to
+// finish.
+func (d *Dispatcher) Close() {
+	d.cancel()
+	d.wg.Wait()
+}
+
+// WatchHealth calls check in the given interval until the context is
+// cancelled and notifies n each time the result changes from healthy to
+// failing and back.
+func WatchHealth(ctx context.Context, interval time.Duration, check func() error, n Notifier) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var failing bool
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := check()
+			switch {
+			case err != nil && !failing:
+				failing = true
+				n.Notify(EventHealthDegraded, map[string]string{"error": err.Error()})
+			case err == nil && failing:
+				failing = false
+				n.Notify(EventHealthRecovered, map[string]string{})
+			}
+		}
+	}
+}
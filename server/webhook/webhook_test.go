@@ -0,0 +1,217 @@
+// Copyright 2021 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	result := Sign([]byte("secret"), "1615723200", []byte(`{"event":"account.retired"}`))
+	if result != "sha256=18bd847f52aae2f3716dfdbbbc308a8eb1c36e7fcfb48f9313e09e145ce3e42d" {
+		t.Errorf("Unexpected signature %v", result)
+	}
+	if result == Sign([]byte("other"), "1615723200", []byte(`{"event":"account.retired"}`)) {
+		t.Error("Expected signature to depend on secret")
+	}
+	if result == Sign([]byte("secret"), "1615723201", []byte(`{"event":"account.retired"}`)) {
+		t.Error("Expected signature to depend on timestamp")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1615723200, 0)
+	body := []byte(`{"event":"account.retired"}`)
+	tests := []struct {
+		name        string
+		signature   string
+		timestamp   string
+		expectError bool
+	}{
+		{
+			"ok",
+			Sign([]byte("secret"), "1615723200", body),
+			"1615723200",
+			false,
+		},
+		{
+			"within tolerance",
+			Sign([]byte("secret"), "1615723000", body),
+			"1615723000",
+			false,
+		},
+		{
+			"bad signature",
+			Sign([]byte("other"), "1615723200", body),
+			"1615723200",
+			true,
+		},
+		{
+			"replayed timestamp",
+			Sign([]byte("secret"), "1615723200", body),
+			"1615723201",
+			true,
+		},
+		{
+			"outside tolerance",
+			Sign([]byte("secret"), "1615722000", body),
+			"1615722000",
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Verify([]byte("secret"), test.signature, test.timestamp, body, now)
+			if test.expectError != (err != nil) {
+				t.Errorf("Unexpected error value %v", err)
+			}
+		})
+	}
+}
+
+func TestDispatcher_Notify(t *testing.T) {
+	tests := []struct {
+		name              string
+		statusCodes       []int
+		maxAttempts       int
+		expectedAttempts  int
+		expectedDelivered bool
+	}{
+		{
+			"ok",
+			[]int{http.StatusNoContent},
+			3,
+			1,
+			true,
+		},
+		{
+			"retried",
+			[]int{http.StatusBadGateway, http.StatusTooManyRequests, http.StatusOK},
+			3,
+			3,
+			true,
+		},
+		{
+			"attempts exceeded",
+			[]int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway},
+			2,
+			2,
+			false,
+		},
+		{
+			"client error",
+			[]int{http.StatusNotFound, http.StatusOK},
+			3,
+			1,
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var lock sync.Mutex
+			var requests int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				if err := Verify([]byte("secret"), r.Header.Get(HeaderSignature), r.Header.Get(HeaderTimestamp), body, time.Now()); err != nil {
+					t.Errorf("Unexpected error verifying signature %v", err)
+				}
+				if r.Header.Get(HeaderEvent) != EventAccountRetired {
+					t.Errorf("Unexpected event header %v", r.Header.Get(HeaderEvent))
+				}
+				var payload Payload
+				if err := json.Unmarshal(body, &payload); err != nil {
+					t.Errorf("Unexpected error %v", err)
+				}
+				if payload.DeliveryID != r.Header.Get(HeaderDelivery) {
+					t.Errorf("Unexpected delivery id %v", payload.DeliveryID)
+				}
+				if !reflect.DeepEqual(payload.Data, map[string]interface{}{"accountId": "account-a"}) {
+					t.Errorf("Unexpected data %v", payload.Data)
+				}
+				lock.Lock()
+				status := test.statusCodes[requests]
+				requests++
+				lock.Unlock()
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+
+			delivered := make(chan Delivery, 1)
+			d := New([]Endpoint{{URL: server.URL, Secret: "secret"}}, test.maxAttempts, func(delivery Delivery) {
+				delivered <- delivery
+			})
+			d.backoff = time.Millisecond
+			defer d.Close()
+
+			d.Notify(EventAccountRetired, map[string]string{"accountId": "account-a"})
+			var delivery Delivery
+			select {
+			case delivery = <-delivered:
+			case <-time.After(time.Second * 5):
+				t.Fatal("Timed out waiting for delivery")
+			}
+			if delivery.Attempts != test.expectedAttempts {
+				t.Errorf("Expected %d attempts, got %d", test.expectedAttempts, delivery.Attempts)
+			}
+			if delivery.Delivered != test.expectedDelivered {
+				t.Errorf("Expected delivered to be %v, got %v", test.expectedDelivered, delivery.Delivered)
+			}
+			if delivery.URL != server.URL || delivery.Event != EventAccountRetired {
+				t.Errorf("Unexpected delivery %v", delivery)
+			}
+			if deliveries := d.Deliveries(); len(deliveries) != 1 || deliveries[0].DeliveryID != delivery.DeliveryID {
+				t.Errorf("Unexpected deliveries %v", deliveries)
+			}
+		})
+	}
+}
+
+type mockNotifier struct {
+	events chan string
+}
+
+func (m *mockNotifier) Notify(event string, data interface{}) {
+	m.events <- event
+}
+
+func TestWatchHealth(t *testing.T) {
+	var lock sync.Mutex
+	results := []error{nil, errors.New("did not work"), errors.New("did not work"), nil}
+	check := func() error {
+		lock.Lock()
+		defer lock.Unlock()
+		if len(results) == 0 {
+			return nil
+		}
+		result := results[0]
+		results = results[1:]
+		return result
+	}
+	n := &mockNotifier{events: make(chan string, 10)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go WatchHealth(ctx, time.Millisecond, check, n)
+
+	var events []string
+	for len(events) < 2 {
+		select {
+		case event := <-n.events:
+			events = append(events, event)
+		case <-time.After(time.Second * 5):
+			t.Fatalf("Timed out waiting for events, got %v", events)
+		}
+	}
+	if !reflect.DeepEqual(events, []string{EventHealthDegraded, EventHealthRecovered}) {
+		t.Errorf("Unexpected events %v", events)
+	}
+}
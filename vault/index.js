@@ -22,7 +22,7 @@ register('EVENT',
   middleware.optIn,
   middleware.eventDuplexer,
   function (event, respond, next) {
-    handler.handleAnalyticsEvent(event.data)
+    handler.handleAnalyticsEvent(event.data, event.origin)
       .then(function () {
         console.log(__('This page is using Offen to collect usage statistics.'))
         console.log(__('You can access and manage all of your personal data or opt-out at "%s/auditorium/".', window.location.origin))
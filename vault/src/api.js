@@ -53,12 +53,17 @@ exports.postEvent = postEventWith(window.location.origin + '/api/events')
 exports.postEventWith = postEventWith
 
 function postEventWith (eventsUrl) {
-  return function (accountId, payload) {
+  return function (accountId, payload, origin) {
     var url = new window.URL(eventsUrl)
+    var headers = {}
+    if (origin) {
+      headers['X-Offen-Origin'] = origin
+    }
     return window
       .fetch(url, {
         method: 'POST',
         credentials: 'include',
+        headers: headers,
         body: JSON.stringify({
           accountId: accountId,
           payload: payload
@@ -16,10 +16,10 @@ exports.handleAnalyticsEvent = handleAnalyticsEventWith(relayEvent)
 exports.handleAnalyticsEventWith = handleAnalyticsEventWith
 
 function handleAnalyticsEventWith (relayEvent) {
-  return function (message) {
+  return function (message, origin) {
     var accountId = message.payload.accountId
     var event = message.payload.event
-    return relayEvent(accountId, event, false)
+    return relayEvent(accountId, event, origin)
   }
 }
 
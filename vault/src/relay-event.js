@@ -13,12 +13,14 @@ module.exports.relayEventWith = relayEventWith
 // relayEvent transmits the given event to the server API associating it with
 // the given accountId. It ensures a local user secret exists for the given
 // accountId and uses it to encrypt the event payload before performing the request.
+// The origin of the embedding page is passed on so the server can check it
+// against the account's domains.
 function relayEventWith (api, ensureUserSecret) {
-  var relayEvent = bindCrypto(function (accountId, payload) {
+  var relayEvent = bindCrypto(function (accountId, payload, origin) {
     var crypto = this
     // `flush` is not supposed to be part of the public signature, but will only
     // be used when the function recursively calls itself
-    var flush = arguments[2] || false
+    var flush = arguments[3] || false
     return ensureUserSecret(accountId, flush)
       .then(crypto.encryptSymmetricWith)
       .then(function (encryptEventPayload) {
@@ -26,13 +28,13 @@ function relayEventWith (api, ensureUserSecret) {
       })
       .then(function (encryptedEventPayload) {
         return api
-          .postEvent(accountId, encryptedEventPayload)
+          .postEvent(accountId, encryptedEventPayload, origin)
           .catch(function (err) {
             // a 400 response is sent in case no cookie is present in the request.
             // This means the secret exchange can happen one more time
             // before retrying to send the event.
             if (err.status === 400 && !flush) {
-              return relayEvent(accountId, payload, true)
+              return relayEvent(accountId, payload, origin, true)
             }
             throw err
           })
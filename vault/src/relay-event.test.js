@@ -33,11 +33,12 @@ describe('src/relay-event.js', function () {
     it('sends an augmented and encrypted event payload to the server', function (done) {
       let err
       var mockApi = {
-        postEvent: function (accountId, payload) {
+        postEvent: function (accountId, payload, origin) {
           try {
             assert(payload)
             assert.notStrictEqual(payload, 'data')
             assert.strictEqual(accountId, 'account-id-token')
+            assert.strictEqual(origin, 'https://www.example.net')
           } catch (_err) {
             err = _err
           }
@@ -45,7 +46,7 @@ describe('src/relay-event.js', function () {
         }
       }
       var relayEvent = relayEventWith(mockApi, mockEnsureUserSecret)
-      relayEvent('account-id-token', { payload: 'data' })
+      relayEvent('account-id-token', { payload: 'data' }, 'https://www.example.net')
         .then(function () {
           done(err)
         })